@@ -0,0 +1,160 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides an agent loop over the Responses API.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTokenBudget is returned by RunAgent when the responses have used
+// AgentOptions.MaxTotalTokens and the agent is not done.
+var ErrTokenBudget = errors.New("agent exceeded token budget")
+
+// MCPApprovalRequest is a call to an MCP tool that the backend holds until
+// it is approved.
+type MCPApprovalRequest struct {
+	ID          string
+	ServerLabel string
+	Name        string
+	Arguments   string
+}
+
+// AgentOptions controls RunAgent. The embedded RunToolsOptions control the
+// local tools and bound the number of responses with MaxSteps.
+type AgentOptions struct {
+	RunToolsOptions
+
+	// MaxTotalTokens, if positive, bounds the total tokens of all responses.
+	// Each request's MaxOutputTokens is lowered to what remains.
+	MaxTotalTokens int
+
+	// Approve decides the MCP tool calls that need approval. Without it
+	// every such call is denied.
+	Approve func(ctx context.Context, req MCPApprovalRequest) (bool, error)
+
+	// OnItem, if set, is called with each output item as it is received,
+	// including the MCP calls and tool listings the backend ran.
+	OnItem func(item ResponseItem)
+}
+
+// AgentResult is the outcome of an agent loop.
+type AgentResult struct {
+	// Response is the last response
+	Response *Response
+	// Items is the conversation: the request input, every output item, and
+	// every function call output and approval sent back.
+	Items []ResponseItem
+	// Steps is the number of responses created.
+	Steps int
+	// Usage is summed over all responses.
+	Usage ResponseUsage
+}
+
+// RunAgent runs a Responses API agent loop mixing local Go tools with MCP
+// tools. The registry's tools are offered as function tools next to
+// req.Tools, which may include "mcp" tools (see MCPTool) for the backend to
+// run. Each response's function calls are executed with registry, MCP
+// approval requests are decided by opts.Approve, and the results are sent
+// back with the conversation so far until a response needs neither.
+//
+// ErrMaxToolSteps or ErrTokenBudget is returned, together with the result so
+// far, when a limit is reached first. A failed response returns its
+// *ResponseError.
+func RunAgent(ctx context.Context, client ResponsesClient, req ResponseRequest, registry *ToolRegistry, opts AgentOptions) (*AgentResult, error) {
+	if registry == nil {
+		registry = NewToolRegistry()
+	}
+	req.Tools = append(append([]ResponseTool(nil), req.Tools...), functionTools(registry, req.Tools)...)
+	result := &AgentResult{Items: append([]ResponseItem(nil), req.Input...)}
+	maxOutputTokens := req.MaxOutputTokens
+
+	for {
+		if opts.MaxTotalTokens > 0 {
+			remaining := opts.MaxTotalTokens - result.Usage.TotalTokens
+			if remaining <= 0 {
+				return result, ErrTokenBudget
+			}
+			req.MaxOutputTokens = capTokens(maxOutputTokens, remaining)
+		}
+		req.Input = result.Items
+		resp, err := client.CreateResponse(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		result.Response = resp
+		result.Steps++
+		result.Usage = ResponseUsage{
+			InputTokens:  result.Usage.InputTokens + resp.Usage.InputTokens,
+			OutputTokens: result.Usage.OutputTokens + resp.Usage.OutputTokens,
+			TotalTokens:  result.Usage.TotalTokens + resp.Usage.TotalTokens,
+		}
+		result.Items = append(result.Items, resp.Output...)
+		if resp.Error != nil {
+			return result, resp.Error
+		}
+
+		var calls []ToolCall
+		var approvals []MCPApprovalRequest
+		for _, item := range resp.Output {
+			if opts.OnItem != nil {
+				opts.OnItem(item)
+			}
+			switch item.Type {
+			case "function_call":
+				calls = append(calls, ToolCall{ID: item.CallID, Type: "function", Function: FunctionCall{Name: item.Name, Arguments: item.Arguments}})
+			case "mcp_approval_request":
+				approvals = append(approvals, MCPApprovalRequest{ID: item.ID, ServerLabel: item.ServerLabel, Name: item.Name, Arguments: item.Arguments})
+			}
+		}
+		if len(calls) == 0 && len(approvals) == 0 {
+			return result, nil
+		}
+		if result.Steps >= opts.maxSteps() {
+			return result, ErrMaxToolSteps
+		}
+
+		for _, approval := range approvals {
+			approve := false
+			if opts.Approve != nil {
+				if approve, err = opts.Approve(ctx, approval); err != nil {
+					return result, fmt.Errorf("approving %s on %s: %w", approval.Name, approval.ServerLabel, err)
+				}
+			}
+			result.Items = append(result.Items, MCPApprovalResponse(approval.ID, approve))
+		}
+		if len(calls) > 0 {
+			messages, err := registry.execute(ctx, calls, opts.RunToolsOptions)
+			for _, msg := range messages {
+				output, _ := msg.Content.(string)
+				result.Items = append(result.Items, ResponseItem{Type: "function_call_output", CallID: msg.ToolCallID, Output: output})
+			}
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+}
+
+// functionTools returns the registry's tools as Responses API function
+// tools, except those named in tools
+func functionTools(registry *ToolRegistry, tools []ResponseTool) []ResponseTool {
+	var fns []ResponseTool
+	for _, tool := range registry.Tools() {
+		named := false
+		for _, t := range tools {
+			named = named || (t.Type == "function" && t.Name == tool.Function.Name)
+		}
+		if !named {
+			fns = append(fns, ResponseTool{
+				Type:        "function",
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			})
+		}
+	}
+	return fns
+}
@@ -0,0 +1,116 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// responsesFunc adapts a function to ResponsesClient.
+type responsesFunc func(ctx context.Context, req ResponseRequest) (*Response, error)
+
+func (f responsesFunc) CreateResponse(ctx context.Context, req ResponseRequest) (*Response, error) {
+	return f(ctx, req)
+}
+
+// decodeResponse decodes a response as a client would, keeping item JSON
+func decodeResponse(t *testing.T, data string) *Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return &resp
+}
+
+// TestRunAgent tests that local function calls and MCP approvals are answered
+// until the final response
+func TestRunAgent(t *testing.T) {
+	var requests []ResponseRequest
+	client := responsesFunc(func(ctx context.Context, req ResponseRequest) (*Response, error) {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			return decodeResponse(t, `{"id":"r1","status":"completed","usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15},"output":[
+				{"type":"mcp_list_tools","id":"l1","server_label":"docs","tools":[{"name":"search","input_schema":{}}]},
+				{"type":"mcp_approval_request","id":"a1","server_label":"docs","name":"search","arguments":"{\"q\":\"paris\"}"},
+				{"type":"function_call","id":"f1","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}","status":"completed"}]}`), nil
+		}
+		return decodeResponse(t, `{"id":"r2","status":"completed","usage":{"input_tokens":20,"output_tokens":5,"total_tokens":25},"output":[
+			{"type":"mcp_call","id":"m1","server_label":"docs","name":"search","arguments":"{}","output":"found","status":"completed"},
+			{"type":"message","id":"msg1","role":"assistant","status":"completed","content":[{"type":"output_text","text":"Sunny in Paris.","annotations":[]}]}]}`), nil
+	})
+
+	var approved []MCPApprovalRequest
+	var items []string
+	req := ResponseRequest{Model: "m", Input: []ResponseItem{UserInput("Weather in Paris?")}, Tools: []ResponseTool{MCPTool("docs", "http://mcp", "always")}}
+	result, err := RunAgent(context.Background(), client, req, weatherRegistry(), AgentOptions{
+		Approve: func(ctx context.Context, req MCPApprovalRequest) (bool, error) {
+			approved = append(approved, req)
+			return true, nil
+		},
+		OnItem: func(item ResponseItem) { items = append(items, item.Type) },
+	})
+	if err != nil {
+		t.Fatalf("RunAgent() error: %v", err)
+	}
+	if result.Steps != 2 || result.Usage.TotalTokens != 40 || result.Response.OutputText() != "Sunny in Paris." {
+		t.Errorf("result = %d steps, %+v, %q", result.Steps, result.Usage, result.Response.OutputText())
+	}
+	if len(approved) != 1 || approved[0].ID != "a1" || approved[0].Name != "search" {
+		t.Errorf("approvals = %+v", approved)
+	}
+	if len(items) != 5 {
+		t.Errorf("items seen = %v, want all 5 output items", items)
+	}
+
+	tools := requests[0].Tools
+	if len(tools) != 2 || tools[0].Type != "mcp" || tools[1].Type != "function" || tools[1].Name != "get_weather" {
+		t.Errorf("tools = %+v, want the MCP tool and the local tool", tools)
+	}
+
+	// The second request replays the conversation with the answers appended
+	input := requests[1].Input
+	if len(input) != 6 {
+		t.Fatalf("second input has %d items, want 6", len(input))
+	}
+	data, _ := json.Marshal(input[1])
+	if string(data) != `{"type":"mcp_list_tools","id":"l1","server_label":"docs","tools":[{"name":"search","input_schema":{}}]}` {
+		t.Errorf("replayed item = %s, want the original JSON", data)
+	}
+	if input[4].Type != "mcp_approval_response" || input[4].ApprovalRequestID != "a1" || !*input[4].Approve {
+		t.Errorf("approval response = %+v", input[4])
+	}
+	if input[5].Type != "function_call_output" || input[5].CallID != "call_1" || input[5].Output != "sunny" {
+		t.Errorf("function call output = %+v", input[5])
+	}
+}
+
+// TestRunAgentLimits tests the step limit, the token budget, and denial
+// without an approver
+func TestRunAgentLimits(t *testing.T) {
+	var requests []ResponseRequest
+	client := responsesFunc(func(ctx context.Context, req ResponseRequest) (*Response, error) {
+		requests = append(requests, req)
+		return decodeResponse(t, `{"id":"r","status":"completed","usage":{"total_tokens":40},"output":[
+			{"type":"mcp_approval_request","id":"a1","server_label":"docs","name":"search","arguments":"{}"}]}`), nil
+	})
+	req := ResponseRequest{Model: "m", Input: []ResponseItem{UserInput("hi")}}
+
+	result, err := RunAgent(context.Background(), client, req, nil, AgentOptions{RunToolsOptions: RunToolsOptions{MaxSteps: 2}})
+	if !errors.Is(err, ErrMaxToolSteps) || result.Steps != 2 {
+		t.Errorf("RunAgent() = %d steps, %v; want 2 steps, ErrMaxToolSteps", result.Steps, err)
+	}
+	if denial := requests[1].Input[2]; denial.Type != "mcp_approval_response" || *denial.Approve {
+		t.Errorf("approval response = %+v, want a denial", denial)
+	}
+
+	requests = nil
+	result, err = RunAgent(context.Background(), client, req, nil, AgentOptions{MaxTotalTokens: 100})
+	if !errors.Is(err, ErrTokenBudget) || result.Steps != 3 {
+		t.Errorf("RunAgent() = %d steps, %v; want 3 steps, ErrTokenBudget", result.Steps, err)
+	}
+	if got := *requests[2].MaxOutputTokens; got != 20 {
+		t.Errorf("last max_output_tokens = %d, want the remaining 20", got)
+	}
+}
@@ -0,0 +1,365 @@
+// Package anthropic converts between Anthropic's Messages API format and SMG
+// chat completions, so that clients speaking the Messages API can be served
+// by SMG workers:
+//
+//	var req anthropic.MessagesRequest
+//	json.Unmarshal(body, &req)
+//	chatReq, err := anthropic.ChatRequest(req)
+//	...
+//	resp, err := client.CreateChatCompletion(ctx, chatReq)
+//	...
+//	json.Marshal(anthropic.MessagesResponseFrom(resp))
+//
+// Streams are converted chunk by chunk with a StreamConverter.
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// MessagesRequest is a Messages API request. Fields the chat completion API
+// has no equivalent for are not decoded.
+type MessagesRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	// System is the system prompt, a string or text blocks
+	System        Content     `json:"system,omitempty"`
+	MaxTokens     int         `json:"max_tokens"`
+	Temperature   *float32    `json:"temperature,omitempty"`
+	TopP          *float32    `json:"top_p,omitempty"`
+	TopK          *int        `json:"top_k,omitempty"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Stream        bool        `json:"stream,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice `json:"tool_choice,omitempty"`
+	Metadata      *Metadata   `json:"metadata,omitempty"`
+}
+
+// Message is a user or assistant turn.
+type Message struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content is a list of content blocks. It decodes from a string as well, as
+// a single text block.
+type Content []ContentBlock
+
+// UnmarshalJSON decodes a string or a list of blocks.
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Content{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// text returns the text of the content's text blocks
+func (c Content) text() string {
+	var texts []string
+	for _, block := range c {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ContentBlock is a block of message content. Type is "text", "image",
+// "tool_use", or "tool_result"; the other fields are set as the type needs.
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Source is the image of an "image" block
+	Source *ImageSource `json:"source,omitempty"`
+
+	// ID, Name, and Input are the call of a "tool_use" block
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// ToolUseID, Content, and IsError are the outcome of a "tool_result"
+	// block
+	ToolUseID string  `json:"tool_use_id,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	IsError   bool    `json:"is_error,omitempty"`
+}
+
+// ImageSource is the image of an "image" block: base64 data or a URL.
+type ImageSource struct {
+	// Type is "base64" or "url"
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// Tool is a client tool the model may call.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// ToolChoice controls tool use. Type is "auto", "any", "tool" (with Name),
+// or "none".
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// Metadata describes the request.
+type Metadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// MessagesResponse is a Messages API response.
+type MessagesResponse struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Role         string         `json:"role"`
+	Model        string         `json:"model"`
+	Content      []ContentBlock `json:"content"`
+	StopReason   string         `json:"stop_reason"`
+	StopSequence *string        `json:"stop_sequence"`
+	Usage        Usage          `json:"usage"`
+}
+
+// Usage counts the tokens of a response.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ChatRequest converts a Messages API request to a chat completion request.
+// The system prompt becomes a system message, tool_use blocks become the
+// assistant's tool calls, and tool_result blocks become tool messages ahead
+// of the rest of their user turn. Invalid requests return an error matching
+// smg.ErrInvalidRequest.
+func ChatRequest(req MessagesRequest) (smg.ChatCompletionRequest, error) {
+	if req.MaxTokens <= 0 {
+		return smg.ChatCompletionRequest{}, invalid("max_tokens must be positive")
+	}
+	if len(req.Messages) == 0 {
+		return smg.ChatCompletionRequest{}, invalid("messages must not be empty")
+	}
+	maxTokens := req.MaxTokens
+	chatReq := smg.ChatCompletionRequest{
+		Model:               req.Model,
+		Temperature:         req.Temperature,
+		TopP:                req.TopP,
+		TopK:                req.TopK,
+		MaxCompletionTokens: &maxTokens,
+		Stream:              req.Stream,
+	}
+	if req.Stream {
+		// The final message_delta event reports usage
+		includeUsage := true
+		chatReq.StreamOptions = &smg.StreamOptions{IncludeUsage: &includeUsage}
+	}
+	if len(req.StopSequences) > 0 {
+		chatReq.Stop = req.StopSequences
+	}
+	if req.Metadata != nil {
+		chatReq.User = req.Metadata.UserID
+	}
+
+	if system := req.System.text(); system != "" {
+		chatReq.Messages = append(chatReq.Messages, smg.SystemText(system))
+	}
+	for i, msg := range req.Messages {
+		var messages []smg.ChatMessage
+		var err error
+		switch msg.Role {
+		case "user":
+			messages, err = userMessages(msg.Content)
+		case "assistant":
+			messages, err = assistantMessages(msg.Content)
+		default:
+			err = fmt.Errorf("role must be user or assistant, got %q", msg.Role)
+		}
+		if err != nil {
+			return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("messages[%d]: %v", i, err))
+		}
+		chatReq.Messages = append(chatReq.Messages, messages...)
+	}
+
+	for _, tool := range req.Tools {
+		parameters := tool.InputSchema
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		chatReq.Tools = append(chatReq.Tools, smg.Tool{
+			Type:     "function",
+			Function: smg.Function{Name: tool.Name, Description: tool.Description, Parameters: parameters},
+		})
+	}
+	if req.ToolChoice != nil {
+		switch req.ToolChoice.Type {
+		case "auto", "none":
+			chatReq.ToolChoice = req.ToolChoice.Type
+		case "any":
+			chatReq.ToolChoice = "required"
+		case "tool":
+			chatReq.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": req.ToolChoice.Name},
+			}
+		default:
+			return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("unknown tool_choice type %q", req.ToolChoice.Type))
+		}
+	}
+	return chatReq, nil
+}
+
+// userMessages converts a user turn: a tool message for each tool result,
+// then a user message with the remaining content, if any
+func userMessages(content Content) ([]smg.ChatMessage, error) {
+	var messages []smg.ChatMessage
+	var parts []smg.ContentPart
+	hasImage := false
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, smg.TextPart(block.Text))
+		case "image":
+			url, err := imageURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, smg.ImagePart(url))
+			hasImage = true
+		case "tool_result":
+			result := block.Content.text()
+			if block.IsError {
+				result = "Error: " + result
+			}
+			messages = append(messages, smg.ToolResult(block.ToolUseID, result))
+		default:
+			return nil, fmt.Errorf("unsupported user content block %q", block.Type)
+		}
+	}
+	switch {
+	case hasImage:
+		messages = append(messages, smg.UserParts(parts...))
+	case len(parts) > 0:
+		messages = append(messages, smg.UserText(content.text()))
+	}
+	return messages, nil
+}
+
+// assistantMessages converts an assistant turn to one message with its text
+// and tool calls
+func assistantMessages(content Content) ([]smg.ChatMessage, error) {
+	msg := smg.AssistantText(content.text())
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, smg.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: smg.FunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		default:
+			return nil, fmt.Errorf("unsupported assistant content block %q", block.Type)
+		}
+	}
+	return []smg.ChatMessage{msg}, nil
+}
+
+// imageURL returns the URL, or data URL, of an image source
+func imageURL(source *ImageSource) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("image block has no source")
+	}
+	switch source.Type {
+	case "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case "url":
+		return source.URL, nil
+	}
+	return "", fmt.Errorf("unsupported image source type %q", source.Type)
+}
+
+// MessagesResponseFrom converts a chat completion to a Messages API
+// response: a text block for the content and a tool_use block for each tool
+// call of the first choice.
+func MessagesResponseFrom(resp *smg.ChatCompletionResponse) *MessagesResponse {
+	out := &MessagesResponse{
+		ID:      messageID(resp.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []ContentBlock{},
+		Usage:   Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+	}
+	if len(resp.Choices) == 0 {
+		out.StopReason = "end_turn"
+		return out
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != "" {
+		out.Content = append(out.Content, ContentBlock{Type: "text", Text: choice.Message.Content})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		out.Content = append(out.Content, ContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: toolInput(call.Function.Arguments),
+		})
+	}
+	out.StopReason = StopReason(choice.FinishReason)
+	return out
+}
+
+// StopReason converts a chat completion finish reason to a Messages API stop
+// reason.
+func StopReason(finishReason smg.FinishReason) string {
+	switch finishReason {
+	case smg.FinishReasonLength:
+		return "max_tokens"
+	case smg.FinishReasonToolCalls:
+		return "tool_use"
+	case smg.FinishReasonContentFilter:
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// toolInput returns tool call arguments as a tool_use input, which must be
+// a JSON object; arguments that are not become an empty object
+func toolInput(arguments string) json.RawMessage {
+	var input map[string]interface{}
+	if json.Unmarshal([]byte(arguments), &input) != nil || input == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// messageID returns a Messages API message ID for a chat completion ID
+func messageID(id string) string {
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+func invalid(message string) error {
+	return fmt.Errorf("%w: %s", smg.ErrInvalidRequest, message)
+}
@@ -0,0 +1,115 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// TestChatRequest tests the conversion of roles, images, and tool blocks
+func TestChatRequest(t *testing.T) {
+	var req MessagesRequest
+	body := `{
+		"model": "claude",
+		"max_tokens": 64,
+		"system": [{"type": "text", "text": "Be brief."}],
+		"stop_sequences": ["END"],
+		"tools": [{"name": "weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "tool", "name": "weather"},
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBO"}},
+				{"type": "text", "text": "Where is this?"}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "sunny"},
+				{"type": "text", "text": "And tomorrow?"}
+			]}
+		]
+	}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	chatReq, err := ChatRequest(req)
+	if err != nil {
+		t.Fatalf("ChatRequest() error: %v", err)
+	}
+
+	if chatReq.Model != "claude" || *chatReq.MaxCompletionTokens != 64 || chatReq.Stop.([]string)[0] != "END" {
+		t.Errorf("request = %+v", chatReq)
+	}
+	if choice := chatReq.ToolChoice.(map[string]interface{}); choice["type"] != "function" || len(chatReq.Tools) != 1 {
+		t.Errorf("tool choice = %v, tools = %+v", choice, chatReq.Tools)
+	}
+	msgs := chatReq.Messages
+	if len(msgs) != 5 {
+		t.Fatalf("got %d messages, want 5: %+v", len(msgs), msgs)
+	}
+	if msgs[0].Role != "system" || msgs[0].Content != "Be brief." {
+		t.Errorf("system message = %+v", msgs[0])
+	}
+	parts, ok := msgs[1].Content.([]smg.ContentPart)
+	if !ok || len(parts) != 2 || parts[0].ImageURL.URL != "data:image/png;base64,iVBO" || parts[1].Text != "Where is this?" {
+		t.Errorf("image message = %+v", msgs[1])
+	}
+	want := smg.ToolCall{ID: "toolu_1", Type: "function", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city": "Paris"}`}}
+	if msgs[2].Role != "assistant" || msgs[2].Content != "Checking." || len(msgs[2].ToolCalls) != 1 || msgs[2].ToolCalls[0] != want {
+		t.Errorf("assistant message = %+v", msgs[2])
+	}
+	if msgs[3].Role != "tool" || msgs[3].ToolCallID != "toolu_1" || msgs[3].Content != "sunny" {
+		t.Errorf("tool message = %+v", msgs[3])
+	}
+	if msgs[4].Role != "user" || msgs[4].Content != "And tomorrow?" {
+		t.Errorf("last message = %+v", msgs[4])
+	}
+
+	for _, bad := range []string{
+		`{"model": "m", "messages": [{"role": "user", "content": "hi"}]}`,
+		`{"model": "m", "max_tokens": 8, "messages": [{"role": "system", "content": "hi"}]}`,
+		`{"model": "m", "max_tokens": 8, "messages": [{"role": "user", "content": "hi"}], "tool_choice": {"type": "some"}}`,
+	} {
+		var req MessagesRequest
+		json.Unmarshal([]byte(bad), &req)
+		if _, err := ChatRequest(req); !errors.Is(err, smg.ErrInvalidRequest) {
+			t.Errorf("ChatRequest(%s) error = %v, want ErrInvalidRequest", bad, err)
+		}
+	}
+}
+
+// TestMessagesResponseFrom tests the conversion of content, tool calls, stop
+// reasons, and usage
+func TestMessagesResponseFrom(t *testing.T) {
+	resp := MessagesResponseFrom(&smg.ChatCompletionResponse{
+		ID:    "chatcmpl-42",
+		Model: "m",
+		Choices: []smg.Choice{{
+			Message: smg.Message{Content: "Let me check.", ToolCalls: []smg.ToolCall{
+				{ID: "call_1", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+				{ID: "call_2", Function: smg.FunctionCall{Name: "time", Arguments: `not json`}},
+			}},
+			FinishReason: "tool_calls",
+		}},
+		Usage: smg.Usage{PromptTokens: 10, CompletionTokens: 5},
+	})
+	data, _ := json.Marshal(resp)
+	want := `{"id":"msg_42","type":"message","role":"assistant","model":"m","content":[` +
+		`{"type":"text","text":"Let me check."},` +
+		`{"type":"tool_use","id":"call_1","name":"weather","input":{"city":"Paris"}},` +
+		`{"type":"tool_use","id":"call_2","name":"time","input":{}}],` +
+		`"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":5}}`
+	if string(data) != want {
+		t.Errorf("response =\n%s\nwant\n%s", data, want)
+	}
+
+	for finish, want := range map[smg.FinishReason]string{"stop": "end_turn", "length": "max_tokens", "content_filter": "refusal"} {
+		if got := StopReason(finish); got != want {
+			t.Errorf("StopReason(%q) = %q, want %q", finish, got, want)
+		}
+	}
+}
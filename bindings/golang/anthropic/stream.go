@@ -0,0 +1,200 @@
+package anthropic
+
+import (
+	"encoding/json"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// StreamEvent is a Messages API stream event.
+type StreamEvent struct {
+	// Type is the event name, e.g. "content_block_delta"
+	Type string
+	// Data is the JSON payload, which repeats the type
+	Data []byte
+}
+
+// SSE returns the event formatted as a server-sent event.
+func (e StreamEvent) SSE() string {
+	return "event: " + e.Type + "\ndata: " + string(e.Data) + "\n\n"
+}
+
+// ErrorEvent returns an "error" event, sent in place of the remaining events
+// when a stream fails. errType is a Messages API error type such as
+// "api_error" or "overloaded_error".
+func ErrorEvent(errType, message string) StreamEvent {
+	return event("error", map[string]interface{}{
+		"error": map[string]interface{}{"type": errType, "message": message},
+	})
+}
+
+func event(eventType string, payload map[string]interface{}) StreamEvent {
+	payload["type"] = eventType
+	data, _ := json.Marshal(payload)
+	return StreamEvent{Type: eventType, Data: data}
+}
+
+// streamChunk is the part of a chat completion stream chunk that events are
+// built from
+type streamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason smg.FinishReason `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// StreamConverter converts the chunks of a chat completion stream to
+// Messages API events. Content deltas go to a text block and each tool call
+// to a tool_use block; a block is stopped when the next one starts. Feed it
+// every chunk with Chunk, then call Finish once the stream ends.
+//
+// Streams need usage (see smg.StreamOptions) for message_delta to report
+// token counts; ChatRequest asks for it.
+type StreamConverter struct {
+	model   string
+	started bool
+	// blocks counts the blocks started; open is the index of the block
+	// being streamed, or -1
+	blocks int
+	open   int
+	text   bool
+	// calls maps tool call indexes to their block indexes
+	calls      map[int]int
+	stopReason string
+	usage      Usage
+}
+
+// NewStreamConverter returns a converter for one stream. model, if not
+// empty, is reported instead of the model named by the chunks.
+func NewStreamConverter(model string) *StreamConverter {
+	return &StreamConverter{model: model, open: -1, calls: make(map[int]int)}
+}
+
+// Chunk returns the events for one chunk, as returned by RecvJSON. The
+// first chunk also yields message_start.
+func (c *StreamConverter) Chunk(chunkJSON string) ([]StreamEvent, error) {
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	if !c.started {
+		events = append(events, c.start(chunk.ID, chunk.Model))
+	}
+	if chunk.Usage != nil {
+		c.usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if c.open < 0 || !c.text {
+				events = append(events, c.stop()...)
+				events = append(events, c.startBlock(true, map[string]interface{}{"type": "text", "text": ""}))
+			}
+			events = append(events, event("content_block_delta", map[string]interface{}{
+				"index": c.open,
+				"delta": map[string]interface{}{"type": "text_delta", "text": choice.Delta.Content},
+			}))
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			index, ok := c.calls[tc.Index]
+			if !ok {
+				events = append(events, c.stop()...)
+				events = append(events, c.startBlock(false, map[string]interface{}{
+					"type": "tool_use", "id": tc.ID, "name": tc.Function.Name, "input": map[string]interface{}{},
+				}))
+				index = c.open
+				c.calls[tc.Index] = index
+			}
+			if tc.Function.Arguments != "" {
+				events = append(events, event("content_block_delta", map[string]interface{}{
+					"index": index,
+					"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": tc.Function.Arguments},
+				}))
+			}
+		}
+		if choice.FinishReason != "" {
+			c.stopReason = StopReason(choice.FinishReason)
+		}
+	}
+	return events, nil
+}
+
+// Finish returns the events ending the message: the open block's stop,
+// message_delta with the stop reason and usage, and message_stop.
+func (c *StreamConverter) Finish() []StreamEvent {
+	var events []StreamEvent
+	if !c.started {
+		events = append(events, c.start("", ""))
+	}
+	events = append(events, c.stop()...)
+	stopReason := c.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	events = append(events,
+		event("message_delta", map[string]interface{}{
+			"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+			"usage": c.usage,
+		}),
+		event("message_stop", map[string]interface{}{}),
+	)
+	return events
+}
+
+// Usage returns the usage reported by the stream so far.
+func (c *StreamConverter) Usage() Usage {
+	return c.usage
+}
+
+func (c *StreamConverter) start(id, model string) StreamEvent {
+	c.started = true
+	if c.model != "" {
+		model = c.model
+	}
+	return event("message_start", map[string]interface{}{
+		"message": map[string]interface{}{
+			"id":            messageID(id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []ContentBlock{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         Usage{},
+		},
+	})
+}
+
+// startBlock starts the next content block
+func (c *StreamConverter) startBlock(text bool, block map[string]interface{}) StreamEvent {
+	c.open = c.blocks
+	c.blocks++
+	c.text = text
+	return event("content_block_start", map[string]interface{}{"index": c.open, "content_block": block})
+}
+
+// stop stops the open block, if any
+func (c *StreamConverter) stop() []StreamEvent {
+	if c.open < 0 {
+		return nil
+	}
+	index := c.open
+	c.open = -1
+	return []StreamEvent{event("content_block_stop", map[string]interface{}{"index": index})}
+}
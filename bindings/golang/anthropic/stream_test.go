@@ -0,0 +1,75 @@
+package anthropic
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestStreamConverter tests the event sequence for text followed by a tool
+// call
+func TestStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-7","model":"m","choices":[{"delta":{"role":"assistant","content":"Let me"}}]}`,
+		`{"id":"chatcmpl-7","model":"m","choices":[{"delta":{"content":" check."}}]}`,
+		`{"id":"chatcmpl-7","model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-7","model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-7","model":"m","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+	}
+	c := NewStreamConverter("alias")
+	var events []StreamEvent
+	for _, chunk := range chunks {
+		evs, err := c.Chunk(chunk)
+		if err != nil {
+			t.Fatalf("Chunk(%s) error: %v", chunk, err)
+		}
+		events = append(events, evs...)
+	}
+	events = append(events, c.Finish()...)
+
+	want := []string{
+		`{"message":{"content":[],"id":"msg_7","model":"alias","role":"assistant","stop_reason":null,"stop_sequence":null,"type":"message","usage":{"input_tokens":0,"output_tokens":0}},"type":"message_start"}`,
+		`{"content_block":{"text":"","type":"text"},"index":0,"type":"content_block_start"}`,
+		`{"delta":{"text":"Let me","type":"text_delta"},"index":0,"type":"content_block_delta"}`,
+		`{"delta":{"text":" check.","type":"text_delta"},"index":0,"type":"content_block_delta"}`,
+		`{"index":0,"type":"content_block_stop"}`,
+		`{"content_block":{"id":"call_1","input":{},"name":"weather","type":"tool_use"},"index":1,"type":"content_block_start"}`,
+		`{"delta":{"partial_json":"{\"city\":\"Paris\"}","type":"input_json_delta"},"index":1,"type":"content_block_delta"}`,
+		`{"index":1,"type":"content_block_stop"}`,
+		`{"delta":{"stop_reason":"tool_use","stop_sequence":null},"type":"message_delta","usage":{"input_tokens":10,"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d:\n%s", len(events), len(want), sse(events))
+	}
+	for i := range want {
+		if string(events[i].Data) != want[i] {
+			t.Errorf("event %d = %s, want %s", i, events[i].Data, want[i])
+		}
+	}
+	if got := events[2].SSE(); !strings.HasPrefix(got, "event: content_block_delta\ndata: {") || !strings.HasSuffix(got, "}\n\n") {
+		t.Errorf("SSE() = %q", got)
+	}
+	if _, err := c.Chunk("not json"); err == nil {
+		t.Error("Chunk(not json) succeeded, want error")
+	}
+}
+
+// TestStreamConverterEmpty tests a stream that ends without chunks
+func TestStreamConverterEmpty(t *testing.T) {
+	events := NewStreamConverter("m").Finish()
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if got := strings.Join(types, ","); got != "message_start,message_delta,message_stop" {
+		t.Errorf("events = %s", got)
+	}
+}
+
+func sse(events []StreamEvent) string {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString(e.SSE())
+	}
+	return b.String()
+}
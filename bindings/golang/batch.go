@@ -0,0 +1,139 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides a parallel map over chat completion requests.
+package smg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMapConcurrency is the number of requests Map runs at once when
+// MapOptions.Concurrency is not set.
+const DefaultMapConcurrency = 8
+
+// MapOptions controls Map.
+type MapOptions struct {
+	// Concurrency is the maximum number of requests in flight. Defaults to
+	// DefaultMapConcurrency.
+	Concurrency int
+	// Retry controls retrying failed requests. The zero value makes one
+	// attempt per request.
+	Retry RetryPolicy
+}
+
+// RetryPolicy controls retries of failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per request, including
+	// the first. Values below 2 disable retries.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles for each later
+	// retry, up to MaxBackoff if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether a failed attempt should be retried. The
+	// default retries every error except ErrInvalidRequest and context errors.
+	Retryable func(err error) bool
+}
+
+// MapResult is the outcome of one request of Map.
+type MapResult struct {
+	Response *ChatCompletionResponse
+	Err      error
+	// Attempts is the number of requests made; 0 if the context was done
+	// before the first
+	Attempts int
+}
+
+// Map sends requests through client, at most opts.Concurrency at a time, and
+// returns their results in input order. A failed request does not stop the
+// others; its error is in its result. Requests not started before ctx is done
+// fail with ctx.Err().
+//
+//	results := smg.Map(ctx, client, requests, smg.MapOptions{
+//	    Concurrency: 32,
+//	    Retry:       smg.RetryPolicy{MaxAttempts: 3, Backoff: time.Second},
+//	})
+//	for i, result := range results {
+//	    if result.Err != nil {
+//	        log.Printf("row %d: %v", i, result.Err)
+//	    }
+//	}
+func Map(ctx context.Context, client ChatClient, requests []ChatCompletionRequest, opts MapOptions) []MapResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultMapConcurrency
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	// A fixed pool of workers rather than a goroutine per request keeps
+	// memory flat for large inputs
+	results := make([]MapResult, len(requests))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = opts.Retry.do(ctx, func() (*ChatCompletionResponse, error) {
+					return client.CreateChatCompletion(ctx, requests[i])
+				})
+			}
+		}()
+	}
+	for i := range requests {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// do calls send until it succeeds, fails with an error not worth retrying, or
+// runs out of attempts
+func (p RetryPolicy) do(ctx context.Context, send func() (*ChatCompletionResponse, error)) MapResult {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = defaultRetryable
+	}
+
+	var result MapResult
+	backoff := p.Backoff
+	for {
+		if err := ctx.Err(); err != nil {
+			if result.Err == nil {
+				result.Err = err
+			}
+			return result
+		}
+		result.Attempts++
+		result.Response, result.Err = send()
+		if result.Err == nil || result.Attempts >= p.MaxAttempts || !retryable(result.Err) {
+			return result
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return result
+			}
+			backoff *= 2
+			if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	}
+}
+
+func defaultRetryable(err error) bool {
+	return !errors.Is(err, ErrInvalidRequest) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,104 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// funcClient answers each request with a function
+type funcClient func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
+
+func (f funcClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return f(ctx, req)
+}
+
+func (f funcClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	return nil, errors.New("streams are not supported")
+}
+
+// TestMap tests ordering, the concurrency limit, retries, and per-item errors
+func TestMap(t *testing.T) {
+	var inFlight, peak int32
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		prompt := req.Messages[0].Content.(string)
+		mu.Lock()
+		attempts[prompt]++
+		attempt := attempts[prompt]
+		mu.Unlock()
+		switch {
+		case prompt == "row 3" && attempt < 2:
+			return nil, ErrNoHealthyWorkers
+		case prompt == "row 5":
+			return nil, invalidRequest("bad row")
+		}
+		return &ChatCompletionResponse{Choices: []Choice{{Message: Message{Content: prompt}}}}, nil
+	})
+
+	requests := make([]ChatCompletionRequest, 20)
+	for i := range requests {
+		requests[i] = ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: fmt.Sprintf("row %d", i)}}}
+	}
+	results := Map(context.Background(), client, requests, MapOptions{
+		Concurrency: 4,
+		Retry:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+	})
+
+	if len(results) != len(requests) {
+		t.Fatalf("got %d results, want %d", len(results), len(requests))
+	}
+	for i, result := range results {
+		switch i {
+		case 5:
+			if !errors.Is(result.Err, ErrInvalidRequest) || result.Attempts != 1 {
+				t.Errorf("result 5 = %+v, want one attempt failing with ErrInvalidRequest", result)
+			}
+		default:
+			want := fmt.Sprintf("row %d", i)
+			if result.Err != nil || result.Response.Choices[0].Message.Content != want {
+				t.Errorf("result %d = %+v, want %q", i, result, want)
+			}
+		}
+	}
+	if results[3].Attempts != 2 {
+		t.Errorf("result 3 attempts = %d, want 2", results[3].Attempts)
+	}
+	if peak > 4 {
+		t.Errorf("peak concurrency = %d, want at most 4", peak)
+	}
+}
+
+// TestMapCanceled tests that requests not started fail with the context error
+func TestMapCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		cancel()
+		return &ChatCompletionResponse{}, nil
+	})
+
+	results := Map(ctx, client, make([]ChatCompletionRequest, 5), MapOptions{Concurrency: 1})
+	if results[0].Err != nil || results[0].Attempts != 1 {
+		t.Errorf("result 0 = %+v, want success", results[0])
+	}
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) || result.Attempts != 0 {
+			t.Errorf("result = %+v, want canceled before any attempt", result)
+		}
+	}
+}
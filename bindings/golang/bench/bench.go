@@ -0,0 +1,152 @@
+// Package bench generates load against a ChatClient and measures it: time
+// to first token (TTFT), time per output token (TPOT), end-to-end latency,
+// and throughput. It backs the smg-bench command and the package's Go
+// benchmarks, and can drive any client, e.g. a MultiClient, an HTTPClient,
+// or a client wrapped in middleware.
+//
+// Example:
+//
+//	reqs, err := bench.LoadDataset("prompts.jsonl", "default", 256)
+//	results := bench.Run(ctx, client, reqs, bench.Options{NumRequests: 1000, Concurrency: 64, Rate: 20})
+//	bench.Summarize(results).Print(os.Stdout)
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// Options controls Run.
+type Options struct {
+	// NumRequests is the number of requests sent, cycling through the
+	// requests given to Run
+	NumRequests int
+	// Concurrency bounds the requests in flight. Defaults to 1.
+	Concurrency int
+	// Rate is the mean arrival rate in requests per second, with
+	// exponentially distributed gaps (a Poisson process); 0 sends each
+	// request as soon as a slot is free
+	Rate float64
+	// Seed seeds the arrival process
+	Seed int64
+}
+
+// Result is the measurement of one request.
+type Result struct {
+	Start time.Time
+	// TTFT is the time to the first output; TPOT the mean time per output
+	// token after it
+	TTFT    time.Duration
+	TPOT    time.Duration
+	Latency time.Duration
+	// InputTokens and OutputTokens are the usage the backend reported.
+	// Without usage, OutputTokens counts the chunks with output.
+	InputTokens  int
+	OutputTokens int
+	Err          error
+}
+
+// Run sends opts.NumRequests requests through client, cycling through reqs,
+// and measures each with Measure. Results are in send order. When ctx is
+// done, no more requests are sent and the results of those sent are
+// returned.
+func Run(ctx context.Context, client smg.ChatClient, reqs []smg.ChatCompletionRequest, opts Options) []Result {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	results := make([]Result, opts.NumRequests)
+	slots := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+
+	next := time.Now()
+	for i := 0; i < opts.NumRequests; i++ {
+		if opts.Rate > 0 {
+			next = next.Add(time.Duration(rng.ExpFloat64() / opts.Rate * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				wg.Wait()
+				return results[:i]
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results[:i]
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = Measure(ctx, client, reqs[i%len(reqs)])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// Measure streams req through client and times its output. The request
+// should ask for usage in its StreamOptions, as LoadDataset's requests do,
+// for OutputTokens to be exact.
+func Measure(ctx context.Context, client smg.ChatClient, req smg.ChatCompletionRequest) Result {
+	r := Result{Start: time.Now()}
+	req.Stream = true
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer stream.Close()
+
+	var first time.Time
+	var chunks int
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		var chunk smg.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			r.Err = err
+			return r
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" && choice.Delta.ReasoningContent == "" && len(choice.Delta.ToolCalls) == 0 {
+				continue
+			}
+			if first.IsZero() {
+				first = time.Now()
+			}
+			chunks++
+		}
+		if chunk.Usage != nil {
+			r.InputTokens = chunk.Usage.PromptTokens
+			r.OutputTokens = chunk.Usage.CompletionTokens
+		}
+	}
+	end := time.Now()
+	r.Latency = end.Sub(r.Start)
+	if first.IsZero() {
+		return r
+	}
+	r.TTFT = first.Sub(r.Start)
+	if r.OutputTokens == 0 {
+		r.OutputTokens = chunks
+	}
+	if r.OutputTokens > 1 {
+		r.TPOT = end.Sub(first) / time.Duration(r.OutputTokens-1)
+	}
+	return r
+}
@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// fakeStream returns its chunks, one per delay
+type fakeStream struct {
+	chunks []string
+	delay  time.Duration
+}
+
+func (s *fakeStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", io.EOF
+	}
+	time.Sleep(s.delay)
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+// fakeClient streams three tokens with usage, and fails requests for "bad"
+type fakeClient struct {
+	inFlight, maxInFlight int32
+}
+
+func (c *fakeClient) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (c *fakeClient) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	if req.Model == "bad" {
+		return nil, smg.ErrNoHealthyWorkers
+	}
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return &fakeStream{delay: time.Millisecond, chunks: []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"a"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"b"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"c"},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+	}}, nil
+}
+
+// TestRun tests measuring requests and summarizing them
+func TestRun(t *testing.T) {
+	client := &fakeClient{}
+	reqs := []smg.ChatCompletionRequest{{Model: "m"}, {Model: "m"}, {Model: "bad"}}
+	results := Run(context.Background(), client, reqs, Options{NumRequests: 6, Concurrency: 2})
+	if client.maxInFlight > 2 {
+		t.Errorf("%d requests in flight, want at most 2", client.maxInFlight)
+	}
+
+	rep := Summarize(results)
+	if rep.Requests != 6 || rep.Failed != 2 || rep.Errors[smg.ErrNoHealthyWorkers.Error()] != 2 {
+		t.Errorf("report = %+v", rep)
+	}
+	r := results[0]
+	if r.Err != nil || r.OutputTokens != 3 || r.InputTokens != 5 || r.TTFT <= 0 || r.TPOT <= 0 || r.Latency < r.TTFT {
+		t.Errorf("result = %+v", r)
+	}
+	if rep.OutputThroughput <= 0 || rep.TTFT.P99 < rep.TTFT.P50 || rep.Latency.Max <= 0 {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+// TestPercentile tests nearest-rank percentiles
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	if p := Percentile(sorted, 50); p != 50 {
+		t.Errorf("p50 = %d, want 50", p)
+	}
+	if p := Percentile(sorted, 99); p != 99 {
+		t.Errorf("p99 = %d, want 99", p)
+	}
+	if p := Percentile(sorted[:1], 90); p != 1 {
+		t.Errorf("p90 of one value = %d, want 1", p)
+	}
+}
+
+// TestLoadDataset tests reading prompts and chats
+func TestLoadDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.jsonl")
+	data := `{"prompt":"hi"}
+
+{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"why?"}],"max_tokens":8}
+`
+	os.WriteFile(path, []byte(data), 0o644)
+	reqs, err := LoadDataset(path, "m", 64)
+	if err != nil {
+		t.Fatalf("LoadDataset() error: %v", err)
+	}
+	if len(reqs) != 2 || len(reqs[0].Messages) != 1 || *reqs[0].MaxCompletionTokens != 64 || len(reqs[1].Messages) != 2 || *reqs[1].MaxCompletionTokens != 8 || !reqs[1].Stream {
+		t.Errorf("requests = %+v", reqs)
+	}
+
+	os.WriteFile(path, []byte(`{"max_tokens":8}`), 0o644)
+	if _, err := LoadDataset(path, "m", 64); err == nil {
+		t.Error("LoadDataset() of an entry without a prompt succeeded")
+	}
+}
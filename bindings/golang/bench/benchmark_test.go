@@ -0,0 +1,162 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// streamClient streams n content chunks and a usage chunk without delay
+type streamClient struct {
+	chunks []string
+}
+
+func newStreamClient(n int) *streamClient {
+	c := &streamClient{}
+	c.chunks = append(c.chunks, `{"id":"c","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant"}}]}`)
+	for i := 0; i < n; i++ {
+		c.chunks = append(c.chunks, fmt.Sprintf(`{"id":"c","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"tok%d "}}]}`, i))
+	}
+	c.chunks = append(c.chunks, fmt.Sprintf(`{"id":"c","choices":[],"usage":{"prompt_tokens":16,"completion_tokens":%d,"total_tokens":%d}}`, n, n+16))
+	return c
+}
+
+func (c *streamClient) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	return nil, fmt.Errorf("not used")
+}
+
+func (c *streamClient) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	return &fakeStream{chunks: c.chunks}, nil
+}
+
+// benchRequest returns a short chat request
+func benchRequest() smg.ChatCompletionRequest {
+	maxTokens, include := 1, true
+	return smg.ChatCompletionRequest{
+		Model:               "default",
+		Messages:            []smg.ChatMessage{{Role: "user", Content: "Reply with one word."}},
+		MaxCompletionTokens: &maxTokens,
+		StreamOptions:       &smg.StreamOptions{IncludeUsage: &include},
+	}
+}
+
+// BenchmarkDecodeChunk benchmarks decoding a streamed chunk
+func BenchmarkDecodeChunk(b *testing.B) {
+	chunk := []byte(`{"id":"c","object":"chat.completion.chunk","created":1,"model":"default","choices":[{"index":0,"delta":{"content":"hello"}}],"sequence_number":7}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var resp smg.ChatCompletionStreamResponse
+		if err := json.Unmarshal(chunk, &resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMeasure benchmarks decoding and timing a stream of 256 tokens
+func BenchmarkMeasure(b *testing.B) {
+	client := newStreamClient(256)
+	req := benchRequest()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if r := Measure(context.Background(), client, req); r.Err != nil || r.OutputTokens != 256 {
+			b.Fatalf("result = %+v", r)
+		}
+	}
+}
+
+// BenchmarkRun benchmarks the overhead of the harness at high concurrency
+func BenchmarkRun(b *testing.B) {
+	client := newStreamClient(8)
+	reqs := []smg.ChatCompletionRequest{benchRequest()}
+	b.ReportAllocs()
+	b.ResetTimer()
+	results := Run(context.Background(), client, reqs, Options{NumRequests: b.N, Concurrency: 64})
+	b.StopTimer()
+	if rep := Summarize(results); rep.Failed != 0 {
+		b.Fatalf("report = %+v", rep)
+	}
+}
+
+// benchTokenizer opens the tokenizer at SGL_TOKENIZER_PATH, skipping the
+// benchmark if it is not set
+func benchTokenizer(b *testing.B) *smg.Tokenizer {
+	path := os.Getenv("SGL_TOKENIZER_PATH")
+	if path == "" {
+		b.Skip("SGL_TOKENIZER_PATH not set")
+	}
+	tok, err := smg.NewTokenizer(path)
+	if err != nil {
+		b.Fatalf("Failed to create tokenizer: %v", err)
+	}
+	b.Cleanup(func() { tok.Close() })
+	return tok
+}
+
+// BenchmarkTokenizerEncode benchmarks encoding text through the FFI
+func BenchmarkTokenizerEncode(b *testing.B) {
+	tok := benchTokenizer(b)
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 64)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tok.Encode(text, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCountPromptTokens benchmarks applying the chat template and
+// counting the prompt through the FFI
+func BenchmarkCountPromptTokens(b *testing.B) {
+	tok := benchTokenizer(b)
+	req := benchRequest()
+	req.Messages = []smg.ChatMessage{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: strings.Repeat("Summarize this sentence. ", 32)},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tok.CountPromptTokens(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMultiClient benchmarks routing one-token requests across the
+// workers at SGL_GRPC_ENDPOINTS, skipping the benchmark if it is not set
+func BenchmarkMultiClient(b *testing.B) {
+	endpoints := os.Getenv("SGL_GRPC_ENDPOINTS")
+	tokenizerPath := os.Getenv("SGL_TOKENIZER_PATH")
+	if endpoints == "" || tokenizerPath == "" {
+		b.Skip("SGL_GRPC_ENDPOINTS or SGL_TOKENIZER_PATH not set")
+	}
+	for _, policy := range []string{"round_robin", "cache_aware"} {
+		b.Run(policy, func(b *testing.B) {
+			client, err := smg.NewMultiClient(smg.MultiClientConfig{
+				Endpoints:     endpoints,
+				TokenizerPath: tokenizerPath,
+				PolicyName:    policy,
+			})
+			if err != nil {
+				b.Fatalf("Failed to create client: %v", err)
+			}
+			defer client.Close()
+
+			req := benchRequest()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if r := Measure(context.Background(), client, req); r.Err != nil {
+						b.Error(r.Err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
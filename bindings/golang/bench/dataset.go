@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// entry is a line of a dataset: a prompt, sent as a user message, or the
+// messages of a chat, with an optional output length
+type entry struct {
+	Prompt    string            `json:"prompt"`
+	Messages  []smg.ChatMessage `json:"messages"`
+	MaxTokens int               `json:"max_tokens"`
+}
+
+// LoadDataset reads the JSONL dataset at path into streaming requests for
+// model that ask for usage. Each line holds a "prompt" string, sent as a
+// user message, or a "messages" array, and optionally "max_tokens"; entries
+// without it generate up to maxTokens tokens.
+func LoadDataset(path, model string, maxTokens int) ([]smg.ChatCompletionRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs []smg.ChatCompletionRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		req, err := e.request(model, maxTokens)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("%s: no prompts", path)
+	}
+	return reqs, nil
+}
+
+func (e entry) request(model string, maxTokens int) (smg.ChatCompletionRequest, error) {
+	messages := e.Messages
+	if len(messages) == 0 {
+		if e.Prompt == "" {
+			return smg.ChatCompletionRequest{}, fmt.Errorf("entry has neither prompt nor messages")
+		}
+		messages = []smg.ChatMessage{smg.UserText(e.Prompt)}
+	}
+	if e.MaxTokens > 0 {
+		maxTokens = e.MaxTokens
+	}
+	include := true
+	return smg.ChatCompletionRequest{
+		Model:               model,
+		Messages:            messages,
+		MaxCompletionTokens: &maxTokens,
+		Stream:              true,
+		StreamOptions:       &smg.StreamOptions{IncludeUsage: &include},
+	}, nil
+}
@@ -0,0 +1,133 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Distribution summarizes a metric over the successful requests, in
+// milliseconds.
+type Distribution struct {
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// Report summarizes a benchmark run.
+type Report struct {
+	Requests int     `json:"requests"`
+	Failed   int     `json:"failed"`
+	Duration float64 `json:"duration_s"`
+	// Throughputs are per second of the whole run
+	RequestThroughput float64 `json:"request_throughput"`
+	InputThroughput   float64 `json:"input_token_throughput"`
+	OutputThroughput  float64 `json:"output_token_throughput"`
+
+	TTFT    Distribution `json:"ttft"`
+	TPOT    Distribution `json:"tpot"`
+	Latency Distribution `json:"e2e_latency"`
+	// Errors counts the failures by message
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// Summarize reports on results.
+func Summarize(results []Result) Report {
+	rep := Report{Requests: len(results)}
+	var start, end time.Time
+	var ttft, tpot, latency []time.Duration
+	var input, output int
+	for _, r := range results {
+		if start.IsZero() || r.Start.Before(start) {
+			start = r.Start
+		}
+		if finish := r.Start.Add(r.Latency); finish.After(end) {
+			end = finish
+		}
+		if r.Err != nil {
+			rep.Failed++
+			if rep.Errors == nil {
+				rep.Errors = make(map[string]int)
+			}
+			rep.Errors[r.Err.Error()]++
+			continue
+		}
+		input += r.InputTokens
+		output += r.OutputTokens
+		latency = append(latency, r.Latency)
+		if r.TTFT > 0 {
+			ttft = append(ttft, r.TTFT)
+		}
+		if r.TPOT > 0 {
+			tpot = append(tpot, r.TPOT)
+		}
+	}
+
+	if d := end.Sub(start).Seconds(); d > 0 {
+		rep.Duration = d
+		rep.RequestThroughput = float64(rep.Requests-rep.Failed) / d
+		rep.InputThroughput = float64(input) / d
+		rep.OutputThroughput = float64(output) / d
+	}
+	rep.TTFT = distributionOf(ttft)
+	rep.TPOT = distributionOf(tpot)
+	rep.Latency = distributionOf(latency)
+	return rep
+}
+
+// distributionOf summarizes values, in milliseconds
+func distributionOf(values []time.Duration) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, v := range sorted {
+		sum += v
+	}
+	return Distribution{
+		Mean: ms(sum / time.Duration(len(sorted))),
+		P50:  ms(Percentile(sorted, 50)),
+		P90:  ms(Percentile(sorted, 90)),
+		P99:  ms(Percentile(sorted, 99)),
+		Max:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+// Percentile returns the p-th percentile of sorted durations by the
+// nearest-rank method.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Print writes the report as a table.
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Requests:           %d (%d failed)\n", r.Requests, r.Failed)
+	fmt.Fprintf(w, "Duration:           %.2f s\n", r.Duration)
+	fmt.Fprintf(w, "Request throughput: %.2f req/s\n", r.RequestThroughput)
+	fmt.Fprintf(w, "Input throughput:   %.2f tok/s\n", r.InputThroughput)
+	fmt.Fprintf(w, "Output throughput:  %.2f tok/s\n", r.OutputThroughput)
+	fmt.Fprintf(w, "\n%-12s %10s %10s %10s %10s %10s\n", "(ms)", "mean", "p50", "p90", "p99", "max")
+	for _, row := range []struct {
+		name string
+		d    Distribution
+	}{{"TTFT", r.TTFT}, {"TPOT", r.TPOT}, {"E2E latency", r.Latency}} {
+		fmt.Fprintf(w, "%-12s %10.2f %10.2f %10.2f %10.2f %10.2f\n", row.name, row.d.Mean, row.d.P50, row.d.P90, row.d.P99, row.d.Max)
+	}
+	for msg, n := range r.Errors {
+		fmt.Fprintf(w, "error (%d): %s\n", n, msg)
+	}
+}
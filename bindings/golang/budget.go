@@ -0,0 +1,416 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides per-tenant token budgets.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTenantLabel is the label, set with WithLabels, that names the tenant
+// of a request when BudgetOptions.Tenant is not set.
+const DefaultTenantLabel = "tenant"
+
+// ErrBudgetExceeded is matched, with errors.Is, by the *BudgetError returned
+// when a request would exceed its tenant's token budget.
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// BudgetError is returned when a request is rejected by WithBudget.
+type BudgetError struct {
+	Tenant string
+	// Used is the number of tokens the tenant consumed in the period
+	Used  int64
+	Limit int64
+	// Reset is when the period ends; zero for budgets without a period
+	Reset time.Time
+}
+
+func (e *BudgetError) Error() string {
+	msg := fmt.Sprintf("tenant %q used %d of %d tokens", e.Tenant, e.Used, e.Limit)
+	if !e.Reset.IsZero() {
+		msg += ", resets at " + e.Reset.Format(time.RFC3339)
+	}
+	return msg
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// TokenBudget limits the tokens, prompt and completion, a tenant may consume.
+type TokenBudget struct {
+	Limit int64
+	// Period, if positive, resets the budget at each multiple of Period
+	// since the zero time in UTC, e.g. 24*time.Hour for daily budgets. Zero
+	// means the budget never resets.
+	Period time.Duration
+}
+
+// periodStart returns the start of the period containing now
+func (b TokenBudget) periodStart(now time.Time) time.Time {
+	if b.Period <= 0 {
+		return time.Time{}
+	}
+	return now.UTC().Truncate(b.Period)
+}
+
+// BudgetStore keeps the tokens consumed by each tenant in each period, so
+// that budgets survive restarts or are shared by several clients or
+// processes. Periods are identified by their start, the zero time for
+// budgets without a period. Implementations must be safe for concurrent use.
+type BudgetStore interface {
+	// Usage returns the tokens tenant consumed in the period starting at
+	// start, or 0 if none were recorded
+	Usage(ctx context.Context, tenant string, start time.Time) (int64, error)
+	// AddUsage adds tokens to the consumption of tenant in the period
+	// starting at start
+	AddUsage(ctx context.Context, tenant string, start time.Time, tokens int64) error
+}
+
+// MemoryBudgetStore is a BudgetStore in memory, the default of WithBudget.
+// It keeps only the latest period of each tenant.
+type MemoryBudgetStore struct {
+	mu     sync.Mutex
+	usages map[string]periodUsage
+}
+
+type periodUsage struct {
+	start  time.Time
+	tokens int64
+}
+
+// NewMemoryBudgetStore creates an empty store.
+func NewMemoryBudgetStore() *MemoryBudgetStore {
+	return &MemoryBudgetStore{usages: make(map[string]periodUsage)}
+}
+
+// Usage returns the tokens tenant consumed in the period starting at start.
+func (s *MemoryBudgetStore) Usage(ctx context.Context, tenant string, start time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usages[tenant]
+	if !u.start.Equal(start) {
+		return 0, nil
+	}
+	return u.tokens, nil
+}
+
+// AddUsage adds tokens to the period starting at start, forgetting earlier
+// periods of tenant.
+func (s *MemoryBudgetStore) AddUsage(ctx context.Context, tenant string, start time.Time, tokens int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usages[tenant]
+	switch {
+	case u.start.Equal(start):
+		u.tokens += tokens
+	case u.start.Before(start):
+		u = periodUsage{start: start, tokens: tokens}
+	default:
+		// A request admitted in a period that has since been replaced
+		return nil
+	}
+	s.usages[tenant] = u
+	return nil
+}
+
+// BudgetDowngrade makes WithBudget downgrade requests near the budget rather
+// than reject them.
+type BudgetDowngrade struct {
+	// Threshold, if positive, is the fraction of the budget after which every
+	// request is downgraded, e.g. 0.8. Requests whose estimate exceeds the
+	// remaining budget are downgraded regardless.
+	Threshold float64
+	// MaxTokens, if positive, caps the MaxCompletionTokens of downgraded
+	// requests
+	MaxTokens int
+	// Model, if set, replaces the model of downgraded requests, e.g. with the
+	// alias of a cheaper model
+	Model string
+}
+
+// BudgetOptions controls WithBudget.
+type BudgetOptions struct {
+	// Budgets are the budgets of tenants by name
+	Budgets map[string]TokenBudget
+	// Default, if its Limit is positive, is the budget of tenants not in
+	// Budgets. Otherwise they are not limited.
+	Default TokenBudget
+	// Tenant returns the tenant of a request. Defaults to the
+	// DefaultTenantLabel label of the context; requests without a tenant
+	// are not limited.
+	Tenant func(ctx context.Context, req ChatCompletionRequest) string
+	// Store keeps consumption. Defaults to a new MemoryBudgetStore.
+	Store BudgetStore
+	// Downgrade, if set, downgrades requests that would exceed the budget,
+	// instead of rejecting them while any budget remains
+	Downgrade *BudgetDowngrade
+	// CountPromptTokens, if set, counts the prompt tokens of a request so
+	// that they are included in its estimate, e.g. the CountPromptTokens
+	// method of the model's Tokenizer. Otherwise the estimate is the
+	// request's MaxCompletionTokens only.
+	CountPromptTokens func(req ChatCompletionRequest) (int, error)
+	// OnDowngrade, if set, is called with each request that is downgraded
+	// and the request sent instead
+	OnDowngrade func(tenant string, req, downgraded ChatCompletionRequest)
+	// OnError, if set, is called when consumption cannot be recorded.
+	// Defaults to logging with the log package.
+	OnError func(tenant string, err error)
+}
+
+// WithBudget returns a middleware that tracks the tokens each tenant
+// consumes, as reported in the usage of responses, and enforces their
+// budgets. A request is estimated before it is sent, as its prompt tokens
+// plus MaxCompletionTokens. A request whose estimate exceeds the remaining
+// budget, or any request once the budget is spent, fails with a *BudgetError
+// matching ErrBudgetExceeded; with Downgrade set, requests that still fit
+// some budget are downgraded instead, with a smaller MaxCompletionTokens and
+// a cheaper model.
+//
+// Streams are charged when their usage chunk arrives, so the middleware
+// requests one, and drops it again if the caller did not. A stream closed
+// before then is charged its estimated prompt tokens and a completion token
+// per chunk received. Consumption is
+// checked before requests and recorded after them, so concurrent requests of
+// a tenant may together overshoot its budget by up to their sizes.
+//
+//	budget := smg.WithBudget(smg.BudgetOptions{
+//	    Budgets:   map[string]smg.TokenBudget{"acme": {Limit: 1_000_000, Period: 24 * time.Hour}},
+//	    Downgrade: &smg.BudgetDowngrade{Threshold: 0.9, MaxTokens: 256, Model: "small"},
+//	})
+//	client = budget(client)
+//	resp, err := client.CreateChatCompletion(smg.WithLabels(ctx, map[string]string{"tenant": "acme"}), req)
+func WithBudget(opts BudgetOptions) ChatMiddleware {
+	if opts.Tenant == nil {
+		opts.Tenant = func(ctx context.Context, req ChatCompletionRequest) string {
+			return LabelsFromContext(ctx)[DefaultTenantLabel]
+		}
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryBudgetStore()
+	}
+	return func(next ChatClient) ChatClient {
+		return &budgetClient{next: next, opts: opts, now: time.Now}
+	}
+}
+
+type budgetClient struct {
+	next ChatClient
+	opts BudgetOptions
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// budgetCharge is where the consumption of an admitted request is recorded
+type budgetCharge struct {
+	tenant string
+	start  time.Time
+	// prompt is the request's estimated prompt tokens, charged for streams
+	// closed before their usage arrives
+	prompt int64
+}
+
+func (c *budgetClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req, charge, err := c.admit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	if err == nil && charge != nil {
+		c.record(ctx, charge, resp.Usage)
+	}
+	return resp, err
+}
+
+func (c *budgetClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	req, charge, err := c.admit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if charge == nil {
+		return c.next.CreateChatCompletionStream(ctx, req)
+	}
+	include := includeUsage(req.StreamOptions)
+	if !include {
+		req.StreamOptions = withUsage()
+	}
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &budgetStream{ChatStream: stream, ctx: ctx, client: c, charge: charge, include: include}, nil
+}
+
+// admit checks req against the budget of its tenant and returns the request
+// to send, downgraded if needed, and where to charge it; nil if the tenant
+// is not limited
+func (c *budgetClient) admit(ctx context.Context, req ChatCompletionRequest) (ChatCompletionRequest, *budgetCharge, error) {
+	tenant := c.opts.Tenant(ctx, req)
+	if tenant == "" {
+		return req, nil, nil
+	}
+	budget, ok := c.opts.Budgets[tenant]
+	if !ok {
+		budget = c.opts.Default
+	}
+	if budget.Limit <= 0 {
+		return req, nil, nil
+	}
+
+	charge := &budgetCharge{tenant: tenant, start: budget.periodStart(c.now())}
+	used, err := c.opts.Store.Usage(ctx, tenant, charge.start)
+	if err != nil {
+		return req, nil, fmt.Errorf("failed to read token budget of %q: %w", tenant, err)
+	}
+	exceeded := &BudgetError{Tenant: tenant, Used: used, Limit: budget.Limit}
+	if budget.Period > 0 {
+		exceeded.Reset = charge.start.Add(budget.Period)
+	}
+	remaining := budget.Limit - used
+	if remaining <= 0 {
+		return req, nil, exceeded
+	}
+
+	var prompt int64
+	if c.opts.CountPromptTokens != nil {
+		n, err := c.opts.CountPromptTokens(req)
+		if err != nil {
+			return req, nil, fmt.Errorf("failed to count prompt tokens: %w", err)
+		}
+		prompt = int64(n)
+	}
+	charge.prompt = prompt
+	estimate := prompt
+	if req.MaxCompletionTokens != nil {
+		estimate += int64(*req.MaxCompletionTokens)
+	}
+
+	d := c.opts.Downgrade
+	if d == nil {
+		if estimate > remaining {
+			return req, nil, exceeded
+		}
+		return req, charge, nil
+	}
+	nearLimit := d.Threshold > 0 && float64(used) >= d.Threshold*float64(budget.Limit)
+	if estimate <= remaining && !nearLimit {
+		return req, charge, nil
+	}
+
+	// The completion gets what the prompt leaves of the budget
+	room := remaining - prompt
+	if room <= 0 {
+		return req, nil, exceeded
+	}
+	downgraded := req
+	if d.MaxTokens > 0 && int64(d.MaxTokens) < room {
+		room = int64(d.MaxTokens)
+	}
+	downgraded.MaxCompletionTokens = capTokens(req.MaxCompletionTokens, int(room))
+	if d.Model != "" {
+		downgraded.Model = d.Model
+	}
+	if c.opts.OnDowngrade != nil {
+		c.opts.OnDowngrade(tenant, req, downgraded)
+	}
+	return downgraded, charge, nil
+}
+
+// record adds the tokens of usage to the budget, even if ctx has been
+// cancelled since
+func (c *budgetClient) record(ctx context.Context, charge *budgetCharge, usage Usage) {
+	if usage.TotalTokens <= 0 {
+		return
+	}
+	err := c.opts.Store.AddUsage(context.WithoutCancel(ctx), charge.tenant, charge.start, int64(usage.TotalTokens))
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("recording token usage: %w", err)
+	if c.opts.OnError != nil {
+		c.opts.OnError(charge.tenant, err)
+	} else {
+		log.Printf("smg: tenant %s: %v", charge.tenant, err)
+	}
+}
+
+// budgetStream charges the usage chunk of a stream, dropping it if the
+// caller did not ask for it. A stream closed before its usage chunk is
+// charged its estimated prompt tokens and a completion token per chunk
+// received, as workers stream a token or more per chunk.
+type budgetStream struct {
+	ChatStream
+	ctx     context.Context
+	client  *budgetClient
+	charge  *budgetCharge
+	include bool
+
+	// mu guards charged and chunks, as Close may be called during a read
+	mu      sync.Mutex
+	charged bool
+	// chunks counts the chunks received with choices
+	chunks int
+}
+
+func (s *budgetStream) RecvJSON() (string, error) {
+	for {
+		chunkJSON, err := s.ChatStream.RecvJSON()
+		if err != nil {
+			return chunkJSON, err
+		}
+		if !strings.Contains(chunkJSON, `"usage"`) {
+			s.received(nil, true)
+			return chunkJSON, nil
+		}
+		var chunk ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil || chunk.Usage == nil {
+			s.received(nil, true)
+			return chunkJSON, nil
+		}
+		s.received(chunk.Usage, len(chunk.Choices) > 0)
+		if s.include || len(chunk.Choices) > 0 {
+			return chunkJSON, nil
+		}
+	}
+}
+
+// received counts a chunk with choices and charges usage, if not yet charged
+func (s *budgetStream) received(usage *Usage, choices bool) {
+	s.mu.Lock()
+	if choices {
+		s.chunks++
+	}
+	charge := usage != nil && !s.charged
+	if charge {
+		s.charged = true
+	}
+	s.mu.Unlock()
+	if charge {
+		s.client.record(s.ctx, s.charge, *usage)
+	}
+}
+
+// Close charges a stream that ended without usage, then closes it.
+func (s *budgetStream) Close() error {
+	s.mu.Lock()
+	charge := !s.charged
+	s.charged = true
+	completion := s.chunks
+	s.mu.Unlock()
+	if charge {
+		prompt := int(s.charge.prompt)
+		s.client.record(s.ctx, s.charge, Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		})
+	}
+	return s.ChatStream.Close()
+}
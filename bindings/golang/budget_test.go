@@ -0,0 +1,189 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// usageClient returns responses reporting total tokens
+func usageClient(total int, requests *[]ChatCompletionRequest) funcClient {
+	return func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		*requests = append(*requests, req)
+		return &ChatCompletionResponse{Model: req.Model, Usage: Usage{TotalTokens: total}}, nil
+	}
+}
+
+// TestBudgetReject tests charging tenants and rejecting requests once their
+// budget is spent
+func TestBudgetReject(t *testing.T) {
+	var requests []ChatCompletionRequest
+	store := NewMemoryBudgetStore()
+	client := WithBudget(BudgetOptions{
+		Budgets: map[string]TokenBudget{"acme": {Limit: 100}},
+		Store:   store,
+	})(usageClient(60, &requests))
+	acme := WithLabels(context.Background(), map[string]string{DefaultTenantLabel: "acme"})
+
+	if _, err := client.CreateChatCompletion(acme, ChatCompletionRequest{Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := store.Usage(acme, "acme", time.Time{}); used != 60 {
+		t.Errorf("Usage() = %d, want 60", used)
+	}
+	// 60 used, so a request for up to 50 more does not fit
+	_, err := client.CreateChatCompletion(acme, ChatCompletionRequest{Model: "m", MaxCompletionTokens: intPtr(50)})
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrBudgetExceeded) || budgetErr.Used != 60 || budgetErr.Limit != 100 {
+		t.Fatalf("err = %v, want a BudgetError", err)
+	}
+	if _, err := client.CreateChatCompletion(acme, ChatCompletionRequest{Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateChatCompletion(acme, ChatCompletionRequest{Model: "m"}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v after the budget was spent", err)
+	}
+
+	// Tenants without a budget, and requests without a tenant, are not limited
+	other := WithLabels(context.Background(), map[string]string{DefaultTenantLabel: "other"})
+	for _, ctx := range []context.Context{other, context.Background()} {
+		if _, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "m"}); err != nil {
+			t.Errorf("unlimited request: %v", err)
+		}
+	}
+	if len(requests) != 4 {
+		t.Errorf("%d requests sent, want 4", len(requests))
+	}
+}
+
+// TestBudgetDowngrade tests downgrading requests near the budget
+func TestBudgetDowngrade(t *testing.T) {
+	var requests []ChatCompletionRequest
+	var downgrades int
+	client := WithBudget(BudgetOptions{
+		Default:           TokenBudget{Limit: 1000},
+		Tenant:            func(ctx context.Context, req ChatCompletionRequest) string { return req.User },
+		Downgrade:         &BudgetDowngrade{Threshold: 0.5, MaxTokens: 100, Model: "small"},
+		CountPromptTokens: func(req ChatCompletionRequest) (int, error) { return 50, nil },
+		OnDowngrade:       func(tenant string, req, downgraded ChatCompletionRequest) { downgrades++ },
+	})(usageClient(400, &requests))
+	ctx := context.Background()
+	req := ChatCompletionRequest{Model: "large", User: "acme", MaxCompletionTokens: intPtr(300)}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateChatCompletion(ctx, req); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	// Sent with 0 and 400 used, under the threshold with room for 350
+	// tokens; downgraded with 800 used, past the threshold
+	if requests[0].Model != "large" || requests[1].Model != "large" {
+		t.Errorf("requests under the threshold were downgraded: %+v", requests[:2])
+	}
+	if got := requests[2]; got.Model != "small" || *got.MaxCompletionTokens != 100 || downgrades != 1 {
+		t.Errorf("downgraded request = %s with %d tokens, %d downgrades", got.Model, *got.MaxCompletionTokens, downgrades)
+	}
+	if *req.MaxCompletionTokens != 300 {
+		t.Error("the caller's request was modified")
+	}
+	// 1200 used
+	if _, err := client.CreateChatCompletion(ctx, req); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("err = %v after the budget was spent", err)
+	}
+}
+
+// TestBudgetPeriod tests that periodic budgets reset
+func TestBudgetPeriod(t *testing.T) {
+	var requests []ChatCompletionRequest
+	now := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	client := WithBudget(BudgetOptions{
+		Budgets: map[string]TokenBudget{"acme": {Limit: 100, Period: 24 * time.Hour}},
+	})(usageClient(100, &requests)).(*budgetClient)
+	client.now = func() time.Time { return now }
+	ctx := WithLabels(context.Background(), map[string]string{DefaultTenantLabel: "acme"})
+
+	client.CreateChatCompletion(ctx, ChatCompletionRequest{})
+	_, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{})
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) || !budgetErr.Reset.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("err = %v, want a BudgetError resetting at midnight", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{}); err != nil {
+		t.Errorf("request in the next period: %v", err)
+	}
+}
+
+// TestBudgetStream tests charging the usage of a stream that did not ask for
+// it, without returning it
+func TestBudgetStream(t *testing.T) {
+	inner := &streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`,
+		`{"id":"c","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+	}}}
+	store := NewMemoryBudgetStore()
+	client := WithBudget(BudgetOptions{Default: TokenBudget{Limit: 100}, Store: store})(inner)
+	ctx := WithLabels(context.Background(), map[string]string{DefaultTenantLabel: "acme"})
+
+	stream, err := client.CreateChatCompletionStream(ctx, ChatCompletionRequest{Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks int
+	for {
+		_, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks++
+	}
+	if chunks != 1 {
+		t.Errorf("%d chunks returned, want the usage chunk dropped", chunks)
+	}
+	if used, _ := store.Usage(ctx, "acme", time.Time{}); used != 5 {
+		t.Errorf("Usage() = %d, want 5", used)
+	}
+	stream.Close()
+	if used, _ := store.Usage(ctx, "acme", time.Time{}); used != 5 {
+		t.Errorf("Usage() = %d after Close, want 5", used)
+	}
+}
+
+// TestBudgetStreamClosed tests charging a stream closed before its usage
+// chunk
+func TestBudgetStreamClosed(t *testing.T) {
+	inner := &streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"c","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{"content":" there"}}]}`,
+		`{"id":"c","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+	}}}
+	store := NewMemoryBudgetStore()
+	client := WithBudget(BudgetOptions{
+		Default:           TokenBudget{Limit: 100},
+		Store:             store,
+		CountPromptTokens: func(ChatCompletionRequest) (int, error) { return 7, nil },
+	})(inner)
+	ctx := WithLabels(context.Background(), map[string]string{DefaultTenantLabel: "acme"})
+
+	stream, err := client.CreateChatCompletionStream(ctx, ChatCompletionRequest{Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.RecvJSON(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := store.Usage(ctx, "acme", time.Time{}); used != 9 {
+		t.Errorf("Usage() = %d, want the 7 prompt tokens and 2 chunks", used)
+	}
+}
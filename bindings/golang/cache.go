@@ -0,0 +1,211 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides an exact-match response cache for chat clients.
+package smg
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ChatMiddleware wraps a ChatClient, e.g. WithCache(store)(client).
+type ChatMiddleware func(next ChatClient) ChatClient
+
+// CacheStore stores cached responses by key. MemoryCache is an in-memory
+// implementation; a shared store such as Redis implements it with GET and
+// SET, applying its own TTL:
+//
+//	func (s redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+//	    value, err := s.rdb.Get(ctx, "smg:"+key).Bytes()
+//	    if err == redis.Nil {
+//	        return nil, false, nil
+//	    }
+//	    return value, err == nil, err
+//	}
+//
+//	func (s redisStore) Set(ctx context.Context, key string, value []byte) error {
+//	    return s.rdb.Set(ctx, "smg:"+key, value, time.Hour).Err()
+//	}
+type CacheStore interface {
+	// Get returns the value stored under key and whether there was one
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// WithCache returns a middleware that serves repeated deterministic chat
+// completions from store: requests with temperature 0 or a seed. Requests
+// match when they are equal apart from Rid; streams are not cached. Store
+// errors are treated as misses, so an unavailable store only disables
+// caching.
+func WithCache(store CacheStore) ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &cachedClient{ChatClient: next, store: store}
+	}
+}
+
+// cachedClient caches the responses of the embedded client; streams pass
+// through
+type cachedClient struct {
+	ChatClient
+	store CacheStore
+}
+
+func (c *cachedClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if !cacheable(req) {
+		return c.ChatClient.CreateChatCompletion(ctx, req)
+	}
+	key, err := CacheKey(req)
+	if err != nil {
+		return c.ChatClient.CreateChatCompletion(ctx, req)
+	}
+
+	if value, ok, err := c.store.Get(ctx, key); err == nil && ok {
+		var resp ChatCompletionResponse
+		if json.Unmarshal(value, &resp) == nil {
+			return &resp, nil
+		}
+	}
+
+	resp, err := c.ChatClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if value, err := json.Marshal(resp); err == nil {
+		_ = c.store.Set(ctx, key, value)
+	}
+	return resp, nil
+}
+
+// cacheable reports whether req is deterministic: greedy or seeded
+func cacheable(req ChatCompletionRequest) bool {
+	if req.Stream {
+		return false
+	}
+	return (req.Temperature != nil && *req.Temperature == 0) || req.Seed != nil
+}
+
+// CacheKey returns the key WithCache stores the response to req under: the
+// SHA-256 of the request's JSON encoding, without Rid. Maps in the request,
+// such as tool parameters, are encoded with sorted keys, so equal requests
+// always have equal keys.
+func CacheKey(req ChatCompletionRequest) (string, error) {
+	req.Rid = nil
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// DefaultCacheEntries is the number of responses a MemoryCache holds when
+// neither MaxEntries nor MaxBytes is set.
+const DefaultCacheEntries = 1024
+
+// MemoryCacheOptions controls a MemoryCache.
+type MemoryCacheOptions struct {
+	// TTL is how long a response is served; zero keeps responses until they
+	// are evicted
+	TTL time.Duration
+	// MaxEntries and MaxBytes limit the number of responses and their total
+	// size; zero means no limit. If neither is set, MaxEntries defaults to
+	// DefaultCacheEntries.
+	MaxEntries int
+	MaxBytes   int
+}
+
+// MemoryCache is an in-memory least-recently-used CacheStore whose entries
+// expire after a TTL. It is safe for concurrent use.
+type MemoryCache struct {
+	opts MemoryCacheOptions
+
+	mu sync.Mutex
+	// order holds the keys from most to least recently used
+	order   *list.List
+	entries map[string]*list.Element
+	bytes   int
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// cacheItem is the value of an element of order
+type cacheItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates an in-memory cache.
+func NewMemoryCache(opts MemoryCacheOptions) *MemoryCache {
+	if opts.MaxEntries <= 0 && opts.MaxBytes <= 0 {
+		opts.MaxEntries = DefaultCacheEntries
+	}
+	return &MemoryCache{
+		opts:    opts,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the unexpired value stored under key.
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	it := elem.Value.(*cacheItem)
+	if !it.expires.IsZero() && !c.now().Before(it.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return it.value, true, nil
+}
+
+// Set stores value under key, evicting the least recently used values while
+// the cache is over its limits. A value larger than MaxBytes is not stored.
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte) error {
+	it := &cacheItem{key: key, value: value}
+	if c.opts.TTL > 0 {
+		it.expires = c.now().Add(c.opts.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if c.opts.MaxBytes > 0 && len(value) > c.opts.MaxBytes {
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(it)
+	c.bytes += len(value)
+	for (c.opts.MaxEntries > 0 && c.order.Len() > c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes) {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of stored values, including expired ones not yet
+// evicted.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *MemoryCache) remove(elem *list.Element) {
+	it := c.order.Remove(elem).(*cacheItem)
+	delete(c.entries, it.key)
+	c.bytes -= len(it.value)
+}
@@ -0,0 +1,105 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestWithCache tests that deterministic requests are served from the store
+func TestWithCache(t *testing.T) {
+	calls := 0
+	client := WithCache(NewMemoryCache(MemoryCacheOptions{}))(funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		calls++
+		return &ChatCompletionResponse{ID: "resp", Choices: []Choice{{Message: Message{Content: "hi"}}}}, nil
+	}))
+
+	zero := float32(0)
+	rid1, rid2 := "a", "b"
+	greedy := ChatCompletionRequest{Model: "m", Temperature: &zero, Messages: []ChatMessage{{Role: "user", Content: "hello"}}, Rid: &rid1}
+	for i := 0; i < 2; i++ {
+		resp, err := client.CreateChatCompletion(context.Background(), greedy)
+		if err != nil || resp.Choices[0].Message.Content != "hi" {
+			t.Fatalf("CreateChatCompletion() = %+v, %v", resp, err)
+		}
+		greedy.Rid = &rid2
+	}
+	if calls != 1 {
+		t.Errorf("greedy request reached the client %d times, want 1", calls)
+	}
+
+	sampled := greedy
+	sampled.Temperature = nil
+	client.CreateChatCompletion(context.Background(), sampled)
+	client.CreateChatCompletion(context.Background(), sampled)
+	if calls != 3 {
+		t.Errorf("client calls = %d, want sampled requests to skip the cache", calls)
+	}
+}
+
+// failingStore fails every operation
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, errors.New("store down")
+}
+
+func (failingStore) Set(ctx context.Context, key string, value []byte) error {
+	return errors.New("store down")
+}
+
+// TestWithCacheStoreErrors tests that store errors only disable caching
+func TestWithCacheStoreErrors(t *testing.T) {
+	client := WithCache(failingStore{})(funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{ID: "resp"}, nil
+	}))
+	seed := 1
+	if _, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{Seed: &seed}); err != nil {
+		t.Errorf("CreateChatCompletion() error: %v", err)
+	}
+}
+
+// TestMemoryCache tests TTL expiry and the entry and byte limits
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	c := NewMemoryCache(MemoryCacheOptions{TTL: time.Minute, MaxEntries: 2, MaxBytes: 10})
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "a", []byte("1111"))
+	c.Set(ctx, "b", []byte("2222"))
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3333"))
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	c.Set(ctx, "d", []byte("44444444"))
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1 after exceeding MaxBytes", c.Len())
+	}
+	c.Set(ctx, "big", make([]byte, 11))
+	if _, ok, _ := c.Get(ctx, "big"); ok {
+		t.Error("value larger than MaxBytes was stored")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "d"); ok {
+		t.Error("expired entry was served")
+	}
+}
+
+// TestCacheKey tests that keys ignore Rid and distinguish content
+func TestCacheKey(t *testing.T) {
+	rid := "x"
+	a, _ := CacheKey(ChatCompletionRequest{Model: "m", Rid: &rid})
+	b, _ := CacheKey(ChatCompletionRequest{Model: "m"})
+	c, _ := CacheKey(ChatCompletionRequest{Model: "n"})
+	if a != b || a == c {
+		t.Errorf("CacheKey() = %s, %s, %s", a, b, c)
+	}
+}
@@ -43,10 +43,17 @@ import (
 //
 // Thread-safe: All public methods are safe for concurrent use.
 type Client struct {
-	endpoint      string
-	tokenizerPath string
-	grpcClient    *grpcclient.GrpcClient // gRPC-based client
-	mu            sync.RWMutex
+	endpoint       string
+	tokenizerPath  string
+	tokenizerPaths map[string]string
+	defaults       modelDefaults
+	strict         *strictDecoder
+	grpcClient     *grpcclient.GrpcClient // gRPC-based client
+	// backend serves the requests of clients whose workers do not speak
+	// DialectSGLang, in place of grpcClient
+	backend *MultiClient
+	reaper  *streamReaper
+	mu      sync.RWMutex
 }
 
 // ClientConfig holds configuration for creating a new client.
@@ -55,11 +62,43 @@ type ClientConfig struct {
 	// Required field. Must include the scheme (grpc://) and port number.
 	Endpoint string
 
+	// Dialect is the gRPC protocol of the engine serving Endpoint.
+	// Defaults to DialectSGLang. SpeculativeDecoding is SGLang-only.
+	Dialect Dialect
+
 	// TokenizerPath is the path to the tokenizer directory containing
-	// tokenizer configuration files (e.g., tokenizer.json, vocab.json).
-	// Required field.
+	// tokenizer configuration files (e.g., tokenizer.json, vocab.json), or to
+	// a single tokenizer file: tokenizer.json, a tiktoken file (*.tiktoken,
+	// tiktoken.model), or a SentencePiece model (tokenizer.model).
+	// Required unless TokenizerPaths is set.
 	TokenizerPath string
 
+	// TokenizerPaths maps model names to tokenizer paths for deployments that
+	// serve several models behind one endpoint. A request whose Model matches a
+	// key is templated and tokenized with that tokenizer; other requests use
+	// TokenizerPath. Each distinct path is loaded once at construction time.
+	TokenizerPaths map[string]string
+
+	// TokenizerPin, if set, is checked against the tokenizer loaded from
+	// TokenizerPath. NewClient fails with ErrTokenizerMismatch on mismatch.
+	TokenizerPin *TokenizerPin
+
+	// TokenizerPins maps model names from TokenizerPaths to the pin their
+	// tokenizer must match.
+	TokenizerPins map[string]TokenizerPin
+
+	// ModelDefaults maps model names to the default parameters of the
+	// requests naming them.
+	ModelDefaults map[string]ModelDefaults
+
+	// StrictDecoding, if set, reports response fields the SDK does not
+	// decode.
+	StrictDecoding *StrictDecoding
+
+	// ClientInfo identifies the client to the workers in the metadata of
+	// every request. If nil, the SDK's name and version are sent.
+	ClientInfo *ClientInfo
+
 	// ChannelBufferSizes configures buffer sizes for internal channels.
 	// If nil, default values will be used (optimized for high concurrency).
 	ChannelBufferSizes *ChannelBufferSizes
@@ -67,6 +106,20 @@ type ClientConfig struct {
 	// Timeouts configures timeout values for various operations.
 	// If nil, default values will be used.
 	Timeouts *Timeouts
+
+	// StreamIdleTimeout, if positive, closes streams with no activity for
+	// longer than it, so that a caller abandoning a stream without reading
+	// it to the end or closing it, or a backend that stops responding
+	// during a read, does not leak the worker request and its handle. A
+	// read starting or returning is activity, so the timeout must exceed
+	// the longest expected wait for a chunk, first chunk included. RecvJSON
+	// on a closed stream returns an error matching ErrStreamIdle.
+	StreamIdleTimeout time.Duration
+
+	// OnStreamIdle, if set, is called for each stream StreamIdleTimeout
+	// closes, with the request ID from its context and how long it was
+	// idle. Defaults to logging them.
+	OnStreamIdle func(requestID string, idle time.Duration)
 }
 
 // ChannelBufferSizes configures buffer sizes for internal channels.
@@ -103,15 +156,29 @@ func defaultTimeouts() Timeouts {
 //
 // Returns an error if:
 // - Endpoint is empty
-// - TokenizerPath is empty
+// - Both TokenizerPath and TokenizerPaths are empty
+// - Any configured tokenizer fails to load
+// - A tokenizer does not match its pin (ErrTokenizerMismatch)
+// - Dialect is unknown
 // - Connection to the server fails
 func NewClient(config ClientConfig) (*Client, error) {
 	if config.Endpoint == "" {
 		return nil, errors.New("endpoint is required")
 	}
-	if config.TokenizerPath == "" {
+	if err := config.Dialect.validate(); err != nil {
+		return nil, err
+	}
+	if config.TokenizerPath == "" && len(config.TokenizerPaths) == 0 {
 		return nil, errors.New("tokenizer path is required")
 	}
+	for model, path := range config.TokenizerPaths {
+		if path == "" {
+			return nil, fmt.Errorf("tokenizer path for model %q is empty", model)
+		}
+	}
+	if err := validateTokenizerPins(config.TokenizerPath, config.TokenizerPin, config.TokenizerPaths, config.TokenizerPins); err != nil {
+		return nil, err
+	}
 
 	bufferSizes := defaultChannelBufferSizes()
 	if config.ChannelBufferSizes != nil {
@@ -139,26 +206,105 @@ func NewClient(config ClientConfig) (*Client, error) {
 		}
 	}
 
-	grpcClient, err := grpcclient.NewGrpcClient(config.Endpoint, config.TokenizerPath, bufferSizes, timeouts)
+	tokenizerPaths := make(map[string]string, len(config.TokenizerPaths))
+	for model, path := range config.TokenizerPaths {
+		tokenizerPaths[model] = path
+	}
+
+	if !config.Dialect.isSGLang() {
+		// The generated gRPC client speaks SGLang only; other engines are
+		// reached through the Rust client, as a single-worker MultiClient
+		backend, err := NewMultiClient(MultiClientConfig{
+			Endpoints:         config.Endpoint,
+			Dialect:           config.Dialect,
+			TokenizerPath:     config.TokenizerPath,
+			TokenizerPaths:    tokenizerPaths,
+			TokenizerPin:      config.TokenizerPin,
+			TokenizerPins:     config.TokenizerPins,
+			ModelDefaults:     config.ModelDefaults,
+			StrictDecoding:    config.StrictDecoding,
+			ClientInfo:        config.ClientInfo,
+			StreamIdleTimeout: config.StreamIdleTimeout,
+			OnStreamIdle:      config.OnStreamIdle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Client{
+			endpoint:       config.Endpoint,
+			tokenizerPath:  config.TokenizerPath,
+			tokenizerPaths: tokenizerPaths,
+			backend:        backend,
+		}, nil
+	}
+
+	md, err := clientMetadata(config.ClientInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcClient, err := grpcclient.NewGrpcClient(config.Endpoint, config.TokenizerPath, tokenizerPaths, md, bufferSizes, timeouts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
 	}
 
+	// Tokenizers given as HuggingFace model IDs are downloaded while loading,
+	// so pins are checked only once loading has succeeded.
+	if err := verifyTokenizerPins(config.TokenizerPath, config.TokenizerPin, tokenizerPaths, config.TokenizerPins); err != nil {
+		grpcClient.Close()
+		return nil, err
+	}
+
 	return &Client{
-		endpoint:      config.Endpoint,
-		tokenizerPath: config.TokenizerPath,
-		grpcClient:    grpcClient,
+		endpoint:       config.Endpoint,
+		tokenizerPath:  config.TokenizerPath,
+		tokenizerPaths: tokenizerPaths,
+		defaults:       newModelDefaults(config.ModelDefaults),
+		strict:         newStrictDecoder(config.StrictDecoding),
+		grpcClient:     grpcClient,
+		reaper:         newStreamReaper(config.StreamIdleTimeout, config.OnStreamIdle),
 	}, nil
 }
 
+// TokenizerPathForModel returns the tokenizer path used for requests naming
+// model, or the default TokenizerPath when the model has no dedicated entry.
+func (c *Client) TokenizerPathForModel(model string) string {
+	if path, ok := c.tokenizerPaths[model]; ok {
+		return path
+	}
+	return c.tokenizerPath
+}
+
+// HealthyWorkerCount returns 1 while the connection to the worker is usable
+// and 0 once it has failed or the client is closed, mirroring
+// MultiClient.HealthyWorkerCount.
+func (c *Client) HealthyWorkerCount() int {
+	if c.backend != nil {
+		return c.backend.HealthyWorkerCount()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.grpcClient == nil || !c.grpcClient.Healthy() {
+		return 0
+	}
+	return 1
+}
+
 // Close closes the client and releases all resources.
 //
 // After Close() is called, the client cannot be used for further requests.
 // Calling Close() multiple times is safe and idempotent.
 func (c *Client) Close() error {
+	if c.backend != nil {
+		return c.backend.Close()
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.reaper.close()
 	if c.grpcClient != nil {
 		if err := c.grpcClient.Close(); err != nil {
 			return err
@@ -197,8 +343,25 @@ type ChatCompletionRequest struct {
 	Logprobs            bool             `json:"logprobs,omitempty"`
 	TopLogprobs         *int             `json:"top_logprobs,omitempty"`
 	User                string           `json:"user,omitempty"`
+	// ContinueFinalMessage makes the model continue the final message, which
+	// must be from the assistant, instead of starting a new turn. The
+	// response holds only the continuation, not the prefix.
+	ContinueFinalMessage bool `json:"continue_final_message,omitempty"`
 	// Rid is forwarded to the backend as the request id for log correlation
 	Rid *string `json:"rid,omitempty"`
+	// Priority orders the request against others; see Priority
+	Priority Priority `json:"priority,omitempty"`
+	// Regex constrains the output to match a regular expression
+	Regex string `json:"regex,omitempty"`
+	// EBNF constrains the output to a grammar in EBNF (GBNF) notation
+	EBNF string `json:"ebnf,omitempty"`
+	// SessionParams continues a turn of a backend session; see OpenSession
+	SessionParams *SessionParams `json:"session_params,omitempty"`
+	// Store asks WithStore to persist the request and its response
+	Store bool `json:"store,omitempty"`
+	// Metadata are tags for the stored completion, e.g. the feature or
+	// experiment, that ListStoredCompletions filters by
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // StreamOptions controls streaming behavior options.
@@ -212,6 +375,14 @@ type ChatMessage struct {
 	Role    string      `json:"role"`
 	Content interface{} `json:"content"`
 	Name    string      `json:"name,omitempty"`
+	// ToolCalls are the calls an assistant message made, for replaying a
+	// conversation that used tools
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a "tool" message answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// ReasoningContent is the reasoning of an assistant message, for
+	// replaying it to models that accept it
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // Tool represents a tool/function that can be called
@@ -230,6 +401,16 @@ type Function struct {
 // ResponseFormat represents the response format
 type ResponseFormat struct {
 	Type string `json:"type"`
+	// JSONSchema constrains the output when Type is "json_schema"
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema names the JSON schema the output of a "json_schema" response
+// format must match
+type JSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
 }
 
 // ChatCompletionResponse represents a non-streaming chat completion response
@@ -245,9 +426,9 @@ type ChatCompletionResponse struct {
 
 // Choice represents a choice in the completion response
 type Choice struct {
-	Index        int     `json:"index"`
-	Message      Message `json:"message"`
-	FinishReason string  `json:"finish_reason"`
+	Index        int          `json:"index"`
+	Message      Message      `json:"message"`
+	FinishReason FinishReason `json:"finish_reason"`
 }
 
 // Message represents a message in the response
@@ -255,6 +436,12 @@ type Message struct {
 	Role      string     `json:"role"`
 	Content   string     `json:"content"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ReasoningContent is the model's reasoning, when the backend separates
+	// it from the content
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Images are the images the model generated, e.g. as data URLs; see
+	// ContentPart.SaveImage
+	Images []ContentPart `json:"images,omitempty"`
 }
 
 // ToolCall represents a tool call in the response
@@ -275,6 +462,40 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// PromptTokensDetails is set when some prompt tokens were served from
+	// the prefix cache
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// CompletionTokensDetails is set when some completion tokens were
+	// reasoning
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails breaks down the prompt tokens of a request.
+type PromptTokensDetails struct {
+	// CachedTokens were found in the prefix cache rather than prefilled
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CompletionTokensDetails breaks down the completion tokens of a request.
+type CompletionTokensDetails struct {
+	// ReasoningTokens were generated as reasoning rather than as the answer
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// CachedTokens returns the prompt tokens served from the prefix cache.
+func (u Usage) CachedTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens returns the completion tokens spent on reasoning.
+func (u Usage) ReasoningTokens() int {
+	if u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
 
 // ChatCompletionStreamResponse represents a streaming chat completion response
@@ -286,22 +507,66 @@ type ChatCompletionStreamResponse struct {
 	SystemFingerprint string         `json:"system_fingerprint,omitempty"`
 	Choices           []StreamChoice `json:"choices"`
 	Usage             *Usage         `json:"usage,omitempty"`
+	// SequenceNumber numbers the chunks of a Client or MultiClient stream
+	// consecutively from 1, in the order RecvJSON returns them, so a proxy
+	// processing chunks in parallel can restore their order and detect
+	// drops. Middleware that drops or merges chunks keeps the numbers of
+	// the chunks it passes on.
+	SequenceNumber int64 `json:"sequence_number,omitempty"`
 }
 
 // StreamChoice represents a choice in a streaming response
 type StreamChoice struct {
 	Index        int          `json:"index"`
 	Delta        MessageDelta `json:"delta"`
-	FinishReason string       `json:"finish_reason,omitempty"`
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
 }
 
 // MessageDelta represents incremental message updates
 type MessageDelta struct {
-	Role      string     `json:"role,omitempty"`
-	Content   string     `json:"content,omitempty"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role             string     `json:"role,omitempty"`
+	Content          string     `json:"content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	// Images are the images generated in this chunk
+	Images []ContentPart `json:"images,omitempty"`
+}
+
+// ChatStream is a stream of chat or text completion chunks.
+type ChatStream interface {
+	// RecvJSON returns the next chunk as JSON, or io.EOF when the stream is
+	// done
+	RecvJSON() (string, error)
+	// Close ends the stream and cancels any pending operations
+	Close() error
 }
 
+// ChatClient is implemented by Client and MultiClient. Helpers that issue
+// chat requests, such as Generate, and middleware, such as WithCache, accept
+// and wrap either through it.
+type ChatClient interface {
+	CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error)
+}
+
+// Backend is the full API of Client and MultiClient, for servers and tools
+// that work with either.
+type Backend interface {
+	ChatClient
+	CreateCompletion(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
+	CreateCompletionStream(ctx context.Context, req CompletionRequest) (ChatStream, error)
+	CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error)
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	Tokenizer(model string) (*Tokenizer, error)
+	HealthyWorkerCount() int
+	Close() error
+}
+
+var (
+	_ Backend = (*Client)(nil)
+	_ Backend = (*MultiClient)(nil)
+)
+
 // CreateChatCompletion creates a non-streaming chat completion with context support.
 //
 // Context Support:
@@ -320,6 +585,7 @@ type MessageDelta struct {
 func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	// For non-streaming, we'll collect all chunks and return the final response
 	req.Stream = true // We still use streaming internally, but collect all chunks
+	req.StreamOptions = withUsage()
 
 	if len(req.Tools) == 0 {
 		req.Tools = nil
@@ -330,10 +596,17 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionReq
 		return nil, err
 	}
 	defer stream.Close()
+	return collectChatCompletion(stream)
+}
 
+// collectChatCompletion reads stream to the end and aggregates its chunks
+// into a single response.
+func collectChatCompletion(stream ChatStream) (*ChatCompletionResponse, error) {
 	var fullContent strings.Builder
+	var fullReasoning strings.Builder
 	var fullToolCalls []ToolCall
-	var finishReason string
+	var images []ContentPart
+	var finishReason FinishReason
 	var usage Usage
 	var responseID string
 	var created int64
@@ -371,9 +644,11 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionReq
 			if choice.Delta.Content != "" {
 				fullContent.WriteString(choice.Delta.Content)
 			}
+			fullReasoning.WriteString(choice.Delta.ReasoningContent)
 			if len(choice.Delta.ToolCalls) > 0 {
 				fullToolCalls = append(fullToolCalls, choice.Delta.ToolCalls...)
 			}
+			images = append(images, choice.Delta.Images...)
 			if choice.FinishReason != "" {
 				finishReason = choice.FinishReason
 			}
@@ -385,15 +660,17 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req ChatCompletionReq
 	}
 
 	message := Message{
-		Role:    "assistant",
-		Content: fullContent.String(),
+		Role:             "assistant",
+		Content:          fullContent.String(),
+		ReasoningContent: fullReasoning.String(),
+		Images:           images,
 	}
 	if len(fullToolCalls) > 0 {
 		message.ToolCalls = fullToolCalls
 	}
 
 	if finishReason == "" {
-		finishReason = "stop"
+		finishReason = FinishReasonStop
 	}
 
 	return &ChatCompletionResponse{
@@ -418,10 +695,24 @@ type ChatCompletionStream struct {
 	grpcStream *grpcclient.GrpcChatCompletionStream
 	ctx        context.Context
 	cancel     context.CancelFunc
+	usage      usageFilter
+	seq        sequencer
+	strict     *strictDecoder
 }
 
+// RecvJSON returns the next chunk as JSON, or io.EOF when the stream is
+// done. Chunks are numbered in sequence_number; concurrent calls are
+// serialized.
 func (s *ChatCompletionStream) RecvJSON() (string, error) {
-	return s.grpcStream.RecvJSON()
+	return s.seq.next(func() (string, error) { return s.usage.next(s.recv) })
+}
+
+func (s *ChatCompletionStream) recv() (string, error) {
+	chunkJSON, err := s.grpcStream.RecvJSON()
+	if err != nil {
+		return "", classify(err)
+	}
+	return chunkJSON, s.strict.check([]byte(chunkJSON), ChatCompletionStreamResponse{})
 }
 
 // Close closes the stream and cancels any pending operations.
@@ -435,6 +726,30 @@ func (s *ChatCompletionStream) Close() error {
 	return nil
 }
 
+// validateChatRequest rejects requests the workers would misinterpret
+func validateChatRequest(req ChatCompletionRequest) error {
+	if req.ContinueFinalMessage && (len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "assistant") {
+		return invalidRequest("continue_final_message requires the last message to be from the assistant")
+	}
+	jsonFormat := req.ResponseFormat != nil && req.ResponseFormat.Type != "text"
+	return validateConstraints(req.Regex, req.EBNF, jsonFormat)
+}
+
+// validateConstraints checks that at most one output constraint is set: a
+// regex, an EBNF grammar, or a JSON response format
+func validateConstraints(regex, ebnf string, jsonFormat bool) error {
+	count := 0
+	for _, set := range []bool{regex != "", ebnf != "", jsonFormat} {
+		if set {
+			count++
+		}
+	}
+	if count > 1 {
+		return invalidRequest("only one of regex, ebnf, and a JSON response_format can constrain the output")
+	}
+	return nil
+}
+
 // CreateChatCompletionStream creates a streaming chat completion with context cancellation support.
 //
 // Context Support:
@@ -458,7 +773,15 @@ func (s *ChatCompletionStream) Close() error {
 //	    time.Sleep(5*time.Second)
 //	    cancel()  // Cancel after 5 seconds
 //	}()
-func (c *Client) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionStream, error) {
+func (c *Client) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	if c.backend != nil {
+		return c.backend.CreateChatCompletionStream(ctx, req)
+	}
+
+	c.defaults.applyChat(&req)
+	if err := validateChatRequest(req); err != nil {
+		return nil, err
+	}
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -482,15 +805,18 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, req ChatComplet
 		return nil, errors.New("gRPC client is closed")
 	}
 
-	grpcStream, err := c.grpcClient.CreateChatCompletionStream(ctx, string(reqJSON))
+	grpcStream, err := c.grpcClient.CreateChatCompletionStream(ctx, reqJSON)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC stream: %w", err)
+		return nil, classify(fmt.Errorf("failed to create gRPC stream: %w", err))
 	}
+	observeWorker(ctx, c.endpoint)
 
 	streamCtx, cancel := context.WithCancel(ctx)
-	return &ChatCompletionStream{
+	return c.reaper.track(ctx, &ChatCompletionStream{
 		grpcStream: grpcStream,
 		ctx:        streamCtx,
 		cancel:     cancel,
-	}, nil
+		usage:      usageFilter{include: includeUsage(req.StreamOptions)},
+		strict:     c.strict,
+	}), nil
 }
@@ -0,0 +1,91 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the metadata identifying clients to workers.
+package smg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is the version of the SDK.
+const Version = "1.8.0"
+
+// gRPC metadata keys identifying the client, sent with every request to
+// workers.
+const (
+	// ClientNameMetadataKey carries ClientInfo.Name
+	ClientNameMetadataKey = "x-client-name"
+	// ClientVersionMetadataKey carries ClientInfo.Version
+	ClientVersionMetadataKey = "x-client-version"
+	// SDKVersionMetadataKey carries the Version of the SDK
+	SDKVersionMetadataKey = "x-smg-sdk-version"
+)
+
+// DefaultClientName is the client name sent when ClientInfo.Name is unset.
+const DefaultClientName = "smg-go-sdk"
+
+// ClientInfo identifies the service sending requests, set with
+// ClientConfig.ClientInfo or MultiClientConfig.ClientInfo, so that worker
+// logs can attribute traffic to it.
+type ClientInfo struct {
+	// Name is the name of the service, e.g. "support-bot". Defaults to
+	// DefaultClientName.
+	Name string
+	// Version is the version of the service. Defaults to the SDK's Version
+	// when Name is unset.
+	Version string
+	// Metadata is extra gRPC metadata sent with every request, e.g. the
+	// team or deployment. Keys are lowercased.
+	Metadata map[string]string
+}
+
+// clientMetadata returns the gRPC metadata identifying the client described
+// by info, which may be nil
+func clientMetadata(info *ClientInfo) (map[string]string, error) {
+	var config ClientInfo
+	if info != nil {
+		config = *info
+	}
+	if config.Name == "" {
+		config.Name = DefaultClientName
+		if config.Version == "" {
+			config.Version = Version
+		}
+	}
+
+	md := make(map[string]string, len(config.Metadata)+3)
+	for key, value := range config.Metadata {
+		md[strings.ToLower(key)] = value
+	}
+	md[ClientNameMetadataKey] = config.Name
+	if config.Version != "" {
+		md[ClientVersionMetadataKey] = config.Version
+	}
+	md[SDKVersionMetadataKey] = Version
+	for key, value := range md {
+		if err := validateMetadata(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return md, nil
+}
+
+// validateMetadata checks that key and value can be sent as ASCII gRPC
+// metadata
+func validateMetadata(key, value string) error {
+	if key == "" || strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") {
+		return fmt.Errorf("invalid client metadata key %q", key)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("invalid client metadata key %q", key)
+		}
+	}
+	for _, c := range value {
+		if c < ' ' || c > '~' {
+			return fmt.Errorf("invalid client metadata value for %q: only printable ASCII is allowed", key)
+		}
+	}
+	return nil
+}
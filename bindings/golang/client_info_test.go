@@ -0,0 +1,61 @@
+package smg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestClientMetadata tests the metadata identifying clients
+func TestClientMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		info *ClientInfo
+		want map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{
+				ClientNameMetadataKey:    DefaultClientName,
+				ClientVersionMetadataKey: Version,
+				SDKVersionMetadataKey:    Version,
+			},
+		},
+		{
+			name: "service",
+			info: &ClientInfo{Name: "support-bot", Version: "2.3.1", Metadata: map[string]string{"X-Team": "search"}},
+			want: map[string]string{
+				ClientNameMetadataKey:    "support-bot",
+				ClientVersionMetadataKey: "2.3.1",
+				SDKVersionMetadataKey:    Version,
+				"x-team":                 "search",
+			},
+		},
+		{
+			name: "name without version",
+			info: &ClientInfo{Name: "support-bot"},
+			want: map[string]string{
+				ClientNameMetadataKey: "support-bot",
+				SDKVersionMetadataKey: Version,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clientMetadata(tt.info)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clientMetadata() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	for _, info := range []*ClientInfo{
+		{Name: "bot\n"},
+		{Metadata: map[string]string{"trace-bin": "x"}},
+		{Metadata: map[string]string{"bad key": "x"}},
+		{Metadata: map[string]string{"grpc-timeout": "1S"}},
+	} {
+		if _, err := clientMetadata(info); err == nil {
+			t.Errorf("clientMetadata(%+v) succeeded", info)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package smg
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -44,6 +47,31 @@ func TestClientConfig(t *testing.T) {
 			},
 			wantErr: true, // Tokenizer file doesn't exist
 		},
+		{
+			name: "empty per-model tokenizer path",
+			config: ClientConfig{
+				Endpoint:       "grpc://localhost:20000",
+				TokenizerPaths: map[string]string{"llama": ""},
+			},
+			wantErr: true,
+		},
+		{
+			name: "pin for unconfigured model",
+			config: ClientConfig{
+				Endpoint:      "grpc://localhost:20000",
+				TokenizerPath: "/path/to/tokenizer",
+				TokenizerPins: map[string]TokenizerPin{"llama": {SHA256: "abc"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "nonexistent per-model tokenizer path",
+			config: ClientConfig{
+				Endpoint:       "grpc://localhost:20000",
+				TokenizerPaths: map[string]string{"llama": "/path/to/nonexistent/tokenizer"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -323,3 +351,75 @@ func TestContextCancellation(t *testing.T) {
 		t.Logf("Request with cancelled context completed (FFI may not support context cancellation)")
 	}
 }
+
+// TestConstraintValidation tests that at most one output constraint is
+// accepted
+func TestConstraintValidation(t *testing.T) {
+	req := ChatCompletionRequest{
+		Model:    "default",
+		Messages: []ChatMessage{{Role: "user", Content: "A US phone number?"}},
+		Regex:    `\(\d{3}\) \d{3}-\d{4}`,
+	}
+	if err := validateChatRequest(req); err != nil {
+		t.Errorf("regex error = %v", err)
+	}
+	req.ResponseFormat = &ResponseFormat{Type: "text"}
+	if err := validateChatRequest(req); err != nil {
+		t.Errorf("regex with a text response format error = %v", err)
+	}
+	req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	if _, err := (&MultiClient{}).CreateChatCompletionStream(context.Background(), req); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("regex with a JSON response format error = %v, want ErrInvalidRequest", err)
+	}
+
+	completion := CompletionRequest{Prompt: "SELECT", Regex: "[a-z]+", EBNF: `root ::= "x"`}
+	if _, err := (&Client{}).CreateCompletionStream(context.Background(), completion); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("regex with a grammar error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// TestContinueFinalMessageValidation tests that continuing requires a final
+// assistant message
+func TestContinueFinalMessageValidation(t *testing.T) {
+	req := ChatCompletionRequest{
+		Model:                "default",
+		Messages:             []ChatMessage{{Role: "user", Content: "Write a haiku"}},
+		ContinueFinalMessage: true,
+	}
+	if _, err := (&Client{}).CreateChatCompletionStream(context.Background(), req); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Client error = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := (&MultiClient{}).CreateChatCompletionStream(context.Background(), req); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("MultiClient error = %v, want ErrInvalidRequest", err)
+	}
+
+	req.Messages = append(req.Messages, ChatMessage{Role: "assistant", Content: "Autumn moonlight"})
+	if err := validateChatRequest(req); err != nil {
+		t.Errorf("validateChatRequest() error = %v", err)
+	}
+}
+
+// TestUsageDetails tests decoding, summing, and omitting usage details
+func TestUsageDetails(t *testing.T) {
+	var u Usage
+	data := `{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":8},"completion_tokens_details":{"reasoning_tokens":3}}`
+	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if u.CachedTokens() != 8 || u.ReasoningTokens() != 3 {
+		t.Errorf("CachedTokens() = %d, ReasoningTokens() = %d", u.CachedTokens(), u.ReasoningTokens())
+	}
+
+	sum := addUsage(u, Usage{PromptTokens: 4, TotalTokens: 4, PromptTokensDetails: &PromptTokensDetails{CachedTokens: 2}})
+	if sum.PromptTokens != 14 || sum.CachedTokens() != 10 || sum.ReasoningTokens() != 3 {
+		t.Errorf("addUsage() = %+v", sum)
+	}
+	if sum := addUsage(Usage{}, Usage{PromptTokens: 1}); sum.PromptTokensDetails != nil || sum.CompletionTokensDetails != nil {
+		t.Errorf("addUsage() without details = %+v", sum)
+	}
+
+	out, _ := json.Marshal(Usage{PromptTokens: 1})
+	if strings.Contains(string(out), "details") {
+		t.Errorf("Marshal() = %s, want no details", out)
+	}
+}
@@ -0,0 +1,420 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file publishes request lifecycle events as CloudEvents.
+package smg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The CloudEvents types of the lifecycle events of a request. Every request
+// is accepted and then completes or fails; streams also report their first
+// token.
+const (
+	EventRequestAccepted  = "smg.request.accepted"
+	EventFirstToken       = "smg.request.first_token"
+	EventRequestCompleted = "smg.request.completed"
+	EventRequestFailed    = "smg.request.failed"
+)
+
+// DefaultEventSource is the CloudEvents source of events when
+// EventPublisherOptions.Source is not set.
+const DefaultEventSource = "smg"
+
+// DefaultEventQueueSize is the number of events an EventPublisher holds for
+// its sink when EventPublisherOptions.QueueSize is not set.
+const DefaultEventQueueSize = 1024
+
+// DefaultEventPublishTimeout bounds each call to the sink when
+// EventPublisherOptions.PublishTimeout is not set.
+const DefaultEventPublishTimeout = 5 * time.Second
+
+// ErrEventDropped is matched, with errors.Is, by the error passed to
+// EventPublisherOptions.OnError for events that were never sent to the sink,
+// because its queue was full or the publisher was closed.
+var ErrEventDropped = errors.New("event dropped")
+
+// CloudEvent is a CloudEvents 1.0 event, encoded in the structured JSON
+// format.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	// Data describes the request; Subject repeats its request ID
+	Data RequestEvent `json:"data"`
+}
+
+// RequestEvent is the data of a lifecycle event.
+type RequestEvent struct {
+	// RequestID is the ID set with WithRequestID, or one generated for the
+	// request, shared by all of its events
+	RequestID string `json:"request_id"`
+	Model     string `json:"model,omitempty"`
+	Stream    bool   `json:"stream"`
+	// Labels are the labels set with WithLabels
+	Labels map[string]string `json:"labels,omitempty"`
+	// TimeToFirstTokenMs is set on the first token and completion of
+	// streams
+	TimeToFirstTokenMs *int64 `json:"time_to_first_token_ms,omitempty"`
+	// DurationMs, the time since the request was accepted, is set on
+	// completion and failure
+	DurationMs   *int64       `json:"duration_ms,omitempty"`
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+	// Usage is set on completion, for streams only if the request asked
+	// for usage
+	Usage *Usage `json:"usage,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// EventSink delivers events, e.g. to an HTTP endpoint or a message broker.
+// HTTPEventSink posts them over HTTP; a NATS sink publishes their JSON
+// encoding with nats.go:
+//
+//	sink := smg.EventSinkFunc(func(ctx context.Context, event smg.CloudEvent) error {
+//	    data, err := json.Marshal(event)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    return nc.Publish("smg.events."+event.Type, data)
+//	})
+type EventSink interface {
+	Publish(ctx context.Context, event CloudEvent) error
+}
+
+// EventSinkFunc adapts a function to EventSink.
+type EventSinkFunc func(ctx context.Context, event CloudEvent) error
+
+func (f EventSinkFunc) Publish(ctx context.Context, event CloudEvent) error {
+	return f(ctx, event)
+}
+
+// HTTPEventSink posts each event to URL in the CloudEvents structured
+// content mode. Responses other than 2xx are errors.
+type HTTPEventSink struct {
+	URL string
+	// Header is added to each request, e.g. for authorization
+	Header http.Header
+	// Client sends the requests; defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (s *HTTPEventSink) Publish(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event sink returned %s", resp.Status)
+	}
+	return nil
+}
+
+// EventPublisherOptions controls an EventPublisher.
+type EventPublisherOptions struct {
+	// Source is the CloudEvents source of the events, e.g. the gateway's
+	// URL. Defaults to DefaultEventSource.
+	Source string
+	// QueueSize is the number of events held for the sink; events that do
+	// not fit are dropped. Defaults to DefaultEventQueueSize.
+	QueueSize int
+	// PublishTimeout bounds each call to the sink. Defaults to
+	// DefaultEventPublishTimeout.
+	PublishTimeout time.Duration
+	// OnError, if set, is called with each event the sink failed to
+	// publish, and each dropped event with an error matching
+	// ErrEventDropped.
+	OnError func(event CloudEvent, err error)
+}
+
+// EventPublisher publishes the lifecycle events of the requests of the
+// clients wrapped by its Middleware, so that downstream systems can react
+// to them without polling logs:
+//
+//	publisher := smg.NewEventPublisher(&smg.HTTPEventSink{URL: "http://broker/events"}, smg.EventPublisherOptions{})
+//	defer publisher.Close()
+//	client := publisher.Middleware()(multiClient)
+//
+// Events are sent to the sink in order by a single goroutine, so that a
+// slow sink never delays generation; when the queue is full, events are
+// dropped.
+//
+// Thread-safe: All methods are safe for concurrent use.
+type EventPublisher struct {
+	sink  EventSink
+	opts  EventPublisherOptions
+	queue chan CloudEvent
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewEventPublisher returns a publisher sending events to sink until it is
+// closed.
+func NewEventPublisher(sink EventSink, opts EventPublisherOptions) *EventPublisher {
+	if opts.Source == "" {
+		opts.Source = DefaultEventSource
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultEventQueueSize
+	}
+	if opts.PublishTimeout <= 0 {
+		opts.PublishTimeout = DefaultEventPublishTimeout
+	}
+	p := &EventPublisher{
+		sink:  sink,
+		opts:  opts,
+		queue: make(chan CloudEvent, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Middleware returns a middleware publishing the events of the requests
+// made through it. Streams are failed if closed before they end.
+func (p *EventPublisher) Middleware() ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &eventClient{next: next, publisher: p}
+	}
+}
+
+// Close stops accepting events and returns once the queued events have
+// been sent to the sink.
+func (p *EventPublisher) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
+
+func (p *EventPublisher) run() {
+	defer close(p.done)
+	for event := range p.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.PublishTimeout)
+		err := p.sink.Publish(ctx, event)
+		cancel()
+		if err != nil {
+			p.report(event, err)
+		}
+	}
+}
+
+// emit queues an event of type eventType with data
+func (p *EventPublisher) emit(eventType string, data RequestEvent) {
+	event := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              randomID(),
+		Source:          p.opts.Source,
+		Type:            eventType,
+		Subject:         data.RequestID,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.report(event, fmt.Errorf("%w: publisher closed", ErrEventDropped))
+		return
+	}
+	select {
+	case p.queue <- event:
+	default:
+		p.report(event, fmt.Errorf("%w: queue full", ErrEventDropped))
+	}
+}
+
+func (p *EventPublisher) report(event CloudEvent, err error) {
+	if p.opts.OnError != nil {
+		p.opts.OnError(event, err)
+	}
+}
+
+// randomID returns a random 128-bit ID in hex
+func randomID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// eventClient publishes the events of the requests of next
+type eventClient struct {
+	next      ChatClient
+	publisher *EventPublisher
+}
+
+func (c *eventClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	r := c.accept(ctx, req)
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	if err != nil {
+		r.fail(err)
+		return nil, err
+	}
+	var finishReason FinishReason
+	if len(resp.Choices) > 0 {
+		finishReason = resp.Choices[0].FinishReason
+	}
+	usage := resp.Usage
+	r.complete(finishReason, &usage)
+	return resp, nil
+}
+
+func (c *eventClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	r := c.accept(ctx, req)
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		r.fail(err)
+		return nil, err
+	}
+	return &eventStream{ChatStream: stream, request: r}, nil
+}
+
+// accept publishes the acceptance of req and returns its tracker
+func (c *eventClient) accept(ctx context.Context, req ChatCompletionRequest) *requestEvents {
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		id = randomID()
+	}
+	r := &requestEvents{
+		publisher: c.publisher,
+		data:      RequestEvent{RequestID: id, Model: req.Model, Stream: req.Stream, Labels: LabelsFromContext(ctx)},
+		start:     time.Now(),
+	}
+	c.publisher.emit(EventRequestAccepted, r.data)
+	return r
+}
+
+// requestEvents publishes the events of a request after its acceptance,
+// at most one of completion and failure
+type requestEvents struct {
+	publisher *EventPublisher
+	data      RequestEvent
+	start     time.Time
+
+	mu         sync.Mutex
+	firstToken *int64
+	finished   bool
+}
+
+func (r *requestEvents) sinceStart() *int64 {
+	ms := time.Since(r.start).Milliseconds()
+	return &ms
+}
+
+// token publishes the first token, once
+func (r *requestEvents) token() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.firstToken != nil || r.finished {
+		return
+	}
+	r.firstToken = r.sinceStart()
+	data := r.data
+	data.TimeToFirstTokenMs = r.firstToken
+	r.publisher.emit(EventFirstToken, data)
+}
+
+func (r *requestEvents) complete(finishReason FinishReason, usage *Usage) {
+	r.finish(EventRequestCompleted, func(data *RequestEvent) {
+		data.FinishReason = finishReason
+		data.Usage = usage
+	})
+}
+
+func (r *requestEvents) fail(err error) {
+	r.finish(EventRequestFailed, func(data *RequestEvent) {
+		data.Error = err.Error()
+	})
+}
+
+// finish publishes the completion or failure, unless the request already
+// finished
+func (r *requestEvents) finish(eventType string, set func(*RequestEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.finished = true
+	data := r.data
+	data.TimeToFirstTokenMs = r.firstToken
+	data.DurationMs = r.sinceStart()
+	set(&data)
+	r.publisher.emit(eventType, data)
+}
+
+// eventStream publishes the first token and the end of a stream
+type eventStream struct {
+	ChatStream
+	request      *requestEvents
+	finishReason FinishReason
+	usage        *Usage
+}
+
+func (s *eventStream) RecvJSON() (string, error) {
+	chunkJSON, err := s.ChatStream.RecvJSON()
+	if err == io.EOF {
+		s.request.complete(s.finishReason, s.usage)
+		return chunkJSON, err
+	}
+	if err != nil {
+		s.request.fail(err)
+		return chunkJSON, err
+	}
+	var chunk ChatCompletionStreamResponse
+	if json.Unmarshal([]byte(chunkJSON), &chunk) == nil {
+		if chunk.Usage != nil {
+			s.usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				s.finishReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" || choice.Delta.ReasoningContent != "" || len(choice.Delta.ToolCalls) > 0 {
+				s.request.token()
+			}
+		}
+	}
+	return chunkJSON, nil
+}
+
+func (s *eventStream) Close() error {
+	s.request.fail(errors.New("stream closed before it ended"))
+	return s.ChatStream.Close()
+}
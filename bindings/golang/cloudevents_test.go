@@ -0,0 +1,163 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// eventRecorder is a sink keeping the events it is sent
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []CloudEvent
+}
+
+func (r *eventRecorder) Publish(ctx context.Context, event CloudEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *eventRecorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []string
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func equalTypes(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestEventPublisher tests the events of a completed and a failed request
+func TestEventPublisher(t *testing.T) {
+	sink := &eventRecorder{}
+	publisher := NewEventPublisher(sink, EventPublisherOptions{Source: "gateway-1"})
+	fail := false
+	client := publisher.Middleware()(funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		if fail {
+			return nil, ErrNoHealthyWorkers
+		}
+		return &ChatCompletionResponse{
+			Choices: []Choice{{FinishReason: "stop"}},
+			Usage:   Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+		}, nil
+	}))
+
+	ctx := WithLabels(WithRequestID(context.Background(), "req-1"), map[string]string{"feature": "search"})
+	if _, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "m"}); err != nil {
+		t.Fatalf("CreateChatCompletion error: %v", err)
+	}
+	fail = true
+	if _, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{Model: "m"}); !errors.Is(err, ErrNoHealthyWorkers) {
+		t.Fatalf("CreateChatCompletion error = %v, want ErrNoHealthyWorkers", err)
+	}
+	publisher.Close()
+
+	if got := sink.types(); !equalTypes(got, EventRequestAccepted, EventRequestCompleted, EventRequestAccepted, EventRequestFailed) {
+		t.Fatalf("event types = %v", got)
+	}
+	accepted, completed, failed := sink.events[0], sink.events[1], sink.events[3]
+	if accepted.SpecVersion != "1.0" || accepted.Source != "gateway-1" || accepted.Subject != "req-1" || accepted.ID == "" || accepted.ID == completed.ID {
+		t.Errorf("accepted event = %+v", accepted)
+	}
+	if d := completed.Data; d.RequestID != "req-1" || d.Model != "m" || d.FinishReason != "stop" || d.Usage == nil || d.Usage.TotalTokens != 5 || d.DurationMs == nil || d.Labels["feature"] != "search" {
+		t.Errorf("completed data = %+v", d)
+	}
+	if d := failed.Data; d.RequestID == "" || d.RequestID == "req-1" || d.Error == "" || d.RequestID != sink.events[2].Data.RequestID {
+		t.Errorf("failed data = %+v, want a generated ID shared with its acceptance", d)
+	}
+
+	var dropped error
+	closedPublisher := NewEventPublisher(sink, EventPublisherOptions{OnError: func(event CloudEvent, err error) { dropped = err }})
+	closedPublisher.Close()
+	closedPublisher.Middleware()(client).CreateChatCompletion(context.Background(), ChatCompletionRequest{})
+	if !errors.Is(dropped, ErrEventDropped) {
+		t.Errorf("event after Close error = %v, want ErrEventDropped", dropped)
+	}
+}
+
+// TestEventPublisherStream tests the first token and end of streams, and the
+// failure of streams closed early
+func TestEventPublisherStream(t *testing.T) {
+	sink := &eventRecorder{}
+	publisher := NewEventPublisher(sink, EventPublisherOptions{})
+	chunks := []string{
+		`{"choices":[{"delta":{"role":"assistant"}}]}`,
+		`{"choices":[{"delta":{"content":"Hi"}}]}`,
+		`{"choices":[{"delta":{"content":"!"},"finish_reason":"stop"}]}`,
+	}
+	client := publisher.Middleware()(&streamClient{stream: &fakeChatStream{chunks: chunks}})
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "m", Stream: true})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream error: %v", err)
+	}
+	for {
+		if _, err := stream.RecvJSON(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("RecvJSON error: %v", err)
+		}
+	}
+	stream.Close()
+
+	client = publisher.Middleware()(&streamClient{stream: &fakeChatStream{chunks: chunks}})
+	stream, _ = client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "m", Stream: true})
+	stream.RecvJSON()
+	stream.Close()
+	publisher.Close()
+
+	if got := sink.types(); !equalTypes(got, EventRequestAccepted, EventFirstToken, EventRequestCompleted, EventRequestAccepted, EventRequestFailed) {
+		t.Fatalf("event types = %v", got)
+	}
+	if d := sink.events[1].Data; d.TimeToFirstTokenMs == nil || !d.Stream {
+		t.Errorf("first token data = %+v", d)
+	}
+	if d := sink.events[2].Data; d.FinishReason != "stop" || d.TimeToFirstTokenMs == nil || d.Usage != nil {
+		t.Errorf("completed data = %+v", d)
+	}
+}
+
+// TestHTTPEventSink tests the structured content mode and error statuses
+func TestHTTPEventSink(t *testing.T) {
+	var contentType string
+	var received CloudEvent
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentType = req.Header.Get("Content-Type")
+		json.NewDecoder(req.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := &HTTPEventSink{URL: server.URL}
+	event := CloudEvent{SpecVersion: "1.0", ID: "1", Source: "smg", Type: EventRequestAccepted, Data: RequestEvent{RequestID: "req-1"}}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if contentType != "application/cloudevents+json" || received.Type != EventRequestAccepted || received.Data.RequestID != "req-1" {
+		t.Errorf("received %q %+v", contentType, received)
+	}
+	status = http.StatusInternalServerError
+	if err := sink.Publish(context.Background(), event); err == nil {
+		t.Error("Publish to a failing sink succeeded, want an error")
+	}
+}
@@ -0,0 +1,89 @@
+// smg-bench replays a prompt dataset against SGLang workers through the SDK
+// and reports time to first token (TTFT), time per output token (TPOT),
+// end-to-end latency, and throughput.
+//
+// Usage:
+//
+//	smg-bench -endpoints grpc://host1:20000,grpc://host2:20000 \
+//	    -tokenizer /models/llama -dataset prompts.jsonl \
+//	    -num-requests 1000 -concurrency 64 -rate 20
+//
+// The dataset is JSONL; each line holds a "prompt" string or a "messages"
+// array, and optionally "max_tokens". Requests cycle through the dataset
+// until -num-requests have been sent. With -rate, arrivals follow a Poisson
+// process of that mean rate, still bounded by -concurrency.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/bench"
+)
+
+func main() {
+	endpoints := flag.String("endpoints", os.Getenv("SGL_GRPC_ENDPOINTS"), "comma-separated gRPC worker endpoints")
+	tokenizerPath := flag.String("tokenizer", os.Getenv("SGL_TOKENIZER_PATH"), "tokenizer path or HuggingFace model ID")
+	policy := flag.String("policy", "round_robin", "load balancing policy: round_robin, random, or cache_aware")
+	dataset := flag.String("dataset", "", "JSONL file of prompts")
+	model := flag.String("model", "default", "model name sent in requests")
+	maxTokens := flag.Int("max-tokens", 256, "output tokens of entries without max_tokens")
+	numRequests := flag.Int("num-requests", 0, "requests to send (default: one per dataset entry)")
+	concurrency := flag.Int("concurrency", 16, "maximum requests in flight")
+	rate := flag.Float64("rate", 0, "mean arrival rate in requests per second (0: unlimited)")
+	seed := flag.Int64("seed", 1, "seed of the arrival process")
+	output := flag.String("output", "", "also write the report as JSON to this file")
+	flag.Parse()
+
+	if *endpoints == "" || *tokenizerPath == "" || *dataset == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	reqs, err := bench.LoadDataset(*dataset, *model, *maxTokens)
+	if err != nil {
+		log.Fatalf("Failed to load dataset: %v", err)
+	}
+	if *numRequests <= 0 {
+		*numRequests = len(reqs)
+	}
+
+	client, err := smg.NewMultiClient(smg.MultiClientConfig{
+		Endpoints:     *endpoints,
+		TokenizerPath: *tokenizerPath,
+		PolicyName:    *policy,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	// Interrupting stops new requests and reports on those sent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Sending %d requests to %s (concurrency %d, rate %g/s)", *numRequests, *endpoints, *concurrency, *rate)
+	results := bench.Run(ctx, client, reqs, bench.Options{
+		NumRequests: *numRequests,
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Seed:        *seed,
+	})
+	rep := bench.Summarize(results)
+	rep.Print(os.Stdout)
+
+	if *output != "" {
+		data, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+		if err := os.WriteFile(*output, data, 0o644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+}
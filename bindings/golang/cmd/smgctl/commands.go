@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// sampling holds the flags shared by chat and complete
+type sampling struct {
+	model       string
+	maxTokens   int
+	temperature float64
+}
+
+func (s *sampling) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.model, "model", "default", "model name")
+	fs.IntVar(&s.maxTokens, "max-tokens", 512, "maximum output tokens")
+	fs.Float64Var(&s.temperature, "temperature", -1, "sampling temperature (default: the model's)")
+}
+
+func (s *sampling) temperaturePtr() *float32 {
+	if s.temperature < 0 {
+		return nil
+	}
+	t := float32(s.temperature)
+	return &t
+}
+
+// chatCommand sends the message in args, or each line read from in as a turn
+// of one conversation, and streams the replies to out
+func chatCommand(ctx context.Context, client smg.ChatClient, args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	var s sampling
+	s.register(fs)
+	system := fs.String("system", "", "system prompt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var history []smg.ChatMessage
+	if *system != "" {
+		history = append(history, smg.SystemText(*system))
+	}
+	turn := func(text string) error {
+		history = append(history, smg.UserText(text))
+		maxTokens := s.maxTokens
+		stream, err := client.CreateChatCompletionStream(ctx, smg.ChatCompletionRequest{
+			Model:               s.model,
+			Messages:            history,
+			MaxCompletionTokens: &maxTokens,
+			Temperature:         s.temperaturePtr(),
+			Stream:              true,
+		})
+		if err != nil {
+			history = history[:len(history)-1]
+			return err
+		}
+		defer stream.Close()
+		reply, err := printStream(stream, out, func(chunk []byte) (string, error) {
+			var c smg.ChatCompletionStreamResponse
+			err := json.Unmarshal(chunk, &c)
+			if err != nil || len(c.Choices) == 0 {
+				return "", err
+			}
+			return c.Choices[0].Delta.Content, nil
+		})
+		if err != nil {
+			history = history[:len(history)-1]
+			return err
+		}
+		history = append(history, smg.AssistantText(reply))
+		return nil
+	}
+
+	if fs.NArg() > 0 {
+		return turn(strings.Join(fs.Args(), " "))
+	}
+	scanner := bufio.NewScanner(in)
+	for prompt(in, out); scanner.Scan(); prompt(in, out) {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if err := turn(text); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// prompt shows a prompt when reading turns from a terminal
+func prompt(in io.Reader, out io.Writer) {
+	if f, ok := in.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(out, "> ")
+		}
+	}
+}
+
+// completer is the part of a client complete needs
+type completer interface {
+	CreateCompletionStream(ctx context.Context, req smg.CompletionRequest) (smg.ChatStream, error)
+}
+
+// completeCommand completes the prompt in args and streams the text to out
+func completeCommand(ctx context.Context, client completer, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("complete", flag.ContinueOnError)
+	var s sampling
+	s.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("complete: a prompt is required")
+	}
+
+	maxTokens := s.maxTokens
+	stream, err := client.CreateCompletionStream(ctx, smg.CompletionRequest{
+		Model:       s.model,
+		Prompt:      strings.Join(fs.Args(), " "),
+		MaxTokens:   &maxTokens,
+		Temperature: s.temperaturePtr(),
+		Stream:      true,
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = printStream(stream, out, func(chunk []byte) (string, error) {
+		var c smg.CompletionStreamResponse
+		err := json.Unmarshal(chunk, &c)
+		if err != nil || len(c.Choices) == 0 {
+			return "", err
+		}
+		return c.Choices[0].Text, nil
+	})
+	return err
+}
+
+// printStream writes the text of each chunk, extracted by text, to out as
+// it arrives, ending with a newline, and returns the whole text
+func printStream(stream smg.ChatStream, out io.Writer, text func([]byte) (string, error)) (string, error) {
+	var all strings.Builder
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(out)
+			return "", err
+		}
+		t, err := text([]byte(chunkJSON))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse chunk: %w", err)
+		}
+		fmt.Fprint(out, t)
+		all.WriteString(t)
+	}
+	fmt.Fprintln(out)
+	return all.String(), nil
+}
+
+// workerCounter is the part of a client health needs
+type workerCounter interface {
+	WorkerCount() int
+	HealthyWorkerCount() int
+}
+
+// healthCommand reports the healthy workers, failing with errUnhealthy if
+// there are none
+func healthCommand(client workerCounter, out io.Writer) error {
+	healthy, total := client.HealthyWorkerCount(), client.WorkerCount()
+	fmt.Fprintf(out, "%d/%d workers healthy\n", healthy, total)
+	if healthy == 0 {
+		return errUnhealthy
+	}
+	return nil
+}
+
+// workerLister is the part of a client workers needs
+type workerLister interface {
+	Workers() ([]smg.WorkerStatus, error)
+}
+
+// workersCommand lists the workers as a table, or as JSON with -json
+func workersCommand(client workerLister, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("workers", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	workers, err := client.Workers()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(workers)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tENDPOINT\tHEALTHY\tLOAD\tPROCESSED")
+	for _, w := range workers {
+		fmt.Fprintf(tw, "%d\t%s\t%t\t%d\t%d\n", w.Index, w.Endpoint, w.Healthy, w.Load, w.ProcessedRequests)
+	}
+	return tw.Flush()
+}
+
+// tokenizeCommand prints the token IDs of the text in args, tokenized with
+// the tokenizer at path
+func tokenizeCommand(path string, args []string) error {
+	fs := flag.NewFlagSet("tokenize", flag.ContinueOnError)
+	special := fs.Bool("special", false, "add special tokens such as BOS")
+	tokens := fs.Bool("tokens", false, "print each token with its ID")
+	chat := fs.Bool("chat", false, "count the prompt tokens of the text as a user message, with the chat template")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if path == "" || fs.NArg() == 0 {
+		return fmt.Errorf("tokenize: -tokenizer and a text are required")
+	}
+	tok, err := smg.NewTokenizer(path)
+	if err != nil {
+		return err
+	}
+	defer tok.Close()
+	return tokenize(tok, strings.Join(fs.Args(), " "), *special, *tokens, *chat, os.Stdout)
+}
+
+func tokenize(tok *smg.Tokenizer, text string, special, tokens, chat bool, out io.Writer) error {
+	if chat {
+		n, err := tok.CountPromptTokens(smg.ChatCompletionRequest{Messages: []smg.ChatMessage{smg.UserText(text)}})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d prompt tokens\n", n)
+		return nil
+	}
+
+	ids, err := tok.Encode(text, special)
+	if err != nil {
+		return err
+	}
+	if !tokens {
+		strs := make([]string, len(ids))
+		for i, id := range ids {
+			strs[i] = fmt.Sprint(id)
+		}
+		fmt.Fprintf(out, "[%s]\n%d tokens\n", strings.Join(strs, ", "), len(ids))
+		return nil
+	}
+	for _, id := range ids {
+		token, _, err := tok.IDToToken(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%8d  %q\n", id, token)
+	}
+	fmt.Fprintf(out, "%d tokens\n", len(ids))
+	return nil
+}
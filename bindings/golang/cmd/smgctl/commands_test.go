@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// fakeStream returns its chunks
+type fakeStream struct{ chunks []string }
+
+func (s *fakeStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+// fakeClient replies to chats with the number of messages sent, and
+// completes prompts with "!"
+type fakeClient struct {
+	requests []smg.ChatCompletionRequest
+}
+
+func (c *fakeClient) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	return nil, errors.New("not used")
+}
+
+func (c *fakeClient) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	c.requests = append(c.requests, req)
+	n := string(rune('0' + len(req.Messages)))
+	return &fakeStream{chunks: []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"got "}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"` + n + `"},"finish_reason":"stop"}]}`,
+	}}, nil
+}
+
+func (c *fakeClient) CreateCompletionStream(ctx context.Context, req smg.CompletionRequest) (smg.ChatStream, error) {
+	return &fakeStream{chunks: []string{`{"choices":[{"index":0,"text":"` + req.Prompt + `!"}]}`}}, nil
+}
+
+func (c *fakeClient) WorkerCount() int        { return 2 }
+func (c *fakeClient) HealthyWorkerCount() int { return 0 }
+
+func (c *fakeClient) Workers() ([]smg.WorkerStatus, error) {
+	return []smg.WorkerStatus{{Index: 0, Endpoint: "grpc://a:1", Healthy: true, Load: 3}}, nil
+}
+
+// TestChatCommand tests one-shot and interactive chats
+func TestChatCommand(t *testing.T) {
+	client := &fakeClient{}
+	var out bytes.Buffer
+	if err := chatCommand(context.Background(), client, []string{"-system", "sys", "hello", "there"}, nil, &out); err != nil {
+		t.Fatalf("chatCommand() error: %v", err)
+	}
+	if out.String() != "got 2\n" || client.requests[0].Messages[1].Content != "hello there" {
+		t.Errorf("one-shot output = %q, request = %+v", out.String(), client.requests[0])
+	}
+
+	client, out = &fakeClient{}, bytes.Buffer{}
+	if err := chatCommand(context.Background(), client, nil, strings.NewReader("hi\n\nmore\n"), &out); err != nil {
+		t.Fatalf("chatCommand() error: %v", err)
+	}
+	// The second turn carries the first turn and its reply
+	if out.String() != "got 1\ngot 3\n" || len(client.requests) != 2 || client.requests[1].Messages[1].Content != "got 1" {
+		t.Errorf("interactive output = %q", out.String())
+	}
+}
+
+// TestCompleteCommand tests completing a prompt
+func TestCompleteCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := completeCommand(context.Background(), &fakeClient{}, []string{"-max-tokens", "5", "Once"}, &out); err != nil || out.String() != "Once!\n" {
+		t.Errorf("completeCommand() = %q, %v", out.String(), err)
+	}
+	if err := completeCommand(context.Background(), &fakeClient{}, nil, &out); err == nil {
+		t.Error("completeCommand() without a prompt succeeded")
+	}
+}
+
+// TestHealthAndWorkersCommands tests the health check and worker listing
+func TestHealthAndWorkersCommands(t *testing.T) {
+	var out bytes.Buffer
+	if err := healthCommand(&fakeClient{}, &out); !errors.Is(err, errUnhealthy) || out.String() != "0/2 workers healthy\n" {
+		t.Errorf("healthCommand() = %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := workersCommand(&fakeClient{}, nil, &out); err != nil || !strings.Contains(out.String(), "grpc://a:1") || !strings.HasPrefix(out.String(), "INDEX") {
+		t.Errorf("workersCommand() = %q, %v", out.String(), err)
+	}
+	out.Reset()
+	if err := workersCommand(&fakeClient{}, []string{"-json"}, &out); err != nil || !strings.Contains(out.String(), `"load": 3`) {
+		t.Errorf("workersCommand(-json) = %q, %v", out.String(), err)
+	}
+}
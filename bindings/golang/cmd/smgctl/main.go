@@ -0,0 +1,112 @@
+// smgctl checks an SGLang deployment from a shell through the SDK.
+//
+// Usage:
+//
+//	smgctl [-endpoints grpc://host:20000,...] [-tokenizer path] <command> [flags] [args]
+//
+// Commands:
+//
+//	chat      chat with a model; without a message, read turns from stdin
+//	complete  complete a prompt without a chat template
+//	health    report healthy workers; exits 1 if there are none
+//	workers   list the workers with their health and load
+//	tokenize  print the token IDs of a text
+//
+// -endpoints and -tokenizer default to $SGL_GRPC_ENDPOINTS and
+// $SGL_TOKENIZER_PATH. tokenize needs only the tokenizer.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// errUnhealthy makes smgctl exit with status 1 without printing an error
+var errUnhealthy = errors.New("no healthy workers")
+
+func main() {
+	flag.Usage = usage
+	endpoints := flag.String("endpoints", os.Getenv("SGL_GRPC_ENDPOINTS"), "comma-separated gRPC worker endpoints")
+	tokenizerPath := flag.String("tokenizer", os.Getenv("SGL_TOKENIZER_PATH"), "tokenizer path or HuggingFace model ID")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	if name == "tokenize" {
+		exit(tokenizeCommand(*tokenizerPath, args))
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "smgctl: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	if *endpoints == "" || *tokenizerPath == "" {
+		fmt.Fprintln(os.Stderr, "smgctl: -endpoints and -tokenizer are required")
+		os.Exit(2)
+	}
+	client, err := smg.NewMultiClient(smg.MultiClientConfig{Endpoints: *endpoints, TokenizerPath: *tokenizerPath})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smgctl: %v\n", err)
+		os.Exit(1)
+	}
+	err = cmd(ctx, client, args)
+	client.Close()
+	exit(err)
+}
+
+// commands are the subcommands that talk to the workers
+var commands = map[string]func(ctx context.Context, client *smg.MultiClient, args []string) error{
+	"chat": func(ctx context.Context, client *smg.MultiClient, args []string) error {
+		return chatCommand(ctx, client, args, os.Stdin, os.Stdout)
+	},
+	"complete": func(ctx context.Context, client *smg.MultiClient, args []string) error {
+		return completeCommand(ctx, client, args, os.Stdout)
+	},
+	"health": func(ctx context.Context, client *smg.MultiClient, args []string) error {
+		return healthCommand(client, os.Stdout)
+	},
+	"workers": func(ctx context.Context, client *smg.MultiClient, args []string) error {
+		return workersCommand(client, args, os.Stdout)
+	},
+}
+
+func exit(err error) {
+	switch {
+	case err == nil:
+		os.Exit(0)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case errors.Is(err, errUnhealthy):
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "smgctl: %v\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: smgctl [flags] <command> [command flags] [args]
+
+Commands:
+  chat      chat with a model; without a message, read turns from stdin
+  complete  complete a prompt without a chat template
+  health    report healthy workers; exits 1 if there are none
+  workers   list the workers with their health and load
+  tokenize  print the token IDs of a text
+
+Flags:`)
+	flag.PrintDefaults()
+}
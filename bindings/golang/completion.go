@@ -0,0 +1,346 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the legacy (/v1/completions) completion API.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CompletionRequest represents a legacy text completion request. The prompt is
+// tokenized as-is; no chat template is applied.
+type CompletionRequest struct {
+	// Model specifies the model to use for completion (e.g., "default")
+	Model string `json:"model"`
+	// Prompt is the text to complete
+	Prompt string `json:"prompt"`
+	// Echo prepends the prompt to the generated text
+	Echo              bool           `json:"echo,omitempty"`
+	MaxTokens         *int           `json:"max_tokens,omitempty"`
+	Temperature       *float32       `json:"temperature,omitempty"`
+	TopP              *float32       `json:"top_p,omitempty"`
+	TopK              *int           `json:"top_k,omitempty"`
+	Stream            bool           `json:"stream"`
+	StreamOptions     *StreamOptions `json:"stream_options,omitempty"`
+	Stop              interface{}    `json:"stop,omitempty"`
+	StopTokenIDs      []int          `json:"stop_token_ids,omitempty"`
+	SkipSpecialTokens bool           `json:"skip_special_tokens,omitempty"`
+	IgnoreEos         bool           `json:"ignore_eos,omitempty"`
+	NoStopTrim        bool           `json:"no_stop_trim,omitempty"`
+	FrequencyPenalty  *float32       `json:"frequency_penalty,omitempty"`
+	PresencePenalty   *float32       `json:"presence_penalty,omitempty"`
+	MinP              *float32       `json:"min_p,omitempty"`
+	RepetitionPenalty *float32       `json:"repetition_penalty,omitempty"`
+	Seed              *int           `json:"seed,omitempty"`
+	User              string         `json:"user,omitempty"`
+	// Rid is forwarded to the backend as the request id for log correlation
+	Rid *string `json:"rid,omitempty"`
+	// Priority orders the request against others; see Priority
+	Priority Priority `json:"priority,omitempty"`
+	// Regex constrains the output to match a regular expression
+	Regex string `json:"regex,omitempty"`
+	// EBNF constrains the output to a grammar in EBNF (GBNF) notation
+	EBNF string `json:"ebnf,omitempty"`
+	// SessionParams continues a turn of a backend session; see OpenSession
+	SessionParams *SessionParams `json:"session_params,omitempty"`
+}
+
+// CompletionResponse represents a non-streaming completion response
+type CompletionResponse struct {
+	ID                string             `json:"id"`
+	Object            string             `json:"object"`
+	Created           int64              `json:"created"`
+	Model             string             `json:"model"`
+	SystemFingerprint string             `json:"system_fingerprint,omitempty"`
+	Choices           []CompletionChoice `json:"choices"`
+	Usage             Usage              `json:"usage"`
+}
+
+// CompletionChoice represents a choice in the completion response
+type CompletionChoice struct {
+	Index        int          `json:"index"`
+	Text         string       `json:"text"`
+	FinishReason FinishReason `json:"finish_reason"`
+}
+
+// CompletionStreamResponse represents a streaming completion response
+type CompletionStreamResponse struct {
+	ID                string                   `json:"id"`
+	Object            string                   `json:"object"`
+	Created           int64                    `json:"created"`
+	Model             string                   `json:"model"`
+	SystemFingerprint string                   `json:"system_fingerprint,omitempty"`
+	Choices           []CompletionStreamChoice `json:"choices"`
+	Usage             *Usage                   `json:"usage,omitempty"`
+	// SequenceNumber numbers the chunks consecutively from 1, as
+	// ChatCompletionStreamResponse.SequenceNumber does
+	SequenceNumber int64 `json:"sequence_number,omitempty"`
+}
+
+// CompletionStreamChoice represents a choice in a streaming completion response
+type CompletionStreamChoice struct {
+	Index        int          `json:"index"`
+	Text         string       `json:"text"`
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+}
+
+// CompletionStream represents a streaming completion. Generation runs on the
+// same pipeline as chat completions; chunks are converted to the completion
+// format as they are received.
+type CompletionStream struct {
+	chat ChatStream
+	// echo holds the prompt until it has been sent with the first chunk
+	echo string
+	// sequence numbers the chunks sent, as chat chunks carrying nothing for
+	// a completion are skipped
+	sequence int64
+}
+
+// RecvJSON returns the next completion chunk as JSON, or io.EOF when the
+// stream is done.
+func (s *CompletionStream) RecvJSON() (string, error) {
+	for {
+		chunkJSON, err := s.chat.RecvJSON()
+		if err != nil {
+			return "", err
+		}
+		if chunkJSON == "" {
+			continue
+		}
+
+		var chunk ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			return "", fmt.Errorf("failed to parse chunk: %w", err)
+		}
+
+		completionChunk, ok := completionChunkFromChat(chunk)
+		if !ok && s.echo == "" {
+			continue
+		}
+		if s.echo != "" {
+			if len(completionChunk.Choices) == 0 {
+				completionChunk.Choices = []CompletionStreamChoice{{}}
+			}
+			completionChunk.Choices[0].Text = s.echo + completionChunk.Choices[0].Text
+			s.echo = ""
+		}
+		s.sequence++
+		completionChunk.SequenceNumber = s.sequence
+
+		result, err := json.Marshal(completionChunk)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal chunk: %w", err)
+		}
+		return string(result), nil
+	}
+}
+
+// Close closes the stream and cancels any pending operations.
+func (s *CompletionStream) Close() error {
+	if s.chat != nil {
+		return s.chat.Close()
+	}
+	return nil
+}
+
+// completionChunkFromChat converts a chat completion chunk to a completion
+// chunk. The boolean result is false for chunks that carry nothing a
+// completion client needs, such as the initial role-only delta.
+func completionChunkFromChat(chunk ChatCompletionStreamResponse) (CompletionStreamResponse, bool) {
+	out := CompletionStreamResponse{
+		ID:                chunk.ID,
+		Object:            "text_completion",
+		Created:           chunk.Created,
+		Model:             chunk.Model,
+		SystemFingerprint: chunk.SystemFingerprint,
+		Choices:           []CompletionStreamChoice{},
+		Usage:             chunk.Usage,
+	}
+
+	useful := chunk.Usage != nil
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content == "" && choice.FinishReason == "" {
+			continue
+		}
+		out.Choices = append(out.Choices, CompletionStreamChoice{
+			Index:        choice.Index,
+			Text:         choice.Delta.Content,
+			FinishReason: choice.FinishReason,
+		})
+		useful = true
+	}
+	return out, useful
+}
+
+// collectCompletion reads stream to the end and aggregates it into a single
+// response.
+func collectCompletion(stream ChatStream) (*CompletionResponse, error) {
+	var text strings.Builder
+	var finishReason FinishReason
+	resp := &CompletionResponse{Object: "text_completion"}
+
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var chunk CompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse chunk: %w", err)
+		}
+
+		if chunk.ID != "" {
+			resp.ID = chunk.ID
+		}
+		if chunk.Created > 0 {
+			resp.Created = chunk.Created
+		}
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		if chunk.SystemFingerprint != "" {
+			resp.SystemFingerprint = chunk.SystemFingerprint
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Text)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+	}
+
+	if finishReason == "" {
+		finishReason = FinishReasonStop
+	}
+	resp.Choices = []CompletionChoice{
+		{
+			Index:        0,
+			Text:         text.String(),
+			FinishReason: finishReason,
+		},
+	}
+	return resp, nil
+}
+
+// CreateCompletion creates a non-streaming text completion.
+//
+// Like CreateChatCompletion, it streams internally and aggregates the chunks,
+// so ctx cancellation is observed between chunks.
+func (c *Client) CreateCompletion(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	req.Stream = true
+	req.StreamOptions = withUsage()
+
+	stream, err := c.CreateCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return collectCompletion(stream)
+}
+
+// CreateCompletionStream creates a streaming text completion. Chunks are
+// returned in the OpenAI "text_completion" format.
+func (c *Client) CreateCompletionStream(ctx context.Context, req CompletionRequest) (ChatStream, error) {
+	if c.backend != nil {
+		return c.backend.CreateCompletionStream(ctx, req)
+	}
+
+	c.defaults.applyCompletion(&req)
+	if err := validateConstraints(req.Regex, req.EBNF, false); err != nil {
+		return nil, err
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	if c.grpcClient == nil {
+		return nil, errors.New("gRPC client is closed")
+	}
+
+	grpcStream, err := c.grpcClient.CreateCompletionStream(ctx, reqJSON)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to create gRPC stream: %w", err))
+	}
+	observeWorker(ctx, c.endpoint)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	return newCompletionStream(c.reaper.track(ctx, &ChatCompletionStream{
+		grpcStream: grpcStream,
+		ctx:        streamCtx,
+		cancel:     cancel,
+		usage:      usageFilter{include: includeUsage(req.StreamOptions)},
+		strict:     c.strict,
+	}), req), nil
+}
+
+// CreateCompletion creates a non-streaming text completion with load
+// balancing.
+func (c *MultiClient) CreateCompletion(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	req.Stream = true
+	req.StreamOptions = withUsage()
+
+	stream, err := c.CreateCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return collectCompletion(stream)
+}
+
+// CreateCompletionStream creates a streaming text completion with load
+// balancing. Chunks are returned in the OpenAI "text_completion" format.
+func (c *MultiClient) CreateCompletionStream(ctx context.Context, req CompletionRequest) (ChatStream, error) {
+	c.defaults.applyCompletion(&req)
+	if err := validateConstraints(req.Regex, req.EBNF, false); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	ffiClient := c.ffiClient
+	c.mu.RUnlock()
+
+	if ffiClient == nil {
+		return nil, errors.New("multi-worker client is closed")
+	}
+
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	release, err := c.admission.acquire(ctx, req.Priority)
+	if err != nil {
+		return nil, err
+	}
+	ffiStream, err := ffiClient.CompletionStreamBytes(reqJSON, RequestIDFromContext(ctx))
+	if err != nil {
+		release()
+		return nil, classify(fmt.Errorf("failed to create stream: %w", err))
+	}
+	observeWorker(ctx, ffiStream.WorkerEndpoint())
+
+	stream := newMultiClientStream(ctx, ffiStream, release, usageFilter{include: includeUsage(req.StreamOptions)}, c.strict)
+	return newCompletionStream(c.reaper.track(ctx, stream), req), nil
+}
+
+func newCompletionStream(chat ChatStream, req CompletionRequest) *CompletionStream {
+	stream := &CompletionStream{chat: chat}
+	if req.Echo {
+		stream.echo = req.Prompt
+	}
+	return stream
+}
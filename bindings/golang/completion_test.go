@@ -0,0 +1,67 @@
+package smg
+
+import (
+	"io"
+	"testing"
+)
+
+// fakeChatStream replays fixed chat completion chunks.
+type fakeChatStream struct {
+	chunks []string
+}
+
+func (s *fakeChatStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeChatStream) Close() error { return nil }
+
+// TestCollectCompletion tests conversion of chat chunks to a completion response
+func TestCollectCompletion(t *testing.T) {
+	chunks := []string{
+		`{"id":"cmpl-1","created":10,"model":"m","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		``,
+		`{"id":"cmpl-1","created":10,"model":"m","choices":[{"index":0,"delta":{"content":" world"}}]}`,
+		`{"id":"cmpl-1","created":10,"model":"m","choices":[{"index":0,"delta":{"content":"!"},"finish_reason":"length"}],
+		  "usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`,
+	}
+
+	tests := []struct {
+		name string
+		echo bool
+		want string
+	}{
+		{name: "plain", want: " world!"},
+		{name: "echo", echo: true, want: "Hello world!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := newCompletionStream(
+				&fakeChatStream{chunks: append([]string(nil), chunks...)},
+				CompletionRequest{Prompt: "Hello", Echo: tt.echo},
+			)
+			resp, err := collectCompletion(stream)
+			if err != nil {
+				t.Fatalf("collectCompletion() error: %v", err)
+			}
+			if resp.ID != "cmpl-1" || resp.Object != "text_completion" || resp.Model != "m" {
+				t.Errorf("collectCompletion() header = %+v", resp)
+			}
+			if got := resp.Choices[0].Text; got != tt.want {
+				t.Errorf("Text = %q, want %q", got, tt.want)
+			}
+			if got := resp.Choices[0].FinishReason; got != "length" {
+				t.Errorf("FinishReason = %q, want length", got)
+			}
+			if resp.Usage.TotalTokens != 3 {
+				t.Errorf("Usage = %+v, want total 3", resp.Usage)
+			}
+		})
+	}
+}
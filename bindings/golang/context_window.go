@@ -0,0 +1,141 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file fits completion budgets to the model's context window.
+package smg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ContextWindowSource reports the models a backend serves and their
+// tokenizers. Client, MultiClient, and any Backend implement it.
+type ContextWindowSource interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	Tokenizer(model string) (*Tokenizer, error)
+}
+
+// ContextWindowOptions controls WithContextWindow.
+type ContextWindowOptions struct {
+	// ContextLength, if positive, is used for every model instead of the
+	// MaxContextLength the workers report.
+	ContextLength int
+	// OnClamp, if set, is called when a request's MaxCompletionTokens is
+	// lowered to fit, e.g. to log a warning.
+	OnClamp func(req ChatCompletionRequest, requested, clamped int)
+}
+
+// WithContextWindow returns a middleware that fits each request into the
+// model's context window. The prompt is tokenized as the SDK sends it, and a
+// MaxCompletionTokens larger than the room left after it is lowered to that
+// room, rather than rejected or cut short unpredictably by the backend. A
+// prompt that leaves no room at all fails with ErrInvalidRequest. Requests
+// without MaxCompletionTokens are left to the backend's default.
+//
+// Context lengths are read once per model from source.ListModels. Requests
+// for a model whose context length or tokenizer is unknown pass through
+// unchanged.
+func WithContextWindow(source ContextWindowSource, opts ContextWindowOptions) ChatMiddleware {
+	w := &contextWindow{opts: opts, lengths: make(map[string]int)}
+	w.count = func(req ChatCompletionRequest) (int, error) {
+		tok, err := source.Tokenizer(req.Model)
+		if err != nil {
+			return 0, err
+		}
+		return tok.CountPromptTokens(req)
+	}
+	w.listModels = source.ListModels
+	return func(next ChatClient) ChatClient {
+		return &contextWindowClient{ChatClient: next, window: w}
+	}
+}
+
+// contextWindow holds the context lengths of models, shared by the clients
+// of a middleware
+type contextWindow struct {
+	opts       ContextWindowOptions
+	count      func(ChatCompletionRequest) (int, error)
+	listModels func(ctx context.Context) ([]ModelInfo, error)
+
+	mu      sync.Mutex
+	lengths map[string]int
+}
+
+// contextLength returns the context length of model, or 0 if unknown. A
+// request without a model uses the first model listed.
+func (w *contextWindow) contextLength(ctx context.Context, model string) int {
+	if w.opts.ContextLength > 0 {
+		return w.opts.ContextLength
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n, ok := w.lengths[model]; ok {
+		return n
+	}
+	models, err := w.listModels(ctx)
+	if err != nil || len(models) == 0 {
+		// Not cached, so a later request tries again
+		return 0
+	}
+	for _, m := range models {
+		w.lengths[m.ID] = m.MaxContextLength
+	}
+	if _, ok := w.lengths[""]; !ok {
+		w.lengths[""] = models[0].MaxContextLength
+	}
+	// An unknown model is cached as 0 too, so it is not listed again
+	n := w.lengths[model]
+	w.lengths[model] = n
+	return n
+}
+
+// fit lowers req's MaxCompletionTokens to the room left in the context
+// window
+func (w *contextWindow) fit(ctx context.Context, req ChatCompletionRequest) (ChatCompletionRequest, error) {
+	if req.MaxCompletionTokens == nil {
+		return req, nil
+	}
+	length := w.contextLength(ctx, req.Model)
+	if length <= 0 {
+		return req, nil
+	}
+	prompt, err := w.count(req)
+	if err != nil {
+		return req, nil
+	}
+	room := length - prompt
+	if room <= 0 {
+		return req, invalidRequest(fmt.Sprintf("prompt of %d tokens leaves no room in the context length of %d", prompt, length))
+	}
+	if requested := *req.MaxCompletionTokens; requested > room {
+		req.MaxCompletionTokens = &room
+		if w.opts.OnClamp != nil {
+			w.opts.OnClamp(req, requested, room)
+		}
+	}
+	return req, nil
+}
+
+// contextWindowClient fits the requests of the embedded client into the
+// context window
+type contextWindowClient struct {
+	ChatClient
+	window *contextWindow
+}
+
+func (c *contextWindowClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req, err := c.window.fit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.ChatClient.CreateChatCompletion(ctx, req)
+}
+
+func (c *contextWindowClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	req, err := c.window.fit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.ChatClient.CreateChatCompletionStream(ctx, req)
+}
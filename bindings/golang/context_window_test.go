@@ -0,0 +1,60 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestContextWindow tests clamping, rejecting, and caching context lengths
+func TestContextWindow(t *testing.T) {
+	var got ChatCompletionRequest
+	next := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		got = req
+		return &ChatCompletionResponse{}, nil
+	})
+	lists := 0
+	var clamped []int
+	w := &contextWindow{
+		opts:    ContextWindowOptions{OnClamp: func(req ChatCompletionRequest, requested, n int) { clamped = append(clamped, requested, n) }},
+		lengths: make(map[string]int),
+		count:   func(req ChatCompletionRequest) (int, error) { return countChars(req.Messages) },
+		listModels: func(ctx context.Context) ([]ModelInfo, error) {
+			lists++
+			return []ModelInfo{{ID: "small", MaxContextLength: 10}, {ID: "large", MaxContextLength: 100}}, nil
+		},
+	}
+	client := &contextWindowClient{ChatClient: next, window: w}
+	send := func(model, prompt string, maxTokens int) error {
+		_, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+			Model:               model,
+			Messages:            []ChatMessage{UserText(prompt)},
+			MaxCompletionTokens: &maxTokens,
+		})
+		return err
+	}
+
+	// Each content byte is a token, so "hello" leaves 5 of 10
+	if err := send("small", "hello", 50); err != nil || *got.MaxCompletionTokens != 5 {
+		t.Errorf("small request sent with max tokens %d, %v; want 5", *got.MaxCompletionTokens, err)
+	}
+	if len(clamped) != 2 || clamped[0] != 50 || clamped[1] != 5 {
+		t.Errorf("OnClamp calls = %v", clamped)
+	}
+	if err := send("large", "hello", 50); err != nil || *got.MaxCompletionTokens != 50 {
+		t.Errorf("large request sent with max tokens %d, %v; want 50", *got.MaxCompletionTokens, err)
+	}
+	if err := send("", "hello", 50); err != nil || *got.MaxCompletionTokens != 5 {
+		t.Errorf("request without a model sent with max tokens %d, %v; want the first model's 5", *got.MaxCompletionTokens, err)
+	}
+	if err := send("other", "hello", 50); err != nil || *got.MaxCompletionTokens != 50 {
+		t.Errorf("unknown model sent with max tokens %d, %v; want 50", *got.MaxCompletionTokens, err)
+	}
+	send("other", "hello", 50)
+	if err := send("small", "hello world", 1); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("overlong prompt error = %v, want ErrInvalidRequest", err)
+	}
+	if lists != 2 {
+		t.Errorf("listed models %d times, want 2", lists)
+	}
+}
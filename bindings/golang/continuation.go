@@ -0,0 +1,93 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file continues chat completions cut off by the token limit.
+package smg
+
+import "context"
+
+// DefaultMaxContinuations is the number of continuation requests
+// WithContinuation makes when ContinuationOptions.MaxContinuations is not set.
+const DefaultMaxContinuations = 3
+
+// ContinuationOptions controls WithContinuation.
+type ContinuationOptions struct {
+	// MaxContinuations is the maximum number of continuation requests per
+	// completion. Defaults to DefaultMaxContinuations.
+	MaxContinuations int
+	// MaxTotalTokens, if positive, caps the completion tokens of the first
+	// request and its continuations together. Each continuation's
+	// MaxCompletionTokens is lowered to what remains.
+	MaxTotalTokens int
+}
+
+// WithContinuation returns a middleware that completes answers cut off by
+// the token limit. When a response's finish reason is "length", the output
+// so far is sent back as a final assistant message with ContinueFinalMessage
+// set, and the outputs are joined into one response. The response's
+// finish reason is that of the last request and its usage is the sum of all
+// requests. Streams pass through unchanged.
+func WithContinuation(opts ContinuationOptions) ChatMiddleware {
+	if opts.MaxContinuations <= 0 {
+		opts.MaxContinuations = DefaultMaxContinuations
+	}
+	return func(next ChatClient) ChatClient {
+		return &continuingClient{ChatClient: next, opts: opts}
+	}
+}
+
+// continuingClient continues truncated responses of the embedded client
+type continuingClient struct {
+	ChatClient
+	opts ContinuationOptions
+}
+
+func (c *continuingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if c.opts.MaxTotalTokens > 0 {
+		req.MaxCompletionTokens = capTokens(req.MaxCompletionTokens, c.opts.MaxTotalTokens)
+	}
+	resp, err := c.ChatClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := req.Messages
+	for n := 0; n < c.opts.MaxContinuations; n++ {
+		if len(resp.Choices) == 0 || !resp.Choices[0].FinishReason.IsTruncated() {
+			break
+		}
+		remaining := c.opts.MaxTotalTokens - resp.Usage.CompletionTokens
+		if c.opts.MaxTotalTokens > 0 && remaining <= 0 {
+			break
+		}
+
+		prefix := resp.Choices[0].Message.Content
+		next := req
+		next.Messages = append(append([]ChatMessage(nil), messages...), ChatMessage{Role: "assistant", Content: prefix})
+		next.ContinueFinalMessage = true
+		if c.opts.MaxTotalTokens > 0 {
+			next.MaxCompletionTokens = capTokens(req.MaxCompletionTokens, remaining)
+		}
+		cont, err := c.ChatClient.CreateChatCompletion(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		if len(cont.Choices) == 0 {
+			break
+		}
+
+		choice := &resp.Choices[0]
+		choice.Message.Content = prefix + cont.Choices[0].Message.Content
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls, cont.Choices[0].Message.ToolCalls...)
+		choice.FinishReason = cont.Choices[0].FinishReason
+		resp.Usage = addUsage(resp.Usage, cont.Usage)
+	}
+	return resp, nil
+}
+
+// capTokens returns a token limit of at most limit
+func capTokens(max *int, limit int) *int {
+	if max != nil && *max <= limit {
+		return max
+	}
+	return &limit
+}
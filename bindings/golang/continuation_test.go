@@ -0,0 +1,53 @@
+package smg
+
+import (
+	"context"
+	"testing"
+)
+
+// TestWithContinuation tests stitching continuations until the answer ends
+// or the token budget runs out
+func TestWithContinuation(t *testing.T) {
+	parts := []string{"The quick ", "brown fox ", "jumps."}
+	var requests []ChatCompletionRequest
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		requests = append(requests, req)
+		n := len(requests) - 1
+		finish := FinishReasonLength
+		if n == len(parts)-1 {
+			finish = FinishReasonStop
+		}
+		return &ChatCompletionResponse{
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: parts[n]}, FinishReason: finish}},
+			Usage:   Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+		}, nil
+	})
+
+	client := WithContinuation(ContinuationOptions{})(inner)
+	req := ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "Say it"}}}
+	resp, err := client.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error: %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "The quick brown fox jumps." || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("response = %q (%s), want the stitched answer", got, resp.Choices[0].FinishReason)
+	}
+	if resp.Usage.CompletionTokens != 6 {
+		t.Errorf("completion tokens = %d, want 6", resp.Usage.CompletionTokens)
+	}
+	last := requests[2].Messages
+	if len(last) != 2 || last[1].Role != "assistant" || last[1].Content != "The quick brown fox " || !requests[2].ContinueFinalMessage {
+		t.Errorf("last continuation messages = %+v", last)
+	}
+
+	// A budget of 3 tokens allows one continuation of at most 1 token
+	requests = nil
+	client = WithContinuation(ContinuationOptions{MaxTotalTokens: 3})(inner)
+	resp, _ = client.CreateChatCompletion(context.Background(), req)
+	if len(requests) != 2 || *requests[0].MaxCompletionTokens != 3 || *requests[1].MaxCompletionTokens != 1 {
+		t.Errorf("made %d requests with budget 3", len(requests))
+	}
+	if resp.Choices[0].FinishReason != "length" {
+		t.Errorf("finish reason = %q, want length when the budget runs out", resp.Choices[0].FinishReason)
+	}
+}
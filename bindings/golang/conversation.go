@@ -0,0 +1,307 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides multi-turn conversation state.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultSummaryTokens is the token budget of a rolling summary when
+// SummaryOptions.MaxTokens is not set.
+const DefaultSummaryTokens = 512
+
+// DefaultSummaryPrompt is the system prompt of the model that writes a
+// conversation's rolling summary.
+const DefaultSummaryPrompt = "You maintain the memory of a conversation between a user and an assistant. " +
+	"Update the summary with the messages below, keeping facts, names, decisions, open questions, and the user's preferences. " +
+	"Be concise and reply with only the summary."
+
+// SummaryOptions configures the rolling summary of a Conversation.
+type SummaryOptions struct {
+	// Client writes the summary, e.g. a client of a smaller, cheaper model.
+	// Defaults to the conversation's client.
+	Client ChatClient
+	// Model writes the summary. Defaults to the conversation's model.
+	Model string
+	// Prompt is the system prompt of the summary request. Defaults to
+	// DefaultSummaryPrompt.
+	Prompt string
+	// MaxTokens bounds the summary and is reserved for it in the prompt
+	// budget. Defaults to DefaultSummaryTokens.
+	MaxTokens int
+}
+
+// ConversationOptions controls a Conversation.
+type ConversationOptions struct {
+	// System, if set, starts the history as a system message.
+	System string
+
+	// MaxPromptTokens, if positive, trims the history before each request so
+	// that the prompt, counted with Tokenizer, fits. Trimming follows
+	// Strategy, as Tokenizer.TruncateMessages does, and the trimmed history
+	// replaces the stored one.
+	MaxPromptTokens int
+	Strategy        TruncationStrategy
+	Tokenizer       *Tokenizer
+
+	// Summary, if set, replaces Strategy: history trimmed to fit
+	// MaxPromptTokens is folded by a model into a rolling summary, kept with
+	// the leading system message, instead of being dropped.
+	Summary *SummaryOptions
+
+	// SessionID, if set, sends each turn in the backend session opened with
+	// this ID by SessionClient.OpenSession. The session keeps the KV cache
+	// of earlier turns, so only the messages not yet sent go with each
+	// request. The client must forward SessionParams, as HTTPClient does.
+	// It cannot be combined with MaxPromptTokens, which rewrites history the
+	// session already holds.
+	SessionID string
+}
+
+// Conversation holds the message history of a multi-turn chat and sends each
+// turn with the history through a ChatClient. It is safe for concurrent use;
+// turns are sent one at a time.
+type Conversation struct {
+	mu       sync.Mutex
+	client   ChatClient
+	req      ChatCompletionRequest
+	opts     ConversationOptions
+	messages []ChatMessage
+	// summary is the rolling summary of trimmed history
+	summary string
+	// count returns the prompt tokens of a history; nil disables trimming
+	count func([]ChatMessage) (int, error)
+	// sent is the number of messages held by the session, and lastRid the
+	// request ID of its last turn
+	sent    int
+	lastRid string
+}
+
+// NewConversation creates a conversation that sends turns through client.
+// req sets the model, sampling parameters, and tools of every request; its
+// messages start the history.
+func NewConversation(client ChatClient, req ChatCompletionRequest, opts ConversationOptions) (*Conversation, error) {
+	c := &Conversation{client: client, req: req, opts: opts}
+	if opts.System != "" {
+		c.messages = append(c.messages, ChatMessage{Role: "system", Content: opts.System})
+	}
+	c.messages = append(c.messages, req.Messages...)
+	c.req.Messages = nil
+
+	if opts.SessionID != "" && opts.MaxPromptTokens > 0 {
+		return nil, errors.New("a session cannot be trimmed to MaxPromptTokens")
+	}
+	if opts.MaxPromptTokens > 0 {
+		if opts.Tokenizer == nil {
+			return nil, errors.New("a tokenizer is required to trim to MaxPromptTokens")
+		}
+		c.count = func(msgs []ChatMessage) (int, error) {
+			req := c.req
+			req.Messages = msgs
+			return opts.Tokenizer.CountPromptTokens(req)
+		}
+	}
+	return c, nil
+}
+
+// Send appends a user message with content, sends the history, and appends
+// the model's reply. On error the history is left unchanged.
+func (c *Conversation) Send(ctx context.Context, content string) (*ChatCompletionResponse, error) {
+	return c.SendMessages(ctx, ChatMessage{Role: "user", Content: content})
+}
+
+// SendMessages is Send for arbitrary messages, such as tool results.
+func (c *Conversation) SendMessages(ctx context.Context, messages ...ChatMessage) (*ChatCompletionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := append(append([]ChatMessage(nil), c.messages...), messages...)
+	summary := c.summary
+	if c.count != nil {
+		var err error
+		if c.opts.Summary != nil {
+			history, summary, err = c.summarize(ctx, history)
+		} else {
+			history, err = truncateMessages(history, c.opts.MaxPromptTokens, c.opts.Strategy, c.count)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := c.req
+	req.Messages = withSummary(history, summary)
+	var rid string
+	if c.opts.SessionID != "" {
+		rid = randomID()
+		req.Rid = &rid
+		req.SessionParams = &SessionParams{ID: c.opts.SessionID, Rid: c.lastRid}
+		req.Messages = history[c.sent:]
+	}
+	resp, err := c.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) > 0 {
+		reply := resp.Choices[0].Message
+		history = append(history, assistantTurn(reply.Content, reply.ToolCalls))
+	}
+	c.messages = history
+	c.summary = summary
+	if rid != "" {
+		c.lastRid = rid
+		c.sent = len(history)
+	}
+	return resp, nil
+}
+
+// summarize trims history to fit the prompt budget less the summary's, and
+// returns the kept history with the summary updated with what was trimmed
+func (c *Conversation) summarize(ctx context.Context, history []ChatMessage) ([]ChatMessage, string, error) {
+	fits := func(msgs []ChatMessage) (bool, error) {
+		n, err := c.count(msgs)
+		if err != nil {
+			return false, fmt.Errorf("failed to count prompt tokens: %w", err)
+		}
+		return n <= c.opts.MaxPromptTokens, nil
+	}
+	if ok, err := fits(withSummary(history, c.summary)); err != nil || ok {
+		return history, c.summary, err
+	}
+
+	opts := *c.opts.Summary
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = DefaultSummaryTokens
+	}
+	if c.opts.MaxPromptTokens <= opts.MaxTokens {
+		return nil, "", ErrPromptTooLong
+	}
+	// Count the kept history with an empty summary in place, so that its
+	// heading is budgeted too
+	kept, err := truncateMessages(history, c.opts.MaxPromptTokens-opts.MaxTokens, KeepSystem(), func(msgs []ChatMessage) (int, error) {
+		return c.count(withSummary(msgs, " "))
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	pinned := leadingSystem(history)
+	dropped := history[pinned : pinned+len(history)-len(kept)]
+	if len(dropped) == 0 {
+		return kept, c.summary, nil
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = c.client
+	}
+	if opts.Model == "" {
+		opts.Model = c.req.Model
+	}
+	if opts.Prompt == "" {
+		opts.Prompt = DefaultSummaryPrompt
+	}
+	var transcript strings.Builder
+	if c.summary != "" {
+		fmt.Fprintf(&transcript, "Summary so far:\n%s\n\nNew messages:\n", c.summary)
+	}
+	for _, msg := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, messageText(msg.Content))
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&transcript, "%s called %s(%s)\n", msg.Role, call.Function.Name, call.Function.Arguments)
+		}
+	}
+	temperature := float32(0)
+	resp, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{
+		Model: opts.Model,
+		Messages: []ChatMessage{
+			{Role: "system", Content: opts.Prompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Temperature:         &temperature,
+		MaxCompletionTokens: &opts.MaxTokens,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to summarize dropped messages: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, "", errors.New("failed to summarize dropped messages: response has no choices")
+	}
+	summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+
+	if ok, err := fits(withSummary(kept, summary)); err != nil {
+		return nil, "", err
+	} else if !ok {
+		return nil, "", ErrPromptTooLong
+	}
+	return kept, summary, nil
+}
+
+// withSummary returns history with summary appended to its leading system
+// message, or in a system message of its own
+func withSummary(history []ChatMessage, summary string) []ChatMessage {
+	if summary == "" {
+		return history
+	}
+	text := "Summary of the earlier conversation:\n" + summary
+	out := make([]ChatMessage, 0, len(history)+1)
+	if pinned := leadingSystem(history); pinned > 0 {
+		if system, ok := history[pinned-1].Content.(string); ok {
+			out = append(out, history[:pinned]...)
+			out[pinned-1].Content = system + "\n\n" + text
+			return append(out, history[pinned:]...)
+		}
+	}
+	out = append(out, ChatMessage{Role: "system", Content: text})
+	return append(out, history...)
+}
+
+// leadingSystem returns the number of leading system and developer messages
+// that trimming keeps
+func leadingSystem(history []ChatMessage) int {
+	n := 0
+	for n < len(history)-1 && isInstruction(history[n].Role) {
+		n++
+	}
+	return n
+}
+
+// Append adds messages to the history without sending them.
+func (c *Conversation) Append(messages ...ChatMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, messages...)
+}
+
+// Messages returns a copy of the history, with the rolling summary, if any,
+// as it is sent.
+func (c *Conversation) Messages() []ChatMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ChatMessage(nil), withSummary(c.messages, c.summary)...)
+}
+
+// Summary returns the rolling summary of trimmed history, if any.
+func (c *Conversation) Summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary
+}
+
+// Reset clears the history, keeping the system message if one was set. A
+// session starts over from its first turn.
+func (c *Conversation) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = nil
+	c.summary = ""
+	c.sent = 0
+	c.lastRid = ""
+	if c.opts.System != "" {
+		c.messages = append(c.messages, ChatMessage{Role: "system", Content: c.opts.System})
+	}
+}
@@ -0,0 +1,127 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingClient fails every request.
+type failingClient struct{}
+
+func (failingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (failingClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	return nil, errors.New("unavailable")
+}
+
+// TestConversation tests history, trimming, and rollback on errors
+func TestConversation(t *testing.T) {
+	client := &scriptedClient{contents: []string{"hello", "fine"}}
+	conv, err := NewConversation(client, ChatCompletionRequest{Model: "m"}, ConversationOptions{System: "sys"})
+	if err != nil {
+		t.Fatalf("NewConversation() error: %v", err)
+	}
+	// Count one token per content byte and keep the system message
+	conv.opts.MaxPromptTokens = 10
+	conv.opts.Strategy = KeepSystem()
+	conv.count = countChars
+
+	if _, err := conv.Send(context.Background(), "hi"); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	if _, err := conv.Send(context.Background(), "how?"); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	// sys+hi+hello+how? is 14 bytes and sys+hello+how? 12, so the whole first
+	// exchange was dropped
+	sent := client.requests[1]
+	if sent.Model != "m" || len(sent.Messages) != 2 || sent.Messages[1].Content != "how?" {
+		t.Errorf("second request = %+v", sent)
+	}
+	got := roles(conv.Messages())
+	want := []string{"system:sys", "user:how?", "assistant:fine"}
+	if len(got) != len(want) {
+		t.Fatalf("Messages() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Messages()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	conv.client = failingClient{}
+	if _, err := conv.Send(context.Background(), "again"); err == nil {
+		t.Fatal("Send() succeeded, want error")
+	}
+	if n := len(conv.Messages()); n != 3 {
+		t.Errorf("history has %d messages after a failed send, want 3", n)
+	}
+
+	conv.Reset()
+	if got := roles(conv.Messages()); len(got) != 1 || got[0] != "system:sys" {
+		t.Errorf("Messages() after Reset = %v", got)
+	}
+}
+
+// TestConversationRequiresTokenizer tests that trimming needs a tokenizer
+func TestConversationRequiresTokenizer(t *testing.T) {
+	if _, err := NewConversation(&scriptedClient{}, ChatCompletionRequest{}, ConversationOptions{MaxPromptTokens: 100}); err == nil {
+		t.Error("NewConversation() succeeded without a tokenizer, want error")
+	}
+}
+
+// TestConversationSummary tests that trimmed history is folded into a rolling
+// summary written by the summary client
+func TestConversationSummary(t *testing.T) {
+	client := &scriptedClient{contents: []string{"reply", "reply", "reply", "reply", "reply"}}
+	summarizer := &scriptedClient{contents: []string{"S1", "S2"}}
+	conv, err := NewConversation(client, ChatCompletionRequest{Model: "big"}, ConversationOptions{System: "sys"})
+	if err != nil {
+		t.Fatalf("NewConversation() error: %v", err)
+	}
+	// One token per content byte, with 4 reserved for the summary
+	conv.opts.MaxPromptTokens = 120
+	conv.opts.Summary = &SummaryOptions{Client: summarizer, Model: "small", MaxTokens: 4}
+	conv.count = countChars
+
+	// The fourth and fifth turns overflow the budget
+	turns := []string{"a", "b", "c", "d", "e"}
+	for _, turn := range turns {
+		if _, err := conv.Send(context.Background(), strings.Repeat(turn, 30)); err != nil {
+			t.Fatalf("Send(%s) error: %v", turn, err)
+		}
+	}
+
+	if len(summarizer.requests) != 2 {
+		t.Fatalf("summarizer called %d times, want 2", len(summarizer.requests))
+	}
+	first := summarizer.requests[0]
+	want := "user: " + strings.Repeat("a", 30) + "\nassistant: reply\nuser: " + strings.Repeat("b", 30) + "\n"
+	if first.Model != "small" || *first.MaxCompletionTokens != 4 || first.Messages[1].Content != want {
+		t.Errorf("first summary request = %+v", first)
+	}
+	if second := summarizer.requests[1].Messages[1].Content.(string); !strings.HasPrefix(second, "Summary so far:\nS1\n") {
+		t.Errorf("second summary request = %q, want the previous summary folded in", second)
+	}
+	if conv.Summary() != "S2" {
+		t.Errorf("Summary() = %q, want S2", conv.Summary())
+	}
+
+	sent := client.requests[4].Messages
+	if sent[0].Role != "system" || sent[0].Content != "sys\n\nSummary of the earlier conversation:\nS2" {
+		t.Errorf("system message = %q, want the summary appended", sent[0].Content)
+	}
+	if n, _ := countChars(sent); n > 120 {
+		t.Errorf("prompt has %d tokens, want at most 120", n)
+	}
+
+	conv.Reset()
+	if conv.Summary() != "" || len(conv.Messages()) != 1 {
+		t.Errorf("after Reset, summary = %q, messages = %v", conv.Summary(), conv.Messages())
+	}
+}
@@ -0,0 +1,84 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file exposes the incremental detokenizer used for streaming.
+package smg
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// Detokenizer turns a stream of token IDs back into text the same way the SDK
+// does when streaming responses. Text is only emitted once it forms complete
+// UTF-8, so a character split across several tokens is never returned in
+// pieces.
+//
+// Use it to reconstruct text from raw token IDs, e.g. those reported in
+// logprobs. Call Close to release resources.
+//
+// Thread-safe: All public methods are safe for concurrent use, but tokens must
+// be fed in order.
+type Detokenizer struct {
+	handle *ffi.DetokenizerHandle
+	mu     sync.Mutex
+}
+
+// NewDetokenizer creates a detokenizer for this tokenizer. promptTokenIDs are
+// optional left context (typically the prompt) that is not itself returned but
+// lets the first generated tokens decode with correct spacing. When
+// skipSpecialTokens is true, special tokens are omitted from the output.
+//
+// The detokenizer keeps its own reference to the underlying tokenizer and
+// remains usable after the tokenizer is closed.
+func (t *Tokenizer) NewDetokenizer(promptTokenIDs []uint32, skipSpecialTokens bool) (*Detokenizer, error) {
+	tokenizer, unlock := t.lock()
+	defer unlock()
+
+	if tokenizer == nil {
+		return nil, errors.New("tokenizer is closed")
+	}
+
+	handle, err := ffi.NewDetokenizer(tokenizer, promptTokenIDs, skipSpecialTokens)
+	if err != nil {
+		return nil, err
+	}
+	return &Detokenizer{handle: handle}, nil
+}
+
+// Step appends token IDs and returns the text they complete. The result may
+// be empty when the tokens end partway through a character; that text is
+// returned by a later Step or by Flush.
+func (d *Detokenizer) Step(tokenIDs ...uint32) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handle == nil {
+		return "", errors.New("detokenizer is closed")
+	}
+	return d.handle.Step(tokenIDs)
+}
+
+// Flush returns any text still held back, e.g. at the end of a stream.
+func (d *Detokenizer) Flush() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handle == nil {
+		return "", errors.New("detokenizer is closed")
+	}
+	return d.handle.Flush()
+}
+
+// Close releases the detokenizer. Calling Close multiple times is safe.
+func (d *Detokenizer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handle != nil {
+		d.handle.Free()
+		d.handle = nil
+	}
+	return nil
+}
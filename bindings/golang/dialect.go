@@ -0,0 +1,42 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the backend dialects clients speak to their workers.
+package smg
+
+import "fmt"
+
+// Dialect is the gRPC protocol of the engine serving a client's workers.
+// The engines name sampling parameters differently and shape their
+// responses differently; the client builds each request in its workers'
+// dialect and reads their responses back into the SDK's types, so callers
+// use the same requests and streams whichever engine serves them.
+//
+// Requests naming a parameter the engine has no equivalent for fail with
+// ErrInvalidRequest rather than being sent without it: session_params is
+// SGLang-only, and vLLM always trims the matched stop string, so it rejects
+// no_stop_trim. So do requests the engine rejects during validation, such as
+// a prompt exceeding its context length.
+type Dialect string
+
+// Supported dialects. The empty Dialect is DialectSGLang.
+const (
+	DialectSGLang Dialect = "sglang"
+	DialectVLLM   Dialect = "vllm"
+	// DialectTRTLLM workers do not compute embeddings; CreateEmbeddings
+	// fails with ErrInvalidRequest.
+	DialectTRTLLM Dialect = "trtllm"
+)
+
+// validate reports an unknown dialect before any worker is contacted
+func (d Dialect) validate() error {
+	switch d {
+	case "", DialectSGLang, DialectVLLM, DialectTRTLLM:
+		return nil
+	}
+	return fmt.Errorf("unknown dialect %q: supported dialects are %q, %q and %q", string(d), DialectSGLang, DialectVLLM, DialectTRTLLM)
+}
+
+// isSGLang reports whether d is DialectSGLang, the default
+func (d Dialect) isSGLang() bool {
+	return d == "" || d == DialectSGLang
+}
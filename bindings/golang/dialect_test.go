@@ -0,0 +1,59 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDialectValidate(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		wantErr bool
+	}{
+		{dialect: ""},
+		{dialect: DialectSGLang},
+		{dialect: DialectVLLM},
+		{dialect: DialectTRTLLM},
+		{dialect: "tgi", wantErr: true},
+		{dialect: "VLLM", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.dialect), func(t *testing.T) {
+			err := tt.dialect.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnknownDialectRejectedBeforeConnecting(t *testing.T) {
+	// Nothing listens on the endpoints; only the dialect can fail
+	_, err := NewClient(ClientConfig{
+		Endpoint:      "grpc://localhost:1",
+		TokenizerPath: "/path/to/tokenizer",
+		Dialect:       "tgi",
+	})
+	if err == nil || !strings.Contains(err.Error(), `unknown dialect "tgi"`) {
+		t.Errorf("NewClient() error = %v, want unknown dialect", err)
+	}
+
+	_, err = NewMultiClient(MultiClientConfig{
+		Endpoints:     "grpc://localhost:1,grpc://localhost:2",
+		TokenizerPath: "/path/to/tokenizer",
+		Dialect:       "tgi",
+	})
+	if err == nil || !strings.Contains(err.Error(), `unknown dialect "tgi"`) {
+		t.Errorf("NewMultiClient() error = %v, want unknown dialect", err)
+	}
+}
+
+func TestSpeculativeDecodingRequiresSGLang(t *testing.T) {
+	client := &Client{backend: &MultiClient{}}
+	_, err := client.SpeculativeDecoding(context.Background())
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("SpeculativeDecoding() error = %v, want ErrInvalidRequest", err)
+	}
+}
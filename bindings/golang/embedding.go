@@ -0,0 +1,153 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the embeddings API.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// embedConcurrency is the number of inputs Client.CreateEmbeddings sends to
+// the worker at once; sgl_multi_client_embed sends as many to its workers
+const embedConcurrency = 8
+
+// EmbeddingRequest represents a request for embeddings of a batch of inputs.
+type EmbeddingRequest struct {
+	// Model specifies the model to use (e.g., "default")
+	Model string `json:"model"`
+	// Input is the batch of texts to embed; each is embedded separately
+	Input []string `json:"input"`
+	User  string   `json:"user,omitempty"`
+}
+
+// EmbeddingResponse represents an embeddings response
+type EmbeddingResponse struct {
+	Object string         `json:"object"`
+	Data   []Embedding    `json:"data"`
+	Model  string         `json:"model"`
+	Usage  EmbeddingUsage `json:"usage"`
+}
+
+// Embedding is the embedding of one input, at the input's index
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingUsage represents token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// embedResult is the per-input result of an embed call
+type embedResult struct {
+	Embedding    []float32 `json:"embedding"`
+	PromptTokens int       `json:"prompt_tokens"`
+}
+
+// buildEmbeddingResponse assembles per-input results, in input order, into a
+// response with summed usage.
+func buildEmbeddingResponse(model string, results []embedResult) *EmbeddingResponse {
+	resp := &EmbeddingResponse{
+		Object: "list",
+		Data:   make([]Embedding, len(results)),
+		Model:  model,
+	}
+	for i, result := range results {
+		resp.Data[i] = Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: result.Embedding,
+		}
+		resp.Usage.PromptTokens += result.PromptTokens
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	return resp
+}
+
+// CreateEmbeddings computes an embedding for every input. Inputs are sent to
+// the worker a few at a time; the call fails if any input fails.
+func (c *Client) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	if c.backend != nil {
+		return c.backend.CreateEmbeddings(ctx, req)
+	}
+	if len(req.Input) == 0 {
+		return nil, invalidRequest("input must not be empty")
+	}
+	if c.grpcClient == nil {
+		return nil, errors.New("gRPC client is closed")
+	}
+
+	results := make([]embedResult, len(req.Input))
+	// The group keeps the first error; later failures are usually caused by
+	// the cancellation it triggers
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(embedConcurrency)
+	for i, text := range req.Input {
+		group.Go(func() error {
+			embedding, promptTokens, err := c.grpcClient.Embed(groupCtx, req.Model, text)
+			if err != nil {
+				return fmt.Errorf("input %d: %w", i, err)
+			}
+			results[i] = embedResult{Embedding: embedding, PromptTokens: promptTokens}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, classify(fmt.Errorf("failed to compute embeddings: %w", err))
+	}
+
+	return buildEmbeddingResponse(req.Model, results), nil
+}
+
+// CreateEmbeddings computes an embedding for every input. Each input is
+// routed to a worker by the load balancing policy, and like Client, a few
+// are sent at a time; the call fails if any input fails. The ctx deadline, if any, bounds each input's request, which
+// otherwise times out after five seconds.
+func (c *MultiClient) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	if len(req.Input) == 0 {
+		return nil, invalidRequest("input must not be empty")
+	}
+
+	c.mu.RLock()
+	ffiClient := c.ffiClient
+	c.mu.RUnlock()
+
+	if ffiClient == nil {
+		return nil, errors.New("multi-worker client is closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeoutMS, err := ffiTimeoutMS(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inputsJSON, err := json.Marshal(req.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resultJSON, err := ffiClient.EmbedJSON(req.Model, string(inputsJSON), RequestIDFromContext(ctx), timeoutMS)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to compute embeddings: %w", err))
+	}
+
+	var results []embedResult
+	if err := json.Unmarshal([]byte(resultJSON), &results); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings: %w", err)
+	}
+	if len(results) != len(req.Input) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(results), len(req.Input))
+	}
+
+	return buildEmbeddingResponse(req.Model, results), nil
+}
@@ -0,0 +1,26 @@
+package smg
+
+import "testing"
+
+// TestBuildEmbeddingResponse tests ordering and usage accounting of batch embeddings
+func TestBuildEmbeddingResponse(t *testing.T) {
+	resp := buildEmbeddingResponse("m", []embedResult{
+		{Embedding: []float32{0.1, 0.2}, PromptTokens: 3},
+		{Embedding: []float32{0.3, 0.4}, PromptTokens: 5},
+	})
+
+	if resp.Object != "list" || resp.Model != "m" || len(resp.Data) != 2 {
+		t.Fatalf("buildEmbeddingResponse() = %+v", resp)
+	}
+	for i, d := range resp.Data {
+		if d.Index != i || d.Object != "embedding" {
+			t.Errorf("Data[%d] = %+v", i, d)
+		}
+	}
+	if resp.Data[1].Embedding[0] != 0.3 {
+		t.Errorf("Data[1].Embedding = %v, want input order", resp.Data[1].Embedding)
+	}
+	if resp.Usage.PromptTokens != 8 || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Usage = %+v, want 8 prompt and total tokens", resp.Usage)
+	}
+}
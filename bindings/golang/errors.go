@@ -0,0 +1,77 @@
+package smg
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// Errors classifying why a request failed. Errors returned when creating a
+// completion, stream, or embeddings, or when managing MultiClient workers,
+// match at most one of these with errors.Is; errors matching none of them are
+// internal failures.
+var (
+	// ErrInvalidRequest means the request was rejected as invalid, e.g. an
+	// unknown model, a malformed prompt, or a chat template failure
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrNoHealthyWorkers means no worker was available to serve the request
+	ErrNoHealthyWorkers = errors.New("no healthy workers available")
+)
+
+// classifiedError tags an error with one of the classification errors
+// without changing its message
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classify tags err with the classification error matching its FFI error
+// code or gRPC status, if any
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrInvalidRequest) || errors.Is(err, ErrNoHealthyWorkers) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &classifiedError{kind: kind, err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var ffiErr *ffi.Error
+	if errors.As(err, &ffiErr) {
+		switch ffiErr.Code {
+		case ffi.ErrorInvalidArgument, ffi.ErrorParsingError, ffi.ErrorTokenizationError:
+			return ErrInvalidRequest
+		case ffi.ErrorNoHealthyWorkers:
+			return ErrNoHealthyWorkers
+		}
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.InvalidArgument, codes.OutOfRange:
+			return ErrInvalidRequest
+		case codes.Unavailable:
+			// A Client has a single worker, so an unavailable worker leaves none
+			return ErrNoHealthyWorkers
+		}
+	}
+	return nil
+}
+
+// invalidRequest tags a validation error as ErrInvalidRequest
+func invalidRequest(msg string) error {
+	return &classifiedError{kind: ErrInvalidRequest, err: errors.New(msg)}
+}
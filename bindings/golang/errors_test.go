@@ -0,0 +1,67 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// TestClassify tests that FFI error codes and gRPC statuses map to the
+// classification errors without changing the message
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"ffi invalid argument", &ffi.Error{Code: ffi.ErrorInvalidArgument, Message: "bad"}, ErrInvalidRequest},
+		{"ffi parsing error", &ffi.Error{Code: ffi.ErrorParsingError, Message: "bad"}, ErrInvalidRequest},
+		{"ffi no healthy workers", &ffi.Error{Code: ffi.ErrorNoHealthyWorkers, Message: "none"}, ErrNoHealthyWorkers},
+		{"ffi unknown", &ffi.Error{Code: ffi.ErrorUnknown, Message: "boom"}, nil},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "bad"), ErrInvalidRequest},
+		{"grpc unavailable", status.Error(codes.Unavailable, "down"), ErrNoHealthyWorkers},
+		{"grpc internal", status.Error(codes.Internal, "boom"), nil},
+		{"plain", errors.New("boom"), nil},
+		{"context", context.DeadlineExceeded, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("failed to create stream: %w", tt.err)
+			got := classify(wrapped)
+			if got.Error() != wrapped.Error() {
+				t.Errorf("classify() message = %q, want %q", got.Error(), wrapped.Error())
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("classify() = %v, does not wrap the original error", got)
+			}
+			for _, kind := range []error{ErrInvalidRequest, ErrNoHealthyWorkers} {
+				if is := errors.Is(got, kind); is != (kind == tt.want) {
+					t.Errorf("errors.Is(classify(), %v) = %v", kind, is)
+				}
+			}
+		})
+	}
+
+	if classify(nil) != nil {
+		t.Error("classify(nil) != nil")
+	}
+}
+
+// TestCreateEmbeddingsEmptyInput tests that empty input is an invalid request
+func TestCreateEmbeddingsEmptyInput(t *testing.T) {
+	_, err := (&Client{}).CreateEmbeddings(context.Background(), EmbeddingRequest{})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("CreateEmbeddings() error = %v, want ErrInvalidRequest", err)
+	}
+	_, err = (&MultiClient{}).CreateEmbeddings(context.Background(), EmbeddingRequest{})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("MultiClient.CreateEmbeddings() error = %v, want ErrInvalidRequest", err)
+	}
+}
@@ -0,0 +1,67 @@
+// gRPC proxy example: serves the SGLang scheduler service and forwards each
+// call to the least loaded healthy worker of a MultiClient
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+
+	"github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/grpcproxy"
+)
+
+func main() {
+	endpoints := os.Getenv("SGL_GRPC_ENDPOINTS")
+	if endpoints == "" {
+		endpoints = "grpc://localhost:20000,grpc://localhost:20001"
+	}
+
+	tokenizerPath := os.Getenv("SGL_TOKENIZER_PATH")
+	if tokenizerPath == "" {
+		tokenizerPath = "./examples/tokenizer"
+	}
+
+	listenAddr := os.Getenv("PROXY_LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = ":30000"
+	}
+
+	// The MultiClient owns the worker pool and its health; the proxy
+	// forwards requests, which arrive already tokenized, to its workers
+	client, err := smg.NewMultiClient(smg.MultiClientConfig{
+		Endpoints:     endpoints,
+		TokenizerPath: tokenizerPath,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create multi-worker client: %v", err)
+	}
+	defer client.Close()
+
+	proxy := grpcproxy.New(client)
+	defer proxy.Close()
+
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", listenAddr, err)
+	}
+	server := grpc.NewServer()
+	proxy.Register(server)
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Println("Shutting down...")
+		server.GracefulStop()
+	}()
+
+	log.Printf("Proxying %d workers on %s", client.WorkerCount(), listenAddr)
+	if err := server.Serve(lis); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
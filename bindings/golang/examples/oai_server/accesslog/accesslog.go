@@ -0,0 +1,103 @@
+// Package accesslog writes one JSON line per request, for feeding request
+// analytics pipelines.
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Entry is one access log line. The middleware fills in the request and
+// response; handlers add what only they know through FromContext.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	// Key and Tenant are set for authenticated requests; the key's name is
+	// logged, never the key itself
+	Key        string `json:"key,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent,omitempty"`
+
+	// Set by handlers for inference requests
+	Model            string  `json:"model,omitempty"`
+	Stream           bool    `json:"stream,omitempty"`
+	TTFTMs           float64 `json:"ttft_ms,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	// Worker is the endpoint of the worker that served the request
+	Worker string `json:"worker,omitempty"`
+	// Cache is the response cache result of cacheable requests: "hit",
+	// "miss", or "bypass"
+	Cache string `json:"cache,omitempty"`
+}
+
+// Logger writes entries as JSON lines. It is safe for concurrent use.
+type Logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Options configure the access log file and its rotation
+type Options struct {
+	// File is the log file path, or "stdout"
+	File string
+	// MaxSizeMB is the size at which the file is rotated
+	MaxSizeMB int
+	// MaxBackups and MaxAgeDays bound the rotated files kept; 0 keeps all
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// New creates a logger writing to the file in opts, rotating it as it grows.
+// Rotated files are compressed.
+func New(opts Options) *Logger {
+	if opts.File == "stdout" {
+		return NewWriter(os.Stdout)
+	}
+	return NewWriter(&lumberjack.Logger{
+		Filename:   opts.File,
+		MaxSize:    opts.MaxSizeMB,
+		MaxBackups: opts.MaxBackups,
+		MaxAge:     opts.MaxAgeDays,
+		Compress:   true,
+	})
+}
+
+// NewWriter creates a logger writing to w
+func NewWriter(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+// Write logs e as one line
+func (l *Logger) Write(e *Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(line)
+	return err
+}
+
+// Close closes the underlying file, if any
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.w.(io.Closer); ok && l.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package accesslog
+
+import (
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+)
+
+// userValueKey is the RequestCtx user value holding the request's record
+const userValueKey = "accesslog.record"
+
+// record is the entry of a request being served
+type record struct {
+	entry    Entry
+	start    time.Time
+	detached bool
+	// write completes and writes the entry
+	write func()
+}
+
+// FromContext returns the request's entry for handlers to add details to. It
+// never returns nil; without the middleware the entry is discarded.
+func FromContext(ctx *fasthttp.RequestCtx) *Entry {
+	if r, ok := ctx.UserValue(userValueKey).(*record); ok {
+		return &r.entry
+	}
+	return &Entry{}
+}
+
+// Detach hands the request's entry to the caller, which must call the
+// returned function to write it once the response is complete. Streaming
+// handlers use it because their body stream writers outlive the handler; the
+// status and key are taken when Detach is called. It never returns nil.
+func Detach(ctx *fasthttp.RequestCtx) func() {
+	r, ok := ctx.UserValue(userValueKey).(*record)
+	if !ok {
+		return func() {}
+	}
+	r.detached = true
+	r.fill(ctx)
+	return r.write
+}
+
+// Middleware writes an entry for every request, including those rejected by
+// the middlewares it wraps, such as authentication, so it should run outside
+// them and inside requestid.Middleware. Write errors go to errLogger.
+func Middleware(logger *Logger, errLogger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		r := &record{start: time.Now()}
+		r.entry = Entry{
+			Time:       r.start.UTC(),
+			RequestID:  requestid.FromContext(ctx),
+			Method:     string(ctx.Method()),
+			Path:       string(ctx.Path()),
+			RemoteAddr: ctx.RemoteIP().String(),
+			UserAgent:  string(ctx.UserAgent()),
+		}
+		r.write = func() {
+			r.entry.LatencyMs = Milliseconds(time.Since(r.start))
+			if err := logger.Write(&r.entry); err != nil {
+				errLogger.Warn("Failed to write access log", zap.Error(err), zap.String("request_id", r.entry.RequestID))
+			}
+		}
+		ctx.SetUserValue(userValueKey, r)
+
+		next(ctx)
+
+		if !r.detached {
+			r.fill(ctx)
+			r.write()
+		}
+	}
+}
+
+// fill sets the status and the key that made the request
+func (r *record) fill(ctx *fasthttp.RequestCtx) {
+	r.entry.Status = ctx.Response.StatusCode()
+	if key := auth.KeyFromContext(ctx); key != nil {
+		r.entry.Key = key.Name
+		r.entry.Tenant = key.Tenant
+	}
+}
+
+// Milliseconds converts d to fractional milliseconds, the unit of entry
+// durations
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,251 @@
+// Package auth provides API key authentication for the server.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"oai_server/secrets"
+)
+
+// KeyInfo describes an API key and what it may access
+type KeyInfo struct {
+	Key string `json:"key"`
+	// Name identifies the key in logs; the key itself is never logged
+	Name   string `json:"name,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// AllowedModels restricts the key to these models; empty allows all models
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	// RequestsPerMinute and TokensPerDay override the server-wide limits when set
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerDay      int `json:"tokens_per_day,omitempty"`
+	// MaxInFlight overrides the server-wide per-key concurrency limit when set
+	MaxInFlight int `json:"max_in_flight,omitempty"`
+	// Admin allows the key to call admin endpoints such as /v1/usage
+	Admin bool `json:"admin,omitempty"`
+}
+
+// AllowsModel reports whether the key may use model
+func (k *KeyInfo) AllowsModel(model string) bool {
+	if len(k.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range k.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore looks up API keys. Lookup returns nil and no error for unknown keys.
+type KeyStore interface {
+	Lookup(key string) (*KeyInfo, error)
+}
+
+// KeyStoreFunc adapts a callback to the KeyStore interface, e.g. to check keys
+// against an external service
+type KeyStoreFunc func(key string) (*KeyInfo, error)
+
+// Lookup calls f(key)
+func (f KeyStoreFunc) Lookup(key string) (*KeyInfo, error) {
+	return f(key)
+}
+
+// StaticKeyStore is a fixed, in-memory set of keys
+type StaticKeyStore struct {
+	// keys is indexed by the SHA-256 of the key so lookups do not compare
+	// secrets byte by byte
+	keys map[[sha256.Size]byte]*KeyInfo
+}
+
+// NewStaticKeyStore creates a key store holding keys
+func NewStaticKeyStore(keys []KeyInfo) (*StaticKeyStore, error) {
+	s := &StaticKeyStore{keys: make(map[[sha256.Size]byte]*KeyInfo, len(keys))}
+	for i := range keys {
+		key := keys[i]
+		if key.Key == "" {
+			return nil, fmt.Errorf("key %d is empty", i)
+		}
+		sum := sha256.Sum256([]byte(key.Key))
+		if _, exists := s.keys[sum]; exists {
+			return nil, fmt.Errorf("key %d is a duplicate", i)
+		}
+		if key.Name == "" {
+			key.Name = fmt.Sprintf("key-%d", i)
+		}
+		s.keys[sum] = &key
+	}
+	return s, nil
+}
+
+// Lookup returns the key's metadata, or nil if the key is unknown
+func (s *StaticKeyStore) Lookup(key string) (*KeyInfo, error) {
+	return s.keys[sha256.Sum256([]byte(key))], nil
+}
+
+// Len returns the number of keys in the store
+func (s *StaticKeyStore) Len() int {
+	return len(s.keys)
+}
+
+// ReloadableKeyStore serves lookups from a StaticKeyStore that can be
+// replaced while requests are in flight, e.g. when the configuration is
+// reloaded
+type ReloadableKeyStore struct {
+	store atomic.Pointer[StaticKeyStore]
+}
+
+// NewReloadableKeyStore creates a reloadable key store serving store
+func NewReloadableKeyStore(store *StaticKeyStore) *ReloadableKeyStore {
+	r := &ReloadableKeyStore{}
+	r.store.Store(store)
+	return r
+}
+
+// Set replaces the keys; requests already authenticated are unaffected
+func (r *ReloadableKeyStore) Set(store *StaticKeyStore) {
+	r.store.Store(store)
+}
+
+// Lookup returns the key's metadata from the current keys, or nil if the key
+// is unknown
+func (r *ReloadableKeyStore) Lookup(key string) (*KeyInfo, error) {
+	return r.store.Load().Lookup(key)
+}
+
+// Len returns the number of current keys
+func (r *ReloadableKeyStore) Len() int {
+	return r.store.Load().Len()
+}
+
+// LoadKeys builds a key store from comma-separated key lists (see
+// ParseKeyList), a JSON key file (see LoadKeyFile), and a directory of key
+// files (see LoadKeyDir). Keys in adminList are admin keys. Any of them may
+// be empty.
+func LoadKeys(list, adminList, path, dir string) (*StaticKeyStore, error) {
+	keys := parseKeyList(list)
+	for _, key := range parseKeyList(adminList) {
+		key.Admin = true
+		keys = append(keys, key)
+	}
+	if path != "" {
+		fileKeys, err := readKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if dir != "" {
+		dirKeys, err := readKeyDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, dirKeys...)
+	}
+	return NewStaticKeyStore(keys)
+}
+
+// LoadKeyFile reads a JSON key file of the form
+//
+//	{"keys": [{"key": "sk-...", "name": "ci", "tenant": "team-a", "allowed_models": ["llama"], "admin": false}]}
+func LoadKeyFile(path string) (*StaticKeyStore, error) {
+	keys, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyStore(keys)
+}
+
+// LoadKeyDir reads a directory of key files, such as a mounted Kubernetes
+// secret. Each file holds either a JSON key file or a key list in the
+// ParseKeyList format; keys in a list are named after their file. Hidden
+// files are skipped.
+func LoadKeyDir(dir string) (*StaticKeyStore, error) {
+	keys, err := readKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeyStore(keys)
+}
+
+// ParseKeyList parses a comma-separated key list as used in environment
+// variables. Each entry is "key", "key:tenant", or "key:tenant:model1|model2".
+func ParseKeyList(list string) (*StaticKeyStore, error) {
+	return NewStaticKeyStore(parseKeyList(list))
+}
+
+func readKeyFile(path string) ([]KeyInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyFile(path, data)
+}
+
+func parseKeyFile(path string, data []byte) ([]KeyInfo, error) {
+	var file struct {
+		Keys []KeyInfo `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
+
+func readKeyDir(dir string) ([]KeyInfo, error) {
+	files, err := secrets.Files(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+	var keys []KeyInfo
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content := strings.TrimSpace(string(data))
+		if strings.HasPrefix(content, "{") {
+			fileKeys, err := parseKeyFile(path, data)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, fileKeys...)
+			continue
+		}
+		listKeys := parseKeyList(content)
+		for i := range listKeys {
+			listKeys[i].Name = filepath.Base(path)
+			if len(listKeys) > 1 {
+				listKeys[i].Name = fmt.Sprintf("%s-%d", filepath.Base(path), i)
+			}
+		}
+		keys = append(keys, listKeys...)
+	}
+	return keys, nil
+}
+
+func parseKeyList(list string) []KeyInfo {
+	var keys []KeyInfo
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		key := KeyInfo{Key: parts[0]}
+		if len(parts) > 1 {
+			key.Tenant = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			key.AllowedModels = strings.Split(parts[2], "|")
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
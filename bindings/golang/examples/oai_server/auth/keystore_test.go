@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseKeyList tests the key, tenant, and model fields of key list
+// entries
+func TestParseKeyList(t *testing.T) {
+	keys := parseKeyList(" sk-a , sk-b:team-b, sk-c:team-c:llama|qwen,,sk-d::")
+	want := []KeyInfo{
+		{Key: "sk-a"},
+		{Key: "sk-b", Tenant: "team-b"},
+		{Key: "sk-c", Tenant: "team-c", AllowedModels: []string{"llama", "qwen"}},
+		{Key: "sk-d"},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("parseKeyList() = %+v, want %+v", keys, want)
+	}
+}
+
+// TestStaticKeyStore tests lookups by key hash, default names, and the
+// rejection of empty and duplicate keys
+func TestStaticKeyStore(t *testing.T) {
+	store, err := NewStaticKeyStore([]KeyInfo{{Key: "sk-a", Name: "ci"}, {Key: "sk-b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := store.Lookup("sk-a"); key == nil || key.Name != "ci" {
+		t.Errorf("Lookup(sk-a) = %+v", key)
+	}
+	if key, _ := store.Lookup("sk-b"); key == nil || key.Name != "key-1" {
+		t.Errorf("Lookup(sk-b) = %+v, want the default name key-1", key)
+	}
+	for _, unknown := range []string{"sk-c", "sk-", ""} {
+		if key, err := store.Lookup(unknown); key != nil || err != nil {
+			t.Errorf("Lookup(%q) = %+v, %v, want nil", unknown, key, err)
+		}
+	}
+	for _, key := range store.keys {
+		if key.Key == "" {
+			t.Error("stored key lost its value")
+		}
+	}
+
+	if _, err := NewStaticKeyStore([]KeyInfo{{Key: "sk-a"}, {Key: ""}}); err == nil {
+		t.Error("empty key accepted")
+	}
+	if _, err := NewStaticKeyStore([]KeyInfo{{Key: "sk-a"}, {Key: "sk-a", Name: "again"}}); err == nil {
+		t.Error("duplicate key accepted")
+	}
+}
+
+// TestLoadKeys tests combining key lists, admin keys, a key file, and a key
+// directory
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keys.json")
+	writeFile(t, file, `{"keys": [{"key": "sk-file", "name": "file", "tenant": "t", "allowed_models": ["llama"], "tokens_per_day": 100}]}`)
+	secretDir := filepath.Join(dir, "secret")
+	if err := os.Mkdir(secretDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(secretDir, "ci"), "sk-ci:team-ci\n")
+	writeFile(t, filepath.Join(secretDir, "batch"), "sk-b1,sk-b2")
+	writeFile(t, filepath.Join(secretDir, "json"), `{"keys": [{"key": "sk-json"}]}`)
+	writeFile(t, filepath.Join(secretDir, ".hidden"), "sk-hidden")
+
+	store, err := LoadKeys("sk-list", "sk-admin", file, secretDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 7 {
+		t.Errorf("Len() = %d, want 7", store.Len())
+	}
+	check := func(token string, want KeyInfo) {
+		t.Helper()
+		key, _ := store.Lookup(token)
+		if key == nil {
+			t.Errorf("Lookup(%q) = nil", token)
+			return
+		}
+		want.Key = token
+		if !reflect.DeepEqual(*key, want) {
+			t.Errorf("Lookup(%q) = %+v, want %+v", token, *key, want)
+		}
+	}
+	check("sk-list", KeyInfo{Name: "key-0"})
+	check("sk-admin", KeyInfo{Name: "key-1", Admin: true})
+	check("sk-file", KeyInfo{Name: "file", Tenant: "t", AllowedModels: []string{"llama"}, TokensPerDay: 100})
+	check("sk-b1", KeyInfo{Name: "batch-0"})
+	check("sk-b2", KeyInfo{Name: "batch-1"})
+	check("sk-ci", KeyInfo{Name: "ci", Tenant: "team-ci"})
+	check("sk-json", KeyInfo{Name: "key-6"})
+	if key, _ := store.Lookup("sk-hidden"); key != nil {
+		t.Error("key from a hidden file loaded")
+	}
+
+	writeFile(t, file, `{"keys": [`)
+	if _, err := LoadKeyFile(file); err == nil {
+		t.Error("malformed key file accepted")
+	}
+}
+
+// TestAllowsModel tests the model allow-list of a key
+func TestAllowsModel(t *testing.T) {
+	all := &KeyInfo{}
+	limited := &KeyInfo{AllowedModels: []string{"llama"}}
+	if !all.AllowsModel("anything") || !limited.AllowsModel("llama") || limited.AllowsModel("qwen") || limited.AllowsModel("") {
+		t.Error("AllowsModel() did not follow AllowedModels")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
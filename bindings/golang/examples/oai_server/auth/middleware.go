@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// userValueKey is the RequestCtx user value holding the authenticated *KeyInfo
+const userValueKey = "auth.key"
+
+// publicPaths do not require an API key
+var publicPaths = map[string]bool{
+	"/health":  true,
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+	// The API description, so that clients can be generated before a key
+	// is issued
+	"/openapi.json": true,
+}
+
+// KeyFromContext returns the key that authenticated the request, or nil if
+// authentication is disabled or the path is public
+func KeyFromContext(ctx *fasthttp.RequestCtx) *KeyInfo {
+	key, _ := ctx.UserValue(userValueKey).(*KeyInfo)
+	return key
+}
+
+// Middleware requires a valid "Authorization: Bearer <key>" header, or an
+// "x-api-key: <key>" header as Anthropic clients send, on every non-public
+// request. Unknown keys get 401; requests whose body names a model the key
+// may not use get 403. Both use the OpenAI error format.
+func Middleware(store KeyStore, logger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	bearer := []byte("Bearer ")
+
+	return func(ctx *fasthttp.RequestCtx) {
+		path := string(ctx.Path())
+		if publicPaths[path] {
+			next(ctx)
+			return
+		}
+
+		header := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)
+		token := ctx.Request.Header.Peek("X-Api-Key")
+		if bytes.HasPrefix(header, bearer) {
+			token = header[len(bearer):]
+		}
+		if len(token) == 0 {
+			ctx.Response.Header.Set(fasthttp.HeaderWWWAuthenticate, "Bearer")
+			utils.RespondError(ctx, 401, "Missing API key. Provide it as 'Authorization: Bearer YOUR_KEY'.", "invalid_request_error")
+			return
+		}
+
+		key, err := store.Lookup(string(token))
+		if err != nil {
+			logger.Error("API key lookup failed", zap.Error(err), zap.String("path", path), requestid.Field(ctx))
+			utils.RespondError(ctx, 500, "Failed to verify API key", "server_error")
+			return
+		}
+		if key == nil {
+			logger.Warn("Rejected request with invalid API key", zap.String("path", path), requestid.Field(ctx))
+			ctx.Response.Header.Set(fasthttp.HeaderWWWAuthenticate, "Bearer")
+			utils.RespondErrorWithParam(ctx, 401, "Incorrect API key provided.", "invalid_request_error", "", "invalid_api_key")
+			return
+		}
+
+		// Every request with a body is checked, whatever its method: PUT
+		// /generate, for one, names a model too
+		if len(key.AllowedModels) > 0 && len(ctx.PostBody()) > 0 {
+			var body struct {
+				Model string `json:"model"`
+			}
+			// Malformed bodies are left to the handler to reject
+			if json.Unmarshal(ctx.PostBody(), &body) == nil && !key.AllowsModel(body.Model) {
+				logger.Warn("Rejected request for model not allowed by API key",
+					zap.String("key", key.Name),
+					zap.String("tenant", key.Tenant),
+					zap.String("model", body.Model),
+					requestid.Field(ctx),
+				)
+				utils.RespondErrorWithParam(ctx, 403, fmt.Sprintf("API key is not allowed to use model %q.", body.Model), "permission_error", "model", "")
+				return
+			}
+		}
+
+		ctx.SetUserValue(userValueKey, key)
+		next(ctx)
+	}
+}
+
+// RequireAdmin lets only requests authenticated with an admin key reach next.
+// Admin endpoints are unavailable while authentication is disabled.
+func RequireAdmin(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		key := KeyFromContext(ctx)
+		if key == nil || !key.Admin {
+			utils.RespondError(ctx, fasthttp.StatusForbidden, "This endpoint requires an admin API key.", "permission_error")
+			return
+		}
+		next(ctx)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// serve runs a request through the middleware and returns the context and
+// whether it reached the handler
+func serve(t *testing.T, store KeyStore, method, path, body string, headers map[string]string) (*fasthttp.RequestCtx, bool) {
+	t.Helper()
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	ctx.Request.SetBodyString(body)
+	for name, value := range headers {
+		ctx.Request.Header.Set(name, value)
+	}
+	reached := false
+	Middleware(store, zap.NewNop(), func(ctx *fasthttp.RequestCtx) {
+		reached = true
+	})(&ctx)
+	return &ctx, reached
+}
+
+// errorType returns the OpenAI error type of a response
+func errorType(t *testing.T, ctx *fasthttp.RequestCtx) string {
+	t.Helper()
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(ctx.Response.Body(), &body); err != nil {
+		t.Fatalf("error body %q: %v", ctx.Response.Body(), err)
+	}
+	return body.Error.Type
+}
+
+// TestMiddlewareAuthentication tests public paths, both key headers, and the
+// 401 and 500 responses
+func TestMiddlewareAuthentication(t *testing.T) {
+	store, err := ParseKeyList("sk-good:team")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/health", "/healthz", "/readyz", "/metrics", "/openapi.json"} {
+		if ctx, reached := serve(t, store, "GET", path, "", nil); !reached || KeyFromContext(ctx) != nil {
+			t.Errorf("public path %s: reached = %v, key = %v", path, reached, KeyFromContext(ctx))
+		}
+	}
+
+	for _, headers := range []map[string]string{
+		{"Authorization": "Bearer sk-good"},
+		{"X-Api-Key": "sk-good"},
+	} {
+		ctx, reached := serve(t, store, "GET", "/v1/models", "", headers)
+		if !reached || KeyFromContext(ctx) == nil || KeyFromContext(ctx).Tenant != "team" {
+			t.Errorf("%v: reached = %v, key = %+v", headers, reached, KeyFromContext(ctx))
+		}
+	}
+
+	for _, headers := range []map[string]string{
+		nil,
+		{"Authorization": "Basic sk-good"},
+		{"Authorization": "Bearer sk-bad"},
+		{"X-Api-Key": "sk-bad"},
+	} {
+		ctx, reached := serve(t, store, "POST", "/v1/chat/completions", `{"model":"m"}`, headers)
+		if reached || ctx.Response.StatusCode() != 401 || errorType(t, ctx) != "invalid_request_error" {
+			t.Errorf("%v: reached = %v, status %d", headers, reached, ctx.Response.StatusCode())
+		}
+		if string(ctx.Response.Header.Peek(fasthttp.HeaderWWWAuthenticate)) != "Bearer" {
+			t.Errorf("%v: no WWW-Authenticate header", headers)
+		}
+	}
+
+	failing := KeyStoreFunc(func(string) (*KeyInfo, error) { return nil, errors.New("unavailable") })
+	if ctx, reached := serve(t, failing, "GET", "/v1/models", "", map[string]string{"Authorization": "Bearer sk-good"}); reached || ctx.Response.StatusCode() != 500 {
+		t.Errorf("failed lookup: reached = %v, status %d", reached, ctx.Response.StatusCode())
+	}
+}
+
+// TestMiddlewareAllowedModels tests that a key limited to some models gets
+// 403 for others, whatever the method of the request
+func TestMiddlewareAllowedModels(t *testing.T) {
+	store, err := ParseKeyList("sk-llama::llama,sk-all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := map[string]string{"Authorization": "Bearer sk-llama"}
+
+	for _, method := range []string{"POST", "PUT", "PATCH"} {
+		ctx, reached := serve(t, store, method, "/generate", `{"model":"qwen","text":"hi"}`, limited)
+		if reached || ctx.Response.StatusCode() != 403 || errorType(t, ctx) != "permission_error" {
+			t.Errorf("%s qwen: reached = %v, status %d", method, reached, ctx.Response.StatusCode())
+		}
+		if _, reached := serve(t, store, method, "/generate", `{"model":"llama","text":"hi"}`, limited); !reached {
+			t.Errorf("%s llama was rejected", method)
+		}
+	}
+
+	if _, reached := serve(t, store, "POST", "/v1/chat/completions", `{"model":"qwen"}`, map[string]string{"Authorization": "Bearer sk-all"}); !reached {
+		t.Error("key without an allow-list was rejected")
+	}
+	if _, reached := serve(t, store, "POST", "/v1/chat/completions", `{not json`, limited); !reached {
+		t.Error("malformed body was not left to the handler")
+	}
+	if _, reached := serve(t, store, "GET", "/v1/models", "", limited); !reached {
+		t.Error("request without a body was rejected")
+	}
+}
+
+// TestRequireAdmin tests that admin endpoints need an admin key
+func TestRequireAdmin(t *testing.T) {
+	store, err := LoadKeys("sk-user", "sk-admin", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, want := range map[string]bool{"sk-user": false, "sk-admin": true} {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI("/admin/workers")
+		ctx.Request.Header.Set("Authorization", "Bearer "+token)
+		reached := false
+		Middleware(store, zap.NewNop(), RequireAdmin(func(*fasthttp.RequestCtx) { reached = true }))(&ctx)
+		if reached != want {
+			t.Errorf("%s: reached = %v, want %v", token, reached, want)
+		}
+		if !want && ctx.Response.StatusCode() != 403 {
+			t.Errorf("%s: status %d, want 403", token, ctx.Response.StatusCode())
+		}
+	}
+}
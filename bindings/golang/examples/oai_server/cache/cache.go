@@ -0,0 +1,96 @@
+// Package cache serves repeated deterministic inference requests from memory
+// instead of the workers. Requests match exactly, after normalizing their
+// JSON, and entries expire after a fixed TTL.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	ContentType string
+	Body        []byte
+	expires     time.Time
+}
+
+// Cache is a least-recently-used cache of responses by request key, whose
+// entries expire after a TTL. It is safe for concurrent use.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu sync.Mutex
+	// order holds the keys from most to least recently used
+	order   *list.List
+	entries map[string]*list.Element
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// item is the value of an element of order
+type item struct {
+	key   string
+	entry *Entry
+}
+
+// New creates a cache holding up to maxEntries responses, each for ttl
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns the unexpired response cached under key, or nil
+func (c *Cache) Get(key string) *Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	it := elem.Value.(*item)
+	if !c.now().Before(it.entry.expires) {
+		c.remove(elem)
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return it.entry
+}
+
+// Put caches a response under key, evicting the least recently used
+// response when the cache is full
+func (c *Cache) Put(key, contentType string, body []byte) {
+	entry := &Entry{ContentType: contentType, Body: body, expires: c.now().Add(c.ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*item).entry = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&item{key: key, entry: entry})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// Len returns the number of cached responses, including expired ones not yet
+// evicted
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*item).key)
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestCacheTTL tests that entries expire after the TTL and are then evicted
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(time.Minute, 10)
+	c.now = func() time.Time { return now }
+
+	c.Put("a", "application/json", []byte("1"))
+	now = now.Add(59 * time.Second)
+	if e := c.Get("a"); e == nil || string(e.Body) != "1" || e.ContentType != "application/json" {
+		t.Fatalf("Get() before the TTL = %+v", e)
+	}
+	// Reads do not extend the TTL
+	now = now.Add(time.Second)
+	if e := c.Get("a"); e != nil {
+		t.Errorf("Get() after the TTL = %+v", e)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want the expired entry evicted", c.Len())
+	}
+
+	// Replacing an entry restarts its TTL
+	c.Put("b", "text/plain", []byte("old"))
+	now = now.Add(30 * time.Second)
+	c.Put("b", "text/plain", []byte("new"))
+	now = now.Add(45 * time.Second)
+	if e := c.Get("b"); e == nil || string(e.Body) != "new" {
+		t.Errorf("Get() of a replaced entry = %+v", e)
+	}
+}
+
+// TestCacheLRU tests that the least recently used entry is evicted when the
+// cache is full
+func TestCacheLRU(t *testing.T) {
+	c := New(time.Hour, 3)
+	for i := 0; i < 3; i++ {
+		c.Put(fmt.Sprint(i), "", []byte{byte(i)})
+	}
+	// Reading 0 makes 1 the least recently used
+	c.Get("0")
+	c.Put("3", "", []byte{3})
+	if c.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", c.Len())
+	}
+	if c.Get("1") != nil {
+		t.Error("least recently used entry was kept")
+	}
+	for _, key := range []string{"0", "2", "3"} {
+		if c.Get(key) == nil {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+
+	// Replacing an entry makes it the most recently used without growing
+	// the cache
+	c.Put("0", "", []byte{9})
+	c.Put("4", "", []byte{4})
+	if c.Get("2") != nil || c.Get("0") == nil || c.Len() != 3 {
+		t.Errorf("after replacing 0: 2 kept = %v, 0 kept = %v, Len() = %d", c.Get("2") != nil, c.Get("0") != nil, c.Len())
+	}
+}
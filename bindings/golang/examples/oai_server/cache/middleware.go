@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+
+	"oai_server/accesslog"
+	"oai_server/auth"
+	"oai_server/metrics"
+)
+
+// Header is the response header reporting whether the cache served the
+// request: "HIT", "MISS", or "BYPASS"
+const Header = "X-Cache"
+
+// Cache lookup results, as reported in Header, metrics, and access logs
+const (
+	Hit    = "hit"
+	Miss   = "miss"
+	Bypass = "bypass"
+)
+
+// endpoints are the cacheable paths, by the object holding their sampling
+// parameters; empty for the top level. Embeddings are always deterministic.
+var endpoints = map[string]struct {
+	params        string
+	deterministic bool
+}{
+	"/v1/chat/completions": {},
+	"/v1/completions":      {},
+	"/v1/embeddings":       {deterministic: true},
+	"/v1/responses":        {},
+	"/generate":            {params: "sampling_params"},
+}
+
+// Middleware serves repeated deterministic requests from c: non-streaming
+// requests with temperature 0 or a seed, and embeddings. Successful responses
+// are cached by tenant, path, and normalized request body. Requests with
+// "Cache-Control: no-cache" or "no-store" skip the cache. auth.Middleware
+// must run first for tenants to be kept apart, and request rewrites such as
+// policies should run first so that their result is part of the key.
+func Middleware(c *Cache, m *metrics.Metrics, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		path := string(ctx.Path())
+		ep, ok := endpoints[path]
+		if !ok || len(ctx.PostBody()) == 0 {
+			next(ctx)
+			return
+		}
+
+		var body map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(ctx.PostBody()))
+		decoder.UseNumber()
+		if decoder.Decode(&body) != nil || body == nil || body["stream"] == true {
+			next(ctx)
+			return
+		}
+		params := body
+		if ep.params != "" {
+			params, _ = body[ep.params].(map[string]interface{})
+		}
+		if !ep.deterministic && !deterministic(params) {
+			next(ctx)
+			return
+		}
+
+		if bypassed(ctx) {
+			respond(ctx, m, path, Bypass)
+			next(ctx)
+			return
+		}
+
+		var tenant string
+		if key := auth.KeyFromContext(ctx); key != nil {
+			tenant = key.Tenant
+		}
+		// json.Marshal sorts object keys, so key order and whitespace do not
+		// matter; numbers keep their original text
+		normalized, err := json.Marshal(body)
+		if err != nil {
+			next(ctx)
+			return
+		}
+		sum := sha256.Sum256([]byte(tenant + "\x00" + path + "\x00" + string(normalized)))
+		key := hex.EncodeToString(sum[:])
+
+		if cached := c.Get(key); cached != nil {
+			accesslog.FromContext(ctx).Model, _ = body["model"].(string)
+			respond(ctx, m, path, Hit)
+			ctx.SetStatusCode(fasthttp.StatusOK)
+			ctx.SetContentType(cached.ContentType)
+			ctx.SetBody(cached.Body)
+			return
+		}
+
+		respond(ctx, m, path, Miss)
+		next(ctx)
+		if ctx.Response.StatusCode() == fasthttp.StatusOK && !ctx.Response.IsBodyStream() {
+			c.Put(key, string(ctx.Response.Header.ContentType()), append([]byte(nil), ctx.Response.Body()...))
+		}
+	}
+}
+
+// deterministic reports whether sampling with params always generates the
+// same text: temperature is 0 or a seed is set
+func deterministic(params map[string]interface{}) bool {
+	if temperature, ok := params["temperature"].(json.Number); ok {
+		if t, err := temperature.Float64(); err == nil && t == 0 {
+			return true
+		}
+	}
+	seed, ok := params["seed"]
+	return ok && seed != nil
+}
+
+// bypassed reports whether the client asked not to be served from the cache
+func bypassed(ctx *fasthttp.RequestCtx) bool {
+	cacheControl := strings.ToLower(string(ctx.Request.Header.Peek(fasthttp.HeaderCacheControl)))
+	return strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store")
+}
+
+// respond reports the lookup result in the response, metrics, and access log
+func respond(ctx *fasthttp.RequestCtx, m *metrics.Metrics, path, result string) {
+	ctx.Response.Header.Set(Header, strings.ToUpper(result))
+	m.ObserveCacheLookup(path, result)
+	accesslog.FromContext(ctx).Cache = result
+}
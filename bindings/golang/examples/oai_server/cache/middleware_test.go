@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+)
+
+// cachedServer serves requests through the auth and cache middleware,
+// counting those that reach the handler
+type cachedServer struct {
+	handler fasthttp.RequestHandler
+	calls   int
+}
+
+func newCachedServer(t *testing.T) *cachedServer {
+	t.Helper()
+	store, err := auth.ParseKeyList("sk-a1:team-a,sk-a2:team-a,sk-b:team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &cachedServer{}
+	s.handler = auth.Middleware(store, zap.NewNop(), Middleware(New(time.Hour, 100), nil, func(ctx *fasthttp.RequestCtx) {
+		s.calls++
+		ctx.SetContentType("application/json")
+		ctx.SetBodyString(`{"id":"resp"}`)
+	}))
+	return s
+}
+
+// do sends body to path with key and returns the X-Cache header
+func (s *cachedServer) do(key, path, body string, headers ...string) string {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI(path)
+	ctx.Request.Header.Set("Authorization", "Bearer "+key)
+	for i := 0; i+1 < len(headers); i += 2 {
+		ctx.Request.Header.Set(headers[i], headers[i+1])
+	}
+	ctx.Request.SetBodyString(body)
+	s.handler(&ctx)
+	return string(ctx.Response.Header.Peek(Header))
+}
+
+// TestMiddlewareTenants tests that cached responses are shared by the keys
+// of a tenant but not across tenants
+func TestMiddlewareTenants(t *testing.T) {
+	s := newCachedServer(t)
+	body := `{"model":"m","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+
+	if got := s.do("sk-a1", "/v1/chat/completions", body); got != "MISS" {
+		t.Fatalf("first request: %s", got)
+	}
+	// The same request from another key of the tenant, with other key order
+	// and whitespace
+	if got := s.do("sk-a2", "/v1/chat/completions", `{"messages": [{"content":"hi","role":"user"}], "temperature": 0, "model": "m"}`); got != "HIT" {
+		t.Errorf("same tenant: %s, want HIT", got)
+	}
+	if got := s.do("sk-b", "/v1/chat/completions", body); got != "MISS" {
+		t.Errorf("other tenant: %s, want MISS", got)
+	}
+	if got := s.do("sk-b", "/v1/completions", body); got != "MISS" {
+		t.Errorf("other path: %s, want MISS", got)
+	}
+	if s.calls != 3 {
+		t.Errorf("handler called %d times, want 3", s.calls)
+	}
+}
+
+// TestMiddlewareCacheable tests which requests are looked up in the cache
+func TestMiddlewareCacheable(t *testing.T) {
+	tests := []struct {
+		name, path, body string
+		headers          []string
+		want             string
+	}{
+		{"seed", "/v1/chat/completions", `{"model":"m","seed":1}`, nil, "MISS"},
+		{"sampled", "/v1/chat/completions", `{"model":"m","temperature":0.7}`, nil, ""},
+		{"streamed", "/v1/chat/completions", `{"model":"m","temperature":0,"stream":true}`, nil, ""},
+		{"embeddings", "/v1/embeddings", `{"model":"m","input":"hi"}`, nil, "MISS"},
+		{"generate", "/generate", `{"text":"hi","sampling_params":{"temperature":0}}`, nil, "MISS"},
+		{"generate sampled", "/generate", `{"text":"hi","temperature":0}`, nil, ""},
+		{"no-cache", "/v1/chat/completions", `{"model":"m","temperature":0}`, []string{"Cache-Control", "no-cache"}, "BYPASS"},
+		{"other path", "/v1/models", `{"temperature":0}`, nil, ""},
+		{"malformed", "/v1/chat/completions", `{"temperature":0`, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCachedServer(t)
+			if got := s.do("sk-a1", tt.path, tt.body, tt.headers...); got != tt.want {
+				t.Errorf("X-Cache = %q, want %q", got, tt.want)
+			}
+			if got := s.do("sk-a1", tt.path, tt.body, tt.headers...); tt.want == "MISS" && got != "HIT" {
+				t.Errorf("repeated request: X-Cache = %q, want HIT", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Package concurrency caps the requests in flight, server-wide and per API
+// key, so that bursts wait briefly in a bounded queue or are rejected instead
+// of piling onto saturated workers.
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits are the in-flight limits. Zero disables a limit.
+type Limits struct {
+	// MaxInFlight caps the requests in flight across all keys
+	MaxInFlight int
+	// MaxInFlightPerKey caps the requests in flight per API key
+	MaxInFlightPerKey int
+	// QueueSize is how many requests may wait for a slot; requests beyond it
+	// are rejected at once
+	QueueSize int
+	// QueueTimeout bounds how long a queued request waits for a slot
+	QueueTimeout time.Duration
+}
+
+// Enabled reports whether any in-flight limit is set
+func (l Limits) Enabled() bool {
+	return l.MaxInFlight > 0 || l.MaxInFlightPerKey > 0
+}
+
+// Decision is the outcome of Acquire
+type Decision struct {
+	Allowed bool
+	// Reason explains a rejection
+	Reason string
+	// Waited is how long the request was queued
+	Waited time.Duration
+}
+
+// Limiter tracks the requests in flight. It is safe for concurrent use.
+type Limiter struct {
+	limits Limits
+
+	mu       sync.Mutex
+	inFlight int
+	perKey   map[string]int
+	queued   int
+	// released is closed, and replaced, whenever a slot is released, waking
+	// the queued requests to try again
+	released chan struct{}
+}
+
+// NewLimiter creates a limiter enforcing limits
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		perKey:   make(map[string]int),
+		released: make(chan struct{}),
+	}
+}
+
+// Limits returns the limits the limiter enforces
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+// InFlight returns the requests in flight and the requests queued
+func (l *Limiter) InFlight() (inFlight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, l.queued
+}
+
+// Acquire takes a slot for a request from key, an empty key for
+// unauthenticated requests, waiting in the queue if none is free. keyLimit
+// overrides MaxInFlightPerKey when positive. Allowed requests must call
+// release once they finish.
+func (l *Limiter) Acquire(ctx context.Context, key string, keyLimit int) (release func(), d Decision) {
+	if keyLimit <= 0 {
+		keyLimit = l.limits.MaxInFlightPerKey
+	}
+	if key == "" {
+		keyLimit = 0
+	}
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	queued := false
+	defer func() {
+		if queued {
+			l.mu.Lock()
+			l.queued--
+			l.mu.Unlock()
+		}
+		d.Waited = time.Since(start)
+	}()
+
+	for {
+		l.mu.Lock()
+		globalFull := l.limits.MaxInFlight > 0 && l.inFlight >= l.limits.MaxInFlight
+		keyFull := keyLimit > 0 && l.perKey[key] >= keyLimit
+		if !globalFull && !keyFull {
+			l.inFlight++
+			if key != "" {
+				l.perKey[key]++
+			}
+			l.mu.Unlock()
+			return l.releaser(key), Decision{Allowed: true}
+		}
+
+		reason := "server concurrency limit reached"
+		if !globalFull {
+			reason = "concurrency limit for this key reached"
+		}
+		if !queued {
+			if l.queued >= l.limits.QueueSize || l.limits.QueueTimeout <= 0 {
+				l.mu.Unlock()
+				return nil, Decision{Reason: reason}
+			}
+			l.queued++
+			queued = true
+			timer := time.NewTimer(l.limits.QueueTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-timeout:
+			return nil, Decision{Reason: reason + " while queued"}
+		case <-ctx.Done():
+			return nil, Decision{Reason: "request cancelled while queued"}
+		}
+	}
+}
+
+// releaser returns a function that frees key's slot once, however often it
+// is called
+func (l *Limiter) releaser(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.inFlight--
+			if key != "" {
+				if l.perKey[key]--; l.perKey[key] <= 0 {
+					delete(l.perKey, key)
+				}
+			}
+			close(l.released)
+			l.released = make(chan struct{})
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package concurrency
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// acquire takes a slot for key, failing the test if it is not allowed
+func acquire(t *testing.T, l *Limiter, key string, keyLimit int) func() {
+	t.Helper()
+	release, d := l.Acquire(context.Background(), key, keyLimit)
+	if !d.Allowed {
+		t.Fatalf("Acquire(%q) rejected: %s", key, d.Reason)
+	}
+	return release
+}
+
+// waitQueued waits until n requests are queued on l
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, queued := l.InFlight(); queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests never queued", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestAcquireLimits tests the server-wide and per-key caps, and that requests
+// over them are rejected at once without a queue
+func TestAcquireLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   Limits
+		held     []string
+		key      string
+		keyLimit int
+		reason   string
+	}{
+		{name: "global cap", limits: Limits{MaxInFlight: 2}, held: []string{"a", "b"}, key: "c", reason: "server concurrency limit reached"},
+		{name: "global cap unauthenticated", limits: Limits{MaxInFlight: 1}, held: []string{""}, key: "", reason: "server concurrency limit reached"},
+		{name: "under global cap", limits: Limits{MaxInFlight: 2}, held: []string{"a"}, key: "a"},
+		{name: "key cap", limits: Limits{MaxInFlightPerKey: 1}, held: []string{"a"}, key: "a", reason: "concurrency limit for this key reached"},
+		{name: "key cap other key", limits: Limits{MaxInFlightPerKey: 1}, held: []string{"a"}, key: "b"},
+		{name: "key cap skips unauthenticated", limits: Limits{MaxInFlightPerKey: 1}, held: []string{"", ""}, key: ""},
+		{name: "key limit override", limits: Limits{MaxInFlightPerKey: 1}, held: []string{"a"}, key: "a", keyLimit: 2},
+		{name: "key limit override lower", limits: Limits{MaxInFlightPerKey: 5}, held: []string{"a"}, key: "a", keyLimit: 1, reason: "concurrency limit for this key reached"},
+		{name: "global cap reported first", limits: Limits{MaxInFlight: 1, MaxInFlightPerKey: 1}, held: []string{"a"}, key: "a", reason: "server concurrency limit reached"},
+		{name: "queue full", limits: Limits{MaxInFlight: 1, QueueTimeout: time.Second}, held: []string{"a"}, key: "b", reason: "server concurrency limit reached"},
+		{name: "queue without timeout", limits: Limits{MaxInFlight: 1, QueueSize: 1}, held: []string{"a"}, key: "b", reason: "server concurrency limit reached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.limits)
+			for _, key := range tt.held {
+				acquire(t, l, key, tt.keyLimit)
+			}
+			start := time.Now()
+			release, d := l.Acquire(context.Background(), tt.key, tt.keyLimit)
+			if d.Allowed != (tt.reason == "") || d.Reason != tt.reason {
+				t.Fatalf("Acquire() = %+v, want reason %q", d, tt.reason)
+			}
+			if d.Allowed {
+				release()
+			} else if release != nil {
+				t.Error("rejected Acquire() returned a release function")
+			}
+			if time.Since(start) > 500*time.Millisecond {
+				t.Error("Acquire() waited instead of deciding at once")
+			}
+			if inFlight, queued := l.InFlight(); inFlight != len(tt.held) || queued != 0 {
+				t.Errorf("InFlight() = %d, %d, want %d, 0", inFlight, queued, len(tt.held))
+			}
+		})
+	}
+}
+
+// TestAcquireQueued tests that a queued request takes the slot released
+// while it waits
+func TestAcquireQueued(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlightPerKey: 1, QueueSize: 1, QueueTimeout: 5 * time.Second})
+	release := acquire(t, l, "a", 0)
+
+	done := make(chan Decision)
+	go func() {
+		release, d := l.Acquire(context.Background(), "a", 0)
+		if d.Allowed {
+			release()
+		}
+		done <- d
+	}()
+	waitQueued(t, l, 1)
+
+	// The queue is full, so a third request is rejected at once
+	if _, d := l.Acquire(context.Background(), "a", 0); d.Allowed || d.Reason != "concurrency limit for this key reached" {
+		t.Errorf("Acquire() with a full queue = %+v", d)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	release()
+	d := <-done
+	if !d.Allowed || d.Waited < 10*time.Millisecond {
+		t.Errorf("queued Acquire() = %+v, want allowed after waiting", d)
+	}
+	if inFlight, queued := l.InFlight(); inFlight != 0 || queued != 0 {
+		t.Errorf("InFlight() = %d, %d, want 0, 0", inFlight, queued)
+	}
+}
+
+// TestAcquireQueueTimeout tests that queued requests are rejected once the
+// queue timeout passes or their context is cancelled
+func TestAcquireQueueTimeout(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlight: 1, QueueSize: 2, QueueTimeout: 20 * time.Millisecond})
+	release := acquire(t, l, "a", 0)
+	defer release()
+
+	release2, d := l.Acquire(context.Background(), "b", 0)
+	if d.Allowed {
+		release2()
+		t.Fatal("Acquire() allowed over the cap")
+	}
+	if d.Reason != "server concurrency limit reached while queued" || d.Waited < 20*time.Millisecond {
+		t.Errorf("Acquire() after the queue timeout = %+v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, d := l.Acquire(ctx, "b", 0); d.Allowed || !strings.Contains(d.Reason, "cancelled") {
+		t.Errorf("Acquire() with a cancelled context = %+v", d)
+	}
+	if _, queued := l.InFlight(); queued != 0 {
+		t.Errorf("queued = %d after the waiters left, want 0", queued)
+	}
+}
+
+// TestReleaseOnce tests that releasing a slot twice frees it only once
+func TestReleaseOnce(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlight: 2, MaxInFlightPerKey: 2})
+	release := acquire(t, l, "a", 0)
+	acquire(t, l, "a", 0)
+
+	release()
+	release()
+	if inFlight, _ := l.InFlight(); inFlight != 1 {
+		t.Errorf("in flight = %d after releasing one slot twice, want 1", inFlight)
+	}
+	if l.perKey["a"] != 1 {
+		t.Errorf("key in flight = %d, want 1", l.perKey["a"])
+	}
+}
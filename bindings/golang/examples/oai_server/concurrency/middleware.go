@@ -0,0 +1,94 @@
+package concurrency
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// userValueKey is the RequestCtx user value holding the request's slot
+const userValueKey = "concurrency.slot"
+
+// slot is the in-flight slot held by a request
+type slot struct {
+	release  func()
+	detached bool
+}
+
+// Detach hands the request's slot to the caller, which must call the
+// returned function once the response is complete. Streaming handlers use it
+// because their body stream writers outlive the handler. It never returns
+// nil; the function is a no-op when the request holds no slot.
+func Detach(ctx *fasthttp.RequestCtx) func() {
+	s, ok := ctx.UserValue(userValueKey).(*slot)
+	if !ok {
+		return func() {}
+	}
+	s.detached = true
+	return s.release
+}
+
+// Middleware limits the requests in flight on paths. With auth.Middleware
+// running first, requests are also limited per key name; keys may override
+// the per-key limit. Requests that find no slot wait up to the queue timeout
+// and then get 429 with Retry-After.
+func Middleware(limiter *Limiter, paths []string, logger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	limited := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		limited[p] = true
+	}
+	limits := limiter.Limits()
+
+	// Clients retrying after the queue timeout find the queue drained
+	retryAfter := int(math.Ceil(limits.QueueTimeout.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if !limited[string(ctx.Path())] {
+			next(ctx)
+			return
+		}
+
+		var keyName, tenant string
+		var keyLimit int
+		if key := auth.KeyFromContext(ctx); key != nil {
+			keyName, tenant, keyLimit = key.Name, key.Tenant, key.MaxInFlight
+		}
+
+		release, decision := limiter.Acquire(ctx, keyName, keyLimit)
+		if !decision.Allowed {
+			inFlight, queued := limiter.InFlight()
+			logger.Warn("Rejected request over concurrency limit",
+				zap.String("key", keyName),
+				zap.String("tenant", tenant),
+				zap.String("reason", decision.Reason),
+				zap.Int("in_flight", inFlight),
+				zap.Int("queued", queued),
+				zap.Duration("waited", decision.Waited),
+				requestid.Field(ctx),
+			)
+			ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusTooManyRequests,
+				fmt.Sprintf("Too many concurrent requests: %s. Retry after %d seconds.", decision.Reason, retryAfter),
+				"rate_limit_exceeded", "", "concurrency_limit_exceeded")
+			return
+		}
+
+		s := &slot{release: release}
+		ctx.SetUserValue(userValueKey, s)
+		next(ctx)
+
+		if !s.detached {
+			release()
+		}
+	}
+}
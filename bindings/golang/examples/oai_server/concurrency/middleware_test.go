@@ -0,0 +1,45 @@
+package concurrency
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// TestMiddlewareDetach tests that the slot of a request is released when its
+// handler returns, unless the handler detached it
+func TestMiddlewareDetach(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlight: 1})
+	serve := func(handler fasthttp.RequestHandler) *fasthttp.RequestCtx {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI("/v1/chat/completions")
+		Middleware(l, []string{"/v1/chat/completions"}, zap.NewNop(), handler)(&ctx)
+		return &ctx
+	}
+
+	serve(func(ctx *fasthttp.RequestCtx) {})
+	if inFlight, _ := l.InFlight(); inFlight != 0 {
+		t.Fatalf("in flight = %d after the handler returned, want 0", inFlight)
+	}
+
+	var releaseSlot func()
+	serve(func(ctx *fasthttp.RequestCtx) { releaseSlot = Detach(ctx) })
+	if inFlight, _ := l.InFlight(); inFlight != 1 {
+		t.Fatalf("in flight = %d after the handler detached its slot, want 1", inFlight)
+	}
+	if ctx := serve(func(ctx *fasthttp.RequestCtx) {}); ctx.Response.StatusCode() != fasthttp.StatusTooManyRequests {
+		t.Errorf("status %d while the detached slot is held, want 429", ctx.Response.StatusCode())
+	} else if string(ctx.Response.Header.Peek(fasthttp.HeaderRetryAfter)) != "1" {
+		t.Errorf("Retry-After = %q, want 1", ctx.Response.Header.Peek(fasthttp.HeaderRetryAfter))
+	}
+
+	releaseSlot()
+	if inFlight, _ := l.InFlight(); inFlight != 0 {
+		t.Errorf("in flight = %d after the detached slot was released, want 0", inFlight)
+	}
+
+	// Detach outside the middleware returns a no-op
+	var ctx fasthttp.RequestCtx
+	Detach(&ctx)()
+}
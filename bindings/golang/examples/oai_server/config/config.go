@@ -1,7 +1,16 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration
@@ -13,60 +22,720 @@ type Config struct {
 	Port          string
 	LogDir        string
 	LogLevel      string
+	// AccessLogFile receives one JSON line per request; a relative path is
+	// under LogDir, "stdout" writes to standard output, and empty disables it
+	AccessLogFile string
+	// AccessLogMaxSizeMB is the size at which the access log is rotated;
+	// AccessLogMaxBackups and AccessLogMaxAgeDays bound the rotated files kept
+	AccessLogMaxSizeMB  int
+	AccessLogMaxBackups int
+	AccessLogMaxAgeDays int
 	// PolicyName is the load balancing policy to use ("round_robin", "random", "cache_aware")
 	// Defaults to "round_robin" if not specified
 	PolicyName string
+	// APIKeys is a comma-separated list of API keys ("key[:tenant[:model1|model2]]").
+	// Authentication is disabled when none of APIKeys, AdminAPIKeys,
+	// APIKeysFile, and APIKeysDir is set.
+	APIKeys string
+	// APIKeysFile is the path to a JSON key file (see auth.LoadKeyFile)
+	APIKeysFile string
+	// APIKeysDir is a directory of key files, such as a mounted secret (see
+	// auth.LoadKeyDir)
+	APIKeysDir string
+	// AdminAPIKeys is a comma-separated list of keys, in the APIKeys format,
+	// that may also call admin endpoints
+	AdminAPIKeys string
+	// RateLimitRPM is the default requests per minute per API key; 0 disables it
+	RateLimitRPM int
+	// TokenQuotaPerDay is the default tokens per UTC day per API key; 0 disables it
+	TokenQuotaPerDay int
+	// TenantMonthlyTokens is a comma-separated list of "tenant:tokens" ceilings
+	// per UTC month; tenants not listed are unlimited
+	TenantMonthlyTokens string
+	// MaxInFlight and MaxInFlightPerKey cap the inference requests in
+	// flight, server-wide and per API key; 0 disables a cap
+	MaxInFlight       int
+	MaxInFlightPerKey int
+	// ConcurrencyQueueSize is how many requests over a cap may wait for a
+	// slot, each for up to ConcurrencyQueueTimeout; the rest get 429
+	ConcurrencyQueueSize    int
+	ConcurrencyQueueTimeout time.Duration
+	// ModerationURL is the moderation service that request and response
+	// text is posted to; moderation is disabled when empty
+	ModerationURL    string
+	ModerationAPIKey string
+	// ModerationTimeout bounds each call to the moderation service
+	ModerationTimeout time.Duration
+	// ModerationStages is a comma-separated list of "input" and "output"
+	ModerationStages string
+	// ModerationFailOpen lets text through when the moderation service
+	// fails; otherwise requests get 503 and responses are blocked
+	ModerationFailOpen bool
+	// ModerationStreamWindow is how many bytes of streamed text are held and
+	// checked at once
+	ModerationStreamWindow int
+	// ResponseCacheTTL is how long responses to deterministic requests are
+	// served from memory; 0 disables the response cache
+	ResponseCacheTTL time.Duration
+	// ResponseCacheMaxEntries bounds the cached responses; the least recently
+	// used are evicted first
+	ResponseCacheMaxEntries int
+	// UsagePrices is a comma-separated list of "model:prompt:completion"
+	// prices in USD per million tokens, used to estimate costs in usage
+	// exports; "*" prices models not listed
+	UsagePrices string
+	// UsageExportTarget is the file (appended to) or HTTP(S) URL (posted to)
+	// that usage records are exported to; exports are disabled when empty
+	UsageExportTarget string
+	// UsageExportFormat is "jsonl" or "csv"
+	UsageExportFormat   string
+	UsageExportInterval time.Duration
+	// UsageExportAPIKey is sent as a bearer token to an HTTP target
+	UsageExportAPIKey string
+	// CORSAllowedOrigins is a comma-separated list of origins allowed to call
+	// the server from a browser ("*" for any); CORS is disabled when empty
+	CORSAllowedOrigins string
+	// CORSAllowedMethods and CORSAllowedHeaders override the defaults when set
+	CORSAllowedMethods string
+	CORSAllowedHeaders string
+	// MaxRequestBodyBytes is the largest request body accepted; larger
+	// requests get 413
+	MaxRequestBodyBytes int
+	// DrainTimeout bounds how long shutdown waits for active requests and
+	// streams to finish before the SMG clients are closed
+	DrainTimeout time.Duration
+	// SSEHeartbeatInterval is how long a stream may be idle before a ": ping"
+	// comment is sent so that proxies do not time it out; 0 disables it
+	SSEHeartbeatInterval time.Duration
+	// TLSCertFile and TLSKeyFile are PEM files to serve HTTPS with; the
+	// server uses plain HTTP when both are empty
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSDir is a directory holding tls.crt and tls.key, as mounted from a
+	// Kubernetes TLS secret; it sets the files not set explicitly
+	TLSDir string
+	// TLSReloadInterval is how often the certificate files are checked for
+	// rotation; 0 disables reloading
+	TLSReloadInterval time.Duration
+	// ConfigReloadInterval is how often the config file and API key file are
+	// checked for changes to apply; 0 disables checking, leaving SIGHUP
+	ConfigReloadInterval time.Duration
+	// OpenAPIValidate rejects requests that do not match the OpenAPI document
+	// served at /openapi.json, including parameters the gateway ignores
+	OpenAPIValidate bool
+	// AnthropicMessages serves Anthropic's Messages API at /v1/messages,
+	// translated to chat completions
+	AnthropicMessages bool
+	// WorkerGroups are labeled worker pools in addition to Endpoints; they
+	// only receive requests for aliases naming their labels. Config file only.
+	WorkerGroups []WorkerGroup
+	// ModelAliases maps model names sent by clients to worker models and
+	// groups. Config file only.
+	ModelAliases map[string]ModelAlias
+	// Policies maps tenants, or "*" for all others, to rewrites applied to
+	// their requests. Config file only.
+	Policies map[string]RequestPolicy
+}
+
+// WorkerGroup is a labeled pool of workers with its own client
+type WorkerGroup struct {
+	Labels    map[string]string `yaml:"labels"`
+	Endpoints []string          `yaml:"endpoints"`
+	// TokenizerPath and Policy default to the top-level settings
+	TokenizerPath string `yaml:"tokenizer_path"`
+	Policy        string `yaml:"policy"`
+}
+
+// ModelAlias routes requests for a model name
+type ModelAlias struct {
+	// Model is the name sent to the workers; empty keeps the requested name
+	Model string `yaml:"model"`
+	// Labels select the worker group; empty uses the default workers
+	Labels map[string]string `yaml:"labels"`
+}
+
+// RequestPolicy rewrites a tenant's requests before they are forwarded
+type RequestPolicy struct {
+	// SystemPrompt is added before the client's system messages
+	SystemPrompt string `yaml:"system_prompt"`
+	// SystemPromptMode is "prepend" (the default) to keep the client's system
+	// messages after SystemPrompt, or "replace" to drop them
+	SystemPromptMode string `yaml:"system_prompt_mode"`
+	// MaxTokens caps, and defaults, the tokens generated
+	MaxTokens int `yaml:"max_tokens"`
+	// MaxTemperature and MaxTopP cap the sampling parameters
+	MaxTemperature *float64 `yaml:"max_temperature"`
+	MaxTopP        *float64 `yaml:"max_top_p"`
+	// StripFields are request fields removed before forwarding
+	StripFields []string `yaml:"strip_fields"`
+}
+
+// fileConfig is the layout of the YAML config file. Lists replace the
+// comma-separated values used by environment variables.
+type fileConfig struct {
+	Server struct {
+		Port                 string        `yaml:"port"`
+		ShutdownDrainTimeout time.Duration `yaml:"shutdown_drain_timeout"`
+		MaxRequestBodyBytes  int           `yaml:"max_request_body_bytes"`
+		// A pointer so that 0 can disable heartbeats
+		SSEHeartbeatInterval *time.Duration `yaml:"sse_heartbeat_interval"`
+		ConfigReloadInterval time.Duration  `yaml:"config_reload_interval"`
+		OpenAPIValidate      bool           `yaml:"openapi_validate"`
+		AnthropicMessages    bool           `yaml:"anthropic_messages"`
+		TLS                  struct {
+			CertFile       string        `yaml:"cert_file"`
+			KeyFile        string        `yaml:"key_file"`
+			Dir            string        `yaml:"dir"`
+			ReloadInterval time.Duration `yaml:"reload_interval"`
+		} `yaml:"tls"`
+	} `yaml:"server"`
+	Workers struct {
+		Endpoints     []string      `yaml:"endpoints"`
+		TokenizerPath string        `yaml:"tokenizer_path"`
+		Policy        string        `yaml:"policy"`
+		Groups        []WorkerGroup `yaml:"groups"`
+	} `yaml:"workers"`
+	Models struct {
+		Aliases map[string]ModelAlias `yaml:"aliases"`
+	} `yaml:"models"`
+	Policies map[string]RequestPolicy `yaml:"policies"`
+	Auth     struct {
+		APIKeys      []string `yaml:"api_keys"`
+		APIKeysFile  string   `yaml:"api_keys_file"`
+		APIKeysDir   string   `yaml:"api_keys_dir"`
+		AdminAPIKeys []string `yaml:"admin_api_keys"`
+	} `yaml:"auth"`
+	Limits struct {
+		RequestsPerMinute   int              `yaml:"requests_per_minute"`
+		TokensPerDay        int              `yaml:"tokens_per_day"`
+		TenantMonthlyTokens map[string]int64 `yaml:"tenant_monthly_tokens"`
+		MaxInFlight         int              `yaml:"max_in_flight"`
+		MaxInFlightPerKey   int              `yaml:"max_in_flight_per_key"`
+		// A pointer so that 0 can disable queueing
+		QueueSize    *int          `yaml:"queue_size"`
+		QueueTimeout time.Duration `yaml:"queue_timeout"`
+	} `yaml:"limits"`
+	Moderation struct {
+		URL          string        `yaml:"url"`
+		APIKey       string        `yaml:"api_key"`
+		Timeout      time.Duration `yaml:"timeout"`
+		Stages       []string      `yaml:"stages"`
+		FailOpen     bool          `yaml:"fail_open"`
+		StreamWindow int           `yaml:"stream_window"`
+	} `yaml:"moderation"`
+	Cache struct {
+		TTL        time.Duration `yaml:"ttl"`
+		MaxEntries int           `yaml:"max_entries"`
+	} `yaml:"cache"`
+	Usage struct {
+		Prices map[string]struct {
+			Prompt     float64 `yaml:"prompt"`
+			Completion float64 `yaml:"completion"`
+		} `yaml:"prices"`
+		Export struct {
+			Target   string        `yaml:"target"`
+			Format   string        `yaml:"format"`
+			Interval time.Duration `yaml:"interval"`
+			APIKey   string        `yaml:"api_key"`
+		} `yaml:"export"`
+	} `yaml:"usage"`
+	CORS struct {
+		AllowedOrigins []string `yaml:"allowed_origins"`
+		AllowedMethods []string `yaml:"allowed_methods"`
+		AllowedHeaders []string `yaml:"allowed_headers"`
+	} `yaml:"cors"`
+	Logging struct {
+		Dir       string `yaml:"dir"`
+		Level     string `yaml:"level"`
+		AccessLog struct {
+			// A pointer so that "" can disable the access log
+			File       *string `yaml:"file"`
+			MaxSizeMB  int     `yaml:"max_size_mb"`
+			MaxBackups int     `yaml:"max_backups"`
+			MaxAgeDays int     `yaml:"max_age_days"`
+		} `yaml:"access_log"`
+	} `yaml:"logging"`
+}
+
+// Load builds the configuration from defaults, then the YAML file at path
+// (skipped when path is empty), then environment variables, each overriding
+// the previous
+func Load(path string) (*Config, error) {
+	cfg := defaults()
+	if path != "" {
+		if err := cfg.applyFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	// The file names of Kubernetes TLS secrets
+	if cfg.TLSDir != "" && cfg.TLSCertFile == "" {
+		cfg.TLSCertFile = filepath.Join(cfg.TLSDir, "tls.crt")
+	}
+	if cfg.TLSDir != "" && cfg.TLSKeyFile == "" {
+		cfg.TLSKeyFile = filepath.Join(cfg.TLSDir, "tls.key")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS requires both a certificate and a key file")
+	}
+	if err := cfg.validateRouting(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePolicies(); err != nil {
+		return nil, err
+	}
+	if cfg.UsageExportFormat != "jsonl" && cfg.UsageExportFormat != "csv" {
+		return nil, fmt.Errorf("invalid usage export format %q (want jsonl or csv)", cfg.UsageExportFormat)
+	}
+	for _, stage := range strings.Split(cfg.ModerationStages, ",") {
+		if stage = strings.TrimSpace(stage); stage != "input" && stage != "output" {
+			return nil, fmt.Errorf("invalid moderation stage %q (want input or output)", stage)
+		}
+	}
+	return cfg, nil
 }
 
-// Load loads configuration from environment variables with defaults
-func Load() *Config {
-	// Get tokenizer path from environment or use default
-	tokenizerPath := os.Getenv("SGL_TOKENIZER_PATH")
-	if tokenizerPath == "" {
-		tokenizerPath = "../tokenizer"
+// validateRouting checks that every worker group can be told apart and that
+// every alias has a group to route to
+func (c *Config) validateRouting() error {
+	for i, group := range c.WorkerGroups {
+		if len(group.Labels) == 0 {
+			return fmt.Errorf("worker group %d has no labels", i)
+		}
+		if len(group.Endpoints) == 0 {
+			return fmt.Errorf("worker group %d has no endpoints", i)
+		}
 	}
+	for name, alias := range c.ModelAliases {
+		if alias.Model == "" && len(alias.Labels) == 0 {
+			return fmt.Errorf("model alias %q needs a model or labels", name)
+		}
+		if len(alias.Labels) > 0 && c.GroupFor(alias.Labels) < 0 {
+			return fmt.Errorf("model alias %q: no worker group has labels %v", name, alias.Labels)
+		}
+	}
+	return nil
+}
 
-	// Get endpoints from environment or use default
-	// Supports comma-separated list for multi-worker setups
-	endpoints := os.Getenv("SGL_GRPC_ENDPOINTS")
-	if endpoints == "" {
-		// Fall back to legacy single endpoint
-		endpoints = os.Getenv("SGL_GRPC_ENDPOINT")
-		if endpoints == "" {
-			endpoints = "grpc://localhost:20000"
+// validatePolicies checks the request policy of every tenant
+func (c *Config) validatePolicies() error {
+	for tenant, policy := range c.Policies {
+		switch policy.SystemPromptMode {
+		case "", "prepend", "replace":
+		default:
+			return fmt.Errorf("policy for tenant %q: invalid system_prompt_mode %q (want prepend or replace)", tenant, policy.SystemPromptMode)
+		}
+		if policy.MaxTokens < 0 {
+			return fmt.Errorf("policy for tenant %q: invalid max_tokens %d", tenant, policy.MaxTokens)
+		}
+		if policy.MaxTemperature != nil && *policy.MaxTemperature < 0 {
+			return fmt.Errorf("policy for tenant %q: invalid max_temperature %g", tenant, *policy.MaxTemperature)
+		}
+		if policy.MaxTopP != nil && (*policy.MaxTopP <= 0 || *policy.MaxTopP > 1) {
+			return fmt.Errorf("policy for tenant %q: invalid max_top_p %g", tenant, *policy.MaxTopP)
 		}
 	}
+	return nil
+}
 
-	// Get load balancing policy from environment or use default
-	policyName := os.Getenv("SGL_POLICY_NAME")
-	if policyName == "" {
-		policyName = "round_robin"
+// GroupFor returns the index of the first worker group carrying all of
+// labels, or -1 if there is none
+func (c *Config) GroupFor(labels map[string]string) int {
+	for i, group := range c.WorkerGroups {
+		matches := true
+		for k, v := range labels {
+			if group.Labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return i
+		}
 	}
+	return -1
+}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+func defaults() *Config {
+	return &Config{
+		Endpoints:     "grpc://localhost:20000",
+		TokenizerPath: "../tokenizer",
+		Port:          "8080",
+		LogDir:        "./logs",
+		LogLevel:      "info",
+		PolicyName:    "round_robin",
+		DrainTimeout:  30 * time.Second,
+		// Rotated like the application log
+		AccessLogFile:       "access.log",
+		AccessLogMaxSizeMB:  100,
+		AccessLogMaxBackups: 10,
+		AccessLogMaxAgeDays: 30,
+		// Below the 30-60s idle timeouts common in proxies and load balancers
+		SSEHeartbeatInterval: 15 * time.Second,
+		// fasthttp's default
+		MaxRequestBodyBytes:     4 << 20,
+		ConcurrencyQueueSize:    32,
+		ConcurrencyQueueTimeout: 5 * time.Second,
+		ModerationTimeout:       2 * time.Second,
+		ModerationStages:        "input,output",
+		// A few sentences, so that streams stay responsive
+		ModerationStreamWindow:  256,
+		ResponseCacheMaxEntries: 1000,
+		UsageExportFormat:       "jsonl",
+		UsageExportInterval:     time.Hour,
 	}
+}
 
-	// Get log directory from environment or use default
-	logDir := os.Getenv("LOG_DIR")
-	if logDir == "" {
-		logDir = "./logs"
+// applyFile overrides the configuration with the values set in a YAML file.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func (c *Config) applyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
 	}
+	defer f.Close()
 
-	// Get log level from environment or use default
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel == "" {
-		logLevel = "info"
+	var file fileConfig
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
 
-	return &Config{
-		Endpoints:     endpoints,
-		TokenizerPath: tokenizerPath,
-		Port:          port,
-		LogDir:        logDir,
-		LogLevel:      logLevel,
-		PolicyName:    policyName,
+	setString(&c.Port, file.Server.Port)
+	if file.Server.ShutdownDrainTimeout > 0 {
+		c.DrainTimeout = file.Server.ShutdownDrainTimeout
+	}
+	if file.Server.MaxRequestBodyBytes > 0 {
+		c.MaxRequestBodyBytes = file.Server.MaxRequestBodyBytes
+	}
+	if file.Server.SSEHeartbeatInterval != nil {
+		c.SSEHeartbeatInterval = *file.Server.SSEHeartbeatInterval
+	}
+	if file.Server.ConfigReloadInterval > 0 {
+		c.ConfigReloadInterval = file.Server.ConfigReloadInterval
+	}
+	if file.Server.OpenAPIValidate {
+		c.OpenAPIValidate = true
+	}
+	if file.Server.AnthropicMessages {
+		c.AnthropicMessages = true
+	}
+	setString(&c.TLSCertFile, file.Server.TLS.CertFile)
+	setString(&c.TLSKeyFile, file.Server.TLS.KeyFile)
+	setString(&c.TLSDir, file.Server.TLS.Dir)
+	if file.Server.TLS.ReloadInterval > 0 {
+		c.TLSReloadInterval = file.Server.TLS.ReloadInterval
+	}
+	setString(&c.Endpoints, strings.Join(file.Workers.Endpoints, ","))
+	setString(&c.TokenizerPath, file.Workers.TokenizerPath)
+	setString(&c.PolicyName, file.Workers.Policy)
+	c.WorkerGroups = file.Workers.Groups
+	c.ModelAliases = file.Models.Aliases
+	c.Policies = file.Policies
+	setString(&c.APIKeys, strings.Join(file.Auth.APIKeys, ","))
+	setString(&c.APIKeysFile, file.Auth.APIKeysFile)
+	setString(&c.APIKeysDir, file.Auth.APIKeysDir)
+	setString(&c.AdminAPIKeys, strings.Join(file.Auth.AdminAPIKeys, ","))
+	if file.Limits.RequestsPerMinute > 0 {
+		c.RateLimitRPM = file.Limits.RequestsPerMinute
+	}
+	if file.Limits.TokensPerDay > 0 {
+		c.TokenQuotaPerDay = file.Limits.TokensPerDay
+	}
+	tenantLimits := make([]string, 0, len(file.Limits.TenantMonthlyTokens))
+	for tenant, tokens := range file.Limits.TenantMonthlyTokens {
+		tenantLimits = append(tenantLimits, fmt.Sprintf("%s:%d", tenant, tokens))
+	}
+	sort.Strings(tenantLimits)
+	setString(&c.TenantMonthlyTokens, strings.Join(tenantLimits, ","))
+	if file.Limits.MaxInFlight > 0 {
+		c.MaxInFlight = file.Limits.MaxInFlight
+	}
+	if file.Limits.MaxInFlightPerKey > 0 {
+		c.MaxInFlightPerKey = file.Limits.MaxInFlightPerKey
+	}
+	if file.Limits.QueueSize != nil {
+		if *file.Limits.QueueSize < 0 {
+			return fmt.Errorf("invalid limits.queue_size %d", *file.Limits.QueueSize)
+		}
+		c.ConcurrencyQueueSize = *file.Limits.QueueSize
+	}
+	if file.Limits.QueueTimeout > 0 {
+		c.ConcurrencyQueueTimeout = file.Limits.QueueTimeout
+	}
+	setString(&c.ModerationURL, file.Moderation.URL)
+	setString(&c.ModerationAPIKey, file.Moderation.APIKey)
+	if file.Moderation.Timeout > 0 {
+		c.ModerationTimeout = file.Moderation.Timeout
+	}
+	setString(&c.ModerationStages, strings.Join(file.Moderation.Stages, ","))
+	if file.Moderation.FailOpen {
+		c.ModerationFailOpen = true
+	}
+	if file.Moderation.StreamWindow > 0 {
+		c.ModerationStreamWindow = file.Moderation.StreamWindow
+	}
+	if file.Cache.TTL > 0 {
+		c.ResponseCacheTTL = file.Cache.TTL
+	}
+	if file.Cache.MaxEntries > 0 {
+		c.ResponseCacheMaxEntries = file.Cache.MaxEntries
+	}
+	prices := make([]string, 0, len(file.Usage.Prices))
+	for model, price := range file.Usage.Prices {
+		prices = append(prices, fmt.Sprintf("%s:%g:%g", model, price.Prompt, price.Completion))
+	}
+	sort.Strings(prices)
+	setString(&c.UsagePrices, strings.Join(prices, ","))
+	setString(&c.UsageExportTarget, file.Usage.Export.Target)
+	setString(&c.UsageExportFormat, file.Usage.Export.Format)
+	if file.Usage.Export.Interval > 0 {
+		c.UsageExportInterval = file.Usage.Export.Interval
+	}
+	setString(&c.UsageExportAPIKey, file.Usage.Export.APIKey)
+	setString(&c.CORSAllowedOrigins, strings.Join(file.CORS.AllowedOrigins, ","))
+	setString(&c.CORSAllowedMethods, strings.Join(file.CORS.AllowedMethods, ","))
+	setString(&c.CORSAllowedHeaders, strings.Join(file.CORS.AllowedHeaders, ","))
+	setString(&c.LogDir, file.Logging.Dir)
+	setString(&c.LogLevel, file.Logging.Level)
+	if file.Logging.AccessLog.File != nil {
+		c.AccessLogFile = *file.Logging.AccessLog.File
+	}
+	if file.Logging.AccessLog.MaxSizeMB > 0 {
+		c.AccessLogMaxSizeMB = file.Logging.AccessLog.MaxSizeMB
+	}
+	if file.Logging.AccessLog.MaxBackups > 0 {
+		c.AccessLogMaxBackups = file.Logging.AccessLog.MaxBackups
+	}
+	if file.Logging.AccessLog.MaxAgeDays > 0 {
+		c.AccessLogMaxAgeDays = file.Logging.AccessLog.MaxAgeDays
+	}
+	return nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set
+func (c *Config) applyEnv() error {
+	// SGL_GRPC_ENDPOINTS supports a comma-separated list for multi-worker
+	// setups; SGL_GRPC_ENDPOINT is the legacy single endpoint
+	setString(&c.Endpoints, os.Getenv("SGL_GRPC_ENDPOINT"))
+	setString(&c.Endpoints, os.Getenv("SGL_GRPC_ENDPOINTS"))
+	setString(&c.TokenizerPath, os.Getenv("SGL_TOKENIZER_PATH"))
+	setString(&c.PolicyName, os.Getenv("SGL_POLICY_NAME"))
+	setString(&c.Port, os.Getenv("PORT"))
+	setString(&c.LogDir, os.Getenv("LOG_DIR"))
+	setString(&c.LogLevel, os.Getenv("LOG_LEVEL"))
+
+	// An empty ACCESS_LOG_FILE disables the access log
+	if v, ok := os.LookupEnv("ACCESS_LOG_FILE"); ok {
+		c.AccessLogFile = v
+	}
+	if err := setInt(&c.AccessLogMaxSizeMB, "ACCESS_LOG_MAX_SIZE_MB"); err != nil {
+		return err
+	}
+	if err := setInt(&c.AccessLogMaxBackups, "ACCESS_LOG_MAX_BACKUPS"); err != nil {
+		return err
+	}
+	if err := setInt(&c.AccessLogMaxAgeDays, "ACCESS_LOG_MAX_AGE_DAYS"); err != nil {
+		return err
+	}
+
+	// API keys are optional; both sources may be used together
+	setString(&c.APIKeys, os.Getenv("API_KEYS"))
+	setString(&c.APIKeysFile, os.Getenv("API_KEYS_FILE"))
+	setString(&c.APIKeysDir, os.Getenv("API_KEYS_DIR"))
+	setString(&c.AdminAPIKeys, os.Getenv("ADMIN_API_KEYS"))
+
+	// Default per-key limits; keys in the API key file may override them
+	if err := setInt(&c.RateLimitRPM, "RATE_LIMIT_RPM"); err != nil {
+		return err
+	}
+	if err := setInt(&c.TokenQuotaPerDay, "TOKEN_QUOTA_PER_DAY"); err != nil {
+		return err
+	}
+	setString(&c.TenantMonthlyTokens, os.Getenv("TENANT_MONTHLY_TOKENS"))
+
+	// In-flight caps apply with or without authentication
+	if err := setInt(&c.MaxInFlight, "MAX_IN_FLIGHT"); err != nil {
+		return err
+	}
+	if err := setInt(&c.MaxInFlightPerKey, "MAX_IN_FLIGHT_PER_KEY"); err != nil {
+		return err
+	}
+	if err := setInt(&c.ConcurrencyQueueSize, "CONCURRENCY_QUEUE_SIZE"); err != nil {
+		return err
+	}
+	if v := os.Getenv("CONCURRENCY_QUEUE_TIMEOUT"); v != "" {
+		queueTimeout, err := time.ParseDuration(v)
+		if err != nil || queueTimeout <= 0 {
+			return fmt.Errorf("invalid CONCURRENCY_QUEUE_TIMEOUT %q", v)
+		}
+		c.ConcurrencyQueueTimeout = queueTimeout
+	}
+
+	// Moderation is opt-in
+	setString(&c.ModerationURL, os.Getenv("MODERATION_URL"))
+	setString(&c.ModerationAPIKey, os.Getenv("MODERATION_API_KEY"))
+	setString(&c.ModerationStages, os.Getenv("MODERATION_STAGES"))
+	if v := os.Getenv("MODERATION_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid MODERATION_TIMEOUT %q", v)
+		}
+		c.ModerationTimeout = timeout
+	}
+	if v := os.Getenv("MODERATION_FAIL_OPEN"); v != "" {
+		failOpen, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid MODERATION_FAIL_OPEN %q", v)
+		}
+		c.ModerationFailOpen = failOpen
+	}
+	if err := setInt(&c.ModerationStreamWindow, "MODERATION_STREAM_WINDOW"); err != nil {
+		return err
+	}
+	if c.ModerationStreamWindow == 0 {
+		return fmt.Errorf("invalid MODERATION_STREAM_WINDOW %q", os.Getenv("MODERATION_STREAM_WINDOW"))
+	}
+
+	// The response cache is opt-in
+	if v := os.Getenv("RESPONSE_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid RESPONSE_CACHE_TTL %q", v)
+		}
+		c.ResponseCacheTTL = ttl
+	}
+	if err := setInt(&c.ResponseCacheMaxEntries, "RESPONSE_CACHE_MAX_ENTRIES"); err != nil {
+		return err
+	}
+	if c.ResponseCacheMaxEntries == 0 {
+		return fmt.Errorf("invalid RESPONSE_CACHE_MAX_ENTRIES %q", os.Getenv("RESPONSE_CACHE_MAX_ENTRIES"))
+	}
+
+	// Usage exports are opt-in
+	setString(&c.UsagePrices, os.Getenv("USAGE_PRICES"))
+	setString(&c.UsageExportTarget, os.Getenv("USAGE_EXPORT_TARGET"))
+	setString(&c.UsageExportFormat, os.Getenv("USAGE_EXPORT_FORMAT"))
+	setString(&c.UsageExportAPIKey, os.Getenv("USAGE_EXPORT_API_KEY"))
+	if v := os.Getenv("USAGE_EXPORT_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid USAGE_EXPORT_INTERVAL %q", v)
+		}
+		c.UsageExportInterval = interval
+	}
+
+	// CORS is opt-in, e.g. for browser-based playgrounds during development
+	setString(&c.CORSAllowedOrigins, os.Getenv("CORS_ALLOWED_ORIGINS"))
+	setString(&c.CORSAllowedMethods, os.Getenv("CORS_ALLOWED_METHODS"))
+	setString(&c.CORSAllowedHeaders, os.Getenv("CORS_ALLOWED_HEADERS"))
+
+	if v := os.Getenv("SHUTDOWN_DRAIN_TIMEOUT"); v != "" {
+		drainTimeout, err := time.ParseDuration(v)
+		if err != nil || drainTimeout <= 0 {
+			return fmt.Errorf("invalid SHUTDOWN_DRAIN_TIMEOUT %q", v)
+		}
+		c.DrainTimeout = drainTimeout
+	}
+
+	if v := os.Getenv("SSE_HEARTBEAT_INTERVAL"); v != "" {
+		heartbeatInterval, err := time.ParseDuration(v)
+		if err != nil || heartbeatInterval < 0 {
+			return fmt.Errorf("invalid SSE_HEARTBEAT_INTERVAL %q", v)
+		}
+		c.SSEHeartbeatInterval = heartbeatInterval
+	}
+
+	if err := setInt(&c.MaxRequestBodyBytes, "MAX_REQUEST_BODY_BYTES"); err != nil {
+		return err
+	}
+	if c.MaxRequestBodyBytes == 0 {
+		return fmt.Errorf("invalid MAX_REQUEST_BODY_BYTES %q", os.Getenv("MAX_REQUEST_BODY_BYTES"))
+	}
+
+	setString(&c.TLSCertFile, os.Getenv("TLS_CERT_FILE"))
+	setString(&c.TLSKeyFile, os.Getenv("TLS_KEY_FILE"))
+	setString(&c.TLSDir, os.Getenv("TLS_DIR"))
+	if v := os.Getenv("TLS_RELOAD_INTERVAL"); v != "" {
+		reloadInterval, err := time.ParseDuration(v)
+		if err != nil || reloadInterval < 0 {
+			return fmt.Errorf("invalid TLS_RELOAD_INTERVAL %q", v)
+		}
+		c.TLSReloadInterval = reloadInterval
+	}
+	if v := os.Getenv("CONFIG_RELOAD_INTERVAL"); v != "" {
+		reloadInterval, err := time.ParseDuration(v)
+		if err != nil || reloadInterval < 0 {
+			return fmt.Errorf("invalid CONFIG_RELOAD_INTERVAL %q", v)
+		}
+		c.ConfigReloadInterval = reloadInterval
+	}
+	if v := os.Getenv("OPENAPI_VALIDATE"); v != "" {
+		validate, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid OPENAPI_VALIDATE %q", v)
+		}
+		c.OpenAPIValidate = validate
+	}
+	if v := os.Getenv("ANTHROPIC_MESSAGES"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid ANTHROPIC_MESSAGES %q", v)
+		}
+		c.AnthropicMessages = enabled
+	}
+	return nil
+}
+
+// reloadable are the settings that a configuration reload applies; the
+// others take effect only after a restart
+var reloadable = map[string]bool{
+	"Endpoints":           true,
+	"APIKeys":             true,
+	"APIKeysFile":         true,
+	"APIKeysDir":          true,
+	"AdminAPIKeys":        true,
+	"RateLimitRPM":        true,
+	"TokenQuotaPerDay":    true,
+	"TenantMonthlyTokens": true,
+	"ModelAliases":        true,
+	"Policies":            true,
+}
+
+// RestartRequired returns the names of the settings that differ in next but
+// that a configuration reload does not apply
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	current, updated := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Name
+		if !reloadable[name] && !reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// setString sets *dst to v unless v is empty
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// setInt sets *dst to the value of the environment variable name, if set
+func setInt(dst *int, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid %s %q", name, v)
 	}
+	*dst = n
+	return nil
 }
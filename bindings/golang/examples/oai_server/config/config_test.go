@@ -0,0 +1,298 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envVars are the environment variables Load reads
+var envVars = []string{
+	"SGL_GRPC_ENDPOINT", "SGL_GRPC_ENDPOINTS", "SGL_TOKENIZER_PATH", "SGL_POLICY_NAME",
+	"PORT", "LOG_DIR", "LOG_LEVEL",
+	"ACCESS_LOG_FILE", "ACCESS_LOG_MAX_SIZE_MB", "ACCESS_LOG_MAX_BACKUPS", "ACCESS_LOG_MAX_AGE_DAYS",
+	"API_KEYS", "API_KEYS_FILE", "API_KEYS_DIR", "ADMIN_API_KEYS",
+	"RATE_LIMIT_RPM", "TOKEN_QUOTA_PER_DAY", "TENANT_MONTHLY_TOKENS",
+	"MAX_IN_FLIGHT", "MAX_IN_FLIGHT_PER_KEY", "CONCURRENCY_QUEUE_SIZE", "CONCURRENCY_QUEUE_TIMEOUT",
+	"MODERATION_URL", "MODERATION_API_KEY", "MODERATION_STAGES", "MODERATION_TIMEOUT",
+	"MODERATION_FAIL_OPEN", "MODERATION_STREAM_WINDOW",
+	"RESPONSE_CACHE_TTL", "RESPONSE_CACHE_MAX_ENTRIES",
+	"USAGE_PRICES", "USAGE_EXPORT_TARGET", "USAGE_EXPORT_FORMAT", "USAGE_EXPORT_API_KEY", "USAGE_EXPORT_INTERVAL",
+	"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS",
+	"SHUTDOWN_DRAIN_TIMEOUT", "SSE_HEARTBEAT_INTERVAL", "MAX_REQUEST_BODY_BYTES",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_DIR", "TLS_RELOAD_INTERVAL",
+	"CONFIG_RELOAD_INTERVAL", "OPENAPI_VALIDATE", "ANTHROPIC_MESSAGES",
+}
+
+// load runs Load with only env set and, unless yaml is empty, a config file
+// holding yaml
+func load(t *testing.T, yaml string, env map[string]string) (*Config, error) {
+	t.Helper()
+	for _, name := range envVars {
+		// Setenv restores the variable after the test; unset it for the test
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	path := ""
+	if yaml != "" {
+		path = filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Load(path)
+}
+
+// TestLoadPrecedence tests that the file overrides the defaults and the
+// environment overrides both
+func TestLoadPrecedence(t *testing.T) {
+	file := `
+server:
+  port: "9090"
+workers:
+  endpoints: [grpc://a:20000, grpc://b:20000]
+  policy: cache_aware
+limits:
+  requests_per_minute: 60
+  tenant_monthly_tokens: {team-b: 20, team-a: 10}
+usage:
+  prices:
+    "*": {prompt: 1, completion: 2}
+cors:
+  allowed_origins: ["https://a.example", "https://b.example"]
+`
+	tests := []struct {
+		name  string
+		yaml  string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, defaults()) {
+					t.Errorf("Load(\"\") = %+v, want the defaults", cfg)
+				}
+			},
+		},
+		{
+			name: "file",
+			yaml: file,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != "9090" || cfg.Endpoints != "grpc://a:20000,grpc://b:20000" || cfg.PolicyName != "cache_aware" {
+					t.Errorf("server and workers: %+v", cfg)
+				}
+				if cfg.RateLimitRPM != 60 || cfg.TenantMonthlyTokens != "team-a:10,team-b:20" {
+					t.Errorf("limits: RateLimitRPM %d, TenantMonthlyTokens %q", cfg.RateLimitRPM, cfg.TenantMonthlyTokens)
+				}
+				if cfg.UsagePrices != "*:1:2" || cfg.CORSAllowedOrigins != "https://a.example,https://b.example" {
+					t.Errorf("lists: UsagePrices %q, CORSAllowedOrigins %q", cfg.UsagePrices, cfg.CORSAllowedOrigins)
+				}
+				// Settings the file leaves out keep their defaults
+				if cfg.LogLevel != "info" || cfg.DrainTimeout != 30*time.Second {
+					t.Errorf("defaults: LogLevel %q, DrainTimeout %v", cfg.LogLevel, cfg.DrainTimeout)
+				}
+			},
+		},
+		{
+			name: "environment over file",
+			yaml: file,
+			env: map[string]string{
+				"PORT":                 "7070",
+				"SGL_GRPC_ENDPOINT":    "grpc://legacy:20000",
+				"SGL_GRPC_ENDPOINTS":   "grpc://c:20000",
+				"RATE_LIMIT_RPM":       "5",
+				"LOG_LEVEL":            "debug",
+				"MODERATION_FAIL_OPEN": "true",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != "7070" || cfg.Endpoints != "grpc://c:20000" || cfg.RateLimitRPM != 5 {
+					t.Errorf("Port %q, Endpoints %q, RateLimitRPM %d", cfg.Port, cfg.Endpoints, cfg.RateLimitRPM)
+				}
+				if cfg.LogLevel != "debug" || !cfg.ModerationFailOpen || cfg.PolicyName != "cache_aware" {
+					t.Errorf("LogLevel %q, ModerationFailOpen %v, PolicyName %q", cfg.LogLevel, cfg.ModerationFailOpen, cfg.PolicyName)
+				}
+			},
+		},
+		{
+			name: "TLS directory",
+			env:  map[string]string{"TLS_DIR": "/certs", "TLS_KEY_FILE": "/keys/server.key"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.TLSCertFile != "/certs/tls.crt" || cfg.TLSKeyFile != "/keys/server.key" {
+					t.Errorf("TLSCertFile %q, TLSKeyFile %q", cfg.TLSCertFile, cfg.TLSKeyFile)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.yaml, tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+// TestLoadZeroValues tests the settings whose zero value in the file or the
+// environment disables a feature rather than keeping the default
+func TestLoadZeroValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		env   map[string]string
+		check func(cfg *Config) bool
+	}{
+		{
+			name:  "queue_size 0",
+			yaml:  "limits:\n  queue_size: 0\n",
+			check: func(cfg *Config) bool { return cfg.ConcurrencyQueueSize == 0 },
+		},
+		{
+			name:  "queue_size absent",
+			yaml:  "limits:\n  max_in_flight: 4\n",
+			check: func(cfg *Config) bool { return cfg.ConcurrencyQueueSize == 32 },
+		},
+		{
+			name:  "access_log file empty",
+			yaml:  "logging:\n  access_log:\n    file: \"\"\n",
+			check: func(cfg *Config) bool { return cfg.AccessLogFile == "" },
+		},
+		{
+			name:  "access_log file absent",
+			yaml:  "logging:\n  access_log:\n    max_size_mb: 5\n",
+			check: func(cfg *Config) bool { return cfg.AccessLogFile == "access.log" && cfg.AccessLogMaxSizeMB == 5 },
+		},
+		{
+			name:  "sse_heartbeat_interval 0",
+			yaml:  "server:\n  sse_heartbeat_interval: 0s\n",
+			check: func(cfg *Config) bool { return cfg.SSEHeartbeatInterval == 0 },
+		},
+		{
+			name:  "sse_heartbeat_interval absent",
+			yaml:  "server:\n  port: \"8081\"\n",
+			check: func(cfg *Config) bool { return cfg.SSEHeartbeatInterval == 15*time.Second },
+		},
+		{
+			name:  "empty ACCESS_LOG_FILE",
+			env:   map[string]string{"ACCESS_LOG_FILE": ""},
+			check: func(cfg *Config) bool { return cfg.AccessLogFile == "" },
+		},
+		{
+			name:  "CONCURRENCY_QUEUE_SIZE 0",
+			env:   map[string]string{"CONCURRENCY_QUEUE_SIZE": "0"},
+			check: func(cfg *Config) bool { return cfg.ConcurrencyQueueSize == 0 },
+		},
+		{
+			name:  "SSE_HEARTBEAT_INTERVAL 0",
+			env:   map[string]string{"SSE_HEARTBEAT_INTERVAL": "0s"},
+			check: func(cfg *Config) bool { return cfg.SSEHeartbeatInterval == 0 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.yaml, tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+		})
+	}
+}
+
+// TestLoadErrors tests that invalid files and values are rejected
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "unknown key", yaml: "server:\n  prot: \"8080\"\n", wantErr: "field prot not found"},
+		{name: "unknown section", yaml: "sever:\n  port: \"8080\"\n", wantErr: "field sever not found"},
+		{name: "negative queue_size", yaml: "limits:\n  queue_size: -1\n", wantErr: "invalid limits.queue_size"},
+		{name: "TLS cert without key", env: map[string]string{"TLS_CERT_FILE": "/certs/tls.crt"}, wantErr: "both a certificate and a key"},
+		{name: "group without labels", yaml: "workers:\n  groups:\n    - endpoints: [grpc://a:1]\n", wantErr: "worker group 0 has no labels"},
+		{name: "group without endpoints", yaml: "workers:\n  groups:\n    - labels: {gpu: h100}\n", wantErr: "worker group 0 has no endpoints"},
+		{name: "empty alias", yaml: "models:\n  aliases:\n    fast: {}\n", wantErr: `model alias "fast" needs a model or labels`},
+		{name: "alias without group", yaml: "models:\n  aliases:\n    fast: {labels: {gpu: h100}}\n", wantErr: "no worker group has labels"},
+		{name: "system_prompt_mode", yaml: "policies:\n  team-a: {system_prompt_mode: append}\n", wantErr: "invalid system_prompt_mode"},
+		{name: "max_top_p", yaml: "policies:\n  \"*\": {max_top_p: 1.5}\n", wantErr: "invalid max_top_p"},
+		{name: "negative max_tokens", yaml: "policies:\n  team-a: {max_tokens: -1}\n", wantErr: "invalid max_tokens"},
+		{name: "usage export format", env: map[string]string{"USAGE_EXPORT_FORMAT": "xml"}, wantErr: "invalid usage export format"},
+		{name: "moderation stage", env: map[string]string{"MODERATION_STAGES": "input,reply"}, wantErr: `invalid moderation stage "reply"`},
+		{name: "negative int", env: map[string]string{"RATE_LIMIT_RPM": "-1"}, wantErr: "invalid RATE_LIMIT_RPM"},
+		{name: "malformed duration", env: map[string]string{"MODERATION_TIMEOUT": "2"}, wantErr: "invalid MODERATION_TIMEOUT"},
+		{name: "zero stream window", env: map[string]string{"MODERATION_STREAM_WINDOW": "0"}, wantErr: "invalid MODERATION_STREAM_WINDOW"},
+		{name: "zero body limit", env: map[string]string{"MAX_REQUEST_BODY_BYTES": "0"}, wantErr: "invalid MAX_REQUEST_BODY_BYTES"},
+		{name: "malformed bool", env: map[string]string{"OPENAPI_VALIDATE": "maybe"}, wantErr: "invalid OPENAPI_VALIDATE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, tt.yaml, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+// TestRestartRequired tests that only settings a reload does not apply are
+// reported
+func TestRestartRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   []string
+	}{
+		{name: "unchanged", change: func(cfg *Config) {}},
+		{
+			name: "reloadable",
+			change: func(cfg *Config) {
+				cfg.Endpoints = "grpc://other:20000"
+				cfg.APIKeys = "sk-new"
+				cfg.ModelAliases = map[string]ModelAlias{"fast": {Model: "llama"}}
+				cfg.Policies = map[string]RequestPolicy{"*": {MaxTokens: 10}}
+			},
+		},
+		{
+			name: "restart",
+			change: func(cfg *Config) {
+				cfg.Port = "9090"
+				cfg.SSEHeartbeatInterval = 0
+				cfg.WorkerGroups = []WorkerGroup{{Labels: map[string]string{"gpu": "h100"}}}
+			},
+			want: []string{"Port", "SSEHeartbeatInterval", "WorkerGroups"},
+		},
+		{
+			name: "both",
+			change: func(cfg *Config) {
+				cfg.RateLimitRPM = 10
+				cfg.LogLevel = "debug"
+			},
+			want: []string{"LogLevel"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := defaults()
+			tt.change(next)
+			if got := defaults().RestartRequired(next); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RestartRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
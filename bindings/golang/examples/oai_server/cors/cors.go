@@ -0,0 +1,111 @@
+// Package cors lets browser-based clients call the server from other origins.
+package cors
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Config controls which cross-origin requests are allowed
+type Config struct {
+	// AllowedOrigins lists origins such as "http://localhost:3000"; "*" allows any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are response headers browsers may read
+	ExposedHeaders []string
+	// MaxAge is how long, in seconds, browsers may cache a preflight response
+	MaxAge int
+}
+
+// DefaultConfig returns a configuration allowing origins with the methods and
+// headers the OpenAI API uses
+func DefaultConfig(origins []string) Config {
+	return Config{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "OPTIONS"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+		ExposedHeaders: []string{
+			"X-Request-ID",
+			"Retry-After",
+			"X-Ratelimit-Limit-Requests",
+			"X-Ratelimit-Remaining-Requests",
+			"X-Ratelimit-Limit-Tokens",
+			"X-Ratelimit-Remaining-Tokens",
+		},
+		MaxAge: 600,
+	}
+}
+
+// SplitList splits a comma-separated list, dropping empty entries
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Middleware adds CORS headers to responses for allowed origins and answers
+// preflight requests itself. It must run before authentication, since
+// browsers send preflight requests without credentials.
+func Middleware(cfg Config, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	anyOrigin := false
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[origin] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		origin := string(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+		if origin == "" {
+			next(ctx)
+			return
+		}
+
+		header := &ctx.Response.Header
+		header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+		allowed := anyOrigin || origins[origin]
+		preflight := ctx.IsOptions() && len(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod)) > 0
+
+		if !allowed {
+			if preflight {
+				// Without CORS headers the browser blocks the actual request
+				ctx.SetStatusCode(fasthttp.StatusForbidden)
+				return
+			}
+			next(ctx)
+			return
+		}
+
+		// Echo the origin, even when any origin is allowed; Vary: Origin keeps
+		// caches from reusing the response for other origins
+		header.Set(fasthttp.HeaderAccessControlAllowOrigin, origin)
+
+		if preflight {
+			header.Set(fasthttp.HeaderAccessControlAllowMethods, methods)
+			header.Set(fasthttp.HeaderAccessControlAllowHeaders, headers)
+			if cfg.MaxAge > 0 {
+				header.Set(fasthttp.HeaderAccessControlMaxAge, maxAge)
+			}
+			ctx.SetStatusCode(fasthttp.StatusNoContent)
+			return
+		}
+
+		if exposed != "" {
+			header.Set(fasthttp.HeaderAccessControlExposeHeaders, exposed)
+		}
+		next(ctx)
+	}
+}
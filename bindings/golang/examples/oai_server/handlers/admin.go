@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/requestid"
+	"oai_server/service"
+	"oai_server/utils"
+)
+
+// workersPath is the prefix of the worker admin endpoints
+const workersPath = "/admin/workers"
+
+// AdminHandler handles the worker admin endpoints, which add, remove, and
+// drain workers without a restart. They require a multi-worker setup.
+type AdminHandler struct {
+	logger  *zap.Logger
+	service *service.SMGService
+	// drainTimeout bounds a drain unless the request sets ?timeout=
+	drainTimeout time.Duration
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(logger *zap.Logger, svc *service.SMGService, drainTimeout time.Duration) *AdminHandler {
+	return &AdminHandler{
+		logger:       logger,
+		service:      svc,
+		drainTimeout: drainTimeout,
+	}
+}
+
+// addWorkerRequest is the body of POST /admin/workers
+type addWorkerRequest struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// setHealthRequest is the body of PUT /admin/workers/{i}/health
+type setHealthRequest struct {
+	Healthy *bool `json:"healthy"`
+}
+
+// HandleWorkers routes the requests under /admin/workers:
+//
+//	GET    /admin/workers              list workers
+//	POST   /admin/workers              add a worker
+//	DELETE /admin/workers/{i}          remove a worker
+//	POST   /admin/workers/{i}/drain    stop routing to a worker and wait for its requests
+//	GET    /admin/workers/{i}/health   get a worker's status
+//	PUT    /admin/workers/{i}/health   mark a worker healthy or unhealthy
+func (h *AdminHandler) HandleWorkers(ctx *fasthttp.RequestCtx) {
+	method := string(ctx.Method())
+	path := strings.TrimSuffix(string(ctx.Path()), "/")
+
+	manager := h.service.WorkerManager()
+	if manager == nil {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest,
+			"Worker management requires multiple endpoints in SGL_GRPC_ENDPOINTS.",
+			"invalid_request_error", "", "single_worker")
+		return
+	}
+
+	if path == workersPath {
+		switch method {
+		case "GET":
+			h.listWorkers(ctx, manager)
+		case "POST":
+			h.addWorker(ctx, manager)
+		default:
+			h.methodNotAllowed(ctx, method, path)
+		}
+		return
+	}
+
+	// /admin/workers/{i}[/action]
+	indexStr, action, _ := strings.Cut(strings.TrimPrefix(path, workersPath+"/"), "/")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusNotFound,
+			fmt.Sprintf("Unknown request URL: %s %s.", method, path), "invalid_request_error", "", "unknown_url")
+		return
+	}
+	worker, ok := h.worker(ctx, manager, index)
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "" && method == "DELETE":
+		h.removeWorker(ctx, manager, worker)
+	case action == "drain" && method == "POST":
+		h.drainWorker(ctx, manager, worker)
+	case action == "health" && method == "GET":
+		writeJSON(ctx, fasthttp.StatusOK, worker)
+	case action == "health" && method == "PUT":
+		h.setWorkerHealth(ctx, manager, worker)
+	case action == "" || action == "drain" || action == "health":
+		h.methodNotAllowed(ctx, method, path)
+	default:
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusNotFound,
+			fmt.Sprintf("Unknown request URL: %s %s.", method, path), "invalid_request_error", "", "unknown_url")
+	}
+}
+
+func (h *AdminHandler) listWorkers(ctx *fasthttp.RequestCtx, manager service.WorkerManager) {
+	workers, err := manager.Workers()
+	if err != nil {
+		utils.RespondSDKError(ctx, "Failed to list workers", err)
+		return
+	}
+	writeJSON(ctx, fasthttp.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   workers,
+	})
+}
+
+func (h *AdminHandler) addWorker(ctx *fasthttp.RequestCtx, manager service.WorkerManager) {
+	var req addWorkerRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		utils.RespondDecodeError(ctx, err)
+		return
+	}
+	req.Endpoint = strings.TrimSpace(req.Endpoint)
+	if req.Endpoint == "" {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest, "endpoint is required", "invalid_request_error", "endpoint", "")
+		return
+	}
+
+	if err := manager.AddWorker(req.Endpoint); err != nil {
+		h.logger.Warn("Failed to add worker", zap.String("endpoint", req.Endpoint), zap.Error(err), requestid.Field(ctx))
+		utils.RespondSDKError(ctx, "Failed to add worker", err)
+		return
+	}
+	h.logger.Info("Added worker", zap.String("endpoint", req.Endpoint), requestid.Field(ctx))
+
+	workers, err := manager.Workers()
+	if err != nil {
+		utils.RespondSDKError(ctx, "Failed to list workers", err)
+		return
+	}
+	for _, worker := range workers {
+		if worker.Endpoint == req.Endpoint {
+			writeJSON(ctx, fasthttp.StatusCreated, worker)
+			return
+		}
+	}
+	// Removed again by a concurrent request
+	utils.RespondError(ctx, fasthttp.StatusConflict, fmt.Sprintf("Worker %s was removed concurrently", req.Endpoint), "invalid_request_error")
+}
+
+func (h *AdminHandler) removeWorker(ctx *fasthttp.RequestCtx, manager service.WorkerManager, worker smg.WorkerStatus) {
+	if err := manager.RemoveWorkerByEndpoint(worker.Endpoint); err != nil {
+		h.respondWorkerError(ctx, "Failed to remove worker", worker, err)
+		return
+	}
+	h.logger.Info("Removed worker",
+		zap.Int("index", worker.Index),
+		zap.String("endpoint", worker.Endpoint),
+		zap.Int("in_flight", worker.Load),
+		requestid.Field(ctx),
+	)
+	writeJSON(ctx, fasthttp.StatusOK, worker)
+}
+
+func (h *AdminHandler) drainWorker(ctx *fasthttp.RequestCtx, manager service.WorkerManager, worker smg.WorkerStatus) {
+	timeout := h.drainTimeout
+	if v := string(ctx.QueryArgs().Peek("timeout")); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 {
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest,
+				fmt.Sprintf("Invalid timeout %q, expected a duration such as 30s", v), "invalid_request_error", "timeout", "")
+			return
+		}
+	}
+
+	h.logger.Info("Draining worker", zap.Int("index", worker.Index), zap.String("endpoint", worker.Endpoint), requestid.Field(ctx))
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := manager.DrainWorkerByEndpoint(drainCtx, worker.Endpoint); err != nil {
+		h.logger.Warn("Failed to drain worker", zap.String("endpoint", worker.Endpoint), zap.Error(err), requestid.Field(ctx))
+		h.respondWorkerError(ctx, "Failed to drain worker", worker, err)
+		return
+	}
+
+	// Report the worker's status after the drain
+	workers, err := manager.Workers()
+	if err != nil {
+		utils.RespondSDKError(ctx, "Failed to list workers", err)
+		return
+	}
+	for _, w := range workers {
+		if w.Endpoint == worker.Endpoint {
+			writeJSON(ctx, fasthttp.StatusOK, w)
+			return
+		}
+	}
+	worker.Healthy = false
+	worker.Load = 0
+	writeJSON(ctx, fasthttp.StatusOK, worker)
+}
+
+func (h *AdminHandler) setWorkerHealth(ctx *fasthttp.RequestCtx, manager service.WorkerManager, worker smg.WorkerStatus) {
+	var req setHealthRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		utils.RespondDecodeError(ctx, err)
+		return
+	}
+	if req.Healthy == nil {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest, "healthy is required", "invalid_request_error", "healthy", "")
+		return
+	}
+
+	if err := manager.SetWorkerHealthByEndpoint(worker.Endpoint, *req.Healthy); err != nil {
+		h.respondWorkerError(ctx, "Failed to set worker health", worker, err)
+		return
+	}
+	h.logger.Info("Set worker health",
+		zap.Int("index", worker.Index),
+		zap.String("endpoint", worker.Endpoint),
+		zap.Bool("healthy", *req.Healthy),
+		requestid.Field(ctx),
+	)
+	worker.Healthy = *req.Healthy
+	writeJSON(ctx, fasthttp.StatusOK, worker)
+}
+
+// respondWorkerError sends the error of an action on worker, with 404 if it
+// was removed since it was looked up
+func (h *AdminHandler) respondWorkerError(ctx *fasthttp.RequestCtx, action string, worker smg.WorkerStatus, err error) {
+	if errors.Is(err, smg.ErrWorkerNotFound) {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusNotFound,
+			fmt.Sprintf("Worker %d (%s) was removed concurrently", worker.Index, worker.Endpoint), "invalid_request_error", "", "worker_not_found")
+		return
+	}
+	utils.RespondSDKError(ctx, action, err)
+}
+
+// worker looks up the worker at index, responding 404 if there is none. The
+// actions on it resolve it again by endpoint, so a worker removed or moved
+// meanwhile is never mistaken for another.
+func (h *AdminHandler) worker(ctx *fasthttp.RequestCtx, manager service.WorkerManager, index int) (smg.WorkerStatus, bool) {
+	workers, err := manager.Workers()
+	if err != nil {
+		utils.RespondSDKError(ctx, "Failed to list workers", err)
+		return smg.WorkerStatus{}, false
+	}
+	if index >= len(workers) {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusNotFound,
+			fmt.Sprintf("Worker %d not found (%d workers)", index, len(workers)), "invalid_request_error", "", "worker_not_found")
+		return smg.WorkerStatus{}, false
+	}
+	return workers[index], true
+}
+
+func (h *AdminHandler) methodNotAllowed(ctx *fasthttp.RequestCtx, method, path string) {
+	utils.RespondError(ctx, fasthttp.StatusMethodNotAllowed,
+		fmt.Sprintf("Method %s is not allowed for %s.", method, path), "invalid_request_error")
+}
+
+// writeJSON sends v as a JSON response
+func writeJSON(ctx *fasthttp.RequestCtx, statusCode int, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		utils.RespondError(ctx, fasthttp.StatusInternalServerError, fmt.Sprintf("Failed to encode response: %v", err), "server_error")
+		return
+	}
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	ctx.Write(jsonData)
+}
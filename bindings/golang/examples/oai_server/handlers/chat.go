@@ -1,11 +1,13 @@
+// Package handlers serves the server's endpoints with fasthttp. The
+// inference endpoints answer like the SDK's smghttp handler, which cannot be
+// mounted here as fasthttp's net/http adaptor buffers streams, and add model
+// aliases, usage accounting, and moderation to it.
 package handlers
 
 import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
 	"strings"
 	"time"
 
@@ -13,8 +15,14 @@ import (
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 
+	"oai_server/accesslog"
+	"oai_server/metrics"
 	"oai_server/models"
+	"oai_server/moderation"
+	"oai_server/ratelimit"
+	"oai_server/requestid"
 	"oai_server/service"
+	"oai_server/usage"
 	"oai_server/utils"
 )
 
@@ -22,54 +30,108 @@ import (
 type ChatHandler struct {
 	logger  *zap.Logger
 	service *service.SMGService
+	metrics *metrics.Metrics
+	// heartbeatInterval is how long a stream may be idle before a ": ping"
+	// comment is sent; 0 disables heartbeats
+	heartbeatInterval time.Duration
+	// moderation checks generated text in windows of moderationWindow bytes
+	// when streaming; nil disables output moderation
+	moderation       *moderation.Checker
+	moderationWindow int
 }
 
-// NewChatHandler creates a new chat handler
-func NewChatHandler(logger *zap.Logger, svc *service.SMGService) *ChatHandler {
+// NewChatHandler creates a new chat handler. m may be nil to disable metrics.
+func NewChatHandler(logger *zap.Logger, svc *service.SMGService, m *metrics.Metrics, heartbeatInterval time.Duration) *ChatHandler {
 	return &ChatHandler{
-		logger:  logger,
-		service: svc,
+		logger:            logger,
+		service:           svc,
+		metrics:           m,
+		heartbeatInterval: heartbeatInterval,
 	}
 }
 
-// recvResult holds the result of a RecvJSON() call
-type recvResult struct {
-	chunkJSON string
-	err       error
+// recordUsage charges a completed request's tokens for model, as the client
+// named it, to the API key's quota and tenant and records them in metrics
+// and the access log
+func (h *ChatHandler) recordUsage(ctx *fasthttp.RequestCtx, model string, promptTokens, completionTokens, totalTokens int) {
+	ratelimit.UsageRecorder(ctx)(totalTokens)
+	usage.Recorder(ctx)(model, promptTokens, completionTokens)
+	entry := accesslog.FromContext(ctx)
+	entry.PromptTokens, entry.CompletionTokens = promptTokens, completionTokens
+	h.metrics.ObserveUsage(string(ctx.Path()), promptTokens, completionTokens, time.Since(ctx.Time()))
+}
+
+// streamUsage charges the tokens of a stream to the API key's quota and
+// tenant: those of its usage chunk or, if the stream ends before one arrives,
+// e.g. because the client disconnected, a completion token for each chunk
+// received, as workers stream a token or more per chunk
+type streamUsage struct {
+	recordUsage       func(tokens int)
+	recordTenantUsage func(model string, promptTokens, completionTokens int)
+	model             string
+	chunks            int
+	charged           bool
+}
+
+// newStreamUsage returns the stream usage of a request for model, as the
+// client named it. Its methods may be called after the handler returns.
+func newStreamUsage(ctx *fasthttp.RequestCtx, model string) *streamUsage {
+	return &streamUsage{
+		recordUsage:       ratelimit.UsageRecorder(ctx),
+		recordTenantUsage: usage.Recorder(ctx),
+		model:             model,
+	}
+}
+
+// chunk counts a chunk received from the workers
+func (u *streamUsage) chunk() {
+	u.chunks++
+}
+
+// charge charges the usage reported by the stream, once
+func (u *streamUsage) charge(promptTokens, completionTokens, totalTokens int) {
+	if u.charged {
+		return
+	}
+	u.charged = true
+	u.recordUsage(totalTokens)
+	u.recordTenantUsage(u.model, promptTokens, completionTokens)
+}
+
+// finish charges the chunks received if the stream reported no usage
+func (u *streamUsage) finish() {
+	if u.charged || u.chunks == 0 {
+		return
+	}
+	u.charge(0, u.chunks, u.chunks)
 }
 
 // HandleChatCompletion handles POST /v1/chat/completions
 func (h *ChatHandler) HandleChatCompletion(ctx *fasthttp.RequestCtx) {
+	logger := h.logger.With(requestid.Field(ctx))
 	var req models.ChatRequest
 	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
-		h.logger.Warn("Invalid chat completion request", zap.Error(err))
-		utils.RespondError(ctx, 400, fmt.Sprintf("Invalid request: %v", err), "invalid_request_error")
+		logger.Warn("Invalid chat completion request", zap.Error(err))
+		utils.RespondDecodeError(ctx, err)
 		return
 	}
+	entry := accesslog.FromContext(ctx)
+	entry.Model = req.Model
+	entry.Stream = req.Stream
 
-	path := string(ctx.Path())
-
-	defer func() {
-		statusCode := ctx.Response.StatusCode()
-		if statusCode == 0 {
-			statusCode = 200
-		}
-		h.logHTTPResponse(statusCode, path)
-	}()
+	// Reject bad input here rather than as a backend error
+	if err := req.Validate(); err != nil {
+		logger.Warn("Invalid chat completion request", zap.String("param", err.Param), zap.String("error", err.Message))
+		utils.RespondErrorWithParam(ctx, 400, err.Message, "invalid_request_error", err.Param, "")
+		return
+	}
 
 	// Convert to SGLang format
 	messages := make([]smg.ChatMessage, len(req.Messages))
 	for i, msg := range req.Messages {
-		role, roleOk := msg["role"]
+		role := msg["role"]
 		content, contentOk := msg["content"]
 
-		// Validate role
-		if !roleOk || role == "" {
-			h.logger.Warn("Missing or empty role in message", zap.Int("message_index", i))
-			utils.RespondError(ctx, 400, "Message role is required and cannot be empty", "invalid_request_error")
-			return
-		}
-
 		// Ensure content is always a string (not null)
 		// Chat template requires content field to be present, even if empty
 		// If content is missing or null, use empty string
@@ -84,8 +146,9 @@ func (h *ChatHandler) HandleChatCompletion(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
+	route := h.service.Route(req.Model)
 	sglReq := smg.ChatCompletionRequest{
-		Model:    req.Model,
+		Model:    route.Target,
 		Messages: messages,
 		Stream:   req.Stream,
 	}
@@ -103,13 +166,10 @@ func (h *ChatHandler) HandleChatCompletion(ctx *fasthttp.RequestCtx) {
 	} else if req.MaxTokens != nil {
 		sglReq.MaxCompletionTokens = req.MaxTokens
 	}
-	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage != nil {
-		sglReq.StreamOptions = &smg.StreamOptions{
-			IncludeUsage: req.StreamOptions.IncludeUsage,
-		}
-	}
+	sglReq.StreamOptions = sdkStreamOptions(req.Stream)
 	sglReq.IgnoreEos = req.IgnoreEos
 	sglReq.NoStopTrim = req.NoStopTrim
+	sglReq.ContinueFinalMessage = req.ContinueFinalMessage
 	if req.Stop != nil {
 		sglReq.Stop = req.Stop
 	}
@@ -136,15 +196,25 @@ func (h *ChatHandler) HandleChatCompletion(ctx *fasthttp.RequestCtx) {
 		sglReq.RepetitionPenalty = &rp
 	}
 
-	requestCtx := context.Background()
+	requestCtx := requestContext(ctx)
 
 	if req.Stream {
-		h.handleStreamingCompletion(ctx, requestCtx, sglReq)
+		h.handleStreamingCompletion(ctx, route, sglReq, req.StreamOptions.WantsUsage())
 	} else {
-		h.handleNonStreamingCompletion(ctx, requestCtx, sglReq)
+		h.handleNonStreamingCompletion(ctx, requestCtx, route, sglReq)
 	}
 }
 
+// requestContext returns a context that forwards the request ID to workers
+// and records the worker serving the request in the access log
+func requestContext(ctx *fasthttp.RequestCtx) context.Context {
+	entry := accesslog.FromContext(ctx)
+	requestCtx := smg.WithRequestID(context.Background(), requestid.FromContext(ctx))
+	return smg.WithWorkerObserver(requestCtx, func(endpoint string) {
+		entry.Worker = endpoint
+	})
+}
+
 // isBrokenPipeError checks if the error is a broken pipe error (client disconnected)
 func isBrokenPipeError(err error) bool {
 	if err == nil {
@@ -157,239 +227,112 @@ func isBrokenPipeError(err error) bool {
 		strings.Contains(errStr, "write: connection closed")
 }
 
-// logHTTPResponse logs HTTP response with colored output
-func (h *ChatHandler) logHTTPResponse(statusCode int, path string) {
-	var statusText string
-	var colorCode string
-
-	switch {
-	case statusCode >= 200 && statusCode < 300:
-		colorCode = "\033[32m" // Green
-		statusText = "OK"
-	case statusCode >= 300 && statusCode < 400:
-		colorCode = "\033[33m" // Yellow
-		statusText = "Redirect"
-	case statusCode >= 400 && statusCode < 500:
-		colorCode = "\033[33m" // Yellow
-		statusText = "Client Error"
-	case statusCode >= 500:
-		colorCode = "\033[31m" // Red
-		statusText = "Server Error"
-	default:
-		colorCode = "\033[37m" // White
-		statusText = "Unknown"
-	}
-
-	resetCode := "\033[0m"
-	msg := fmt.Sprintf("%s[%d %s]%s %s", colorCode, statusCode, statusText, resetCode, path)
-	h.logger.Info(msg)
+func (h *ChatHandler) handleStreamingCompletion(ctx *fasthttp.RequestCtx, route service.Route, req smg.ChatCompletionRequest, includeUsage bool) {
+	h.streamSSE(ctx, route, includeUsage, func(streamCtx context.Context) (smg.ChatStream, error) {
+		return route.Client.CreateChatCompletionStream(streamCtx, req)
+	})
 }
 
-func (h *ChatHandler) handleStreamingCompletion(ctx *fasthttp.RequestCtx, requestCtx context.Context, req smg.ChatCompletionRequest) {
-
-	ctx.SetContentType("text/event-stream")
-	ctx.Response.Header.Set("Cache-Control", "no-cache")
-	ctx.Response.Header.Set("Connection", "keep-alive")
-	ctx.Response.Header.Set("X-Accel-Buffering", "no")
-	ctx.SetStatusCode(200)
-
-	var clientDisconnected bool
-	// Flush timeout: prevent deadlock if client is slow or disconnected
-	// This timeout should be longer than typical network latency but shorter than client timeout
-	const flushTimeout = 5 * time.Second
-
-	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
-		streamCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		stream, err := h.service.ChatClient().CreateChatCompletionStream(streamCtx, req)
-		if err != nil {
-			h.logger.Error("Failed to create chat completion stream",
-				zap.Error(err),
-				zap.String("model", req.Model),
-			)
-			// Use sendSSEError to send error in consistent format
-			errInfo, sendErr := h.sendSSEError(w, err)
-			if sendErr != nil {
-				h.logger.Warn("Failed to send SSE error", zap.Error(sendErr))
-			} else if errInfo.IsTimeout {
-				h.logger.Error("Stream creation timeout", zap.Error(err))
-			}
-			return
-		}
-		defer func() {
-			if closeErr := stream.Close(); closeErr != nil {
-				h.logger.Warn("Failed to close stream", zap.Error(closeErr))
-			}
-		}()
-
-		// Use a single dedicated goroutine to continuously call RecvJSON() and send results via channel
-		recvChan := make(chan recvResult, 20)
-		recvGoroutineDone := make(chan struct{})
-		go func() {
-			defer func() {
-				close(recvChan)
-				close(recvGoroutineDone)
-			}()
-			for {
-				// Check context before calling RecvJSON() to avoid blocking if context is cancelled
-				select {
-				case <-streamCtx.Done():
-					return
-				default:
-				}
-
-				// Call RecvJSON() - this may block, but stream.Close() will unblock it
-				// when context is cancelled (called from main loop)
-				chunkJSON, err := stream.RecvJSON()
-
-				// Check context again after RecvJSON() returns
-				select {
-				case <-streamCtx.Done():
-					return
-				default:
-				}
+// sdkStreamOptions returns the stream options to send to the SDK. Streams
+// always ask for usage so that it can be metered; streamSSE forwards the
+// usage chunk only to clients that asked for it.
+func sdkStreamOptions(stream bool) *smg.StreamOptions {
+	if !stream {
+		return nil
+	}
+	includeUsage := true
+	return &smg.StreamOptions{IncludeUsage: &includeUsage}
+}
 
-				// Send to channel (may block if channel is full)
-				// If channel is full, this will block until main loop reads from it
-				// This is acceptable because main loop should be actively reading
-				select {
-				case recvChan <- recvResult{chunkJSON: chunkJSON, err: err}:
-					if err != nil {
-						// EOF or other error, stop the goroutine
-						return
-					}
-				case <-streamCtx.Done():
-					// Context cancelled while sending, stop the goroutine
-					return
+// streamSSE writes the chunks of the stream returned by open as server-sent
+// events, followed by "data: [DONE]". The final usage chunk is written only
+// if includeUsage is set.
+func (h *ChatHandler) streamSSE(ctx *fasthttp.RequestCtx, route service.Route, includeUsage bool, open func(context.Context) (smg.ChatStream, error)) {
+	renameModel := chunkModelRenamer(route)
+	respondError := func(ctx *fasthttp.RequestCtx, err error) {
+		utils.RespondSDKError(ctx, "Failed to create stream", err)
+	}
+	h.pumpStream(ctx, route, open, respondError, streamEvents{
+		chunk: func(w *bufio.Writer, chunkJSON string) *smg.Usage {
+			var usage *smg.Usage
+			if strings.Contains(chunkJSON, `"usage"`) {
+				if usage = chunkUsage(chunkJSON); usage != nil && !includeUsage {
+					return usage
 				}
 			}
-		}()
-
-		for {
-			if clientDisconnected {
-				cancel()
-				// Close stream immediately to unblock RecvJSON() calls
-				stream.Close()
-				return
-			}
+			w.WriteString("data: ")
+			w.WriteString(renameModel(chunkJSON))
+			w.WriteString("\n\n")
+			return usage
+		},
+		fail: func(w *bufio.Writer, errInfo StreamErrorInfo) {
+			w.WriteString("data: ")
+			w.WriteString(formatErrorJSON(errInfo))
+			w.WriteString("\n\n")
+		},
+		end: func(w *bufio.Writer) {
+			w.WriteString("data: [DONE]\n\n")
+		},
+	})
+}
 
-			select {
-			case <-streamCtx.Done():
-				// Close stream to ensure RecvJSON() goroutine can exit
-				stream.Close()
-				return
-			case result, ok := <-recvChan:
-				if !ok {
-					// Channel closed, stream ended
-					return
-				}
-				if result.err == io.EOF {
-					if !clientDisconnected {
-						w.WriteString("data: [DONE]\n\n")
-						// Flush with timeout to prevent deadlock
-						flushDone := make(chan error, 1)
-						go func() {
-							flushDone <- w.Flush()
-						}()
-						flushCtx, flushCancel := context.WithTimeout(streamCtx, flushTimeout)
-						defer flushCancel()
-						select {
-						case flushErr := <-flushDone:
-							if flushErr != nil && !isBrokenPipeError(flushErr) {
-								h.logger.Warn("Final flush error", zap.Error(flushErr))
-							}
-						case <-flushCtx.Done():
-							if flushCtx.Err() == context.DeadlineExceeded {
-								h.logger.Warn("Final flush timeout", zap.Duration("timeout", flushTimeout))
-							}
-						case <-streamCtx.Done():
-							// Context cancelled, skip flush
-						}
-					}
-					return
-				}
-				if result.err != nil {
-					if result.err == context.Canceled || result.err == context.DeadlineExceeded {
-						return
-					}
-					// Send error to client before closing
-					errInfo, sendErr := h.sendSSEError(w, result.err)
-					if sendErr != nil {
-						h.logger.Warn("Failed to send SSE error", zap.Error(sendErr))
-					}
-					if errInfo.IsTimeout {
-						h.logger.Error("Stream timeout error", zap.Error(result.err))
-					} else {
-						h.logger.Error("Stream error", zap.Error(result.err))
-					}
-					return
-				}
-				if result.chunkJSON == "" {
-					continue
-				}
+// chunkModelRenamer returns a function that replaces the target model name in
+// stream chunks with the requested alias
+func chunkModelRenamer(route service.Route) func(string) string {
+	if !route.Aliased() {
+		return func(chunkJSON string) string { return chunkJSON }
+	}
+	target, _ := json.Marshal(route.Target)
+	alias, _ := json.Marshal(route.Model)
+	oldField := `"model":` + string(target)
+	newField := `"model":` + string(alias)
+	return func(chunkJSON string) string {
+		return strings.Replace(chunkJSON, oldField, newField, 1)
+	}
+}
 
-				w.WriteString("data: ")
-				w.WriteString(result.chunkJSON)
-				w.WriteString("\n\n")
-
-				// Flush with timeout to prevent deadlock:
-				// If Flush blocks indefinitely (slow client), RecvJSON goroutine may fill recvChan
-				// and then block trying to send, causing deadlock
-				// Note: bufio.Writer.Flush() doesn't have a timeout parameter, so we use
-				// a goroutine + select pattern to implement timeout behavior
-				flushDone := make(chan error, 1)
-				go func() {
-					flushDone <- w.Flush()
-				}()
-
-				flushCtx, flushCancel := context.WithTimeout(streamCtx, flushTimeout)
-				defer flushCancel()
-
-				select {
-				case err := <-flushDone:
-					if err != nil {
-						if isBrokenPipeError(err) {
-							clientDisconnected = true
-							cancel()
-							// Close stream immediately to unblock RecvJSON() calls
-							stream.Close()
-							return
-						}
-						h.logger.Warn("Flush error", zap.Error(err))
-					}
-				case <-flushCtx.Done():
-					// Flush timeout: client may be slow or disconnected
-					// Continue processing to avoid deadlock, but mark as disconnected
-					if flushCtx.Err() == context.DeadlineExceeded {
-						h.logger.Warn("Flush timeout, client may be slow or disconnected", zap.Duration("timeout", flushTimeout))
-					}
-					clientDisconnected = true
-					cancel()
-					stream.Close()
-					return
-				case <-streamCtx.Done():
-					// Context cancelled, stop flushing
-					return
-				}
-			}
-		}
-	})
+// chunkUsage returns the usage of a stream chunk, or nil if it has none
+func chunkUsage(chunkJSON string) *smg.Usage {
+	var chunk struct {
+		Usage *smg.Usage `json:"usage"`
+	}
+	if json.Unmarshal([]byte(chunkJSON), &chunk) != nil {
+		return nil
+	}
+	return chunk.Usage
 }
 
-func (h *ChatHandler) handleNonStreamingCompletion(ctx *fasthttp.RequestCtx, requestCtx context.Context, req smg.ChatCompletionRequest) {
-	resp, err := h.service.ChatClient().CreateChatCompletion(requestCtx, req)
+func (h *ChatHandler) handleNonStreamingCompletion(ctx *fasthttp.RequestCtx, requestCtx context.Context, route service.Route, req smg.ChatCompletionRequest) {
+	logger := h.logger.With(requestid.Field(ctx))
+	resp, err := route.Client.CreateChatCompletion(requestCtx, req)
 	if err != nil {
-		h.logger.Error("Failed to create chat completion",
+		logger.Error("Failed to create chat completion",
 			zap.Error(err),
 			zap.String("model", req.Model),
 		)
-		utils.RespondError(ctx, 500, fmt.Sprintf("Failed to create completion: %v", err), "server_error")
+		utils.RespondSDKError(ctx, "Failed to create completion", err)
 		return
 	}
+	h.recordUsage(ctx, route.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+
+	texts := make([]string, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		texts[i] = choice.Message.Content
+	}
+	verdict := h.moderateOutput(ctx, route, texts)
+	for i := range resp.Choices {
+		switch verdict.Action {
+		case moderation.Block:
+			resp.Choices[i].Message.Content = ""
+			resp.Choices[i].Message.ToolCalls = nil
+			resp.Choices[i].FinishReason = moderation.ContentFilter
+		case moderation.Redact:
+			resp.Choices[i].Message.Content = verdict.Texts[i]
+		}
+	}
 
 	// Convert to OpenAI format
-	response := utils.BuildResponseBase(resp.ID, resp.Created, resp.Model)
+	response := utils.BuildResponseBase(resp.ID, resp.Created, route.ResponseModel(resp.Model))
 	response["object"] = "chat.completion"
 
 	choices := make([]map[string]interface{}, len(resp.Choices))
@@ -432,13 +375,15 @@ func (h *ChatHandler) handleNonStreamingCompletion(ctx *fasthttp.RequestCtx, req
 
 // StreamErrorInfo holds parsed error information
 type StreamErrorInfo struct {
-	Message   string
-	Type      string
-	Code      int
+	Message string
+	Type    string
+	// Status is the HTTP status the error would have had before streaming began
+	Status    int
 	IsTimeout bool
+	RequestID string
 }
 
-// parseStreamError parses error type and code
+// parseStreamError parses error type and status
 func parseStreamError(err error) StreamErrorInfo {
 	if err == nil {
 		return StreamErrorInfo{}
@@ -448,75 +393,43 @@ func parseStreamError(err error) StreamErrorInfo {
 	// Check timeout error by message prefix
 	isTimeout := strings.HasPrefix(errorMsg, "stream.Recv() timeout") || strings.Contains(errorMsg, "timeout after")
 
-	errorType := "server_error"
-	errorCode := 500
+	status, errorType := utils.SDKErrorStatus(err)
 	if isTimeout {
-		errorType = "timeout_error"
-		errorCode = 504
+		status, errorType = fasthttp.StatusGatewayTimeout, "timeout_error"
 	}
 
 	return StreamErrorInfo{
 		Message:   errorMsg,
 		Type:      errorType,
-		Code:      errorCode,
+		Status:    status,
 		IsTimeout: isTimeout,
 	}
 }
 
 // formatErrorJSON formats error as OpenAI JSON
 func formatErrorJSON(errInfo StreamErrorInfo) string {
-	errorObj := map[string]interface{}{
-		"error": map[string]interface{}{
-			"message": errInfo.Message,
-			"type":    errInfo.Type,
-			"code":    errInfo.Code,
-		},
-	}
-	jsonBytes, _ := json.Marshal(errorObj)
+	jsonBytes, _ := json.Marshal(utils.ErrorBody(errInfo.Message, errInfo.Type, "", "", errInfo.RequestID))
 	return string(jsonBytes)
 }
 
-// sendSSEError sends SSE error response. Callers should log errors.
-func (h *ChatHandler) sendSSEError(w *bufio.Writer, err error) (StreamErrorInfo, error) {
-	errInfo := parseStreamError(err)
-	errorJSON := formatErrorJSON(errInfo)
-
-	w.WriteString("data: ")
-	w.WriteString(errorJSON)
-	w.WriteString("\n\n")
-
-	if flushErr := w.Flush(); flushErr != nil && !isBrokenPipeError(flushErr) {
-		h.logger.Warn("Failed to flush error response", zap.Error(flushErr))
-		return errInfo, flushErr
-	}
-
-	return errInfo, nil
-}
-
-// HandleGenerate handles POST /generate (SGLang native API)
+// HandleGenerate handles POST /generate (SGLang native API). The optional
+// model field routes the request like the OpenAI endpoints, so API keys
+// limited to some models are held to them here too.
 func (h *ChatHandler) HandleGenerate(ctx *fasthttp.RequestCtx) {
-	path := string(ctx.Path())
-
-	defer func() {
-		statusCode := ctx.Response.StatusCode()
-		if statusCode == 0 {
-			statusCode = 200
-		}
-		h.logHTTPResponse(statusCode, path)
-	}()
+	logger := h.logger.With(requestid.Field(ctx))
 
 	// Parse request body
 	var req map[string]interface{}
 	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
-		h.logger.Warn("Invalid generate request", zap.Error(err))
-		utils.RespondError(ctx, 400, fmt.Sprintf("Invalid request: %v", err), "invalid_request_error")
+		logger.Warn("Invalid generate request", zap.Error(err))
+		utils.RespondDecodeError(ctx, err)
 		return
 	}
 
 	// Extract text and sampling_params
 	text, ok := req["text"].(string)
 	if !ok || text == "" {
-		utils.RespondError(ctx, 400, "Missing or invalid 'text' field", "invalid_request_error")
+		utils.RespondErrorWithParam(ctx, 400, "Missing or invalid 'text' field", "invalid_request_error", "text", "")
 		return
 	}
 
@@ -525,9 +438,15 @@ func (h *ChatHandler) HandleGenerate(ctx *fasthttp.RequestCtx) {
 		samplingParams = make(map[string]interface{})
 	}
 
+	model, _ := req["model"].(string)
+	if model == "" {
+		model = "default"
+	}
+	route := h.service.Route(model)
+
 	// Convert to chat completion format for processing
 	chatReq := smg.ChatCompletionRequest{
-		Model:    "default",
+		Model:    route.Target,
 		Messages: []smg.ChatMessage{{Role: "user", Content: text}},
 		Stream:   false,
 	}
@@ -550,17 +469,18 @@ func (h *ChatHandler) HandleGenerate(ctx *fasthttp.RequestCtx) {
 		chatReq.TopK = &topKInt
 	}
 
-	requestCtx := context.Background()
+	requestCtx := requestContext(ctx)
 
 	// Use non-streaming completion for /generate endpoint
-	resp, err := h.service.ChatClient().CreateChatCompletion(requestCtx, chatReq)
+	resp, err := route.Client.CreateChatCompletion(requestCtx, chatReq)
 	if err != nil {
-		h.logger.Error("Failed to create completion",
+		logger.Error("Failed to create completion",
 			zap.Error(err),
 		)
-		utils.RespondError(ctx, 500, fmt.Sprintf("Failed to create completion: %v", err), "server_error")
+		utils.RespondSDKError(ctx, "Failed to create completion", err)
 		return
 	}
+	h.recordUsage(ctx, route.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
 
 	// Convert to SGLang /generate response format
 	// meta_info must match SGLang's expected format with completion_tokens at top level
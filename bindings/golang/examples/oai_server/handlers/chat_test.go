@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/service"
+)
+
+// fakeBackend answers chat completions with a fixed reply, and streams with
+// chunks followed by streamErr or io.EOF, and records the requests it
+// receives
+type fakeBackend struct {
+	smg.Backend
+	requests  []smg.ChatCompletionRequest
+	chunks    []string
+	streamErr error
+}
+
+func (b *fakeBackend) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	b.requests = append(b.requests, req)
+	return &smg.ChatCompletionResponse{
+		ID:      "chatcmpl-1",
+		Model:   req.Model,
+		Choices: []smg.Choice{{Message: smg.Message{Role: "assistant", Content: "hi"}, FinishReason: "stop"}},
+		Usage:   smg.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}, nil
+}
+
+func (b *fakeBackend) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	b.requests = append(b.requests, req)
+	err := b.streamErr
+	if err == nil {
+		err = io.EOF
+	}
+	return &fakeStream{chunks: b.chunks, err: err}, nil
+}
+
+// fakeStream returns chunks and then err
+type fakeStream struct {
+	chunks []string
+	err    error
+}
+
+func (s *fakeStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", s.err
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+// TestStreamUsage tests charging a stream's usage chunk, or its chunks when
+// it ends without one
+func TestStreamUsage(t *testing.T) {
+	var charged []int
+	var tenant [][3]interface{}
+	newUsage := func() *streamUsage {
+		charged, tenant = nil, nil
+		return &streamUsage{
+			recordUsage: func(tokens int) { charged = append(charged, tokens) },
+			recordTenantUsage: func(model string, promptTokens, completionTokens int) {
+				tenant = append(tenant, [3]interface{}{model, promptTokens, completionTokens})
+			},
+			model: "m",
+		}
+	}
+
+	u := newUsage()
+	for i := 0; i < 3; i++ {
+		u.chunk()
+	}
+	u.charge(10, 3, 13)
+	u.charge(10, 3, 13)
+	u.finish()
+	if len(charged) != 1 || charged[0] != 13 || len(tenant) != 1 || tenant[0] != [3]interface{}{"m", 10, 3} {
+		t.Errorf("completed stream charged %v, tenant %v", charged, tenant)
+	}
+
+	// The client disconnected after two chunks
+	u = newUsage()
+	u.chunk()
+	u.chunk()
+	u.finish()
+	if len(charged) != 1 || charged[0] != 2 || len(tenant) != 1 || tenant[0] != [3]interface{}{"m", 0, 2} {
+		t.Errorf("abandoned stream charged %v, tenant %v", charged, tenant)
+	}
+
+	u = newUsage()
+	u.finish()
+	if len(charged) != 0 || len(tenant) != 0 {
+		t.Errorf("empty stream charged %v, tenant %v", charged, tenant)
+	}
+}
+
+// TestGenerateModelAllowList tests that /generate is routed by its model
+// field, so a key limited to some models cannot reach others through it
+func TestGenerateModelAllowList(t *testing.T) {
+	backend := &fakeBackend{}
+	svc := service.NewSMGServiceWithClient(backend, "grpc://worker:20000")
+	if err := svc.SetModelAliases([]service.ModelAlias{{Name: "llama", Target: "meta-llama", Group: -1}}); err != nil {
+		t.Fatal(err)
+	}
+	h := NewChatHandler(zap.NewNop(), svc, nil, 0)
+	store, err := auth.ParseKeyList("sk-llama:team:llama,sk-any:team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := auth.Middleware(store, zap.NewNop(), h.HandleGenerate)
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		wantStatus int
+		// wantModel is the model the workers were asked for
+		wantModel string
+	}{
+		{name: "allowed model", key: "sk-llama", body: `{"text":"hello","model":"llama"}`, wantStatus: 200, wantModel: "meta-llama"},
+		{name: "other model", key: "sk-llama", body: `{"text":"hello","model":"qwen"}`, wantStatus: 403},
+		{name: "no model", key: "sk-llama", body: `{"text":"hello"}`, wantStatus: 403},
+		{name: "unrestricted key", key: "sk-any", body: `{"text":"hello"}`, wantStatus: 200, wantModel: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.requests = nil
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/generate")
+			ctx.Request.Header.Set("Authorization", "Bearer "+tt.key)
+			ctx.Request.SetBodyString(tt.body)
+			handler(&ctx)
+
+			if ctx.Response.StatusCode() != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", ctx.Response.StatusCode(), tt.wantStatus, ctx.Response.Body())
+			}
+			if tt.wantStatus != 200 {
+				if len(backend.requests) != 0 {
+					t.Errorf("rejected request reached the workers: %+v", backend.requests)
+				}
+				return
+			}
+			if len(backend.requests) != 1 || backend.requests[0].Model != tt.wantModel {
+				t.Fatalf("workers got %+v, want model %q", backend.requests, tt.wantModel)
+			}
+			var resp struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil || resp.Text != "hi" {
+				t.Errorf("response %s: %v", ctx.Response.Body(), err)
+			}
+		})
+	}
+}
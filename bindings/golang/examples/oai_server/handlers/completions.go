@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/accesslog"
+	"oai_server/models"
+	"oai_server/moderation"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// HandleCompletion handles POST /v1/completions (legacy completions API)
+func (h *ChatHandler) HandleCompletion(ctx *fasthttp.RequestCtx) {
+	logger := h.logger.With(requestid.Field(ctx))
+
+	var req models.CompletionRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		logger.Warn("Invalid completion request", zap.Error(err))
+		utils.RespondDecodeError(ctx, err)
+		return
+	}
+	entry := accesslog.FromContext(ctx)
+	entry.Model = req.Model
+	entry.Stream = req.Stream
+	if err := req.Validate(); err != nil {
+		logger.Warn("Invalid completion request", zap.String("param", err.Param), zap.String("error", err.Message))
+		utils.RespondErrorWithParam(ctx, 400, err.Message, "invalid_request_error", err.Param, "")
+		return
+	}
+
+	// The prompt may be a string or a single-element array of strings
+	var prompt string
+	switch p := req.Prompt.(type) {
+	case string:
+		prompt = p
+	case []interface{}:
+		if len(p) != 1 {
+			utils.RespondErrorWithParam(ctx, 400, "Exactly one prompt is supported per request", "invalid_request_error", "prompt", "")
+			return
+		}
+		s, ok := p[0].(string)
+		if !ok {
+			utils.RespondErrorWithParam(ctx, 400, "Prompt must be a string", "invalid_request_error", "prompt", "")
+			return
+		}
+		prompt = s
+	default:
+		utils.RespondErrorWithParam(ctx, 400, "Prompt must be a string", "invalid_request_error", "prompt", "")
+		return
+	}
+
+	route := h.service.Route(req.Model)
+	sglReq := smg.CompletionRequest{
+		Model:        route.Target,
+		Prompt:       prompt,
+		Echo:         req.Echo,
+		Stream:       req.Stream,
+		MaxTokens:    req.MaxTokens,
+		TopK:         req.TopK,
+		Stop:         req.Stop,
+		StopTokenIDs: req.StopTokenIDs,
+		IgnoreEos:    req.IgnoreEos,
+		NoStopTrim:   req.NoStopTrim,
+		Seed:         req.Seed,
+		User:         req.User,
+	}
+	sglReq.StreamOptions = sdkStreamOptions(req.Stream)
+	sglReq.Temperature = toFloat32(req.Temperature)
+	sglReq.TopP = toFloat32(req.TopP)
+	sglReq.FrequencyPenalty = toFloat32(req.FrequencyPenalty)
+	sglReq.PresencePenalty = toFloat32(req.PresencePenalty)
+	sglReq.MinP = toFloat32(req.MinP)
+	sglReq.RepetitionPenalty = toFloat32(req.RepetitionPenalty)
+
+	if req.Stream {
+		h.streamSSE(ctx, route, req.StreamOptions.WantsUsage(), func(streamCtx context.Context) (smg.ChatStream, error) {
+			return route.Client.CreateCompletionStream(streamCtx, sglReq)
+		})
+		return
+	}
+
+	resp, err := route.Client.CreateCompletion(requestContext(ctx), sglReq)
+	if err != nil {
+		logger.Error("Failed to create completion",
+			zap.Error(err),
+			zap.String("model", req.Model),
+		)
+		utils.RespondSDKError(ctx, "Failed to create completion", err)
+		return
+	}
+	h.recordUsage(ctx, route.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+
+	texts := make([]string, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		texts[i] = choice.Text
+	}
+	verdict := h.moderateOutput(ctx, route, texts)
+	for i := range resp.Choices {
+		switch verdict.Action {
+		case moderation.Block:
+			resp.Choices[i].Text = ""
+			resp.Choices[i].FinishReason = moderation.ContentFilter
+		case moderation.Redact:
+			resp.Choices[i].Text = verdict.Texts[i]
+		}
+	}
+
+	response := utils.BuildResponseBase(resp.ID, resp.Created, route.ResponseModel(resp.Model))
+	response["object"] = "text_completion"
+
+	choices := make([]map[string]interface{}, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choices[i] = map[string]interface{}{
+			"index":         choice.Index,
+			"text":          choice.Text,
+			"logprobs":      nil,
+			"finish_reason": choice.FinishReason,
+		}
+	}
+	response["choices"] = choices
+	response["usage"] = map[string]interface{}{
+		"prompt_tokens":     resp.Usage.PromptTokens,
+		"completion_tokens": resp.Usage.CompletionTokens,
+		"total_tokens":      resp.Usage.TotalTokens,
+	}
+
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	jsonData, _ := json.Marshal(response)
+	ctx.Write(jsonData)
+}
+
+// toFloat32 converts an optional request float to the SDK's float32 form
+func toFloat32(v *float64) *float32 {
+	if v == nil {
+		return nil
+	}
+	f := float32(*v)
+	return &f
+}
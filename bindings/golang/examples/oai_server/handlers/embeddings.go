@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/accesslog"
+	"oai_server/models"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// HandleEmbeddings handles POST /v1/embeddings
+func (h *ChatHandler) HandleEmbeddings(ctx *fasthttp.RequestCtx) {
+	logger := h.logger.With(requestid.Field(ctx))
+
+	var req models.EmbeddingRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		logger.Warn("Invalid embeddings request", zap.Error(err))
+		utils.RespondDecodeError(ctx, err)
+		return
+	}
+	accesslog.FromContext(ctx).Model = req.Model
+
+	// The input may be a string or an array of strings (token arrays are not supported)
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []interface{}:
+		for _, item := range in {
+			s, ok := item.(string)
+			if !ok {
+				utils.RespondErrorWithParam(ctx, 400, "Input must be a string or an array of strings", "invalid_request_error", "input", "")
+				return
+			}
+			inputs = append(inputs, s)
+		}
+	}
+	if len(inputs) == 0 {
+		utils.RespondErrorWithParam(ctx, 400, "Input must be a non-empty string or array of strings", "invalid_request_error", "input", "")
+		return
+	}
+
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		utils.RespondErrorWithParam(ctx, 400, fmt.Sprintf("Unsupported encoding_format %q", req.EncodingFormat), "invalid_request_error", "encoding_format", "")
+		return
+	}
+
+	route := h.service.Route(req.Model)
+	resp, err := route.Client.CreateEmbeddings(requestContext(ctx), smg.EmbeddingRequest{
+		Model: route.Target,
+		Input: inputs,
+		User:  req.User,
+	})
+	if err != nil {
+		logger.Error("Failed to create embeddings",
+			zap.Error(err),
+			zap.String("model", req.Model),
+			zap.Int("inputs", len(inputs)),
+		)
+		utils.RespondSDKError(ctx, "Failed to create embeddings", err)
+		return
+	}
+	h.recordUsage(ctx, route.Model, resp.Usage.PromptTokens, 0, resp.Usage.TotalTokens)
+
+	data := make([]map[string]interface{}, len(resp.Data))
+	for i, d := range resp.Data {
+		var embedding interface{} = d.Embedding
+		if req.EncodingFormat == "base64" {
+			embedding = encodeEmbeddingBase64(d.Embedding)
+		}
+		data[i] = map[string]interface{}{
+			"object":    d.Object,
+			"index":     d.Index,
+			"embedding": embedding,
+		}
+	}
+
+	response := map[string]interface{}{
+		"object": resp.Object,
+		"data":   data,
+		"model":  route.ResponseModel(resp.Model),
+		"usage": map[string]interface{}{
+			"prompt_tokens": resp.Usage.PromptTokens,
+			"total_tokens":  resp.Usage.TotalTokens,
+		},
+	}
+
+	ctx.SetStatusCode(200)
+	ctx.SetContentType("application/json")
+	jsonData, _ := json.Marshal(response)
+	ctx.Write(jsonData)
+}
+
+// encodeEmbeddingBase64 encodes an embedding as little-endian float32 bytes,
+// matching OpenAI's encoding_format=base64
+func encodeEmbeddingBase64(embedding []float32) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -5,21 +5,26 @@ import (
 
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
+
+	"oai_server/service"
 )
 
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	logger *zap.Logger
+	logger  *zap.Logger
+	service *service.SMGService
 }
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler(logger *zap.Logger) *HealthHandler {
+func NewHealthHandler(logger *zap.Logger, svc *service.SMGService) *HealthHandler {
 	return &HealthHandler{
-		logger: logger,
+		logger:  logger,
+		service: svc,
 	}
 }
 
-// Check handles GET /health
+// Check handles GET /health and GET /healthz (liveness). It only reports
+// that the process is serving requests.
 func (h *HealthHandler) Check(ctx *fasthttp.RequestCtx) {
 	ctx.SetStatusCode(200)
 	ctx.SetContentType("application/json")
@@ -31,3 +36,40 @@ func (h *HealthHandler) Check(ctx *fasthttp.RequestCtx) {
 	jsonData, _ := json.Marshal(response)
 	ctx.Write(jsonData)
 }
+
+// Ready handles GET /readyz (readiness). It returns 503 unless at least one
+// worker is healthy and the default tokenizer is loaded, so that load
+// balancers stop routing to a gateway that cannot serve requests.
+func (h *HealthHandler) Ready(ctx *fasthttp.RequestCtx) {
+	client := h.service.ChatClient()
+
+	healthyWorkers := client.HealthyWorkerCount()
+	tokenizerStatus := "loaded"
+	if _, err := client.Tokenizer(""); err != nil {
+		tokenizerStatus = err.Error()
+	}
+
+	ready := healthyWorkers > 0 && tokenizerStatus == "loaded"
+	status := "ready"
+	statusCode := fasthttp.StatusOK
+	if !ready {
+		status = "not_ready"
+		statusCode = fasthttp.StatusServiceUnavailable
+		h.logger.Warn("Readiness check failed",
+			zap.Int("healthy_workers", healthyWorkers),
+			zap.String("tokenizer", tokenizerStatus),
+		)
+	}
+
+	response := map[string]interface{}{
+		"status":          status,
+		"healthy_workers": healthyWorkers,
+		"workers":         h.service.WorkerCount(),
+		"tokenizer":       tokenizerStatus,
+	}
+
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	jsonData, _ := json.Marshal(response)
+	ctx.Write(jsonData)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import "time"
+
+// heartbeatComment is an SSE comment line; clients ignore it, but it keeps
+// proxies from closing a stream that is idle during a long prefill
+const heartbeatComment = ": ping\n\n"
+
+// heartbeat fires when a stream has been idle for its interval. A zero
+// interval disables it: C returns nil, which blocks forever in a select.
+type heartbeat struct {
+	interval time.Duration
+	timer    *time.Timer
+}
+
+func newHeartbeat(interval time.Duration) *heartbeat {
+	hb := &heartbeat{interval: interval}
+	if interval > 0 {
+		hb.timer = time.NewTimer(interval)
+	}
+	return hb
+}
+
+// C returns the channel that receives when the stream has been idle
+func (hb *heartbeat) C() <-chan time.Time {
+	if hb.timer == nil {
+		return nil
+	}
+	return hb.timer.C
+}
+
+// Reset restarts the idle interval after the stream wrote something
+func (hb *heartbeat) Reset() {
+	if hb.timer != nil {
+		hb.timer.Reset(hb.interval)
+	}
+}
+
+// Stop releases the timer
+func (hb *heartbeat) Stop() {
+	if hb.timer != nil {
+		hb.timer.Stop()
+	}
+}
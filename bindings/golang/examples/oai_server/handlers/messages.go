@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/anthropic"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/accesslog"
+	"oai_server/moderation"
+	"oai_server/requestid"
+	"oai_server/service"
+	"oai_server/utils"
+)
+
+// HandleMessages handles POST /v1/messages, Anthropic's Messages API.
+// Requests are converted to chat completions and the results back, and
+// errors use the Messages API error format.
+func (h *ChatHandler) HandleMessages(ctx *fasthttp.RequestCtx) {
+	logger := h.logger.With(requestid.Field(ctx))
+
+	var req anthropic.MessagesRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		logger.Warn("Invalid messages request", zap.Error(err))
+		respondMessagesError(ctx, fasthttp.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	entry := accesslog.FromContext(ctx)
+	entry.Model = req.Model
+	entry.Stream = req.Stream
+
+	sglReq, err := anthropic.ChatRequest(req)
+	if err != nil {
+		logger.Warn("Invalid messages request", zap.Error(err))
+		respondMessagesError(ctx, fasthttp.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	route := h.service.Route(req.Model)
+	sglReq.Model = route.Target
+
+	if req.Stream {
+		h.handleStreamingMessages(ctx, route, sglReq)
+	} else {
+		h.handleNonStreamingMessages(ctx, route, sglReq)
+	}
+}
+
+// respondMessagesError sends an error response in the Messages API format
+func respondMessagesError(ctx *fasthttp.RequestCtx, statusCode int, errorType, message string) {
+	writeJSON(ctx, statusCode, map[string]interface{}{
+		"type":       "error",
+		"error":      map[string]interface{}{"type": errorType, "message": message},
+		"request_id": requestid.FromContext(ctx),
+	})
+}
+
+// messagesErrorType returns the Messages API error type for an HTTP status
+func messagesErrorType(statusCode int) string {
+	switch statusCode {
+	case fasthttp.StatusBadRequest:
+		return "invalid_request_error"
+	case fasthttp.StatusServiceUnavailable:
+		return "overloaded_error"
+	case fasthttp.StatusGatewayTimeout:
+		return "timeout_error"
+	}
+	return "api_error"
+}
+
+func (h *ChatHandler) handleNonStreamingMessages(ctx *fasthttp.RequestCtx, route service.Route, req smg.ChatCompletionRequest) {
+	logger := h.logger.With(requestid.Field(ctx))
+	completion, err := route.Client.CreateChatCompletion(requestContext(ctx), req)
+	if err != nil {
+		logger.Error("Failed to create message",
+			zap.Error(err),
+			zap.String("model", req.Model),
+		)
+		statusCode, _ := utils.SDKErrorStatus(err)
+		respondMessagesError(ctx, statusCode, messagesErrorType(statusCode), fmt.Sprintf("Failed to create message: %v", err))
+		return
+	}
+	h.recordUsage(ctx, route.Model, completion.Usage.PromptTokens, completion.Usage.CompletionTokens, completion.Usage.TotalTokens)
+
+	if len(completion.Choices) > 0 {
+		choice := &completion.Choices[0]
+		verdict := h.moderateOutput(ctx, route, []string{choice.Message.Content})
+		switch verdict.Action {
+		case moderation.Block:
+			choice.Message.Content = ""
+			choice.Message.ToolCalls = nil
+			choice.FinishReason = moderation.ContentFilter
+		case moderation.Redact:
+			choice.Message.Content = verdict.Texts[0]
+		}
+	}
+	resp := anthropic.MessagesResponseFrom(completion)
+	resp.Model = route.ResponseModel(completion.Model)
+	writeJSON(ctx, fasthttp.StatusOK, resp)
+}
+
+func (h *ChatHandler) handleStreamingMessages(ctx *fasthttp.RequestCtx, route service.Route, req smg.ChatCompletionRequest) {
+	logger := h.logger.With(requestid.Field(ctx))
+	open := func(streamCtx context.Context) (smg.ChatStream, error) {
+		return route.Client.CreateChatCompletionStream(streamCtx, req)
+	}
+	respondError := func(ctx *fasthttp.RequestCtx, err error) {
+		statusCode, _ := utils.SDKErrorStatus(err)
+		respondMessagesError(ctx, statusCode, messagesErrorType(statusCode), fmt.Sprintf("Failed to create stream: %v", err))
+	}
+
+	// An aliased model is reported by its alias
+	converter := anthropic.NewStreamConverter(route.ResponseModel(""))
+	write := func(w *bufio.Writer, events []anthropic.StreamEvent) {
+		for _, event := range events {
+			w.WriteString(event.SSE())
+		}
+	}
+	h.pumpStream(ctx, route, open, respondError, streamEvents{
+		chunk: func(w *bufio.Writer, chunkJSON string) *smg.Usage {
+			events, err := converter.Chunk(chunkJSON)
+			if err != nil {
+				logger.Warn("Failed to parse stream chunk", zap.Error(err))
+				return nil
+			}
+			write(w, events)
+			if !strings.Contains(chunkJSON, `"usage"`) {
+				return nil
+			}
+			return chunkUsage(chunkJSON)
+		},
+		fail: func(w *bufio.Writer, errInfo StreamErrorInfo) {
+			write(w, []anthropic.StreamEvent{anthropic.ErrorEvent(messagesErrorType(errInfo.Status), errInfo.Message)})
+		},
+		end: func(w *bufio.Writer) {
+			write(w, converter.Finish())
+		},
+	})
+}
@@ -1,42 +1,92 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
+	"time"
 
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
+
+	"oai_server/requestid"
+	"oai_server/service"
+	"oai_server/utils"
 )
 
+// listModelsTimeout bounds the per-request model discovery across workers
+const listModelsTimeout = 5 * time.Second
+
 // ModelsHandler handles model list requests
 type ModelsHandler struct {
 	logger        *zap.Logger
 	tokenizerPath string
+	smgService    *service.SMGService
+	created       int64
 }
 
 // NewModelsHandler creates a new models handler
-func NewModelsHandler(logger *zap.Logger, tokenizerPath string) *ModelsHandler {
+func NewModelsHandler(logger *zap.Logger, tokenizerPath string, smgService *service.SMGService) *ModelsHandler {
 	return &ModelsHandler{
 		logger:        logger,
 		tokenizerPath: tokenizerPath,
+		smgService:    smgService,
+		created:       time.Now().Unix(),
 	}
 }
 
 // List handles GET /v1/models
+// Returns the models served by the configured workers
 func (h *ModelsHandler) List(ctx *fasthttp.RequestCtx) {
-	// Return a default model for OpenAI compatibility
+	logger := h.logger.With(requestid.Field(ctx))
+	reqCtx, cancel := context.WithTimeout(requestContext(ctx), listModelsTimeout)
+	defer cancel()
+
+	models, err := h.smgService.ChatClient().ListModels(reqCtx)
+	if err != nil {
+		logger.Error("Failed to list models", zap.Error(err))
+		utils.RespondError(ctx, fasthttp.StatusServiceUnavailable, "Failed to list models: "+err.Error(), "service_unavailable")
+		return
+	}
+
+	data := make([]map[string]interface{}, 0, len(models))
+	for _, m := range models {
+		entry := map[string]interface{}{
+			"id":       m.ID,
+			"object":   "model",
+			"created":  h.created,
+			"owned_by": "sglang",
+			"root":     m.ModelPath,
+		}
+		if m.MaxContextLength > 0 {
+			entry["max_model_len"] = m.MaxContextLength
+		}
+		data = append(data, entry)
+	}
+
+	// Aliases are listed under the names clients use, after the worker models
+	aliases := h.smgService.ModelAliases()
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data = append(data, map[string]interface{}{
+			"id":       name,
+			"object":   "model",
+			"created":  h.created,
+			"owned_by": "sglang",
+			"root":     aliases[name],
+		})
+	}
+
 	ctx.SetStatusCode(200)
 	ctx.SetContentType("application/json")
 
 	response := map[string]interface{}{
 		"object": "list",
-		"data": []map[string]interface{}{
-			{
-				"id":       "default",
-				"object":   "model",
-				"created": 1677610602,
-				"owned_by": "sglang",
-			},
-		},
+		"data":   data,
 	}
 
 	jsonData, _ := json.Marshal(response)
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/moderation"
+	"oai_server/requestid"
+	"oai_server/service"
+)
+
+// SetOutputModeration moderates generated text with checker before it is
+// returned. Streams are checked in windows of streamWindow bytes of text. It
+// must be called before the handler serves requests.
+func (h *ChatHandler) SetOutputModeration(checker *moderation.Checker, streamWindow int) {
+	h.moderation = checker
+	h.moderationWindow = streamWindow
+}
+
+// moderationRequest describes a request to the output moderator
+func moderationRequest(ctx *fasthttp.RequestCtx, route service.Route) moderation.Request {
+	req := moderation.Request{Path: string(ctx.Path()), Model: route.Model}
+	if key := auth.KeyFromContext(ctx); key != nil {
+		req.Tenant = key.Tenant
+	}
+	return req
+}
+
+// moderateStream returns stream with its output moderated, or stream itself
+// when output moderation is disabled
+func (h *ChatHandler) moderateStream(ctx *fasthttp.RequestCtx, streamCtx context.Context, route service.Route, stream smg.ChatStream) smg.ChatStream {
+	if h.moderation == nil {
+		return stream
+	}
+	return moderation.NewStream(streamCtx, h.moderation, moderationRequest(ctx, route), h.moderationWindow, stream)
+}
+
+// moderateOutput checks the texts of a response. A failed check blocks the
+// response. Without output moderation, or text, everything is allowed.
+func (h *ChatHandler) moderateOutput(ctx *fasthttp.RequestCtx, route service.Route, texts []string) moderation.Verdict {
+	empty := true
+	for _, text := range texts {
+		empty = empty && text == ""
+	}
+	if h.moderation == nil || empty {
+		return moderation.Verdict{Action: moderation.Allow}
+	}
+	req := moderationRequest(ctx, route)
+	req.Stage = moderation.StageOutput
+	req.Texts = texts
+	verdict, err := h.moderation.Check(ctx, &req)
+	if err != nil {
+		h.logger.Error("Output moderation failed, blocking response", zap.Error(err), requestid.Field(ctx))
+		return moderation.Verdict{Action: moderation.Block}
+	}
+	if verdict.Action == moderation.Block {
+		h.logger.Warn("Blocked response by content moderation",
+			zap.String("tenant", req.Tenant),
+			zap.String("reason", verdict.Reason),
+			requestid.Field(ctx),
+		)
+	}
+	return verdict
+}
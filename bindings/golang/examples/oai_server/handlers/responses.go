@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/accesslog"
+	"oai_server/models"
+	"oai_server/moderation"
+	"oai_server/requestid"
+	"oai_server/service"
+	"oai_server/utils"
+)
+
+// responseObject is a Responses API response
+type responseObject struct {
+	ID                 string                `json:"id"`
+	Object             string                `json:"object"`
+	CreatedAt          int64                 `json:"created_at"`
+	Status             string                `json:"status"`
+	Error              *responseError        `json:"error"`
+	IncompleteDetails  *incompleteDetails    `json:"incomplete_details"`
+	Instructions       *string               `json:"instructions"`
+	MaxOutputTokens    *int                  `json:"max_output_tokens"`
+	Model              string                `json:"model"`
+	Output             []interface{}         `json:"output"`
+	ParallelToolCalls  bool                  `json:"parallel_tool_calls"`
+	PreviousResponseID *string               `json:"previous_response_id"`
+	Store              bool                  `json:"store"`
+	Temperature        *float64              `json:"temperature"`
+	TopP               *float64              `json:"top_p"`
+	ToolChoice         interface{}           `json:"tool_choice"`
+	Tools              []models.ResponseTool `json:"tools"`
+	Usage              *responseUsage        `json:"usage"`
+	Metadata           map[string]string     `json:"metadata"`
+}
+
+type responseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type incompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type responseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// messageItem is an assistant message output item
+type messageItem struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Status  string       `json:"status"`
+	Role    string       `json:"role"`
+	Content []outputText `json:"content"`
+}
+
+type outputText struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// functionCallItem is a function call output item
+type functionCallItem struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Status    string `json:"status"`
+}
+
+// HandleResponses handles POST /v1/responses. Requests are served as chat
+// completions; responses are not stored, so previous_response_id is
+// rejected and clients send the whole conversation as input items.
+func (h *ChatHandler) HandleResponses(ctx *fasthttp.RequestCtx) {
+	logger := h.logger.With(requestid.Field(ctx))
+
+	var req models.ResponsesRequest
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		logger.Warn("Invalid responses request", zap.Error(err))
+		utils.RespondDecodeError(ctx, err)
+		return
+	}
+	entry := accesslog.FromContext(ctx)
+	entry.Model = req.Model
+	entry.Stream = req.Stream
+	if err := req.Validate(); err != nil {
+		logger.Warn("Invalid responses request", zap.String("param", err.Param), zap.String("error", err.Message))
+		utils.RespondErrorWithParam(ctx, 400, err.Message, "invalid_request_error", err.Param, "")
+		return
+	}
+	items, _ := req.InputItems()
+
+	route := h.service.Route(req.Model)
+	sglReq := smg.ChatCompletionRequest{
+		Model:               route.Target,
+		Messages:            responseMessages(req.Instructions, items),
+		Stream:              req.Stream,
+		MaxCompletionTokens: req.MaxOutputTokens,
+		User:                req.User,
+	}
+	if req.Temperature != nil {
+		temp := float32(*req.Temperature)
+		sglReq.Temperature = &temp
+	}
+	if req.TopP != nil {
+		topP := float32(*req.TopP)
+		sglReq.TopP = &topP
+	}
+	for _, tool := range req.Tools {
+		parameters := tool.Parameters
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		sglReq.Tools = append(sglReq.Tools, smg.Tool{
+			Type: "function",
+			Function: smg.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	switch choice := req.ToolChoice.(type) {
+	case string:
+		sglReq.ToolChoice = choice
+	case map[string]interface{}:
+		sglReq.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": choice["name"]},
+		}
+	}
+	sglReq.StreamOptions = sdkStreamOptions(req.Stream)
+
+	resp := newResponseObject(&req, route.Model)
+	if req.Stream {
+		h.handleStreamingResponse(ctx, route, sglReq, resp)
+	} else {
+		h.handleNonStreamingResponse(ctx, route, sglReq, resp)
+	}
+}
+
+// responseMessages converts instructions and input items to chat messages.
+// Function calls join the assistant message before them, and function call
+// outputs become tool messages.
+func responseMessages(instructions string, items []models.ResponseInputItem) []smg.ChatMessage {
+	messages := make([]smg.ChatMessage, 0, len(items)+1)
+	if instructions != "" {
+		messages = append(messages, smg.ChatMessage{Role: "system", Content: instructions})
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "message":
+			text, _ := item.ContentText()
+			messages = append(messages, smg.ChatMessage{Role: item.Role, Content: text})
+		case "function_call":
+			call := smg.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: smg.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, smg.ChatMessage{Role: "assistant", Content: "", ToolCalls: []smg.ToolCall{call}})
+		case "function_call_output":
+			messages = append(messages, smg.ChatMessage{Role: "tool", Content: item.Output, ToolCallID: item.CallID})
+		}
+	}
+	return messages
+}
+
+// newResponseObject returns an in-progress response echoing the request's
+// settings
+func newResponseObject(req *models.ResponsesRequest, model string) *responseObject {
+	resp := &responseObject{
+		ID:                "resp_" + newItemID(),
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            "in_progress",
+		MaxOutputTokens:   req.MaxOutputTokens,
+		Model:             model,
+		Output:            []interface{}{},
+		ParallelToolCalls: req.ParallelToolCalls == nil || *req.ParallelToolCalls,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		ToolChoice:        req.ToolChoice,
+		Tools:             req.Tools,
+		Metadata:          req.Metadata,
+	}
+	if req.Instructions != "" {
+		resp.Instructions = &req.Instructions
+	}
+	if resp.ToolChoice == nil {
+		resp.ToolChoice = "auto"
+	}
+	if resp.Tools == nil {
+		resp.Tools = []models.ResponseTool{}
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	return resp
+}
+
+// finish sets the final status of the response from the chat finish reason
+func (r *responseObject) finish(finishReason smg.FinishReason) {
+	switch finishReason {
+	case smg.FinishReasonLength:
+		r.Status = "incomplete"
+		r.IncompleteDetails = &incompleteDetails{Reason: "max_output_tokens"}
+	case moderation.ContentFilter:
+		r.Status = "incomplete"
+		r.IncompleteDetails = &incompleteDetails{Reason: "content_filter"}
+	default:
+		r.Status = "completed"
+	}
+}
+
+// newItemID returns a random ID for responses and output items
+func newItemID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (h *ChatHandler) handleNonStreamingResponse(ctx *fasthttp.RequestCtx, route service.Route, req smg.ChatCompletionRequest, resp *responseObject) {
+	logger := h.logger.With(requestid.Field(ctx))
+	completion, err := route.Client.CreateChatCompletion(requestContext(ctx), req)
+	if err != nil {
+		logger.Error("Failed to create response",
+			zap.Error(err),
+			zap.String("model", req.Model),
+		)
+		utils.RespondSDKError(ctx, "Failed to create response", err)
+		return
+	}
+	h.recordUsage(ctx, route.Model, completion.Usage.PromptTokens, completion.Usage.CompletionTokens, completion.Usage.TotalTokens)
+
+	resp.Model = route.ResponseModel(completion.Model)
+	resp.Usage = &responseUsage{
+		InputTokens:  completion.Usage.PromptTokens,
+		OutputTokens: completion.Usage.CompletionTokens,
+		TotalTokens:  completion.Usage.TotalTokens,
+	}
+	var finishReason smg.FinishReason
+	if len(completion.Choices) > 0 {
+		choice := completion.Choices[0]
+		finishReason = choice.FinishReason
+		verdict := h.moderateOutput(ctx, route, []string{choice.Message.Content})
+		switch verdict.Action {
+		case moderation.Block:
+			choice.Message.Content = ""
+			choice.Message.ToolCalls = nil
+			finishReason = moderation.ContentFilter
+		case moderation.Redact:
+			choice.Message.Content = verdict.Texts[0]
+		}
+		if choice.Message.Content != "" {
+			resp.Output = append(resp.Output, &messageItem{
+				Type:    "message",
+				ID:      "msg_" + newItemID(),
+				Status:  "completed",
+				Role:    "assistant",
+				Content: []outputText{{Type: "output_text", Text: choice.Message.Content, Annotations: []interface{}{}}},
+			})
+		}
+		for _, tc := range choice.Message.ToolCalls {
+			resp.Output = append(resp.Output, &functionCallItem{
+				Type:      "function_call",
+				ID:        "fc_" + newItemID(),
+				CallID:    tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+				Status:    "completed",
+			})
+		}
+	}
+	resp.finish(finishReason)
+	writeJSON(ctx, fasthttp.StatusOK, resp)
+}
+
+// responseChunk is the part of a chat completion stream chunk that
+// responses are built from
+type responseChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason smg.FinishReason `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *smg.Usage `json:"usage"`
+}
+
+func (h *ChatHandler) handleStreamingResponse(ctx *fasthttp.RequestCtx, route service.Route, req smg.ChatCompletionRequest, resp *responseObject) {
+	logger := h.logger.With(requestid.Field(ctx))
+	open := func(streamCtx context.Context) (smg.ChatStream, error) {
+		return route.Client.CreateChatCompletionStream(streamCtx, req)
+	}
+	respondError := func(ctx *fasthttp.RequestCtx, err error) {
+		utils.RespondSDKError(ctx, "Failed to create stream", err)
+	}
+
+	var events *responseEvents
+	var finishReason smg.FinishReason
+	h.pumpStream(ctx, route, open, respondError, streamEvents{
+		begin: func(w *bufio.Writer) {
+			events = &responseEvents{w: w, resp: resp, calls: make(map[int]*openCall)}
+			events.emit("response.created", map[string]interface{}{"response": resp})
+			events.emit("response.in_progress", map[string]interface{}{"response": resp})
+		},
+		chunk: func(w *bufio.Writer, chunkJSON string) *smg.Usage {
+			var chunk responseChunk
+			if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+				logger.Warn("Failed to parse stream chunk", zap.Error(err))
+				return nil
+			}
+			if chunk.Model != "" {
+				resp.Model = route.ResponseModel(chunk.Model)
+			}
+			if chunk.Usage != nil {
+				resp.Usage = &responseUsage{
+					InputTokens:  chunk.Usage.PromptTokens,
+					OutputTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:  chunk.Usage.TotalTokens,
+				}
+			}
+			for _, choice := range chunk.Choices {
+				if choice.Delta.Content != "" {
+					events.text(choice.Delta.Content)
+				}
+				for _, tc := range choice.Delta.ToolCalls {
+					events.toolCall(tc.Index, tc.ID, tc.Function.Name, tc.Function.Arguments)
+				}
+				if choice.FinishReason != "" {
+					finishReason = choice.FinishReason
+				}
+			}
+			return chunk.Usage
+		},
+		fail: func(w *bufio.Writer, errInfo StreamErrorInfo) {
+			resp.Status = "failed"
+			resp.Error = &responseError{Code: errInfo.Type, Message: errInfo.Message}
+			events.emit("response.failed", map[string]interface{}{"response": resp})
+		},
+		end: func(w *bufio.Writer) {
+			events.closeMessage()
+			events.closeCall()
+			resp.finish(finishReason)
+			if resp.Status == "incomplete" {
+				events.emit("response.incomplete", map[string]interface{}{"response": resp})
+			} else {
+				events.emit("response.completed", map[string]interface{}{"response": resp})
+			}
+		},
+	})
+}
+
+// openCall is a function call output item being streamed
+type openCall struct {
+	item        *functionCallItem
+	outputIndex int
+}
+
+// responseEvents writes Responses API stream events as output items are
+// built from chat completion deltas. A message is closed when a function
+// call starts, and a function call when the next one starts.
+type responseEvents struct {
+	w    *bufio.Writer
+	resp *responseObject
+	seq  int
+
+	message      *messageItem
+	messageIndex int
+
+	// calls are the function calls by tool call index; current is the one
+	// being streamed
+	calls   map[int]*openCall
+	current *openCall
+}
+
+// emit writes an event; payload gets the event type and sequence number
+func (e *responseEvents) emit(eventType string, payload map[string]interface{}) {
+	payload["type"] = eventType
+	payload["sequence_number"] = e.seq
+	e.seq++
+	data, _ := json.Marshal(payload)
+	e.w.WriteString("event: ")
+	e.w.WriteString(eventType)
+	e.w.WriteString("\ndata: ")
+	e.w.Write(data)
+	e.w.WriteString("\n\n")
+}
+
+// text appends a text delta to the message, starting one if none is open
+func (e *responseEvents) text(delta string) {
+	if e.message == nil || e.message.Status == "completed" {
+		e.closeCall()
+		e.message = &messageItem{
+			Type:    "message",
+			ID:      "msg_" + newItemID(),
+			Status:  "in_progress",
+			Role:    "assistant",
+			Content: []outputText{},
+		}
+		e.messageIndex = len(e.resp.Output)
+		e.resp.Output = append(e.resp.Output, e.message)
+		e.emit("response.output_item.added", map[string]interface{}{"output_index": e.messageIndex, "item": e.message})
+
+		part := outputText{Type: "output_text", Annotations: []interface{}{}}
+		e.message.Content = append(e.message.Content, part)
+		e.emit("response.content_part.added", map[string]interface{}{
+			"item_id": e.message.ID, "output_index": e.messageIndex, "content_index": 0, "part": part,
+		})
+	}
+	e.message.Content[0].Text += delta
+	e.emit("response.output_text.delta", map[string]interface{}{
+		"item_id": e.message.ID, "output_index": e.messageIndex, "content_index": 0, "delta": delta,
+	})
+}
+
+// closeMessage finishes the message being streamed, if any
+func (e *responseEvents) closeMessage() {
+	if e.message == nil || e.message.Status == "completed" {
+		return
+	}
+	part := e.message.Content[0]
+	e.emit("response.output_text.done", map[string]interface{}{
+		"item_id": e.message.ID, "output_index": e.messageIndex, "content_index": 0, "text": part.Text,
+	})
+	e.emit("response.content_part.done", map[string]interface{}{
+		"item_id": e.message.ID, "output_index": e.messageIndex, "content_index": 0, "part": part,
+	})
+	e.message.Status = "completed"
+	e.emit("response.output_item.done", map[string]interface{}{"output_index": e.messageIndex, "item": e.message})
+}
+
+// toolCall applies a tool call delta, starting a function call item for a
+// new tool call index
+func (e *responseEvents) toolCall(index int, callID, name, arguments string) {
+	call, ok := e.calls[index]
+	if !ok {
+		e.closeMessage()
+		e.closeCall()
+		call = &openCall{
+			item: &functionCallItem{
+				Type:   "function_call",
+				ID:     "fc_" + newItemID(),
+				CallID: callID,
+				Name:   name,
+				Status: "in_progress",
+			},
+			outputIndex: len(e.resp.Output),
+		}
+		e.calls[index] = call
+		e.current = call
+		e.resp.Output = append(e.resp.Output, call.item)
+		e.emit("response.output_item.added", map[string]interface{}{"output_index": call.outputIndex, "item": call.item})
+	} else {
+		if callID != "" {
+			call.item.CallID = callID
+		}
+		if name != "" {
+			call.item.Name = name
+		}
+	}
+	if arguments != "" {
+		call.item.Arguments += arguments
+		e.emit("response.function_call_arguments.delta", map[string]interface{}{
+			"item_id": call.item.ID, "output_index": call.outputIndex, "delta": arguments,
+		})
+	}
+}
+
+// closeCall finishes the function call being streamed, if any
+func (e *responseEvents) closeCall() {
+	call := e.current
+	if call == nil {
+		return
+	}
+	e.current = nil
+	e.emit("response.function_call_arguments.done", map[string]interface{}{
+		"item_id": call.item.ID, "output_index": call.outputIndex, "arguments": call.item.Arguments,
+	})
+	call.item.Status = "completed"
+	e.emit("response.output_item.done", map[string]interface{}{"output_index": call.outputIndex, "item": call.item})
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/concurrency"
+	"oai_server/logger"
+	"oai_server/metrics"
+	"oai_server/service"
+	"oai_server/utils"
+)
+
+// StatusHandler serves GET /admin/status, a summary of the fleet for on-call
+// engineers: workers and their health, requests in flight, and recent errors
+type StatusHandler struct {
+	logger       *zap.Logger
+	service      *service.SMGService
+	metrics      *metrics.Metrics
+	recentErrors *logger.RecentErrors
+	version      string
+	started      time.Time
+
+	// limiter is nil when concurrency limits are disabled
+	limiter *concurrency.Limiter
+	// groupLabels are the labels of each worker group, in group order
+	groupLabels []map[string]string
+}
+
+// NewStatusHandler creates a status handler for a server of version started
+// now. recentErrors may be nil.
+func NewStatusHandler(logger *zap.Logger, svc *service.SMGService, serverMetrics *metrics.Metrics,
+	recentErrors *logger.RecentErrors, version string) *StatusHandler {
+	return &StatusHandler{
+		logger:       logger,
+		service:      svc,
+		metrics:      serverMetrics,
+		recentErrors: recentErrors,
+		version:      version,
+		started:      time.Now(),
+	}
+}
+
+// SetLimiter reports the requests admitted and queued by limiter
+func (h *StatusHandler) SetLimiter(limiter *concurrency.Limiter) {
+	h.limiter = limiter
+}
+
+// SetGroupLabels names the worker groups by their labels, in group order
+func (h *StatusHandler) SetGroupLabels(labels []map[string]string) {
+	h.groupLabels = labels
+}
+
+// statusResponse is the body of GET /admin/status
+type statusResponse struct {
+	Object        string    `json:"object"`
+	Version       string    `json:"version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	// Policy is the load balancing policy of the default workers; empty for
+	// a single worker
+	Policy       string               `json:"policy"`
+	Workers      poolStatus           `json:"workers"`
+	Groups       []groupStatus        `json:"groups,omitempty"`
+	InFlight     inFlightStatus       `json:"in_flight"`
+	RecentErrors []logger.RecentError `json:"recent_errors"`
+}
+
+// poolStatus is the state of the default workers or a worker group
+type poolStatus struct {
+	Total   int                `json:"total"`
+	Healthy int                `json:"healthy"`
+	Data    []smg.WorkerStatus `json:"data"`
+	// Error is set when the workers could not be listed
+	Error string `json:"error,omitempty"`
+}
+
+// groupStatus is the state of a labeled worker group
+type groupStatus struct {
+	Index  int               `json:"index"`
+	Labels map[string]string `json:"labels,omitempty"`
+	poolStatus
+}
+
+// inFlightStatus counts the requests being served
+type inFlightStatus struct {
+	// Workers is the sum of the workers' loads; multi-worker clients only
+	Workers int `json:"workers"`
+	Streams int `json:"streams"`
+	// Admitted and Queued are set when concurrency limits are enabled
+	Admitted *int `json:"admitted,omitempty"`
+	Queued   *int `json:"queued,omitempty"`
+}
+
+// Handle serves the status as JSON, or as an HTML page for browsers and
+// ?format=html
+func (h *StatusHandler) Handle(ctx *fasthttp.RequestCtx) {
+	status := h.status()
+	format := string(ctx.QueryArgs().Peek("format"))
+	if format == "html" || (format == "" && strings.Contains(string(ctx.Request.Header.Peek("Accept")), "text/html")) {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetContentType("text/html; charset=utf-8")
+		if err := statusPage.Execute(ctx, status); err != nil {
+			h.logger.Warn("Failed to render status page", zap.Error(err))
+		}
+		return
+	}
+	if format != "" && format != "json" {
+		utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest,
+			"Invalid format, expected json or html", "invalid_request_error", "format", "")
+		return
+	}
+	writeJSON(ctx, fasthttp.StatusOK, status)
+}
+
+func (h *StatusHandler) status() *statusResponse {
+	now := time.Now()
+	status := &statusResponse{
+		Object:        "status",
+		Version:       h.version,
+		StartedAt:     h.started.UTC(),
+		UptimeSeconds: int64(now.Sub(h.started).Seconds()),
+		Policy:        h.service.PolicyName(),
+		RecentErrors:  []logger.RecentError{},
+	}
+
+	status.Workers = newPoolStatus(h.service.Workers())
+	status.InFlight.Workers = status.Workers.load()
+	for i := 0; i < h.service.GroupCount(); i++ {
+		group := groupStatus{Index: i, poolStatus: newPoolStatus(h.service.GroupWorkers(i))}
+		if i < len(h.groupLabels) {
+			group.Labels = h.groupLabels[i]
+		}
+		status.Groups = append(status.Groups, group)
+		status.InFlight.Workers += group.load()
+	}
+	status.InFlight.Streams = h.metrics.ActiveStreams()
+	if h.limiter != nil {
+		admitted, queued := h.limiter.InFlight()
+		status.InFlight.Admitted, status.InFlight.Queued = &admitted, &queued
+	}
+
+	if h.recentErrors != nil {
+		status.RecentErrors = h.recentErrors.Errors()
+	}
+	return status
+}
+
+// newPoolStatus summarizes a list of workers
+func newPoolStatus(workers []smg.WorkerStatus, err error) poolStatus {
+	if err != nil {
+		return poolStatus{Data: []smg.WorkerStatus{}, Error: err.Error()}
+	}
+	pool := poolStatus{Total: len(workers), Data: workers}
+	for _, worker := range workers {
+		if worker.Healthy {
+			pool.Healthy++
+		}
+	}
+	return pool
+}
+
+// load returns the requests in flight on the pool's workers
+func (p poolStatus) load() int {
+	var load int
+	for _, worker := range p.Data {
+		load += worker.Load
+	}
+	return load
+}
+
+// statusPage renders a statusResponse for browsers. It refreshes itself so
+// it can be left open.
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>SMG gateway status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.unhealthy { color: #b00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>SMG gateway status</h1>
+<p>Version {{.Version}}, up {{.UptimeSeconds}}s since {{.StartedAt.Format "2006-01-02 15:04:05 UTC"}}{{if .Policy}}, policy {{.Policy}}{{end}}</p>
+<p>In flight: {{.InFlight.Workers}} on workers, {{.InFlight.Streams}} streams{{if .InFlight.Admitted}}, {{.InFlight.Admitted}} admitted, {{.InFlight.Queued}} queued{{end}}</p>
+
+{{define "pool"}}
+<p>{{.Healthy}} of {{.Total}} healthy{{if .Error}} <span class="unhealthy">{{.Error}}</span>{{end}}</p>
+<table>
+<tr><th>#</th><th>Endpoint</th><th>Health</th><th>In flight</th><th>Processed</th></tr>
+{{range .Data}}<tr><td>{{.Index}}</td><td>{{.Endpoint}}</td>{{if .Healthy}}<td>healthy</td>{{else}}<td class="unhealthy">unhealthy</td>{{end}}<td>{{.Load}}</td><td>{{.ProcessedRequests}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Workers</h2>
+{{template "pool" .Workers}}
+{{range .Groups}}<h2>Group {{.Index}}{{range $k, $v := .Labels}} {{$k}}={{$v}}{{end}}</h2>
+{{template "pool" .}}
+{{end}}
+
+<h2>Recent errors</h2>
+{{if .RecentErrors}}<table>
+<tr><th>Time</th><th>Message</th><th>Details</th></tr>
+{{range .RecentErrors}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.Message}}</td><td>{{range $k, $v := .Fields}}{{$k}}={{$v}} {{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>None</p>{{end}}
+</body>
+</html>
+`))
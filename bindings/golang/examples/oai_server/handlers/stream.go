@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/accesslog"
+	"oai_server/concurrency"
+	"oai_server/requestid"
+	"oai_server/service"
+)
+
+// flushTimeout bounds a flush to a slow or disconnected client. It should be
+// longer than typical network latency but shorter than client timeouts.
+const flushTimeout = 5 * time.Second
+
+// recvResult holds the result of a RecvJSON() call
+type recvResult struct {
+	chunkJSON string
+	err       error
+}
+
+// streamEvents writes one API's server-sent events for a chat completion
+// stream. Its functions run in the body stream writer, after the handler
+// returns; pumpStream flushes after each.
+type streamEvents struct {
+	// begin writes the events preceding the first chunk; nil writes none
+	begin func(w *bufio.Writer)
+	// chunk writes the events of a chunk and returns the usage it reports,
+	// or nil
+	chunk func(w *bufio.Writer, chunkJSON string) *smg.Usage
+	// fail writes the events of a stream that failed with errInfo
+	fail func(w *bufio.Writer, errInfo StreamErrorInfo)
+	// end writes the events completing the stream
+	end func(w *bufio.Writer)
+}
+
+// pumpStream opens a chat completion stream with open and writes it to the
+// client with events. Streams the SDK fails to open are answered with
+// respondError before committing to a 200.
+//
+// The stream holds its concurrency slot, and its access log entry is
+// written, until it ends, and idle periods get heartbeat comments. The usage
+// it reports is charged to the key's token quota and its tenant and recorded
+// in metrics and the access log; if it ends early, e.g. because the client
+// disconnected, what was generated is charged instead.
+func (h *ChatHandler) pumpStream(ctx *fasthttp.RequestCtx, route service.Route, open func(context.Context) (smg.ChatStream, error), respondError func(ctx *fasthttp.RequestCtx, err error), events streamEvents) {
+	logger := h.logger.With(requestid.Field(ctx))
+
+	streamCtx, cancel := context.WithCancel(requestContext(ctx))
+	stream, err := open(streamCtx)
+	if err != nil {
+		cancel()
+		logger.Error("Failed to create stream",
+			zap.Error(err),
+			zap.String("model", route.Model),
+		)
+		respondError(ctx, err)
+		return
+	}
+	stream = h.moderateStream(ctx, streamCtx, route, stream)
+
+	ctx.SetContentType("text/event-stream")
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	ctx.Response.Header.Set("Connection", "keep-alive")
+	ctx.Response.Header.Set("X-Accel-Buffering", "no")
+	ctx.SetStatusCode(200)
+
+	streamUsage := newStreamUsage(ctx, route.Model)
+	path := string(ctx.Path())
+	start := ctx.Time()
+
+	// Stream writers run after the handler returns, so take the request ID now
+	requestID := requestid.FromContext(ctx)
+
+	releaseSlot := concurrency.Detach(ctx)
+	entry := accesslog.FromContext(ctx)
+	writeAccessLog := accesslog.Detach(ctx)
+	report := func(u *smg.Usage) {
+		if u == nil {
+			return
+		}
+		streamUsage.charge(u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		entry.PromptTokens, entry.CompletionTokens = u.PromptTokens, u.CompletionTokens
+		h.metrics.ObserveUsage(path, u.PromptTokens, u.CompletionTokens, time.Since(start))
+	}
+
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer releaseSlot()
+		defer writeAccessLog()
+		defer streamUsage.finish()
+		h.metrics.StreamStarted()
+		defer h.metrics.StreamFinished()
+		defer cancel()
+		defer func() {
+			if closeErr := stream.Close(); closeErr != nil {
+				logger.Warn("Failed to close stream", zap.Error(closeErr))
+			}
+		}()
+
+		if events.begin != nil {
+			events.begin(w)
+			if !flushWithin(w, logger) {
+				return
+			}
+		}
+
+		// Receive in a goroutine so that idle periods can be filled with
+		// heartbeats; cancelling and closing the stream on return unblocks it
+		recvChan := make(chan recvResult, 20)
+		go func() {
+			defer close(recvChan)
+			for {
+				chunkJSON, err := stream.RecvJSON()
+				select {
+				case recvChan <- recvResult{chunkJSON: chunkJSON, err: err}:
+				case <-streamCtx.Done():
+					return
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+		hb := newHeartbeat(h.heartbeatInterval)
+		defer hb.Stop()
+
+		firstChunk := true
+		for {
+			var result recvResult
+			select {
+			case <-hb.C():
+				// No chunk for a while, e.g. during a long prefill
+				w.WriteString(heartbeatComment)
+				if !flushWithin(w, logger) {
+					return
+				}
+				hb.Reset()
+				continue
+			case r, ok := <-recvChan:
+				if !ok {
+					return
+				}
+				result = r
+			}
+
+			chunkJSON, err := result.chunkJSON, result.err
+			if err == io.EOF {
+				events.end(w)
+				flushWithin(w, logger)
+				return
+			}
+			if err != nil {
+				if err == context.Canceled || err == context.DeadlineExceeded {
+					return
+				}
+				errInfo := parseStreamError(err)
+				errInfo.RequestID = requestID
+				if errInfo.IsTimeout {
+					logger.Error("Stream timeout error", zap.Error(err))
+				} else {
+					logger.Error("Stream error", zap.Error(err))
+				}
+				events.fail(w, errInfo)
+				flushWithin(w, logger)
+				return
+			}
+			if chunkJSON == "" {
+				continue
+			}
+			streamUsage.chunk()
+			if firstChunk {
+				firstChunk = false
+				h.metrics.ObserveTTFT(path, time.Since(start))
+				entry.TTFTMs = accesslog.Milliseconds(time.Since(start))
+			}
+
+			report(events.chunk(w, chunkJSON))
+			if !flushWithin(w, logger) {
+				return
+			}
+			hb.Reset()
+		}
+	})
+}
+
+// flushWithin flushes w, giving up after flushTimeout so that a client that
+// stopped reading cannot block the stream forever. It reports whether the
+// client can still be written to.
+func flushWithin(w *bufio.Writer, logger *zap.Logger) bool {
+	if w.Buffered() == 0 {
+		return true
+	}
+	// bufio.Writer.Flush has no timeout, so wait for it in a select
+	flushDone := make(chan error, 1)
+	go func() {
+		flushDone <- w.Flush()
+	}()
+	timer := time.NewTimer(flushTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-flushDone:
+		if err != nil {
+			if !isBrokenPipeError(err) {
+				logger.Warn("Flush error", zap.Error(err))
+			}
+			return false
+		}
+		return true
+	case <-timer.C:
+		logger.Warn("Flush timeout, client may be slow or disconnected", zap.Duration("timeout", flushTimeout))
+		return false
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/metrics"
+	"oai_server/service"
+)
+
+const (
+	textChunk  = `{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"delta":{"content":"Hi"}}]}`
+	finalChunk = `{"id":"chatcmpl-1","model":"m","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
+	usageChunk = `{"id":"chatcmpl-1","model":"m","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`
+)
+
+// serveStream posts body to path, served by handle with backend, and returns
+// the streamed response and the metrics it recorded
+func serveStream(backend *fakeBackend, path, body string, handle func(h *ChatHandler) fasthttp.RequestHandler) (*fasthttp.RequestCtx, string) {
+	m := metrics.New(nil)
+	h := NewChatHandler(zap.NewNop(), service.NewSMGServiceWithClient(backend, "grpc://test"), m, 0)
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI(path)
+	ctx.Request.SetBodyString(body)
+	handle(h)(&ctx)
+	// Reading the body runs the stream writer to its end
+	ctx.Response.Body()
+
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	return &ctx, b.String()
+}
+
+// eventNames returns the names of the server-sent events in body
+func eventNames(body []byte) []string {
+	var names []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TestStreamSSE tests the chat completion stream: chunks as data events,
+// the usage chunk only when asked for, errors, and usage accounting
+func TestStreamSSE(t *testing.T) {
+	chat := func(h *ChatHandler) fasthttp.RequestHandler { return h.HandleChatCompletion }
+	request := func(streamOptions string) string {
+		return `{"model":"m","messages":[{"role":"user","content":"Hi"}],"stream":true` + streamOptions + `}`
+	}
+	tests := []struct {
+		name      string
+		body      string
+		chunks    []string
+		streamErr error
+		want      string
+		wantUsage bool
+	}{
+		{
+			name:      "usage hidden",
+			body:      request(""),
+			chunks:    []string{textChunk, "", finalChunk, usageChunk},
+			want:      "data: " + textChunk + "\n\ndata: " + finalChunk + "\n\ndata: [DONE]\n\n",
+			wantUsage: true,
+		},
+		{
+			name:      "usage included",
+			body:      request(`,"stream_options":{"include_usage":true}`),
+			chunks:    []string{textChunk, usageChunk},
+			want:      "data: " + textChunk + "\n\ndata: " + usageChunk + "\n\ndata: [DONE]\n\n",
+			wantUsage: true,
+		},
+		{
+			name:      "stream error",
+			body:      request(""),
+			chunks:    []string{textChunk},
+			streamErr: errors.New("worker failed"),
+			want:      "data: " + textChunk + "\n\ndata: {\"error\":",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeBackend{chunks: tt.chunks, streamErr: tt.streamErr}
+			ctx, scraped := serveStream(backend, "/v1/chat/completions", tt.body, chat)
+			if ctx.Response.StatusCode() != fasthttp.StatusOK || string(ctx.Response.Header.ContentType()) != "text/event-stream" {
+				t.Fatalf("status %d, Content-Type %q", ctx.Response.StatusCode(), ctx.Response.Header.ContentType())
+			}
+			body := string(ctx.Response.Body())
+			if tt.streamErr != nil {
+				if !strings.HasPrefix(body, tt.want) || !strings.Contains(body, "worker failed") || strings.Contains(body, "[DONE]") {
+					t.Errorf("body = %q, want an error event after %q", body, tt.want)
+				}
+			} else if body != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+			if len(backend.requests) != 1 || backend.requests[0].StreamOptions == nil {
+				t.Errorf("requests = %+v, want one asking for usage", backend.requests)
+			}
+
+			if !strings.Contains(scraped, `smg_time_to_first_token_seconds_count{path="/v1/chat/completions"} 1`) {
+				t.Error("time to first token not recorded")
+			}
+			if got := strings.Contains(scraped, `smg_prompt_tokens_total{path="/v1/chat/completions"} 3`); got != tt.wantUsage {
+				t.Errorf("usage recorded = %v, want %v", got, tt.wantUsage)
+			}
+			if !strings.Contains(scraped, "smg_active_streams 0") {
+				t.Error("stream still counted as active")
+			}
+		})
+	}
+}
+
+// TestStreamResponses tests the Responses API events built from a stream
+func TestStreamResponses(t *testing.T) {
+	responses := func(h *ChatHandler) fasthttp.RequestHandler { return h.HandleResponses }
+	backend := &fakeBackend{chunks: []string{textChunk, finalChunk, usageChunk}}
+	ctx, scraped := serveStream(backend, "/v1/responses", `{"model":"m","input":"Hi","stream":true}`, responses)
+
+	events := eventNames(ctx.Response.Body())
+	want := []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.completed",
+	}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if !strings.Contains(string(ctx.Response.Body()), `"input_tokens":3`) {
+		t.Error("response.completed carries no usage")
+	}
+	if !strings.Contains(scraped, `smg_prompt_tokens_total{path="/v1/responses"} 3`) {
+		t.Error("usage not recorded")
+	}
+
+	// A failed stream ends with response.failed
+	backend = &fakeBackend{chunks: []string{textChunk}, streamErr: errors.New("worker failed")}
+	ctx, _ = serveStream(backend, "/v1/responses", `{"model":"m","input":"Hi","stream":true}`, responses)
+	if body := string(ctx.Response.Body()); !strings.Contains(body, "event: response.failed\n") || strings.Contains(body, "response.completed") {
+		t.Errorf("failed stream body = %q", body)
+	}
+}
+
+// TestStreamMessages tests the Messages API events built from a stream
+func TestStreamMessages(t *testing.T) {
+	messages := func(h *ChatHandler) fasthttp.RequestHandler { return h.HandleMessages }
+	body := `{"model":"m","max_tokens":10,"messages":[{"role":"user","content":"Hi"}],"stream":true}`
+	backend := &fakeBackend{chunks: []string{textChunk, finalChunk, usageChunk}}
+	ctx, scraped := serveStream(backend, "/v1/messages", body, messages)
+
+	events := eventNames(ctx.Response.Body())
+	want := []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if !strings.Contains(scraped, `smg_prompt_tokens_total{path="/v1/messages"} 3`) {
+		t.Error("usage not recorded")
+	}
+
+	// A failed stream ends with an error event
+	backend = &fakeBackend{chunks: []string{textChunk}, streamErr: errors.New("worker failed")}
+	ctx, _ = serveStream(backend, "/v1/messages", body, messages)
+	if body := string(ctx.Response.Body()); !strings.Contains(body, "event: error\n") || strings.Contains(body, "message_stop") {
+		t.Errorf("failed stream body = %q", body)
+	}
+}
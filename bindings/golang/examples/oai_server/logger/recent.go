@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// RecentError is an error logged recently
+type RecentError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	// Fields are the entry's context, such as "error" and "request_id"
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// RecentErrors is a zapcore.Core keeping the latest error-level entries in
+// memory, e.g. for a status page. Tee it with the logger's core:
+//
+//	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+//		return zapcore.NewTee(core, recent)
+//	}))
+type RecentErrors struct {
+	ring *errorRing
+	// fields are the context added by With
+	fields []zapcore.Field
+}
+
+// errorRing holds the entries of a RecentErrors and the cores derived from it
+type errorRing struct {
+	mu      sync.Mutex
+	entries []RecentError
+	// next is the index the next entry is written to once entries is full
+	next int
+	size int
+}
+
+// NewRecentErrors creates a core keeping the last size errors
+func NewRecentErrors(size int) *RecentErrors {
+	return &RecentErrors{ring: &errorRing{size: size}}
+}
+
+// Errors returns the kept errors, newest first
+func (r *RecentErrors) Errors() []RecentError {
+	ring := r.ring
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	errs := make([]RecentError, 0, len(ring.entries))
+	for i := 1; i <= len(ring.entries); i++ {
+		errs = append(errs, ring.entries[(ring.next-i+len(ring.entries))%len(ring.entries)])
+	}
+	return errs
+}
+
+// Enabled reports whether level is kept: errors and above
+func (r *RecentErrors) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+// With returns a core adding fields to the errors it keeps
+func (r *RecentErrors) With(fields []zapcore.Field) zapcore.Core {
+	return &RecentErrors{ring: r.ring, fields: append(append([]zapcore.Field(nil), r.fields...), fields...)}
+}
+
+// Check adds the core to ce if the entry is kept
+func (r *RecentErrors) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(entry.Level) {
+		return ce.AddCore(entry, r)
+	}
+	return ce
+}
+
+// Write keeps the entry
+func (r *RecentErrors) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range r.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	recent := RecentError{Time: entry.Time.UTC(), Message: entry.Message}
+	if len(enc.Fields) > 0 {
+		recent.Fields = enc.Fields
+	}
+
+	ring := r.ring
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if len(ring.entries) < ring.size {
+		ring.entries = append(ring.entries, recent)
+		ring.next = len(ring.entries) % ring.size
+		return nil
+	}
+	ring.entries[ring.next] = recent
+	ring.next = (ring.next + 1) % ring.size
+	return nil
+}
+
+// Sync does nothing; errors are kept in memory
+func (r *RecentErrors) Sync() error {
+	return nil
+}
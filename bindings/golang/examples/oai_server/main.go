@@ -2,19 +2,41 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "net/http/pprof" // Enable pprof endpoints
 
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
+	"oai_server/accesslog"
+	"oai_server/auth"
+	"oai_server/cache"
+	"oai_server/concurrency"
 	"oai_server/config"
+	"oai_server/cors"
 	"oai_server/handlers"
 	"oai_server/logger"
+	"oai_server/metrics"
+	"oai_server/moderation"
+	"oai_server/openapi"
+	"oai_server/ratelimit"
+	"oai_server/requestid"
 	"oai_server/service"
+	"oai_server/tlscert"
+	"oai_server/transform"
+	"oai_server/usage"
+	"oai_server/utils"
 )
 
 // Version information (set at build time via ldflags)
@@ -25,8 +47,15 @@ var (
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"),
+		"path to a YAML config file; environment variables override its values")
+	flag.Parse()
+
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load configuration: %v", err))
+	}
 
 	// Initialize logger
 	appLogger, err := logger.Init(cfg.LogDir, cfg.LogLevel)
@@ -35,6 +64,29 @@ func main() {
 	}
 	defer appLogger.Sync()
 
+	// Keep the latest errors for the status page
+	recentErrors := logger.NewRecentErrors(recentErrorCount)
+	appLogger = appLogger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, recentErrors)
+	}))
+
+	// Access log entries are written by the middleware installed below
+	var accessLogger *accesslog.Logger
+	if cfg.AccessLogFile != "" {
+		accessLogFile := cfg.AccessLogFile
+		if accessLogFile != "stdout" && !filepath.IsAbs(accessLogFile) {
+			accessLogFile = filepath.Join(cfg.LogDir, accessLogFile)
+		}
+		accessLogger = accesslog.New(accesslog.Options{
+			File:       accessLogFile,
+			MaxSizeMB:  cfg.AccessLogMaxSizeMB,
+			MaxBackups: cfg.AccessLogMaxBackups,
+			MaxAgeDays: cfg.AccessLogMaxAgeDays,
+		})
+		defer accessLogger.Close()
+		appLogger.Info("Access log enabled", zap.String("file", accessLogFile))
+	}
+
 	appLogger.Info("Starting OpenAI-compatible server",
 		zap.String("endpoints", cfg.Endpoints),
 		zap.String("tokenizer", cfg.TokenizerPath),
@@ -58,6 +110,29 @@ func main() {
 		appLogger.Info("SMG single-worker client created successfully")
 	}
 
+	// Labeled worker groups, added in config order so that GroupFor indices
+	// match, and the model aliases routed to them
+	for i, group := range cfg.WorkerGroups {
+		tokenizerPath := group.TokenizerPath
+		if tokenizerPath == "" {
+			tokenizerPath = cfg.TokenizerPath
+		}
+		policyName := group.Policy
+		if policyName == "" {
+			policyName = cfg.PolicyName
+		}
+		if _, err := smgService.AddWorkerGroup(strings.Join(group.Endpoints, ","), tokenizerPath, policyName); err != nil {
+			appLogger.Fatal("Failed to create worker group", zap.Int("group", i), zap.Any("labels", group.Labels), zap.Error(err))
+		}
+		appLogger.Info("Worker group created", zap.Any("labels", group.Labels), zap.Strings("endpoints", group.Endpoints))
+	}
+	if err := smgService.SetModelAliases(modelAliases(cfg)); err != nil {
+		appLogger.Fatal("Failed to set model aliases", zap.Error(err))
+	}
+	if len(cfg.ModelAliases) > 0 {
+		appLogger.Info("Model aliases configured", zap.Any("aliases", smgService.ModelAliases()))
+	}
+
 	// Enable pprof if requested
 	if os.Getenv("PPROF_ENABLED") == "true" {
 		pprofPort := os.Getenv("PPROF_PORT")
@@ -74,10 +149,82 @@ func main() {
 		appLogger.Info("pprof enabled", zap.String("port", pprofPort), zap.String("endpoint", fmt.Sprintf("http://localhost:%s/debug/pprof/", pprofPort)))
 	}
 
+	// Worker health is read from the client on every scrape
+	serverMetrics := metrics.New(func() (int, int) {
+		return smgService.WorkerCount(), smgService.ChatClient().HealthyWorkerCount()
+	})
+
 	// Initialize handlers
-	healthHandler := handlers.NewHealthHandler(appLogger)
-	modelsHandler := handlers.NewModelsHandler(appLogger, cfg.TokenizerPath)
-	chatHandler := handlers.NewChatHandler(appLogger, smgService)
+	healthHandler := handlers.NewHealthHandler(appLogger, smgService)
+	modelsHandler := handlers.NewModelsHandler(appLogger, cfg.TokenizerPath, smgService)
+	chatHandler := handlers.NewChatHandler(appLogger, smgService, serverMetrics, cfg.SSEHeartbeatInterval)
+
+	// Content moderation through an HTTP service. Programs embedding the
+	// server may use an in-process moderation.Func instead.
+	var moderator moderation.Moderator
+	if cfg.ModerationURL != "" {
+		moderator = moderation.NewHTTPModerator(cfg.ModerationURL, cfg.ModerationAPIKey, cfg.ModerationTimeout)
+	}
+	var moderationChecker *moderation.Checker
+	if moderator != nil {
+		moderationChecker = &moderation.Checker{Moderator: moderator, FailOpen: cfg.ModerationFailOpen, Logger: appLogger}
+		if strings.Contains(cfg.ModerationStages, "output") {
+			chatHandler.SetOutputModeration(moderationChecker, cfg.ModerationStreamWindow)
+		}
+		appLogger.Info("Content moderation enabled",
+			zap.String("stages", cfg.ModerationStages),
+			zap.Bool("fail_open", cfg.ModerationFailOpen),
+		)
+	}
+
+	// Token usage per key and tenant, with optional monthly tenant ceilings
+	tenantLimits, err := usage.ParseLimits(cfg.TenantMonthlyTokens)
+	if err != nil {
+		appLogger.Fatal("Invalid tenant token limits", zap.Error(err))
+	}
+	usageTracker := usage.NewTracker(tenantLimits)
+	usageHandler := auth.RequireAdmin(usage.Handler(usageTracker))
+
+	// Periodic usage records for billing, to a file or an HTTP service
+	var usageExporter *usage.Exporter
+	if cfg.UsageExportTarget != "" {
+		prices, err := usage.ParsePrices(cfg.UsagePrices)
+		if err != nil {
+			appLogger.Fatal("Invalid usage prices", zap.Error(err))
+		}
+		var sink usage.Sink = usage.NewFileSink(cfg.UsageExportTarget, cfg.UsageExportFormat)
+		if strings.HasPrefix(cfg.UsageExportTarget, "http://") || strings.HasPrefix(cfg.UsageExportTarget, "https://") {
+			sink = usage.NewHTTPSink(cfg.UsageExportTarget, cfg.UsageExportAPIKey, cfg.UsageExportFormat, usageExportTimeout)
+		}
+		usageExporter = usage.NewExporter(usageTracker, sink, prices, appLogger)
+		exportCtx, stopExport := context.WithCancel(context.Background())
+		defer stopExport()
+		go usageExporter.Run(exportCtx, cfg.UsageExportInterval)
+		appLogger.Info("Usage export enabled",
+			zap.String("format", cfg.UsageExportFormat),
+			zap.Duration("interval", cfg.UsageExportInterval),
+			zap.Int("prices", len(prices)),
+		)
+	}
+
+	// Worker management for multi-worker setups; drains default to the
+	// shutdown drain timeout
+	adminHandler := handlers.NewAdminHandler(appLogger, smgService, cfg.DrainTimeout)
+	adminWorkersHandler := auth.RequireAdmin(adminHandler.HandleWorkers)
+
+	// Fleet summary for on-call, as JSON or an HTML page
+	statusHandler := handlers.NewStatusHandler(appLogger, smgService, serverMetrics, recentErrors, Version)
+	groupLabels := make([]map[string]string, len(cfg.WorkerGroups))
+	for i, group := range cfg.WorkerGroups {
+		groupLabels[i] = group.Labels
+	}
+	statusHandler.SetGroupLabels(groupLabels)
+	adminStatusHandler := auth.RequireAdmin(statusHandler.Handle)
+
+	// Describe the client-facing endpoints so that clients can generate SDKs
+	authEnabled := cfg.APIKeys != "" || cfg.AdminAPIKeys != "" || cfg.APIKeysFile != "" || cfg.APIKeysDir != ""
+	apiDoc := openapi.Build(Version, authEnabled)
+	openAPIHandler := apiDoc.Handler()
 
 	// Setup fasthttp router
 	router := func(ctx *fasthttp.RequestCtx) {
@@ -85,24 +232,203 @@ func main() {
 		method := string(ctx.Method())
 
 		switch {
-		case method == "GET" && path == "/health":
+		case method == "GET" && (path == "/health" || path == "/healthz"):
 			healthHandler.Check(ctx)
+		case method == "GET" && path == "/readyz":
+			healthHandler.Ready(ctx)
+		case method == "GET" && path == "/metrics":
+			serverMetrics.Handler(ctx)
+		case method == "GET" && path == "/openapi.json":
+			openAPIHandler(ctx)
 		case method == "GET" && path == "/v1/models":
 			modelsHandler.List(ctx)
+		case method == "GET" && path == "/v1/usage":
+			usageHandler(ctx)
 		case method == "GET" && path == "/get_model_info":
 			modelsHandler.GetModelInfo(ctx)
 		case method == "POST" && path == "/v1/chat/completions":
 			chatHandler.HandleChatCompletion(ctx)
+		case method == "POST" && path == "/v1/completions":
+			chatHandler.HandleCompletion(ctx)
+		case method == "POST" && path == "/v1/embeddings":
+			chatHandler.HandleEmbeddings(ctx)
+		case method == "POST" && path == "/v1/responses":
+			chatHandler.HandleResponses(ctx)
+		case method == "POST" && path == "/v1/messages" && cfg.AnthropicMessages:
+			chatHandler.HandleMessages(ctx)
 		case (method == "POST" || method == "PUT") && path == "/generate":
 			chatHandler.HandleGenerate(ctx)
+		case method == "GET" && path == "/admin/status":
+			adminStatusHandler(ctx)
+		case path == "/admin/workers" || strings.HasPrefix(path, "/admin/workers/"):
+			adminWorkersHandler(ctx)
 		default:
-			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusNotFound,
+				fmt.Sprintf("Unknown request URL: %s %s.", method, path), "invalid_request_error", "", "unknown_url")
 		}
 	}
 
+	// Serve repeated deterministic requests from memory. This runs inside
+	// the policies so that rewritten requests are what is matched.
+	handler := fasthttp.RequestHandler(router)
+	if cfg.ResponseCacheTTL > 0 {
+		handler = cache.Middleware(cache.New(cfg.ResponseCacheTTL, cfg.ResponseCacheMaxEntries), serverMetrics, handler)
+		appLogger.Info("Response cache enabled",
+			zap.Duration("ttl", cfg.ResponseCacheTTL),
+			zap.Int("max_entries", cfg.ResponseCacheMaxEntries),
+		)
+	}
+
+	// Rewrite requests by their tenant's policy, inside auth so that the
+	// tenant is known. Policies are replaced on configuration reloads.
+	policies := transform.NewPolicies(requestPolicies(cfg))
+	handler = transform.Middleware(policies, appLogger, handler)
+	if len(cfg.Policies) > 0 {
+		appLogger.Info("Request policies enabled", zap.Int("tenants", len(cfg.Policies)))
+	}
+
+	// Moderate what clients wrote, before policies add to it
+	if moderationChecker != nil && strings.Contains(cfg.ModerationStages, "input") {
+		handler = moderation.Middleware(moderationChecker, handler)
+	}
+
+	// Reject requests the OpenAPI document does not allow before any work
+	// is spent on them
+	if cfg.OpenAPIValidate {
+		handler = openapi.Middleware(apiDoc, handler)
+		appLogger.Info("OpenAPI request validation enabled")
+	}
+
+	// Cap the inference requests in flight. This runs inside auth so that
+	// per-key caps see the key, and after the rate limits so that rejected
+	// requests never hold a slot.
+	concurrencyLimits := concurrency.Limits{
+		MaxInFlight:       cfg.MaxInFlight,
+		MaxInFlightPerKey: cfg.MaxInFlightPerKey,
+		QueueSize:         cfg.ConcurrencyQueueSize,
+		QueueTimeout:      cfg.ConcurrencyQueueTimeout,
+	}
+	if concurrencyLimits.Enabled() {
+		limiter := concurrency.NewLimiter(concurrencyLimits)
+		statusHandler.SetLimiter(limiter)
+		handler = concurrency.Middleware(limiter, []string{
+			"/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/responses", "/v1/messages", "/generate",
+		}, appLogger, handler)
+		appLogger.Info("Concurrency limits enabled",
+			zap.Int("max_in_flight", concurrencyLimits.MaxInFlight),
+			zap.Int("max_in_flight_per_key", concurrencyLimits.MaxInFlightPerKey),
+			zap.Int("queue_size", concurrencyLimits.QueueSize),
+			zap.Duration("queue_timeout", concurrencyLimits.QueueTimeout),
+		)
+	}
+
+	// Require API keys if any are configured. Keys and default limits are
+	// replaced on configuration reloads.
+	var keyStore *auth.ReloadableKeyStore
+	var rateLimits *ratelimit.DefaultLimits
+	if authEnabled {
+		keys, err := auth.LoadKeys(cfg.APIKeys, cfg.AdminAPIKeys, cfg.APIKeysFile, cfg.APIKeysDir)
+		if err != nil {
+			appLogger.Fatal("Failed to load API keys", zap.Error(err))
+		}
+		keyStore = auth.NewReloadableKeyStore(keys)
+		rateLimits = ratelimit.NewDefaultLimits(ratelimit.Limits{
+			RequestsPerMinute: cfg.RateLimitRPM,
+			TokensPerDay:      cfg.TokenQuotaPerDay,
+		})
+		// Limits apply per authenticated key, so the limiter and usage
+		// tracking run inside auth
+		handler = usage.Middleware(usageTracker, appLogger, handler)
+		handler = ratelimit.Middleware(ratelimit.NewMemoryLimiter(), rateLimits, appLogger, handler)
+		handler = auth.Middleware(keyStore, appLogger, handler)
+		appLogger.Info("API key authentication enabled",
+			zap.Int("keys", keyStore.Len()),
+			zap.Int("rate_limit_rpm", cfg.RateLimitRPM),
+			zap.Int("token_quota_per_day", cfg.TokenQuotaPerDay),
+			zap.Int("tenant_limits", len(tenantLimits)),
+		)
+	}
+
+	// CORS runs before authentication: browsers send preflight requests
+	// without credentials
+	if cfg.CORSAllowedOrigins != "" {
+		corsConfig := cors.DefaultConfig(cors.SplitList(cfg.CORSAllowedOrigins))
+		if cfg.CORSAllowedMethods != "" {
+			corsConfig.AllowedMethods = cors.SplitList(cfg.CORSAllowedMethods)
+		}
+		if cfg.CORSAllowedHeaders != "" {
+			corsConfig.AllowedHeaders = cors.SplitList(cfg.CORSAllowedHeaders)
+		}
+		handler = cors.Middleware(corsConfig, handler)
+		appLogger.Info("CORS enabled", zap.Strings("origins", corsConfig.AllowedOrigins))
+	}
+
+	// Count every response, including auth, rate limit, and CORS rejections
+	handler = metrics.Middleware(serverMetrics, []string{
+		"/health", "/healthz", "/readyz", "/metrics", "/openapi.json",
+		"/v1/models", "/v1/usage", "/get_model_info",
+		"/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/responses", "/v1/messages", "/generate",
+		"/admin/status", "/admin/workers",
+	}, handler)
+
+	// Log every response, including rejections, with its request ID
+	if accessLogger != nil {
+		handler = accesslog.Middleware(accessLogger, appLogger, handler)
+	}
+
+	// Assign request IDs outermost so every response, including auth and
+	// rate limit errors, carries one
+	handler = requestid.Middleware(handler)
+
+	server := &fasthttp.Server{
+		Handler:            handler,
+		MaxRequestBodySize: cfg.MaxRequestBodyBytes,
+		// Report unreadable requests, such as oversized bodies, as JSON errors
+		ErrorHandler: utils.ServerErrorHandler(cfg.MaxRequestBodyBytes),
+		// Idle keep-alive connections would otherwise hold shutdown open
+		IdleTimeout: idleTimeout,
+	}
+
+	// Apply configuration changes on SIGHUP and, if enabled, when the config
+	// or API key file changes
+	reloader := newConfigReloader(*configPath, cfg, appLogger, smgService, keyStore, rateLimits, usageTracker, policies)
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go func() {
+		for range reloadSignals {
+			reloader.ReloadAndLog("SIGHUP")
+		}
+	}()
+	if cfg.ConfigReloadInterval > 0 {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go reloader.Watch(watchCtx, cfg.ConfigReloadInterval)
+		appLogger.Info("Configuration reloading enabled", zap.Duration("interval", cfg.ConfigReloadInterval))
+	}
+
+	// Serve HTTPS when a certificate is configured
+	scheme := "http"
+	if cfg.TLSCertFile != "" {
+		certs, err := tlscert.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, appLogger)
+		if err != nil {
+			appLogger.Fatal("Failed to load TLS certificate", zap.Error(err))
+		}
+		server.TLSConfig = certs.TLSConfig()
+		if cfg.TLSReloadInterval > 0 {
+			watchCtx, stopWatch := context.WithCancel(context.Background())
+			defer stopWatch()
+			go certs.Watch(watchCtx, cfg.TLSReloadInterval)
+		}
+		scheme = "https"
+		appLogger.Info("TLS enabled",
+			zap.String("cert_file", cfg.TLSCertFile),
+			zap.Duration("reload_interval", cfg.TLSReloadInterval),
+		)
+	}
+
 	// Start server
 	serverAddr := ":" + cfg.Port
-	baseURL := fmt.Sprintf("http://localhost:%s", cfg.Port)
+	baseURL := fmt.Sprintf("%s://localhost:%s", scheme, cfg.Port)
 
 	appLogger.Info("Server starting",
 		zap.String("address", serverAddr),
@@ -112,13 +438,80 @@ func main() {
 	// Print available HTTP endpoints (similar to FastAPI startup)
 	appLogger.Info("Available HTTP endpoints:")
 	appLogger.Info(fmt.Sprintf("  GET  %s/health", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/healthz", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/readyz", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/metrics", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/openapi.json", baseURL))
 	appLogger.Info(fmt.Sprintf("  GET  %s/v1/models", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/v1/usage", baseURL))
 	appLogger.Info(fmt.Sprintf("  GET  %s/get_model_info", baseURL))
 	appLogger.Info(fmt.Sprintf("  POST %s/v1/chat/completions", baseURL))
+	appLogger.Info(fmt.Sprintf("  POST %s/v1/completions", baseURL))
+	appLogger.Info(fmt.Sprintf("  POST %s/v1/embeddings", baseURL))
+	appLogger.Info(fmt.Sprintf("  POST %s/v1/responses", baseURL))
+	if cfg.AnthropicMessages {
+		appLogger.Info(fmt.Sprintf("  POST %s/v1/messages", baseURL))
+	}
 	appLogger.Info(fmt.Sprintf("  POST %s/generate", baseURL))
+	appLogger.Info(fmt.Sprintf("  GET  %s/admin/status", baseURL))
+	if smgService.WorkerManager() != nil {
+		appLogger.Info(fmt.Sprintf("  GET  %s/admin/workers (and POST, DELETE /{i}, POST /{i}/drain, GET|PUT /{i}/health)", baseURL))
+	}
 	appLogger.Info(fmt.Sprintf("Application startup complete. Listening on %s", baseURL))
 
-	if err := fasthttp.ListenAndServe(serverAddr, router); err != nil {
-		appLogger.Fatal("Server failed", zap.Error(err))
+	serverErr := make(chan error, 1)
+	go func() {
+		if scheme == "https" {
+			// The certificate comes from server.TLSConfig
+			serverErr <- server.ListenAndServeTLS(serverAddr, "", "")
+			return
+		}
+		serverErr <- server.ListenAndServe(serverAddr)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			appLogger.Fatal("Server failed", zap.Error(err))
+		}
+	case sig := <-signals:
+		// Stop accepting connections and let in-flight requests, including
+		// SSE streams, finish before the deferred smgService.Close() runs
+		appLogger.Info("Shutting down, draining active requests",
+			zap.String("signal", sig.String()),
+			zap.Int("open_connections", int(server.GetOpenConnectionsCount())),
+			zap.Duration("drain_timeout", cfg.DrainTimeout),
+		)
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		defer cancel()
+		if err := server.ShutdownWithContext(drainCtx); err != nil {
+			appLogger.Warn("Drain timeout reached, closing remaining connections",
+				zap.Error(err),
+				zap.Int("open_connections", int(server.GetOpenConnectionsCount())),
+			)
+		} else {
+			appLogger.Info("All requests drained")
+		}
+	}
+
+	// Export the usage of the last, partial period
+	if usageExporter != nil {
+		exportCtx, cancel := context.WithTimeout(context.Background(), usageExportTimeout)
+		defer cancel()
+		if err := usageExporter.Export(exportCtx); err != nil {
+			appLogger.Error("Failed to export usage on shutdown", zap.Error(err))
+		}
 	}
 }
+
+// idleTimeout closes keep-alive connections that have no request in flight
+const idleTimeout = 60 * time.Second
+
+// usageExportTimeout bounds each usage export to an HTTP service
+const usageExportTimeout = 30 * time.Second
+
+// recentErrorCount is how many errors the status page shows
+const recentErrorCount = 50
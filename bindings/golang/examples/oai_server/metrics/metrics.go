@@ -0,0 +1,273 @@
+// Package metrics collects server metrics and serves them in the Prometheus
+// text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default histogram buckets
+var (
+	// durationBuckets covers request durations and time to first token, in seconds
+	durationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	// throughputBuckets covers per-request output tokens per second
+	throughputBuckets = []float64{1, 5, 10, 20, 30, 50, 75, 100, 150, 200, 300, 500}
+)
+
+// Metrics holds the server's metrics. All methods are safe for concurrent use
+// and are no-ops on a nil *Metrics.
+type Metrics struct {
+	httpRequests     *counterVec
+	httpDuration     *histogramVec
+	ttft             *histogramVec
+	tokensPerSecond  *histogramVec
+	promptTokens     *counterVec
+	completionTokens *counterVec
+	cacheLookups     *counterVec
+	activeStreams    int64
+
+	// workers reports total and healthy workers at scrape time
+	workers func() (total, healthy int)
+}
+
+// New creates an empty set of metrics. workers, if non-nil, is called on each
+// scrape to report worker health.
+func New(workers func() (total, healthy int)) *Metrics {
+	return &Metrics{
+		httpRequests: newCounterVec("smg_http_requests_total",
+			"HTTP requests by method, path, and status code.", "method", "path", "status"),
+		httpDuration: newHistogramVec("smg_http_request_duration_seconds",
+			"Time until the handler returned; for streams, until the response headers were written.", durationBuckets, "path"),
+		ttft: newHistogramVec("smg_time_to_first_token_seconds",
+			"Time from request start to the first streamed chunk.", durationBuckets, "path"),
+		tokensPerSecond: newHistogramVec("smg_output_tokens_per_second",
+			"Completion tokens per second per request, including time to first token.", throughputBuckets, "path"),
+		promptTokens: newCounterVec("smg_prompt_tokens_total",
+			"Prompt tokens processed.", "path"),
+		completionTokens: newCounterVec("smg_completion_tokens_total",
+			"Completion tokens generated.", "path"),
+		cacheLookups: newCounterVec("smg_response_cache_lookups_total",
+			"Cacheable requests by path and result: hit, miss, or bypass.", "path", "result"),
+		workers: workers,
+	}
+}
+
+// ObserveRequest records a finished HTTP request
+func (m *Metrics) ObserveRequest(method, path string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequests.add(1, method, path, strconv.Itoa(status))
+	m.httpDuration.observe(duration.Seconds(), path)
+}
+
+// ObserveTTFT records the time to the first streamed chunk of a request
+func (m *Metrics) ObserveTTFT(path string, ttft time.Duration) {
+	if m == nil {
+		return
+	}
+	m.ttft.observe(ttft.Seconds(), path)
+}
+
+// ObserveUsage records the token usage of a completed request that took
+// duration to generate
+func (m *Metrics) ObserveUsage(path string, promptTokens, completionTokens int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.promptTokens.add(float64(promptTokens), path)
+	m.completionTokens.add(float64(completionTokens), path)
+	if completionTokens > 0 && duration > 0 {
+		m.tokensPerSecond.observe(float64(completionTokens)/duration.Seconds(), path)
+	}
+}
+
+// ObserveCacheLookup records whether a cacheable request was served from the
+// response cache
+func (m *Metrics) ObserveCacheLookup(path, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.add(1, path, result)
+}
+
+// StreamStarted increments the number of active SSE streams
+func (m *Metrics) StreamStarted() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.activeStreams, 1)
+}
+
+// StreamFinished decrements the number of active SSE streams
+func (m *Metrics) StreamFinished() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.activeStreams, -1)
+}
+
+// ActiveStreams returns the number of SSE streams currently open
+func (m *Metrics) ActiveStreams() int {
+	if m == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&m.activeStreams))
+}
+
+// WriteTo writes all metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.httpRequests.write(&b)
+	m.httpDuration.write(&b)
+	m.ttft.write(&b)
+	m.tokensPerSecond.write(&b)
+	m.promptTokens.write(&b)
+	m.completionTokens.write(&b)
+	m.cacheLookups.write(&b)
+	writeGauge(&b, "smg_active_streams", "SSE streams currently open.", float64(atomic.LoadInt64(&m.activeStreams)))
+	if m.workers != nil {
+		total, healthy := m.workers()
+		writeGauge(&b, "smg_workers", "Configured workers.", float64(total))
+		writeGauge(&b, "smg_healthy_workers", "Workers currently healthy.", float64(healthy))
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// counterVec is a counter partitioned by labels
+type counterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	key := formatLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram partitioned by labels
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogramVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		labels := append(append([]string(nil), h.labels...), "le")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values := append(append([]string(nil), s.labelValues...), formatValue(bound))
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), cumulative)
+		}
+		values := append(append([]string(nil), s.labelValues...), "+Inf")
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, formatLabels(labels, values), s.count)
+		plain := formatLabels(h.labels, s.labelValues)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, plain, formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, plain, s.count)
+	}
+}
+
+func writeGauge(b *strings.Builder, name, help string, v float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatValue(v))
+}
+
+// formatLabels renders {name="value",...}, or "" when there are no labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteTo tests the exposition of every metric against
+// testdata/metrics.golden: label order and escaping, cumulative buckets with
+// inclusive upper bounds, and the worker gauges
+func TestWriteTo(t *testing.T) {
+	m := New(func() (int, int) { return 3, 2 })
+	m.ObserveRequest("POST", "/v1/chat/completions", 200, 300*time.Millisecond)
+	m.ObserveRequest("POST", "/v1/chat/completions", 200, 20*time.Second)
+	m.ObserveRequest("GET", "/v1/models", 404, 0)
+	// 40 tokens in 2s fall on the 20 tokens/s bound
+	m.ObserveUsage("/v1/chat/completions", 10, 40, 2*time.Second)
+	m.ObserveCacheLookup("/v1/chat/completions", "hit")
+	m.ObserveCacheLookup(`a"b\c`, "miss")
+	m.StreamStarted()
+	m.StreamStarted()
+	m.StreamFinished()
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != b.Len() {
+		t.Errorf("WriteTo() = %d, wrote %d bytes", n, b.Len())
+	}
+	want, err := os.ReadFile("testdata/metrics.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != string(want) {
+		t.Errorf("WriteTo() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestWriteToWithoutWorkers tests that the worker gauges are omitted without
+// a workers function
+func TestWriteToWithoutWorkers(t *testing.T) {
+	var b strings.Builder
+	New(nil).WriteTo(&b)
+	if strings.Contains(b.String(), "smg_workers") || !strings.HasSuffix(b.String(), "smg_active_streams 0\n") {
+		t.Errorf("WriteTo() wrote:\n%s", b.String())
+	}
+}
+
+// TestNilMetrics tests that recording on nil metrics is a no-op
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("GET", "/", 200, time.Second)
+	m.ObserveTTFT("/", time.Second)
+	m.ObserveUsage("/", 1, 1, time.Second)
+	m.ObserveCacheLookup("/", "hit")
+	m.StreamStarted()
+	m.StreamFinished()
+	if m.ActiveStreams() != 0 {
+		t.Errorf("ActiveStreams() = %d, want 0", m.ActiveStreams())
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Middleware records the count, status, and duration of every request. Paths
+// not in paths are recorded as "other" to bound label cardinality.
+func Middleware(m *Metrics, paths []string, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	known := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		known[p] = true
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+
+		path := string(ctx.Path())
+		if !known[path] {
+			path = "other"
+		}
+		m.ObserveRequest(string(ctx.Method()), path, ctx.Response.StatusCode(), time.Since(start))
+	}
+}
+
+// Handler serves GET /metrics
+func (m *Metrics) Handler(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(ctx)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// TestMiddleware tests that requests are counted by method, path and status,
+// with unknown paths folded into "other"
+func TestMiddleware(t *testing.T) {
+	m := New(nil)
+	handler := Middleware(m, []string{"/v1/chat/completions", "/health"}, func(ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) != "/health" {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	})
+	requests := []struct{ method, uri string }{
+		{"POST", "/v1/chat/completions"},
+		{"POST", "/v1/chat/completions?stream=true"},
+		{"GET", "/health"},
+		{"GET", "/v1/chat/completions/123"},
+		{"GET", "/admin"},
+		{"PUT", "/admin"},
+	}
+	for _, r := range requests {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(r.method)
+		ctx.Request.SetRequestURI(r.uri)
+		handler(&ctx)
+	}
+
+	want := map[string]float64{
+		`{method="POST",path="/v1/chat/completions",status="404"}`: 2,
+		`{method="GET",path="/health",status="200"}`:               1,
+		`{method="GET",path="other",status="404"}`:                 2,
+		`{method="PUT",path="other",status="404"}`:                 1,
+	}
+	got := m.httpRequests.values
+	if len(got) != len(want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+	for key, n := range want {
+		if got[key] != n {
+			t.Errorf("requests%s = %v, want %v", key, got[key], n)
+		}
+	}
+	if len(m.httpDuration.series) != 3 {
+		t.Errorf("duration series = %d, want one per path", len(m.httpDuration.series))
+	}
+}
+
+// TestHandler tests that /metrics is served in the text exposition format
+func TestHandler(t *testing.T) {
+	var ctx fasthttp.RequestCtx
+	New(nil).Handler(&ctx)
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Errorf("status %d, want 200", ctx.Response.StatusCode())
+	}
+	if ct := string(ctx.Response.Header.ContentType()); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if len(ctx.Response.Body()) == 0 {
+		t.Error("empty body")
+	}
+}
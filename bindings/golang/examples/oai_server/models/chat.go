@@ -21,9 +21,18 @@ type ChatRequest struct {
 	TopK                *int                     `json:"top_k,omitempty"`
 	MinP                *float64                 `json:"min_p,omitempty"`
 	RepetitionPenalty   *float64                 `json:"repetition_penalty,omitempty"`
+	// ContinueFinalMessage continues the final assistant message instead of
+	// starting a new turn
+	ContinueFinalMessage bool `json:"continue_final_message,omitempty"`
 }
 
 // StreamOptions represents streaming options (e.g., include_usage)
 type StreamOptions struct {
 	IncludeUsage *bool `json:"include_usage,omitempty"`
 }
+
+// WantsUsage reports whether the client asked for a final usage chunk. It is
+// safe to call on nil options.
+func (o *StreamOptions) WantsUsage() bool {
+	return o != nil && o.IncludeUsage != nil && *o.IncludeUsage
+}
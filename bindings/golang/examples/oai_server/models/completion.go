@@ -0,0 +1,24 @@
+package models
+
+// CompletionRequest represents an OpenAI-compatible legacy completion request
+type CompletionRequest struct {
+	Model             string         `json:"model" binding:"required"`
+	Prompt            interface{}    `json:"prompt" binding:"required"`
+	Echo              bool           `json:"echo,omitempty"`
+	Stream            bool           `json:"stream,omitempty"`
+	StreamOptions     *StreamOptions `json:"stream_options,omitempty"`
+	Temperature       *float64       `json:"temperature,omitempty"`
+	TopP              *float64       `json:"top_p,omitempty"`
+	MaxTokens         *int           `json:"max_tokens,omitempty"`
+	IgnoreEos         bool           `json:"ignore_eos,omitempty"`
+	NoStopTrim        bool           `json:"no_stop_trim,omitempty"`
+	StopTokenIDs      []int          `json:"stop_token_ids,omitempty"`
+	Stop              interface{}    `json:"stop,omitempty"`
+	FrequencyPenalty  *float64       `json:"frequency_penalty,omitempty"`
+	PresencePenalty   *float64       `json:"presence_penalty,omitempty"`
+	TopK              *int           `json:"top_k,omitempty"`
+	MinP              *float64       `json:"min_p,omitempty"`
+	RepetitionPenalty *float64       `json:"repetition_penalty,omitempty"`
+	Seed              *int           `json:"seed,omitempty"`
+	User              string         `json:"user,omitempty"`
+}
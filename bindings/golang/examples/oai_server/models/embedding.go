@@ -0,0 +1,9 @@
+package models
+
+// EmbeddingRequest represents an OpenAI-compatible embeddings request
+type EmbeddingRequest struct {
+	Model          string      `json:"model" binding:"required"`
+	Input          interface{} `json:"input" binding:"required"`
+	EncodingFormat string      `json:"encoding_format,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
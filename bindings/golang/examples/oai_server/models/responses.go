@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ResponsesRequest represents an OpenAI Responses API request
+type ResponsesRequest struct {
+	Model string `json:"model" binding:"required"`
+	// Input is a string or an array of input items
+	Input        json.RawMessage `json:"input" binding:"required"`
+	Instructions string          `json:"instructions,omitempty"`
+	Tools        []ResponseTool  `json:"tools,omitempty"`
+	// ToolChoice is "auto", "none", "required", or {"type": "function", "name": ...}
+	ToolChoice         interface{}       `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	MaxOutputTokens    *int              `json:"max_output_tokens,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Store              *bool             `json:"store,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	User               string            `json:"user,omitempty"`
+}
+
+// ResponseInputItem is an item of a Responses API input array: a message,
+// a function call made by the model, or the output of such a call
+type ResponseInputItem struct {
+	// Type is "message" (the default), "function_call", or "function_call_output"
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id,omitempty"`
+
+	// Message fields. Content is a string or an array of content parts.
+	Role    string      `json:"role,omitempty"`
+	Content interface{} `json:"content,omitempty"`
+
+	// Function call fields
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// ResponseTool is a tool the model may call. Only function tools are
+// supported.
+type ResponseTool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Strict      *bool                  `json:"strict,omitempty"`
+}
+
+// InputItems returns the request input as items. A string input is a single
+// user message.
+func (r *ResponsesRequest) InputItems() ([]ResponseInputItem, *ValidationError) {
+	raw := strings.TrimSpace(string(r.Input))
+	if raw == "" || raw == "null" {
+		return nil, invalidParam("input", "input is required")
+	}
+	if strings.HasPrefix(raw, `"`) {
+		var text string
+		if err := json.Unmarshal(r.Input, &text); err != nil {
+			return nil, invalidParam("input", "input must be a string or an array of input items")
+		}
+		return []ResponseInputItem{{Type: "message", Role: "user", Content: text}}, nil
+	}
+
+	var items []ResponseInputItem
+	if err := json.Unmarshal(r.Input, &items); err != nil {
+		return nil, invalidParam("input", "input must be a string or an array of input items")
+	}
+	if len(items) == 0 {
+		return nil, invalidParam("input", "input must contain at least one item")
+	}
+	for i := range items {
+		if items[i].Type == "" {
+			items[i].Type = "message"
+		}
+	}
+	return items, nil
+}
+
+// ContentText returns the text of a message item, joining text parts with
+// newlines. It reports false if the content has a part that is not text.
+func (it *ResponseInputItem) ContentText() (string, bool) {
+	switch content := it.Content.(type) {
+	case nil:
+		return "", true
+	case string:
+		return content, true
+	case []interface{}:
+		texts := make([]string, 0, len(content))
+		for _, p := range content {
+			part, ok := p.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			switch part["type"] {
+			case "input_text", "output_text", "text":
+			default:
+				return "", false
+			}
+			text, ok := part["text"].(string)
+			if !ok {
+				return "", false
+			}
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, "\n"), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,251 @@
+package models
+
+import "fmt"
+
+// chatRoles are the message roles accepted in chat requests
+var chatRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+	"function":  true,
+}
+
+// ValidationError describes an invalid request parameter
+type ValidationError struct {
+	// Param is the offending parameter, e.g. "messages[2].role"
+	Param   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func invalidParam(param, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Param: param, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks the messages and sampling parameters of the request
+func (r *ChatRequest) Validate() *ValidationError {
+	if len(r.Messages) == 0 {
+		return invalidParam("messages", "messages must contain at least one message")
+	}
+	for i, msg := range r.Messages {
+		role, ok := msg["role"]
+		if !ok || role == "" {
+			return invalidParam(fmt.Sprintf("messages[%d].role", i), "Message role is required and cannot be empty")
+		}
+		if !chatRoles[role] {
+			return invalidParam(fmt.Sprintf("messages[%d].role", i),
+				"Invalid role %q, expected one of system, developer, user, assistant, tool, function", role)
+		}
+	}
+
+	if err := validateSampling(samplingParams{
+		temperature:       r.Temperature,
+		topP:              r.TopP,
+		maxTokens:         r.MaxTokens,
+		frequencyPenalty:  r.FrequencyPenalty,
+		presencePenalty:   r.PresencePenalty,
+		topK:              r.TopK,
+		minP:              r.MinP,
+		repetitionPenalty: r.RepetitionPenalty,
+		stop:              r.Stop,
+		stopTokenIDs:      r.StopTokenIDs,
+	}); err != nil {
+		return err
+	}
+	if r.MaxCompletionTokens != nil && *r.MaxCompletionTokens < 1 {
+		return invalidParam("max_completion_tokens", "max_completion_tokens must be at least 1, got %d", *r.MaxCompletionTokens)
+	}
+	if r.StreamOptions != nil && !r.Stream {
+		return invalidParam("stream_options", "stream_options is only allowed when stream is true")
+	}
+	if r.ContinueFinalMessage && r.Messages[len(r.Messages)-1]["role"] != "assistant" {
+		return invalidParam("continue_final_message", "continue_final_message requires the last message to be from the assistant")
+	}
+	return nil
+}
+
+// Validate checks the sampling parameters of the request. The prompt is
+// checked by the handler, which also extracts it.
+func (r *CompletionRequest) Validate() *ValidationError {
+	if err := validateSampling(samplingParams{
+		temperature:       r.Temperature,
+		topP:              r.TopP,
+		maxTokens:         r.MaxTokens,
+		frequencyPenalty:  r.FrequencyPenalty,
+		presencePenalty:   r.PresencePenalty,
+		topK:              r.TopK,
+		minP:              r.MinP,
+		repetitionPenalty: r.RepetitionPenalty,
+		stop:              r.Stop,
+		stopTokenIDs:      r.StopTokenIDs,
+	}); err != nil {
+		return err
+	}
+	if r.StreamOptions != nil && !r.Stream {
+		return invalidParam("stream_options", "stream_options is only allowed when stream is true")
+	}
+	return nil
+}
+
+// samplingParams are the parameters shared by chat and completion requests
+type samplingParams struct {
+	temperature       *float64
+	topP              *float64
+	maxTokens         *int
+	frequencyPenalty  *float64
+	presencePenalty   *float64
+	topK              *int
+	minP              *float64
+	repetitionPenalty *float64
+	stop              interface{}
+	stopTokenIDs      []int
+}
+
+// validateSampling checks parameter ranges against what the backend accepts
+func validateSampling(p samplingParams) *ValidationError {
+	if err := checkRange("temperature", p.temperature, 0, 2); err != nil {
+		return err
+	}
+	if p.topP != nil && (*p.topP <= 0 || *p.topP > 1) {
+		return invalidParam("top_p", "top_p must be in (0, 1], got %v", *p.topP)
+	}
+	if p.maxTokens != nil && *p.maxTokens < 1 {
+		return invalidParam("max_tokens", "max_tokens must be at least 1, got %d", *p.maxTokens)
+	}
+	if err := checkRange("frequency_penalty", p.frequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkRange("presence_penalty", p.presencePenalty, -2, 2); err != nil {
+		return err
+	}
+	// -1 disables top-k sampling
+	if p.topK != nil && *p.topK < 1 && *p.topK != -1 {
+		return invalidParam("top_k", "top_k must be -1 or at least 1, got %d", *p.topK)
+	}
+	if err := checkRange("min_p", p.minP, 0, 1); err != nil {
+		return err
+	}
+	if err := checkRange("repetition_penalty", p.repetitionPenalty, 0, 2); err != nil {
+		return err
+	}
+
+	switch stop := p.stop.(type) {
+	case nil, string:
+	case []interface{}:
+		for _, s := range stop {
+			if _, ok := s.(string); !ok {
+				return invalidParam("stop", "stop must be a string or an array of strings")
+			}
+		}
+	default:
+		return invalidParam("stop", "stop must be a string or an array of strings")
+	}
+	for i, id := range p.stopTokenIDs {
+		if id < 0 {
+			return invalidParam(fmt.Sprintf("stop_token_ids[%d]", i), "Token IDs must be non-negative, got %d", id)
+		}
+	}
+	return nil
+}
+
+// checkRange checks that an optional value lies in [lo, hi]
+func checkRange(param string, v *float64, lo, hi float64) *ValidationError {
+	if v != nil && (*v < lo || *v > hi) {
+		return invalidParam(param, "%s must be between %v and %v, got %v", param, lo, hi, *v)
+	}
+	return nil
+}
+
+// responseRoles are the message roles accepted in Responses API input
+var responseRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+}
+
+// Validate checks the input items, tools, and sampling parameters of the
+// request
+func (r *ResponsesRequest) Validate() *ValidationError {
+	if r.PreviousResponseID != "" {
+		return invalidParam("previous_response_id",
+			"previous_response_id is not supported because responses are not stored; send the conversation in input")
+	}
+
+	items, err := r.InputItems()
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		if err := item.validate(fmt.Sprintf("input[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	for i, tool := range r.Tools {
+		if tool.Type != "function" {
+			return invalidParam(fmt.Sprintf("tools[%d].type", i), "Unsupported tool type %q, only function tools are supported", tool.Type)
+		}
+		if tool.Name == "" {
+			return invalidParam(fmt.Sprintf("tools[%d].name", i), "Function tools require a name")
+		}
+	}
+	switch choice := r.ToolChoice.(type) {
+	case nil:
+	case string:
+		if choice != "auto" && choice != "none" && choice != "required" {
+			return invalidParam("tool_choice", "Invalid tool_choice %q, expected one of auto, none, required", choice)
+		}
+	case map[string]interface{}:
+		name, _ := choice["name"].(string)
+		if choice["type"] != "function" || name == "" {
+			return invalidParam("tool_choice", `tool_choice must be {"type": "function", "name": ...}`)
+		}
+	default:
+		return invalidParam("tool_choice", "tool_choice must be a string or an object")
+	}
+
+	if err := checkRange("temperature", r.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if r.TopP != nil && (*r.TopP <= 0 || *r.TopP > 1) {
+		return invalidParam("top_p", "top_p must be in (0, 1], got %v", *r.TopP)
+	}
+	if r.MaxOutputTokens != nil && *r.MaxOutputTokens < 1 {
+		return invalidParam("max_output_tokens", "max_output_tokens must be at least 1, got %d", *r.MaxOutputTokens)
+	}
+	return nil
+}
+
+// validate checks an input item; param is its position, e.g. "input[2]"
+func (it *ResponseInputItem) validate(param string) *ValidationError {
+	switch it.Type {
+	case "message":
+		if !responseRoles[it.Role] {
+			return invalidParam(param+".role", "Invalid role %q, expected one of system, developer, user, assistant", it.Role)
+		}
+		if _, ok := it.ContentText(); !ok {
+			return invalidParam(param+".content", "Only text content is supported")
+		}
+	case "function_call":
+		if it.CallID == "" {
+			return invalidParam(param+".call_id", "Function calls require a call_id")
+		}
+		if it.Name == "" {
+			return invalidParam(param+".name", "Function calls require a name")
+		}
+	case "function_call_output":
+		if it.CallID == "" {
+			return invalidParam(param+".call_id", "Function call outputs require a call_id")
+		}
+	default:
+		return invalidParam(param+".type",
+			"Unsupported input item type %q, expected one of message, function_call, function_call_output", it.Type)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestChatRequestValidate tests the parameter each invalid chat request is
+// rejected for; an empty param means the request is valid
+func TestChatRequestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		param  string
+	}{
+		{name: "minimal", fields: ``},
+		{name: "all in range", fields: `,"temperature":2,"top_p":1,"max_tokens":1,"max_completion_tokens":1,"frequency_penalty":-2,"presence_penalty":2,"top_k":-1,"min_p":0,"repetition_penalty":2,"stop":["a","b"],"stop_token_ids":[0]`},
+		{name: "stop string", fields: `,"stop":"\n"`},
+		{name: "stream options when streaming", fields: `,"stream":true,"stream_options":{"include_usage":true}`},
+
+		{name: "temperature too high", fields: `,"temperature":2.1`, param: "temperature"},
+		{name: "temperature negative", fields: `,"temperature":-0.1`, param: "temperature"},
+		{name: "top_p zero", fields: `,"top_p":0`, param: "top_p"},
+		{name: "top_p above one", fields: `,"top_p":1.5`, param: "top_p"},
+		{name: "max_tokens zero", fields: `,"max_tokens":0`, param: "max_tokens"},
+		{name: "max_completion_tokens zero", fields: `,"max_completion_tokens":0`, param: "max_completion_tokens"},
+		{name: "frequency_penalty", fields: `,"frequency_penalty":-2.5`, param: "frequency_penalty"},
+		{name: "presence_penalty", fields: `,"presence_penalty":3`, param: "presence_penalty"},
+		{name: "top_k zero", fields: `,"top_k":0`, param: "top_k"},
+		{name: "top_k below -1", fields: `,"top_k":-2`, param: "top_k"},
+		{name: "min_p", fields: `,"min_p":1.1`, param: "min_p"},
+		{name: "repetition_penalty", fields: `,"repetition_penalty":-1`, param: "repetition_penalty"},
+		{name: "stop number", fields: `,"stop":1`, param: "stop"},
+		{name: "stop array of numbers", fields: `,"stop":["a",1]`, param: "stop"},
+		{name: "stop object", fields: `,"stop":{"a":"b"}`, param: "stop"},
+		{name: "negative stop token", fields: `,"stop_token_ids":[1,-1]`, param: "stop_token_ids[1]"},
+		{name: "stream options without streaming", fields: `,"stream_options":{"include_usage":true}`, param: "stream_options"},
+		{name: "continue a user message", fields: `,"continue_final_message":true`, param: "continue_final_message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatRequest
+			body := `{"model":"m","messages":[{"role":"user","content":"Hi"}]` + tt.fields + `}`
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			checkParam(t, req.Validate(), tt.param)
+		})
+	}
+}
+
+// TestChatRequestValidateMessages tests the checks of chat messages
+func TestChatRequestValidateMessages(t *testing.T) {
+	tests := []struct {
+		messages string
+		param    string
+	}{
+		{messages: `[]`, param: "messages"},
+		{messages: `[{"content":"Hi"}]`, param: "messages[0].role"},
+		{messages: `[{"role":"user","content":"Hi"},{"role":"","content":"Hi"}]`, param: "messages[1].role"},
+		{messages: `[{"role":"system","content":"Be brief."},{"role":"bot","content":"Hi"}]`, param: "messages[1].role"},
+		{messages: `[{"role":"system"},{"role":"developer"},{"role":"user"},{"role":"assistant"},{"role":"tool"},{"role":"function"}]`},
+	}
+	for _, tt := range tests {
+		var req ChatRequest
+		if err := json.Unmarshal([]byte(`{"model":"m","messages":`+tt.messages+`}`), &req); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(tt.messages, func(t *testing.T) {
+			checkParam(t, req.Validate(), tt.param)
+		})
+	}
+
+	// Continuing the final message needs it to be the assistant's
+	req := ChatRequest{
+		Messages:             []map[string]string{{"role": "user"}, {"role": "assistant"}},
+		ContinueFinalMessage: true,
+	}
+	if err := req.Validate(); err != nil {
+		t.Errorf("Validate() continuing an assistant message = %v", err)
+	}
+}
+
+// TestCompletionRequestValidate tests that completion requests share the
+// sampling checks
+func TestCompletionRequestValidate(t *testing.T) {
+	tests := []struct {
+		fields string
+		param  string
+	}{
+		{fields: ``},
+		{fields: `,"top_k":0`, param: "top_k"},
+		{fields: `,"stop":[1]`, param: "stop"},
+		{fields: `,"stream_options":{}`, param: "stream_options"},
+	}
+	for _, tt := range tests {
+		var req CompletionRequest
+		if err := json.Unmarshal([]byte(`{"model":"m","prompt":"Hi"`+tt.fields+`}`), &req); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(tt.fields, func(t *testing.T) {
+			checkParam(t, req.Validate(), tt.param)
+		})
+	}
+}
+
+// TestResponsesRequestValidate tests the parameter each invalid Responses
+// request is rejected for
+func TestResponsesRequestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		param string
+	}{
+		{name: "string input", body: `{"input":"Hi"}`},
+		{name: "items", body: `{"input":[{"role":"user","content":[{"type":"input_text","text":"Hi"}]},{"type":"function_call","call_id":"c","name":"f"},{"type":"function_call_output","call_id":"c","output":"1"}]}`},
+		{name: "tools", body: `{"input":"Hi","tools":[{"type":"function","name":"f"}],"tool_choice":{"type":"function","name":"f"}}`},
+		{name: "tool_choice string", body: `{"input":"Hi","tool_choice":"required"}`},
+
+		{name: "previous response", body: `{"input":"Hi","previous_response_id":"resp_1"}`, param: "previous_response_id"},
+		{name: "no input", body: `{}`, param: "input"},
+		{name: "null input", body: `{"input":null}`, param: "input"},
+		{name: "empty items", body: `{"input":[]}`, param: "input"},
+		{name: "number input", body: `{"input":1}`, param: "input"},
+		{name: "role", body: `{"input":[{"role":"user","content":"Hi"},{"role":"tool","content":"x"}]}`, param: "input[1].role"},
+		{name: "image content", body: `{"input":[{"role":"user","content":[{"type":"input_image","image_url":"x"}]}]}`, param: "input[0].content"},
+		{name: "function call without call_id", body: `{"input":[{"type":"function_call","name":"f"}]}`, param: "input[0].call_id"},
+		{name: "function call without name", body: `{"input":[{"type":"function_call","call_id":"c"}]}`, param: "input[0].name"},
+		{name: "function call output without call_id", body: `{"input":[{"type":"function_call_output","output":"1"}]}`, param: "input[0].call_id"},
+		{name: "item type", body: `{"input":[{"type":"reasoning"}]}`, param: "input[0].type"},
+		{name: "tool type", body: `{"input":"Hi","tools":[{"type":"web_search","name":"s"}]}`, param: "tools[0].type"},
+		{name: "tool name", body: `{"input":"Hi","tools":[{"type":"function"}]}`, param: "tools[0].name"},
+		{name: "tool_choice unknown", body: `{"input":"Hi","tool_choice":"any"}`, param: "tool_choice"},
+		{name: "tool_choice without name", body: `{"input":"Hi","tool_choice":{"type":"function"}}`, param: "tool_choice"},
+		{name: "tool_choice number", body: `{"input":"Hi","tool_choice":1}`, param: "tool_choice"},
+		{name: "temperature", body: `{"input":"Hi","temperature":3}`, param: "temperature"},
+		{name: "top_p", body: `{"input":"Hi","top_p":0}`, param: "top_p"},
+		{name: "max_output_tokens", body: `{"input":"Hi","max_output_tokens":0}`, param: "max_output_tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ResponsesRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			checkParam(t, req.Validate(), tt.param)
+		})
+	}
+}
+
+// checkParam checks that err rejects param, or that it is nil when param is
+// empty
+func checkParam(t *testing.T, err *ValidationError, param string) {
+	t.Helper()
+	switch {
+	case param == "" && err != nil:
+		t.Errorf("Validate() = %q (param %s), want nil", err.Message, err.Param)
+	case param != "" && err == nil:
+		t.Errorf("Validate() = nil, want an error for %s", param)
+	case param != "" && err.Param != param:
+		t.Errorf("Validate() rejected %s (%q), want %s", err.Param, err.Message, param)
+	}
+}
@@ -0,0 +1,143 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// textRef is a text in a decoded request body and how to replace it
+type textRef struct {
+	text string
+	set  func(string)
+}
+
+// inputFields are the fields holding client-written text, by path. Fields
+// listed under items are arrays of objects whose text fields are listed.
+var inputFields = map[string]struct {
+	fields []string
+	items  map[string][]string
+}{
+	"/v1/chat/completions": {items: map[string][]string{"messages": {"content"}}},
+	"/v1/completions":      {fields: []string{"prompt"}},
+	"/v1/embeddings":       {fields: []string{"input"}},
+	"/v1/responses":        {fields: []string{"instructions", "input"}, items: map[string][]string{"input": {"content", "output"}}},
+	"/v1/messages":         {fields: []string{"system"}, items: map[string][]string{"messages": {"content"}}},
+	"/generate":            {fields: []string{"text"}},
+}
+
+// Middleware moderates the client-written text of inference requests, such
+// as messages and prompts, before they reach next. Blocked requests get 400
+// with code "content_filter"; redacted text replaces the original in the
+// body. auth.Middleware must run first for moderators to see the tenant.
+// Malformed bodies are passed on for the handler to reject.
+func Middleware(checker *Checker, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		path := string(ctx.Path())
+		fields, ok := inputFields[path]
+		if !ok || len(ctx.PostBody()) == 0 {
+			next(ctx)
+			return
+		}
+
+		var body map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(ctx.PostBody()))
+		// Keep numbers, such as seeds, exactly as sent
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil || body == nil {
+			next(ctx)
+			return
+		}
+		var refs []textRef
+		for _, name := range fields.fields {
+			refs = append(refs, textsAt(body, name)...)
+		}
+		for name, itemFields := range fields.items {
+			items, _ := body[name].([]interface{})
+			for _, item := range items {
+				if obj, ok := item.(map[string]interface{}); ok {
+					for _, field := range itemFields {
+						refs = append(refs, textsAt(obj, field)...)
+					}
+				}
+			}
+		}
+		if len(refs) == 0 {
+			next(ctx)
+			return
+		}
+
+		req := &Request{Stage: StageInput, Path: path, Texts: make([]string, len(refs))}
+		req.Model, _ = body["model"].(string)
+		if key := auth.KeyFromContext(ctx); key != nil {
+			req.Tenant = key.Tenant
+		}
+		for i, ref := range refs {
+			req.Texts[i] = ref.text
+		}
+
+		verdict, err := checker.Check(ctx, req)
+		if err != nil {
+			checker.Logger.Error("Input moderation failed", zap.Error(err), requestid.Field(ctx))
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusServiceUnavailable,
+				"Content moderation is unavailable. Please retry later.", "server_error", "", "moderation_unavailable")
+			return
+		}
+
+		switch verdict.Action {
+		case Block:
+			checker.Logger.Warn("Blocked request by content moderation",
+				zap.String("tenant", req.Tenant),
+				zap.String("reason", verdict.Reason),
+				requestid.Field(ctx),
+			)
+			message := "The request was blocked by content moderation."
+			if verdict.Reason != "" {
+				message = fmt.Sprintf("The request was blocked by content moderation: %s.", verdict.Reason)
+			}
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest, message, "invalid_request_error", "", ContentFilter)
+			return
+		case Redact:
+			for i, ref := range refs {
+				ref.set(verdict.Texts[i])
+			}
+			redacted, err := json.Marshal(body)
+			if err != nil {
+				utils.RespondError(ctx, fasthttp.StatusInternalServerError, "Failed to redact request", "server_error")
+				return
+			}
+			ctx.Request.SetBody(redacted)
+		}
+		next(ctx)
+	}
+}
+
+// textsAt returns the texts in obj[name]: a string, an array of strings, or
+// an array of content parts with a "text" field
+func textsAt(obj map[string]interface{}, name string) []textRef {
+	switch v := obj[name].(type) {
+	case string:
+		return []textRef{{text: v, set: func(s string) { obj[name] = s }}}
+	case []interface{}:
+		var refs []textRef
+		for i := range v {
+			switch elem := v[i].(type) {
+			case string:
+				refs = append(refs, textRef{text: elem, set: func(s string) { v[i] = s }})
+			case map[string]interface{}:
+				if text, ok := elem["text"].(string); ok {
+					refs = append(refs, textRef{text: text, set: func(s string) { elem["text"] = s }})
+				}
+			}
+		}
+		return refs
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package moderation checks request and response text with a moderator, an
+// in-process function or an HTTP service, which may allow, redact, or block
+// it. Blocked responses end with the "content_filter" finish reason.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Stage is the point at which text is moderated
+type Stage string
+
+const (
+	// StageInput is the client's request, before it is forwarded
+	StageInput Stage = "input"
+	// StageOutput is the generated response, before it is returned
+	StageOutput Stage = "output"
+)
+
+// Action is a moderator's decision
+type Action string
+
+const (
+	Allow  Action = "allow"
+	Redact Action = "redact"
+	Block  Action = "block"
+)
+
+// ContentFilter is the finish reason of blocked responses and the error code
+// of blocked requests
+const ContentFilter = "content_filter"
+
+// Request is the text to moderate
+type Request struct {
+	Stage  Stage  `json:"stage"`
+	Path   string `json:"path"`
+	Model  string `json:"model,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// Texts are the client-written texts of a request, such as message
+	// contents, or the generated texts of a response
+	Texts []string `json:"texts"`
+}
+
+// Verdict is a moderator's decision on a Request
+type Verdict struct {
+	Action Action `json:"action"`
+	// Reason explains a block or redaction; it is returned to the client
+	Reason string `json:"reason,omitempty"`
+	// Texts replace the request's texts, one for one, when redacting
+	Texts []string `json:"texts,omitempty"`
+}
+
+// Moderator decides whether text may pass. Implementations must be safe for
+// concurrent use.
+type Moderator interface {
+	Moderate(ctx context.Context, req *Request) (Verdict, error)
+}
+
+// Func adapts an in-process function to the Moderator interface
+type Func func(ctx context.Context, req *Request) (Verdict, error)
+
+// Moderate calls f(ctx, req)
+func (f Func) Moderate(ctx context.Context, req *Request) (Verdict, error) {
+	return f(ctx, req)
+}
+
+// HTTPModerator posts each Request as JSON to a moderation service, which
+// answers with a Verdict as JSON
+type HTTPModerator struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTPModerator creates a moderator calling url, sending apiKey as a
+// bearer token when set. Calls taking longer than timeout fail.
+func NewHTTPModerator(url, apiKey string, timeout time.Duration) *HTTPModerator {
+	return &HTTPModerator{url: url, apiKey: apiKey, client: &http.Client{Timeout: timeout}}
+}
+
+// Moderate calls the moderation service
+func (m *HTTPModerator) Moderate(ctx context.Context, req *Request) (Verdict, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("moderation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return Verdict{}, fmt.Errorf("moderation service returned status %d", resp.StatusCode)
+	}
+	var verdict Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return Verdict{}, fmt.Errorf("failed to parse moderation verdict: %w", err)
+	}
+	return verdict, nil
+}
+
+// Checker runs a moderator and validates its verdicts
+type Checker struct {
+	Moderator Moderator
+	// FailOpen allows text when the moderator fails or returns an invalid
+	// verdict; otherwise Check returns the error
+	FailOpen bool
+	Logger   *zap.Logger
+}
+
+// Check moderates req. It returns an error only when the moderator failed
+// and the checker does not fail open.
+func (c *Checker) Check(ctx context.Context, req *Request) (Verdict, error) {
+	verdict, err := c.Moderator.Moderate(ctx, req)
+	if err == nil {
+		err = validate(req, verdict)
+	}
+	if err != nil {
+		if c.FailOpen {
+			c.Logger.Warn("Moderation failed, allowing content", zap.String("stage", string(req.Stage)), zap.Error(err))
+			return Verdict{Action: Allow}, nil
+		}
+		return Verdict{}, err
+	}
+	return verdict, nil
+}
+
+// validate checks that verdict is a valid answer to req
+func validate(req *Request, verdict Verdict) error {
+	switch verdict.Action {
+	case Allow, Block:
+		return nil
+	case Redact:
+		if len(verdict.Texts) != len(req.Texts) {
+			return fmt.Errorf("redaction returned %d texts for %d", len(verdict.Texts), len(req.Texts))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown moderation action %q", verdict.Action)
+	}
+}
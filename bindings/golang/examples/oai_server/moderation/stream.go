@@ -0,0 +1,207 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"go.uber.org/zap"
+)
+
+// Stream moderates a stream of chat or text completion chunks. Chunks are
+// held until their text reaches the window size or a choice finishes, and
+// then released, redacted, or replaced by a final chunk with the
+// "content_filter" finish reason that ends the stream.
+type Stream struct {
+	smg.ChatStream
+	ctx     context.Context
+	checker *Checker
+	req     Request
+	window  int
+
+	// pending are the held chunks, and pendingText their text
+	pending     []map[string]interface{}
+	pendingText int
+	// ready are the chunks to return, in order
+	ready []string
+	// err ends the stream once ready is empty
+	err error
+}
+
+// NewStream moderates the output of inner in windows of about window bytes
+// of text. req describes the request; its stage and texts are set per check.
+func NewStream(ctx context.Context, checker *Checker, req Request, window int, inner smg.ChatStream) *Stream {
+	req.Stage = StageOutput
+	return &Stream{ChatStream: inner, ctx: ctx, checker: checker, req: req, window: window}
+}
+
+// RecvJSON returns the next moderated chunk
+func (s *Stream) RecvJSON() (string, error) {
+	for {
+		if len(s.ready) > 0 {
+			chunk := s.ready[0]
+			s.ready = s.ready[1:]
+			return chunk, nil
+		}
+		if s.err != nil {
+			return "", s.err
+		}
+
+		chunkJSON, err := s.ChatStream.RecvJSON()
+		if err != nil {
+			// Check what is held before ending; errors other than EOF are
+			// returned after the chunks released
+			s.release()
+			if s.err == nil {
+				s.err = err
+			}
+			continue
+		}
+		if chunkJSON == "" {
+			continue
+		}
+
+		var chunk map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(chunkJSON)))
+		decoder.UseNumber()
+		if decoder.Decode(&chunk) != nil || chunk == nil {
+			// Not a chunk this package understands; keep it in order
+			s.release()
+			s.ready = append(s.ready, chunkJSON)
+			continue
+		}
+		text, finished := chunkText(chunk)
+		s.pending = append(s.pending, chunk)
+		s.pendingText += len(text)
+		if s.pendingText >= s.window || finished || s.pendingText == 0 {
+			s.release()
+		}
+	}
+}
+
+// release moderates the held chunks and moves them, or their replacement,
+// to ready
+func (s *Stream) release() {
+	pending := s.pending
+	s.pending, s.pendingText = nil, 0
+	if len(pending) == 0 {
+		return
+	}
+
+	var texts []string
+	for _, chunk := range pending {
+		if text, _ := chunkText(chunk); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	verdict := Verdict{Action: Allow}
+	if len(texts) > 0 {
+		req := s.req
+		req.Texts = []string{strings.Join(texts, "")}
+		var err error
+		if verdict, err = s.checker.Check(s.ctx, &req); err != nil {
+			s.checker.Logger.Error("Output moderation failed, ending stream", zap.Error(err))
+			verdict = Verdict{Action: Block}
+		}
+	}
+
+	switch verdict.Action {
+	case Block:
+		s.checker.Logger.Warn("Blocked streamed response by content moderation",
+			zap.String("tenant", s.req.Tenant), zap.String("reason", verdict.Reason))
+		s.ready = append(s.ready, marshal(filteredChunk(pending[0])))
+		// Stop generating; the stream's usage is not reported
+		s.err = io.EOF
+		return
+	case Redact:
+		// The whole window's redacted text goes in its first text chunk
+		replaced := false
+		for _, chunk := range pending {
+			if text, _ := chunkText(chunk); text == "" {
+				continue
+			}
+			if replaced {
+				setChunkText(chunk, "")
+			} else {
+				setChunkText(chunk, verdict.Texts[0])
+				replaced = true
+			}
+		}
+	}
+	for _, chunk := range pending {
+		s.ready = append(s.ready, marshal(chunk))
+	}
+}
+
+// chunkText returns the text of a chunk's first choice, from a chat delta or
+// a text completion, and whether a choice finished
+func chunkText(chunk map[string]interface{}) (text string, finished bool) {
+	choices, _ := chunk["choices"].([]interface{})
+	for i, c := range choices {
+		choice, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if reason, ok := choice["finish_reason"].(string); ok && reason != "" {
+			finished = true
+		}
+		if i > 0 {
+			continue
+		}
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			text, _ = delta["content"].(string)
+		} else {
+			text, _ = choice["text"].(string)
+		}
+	}
+	return text, finished
+}
+
+// setChunkText replaces the text of a chunk's first choice
+func setChunkText(chunk map[string]interface{}, text string) {
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if delta, ok := choice["delta"].(map[string]interface{}); ok {
+		delta["content"] = text
+	} else {
+		choice["text"] = text
+	}
+}
+
+// filteredChunk returns the final chunk of a blocked stream: a copy of like
+// whose only choice has no text and the content_filter finish reason
+func filteredChunk(like map[string]interface{}) map[string]interface{} {
+	chunk := make(map[string]interface{}, len(like))
+	for k, v := range like {
+		if k != "choices" && k != "usage" {
+			chunk[k] = v
+		}
+	}
+	choice := map[string]interface{}{"index": 0, "finish_reason": ContentFilter}
+	if choices, _ := like["choices"].([]interface{}); len(choices) > 0 {
+		if first, ok := choices[0].(map[string]interface{}); ok {
+			if _, isChat := first["delta"]; isChat {
+				choice["delta"] = map[string]interface{}{}
+			} else {
+				choice["text"] = ""
+			}
+		}
+	}
+	chunk["choices"] = []interface{}{choice}
+	return chunk
+}
+
+// marshal encodes a chunk decoded by RecvJSON, which always encodes
+func marshal(chunk map[string]interface{}) string {
+	data, _ := json.Marshal(chunk)
+	return string(data)
+}
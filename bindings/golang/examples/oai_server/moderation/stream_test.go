@@ -0,0 +1,248 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeStream returns chunks and then err, or io.EOF
+type fakeStream struct {
+	chunks []string
+	err    error
+	read   int
+}
+
+func (f *fakeStream) RecvJSON() (string, error) {
+	if f.read == len(f.chunks) {
+		if f.err != nil {
+			return "", f.err
+		}
+		return "", io.EOF
+	}
+	f.read++
+	return f.chunks[f.read-1], nil
+}
+
+func (f *fakeStream) Close() error { return nil }
+
+// chatChunk returns a chat completion chunk with content, finished with
+// reason when set
+func chatChunk(content, reason string) string {
+	choice := map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": content}}
+	if reason != "" {
+		choice["finish_reason"] = reason
+	}
+	data, _ := json.Marshal(map[string]interface{}{"id": "chatcmpl-1", "choices": []interface{}{choice}})
+	return string(data)
+}
+
+// recorder returns a moderator calling decide and recording the texts it
+// was asked about
+func recorder(checked *[]string, decide func(text string) (Verdict, error)) Func {
+	return func(ctx context.Context, req *Request) (Verdict, error) {
+		if req.Stage != StageOutput || len(req.Texts) != 1 {
+			return Verdict{}, fmt.Errorf("unexpected request %+v", req)
+		}
+		*checked = append(*checked, req.Texts[0])
+		return decide(req.Texts[0])
+	}
+}
+
+// drain reads s to its end, returning the first choice of each chunk as
+// "text|finish_reason" and the error that ended it
+func drain(t *testing.T, s *Stream) ([]string, error) {
+	t.Helper()
+	var got []string
+	for {
+		chunkJSON, err := s.RecvJSON()
+		if err != nil {
+			return got, err
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			got = append(got, chunkJSON)
+			continue
+		}
+		text, _ := chunkText(chunk)
+		choice := chunk["choices"].([]interface{})[0].(map[string]interface{})
+		reason, _ := choice["finish_reason"].(string)
+		got = append(got, text+"|"+reason)
+	}
+}
+
+// TestStream tests the windowed moderation of streamed chunks
+func TestStream(t *testing.T) {
+	failure := errors.New("moderator unavailable")
+	allow := func(string) (Verdict, error) { return Verdict{Action: Allow}, nil }
+	tests := []struct {
+		name     string
+		window   int
+		chunks   []string
+		innerErr error
+		decide   func(text string) (Verdict, error)
+		failOpen bool
+		want     []string
+		wantErr  error
+		checked  []string
+	}{
+		{
+			name:   "windowed",
+			window: 10,
+			chunks: []string{chatChunk("Hello ", ""), chatChunk("world", ""), chatChunk("!", ""), chatChunk("", "stop")},
+			decide: allow,
+			want:   []string{"Hello |", "world|", "!|", "|stop"},
+			// The window releases once it holds 10 bytes, and the
+			// finish releases the rest
+			checked: []string{"Hello world", "!"},
+		},
+		{
+			name:    "chunks without text released at once",
+			window:  10,
+			chunks:  []string{chatChunk("", ""), chatChunk("Hi", "stop")},
+			decide:  allow,
+			want:    []string{"|", "Hi|stop"},
+			checked: []string{"Hi"},
+		},
+		{
+			name:    "held text checked at the end",
+			window:  100,
+			chunks:  []string{chatChunk("Hello", ""), chatChunk(" there", "")},
+			decide:  allow,
+			want:    []string{"Hello|", " there|"},
+			checked: []string{"Hello there"},
+		},
+		{
+			name:   "blocked",
+			window: 4,
+			chunks: []string{chatChunk("fine", ""), chatChunk("bad words", ""), chatChunk("more", ""), chatChunk("", "stop")},
+			decide: func(text string) (Verdict, error) {
+				if strings.Contains(text, "bad") {
+					return Verdict{Action: Block, Reason: "bad"}, nil
+				}
+				return Verdict{Action: Allow}, nil
+			},
+			// The blocked window is replaced and the stream ends
+			want:    []string{"fine|", "|" + ContentFilter},
+			checked: []string{"fine", "bad words"},
+		},
+		{
+			name:   "redacted into the first text chunk",
+			window: 100,
+			chunks: []string{chatChunk("my sec", ""), chatChunk("", ""), chatChunk("ret is", ""), chatChunk(" x", "stop")},
+			decide: func(text string) (Verdict, error) {
+				return Verdict{Action: Redact, Texts: []string{strings.ReplaceAll(text, "secret", "***")}}, nil
+			},
+			want:    []string{"my *** is x|", "|", "|", "|stop"},
+			checked: []string{"my secret is x"},
+		},
+		{
+			name:     "fail open",
+			window:   4,
+			chunks:   []string{chatChunk("text", ""), chatChunk("", "stop")},
+			decide:   func(string) (Verdict, error) { return Verdict{}, failure },
+			failOpen: true,
+			want:     []string{"text|", "|stop"},
+			checked:  []string{"text"},
+		},
+		{
+			name:     "invalid verdict fails open",
+			window:   4,
+			chunks:   []string{chatChunk("text", "")},
+			decide:   func(string) (Verdict, error) { return Verdict{Action: Redact}, nil },
+			failOpen: true,
+			want:     []string{"text|"},
+			checked:  []string{"text"},
+		},
+		{
+			name:    "fail closed",
+			window:  4,
+			chunks:  []string{chatChunk("text", ""), chatChunk("", "stop")},
+			decide:  func(string) (Verdict, error) { return Verdict{}, failure },
+			want:    []string{"|" + ContentFilter},
+			checked: []string{"text"},
+		},
+		{
+			name:     "stream error after the held chunks",
+			window:   100,
+			chunks:   []string{chatChunk("partial", "")},
+			innerErr: failure,
+			decide:   allow,
+			want:     []string{"partial|"},
+			wantErr:  failure,
+			checked:  []string{"partial"},
+		},
+		{
+			name:    "unknown chunks kept in order",
+			window:  100,
+			chunks:  []string{chatChunk("a", ""), "[not a chunk]", chatChunk("b", "stop")},
+			decide:  allow,
+			want:    []string{"a|", "[not a chunk]", "b|stop"},
+			checked: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checked []string
+			checker := &Checker{Moderator: recorder(&checked, tt.decide), FailOpen: tt.failOpen, Logger: zap.NewNop()}
+			inner := &fakeStream{chunks: tt.chunks, err: tt.innerErr}
+			s := NewStream(context.Background(), checker, Request{Path: "/v1/chat/completions"}, tt.window, inner)
+
+			got, err := drain(t, s)
+			wantErr := tt.wantErr
+			if wantErr == nil {
+				wantErr = io.EOF
+			}
+			if !errors.Is(err, wantErr) {
+				t.Errorf("stream ended with %v, want %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(checked, tt.checked) {
+				t.Errorf("checked %q, want %q", checked, tt.checked)
+			}
+		})
+	}
+}
+
+// TestStreamBlockedChunk tests the final chunk of a blocked stream
+func TestStreamBlockedChunk(t *testing.T) {
+	block := Func(func(context.Context, *Request) (Verdict, error) { return Verdict{Action: Block}, nil })
+	checker := &Checker{Moderator: block, Logger: zap.NewNop()}
+	tests := []struct {
+		name  string
+		chunk string
+		want  string
+	}{
+		{
+			name:  "chat",
+			chunk: `{"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"bad"}},{"index":1,"delta":{"content":"also"}}],"usage":{"total_tokens":3}}`,
+			want:  `{"choices":[{"delta":{},"finish_reason":"content_filter","index":0}],"id":"chatcmpl-1","object":"chat.completion.chunk"}`,
+		},
+		{
+			name:  "text completion",
+			chunk: `{"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"bad","finish_reason":"stop"}]}`,
+			want:  `{"choices":[{"finish_reason":"content_filter","index":0,"text":""}],"id":"cmpl-1","object":"text_completion"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStream(context.Background(), checker, Request{}, 1, &fakeStream{chunks: []string{tt.chunk}})
+			got, err := s.RecvJSON()
+			if err != nil || got != tt.want {
+				t.Errorf("RecvJSON() = %s, %v, want %s", got, err, tt.want)
+			}
+			if _, err := s.RecvJSON(); err != io.EOF {
+				t.Errorf("RecvJSON() after the block = %v, want io.EOF", err)
+			}
+		})
+	}
+}
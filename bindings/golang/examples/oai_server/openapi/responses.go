@@ -0,0 +1,158 @@
+package openapi
+
+// generateRequest is the SGLang native request. Only the sampling
+// parameters listed are applied; others are accepted and ignored. The model
+// defaults to "default".
+var generateRequest = objectOf(map[string]*Schema{
+	"model": stringSchema(),
+	"text":  {Type: "string", MinLength: intPtr(1)},
+	"sampling_params": {Type: "object", Nullable: true, Properties: map[string]*Schema{
+		"max_new_tokens": atLeast(1),
+		"temperature":    between(0, 2),
+		"top_p":          fieldSchemas["top_p"],
+		"top_k":          fieldSchemas["top_k"],
+	}},
+}, "text")
+
+// usage is the token usage reported by chat and completion responses
+var usage = objectOf(map[string]*Schema{
+	"prompt_tokens":     integerSchema(),
+	"completion_tokens": integerSchema(),
+	"total_tokens":      integerSchema(),
+}, "prompt_tokens", "completion_tokens", "total_tokens")
+
+// nullableObject returns an object schema that may be null
+func nullableObject(properties map[string]*Schema, required ...string) *Schema {
+	s := objectOf(properties, required...)
+	s.Nullable = true
+	return s
+}
+
+// responseSchemas describe the bodies the handlers write
+var responseSchemas = map[string]*Schema{
+	"ChatCompletion": objectOf(map[string]*Schema{
+		"id":      stringSchema(),
+		"object":  enumOf("chat.completion"),
+		"created": integerSchema(),
+		"model":   stringSchema(),
+		"choices": arrayOf(objectOf(map[string]*Schema{
+			"index": integerSchema(),
+			"message": objectOf(map[string]*Schema{
+				"role":    stringSchema(),
+				"content": stringSchema(),
+				"tool_calls": arrayOf(objectOf(map[string]*Schema{
+					"id":   stringSchema(),
+					"type": enumOf("function"),
+					"function": objectOf(map[string]*Schema{
+						"name":      stringSchema(),
+						"arguments": stringSchema(),
+					}, "name", "arguments"),
+				}, "id", "type", "function")),
+			}, "role", "content"),
+			"finish_reason": stringSchema(),
+		}, "index", "message", "finish_reason")),
+		"usage": usage,
+	}, "id", "object", "created", "model", "choices", "usage"),
+
+	"Completion": objectOf(map[string]*Schema{
+		"id":      stringSchema(),
+		"object":  enumOf("text_completion"),
+		"created": integerSchema(),
+		"model":   stringSchema(),
+		"choices": arrayOf(objectOf(map[string]*Schema{
+			"index":         integerSchema(),
+			"text":          stringSchema(),
+			"logprobs":      {Type: "object", Nullable: true},
+			"finish_reason": stringSchema(),
+		}, "index", "text", "logprobs", "finish_reason")),
+		"usage": usage,
+	}, "id", "object", "created", "model", "choices", "usage"),
+
+	"EmbeddingList": objectOf(map[string]*Schema{
+		"object": enumOf("list"),
+		"model":  stringSchema(),
+		"data": arrayOf(objectOf(map[string]*Schema{
+			"object": enumOf("embedding"),
+			"index":  integerSchema(),
+			"embedding": {
+				Description: "An array of floats, or base64 little-endian float32s when encoding_format is base64",
+				OneOf:       []*Schema{arrayOf(numberSchema()), stringSchema()},
+			},
+		}, "object", "index", "embedding")),
+		"usage": objectOf(map[string]*Schema{
+			"prompt_tokens": integerSchema(),
+			"total_tokens":  integerSchema(),
+		}, "prompt_tokens", "total_tokens"),
+	}, "object", "model", "data", "usage"),
+
+	"Response": objectOf(map[string]*Schema{
+		"id":                 stringSchema(),
+		"object":             enumOf("response"),
+		"created_at":         integerSchema(),
+		"status":             enumOf("in_progress", "completed", "incomplete", "failed"),
+		"error":              nullableObject(map[string]*Schema{"code": stringSchema(), "message": stringSchema()}),
+		"incomplete_details": nullableObject(map[string]*Schema{"reason": stringSchema()}),
+		"model":              stringSchema(),
+		"output": arrayOf(oneOf(
+			objectOf(map[string]*Schema{
+				"type":   enumOf("message"),
+				"id":     stringSchema(),
+				"status": stringSchema(),
+				"role":   enumOf("assistant"),
+				"content": arrayOf(objectOf(map[string]*Schema{
+					"type":        enumOf("output_text"),
+					"text":        stringSchema(),
+					"annotations": arrayOf(&Schema{}),
+				}, "type", "text")),
+			}, "type", "id", "role", "content"),
+			objectOf(map[string]*Schema{
+				"type":      enumOf("function_call"),
+				"id":        stringSchema(),
+				"call_id":   stringSchema(),
+				"name":      stringSchema(),
+				"arguments": stringSchema(),
+				"status":    stringSchema(),
+			}, "type", "id", "call_id", "name", "arguments"),
+		)),
+		"usage": nullableObject(map[string]*Schema{
+			"input_tokens":  integerSchema(),
+			"output_tokens": integerSchema(),
+			"total_tokens":  integerSchema(),
+		}),
+		"metadata": {Type: "object", Nullable: true, AdditionalProperties: stringSchema()},
+	}, "id", "object", "created_at", "status", "model", "output"),
+
+	"GenerateResponse": objectOf(map[string]*Schema{
+		"text": stringSchema(),
+		"meta_info": objectOf(map[string]*Schema{
+			"id":                stringSchema(),
+			"finish_reason":     stringSchema(),
+			"prompt_tokens":     integerSchema(),
+			"completion_tokens": integerSchema(),
+			"cached_tokens":     integerSchema(),
+			"weight_version":    stringSchema(),
+		}),
+	}, "text", "meta_info"),
+
+	"ModelList": objectOf(map[string]*Schema{
+		"object": enumOf("list"),
+		"data": arrayOf(objectOf(map[string]*Schema{
+			"id":            stringSchema(),
+			"object":        enumOf("model"),
+			"created":       integerSchema(),
+			"owned_by":      stringSchema(),
+			"root":          stringSchema(),
+			"max_model_len": integerSchema(),
+		}, "id", "object", "created", "owned_by")),
+	}, "object", "data"),
+
+	"Error": objectOf(map[string]*Schema{
+		"error": objectOf(map[string]*Schema{
+			"message":    stringSchema(),
+			"type":       stringSchema(),
+			"param":      {Type: "string", Nullable: true},
+			"code":       {Type: "string", Nullable: true},
+			"request_id": stringSchema(),
+		}, "message", "type", "param", "code"),
+	}, "error"),
+}
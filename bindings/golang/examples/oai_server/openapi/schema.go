@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object that the document
+// uses and that Validate checks
+type Schema struct {
+	Ref              string        `json:"$ref,omitempty"`
+	Type             string        `json:"type,omitempty"`
+	Format           string        `json:"format,omitempty"`
+	Description      string        `json:"description,omitempty"`
+	Nullable         bool          `json:"nullable,omitempty"`
+	Enum             []interface{} `json:"enum,omitempty"`
+	Minimum          *float64      `json:"minimum,omitempty"`
+	Maximum          *float64      `json:"maximum,omitempty"`
+	ExclusiveMinimum bool          `json:"exclusiveMinimum,omitempty"`
+	MinLength        *int          `json:"minLength,omitempty"`
+	MinItems         *int          `json:"minItems,omitempty"`
+	MaxItems         *int          `json:"maxItems,omitempty"`
+	Items            *Schema       `json:"items,omitempty"`
+	// Properties and Required describe objects. AdditionalProperties is
+	// false, to reject unknown properties, or the *Schema of their values;
+	// other properties are allowed when it is nil.
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// ref returns a schema referring to the named component
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func stringSchema() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func integerSchema() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func numberSchema() *Schema {
+	return &Schema{Type: "number"}
+}
+
+func booleanSchema() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+func arrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// objectOf returns an object schema with the given properties, of which
+// required must be present
+func objectOf(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+func enumOf(values ...string) *Schema {
+	s := &Schema{Type: "string"}
+	for _, v := range values {
+		s.Enum = append(s.Enum, v)
+	}
+	return s
+}
+
+func oneOf(schemas ...*Schema) *Schema {
+	return &Schema{OneOf: schemas}
+}
+
+// between returns an optional number schema bounded by [lo, hi]
+func between(lo, hi float64) *Schema {
+	return &Schema{Type: "number", Nullable: true, Minimum: &lo, Maximum: &hi}
+}
+
+// atLeast returns an optional integer schema bounded below by lo
+func atLeast(lo float64) *Schema {
+	return &Schema{Type: "integer", Nullable: true, Minimum: &lo}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// fieldSchemas refine the schemas reflected from the request types, by
+// "Type.field" or, for every type, by field name. The ranges mirror the
+// checks in models/validate.go.
+var fieldSchemas = map[string]*Schema{
+	"temperature":           between(0, 2),
+	"top_p":                 {Type: "number", Nullable: true, Minimum: floatPtr(0), ExclusiveMinimum: true, Maximum: floatPtr(1)},
+	"max_tokens":            atLeast(1),
+	"max_completion_tokens": atLeast(1),
+	"max_output_tokens":     atLeast(1),
+	"frequency_penalty":     between(-2, 2),
+	"presence_penalty":      between(-2, 2),
+	"top_k": {Type: "integer", Nullable: true, Minimum: floatPtr(-1),
+		Description: "At least 1, or -1 to disable top-k sampling"},
+	"min_p":              between(0, 1),
+	"repetition_penalty": between(0, 2),
+	"stop_token_ids":     {Type: "array", Nullable: true, Items: &Schema{Type: "integer", Minimum: floatPtr(0)}},
+	"stop":               {Nullable: true, OneOf: []*Schema{stringSchema(), arrayOf(stringSchema())}},
+
+	"ChatRequest.messages": {Type: "array", MinItems: intPtr(1), Items: &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"role":         enumOf("system", "developer", "user", "assistant", "tool", "function"),
+			"content":      stringSchema(),
+			"name":         stringSchema(),
+			"tool_call_id": stringSchema(),
+		},
+		Required:             []string{"role"},
+		AdditionalProperties: stringSchema(),
+	}},
+	"ChatRequest.tool_choice": {Nullable: true, OneOf: []*Schema{
+		enumOf("auto", "none", "required"),
+		objectOf(map[string]*Schema{
+			"type":     enumOf("function"),
+			"function": objectOf(map[string]*Schema{"name": stringSchema()}, "name"),
+		}, "type", "function"),
+	}},
+	"CompletionRequest.prompt": {
+		Description: "A prompt, or an array holding exactly one prompt",
+		OneOf:       []*Schema{stringSchema(), {Type: "array", Items: stringSchema(), MinItems: intPtr(1), MaxItems: intPtr(1)}},
+	},
+	"EmbeddingRequest.input": {OneOf: []*Schema{
+		{Type: "string", MinLength: intPtr(1)},
+		{Type: "array", Items: stringSchema(), MinItems: intPtr(1)},
+	}},
+	"EmbeddingRequest.encoding_format": enumOf("float", "base64"),
+	"ResponsesRequest.input":           oneOf(stringSchema(), &Schema{Type: "array", Items: ref("ResponseInputItem"), MinItems: intPtr(1)}),
+	"ResponsesRequest.tool_choice": {Nullable: true, OneOf: []*Schema{
+		enumOf("auto", "none", "required"),
+		objectOf(map[string]*Schema{"type": enumOf("function"), "name": stringSchema()}, "type", "name"),
+	}},
+	"ResponseInputItem.type": enumOf("message", "function_call", "function_call_output"),
+	"ResponseInputItem.role": enumOf("system", "developer", "user", "assistant"),
+	"ResponseInputItem.content": {Nullable: true, OneOf: []*Schema{
+		stringSchema(),
+		arrayOf(objectOf(map[string]*Schema{
+			"type": enumOf("input_text", "output_text", "text"),
+			"text": stringSchema(),
+		}, "type", "text")),
+	}},
+	"ResponseTool.type": enumOf("function"),
+}
+
+// reflectSchema returns the schema of a request type from its json and
+// binding tags. Struct properties are closed, so that parameters the
+// gateway does not support are rejected rather than silently ignored.
+func reflectSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := reflectSchema(t.Elem())
+		s.Nullable = true
+		return s
+	case reflect.String:
+		return stringSchema()
+	case reflect.Bool:
+		return booleanSchema()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return integerSchema()
+	case reflect.Float32, reflect.Float64:
+		return numberSchema()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// json.RawMessage and other byte slices hold any value
+			return &Schema{}
+		}
+		return &Schema{Type: "array", Nullable: true, Items: reflectSchema(t.Elem())}
+	case reflect.Map:
+		s := &Schema{Type: "object", Nullable: true}
+		if t.Elem().Kind() != reflect.Interface {
+			s.AdditionalProperties = reflectSchema(t.Elem())
+		}
+		return s
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			prop, ok := fieldSchemas[t.Name()+"."+name]
+			if !ok {
+				prop, ok = fieldSchemas[name]
+			}
+			if !ok {
+				prop = reflectSchema(field.Type)
+			}
+			s.Properties[name] = prop
+			if strings.Contains(field.Tag.Get("binding"), "required") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s
+	default:
+		// Interfaces hold any value
+		return &Schema{}
+	}
+}
@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/valyala/fasthttp"
+
+	"oai_server/models"
+)
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem holds the operations on a path
+type PathItem struct {
+	Get  *Operation `json:"get,omitempty"`
+	Post *Operation `json:"post,omitempty"`
+	Put  *Operation `json:"put,omitempty"`
+}
+
+// Operation is an endpoint
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security overrides the document's security; an empty list makes the
+	// operation public
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+// RequestBody describes an operation's request body by media type
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes an operation's response by media type
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas that others refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how requests authenticate
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Build returns the document for the gateway's client-facing endpoints.
+// When auth is set, every endpoint but the health checks and metrics
+// requires a bearer API key.
+func Build(version string, auth bool) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "SMG OpenAI-compatible gateway",
+			Description: "The OpenAI-compatible and SGLang endpoints served by this gateway, with the parameters it supports.",
+			Version:     version,
+		},
+		Paths: map[string]*PathItem{
+			"/v1/chat/completions": {Post: inference("createChatCompletion", "Create a chat completion", "ChatRequest", "ChatCompletion", true)},
+			"/v1/completions":      {Post: inference("createCompletion", "Create a completion", "CompletionRequest", "Completion", true)},
+			"/v1/embeddings":       {Post: inference("createEmbedding", "Create embeddings", "EmbeddingRequest", "EmbeddingList", false)},
+			"/v1/responses":        {Post: inference("createResponse", "Create a model response", "ResponsesRequest", "Response", true)},
+			"/generate": {
+				Post: inference("generate", "Generate text (SGLang native API)", "GenerateRequest", "GenerateResponse", false),
+				Put:  inference("generatePut", "Generate text (SGLang native API)", "GenerateRequest", "GenerateResponse", false),
+			},
+			"/v1/models":      {Get: get("listModels", "List the models", "application/json", ref("ModelList"))},
+			"/get_model_info": {Get: get("getModelInfo", "Describe the model (SGLang native API)", "application/json", &Schema{Type: "object"})},
+			"/health":         {Get: public(get("health", "Liveness check", "application/json", &Schema{Type: "object"}))},
+			"/healthz":        {Get: public(get("healthz", "Liveness check", "application/json", &Schema{Type: "object"}))},
+			"/readyz":         {Get: public(get("readyz", "Readiness check; 503 when no worker is healthy", "application/json", &Schema{Type: "object"}))},
+			"/metrics":        {Get: public(get("metrics", "Prometheus metrics", "text/plain", stringSchema()))},
+		},
+		Components: Components{Schemas: map[string]*Schema{
+			"ChatRequest":       reflectSchema(reflect.TypeOf(models.ChatRequest{})),
+			"CompletionRequest": reflectSchema(reflect.TypeOf(models.CompletionRequest{})),
+			"EmbeddingRequest":  reflectSchema(reflect.TypeOf(models.EmbeddingRequest{})),
+			"ResponsesRequest":  reflectSchema(reflect.TypeOf(models.ResponsesRequest{})),
+			"ResponseInputItem": reflectSchema(reflect.TypeOf(models.ResponseInputItem{})),
+			"GenerateRequest":   generateRequest,
+		}},
+	}
+	for name, s := range responseSchemas {
+		doc.Components.Schemas[name] = s
+	}
+	if auth {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{"bearer": {Type: "http", Scheme: "bearer"}}
+		doc.Security = []map[string][]string{{"bearer": {}}}
+	}
+	return doc
+}
+
+// inference returns a JSON operation answered with the named schema, or
+// with server-sent events when streaming
+func inference(id, summary, request, response string, streams bool) *Operation {
+	ok := &Response{Description: "OK", Content: map[string]MediaType{"application/json": {Schema: ref(response)}}}
+	if streams {
+		ok.Description = "OK; server-sent events of chunks when stream is true"
+		ok.Content["text/event-stream"] = MediaType{Schema: stringSchema()}
+	}
+	return &Operation{
+		OperationID: id,
+		Summary:     summary,
+		RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: ref(request)}}},
+		Responses:   map[string]*Response{"200": ok, "default": errorResponse()},
+	}
+}
+
+func get(id, summary, contentType string, schema *Schema) *Operation {
+	return &Operation{
+		OperationID: id,
+		Summary:     summary,
+		Responses: map[string]*Response{
+			"200":     {Description: "OK", Content: map[string]MediaType{contentType: {Schema: schema}}},
+			"default": errorResponse(),
+		},
+	}
+}
+
+func public(op *Operation) *Operation {
+	op.Security = &[]map[string][]string{}
+	return op
+}
+
+func errorResponse() *Response {
+	return &Response{Description: "Error", Content: map[string]MediaType{"application/json": {Schema: ref("Error")}}}
+}
+
+// Operations returns the request body schema of each operation that has
+// one, by "METHOD /path"
+func (d *Document) Operations() map[string]*Schema {
+	ops := make(map[string]*Schema)
+	for path, item := range d.Paths {
+		for method, op := range map[string]*Operation{"GET": item.Get, "POST": item.Post, "PUT": item.Put} {
+			if op != nil && op.RequestBody != nil {
+				ops[method+" "+path] = op.RequestBody.Content["application/json"].Schema
+			}
+		}
+	}
+	return ops
+}
+
+// Handler serves the document as JSON
+func (d *Document) Handler() fasthttp.RequestHandler {
+	body, _ := json.Marshal(d)
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetContentType("application/json")
+		ctx.Write(body)
+	}
+}
@@ -0,0 +1,275 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+
+	"oai_server/utils"
+)
+
+// ValidationError describes a request value that does not match the document
+type ValidationError struct {
+	// Param is the offending parameter, e.g. "messages[2].role"; it is empty
+	// when the body as a whole does not match
+	Param   string
+	Message string
+	// Code is "invalid_type", "missing_required_parameter",
+	// "unknown_parameter", or "invalid_value"
+	Code string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Validate checks v, as decoded by encoding/json with UseNumber, against s.
+// It returns the first value that does not match, or nil.
+func (d *Document) Validate(s *Schema, v interface{}) *ValidationError {
+	return d.validate(s, v, "")
+}
+
+func (d *Document) validate(s *Schema, v interface{}, param string) *ValidationError {
+	if s.Ref != "" {
+		return d.validate(d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], v, param)
+	}
+	if v == nil {
+		if s.Nullable || (s.Type == "" && len(s.OneOf) == 0) {
+			return nil
+		}
+		return &ValidationError{Param: param, Code: "invalid_type",
+			Message: fmt.Sprintf("Invalid type for '%s': expected %s, got null.", param, d.describe(s))}
+	}
+	if len(s.OneOf) > 0 {
+		return d.validateOneOf(s, v, param)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return d.typeError(s, v, param)
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			return invalidValue(param, "'%s' must not be empty.", param)
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return invalidValue(param, "Invalid value for '%s': %q is not one of %s.", param, str, enumList(s.Enum))
+		}
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return d.typeError(s, v, param)
+		}
+		if s.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return d.typeError(s, v, param)
+			}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return d.typeError(s, v, param)
+		}
+		return checkBounds(s, f, param)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return d.typeError(s, v, param)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return d.typeError(s, v, param)
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			return invalidValue(param, "'%s' must contain at least %d item(s).", param, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return invalidValue(param, "'%s' must contain at most %d item(s).", param, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", param, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return d.typeError(s, v, param)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				p := join(param, name)
+				return &ValidationError{Param: p, Code: "missing_required_parameter",
+					Message: fmt.Sprintf("Missing required parameter: '%s'.", p)}
+			}
+		}
+		// Check properties in a stable order so the same body always gets
+		// the same error
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				switch additional := s.AdditionalProperties.(type) {
+				case bool:
+					if !additional {
+						p := join(param, name)
+						return &ValidationError{Param: p, Code: "unknown_parameter",
+							Message: fmt.Sprintf("Unrecognized request argument supplied: %s", p)}
+					}
+				case *Schema:
+					prop = additional
+				}
+			}
+			if prop == nil {
+				continue
+			}
+			if err := d.validate(prop, obj[name], join(param, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateOneOf checks v against the alternative of its JSON type, so that
+// errors point into that alternative rather than listing them all
+func (d *Document) validateOneOf(s *Schema, v interface{}, param string) *ValidationError {
+	for _, alt := range s.OneOf {
+		if d.resolve(alt).Type == jsonType(v) || (d.resolve(alt).Type == "integer" && jsonType(v) == "number") {
+			return d.validate(alt, v, param)
+		}
+	}
+	return d.typeError(s, v, param)
+}
+
+// resolve follows a reference to a component
+func (d *Document) resolve(s *Schema) *Schema {
+	if s.Ref != "" {
+		return d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (d *Document) typeError(s *Schema, v interface{}, param string) *ValidationError {
+	return &ValidationError{Param: param, Code: "invalid_type",
+		Message: fmt.Sprintf("Invalid type for '%s': expected %s, got %s.", param, d.describe(s), jsonType(v))}
+}
+
+// describe names the types a schema accepts, such as "string or array"
+func (d *Document) describe(s *Schema) string {
+	s = d.resolve(s)
+	if len(s.OneOf) == 0 {
+		return s.Type
+	}
+	types := make([]string, len(s.OneOf))
+	for i, alt := range s.OneOf {
+		types[i] = d.resolve(alt).Type
+	}
+	return strings.Join(types, " or ")
+}
+
+func checkBounds(s *Schema, f float64, param string) *ValidationError {
+	tooLow := s.Minimum != nil && (f < *s.Minimum || (s.ExclusiveMinimum && f == *s.Minimum))
+	tooHigh := s.Maximum != nil && f > *s.Maximum
+	if !tooLow && !tooHigh {
+		return nil
+	}
+	switch {
+	case s.Minimum != nil && s.Maximum != nil && s.ExclusiveMinimum:
+		return invalidValue(param, "'%s' must be in (%v, %v], got %v.", param, *s.Minimum, *s.Maximum, f)
+	case s.Minimum != nil && s.Maximum != nil:
+		return invalidValue(param, "'%s' must be between %v and %v, got %v.", param, *s.Minimum, *s.Maximum, f)
+	case s.Minimum != nil:
+		return invalidValue(param, "'%s' must be at least %v, got %v.", param, *s.Minimum, f)
+	default:
+		return invalidValue(param, "'%s' must be at most %v, got %v.", param, *s.Maximum, f)
+	}
+}
+
+func invalidValue(param, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Param: param, Code: "invalid_value", Message: fmt.Sprintf(format, args...)}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// join appends a property name to a parameter path
+func join(param, name string) string {
+	if param == "" {
+		return name
+	}
+	return param + "." + name
+}
+
+func contains(values []interface{}, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(values []interface{}) string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = fmt.Sprint(v)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Middleware rejects requests whose JSON bodies do not match the request
+// schema of their operation in doc with 400 and the OpenAI error format,
+// naming the offending parameter. Bodies that are not JSON objects are
+// passed on for the handler to reject.
+func Middleware(doc *Document, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	operations := doc.Operations()
+
+	return func(ctx *fasthttp.RequestCtx) {
+		schema, ok := operations[string(ctx.Method())+" "+string(ctx.Path())]
+		if !ok || len(ctx.PostBody()) == 0 {
+			next(ctx)
+			return
+		}
+
+		var body map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(ctx.PostBody()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil || body == nil {
+			next(ctx)
+			return
+		}
+		if err := doc.Validate(schema, body); err != nil {
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusBadRequest, err.Message, "invalid_request_error", err.Param, err.Code)
+			return
+		}
+		next(ctx)
+	}
+}
@@ -0,0 +1,156 @@
+// Package ratelimit enforces per-API-key request rates and daily token quotas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits are the limits applied to one API key. Zero disables a limit.
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerDay      int
+}
+
+// DefaultLimits holds the limits of keys without their own, which can be
+// replaced while requests are in flight, e.g. when the configuration is
+// reloaded
+type DefaultLimits struct {
+	limits atomic.Pointer[Limits]
+}
+
+// NewDefaultLimits creates default limits holding limits
+func NewDefaultLimits(limits Limits) *DefaultLimits {
+	d := &DefaultLimits{}
+	d.Set(limits)
+	return d
+}
+
+// Get returns the current limits
+func (d *DefaultLimits) Get() Limits {
+	return *d.limits.Load()
+}
+
+// Set replaces the limits
+func (d *DefaultLimits) Set(limits Limits) {
+	d.limits.Store(&limits)
+}
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long to wait before retrying a rejected request
+	RetryAfter time.Duration
+	// Reason explains a rejection
+	Reason string
+	// RemainingRequests and RemainingTokens are -1 when the limit is disabled
+	RemainingRequests int
+	RemainingTokens   int
+}
+
+// Limiter tracks usage per key. Implementations must be safe for concurrent
+// use; the in-memory limiter is suitable for a single server, a shared store
+// such as Redis is needed when running several replicas.
+type Limiter interface {
+	// Allow counts a request against key and reports whether it may proceed.
+	// Rejected requests are not counted.
+	Allow(ctx context.Context, key string, limits Limits) (Decision, error)
+	// AddTokens charges tokens used by a completed request to key's daily quota
+	AddTokens(ctx context.Context, key string, tokens int) error
+}
+
+// keyState is the usage of one key
+type keyState struct {
+	// Request rate is a token bucket holding up to RequestsPerMinute requests,
+	// refilled continuously over a minute
+	requests   float64
+	refilledAt time.Time
+
+	// Token quota is a fixed window per UTC day
+	day        time.Time
+	tokensUsed int
+}
+
+// MemoryLimiter is an in-process Limiter
+type MemoryLimiter struct {
+	mu   sync.Mutex
+	keys map[string]*keyState
+	now  func() time.Time
+}
+
+// NewMemoryLimiter creates an in-process limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		keys: make(map[string]*keyState),
+		now:  time.Now,
+	}
+}
+
+// state returns key's state with the daily window rolled over. Callers must hold l.mu.
+func (l *MemoryLimiter) state(key string, now time.Time) *keyState {
+	day := now.UTC().Truncate(24 * time.Hour)
+	s, ok := l.keys[key]
+	if !ok {
+		s = &keyState{requests: math.Inf(1), refilledAt: now, day: day}
+		l.keys[key] = s
+	}
+	if !s.day.Equal(day) {
+		s.day = day
+		s.tokensUsed = 0
+	}
+	return s
+}
+
+// Allow implements Limiter
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limits Limits) (Decision, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.state(key, now)
+	d := Decision{Allowed: true, RemainingRequests: -1, RemainingTokens: -1}
+
+	if limits.TokensPerDay > 0 {
+		d.RemainingTokens = limits.TokensPerDay - s.tokensUsed
+		if d.RemainingTokens <= 0 {
+			d.RemainingTokens = 0
+			d.Allowed = false
+			d.RetryAfter = s.day.Add(24 * time.Hour).Sub(now)
+			d.Reason = "daily token quota exceeded"
+			return d, nil
+		}
+	}
+
+	if limits.RequestsPerMinute > 0 {
+		capacity := float64(limits.RequestsPerMinute)
+		perSecond := capacity / 60
+		s.requests = math.Min(capacity, s.requests+now.Sub(s.refilledAt).Seconds()*perSecond)
+		s.refilledAt = now
+		if s.requests < 1 {
+			d.Allowed = false
+			d.RetryAfter = time.Duration((1 - s.requests) / perSecond * float64(time.Second))
+			d.Reason = "request rate limit exceeded"
+			d.RemainingRequests = 0
+			return d, nil
+		}
+		s.requests--
+		d.RemainingRequests = int(s.requests)
+	}
+
+	return d, nil
+}
+
+// AddTokens implements Limiter
+func (l *MemoryLimiter) AddTokens(_ context.Context, key string, tokens int) error {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state(key, now).tokensUsed += tokens
+	return nil
+}
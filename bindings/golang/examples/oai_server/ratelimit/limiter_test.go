@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter whose clock is *now
+func newTestLimiter(now *time.Time) *MemoryLimiter {
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+// TestRequestRate tests that the token bucket admits a burst of
+// RequestsPerMinute requests and then refills continuously
+func TestRequestRate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+	limits := Limits{RequestsPerMinute: 60}
+	ctx := context.Background()
+
+	for i := 0; i < 60; i++ {
+		d, _ := l.Allow(ctx, "k", limits)
+		if !d.Allowed || d.RemainingRequests != 59-i {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+	d, _ := l.Allow(ctx, "k", limits)
+	if d.Allowed || d.RetryAfter != time.Second || d.RemainingRequests != 0 || d.Reason == "" {
+		t.Fatalf("request over the burst: %+v", d)
+	}
+
+	// One request a second at 60 a minute
+	now = now.Add(1500 * time.Millisecond)
+	if d, _ := l.Allow(ctx, "k", limits); !d.Allowed {
+		t.Errorf("request after refill rejected: %+v", d)
+	}
+	if d, _ := l.Allow(ctx, "k", limits); d.Allowed || d.RetryAfter != 500*time.Millisecond {
+		t.Errorf("second request after refill: %+v, want retry after 500ms", d)
+	}
+
+	// The bucket holds at most a minute's worth
+	now = now.Add(time.Hour)
+	for i := 0; i < 60; i++ {
+		l.Allow(ctx, "k", limits)
+	}
+	if d, _ := l.Allow(ctx, "k", limits); d.Allowed {
+		t.Error("bucket refilled beyond its capacity")
+	}
+
+	if d, _ := l.Allow(ctx, "other", limits); !d.Allowed {
+		t.Error("keys share a bucket")
+	}
+}
+
+// TestTokenQuota tests the daily token quota and its rollover at midnight
+// UTC, whatever the local time zone
+func TestTokenQuota(t *testing.T) {
+	// 23:30 UTC, the next day in Tokyo
+	tokyo := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2026, 1, 1, 23, 30, 0, 0, time.UTC).In(tokyo)
+	l := newTestLimiter(&now)
+	limits := Limits{TokensPerDay: 100}
+	ctx := context.Background()
+
+	if d, _ := l.Allow(ctx, "k", limits); !d.Allowed || d.RemainingTokens != 100 || d.RemainingRequests != -1 {
+		t.Fatalf("first request: %+v", d)
+	}
+	l.AddTokens(ctx, "k", 60)
+	if d, _ := l.Allow(ctx, "k", limits); !d.Allowed || d.RemainingTokens != 40 {
+		t.Fatalf("after 60 tokens: %+v", d)
+	}
+	// A request is admitted while any quota remains, and may overshoot it
+	l.AddTokens(ctx, "k", 50)
+	d, _ := l.Allow(ctx, "k", limits)
+	if d.Allowed || d.RemainingTokens != 0 || d.RetryAfter != 30*time.Minute {
+		t.Fatalf("over quota: %+v, want retry at midnight UTC", d)
+	}
+
+	now = now.Add(29 * time.Minute)
+	if d, _ := l.Allow(ctx, "k", limits); d.Allowed {
+		t.Error("quota reset before midnight UTC")
+	}
+	now = now.Add(time.Minute)
+	if d, _ := l.Allow(ctx, "k", limits); !d.Allowed || d.RemainingTokens != 100 {
+		t.Errorf("after midnight UTC: %+v", d)
+	}
+}
+
+// TestQuotaRejectionNotCounted tests that a request rejected for its quota
+// does not use up the request rate
+func TestQuotaRejectionNotCounted(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(&now)
+	ctx := context.Background()
+	limits := Limits{RequestsPerMinute: 1, TokensPerDay: 10}
+
+	l.AddTokens(ctx, "k", 10)
+	for i := 0; i < 3; i++ {
+		if d, _ := l.Allow(ctx, "k", limits); d.Allowed {
+			t.Fatal("request over quota admitted")
+		}
+	}
+	if d, _ := l.Allow(ctx, "k", Limits{RequestsPerMinute: 1}); !d.Allowed {
+		t.Error("quota rejections used up the request rate")
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// userValueKey is the RequestCtx user value holding the request's usage recorder
+const userValueKey = "ratelimit.usage"
+
+// LimitsFor returns the limits for key: the key's own limits where set,
+// otherwise defaults
+func LimitsFor(key *auth.KeyInfo, defaults Limits) Limits {
+	limits := defaults
+	if key.RequestsPerMinute > 0 {
+		limits.RequestsPerMinute = key.RequestsPerMinute
+	}
+	if key.TokensPerDay > 0 {
+		limits.TokensPerDay = key.TokensPerDay
+	}
+	return limits
+}
+
+// UsageRecorder returns a function that charges tokens to the quota of the
+// key that made the request. It never returns nil; the function is a no-op
+// when rate limiting is disabled. It may be called after the handler returns,
+// e.g. from a body stream writer.
+func UsageRecorder(ctx *fasthttp.RequestCtx) func(tokens int) {
+	if record, ok := ctx.UserValue(userValueKey).(func(int)); ok {
+		return record
+	}
+	return func(int) {}
+}
+
+// Middleware applies per-key limits to requests authenticated by
+// auth.Middleware, which must run first. Keys are identified by name, so keys
+// sharing a name share limits. Rejected requests get 429 with Retry-After.
+func Middleware(limiter Limiter, defaults *DefaultLimits, logger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		key := auth.KeyFromContext(ctx)
+		if key == nil {
+			next(ctx)
+			return
+		}
+		limits := LimitsFor(key, defaults.Get())
+		if limits == (Limits{}) {
+			next(ctx)
+			return
+		}
+
+		decision, err := limiter.Allow(ctx, key.Name, limits)
+		if err != nil {
+			// Fail open: an unavailable limiter store should not take the server down
+			logger.Error("Rate limit check failed", zap.Error(err), zap.String("key", key.Name), requestid.Field(ctx))
+			next(ctx)
+			return
+		}
+
+		header := &ctx.Response.Header
+		if limits.RequestsPerMinute > 0 {
+			header.Set("X-Ratelimit-Limit-Requests", strconv.Itoa(limits.RequestsPerMinute))
+			header.Set("X-Ratelimit-Remaining-Requests", strconv.Itoa(decision.RemainingRequests))
+		}
+		if limits.TokensPerDay > 0 {
+			header.Set("X-Ratelimit-Limit-Tokens", strconv.Itoa(limits.TokensPerDay))
+			header.Set("X-Ratelimit-Remaining-Tokens", strconv.Itoa(decision.RemainingTokens))
+		}
+
+		if !decision.Allowed {
+			retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			logger.Warn("Rejected rate limited request",
+				zap.String("key", key.Name),
+				zap.String("tenant", key.Tenant),
+				zap.String("reason", decision.Reason),
+				zap.Int("retry_after", retryAfter),
+				requestid.Field(ctx),
+			)
+			header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusTooManyRequests,
+				fmt.Sprintf("Rate limit reached for key %q: %s. Retry after %d seconds.", key.Name, decision.Reason, retryAfter),
+				"rate_limit_exceeded", "", "rate_limit_exceeded")
+			return
+		}
+
+		if limits.TokensPerDay > 0 {
+			name := key.Name
+			idField := requestid.Field(ctx)
+			ctx.SetUserValue(userValueKey, func(tokens int) {
+				if tokens <= 0 {
+					return
+				}
+				if err := limiter.AddTokens(context.Background(), name, tokens); err != nil {
+					logger.Error("Failed to record token usage", zap.Error(err), zap.String("key", name), idField)
+				}
+			})
+		}
+
+		next(ctx)
+	}
+}
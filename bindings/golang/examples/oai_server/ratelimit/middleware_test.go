@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+)
+
+// TestLimitsFor tests that a key's own limits override the defaults
+func TestLimitsFor(t *testing.T) {
+	defaults := Limits{RequestsPerMinute: 10, TokensPerDay: 1000}
+	tests := []struct {
+		key  auth.KeyInfo
+		want Limits
+	}{
+		{auth.KeyInfo{}, defaults},
+		{auth.KeyInfo{RequestsPerMinute: 5}, Limits{RequestsPerMinute: 5, TokensPerDay: 1000}},
+		{auth.KeyInfo{TokensPerDay: 50}, Limits{RequestsPerMinute: 10, TokensPerDay: 50}},
+		{auth.KeyInfo{RequestsPerMinute: 1, TokensPerDay: 2}, Limits{RequestsPerMinute: 1, TokensPerDay: 2}},
+	}
+	for _, tt := range tests {
+		if got := LimitsFor(&tt.key, defaults); got != tt.want {
+			t.Errorf("LimitsFor(%+v) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+	if got := LimitsFor(&auth.KeyInfo{TokensPerDay: 50}, Limits{}); got != (Limits{TokensPerDay: 50}) {
+		t.Errorf("LimitsFor() without defaults = %+v", got)
+	}
+}
+
+// serve runs a request authenticated with token through the auth and rate
+// limit middleware, calling handler if it is admitted
+func serve(store auth.KeyStore, limiter Limiter, defaults Limits, token string, handler fasthttp.RequestHandler) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/v1/chat/completions")
+	ctx.Request.Header.Set("Authorization", "Bearer "+token)
+	logger := zap.NewNop()
+	auth.Middleware(store, logger, Middleware(limiter, NewDefaultLimits(defaults), logger, handler))(&ctx)
+	return &ctx
+}
+
+// TestMiddleware tests the rate limit headers, 429 responses, and charging
+// usage to the key's quota
+func TestMiddleware(t *testing.T) {
+	store, err := auth.NewStaticKeyStore([]auth.KeyInfo{
+		{Key: "sk-a", Name: "a", RequestsPerMinute: 2},
+		{Key: "sk-b", Name: "b", TokensPerDay: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewMemoryLimiter()
+
+	for i, want := range []int{200, 200, 429} {
+		ctx := serve(store, limiter, Limits{}, "sk-a", func(ctx *fasthttp.RequestCtx) {})
+		if ctx.Response.StatusCode() != want {
+			t.Fatalf("request %d: status %d, want %d", i, ctx.Response.StatusCode(), want)
+		}
+		header := &ctx.Response.Header
+		if string(header.Peek("X-Ratelimit-Limit-Requests")) != "2" || len(header.Peek("X-Ratelimit-Limit-Tokens")) != 0 {
+			t.Errorf("request %d: headers %s", i, header.Header())
+		}
+		if want == 429 && string(header.Peek(fasthttp.HeaderRetryAfter)) != "30" {
+			t.Errorf("Retry-After = %q, want 30", header.Peek(fasthttp.HeaderRetryAfter))
+		}
+	}
+
+	ctx := serve(store, limiter, Limits{}, "sk-b", func(ctx *fasthttp.RequestCtx) {
+		UsageRecorder(ctx)(120)
+	})
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Header.Peek("X-Ratelimit-Remaining-Tokens")) != "100" {
+		t.Fatalf("first request of b: status %d, headers %s", ctx.Response.StatusCode(), ctx.Response.Header.Header())
+	}
+	ctx = serve(store, limiter, Limits{}, "sk-b", func(ctx *fasthttp.RequestCtx) {
+		t.Error("request over quota reached the handler")
+	})
+	if ctx.Response.StatusCode() != 429 || string(ctx.Response.Header.Peek("X-Ratelimit-Remaining-Tokens")) != "0" {
+		t.Errorf("request over quota: status %d, headers %s", ctx.Response.StatusCode(), ctx.Response.Header.Header())
+	}
+}
+
+// TestMiddlewareUnlimited tests that requests without limits, or whose
+// limiter fails, are let through
+func TestMiddlewareUnlimited(t *testing.T) {
+	store, err := auth.ParseKeyList("sk-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached := false
+	ctx := serve(store, NewMemoryLimiter(), Limits{}, "sk-a", func(ctx *fasthttp.RequestCtx) {
+		reached = true
+		UsageRecorder(ctx)(10) // a no-op
+	})
+	if !reached || len(ctx.Response.Header.Peek("X-Ratelimit-Limit-Requests")) != 0 {
+		t.Error("request without limits was limited")
+	}
+
+	reached = false
+	serve(store, failingLimiter{}, Limits{RequestsPerMinute: 1}, "sk-a", func(*fasthttp.RequestCtx) { reached = true })
+	if !reached {
+		t.Error("request was rejected when the limiter failed")
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Limits) (Decision, error) {
+	return Decision{}, errors.New("unavailable")
+}
+
+func (failingLimiter) AddTokens(context.Context, string, int) error {
+	return errors.New("unavailable")
+}
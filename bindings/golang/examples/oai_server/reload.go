@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/config"
+	"oai_server/ratelimit"
+	"oai_server/secrets"
+	"oai_server/service"
+	"oai_server/transform"
+	"oai_server/usage"
+)
+
+// configReloader applies configuration changes without a restart: API keys,
+// default rate limits, tenant token ceilings, request policies, model
+// aliases, and the default workers. Other changed settings are logged as
+// needing a restart.
+type configReloader struct {
+	// path is the config file; empty when configured by environment only
+	path    string
+	logger  *zap.Logger
+	service *service.SMGService
+	// keyStore and rateLimits are nil when authentication is disabled
+	keyStore   *auth.ReloadableKeyStore
+	rateLimits *ratelimit.DefaultLimits
+	usage      *usage.Tracker
+	policies   *transform.Policies
+	// startup is the configuration the server started with, which settings
+	// that need a restart are compared against
+	startup *config.Config
+
+	mu      sync.Mutex
+	current *config.Config
+	// fingerprint is the digest of the watched files' contents when last
+	// loaded
+	fingerprint string
+}
+
+// newConfigReloader creates a reloader for a server started with cfg, loaded
+// from path
+func newConfigReloader(path string, cfg *config.Config, logger *zap.Logger, smgService *service.SMGService,
+	keyStore *auth.ReloadableKeyStore, rateLimits *ratelimit.DefaultLimits, usageTracker *usage.Tracker,
+	policies *transform.Policies) *configReloader {
+	r := &configReloader{
+		path:       path,
+		logger:     logger,
+		service:    smgService,
+		keyStore:   keyStore,
+		rateLimits: rateLimits,
+		usage:      usageTracker,
+		policies:   policies,
+		startup:    cfg,
+		current:    cfg,
+	}
+	r.fingerprint, _ = secrets.Fingerprint(r.watchedFiles(cfg)...)
+	return r
+}
+
+// Reload loads the configuration again and applies what changed. An invalid
+// configuration is rejected as a whole, keeping the current one.
+func (r *configReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Taken before reading so that writes during the reload are seen by the
+	// next check
+	fingerprint, _ := secrets.Fingerprint(r.watchedFiles(r.current)...)
+	next, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+
+	// Build everything before applying anything
+	authEnabled := next.APIKeys != "" || next.AdminAPIKeys != "" || next.APIKeysFile != "" || next.APIKeysDir != ""
+	if authEnabled != (r.keyStore != nil) {
+		return errors.New("authentication cannot be enabled or disabled without a restart")
+	}
+	var keyStore *auth.StaticKeyStore
+	if authEnabled {
+		if keyStore, err = auth.LoadKeys(next.APIKeys, next.AdminAPIKeys, next.APIKeysFile, next.APIKeysDir); err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+	}
+	tenantLimits, err := usage.ParseLimits(next.TenantMonthlyTokens)
+	if err != nil {
+		return fmt.Errorf("invalid tenant token limits: %w", err)
+	}
+	// Alias groups are indices into the running groups, which only change
+	// with a restart
+	groupsChanged := !reflect.DeepEqual(next.WorkerGroups, r.startup.WorkerGroups)
+	var aliases *service.AliasRoutes
+	if !groupsChanged {
+		if aliases, err = r.service.ResolveModelAliases(modelAliases(next)); err != nil {
+			return fmt.Errorf("invalid model aliases: %w", err)
+		}
+	}
+
+	if keyStore != nil {
+		r.keyStore.Set(keyStore)
+		r.rateLimits.Set(ratelimit.Limits{
+			RequestsPerMinute: next.RateLimitRPM,
+			TokensPerDay:      next.TokenQuotaPerDay,
+		})
+	}
+	r.usage.SetLimits(tenantLimits)
+	r.policies.Set(requestPolicies(next))
+
+	if groupsChanged {
+		r.logger.Warn("Worker groups changed, keeping the current model aliases until a restart")
+	} else {
+		r.service.ApplyModelAliases(aliases)
+	}
+
+	// Workers follow the configured endpoints only when those change, so
+	// workers added through the admin API stay otherwise
+	if next.Endpoints != r.current.Endpoints {
+		added, removed, err := r.service.SetEndpoints(next.Endpoints)
+		if err != nil {
+			// Retried on the next reload
+			next.Endpoints = r.current.Endpoints
+			r.logger.Error("Failed to update workers", zap.Error(err), zap.Strings("added", added), zap.Strings("removed", removed))
+		} else {
+			r.logger.Info("Updated workers", zap.Strings("added", added), zap.Strings("removed", removed))
+		}
+	}
+
+	if restart := r.startup.RestartRequired(next); len(restart) > 0 {
+		r.logger.Warn("Changed settings take effect after a restart", zap.Strings("settings", restart))
+	}
+
+	r.current = next
+	r.fingerprint = fingerprint
+	r.logger.Info("Reloaded configuration",
+		zap.Int("keys", r.keyCount()),
+		zap.Int("model_aliases", len(next.ModelAliases)),
+		zap.Int("rate_limit_rpm", next.RateLimitRPM),
+		zap.Int("token_quota_per_day", next.TokenQuotaPerDay),
+	)
+	return nil
+}
+
+// ReloadAndLog reloads the configuration, logging a failure along with what
+// triggered the reload
+func (r *configReloader) ReloadAndLog(trigger string) {
+	if err := r.Reload(); err != nil {
+		r.logger.Error("Failed to reload configuration, keeping the current one",
+			zap.String("trigger", trigger), zap.Error(err))
+	}
+}
+
+// Watch reloads the configuration whenever the config file, API key file, or
+// API key directory changes, checking every interval until ctx is done.
+// Failed reloads are retried at the next change.
+func (r *configReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		files, loaded := r.watchedFiles(r.current), r.fingerprint
+		r.mu.Unlock()
+		fingerprint, err := secrets.Fingerprint(files...)
+		if err != nil {
+			r.logger.Warn("Failed to check configuration files", zap.Error(err))
+			continue
+		}
+		if fingerprint == loaded {
+			continue
+		}
+
+		r.ReloadAndLog("file change")
+		// A failed reload is not retried until the files change again
+		r.mu.Lock()
+		r.fingerprint = fingerprint
+		r.mu.Unlock()
+	}
+}
+
+// keyCount returns the number of API keys, 0 when authentication is disabled
+func (r *configReloader) keyCount() int {
+	if r.keyStore == nil {
+		return 0
+	}
+	return r.keyStore.Len()
+}
+
+// watchedFiles returns the files and directories whose changes trigger a
+// reload under cfg
+func (r *configReloader) watchedFiles(cfg *config.Config) []string {
+	var files []string
+	if r.path != "" {
+		files = append(files, r.path)
+	}
+	if cfg.APIKeysFile != "" {
+		files = append(files, cfg.APIKeysFile)
+	}
+	if cfg.APIKeysDir != "" {
+		files = append(files, cfg.APIKeysDir)
+	}
+	return files
+}
+
+// requestPolicies returns the request policies of cfg by tenant
+func requestPolicies(cfg *config.Config) map[string]*transform.Policy {
+	policies := make(map[string]*transform.Policy, len(cfg.Policies))
+	for tenant, policy := range cfg.Policies {
+		policies[tenant] = &transform.Policy{
+			SystemPrompt:        policy.SystemPrompt,
+			ReplaceSystemPrompt: policy.SystemPromptMode == "replace",
+			MaxTokens:           policy.MaxTokens,
+			MaxTemperature:      policy.MaxTemperature,
+			MaxTopP:             policy.MaxTopP,
+			StripFields:         policy.StripFields,
+		}
+	}
+	return policies
+}
+
+// modelAliases returns the model aliases of cfg, with each alias's labels
+// resolved to the index of its worker group
+func modelAliases(cfg *config.Config) []service.ModelAlias {
+	aliases := make([]service.ModelAlias, 0, len(cfg.ModelAliases))
+	for name, alias := range cfg.ModelAliases {
+		group := -1
+		if len(alias.Labels) > 0 {
+			group = cfg.GroupFor(alias.Labels)
+		}
+		aliases = append(aliases, service.ModelAlias{Name: name, Target: alias.Model, Group: group})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases
+}
@@ -0,0 +1,67 @@
+// Package requestid assigns every HTTP request an ID used in logs, error
+// bodies, and the gRPC metadata sent to workers.
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// Header is the HTTP header carrying the request ID in both directions
+const Header = "X-Request-ID"
+
+// maxLength bounds client-supplied IDs so they stay cheap to log and forward
+const maxLength = 128
+
+// userValueKey is the RequestCtx user value holding the request ID
+const userValueKey = "requestid"
+
+// FromContext returns the request's ID, or "" outside Middleware
+func FromContext(ctx *fasthttp.RequestCtx) string {
+	id, _ := ctx.UserValue(userValueKey).(string)
+	return id
+}
+
+// Field returns the request's ID as a log field
+func Field(ctx *fasthttp.RequestCtx) zap.Field {
+	return zap.String("request_id", FromContext(ctx))
+}
+
+// Middleware accepts the client's X-Request-ID if it is valid, or generates
+// one, and echoes it in the response. It should wrap all other middleware so
+// that every response carries the ID.
+func Middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		id := string(ctx.Request.Header.Peek(Header))
+		if !valid(id) {
+			id = generate()
+		}
+		ctx.SetUserValue(userValueKey, id)
+		ctx.Response.Header.Set(Header, id)
+		next(ctx)
+	}
+}
+
+// valid reports whether id is non-empty, bounded, and visible ASCII, so it
+// is safe to use as a header, a log field, and gRPC metadata
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// generate returns a random 128-bit hex ID
+func generate() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
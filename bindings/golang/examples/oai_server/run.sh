@@ -1,9 +1,11 @@
 #!/bin/bash
 
 # OpenAI-compatible server runner
-# Usage: ./run.sh [tokenizer_path] [endpoint] [port] [--profile] [--pprof-port PORT]
+# Usage: ./run.sh [tokenizer_path] [endpoint] [port] [--config FILE] [--profile] [--pprof-port PORT]
 #
 # Options:
+#   --config FILE      Load settings from a YAML config file; positional
+#                      arguments and environment variables override it
 #   --profile          Enable pprof profiling (default port: 6060)
 #   --pprof-port PORT  Set pprof port (default: 6060, requires --profile)
 
@@ -39,9 +41,14 @@ PPROF_PORT="6060"
 TOKENIZER_PATH=""
 ENDPOINT=""
 PORT=""
+CONFIG_FILE=""
 
 while [[ $# -gt 0 ]]; do
 	case $1 in
+		--config)
+			CONFIG_FILE="$2"
+			shift 2
+			;;
 		--profile)
 			ENABLE_PROFILE=true
 			shift
@@ -64,6 +71,11 @@ while [[ $# -gt 0 ]]; do
 	esac
 done
 
+# Remember explicit arguments before defaults are applied
+EXPLICIT_TOKENIZER_PATH="$TOKENIZER_PATH"
+EXPLICIT_ENDPOINT="$ENDPOINT"
+EXPLICIT_PORT="$PORT"
+
 # Default configuration
 DEFAULT_TOKENIZER_PATH="${SGL_TOKENIZER_PATH:-../tokenizer}"
 DEFAULT_ENDPOINT="${SGL_GRPC_ENDPOINT:-grpc://localhost:20000}"
@@ -78,6 +90,9 @@ echo "Library path: ${LIB_DIR}"
 echo "Tokenizer: $TOKENIZER_PATH"
 echo "Endpoint: $ENDPOINT"
 echo "Port: $PORT"
+if [[ -n "$CONFIG_FILE" ]]; then
+	echo "Config file: $CONFIG_FILE (overridden by explicit arguments)"
+fi
 echo "Client Mode: gRPC (default)"
 echo "FFI Postprocessing: ENABLED (normal mode)"
 echo "FFI Preprocessing: ENABLED (normal mode)"
@@ -108,4 +123,12 @@ echo "Syncing Go module dependencies..."
 go mod tidy
 
 # Run the server (use ./main.go to ensure module context is correct)
-SGL_TOKENIZER_PATH="$TOKENIZER_PATH" SGL_GRPC_ENDPOINT="$ENDPOINT" PORT="$PORT" go run ./main.go
+if [[ -n "$CONFIG_FILE" ]]; then
+	# Only explicit arguments and environment variables override the config file
+	[[ -n "$EXPLICIT_TOKENIZER_PATH" ]] && export SGL_TOKENIZER_PATH="$EXPLICIT_TOKENIZER_PATH"
+	[[ -n "$EXPLICIT_ENDPOINT" ]] && export SGL_GRPC_ENDPOINT="$EXPLICIT_ENDPOINT"
+	[[ -n "$EXPLICIT_PORT" ]] && export PORT="$EXPLICIT_PORT"
+	go run ./main.go --config "$CONFIG_FILE"
+else
+	SGL_TOKENIZER_PATH="$TOKENIZER_PATH" SGL_GRPC_ENDPOINT="$ENDPOINT" PORT="$PORT" go run ./main.go
+fi
@@ -0,0 +1,73 @@
+// Package secrets reads secrets mounted as files and directories, such as
+// Kubernetes secret volumes, and detects when they are rotated.
+//
+// Kubernetes updates a secret volume by writing the new files to a hidden
+// directory and swapping a symlink to it, which may leave modification times
+// unchanged. Changes are therefore detected by content.
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files returns the paths of the secret files in dir, sorted: its regular
+// files and symlinks to them, except hidden ones such as Kubernetes's
+// "..data"
+func Files(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Stat follows the symlinks of secret volumes
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Fingerprint returns a digest of the contents of paths, each a file or a
+// directory of secret files (see Files). It changes whenever a file is
+// changed, added, or removed.
+func Fingerprint(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = Files(path); err != nil {
+				return "", err
+			}
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			// Lengths keep names and contents from running together
+			fmt.Fprintf(h, "%d:%s%d:", len(file), file, len(data))
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -2,89 +2,120 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	smg "github.com/lightseek/smg/go-grpc-sdk"
 )
 
-// ChatClient interface defines methods for chat completion operations.
-// Both smg.Client and smg.MultiClient implement this interface.
-type ChatClient interface {
-	CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error)
-	CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (ChatStream, error)
-	Close() error
+// WorkerManager adds, removes, and drains workers at runtime. Workers are
+// acted on by endpoint, as indices shift when workers are removed.
+// smg.MultiClient implements this interface.
+type WorkerManager interface {
+	Workers() ([]smg.WorkerStatus, error)
+	AddWorker(endpoint string) error
+	SetWorkers(endpoints []string) (added, removed []string, err error)
+	RemoveWorkerByEndpoint(endpoint string) error
+	DrainWorkerByEndpoint(ctx context.Context, endpoint string) error
+	SetWorkerHealthByEndpoint(endpoint string, healthy bool) error
 }
 
-// ChatStream interface defines methods for streaming chat completion.
-type ChatStream interface {
-	RecvJSON() (string, error)
-	Close() error
-}
-
-// singleClientWrapper wraps *smg.Client to implement ChatClient interface
-type singleClientWrapper struct {
-	client *smg.Client
-}
-
-func (w *singleClientWrapper) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
-	return w.client.CreateChatCompletion(ctx, req)
-}
+// SMGService wraps SMG client (supports both single and multi-worker)
+type SMGService struct {
+	chatClient smg.Backend
+	// workerManager is nil for a single worker
+	workerManager WorkerManager
+	// endpoint is the worker of a single-worker setup
+	endpoint string
+	// Keep references for info purposes
+	isMultiWorker bool
+	policyName    string
 
-func (w *singleClientWrapper) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (ChatStream, error) {
-	return w.client.CreateChatCompletionStream(ctx, req)
-}
+	// groups are labeled worker pools, each with its own client
+	groups []workerGroup
 
-func (w *singleClientWrapper) Close() error {
-	return w.client.Close()
+	mu sync.RWMutex
+	// aliases maps requested model names to their routes
+	aliases map[string]Route
 }
 
-// multiClientWrapper wraps *smg.MultiClient to implement ChatClient interface
-type multiClientWrapper struct {
-	client *smg.MultiClient
+// workerGroup is a labeled worker pool
+type workerGroup struct {
+	client smg.Backend
+	// manager is nil for a single worker
+	manager  WorkerManager
+	endpoint string
 }
 
-func (w *multiClientWrapper) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
-	return w.client.CreateChatCompletion(ctx, req)
+// ModelAlias routes requests for Name to the Target model on a worker group,
+// or on the default workers if Group is -1. An empty Target keeps the name.
+type ModelAlias struct {
+	Name   string
+	Target string
+	Group  int
 }
 
-func (w *multiClientWrapper) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (ChatStream, error) {
-	return w.client.CreateChatCompletionStream(ctx, req)
+// Route is where requests for a model are sent
+type Route struct {
+	// Model is the name the client requested and sees in responses
+	Model string
+	// Target is the model name sent to the workers
+	Target string
+	Client smg.Backend
 }
 
-func (w *multiClientWrapper) Close() error {
-	return w.client.Close()
+// Aliased reports whether the workers know the model by another name
+func (r Route) Aliased() bool {
+	return r.Target != r.Model
 }
 
-// SMGService wraps SMG client (supports both single and multi-worker)
-type SMGService struct {
-	chatClient ChatClient
-	// Keep references for info purposes
-	isMultiWorker bool
-	workerCount   int
-	policyName    string
+// ResponseModel returns the model name to report in a response whose model
+// the workers set to workerModel, hiding the target name of aliases
+func (r Route) ResponseModel(workerModel string) string {
+	if r.Aliased() {
+		return r.Model
+	}
+	return workerModel
 }
 
 // NewSMGService creates a new SMG service.
 // If endpoints contains multiple comma-separated endpoints, uses MultiClient with load balancing.
 // Otherwise uses single Client for backwards compatibility.
 func NewSMGService(endpoints, tokenizerPath, policyName string) (*SMGService, error) {
-	// Parse endpoints
-	endpointList := strings.Split(endpoints, ",")
-	for i := range endpointList {
-		endpointList[i] = strings.TrimSpace(endpointList[i])
+	chatClient, multiClient, err := newChatClient(endpoints, tokenizerPath, policyName)
+	if err != nil {
+		return nil, err
 	}
-
-	// Filter empty endpoints
-	var validEndpoints []string
-	for _, ep := range endpointList {
-		if ep != "" {
-			validEndpoints = append(validEndpoints, ep)
-		}
+	if multiClient == nil {
+		return &SMGService{
+			chatClient:    chatClient,
+			endpoint:      strings.Join(splitEndpoints(endpoints), ","),
+			isMultiWorker: false,
+			policyName:    "",
+		}, nil
 	}
+	return &SMGService{
+		chatClient:    chatClient,
+		workerManager: multiClient,
+		isMultiWorker: true,
+		policyName:    multiClient.PolicyName(),
+	}, nil
+}
 
+// NewSMGServiceWithClient wraps the client of a single worker at endpoint,
+// e.g. one configured beyond what NewSMGService supports, or a fake in tests
+func NewSMGServiceWithClient(client smg.Backend, endpoint string) *SMGService {
+	return &SMGService{chatClient: client, endpoint: endpoint}
+}
+
+// newChatClient creates a MultiClient for several endpoints or a Client for
+// one. The MultiClient is also returned so that its workers can be managed.
+func newChatClient(endpoints, tokenizerPath, policyName string) (smg.Backend, *smg.MultiClient, error) {
+	validEndpoints := splitEndpoints(endpoints)
 	if len(validEndpoints) == 0 {
-		return nil, fmt.Errorf("no valid gRPC endpoints provided in endpoints string: %q", endpoints)
+		return nil, nil, fmt.Errorf("no valid gRPC endpoints provided in endpoints string: %q", endpoints)
 	}
 
 	if len(validEndpoints) > 1 {
@@ -95,14 +126,9 @@ func NewSMGService(endpoints, tokenizerPath, policyName string) (*SMGService, er
 			PolicyName:    policyName,
 		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return &SMGService{
-			chatClient:    &multiClientWrapper{client: multiClient},
-			isMultiWorker: true,
-			workerCount:   multiClient.WorkerCount(),
-			policyName:    multiClient.PolicyName(),
-		}, nil
+		return multiClient, multiClient, nil
 	}
 
 	// Single endpoint: use regular Client for backwards compatibility
@@ -111,19 +137,121 @@ func NewSMGService(endpoints, tokenizerPath, policyName string) (*SMGService, er
 		TokenizerPath: tokenizerPath,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return client, nil, nil
+}
 
-	return &SMGService{
-		chatClient:    &singleClientWrapper{client: client},
-		isMultiWorker: false,
-		workerCount:   1,
-		policyName:    "",
-	}, nil
+// splitEndpoints parses a comma-separated endpoint list, skipping empty entries
+func splitEndpoints(endpoints string) []string {
+	var valid []string
+	for _, ep := range strings.Split(endpoints, ",") {
+		if ep = strings.TrimSpace(ep); ep != "" {
+			valid = append(valid, ep)
+		}
+	}
+	return valid
+}
+
+// SetEndpoints changes the default workers to the comma-separated endpoints,
+// keeping the workers listed in both. Only multi-worker setups can change
+// their workers; a single-worker client needs a restart.
+func (s *SMGService) SetEndpoints(endpoints string) (added, removed []string, err error) {
+	if s.workerManager == nil {
+		return nil, nil, errors.New("the workers of a single-worker client cannot change without a restart")
+	}
+	endpointList := splitEndpoints(endpoints)
+	if len(endpointList) == 0 {
+		return nil, nil, fmt.Errorf("no valid gRPC endpoints provided in endpoints string: %q", endpoints)
+	}
+	return s.workerManager.SetWorkers(endpointList)
+}
+
+// AddWorkerGroup connects a labeled pool of workers and returns its index
+// for SetModelAliases. It must be called before the service handles requests.
+func (s *SMGService) AddWorkerGroup(endpoints, tokenizerPath, policyName string) (int, error) {
+	client, multiClient, err := newChatClient(endpoints, tokenizerPath, policyName)
+	if err != nil {
+		return 0, err
+	}
+	group := workerGroup{client: client, endpoint: strings.Join(splitEndpoints(endpoints), ",")}
+	if multiClient != nil {
+		group.manager = multiClient
+	}
+	s.groups = append(s.groups, group)
+	return len(s.groups) - 1, nil
+}
+
+// AliasRoutes are model aliases resolved to their workers by
+// ResolveModelAliases, ready to be applied with ApplyModelAliases
+type AliasRoutes struct {
+	routes map[string]Route
+}
+
+// ResolveModelAliases resolves aliases to their workers without applying
+// them, so that a configuration can be validated as a whole first
+func (s *SMGService) ResolveModelAliases(aliases []ModelAlias) (*AliasRoutes, error) {
+	routes := make(map[string]Route, len(aliases))
+	for _, alias := range aliases {
+		client := s.chatClient
+		if alias.Group >= 0 {
+			if alias.Group >= len(s.groups) {
+				return nil, fmt.Errorf("model alias %q: worker group %d does not exist", alias.Name, alias.Group)
+			}
+			client = s.groups[alias.Group].client
+		}
+		target := alias.Target
+		if target == "" {
+			target = alias.Name
+		}
+		routes[alias.Name] = Route{Model: alias.Name, Target: target, Client: client}
+	}
+	return &AliasRoutes{routes: routes}, nil
+}
+
+// ApplyModelAliases replaces all model aliases with resolved ones. It may be
+// called while the service handles requests.
+func (s *SMGService) ApplyModelAliases(aliases *AliasRoutes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases = aliases.routes
+}
+
+// SetModelAliases resolves and replaces all model aliases. It may be called
+// while the service handles requests; on error the current aliases are kept.
+func (s *SMGService) SetModelAliases(aliases []ModelAlias) error {
+	routes, err := s.ResolveModelAliases(aliases)
+	if err != nil {
+		return err
+	}
+	s.ApplyModelAliases(routes)
+	return nil
+}
+
+// Route returns where to send a request for model. Models without an alias
+// go to the default workers unchanged.
+func (s *SMGService) Route(model string) Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if route, ok := s.aliases[model]; ok {
+		return route
+	}
+	return Route{Model: model, Target: model, Client: s.chatClient}
 }
 
-// ChatClient returns the underlying chat client interface
-func (s *SMGService) ChatClient() ChatClient {
+// ModelAliases returns the target model of each alias
+func (s *SMGService) ModelAliases() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	aliases := make(map[string]string, len(s.aliases))
+	for name, route := range s.aliases {
+		aliases[name] = route.Target
+	}
+	return aliases
+}
+
+// ChatClient returns the client of the default workers
+func (s *SMGService) ChatClient() smg.Backend {
 	return s.chatClient
 }
 
@@ -132,9 +260,51 @@ func (s *SMGService) IsMultiWorker() bool {
 	return s.isMultiWorker
 }
 
-// WorkerCount returns the number of workers
+// WorkerManager returns the worker manager of a multi-worker setup, or nil
+// for a single worker
+func (s *SMGService) WorkerManager() WorkerManager {
+	return s.workerManager
+}
+
+// WorkerCount returns the current number of workers
 func (s *SMGService) WorkerCount() int {
-	return s.workerCount
+	if s.workerManager == nil {
+		return 1
+	}
+	workers, err := s.workerManager.Workers()
+	if err != nil {
+		return 0
+	}
+	return len(workers)
+}
+
+// Workers returns the status of the default workers. A single worker is
+// reported without load, which only multi-worker clients track.
+func (s *SMGService) Workers() ([]smg.WorkerStatus, error) {
+	return workerStatus(s.chatClient, s.workerManager, s.endpoint)
+}
+
+// GroupCount returns the number of worker groups
+func (s *SMGService) GroupCount() int {
+	return len(s.groups)
+}
+
+// GroupWorkers returns the status of the workers of a group
+func (s *SMGService) GroupWorkers(group int) ([]smg.WorkerStatus, error) {
+	if group < 0 || group >= len(s.groups) {
+		return nil, fmt.Errorf("worker group %d does not exist", group)
+	}
+	g := s.groups[group]
+	return workerStatus(g.client, g.manager, g.endpoint)
+}
+
+// workerStatus lists the workers of a pool; manager is nil for a single
+// worker at endpoint
+func workerStatus(client smg.Backend, manager WorkerManager, endpoint string) ([]smg.WorkerStatus, error) {
+	if manager != nil {
+		return manager.Workers()
+	}
+	return []smg.WorkerStatus{{Endpoint: endpoint, Healthy: client.HealthyWorkerCount() > 0}}, nil
 }
 
 // PolicyName returns the load balancing policy name (empty for single worker)
@@ -142,10 +312,14 @@ func (s *SMGService) PolicyName() string {
 	return s.policyName
 }
 
-// Close closes the SMG client
+// Close closes the SMG clients of the default workers and all groups
 func (s *SMGService) Close() error {
+	var errs []error
 	if s.chatClient != nil {
-		return s.chatClient.Close()
+		errs = append(errs, s.chatClient.Close())
 	}
-	return nil
+	for _, group := range s.groups {
+		errs = append(errs, group.client.Close())
+	}
+	return errors.Join(errs...)
 }
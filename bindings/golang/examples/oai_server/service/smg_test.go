@@ -0,0 +1,40 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestModelAliases tests resolving aliases to worker groups, and that aliases
+// which do not resolve leave the current ones in place
+func TestModelAliases(t *testing.T) {
+	s := &SMGService{groups: []workerGroup{{endpoint: "grpc://group0:20000"}}}
+
+	if err := s.SetModelAliases([]ModelAlias{
+		{Name: "fast", Target: "llama-8b", Group: -1},
+		{Name: "big", Target: "llama-70b", Group: 0},
+		{Name: "same", Group: -1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"fast": "llama-8b", "big": "llama-70b", "same": "same"}
+	if got := s.ModelAliases(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ModelAliases() = %v, want %v", got, want)
+	}
+	if route := s.Route("big"); route.Model != "big" || route.Target != "llama-70b" || !route.Aliased() {
+		t.Errorf("Route(big) = %+v", route)
+	}
+	if route := s.Route("other"); route.Target != "other" || route.Aliased() {
+		t.Errorf("Route(other) = %+v", route)
+	}
+
+	if _, err := s.ResolveModelAliases([]ModelAlias{{Name: "fast", Group: -1}, {Name: "bad", Group: 1}}); err == nil {
+		t.Error("alias of a missing worker group resolved")
+	}
+	if err := s.SetModelAliases([]ModelAlias{{Name: "bad", Group: 1}}); err == nil {
+		t.Error("SetModelAliases() accepted a missing worker group")
+	}
+	if got := s.ModelAliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ModelAliases() = %v after failed updates, want %v", got, want)
+	}
+}
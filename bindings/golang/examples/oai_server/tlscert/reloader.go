@@ -0,0 +1,107 @@
+// Package tlscert serves a TLS certificate from disk and picks up rotated
+// certificates without a restart.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"oai_server/secrets"
+)
+
+// Reloader holds the certificate and key loaded from a pair of PEM files.
+// Use GetCertificate as tls.Config.GetCertificate so that new connections
+// get the current certificate.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// fingerprint is the digest of the files' contents when last loaded
+	fingerprint string
+}
+
+// NewReloader loads the certificate and key from certFile and keyFile
+func NewReloader(certFile, keyFile string, logger *zap.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the current certificate
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// GetCertificate returns the current certificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate and key from disk. On failure the current
+// certificate is kept.
+func (r *Reloader) Reload() error {
+	fingerprint, err := secrets.Fingerprint(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.fingerprint = fingerprint
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the certificate whenever either file's contents change,
+// checking every interval until ctx is done. Failed reloads are logged and
+// retried at the next check, so a half-written rotation does not take the
+// server down.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fingerprint, err := secrets.Fingerprint(r.certFile, r.keyFile)
+		if err != nil {
+			r.logger.Warn("Failed to check TLS certificate", zap.Error(err))
+			continue
+		}
+		r.mu.RLock()
+		changed := fingerprint != r.fingerprint
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			r.logger.Error("Failed to reload TLS certificate, keeping the current one", zap.Error(err))
+			continue
+		}
+		r.logger.Info("Reloaded TLS certificate", zap.String("cert_file", r.certFile))
+	}
+}
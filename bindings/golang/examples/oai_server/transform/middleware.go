@@ -0,0 +1,41 @@
+package transform
+
+import (
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+)
+
+// Middleware rewrites inference requests by the policy of the tenant of the
+// key that made them, so auth.Middleware must run first when enabled.
+// Malformed bodies are passed on unchanged for the handler to reject.
+func Middleware(policies *Policies, logger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ep, ok := endpoints[string(ctx.Path())]
+		if !ok || len(ctx.PostBody()) == 0 {
+			next(ctx)
+			return
+		}
+
+		var tenant string
+		if key := auth.KeyFromContext(ctx); key != nil {
+			tenant = key.Tenant
+		}
+		policy := policies.For(tenant)
+		if policy == nil {
+			next(ctx)
+			return
+		}
+
+		body, err := policy.apply(ep, ctx.PostBody())
+		if err != nil {
+			logger.Debug("Request body not transformed", zap.Error(err), zap.String("tenant", tenant), requestid.Field(ctx))
+			next(ctx)
+			return
+		}
+		ctx.Request.SetBody(body)
+		next(ctx)
+	}
+}
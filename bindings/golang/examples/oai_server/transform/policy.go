@@ -0,0 +1,241 @@
+// Package transform rewrites inference requests according to per-tenant
+// policies before they are forwarded, so that platform rules such as system
+// prompts and sampling caps are enforced centrally rather than by clients.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// AnyTenant is the policy name that applies to tenants without a policy of
+// their own, and to requests without a tenant
+const AnyTenant = "*"
+
+// Policy is the set of rewrites applied to a tenant's requests. Zero fields
+// leave requests unchanged.
+type Policy struct {
+	// SystemPrompt is added as the first chat message and before Responses
+	// instructions
+	SystemPrompt string
+	// ReplaceSystemPrompt drops the client's system and developer messages,
+	// and its instructions, instead of keeping them after SystemPrompt
+	ReplaceSystemPrompt bool
+	// MaxTokens caps the tokens generated; requests that set no limit get it
+	MaxTokens int
+	// MaxTemperature and MaxTopP cap the sampling parameters when set
+	MaxTemperature *float64
+	MaxTopP        *float64
+	// StripFields are top-level request fields removed before forwarding,
+	// e.g. "logit_bias" or "tools"
+	StripFields []string
+}
+
+// Policies maps tenant names to their policies. It can be replaced while
+// requests are in flight, e.g. when the configuration is reloaded.
+type Policies struct {
+	byTenant atomic.Pointer[map[string]*Policy]
+}
+
+// NewPolicies creates policies holding byTenant, which may be nil
+func NewPolicies(byTenant map[string]*Policy) *Policies {
+	p := &Policies{}
+	p.Set(byTenant)
+	return p
+}
+
+// Set replaces the policies
+func (p *Policies) Set(byTenant map[string]*Policy) {
+	p.byTenant.Store(&byTenant)
+}
+
+// For returns the policy of tenant, falling back to the AnyTenant policy, or
+// nil if neither exists
+func (p *Policies) For(tenant string) *Policy {
+	byTenant := *p.byTenant.Load()
+	if policy, ok := byTenant[tenant]; ok {
+		return policy
+	}
+	return byTenant[AnyTenant]
+}
+
+// endpoint locates the fields a policy rewrites in one endpoint's requests
+type endpoint struct {
+	// params is the object holding the sampling parameters; empty for the
+	// top level
+	params string
+	// maxTokens are the fields limiting the tokens generated; the first is
+	// set when none is
+	maxTokens []string
+	// messages and instructions hold the conversation and the system prompt;
+	// empty when the endpoint has none
+	messages     string
+	instructions string
+}
+
+// endpoints are the request layouts of the paths policies apply to
+var endpoints = map[string]endpoint{
+	"/v1/chat/completions": {maxTokens: []string{"max_tokens", "max_completion_tokens"}, messages: "messages"},
+	"/v1/completions":      {maxTokens: []string{"max_tokens"}},
+	"/v1/embeddings":       {},
+	"/v1/responses":        {maxTokens: []string{"max_output_tokens"}, messages: "input", instructions: "instructions"},
+	"/v1/messages":         {maxTokens: []string{"max_tokens"}, messages: "messages", instructions: "system"},
+	"/generate":            {params: "sampling_params", maxTokens: []string{"max_new_tokens"}},
+}
+
+// apply returns body, a request to an endpoint in endpoints, rewritten by the
+// policy. It returns an error if body is not a JSON object.
+func (p *Policy) apply(ep endpoint, body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("request body is null")
+	}
+
+	for _, name := range p.StripFields {
+		delete(fields, name)
+	}
+
+	params := fields
+	if ep.params != "" {
+		params = map[string]json.RawMessage{}
+		if raw, ok := fields[ep.params]; ok && !isNull(raw) {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.capParams(ep, params)
+	if ep.params != "" && len(params) > 0 {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		fields[ep.params] = raw
+	}
+
+	if p.SystemPrompt != "" {
+		if err := p.applySystemPrompt(ep, fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// capParams lowers the sampling parameters above the policy's caps
+func (p *Policy) capParams(ep endpoint, params map[string]json.RawMessage) {
+	if p.MaxTokens > 0 && len(ep.maxTokens) > 0 {
+		limited := false
+		for _, name := range ep.maxTokens {
+			var n float64
+			raw, ok := params[name]
+			if !ok || isNull(raw) || json.Unmarshal(raw, &n) != nil {
+				continue
+			}
+			limited = true
+			if n > float64(p.MaxTokens) {
+				params[name] = mustMarshal(p.MaxTokens)
+			}
+		}
+		if !limited {
+			params[ep.maxTokens[0]] = mustMarshal(p.MaxTokens)
+		}
+	}
+	capFloat(params, "temperature", p.MaxTemperature)
+	capFloat(params, "top_p", p.MaxTopP)
+}
+
+// capFloat lowers the number params[name] to limit if it is above it
+func capFloat(params map[string]json.RawMessage, name string, limit *float64) {
+	if limit == nil {
+		return
+	}
+	var v float64
+	if raw, ok := params[name]; ok && json.Unmarshal(raw, &v) == nil && v > *limit {
+		params[name] = mustMarshal(*limit)
+	}
+}
+
+// applySystemPrompt adds the policy's system prompt to the conversation,
+// dropping the client's when the policy replaces it
+func (p *Policy) applySystemPrompt(ep endpoint, fields map[string]json.RawMessage) error {
+	if ep.instructions != "" {
+		// The Responses API carries the system prompt as instructions, and
+		// the Messages API as system
+		instructions := p.SystemPrompt
+		if raw, ok := fields[ep.instructions]; ok && !p.ReplaceSystemPrompt {
+			if existing := instructionText(raw); existing != "" {
+				instructions += "\n\n" + existing
+			}
+		}
+		fields[ep.instructions] = mustMarshal(instructions)
+		if !p.ReplaceSystemPrompt {
+			return nil
+		}
+	}
+	if ep.messages == "" {
+		return nil
+	}
+
+	raw, ok := fields[ep.messages]
+	if !ok || !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		// Missing or string inputs are left to the handler
+		return nil
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return err
+	}
+	kept := make([]json.RawMessage, 0, len(messages)+1)
+	if ep.instructions == "" {
+		kept = append(kept, mustMarshal(map[string]string{"role": "system", "content": p.SystemPrompt}))
+	}
+	for _, message := range messages {
+		var m struct {
+			Role string `json:"role"`
+		}
+		if p.ReplaceSystemPrompt && json.Unmarshal(message, &m) == nil && (m.Role == "system" || m.Role == "developer") {
+			continue
+		}
+		kept = append(kept, message)
+	}
+	fields[ep.messages] = mustMarshal(kept)
+	return nil
+}
+
+// instructionText returns the text of a system prompt field: a string, or a
+// list of text blocks as the Messages API allows
+func instructionText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var blocks []struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(raw, &blocks)
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		texts = append(texts, block.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// isNull reports whether raw is the JSON null
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// mustMarshal encodes values that always encode, such as numbers and strings
+func mustMarshal(v interface{}) json.RawMessage {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
@@ -0,0 +1,193 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func float(v float64) *float64 { return &v }
+
+// TestPolicyApply tests the rewrites of each endpoint's requests
+func TestPolicyApply(t *testing.T) {
+	caps := &Policy{MaxTokens: 100, MaxTemperature: float(1), MaxTopP: float(0.9)}
+	prompt := &Policy{SystemPrompt: "Be brief."}
+	replace := &Policy{SystemPrompt: "Be brief.", ReplaceSystemPrompt: true}
+
+	tests := []struct {
+		name   string
+		path   string
+		policy *Policy
+		body   string
+		want   string
+	}{
+		// Chat completions
+		{
+			name: "chat absent max_tokens", path: "/v1/chat/completions", policy: caps,
+			body: `{"messages":[]}`,
+			want: `{"messages":[],"max_tokens":100}`,
+		},
+		{
+			name: "chat null max_tokens", path: "/v1/chat/completions", policy: caps,
+			body: `{"messages":[],"max_tokens":null}`,
+			want: `{"messages":[],"max_tokens":100}`,
+		},
+		{
+			name: "chat max_tokens above cap", path: "/v1/chat/completions", policy: caps,
+			body: `{"max_tokens":500}`,
+			want: `{"max_tokens":100}`,
+		},
+		{
+			name: "chat max_tokens below cap", path: "/v1/chat/completions", policy: caps,
+			body: `{"max_tokens":50}`,
+			want: `{"max_tokens":50}`,
+		},
+		{
+			name: "chat max_completion_tokens limits instead", path: "/v1/chat/completions", policy: caps,
+			body: `{"max_completion_tokens":500}`,
+			want: `{"max_completion_tokens":100}`,
+		},
+		{
+			name: "chat sampling caps", path: "/v1/chat/completions", policy: caps,
+			body: `{"max_tokens":10,"temperature":1.5,"top_p":0.5}`,
+			want: `{"max_tokens":10,"temperature":1,"top_p":0.5}`,
+		},
+		{
+			name: "chat strip fields", path: "/v1/chat/completions", policy: &Policy{StripFields: []string{"logit_bias", "tools"}},
+			body: `{"logit_bias":{"1":5},"tools":[],"model":"m"}`,
+			want: `{"model":"m"}`,
+		},
+		{
+			name: "chat system prompt kept", path: "/v1/chat/completions", policy: prompt,
+			body: `{"messages":[{"role":"system","content":"Client."},{"role":"user","content":"Hi"}]}`,
+			want: `{"messages":[{"role":"system","content":"Be brief."},{"role":"system","content":"Client."},{"role":"user","content":"Hi"}]}`,
+		},
+		{
+			name: "chat system prompt replaced", path: "/v1/chat/completions", policy: replace,
+			body: `{"messages":[{"role":"system","content":"Client."},{"role":"developer","content":"Dev."},{"role":"user","content":"Hi"}]}`,
+			want: `{"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}`,
+		},
+
+		// Completions and embeddings
+		{
+			name: "completions absent max_tokens", path: "/v1/completions", policy: &Policy{MaxTokens: 100, SystemPrompt: "Be brief."},
+			body: `{"prompt":"Hi"}`,
+			want: `{"prompt":"Hi","max_tokens":100}`,
+		},
+		{
+			name: "embeddings have no limit", path: "/v1/embeddings", policy: &Policy{MaxTokens: 100, SystemPrompt: "Be brief."},
+			body: `{"input":"Hi"}`,
+			want: `{"input":"Hi"}`,
+		},
+
+		// Responses
+		{
+			name: "responses absent max_output_tokens", path: "/v1/responses", policy: caps,
+			body: `{"input":"Hi"}`,
+			want: `{"input":"Hi","max_output_tokens":100}`,
+		},
+		{
+			name: "responses instructions kept", path: "/v1/responses", policy: prompt,
+			body: `{"input":"Hi","instructions":"Client."}`,
+			want: `{"input":"Hi","instructions":"Be brief.\n\nClient."}`,
+		},
+		{
+			name: "responses instructions replaced", path: "/v1/responses", policy: replace,
+			body: `{"input":[{"role":"developer","content":"Dev."},{"role":"user","content":"Hi"}],"instructions":"Client."}`,
+			want: `{"input":[{"role":"user","content":"Hi"}],"instructions":"Be brief."}`,
+		},
+
+		// Messages
+		{
+			name: "messages system string kept", path: "/v1/messages", policy: prompt,
+			body: `{"messages":[{"role":"user","content":"Hi"}],"system":"Client."}`,
+			want: `{"messages":[{"role":"user","content":"Hi"}],"system":"Be brief.\n\nClient."}`,
+		},
+		{
+			name: "messages system blocks kept", path: "/v1/messages", policy: prompt,
+			body: `{"messages":[],"system":[{"type":"text","text":"One."},{"type":"text","text":"Two."}]}`,
+			want: `{"messages":[],"system":"Be brief.\n\nOne.\nTwo."}`,
+		},
+		{
+			name: "messages system blocks replaced", path: "/v1/messages", policy: replace,
+			body: `{"messages":[],"system":[{"type":"text","text":"One."}]}`,
+			want: `{"messages":[],"system":"Be brief."}`,
+		},
+		{
+			name: "messages null max_tokens", path: "/v1/messages", policy: caps,
+			body: `{"max_tokens":null}`,
+			want: `{"max_tokens":100}`,
+		},
+
+		// Generate nests its parameters in sampling_params
+		{
+			name: "generate absent sampling_params", path: "/generate", policy: caps,
+			body: `{"text":"Hi"}`,
+			want: `{"text":"Hi","sampling_params":{"max_new_tokens":100}}`,
+		},
+		{
+			name: "generate null sampling_params", path: "/generate", policy: caps,
+			body: `{"text":"Hi","sampling_params":null}`,
+			want: `{"text":"Hi","sampling_params":{"max_new_tokens":100}}`,
+		},
+		{
+			name: "generate nested caps", path: "/generate", policy: caps,
+			body: `{"temperature":5,"max_tokens":500,"sampling_params":{"max_new_tokens":500,"temperature":1.5,"top_p":0.95}}`,
+			want: `{"temperature":5,"max_tokens":500,"sampling_params":{"max_new_tokens":100,"temperature":1,"top_p":0.9}}`,
+		},
+		{
+			name: "generate nothing to cap", path: "/generate", policy: prompt,
+			body: `{"text":"Hi"}`,
+			want: `{"text":"Hi"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.apply(endpoints[tt.path], []byte(tt.body))
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatalf("apply() = %s: %v", got, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPolicyApplyErrors tests that bodies which are not JSON objects are
+// rejected
+func TestPolicyApplyErrors(t *testing.T) {
+	policy := &Policy{MaxTokens: 100}
+	for _, body := range []string{``, `null`, `[]`, `"text"`, `{"sampling_params":[]}`} {
+		if got, err := policy.apply(endpoints["/generate"], []byte(body)); err == nil {
+			t.Errorf("apply(%s) = %s, want an error", body, got)
+		}
+	}
+}
+
+// TestPoliciesFor tests the fallback to the AnyTenant policy
+func TestPoliciesFor(t *testing.T) {
+	team, fallback := &Policy{MaxTokens: 1}, &Policy{MaxTokens: 2}
+	policies := NewPolicies(map[string]*Policy{"team": team, AnyTenant: fallback})
+	if got := policies.For("team"); got != team {
+		t.Errorf("For(team) = %+v, want its own policy", got)
+	}
+	if got := policies.For("other"); got != fallback {
+		t.Errorf("For(other) = %+v, want the %q policy", got, AnyTenant)
+	}
+	if got := policies.For(""); got != fallback {
+		t.Errorf("For(\"\") = %+v, want the %q policy", got, AnyTenant)
+	}
+
+	policies.Set(nil)
+	if got := policies.For("team"); got != nil {
+		t.Errorf("For(team) after Set(nil) = %+v, want nil", got)
+	}
+}
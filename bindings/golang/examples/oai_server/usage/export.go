@@ -0,0 +1,281 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Record is the usage of a tenant and model over an export period
+type Record struct {
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Tenant      string    `json:"tenant"`
+	// Model is the model the client requested, which may be an alias
+	Model string `json:"model"`
+	Totals
+	// EstimatedCostUSD is 0 for models without a price
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// csvHeader names the CSV columns, in the order of csvRow
+var csvHeader = []string{
+	"period_start", "period_end", "tenant", "model",
+	"requests", "prompt_tokens", "completion_tokens", "total_tokens", "estimated_cost_usd",
+}
+
+func (r *Record) csvRow() []string {
+	return []string{
+		r.PeriodStart.Format(time.RFC3339), r.PeriodEnd.Format(time.RFC3339), r.Tenant, r.Model,
+		strconv.FormatInt(r.Requests, 10),
+		strconv.FormatInt(r.PromptTokens, 10),
+		strconv.FormatInt(r.CompletionTokens, 10),
+		strconv.FormatInt(r.TotalTokens, 10),
+		strconv.FormatFloat(r.EstimatedCostUSD, 'f', -1, 64),
+	}
+}
+
+// AnyModel is the model name whose price applies to models without one
+const AnyModel = "*"
+
+// Price is the cost of a model's tokens in USD per million
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Prices maps models to their prices
+type Prices map[string]Price
+
+// Cost returns the estimated cost of tokens of model, rounded to a billionth
+// of a dollar, falling back to the AnyModel price, or 0 if neither is set
+func (p Prices) Cost(model string, promptTokens, completionTokens int64) float64 {
+	price, ok := p[model]
+	if !ok {
+		if price, ok = p[AnyModel]; !ok {
+			return 0
+		}
+	}
+	cost := (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+	return math.Round(cost*1e9) / 1e9
+}
+
+// ParsePrices parses a comma-separated list of "model:prompt:completion"
+// prices in USD per million tokens. Model names may contain colons.
+func ParsePrices(list string) (Prices, error) {
+	prices := make(Prices)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("invalid price %q, expected model:prompt:completion", entry)
+		}
+		model := strings.Join(parts[:len(parts)-2], ":")
+		prompt, err1 := strconv.ParseFloat(parts[len(parts)-2], 64)
+		completion, err2 := strconv.ParseFloat(parts[len(parts)-1], 64)
+		if model == "" || err1 != nil || err2 != nil || prompt < 0 || completion < 0 {
+			return nil, fmt.Errorf("invalid price %q, expected model:prompt:completion", entry)
+		}
+		prices[model] = Price{Prompt: prompt, Completion: completion}
+	}
+	return prices, nil
+}
+
+// Export formats
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// encode renders records in format, with a header row for CSV when header is
+// set
+func encode(records []Record, format string, header bool) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSONL:
+		encoder := json.NewEncoder(&buf)
+		for i := range records {
+			if err := encoder.Encode(&records[i]); err != nil {
+				return nil, err
+			}
+		}
+	case FormatCSV:
+		w := csv.NewWriter(&buf)
+		if header {
+			w.Write(csvHeader)
+		}
+		for i := range records {
+			w.Write(records[i].csvRow())
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown export format %q (want jsonl or csv)", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Sink receives exported usage records
+type Sink interface {
+	Write(ctx context.Context, records []Record) error
+}
+
+// FileSink appends records to a file. CSV files get a header row when they
+// are created.
+type FileSink struct {
+	path   string
+	format string
+}
+
+// NewFileSink creates a sink appending to path in format
+func NewFileSink(path, format string) *FileSink {
+	return &FileSink{path: path, format: format}
+}
+
+// Write appends records to the file
+func (s *FileSink) Write(_ context.Context, records []Record) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	data, err := encode(records, s.format, info.Size() == 0)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPSink posts records to a billing service, as JSON lines or CSV with a
+// header row. Responses other than 2xx are errors.
+type HTTPSink struct {
+	url    string
+	apiKey string
+	format string
+	client *http.Client
+}
+
+// NewHTTPSink creates a sink posting to url in format, sending apiKey as a
+// bearer token when set
+func NewHTTPSink(url, apiKey, format string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{url: url, apiKey: apiKey, format: format, client: &http.Client{Timeout: timeout}}
+}
+
+// Write posts records
+func (s *HTTPSink) Write(ctx context.Context, records []Record) error {
+	data, err := encode(records, s.format, true)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if s.format == FormatCSV {
+		req.Header.Set("Content-Type", "text/csv")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("usage export request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("usage export sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// maxUnsent bounds the records kept while the sink fails; the oldest are
+// dropped beyond it
+const maxUnsent = 100000
+
+// Exporter periodically writes the usage recorded by a tracker to a sink.
+// Records the sink fails to take are retried with the next export.
+type Exporter struct {
+	tracker *Tracker
+	sink    Sink
+	prices  Prices
+	logger  *zap.Logger
+
+	mu     sync.Mutex
+	unsent []Record
+}
+
+// NewExporter creates an exporter of tracker's usage, priced by prices
+func NewExporter(tracker *Tracker, sink Sink, prices Prices, logger *zap.Logger) *Exporter {
+	return &Exporter{tracker: tracker, sink: sink, prices: prices, logger: logger}
+}
+
+// Export writes the usage recorded since the last export, along with any
+// records not yet sent. Nothing is written when there is no usage.
+func (e *Exporter) Export(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	records := append(e.unsent, e.tracker.TakeRecords(e.prices)...)
+	if len(records) == 0 {
+		return nil
+	}
+	if err := e.sink.Write(ctx, records); err != nil {
+		if dropped := len(records) - maxUnsent; dropped > 0 {
+			e.logger.Error("Dropping unsent usage records", zap.Int("records", dropped))
+			records = records[dropped:]
+		}
+		e.unsent = records
+		return err
+	}
+	e.unsent = nil
+	e.logger.Info("Exported usage", zap.Int("records", len(records)))
+	return nil
+}
+
+// Run exports every interval until ctx is done. Failures are logged and
+// retried at the next export.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := e.Export(ctx); err != nil {
+			e.logger.Warn("Failed to export usage, retrying at the next export", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testRecords returns records of a period ending at 12:00 on Jan 1 2026
+func testRecords() []Record {
+	start := time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	return []Record{
+		{PeriodStart: start, PeriodEnd: end, Tenant: "acme", Model: "m", Totals: Totals{Requests: 2, PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}, EstimatedCostUSD: 0.00075},
+		{PeriodStart: start, PeriodEnd: end, Tenant: "beta", Model: "org/m:v2", Totals: Totals{Requests: 1, PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}},
+	}
+}
+
+const (
+	testCSVHeader = "period_start,period_end,tenant,model,requests,prompt_tokens,completion_tokens,total_tokens,estimated_cost_usd\n"
+	testCSVRows   = "2026-01-01T11:00:00Z,2026-01-01T12:00:00Z,acme,m,2,100,50,150,0.00075\n" +
+		"2026-01-01T11:00:00Z,2026-01-01T12:00:00Z,beta,org/m:v2,1,1,2,3,0\n"
+	testCSV   = testCSVHeader + testCSVRows
+	testJSONL = `{"period_start":"2026-01-01T11:00:00Z","period_end":"2026-01-01T12:00:00Z","tenant":"acme","model":"m","requests":2,"prompt_tokens":100,"completion_tokens":50,"total_tokens":150,"estimated_cost_usd":0.00075}` + "\n" +
+		`{"period_start":"2026-01-01T11:00:00Z","period_end":"2026-01-01T12:00:00Z","tenant":"beta","model":"org/m:v2","requests":1,"prompt_tokens":1,"completion_tokens":2,"total_tokens":3,"estimated_cost_usd":0}` + "\n"
+)
+
+// TestTakeRecords tests that each export covers the usage since the last
+func TestTakeRecords(t *testing.T) {
+	start := time.Date(2026, 1, 1, 11, 0, 0, 500, time.UTC)
+	now := start
+	tr := newTestTracker(&now, nil)
+	prices := Prices{"m": {Prompt: 2.5, Completion: 10}}
+
+	if records := tr.TakeRecords(prices); records == nil || len(records) != 0 {
+		t.Errorf("TakeRecords() without usage = %+v", records)
+	}
+
+	tr.Record("k2", "beta", "org/m:v2", 1, 2)
+	tr.Record("k1", "acme", "m", 60, 20)
+	tr.Record("k3", "acme", "m", 40, 30)
+	now = now.Add(time.Hour + 500*time.Millisecond)
+
+	records := tr.TakeRecords(prices)
+	if !reflect.DeepEqual(records, testRecords()) {
+		t.Errorf("TakeRecords() = %+v, want %+v", records, testRecords())
+	}
+
+	// The next period starts where the last ended
+	tr.Record("k1", "acme", "m", 1, 1)
+	now = now.Add(time.Minute)
+	records = tr.TakeRecords(prices)
+	wantStart, wantEnd := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 12, 1, 0, 0, time.UTC)
+	if len(records) != 1 || !records[0].PeriodStart.Equal(wantStart) || !records[0].PeriodEnd.Equal(wantEnd) || records[0].Requests != 1 {
+		t.Errorf("TakeRecords() of the next period = %+v", records)
+	}
+}
+
+// TestPricesCost tests pricing with the fallback to AnyModel
+func TestPricesCost(t *testing.T) {
+	prices := Prices{"m": {Prompt: 2.5, Completion: 10}, AnyModel: {Prompt: 1, Completion: 1}}
+	tests := []struct {
+		prices Prices
+		model  string
+		want   float64
+	}{
+		{prices: prices, model: "m", want: 0.00075},
+		{prices: prices, model: "other", want: 0.00015},
+		{prices: Prices{"m": {Prompt: 2.5, Completion: 10}}, model: "other", want: 0},
+		{prices: nil, model: "m", want: 0},
+		// Rounded to a billionth of a dollar
+		{prices: Prices{"m": {Prompt: 0.0123456, Completion: 0}}, model: "m", want: 0.000001235},
+	}
+	for _, tt := range tests {
+		if got := tt.prices.Cost(tt.model, 100, 50); got != tt.want {
+			t.Errorf("%v.Cost(%q) = %v, want %v", tt.prices, tt.model, got, tt.want)
+		}
+	}
+}
+
+// TestParsePrices tests parsing model prices
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices(" m:2.5:10, org/m:v2:0:0.5 ,*:1:1,")
+	want := Prices{"m": {Prompt: 2.5, Completion: 10}, "org/m:v2": {Prompt: 0, Completion: 0.5}, AnyModel: {Prompt: 1, Completion: 1}}
+	if err != nil || !reflect.DeepEqual(prices, want) {
+		t.Errorf("ParsePrices() = %v, %v, want %v", prices, err, want)
+	}
+	for _, list := range []string{"m", "m:1", ":1:1", "m:a:1", "m:1:-1"} {
+		if _, err := ParsePrices(list); err == nil {
+			t.Errorf("ParsePrices(%q) succeeded", list)
+		}
+	}
+}
+
+// TestEncode tests the export formats
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		format string
+		header bool
+		want   string
+	}{
+		{format: FormatCSV, header: true, want: testCSV},
+		{format: FormatCSV, header: false, want: testCSVRows},
+		{format: FormatJSONL, header: true, want: testJSONL},
+	}
+	for _, tt := range tests {
+		got, err := encode(testRecords(), tt.format, tt.header)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("encode(%s, %v) = %q, %v, want %q", tt.format, tt.header, got, err, tt.want)
+		}
+	}
+	if _, err := encode(testRecords(), "xml", true); err == nil {
+		t.Error("encode() of an unknown format succeeded")
+	}
+}
+
+// TestFileSink tests that CSV files get one header row however often they
+// are appended to
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+	sink := NewFileSink(path, FormatCSV)
+	records := testRecords()
+	for i := range records {
+		if err := sink.Write(context.Background(), records[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != testCSV {
+		t.Errorf("file = %q, %v, want %q", data, err, testCSV)
+	}
+}
+
+// TestHTTPSink tests posting records and failing on other than 2xx
+func TestHTTPSink(t *testing.T) {
+	status := http.StatusNoContent
+	var contentType, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		contentType, auth, body = r.Header.Get("Content-Type"), r.Header.Get("Authorization"), string(data)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, "secret", FormatJSONL, time.Second)
+	if err := sink.Write(context.Background(), testRecords()); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-ndjson" || auth != "Bearer secret" || body != testJSONL {
+		t.Errorf("request = %q, %q, %q", contentType, auth, body)
+	}
+
+	sink = NewHTTPSink(server.URL, "", FormatCSV, time.Second)
+	if err := sink.Write(context.Background(), testRecords()); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "text/csv" || auth != "" || body != testCSV {
+		t.Errorf("request = %q, %q, %q", contentType, auth, body)
+	}
+
+	status = http.StatusBadGateway
+	if err := sink.Write(context.Background(), testRecords()); err == nil {
+		t.Error("Write() succeeded with a 502")
+	}
+}
+
+// failingSink fails its first writes and records the rest
+type failingSink struct {
+	failures int
+	written  [][]Record
+}
+
+func (s *failingSink) Write(_ context.Context, records []Record) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	s.written = append(s.written, records)
+	return nil
+}
+
+// TestExporterRetries tests that records the sink fails to take are sent
+// with the next export
+func TestExporterRetries(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr := newTestTracker(&now, nil)
+	sink := &failingSink{failures: 1}
+	e := NewExporter(tr, sink, nil, zap.NewNop())
+
+	if err := e.Export(context.Background()); err != nil || len(sink.written) != 0 {
+		t.Errorf("Export() without usage = %v, wrote %v", err, sink.written)
+	}
+	tr.Record("k1", "acme", "m", 1, 1)
+	if err := e.Export(context.Background()); err == nil {
+		t.Error("Export() succeeded with a failing sink")
+	}
+	tr.Record("k1", "beta", "m", 1, 1)
+	if err := e.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.written) != 1 || len(sink.written[0]) != 2 || sink.written[0][0].Tenant != "acme" || sink.written[0][1].Tenant != "beta" {
+		t.Errorf("written = %+v, want the failed and new records", sink.written)
+	}
+}
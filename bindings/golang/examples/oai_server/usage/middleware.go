@@ -0,0 +1,81 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+
+	"oai_server/auth"
+	"oai_server/requestid"
+	"oai_server/utils"
+)
+
+// userValueKey is the RequestCtx user value holding the request's usage recorder
+const userValueKey = "usage.recorder"
+
+// Recorder returns a function that records the tokens of a completed request
+// for the key that made it, along with the model the client requested. It
+// never returns nil; the function is a no-op for unauthenticated requests. It
+// may be called after the handler returns, e.g. from a body stream writer.
+func Recorder(ctx *fasthttp.RequestCtx) func(model string, promptTokens, completionTokens int) {
+	if record, ok := ctx.UserValue(userValueKey).(func(string, int, int)); ok {
+		return record
+	}
+	return func(string, int, int) {}
+}
+
+// tenantOf returns the tenant usage of key is tracked under
+func tenantOf(key *auth.KeyInfo) string {
+	if key.Tenant == "" {
+		return DefaultTenant
+	}
+	return key.Tenant
+}
+
+// Middleware tracks the usage of requests authenticated by auth.Middleware,
+// which must run first. Requests from tenants that reached their monthly
+// token ceiling get 429 with code "insufficient_quota".
+func Middleware(tracker *Tracker, logger *zap.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		key := auth.KeyFromContext(ctx)
+		if key == nil {
+			next(ctx)
+			return
+		}
+		tenant := tenantOf(key)
+
+		if allowed, used, limit := tracker.Allow(tenant); !allowed {
+			logger.Warn("Rejected request from tenant over monthly token limit",
+				zap.String("key", key.Name),
+				zap.String("tenant", tenant),
+				zap.Int64("used", used),
+				zap.Int64("limit", limit),
+				requestid.Field(ctx),
+			)
+			utils.RespondErrorWithParam(ctx, fasthttp.StatusTooManyRequests,
+				fmt.Sprintf("Tenant %q has used %d of its %d monthly tokens.", tenant, used, limit),
+				"insufficient_quota", "", "insufficient_quota")
+			return
+		}
+
+		name := key.Name
+		ctx.SetUserValue(userValueKey, func(model string, promptTokens, completionTokens int) {
+			tracker.Record(name, tenant, model, promptTokens, completionTokens)
+		})
+		next(ctx)
+	}
+}
+
+// Handler serves the current month's usage as a Report. The "tenant" query
+// parameter restricts the report to one tenant.
+func Handler(tracker *Tracker) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		report := tracker.Report(string(ctx.QueryArgs().Peek("tenant")))
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetContentType("application/json")
+		jsonData, _ := json.Marshal(report)
+		ctx.Write(jsonData)
+	}
+}
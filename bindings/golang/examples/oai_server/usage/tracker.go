@@ -0,0 +1,247 @@
+// Package usage tracks token usage per API key and tenant, enforces monthly
+// token ceilings per tenant, and exports usage records for billing.
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTenant is the tenant of keys that do not name one
+const DefaultTenant = "default"
+
+// Totals is the usage of a key or tenant in the current month
+type Totals struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+func (t *Totals) add(promptTokens, completionTokens int) {
+	t.Requests++
+	t.PromptTokens += int64(promptTokens)
+	t.CompletionTokens += int64(completionTokens)
+	t.TotalTokens += int64(promptTokens + completionTokens)
+}
+
+// TenantUsage is a tenant's entry in a Report
+type TenantUsage struct {
+	Tenant string `json:"tenant"`
+	Totals
+	// MonthlyTokenLimit is 0 when the tenant has no ceiling
+	MonthlyTokenLimit int64 `json:"monthly_token_limit"`
+}
+
+// KeyUsage is a key's entry in a Report
+type KeyUsage struct {
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Totals
+}
+
+// Report is the usage of all tenants and keys in the current month
+type Report struct {
+	Object string `json:"object"`
+	// Month is the UTC month the totals cover, e.g. "2026-10"
+	Month   string        `json:"month"`
+	Tenants []TenantUsage `json:"tenants"`
+	Keys    []KeyUsage    `json:"keys"`
+}
+
+type keyID struct {
+	name   string
+	tenant string
+}
+
+// exportID identifies the usage in an export record
+type exportID struct {
+	tenant string
+	model  string
+}
+
+// Tracker accumulates usage per key and tenant for the current UTC month.
+// Usage is kept in memory, so it restarts from zero with the server.
+type Tracker struct {
+	mu sync.Mutex
+	// limits maps tenants to monthly token ceilings
+	limits  map[string]int64
+	month   string
+	tenants map[string]*Totals
+	keys    map[keyID]*Totals
+	// unexported is the usage since unexportedSince, by tenant and model,
+	// not yet taken by TakeRecords. It spans month boundaries.
+	unexported      map[exportID]*Totals
+	unexportedSince time.Time
+	now             func() time.Time
+}
+
+// NewTracker creates a tracker enforcing limits, a map from tenant to monthly
+// token ceiling. limits may be nil.
+func NewTracker(limits map[string]int64) *Tracker {
+	return &Tracker{
+		limits:          limits,
+		tenants:         make(map[string]*Totals),
+		keys:            make(map[keyID]*Totals),
+		unexported:      make(map[exportID]*Totals),
+		unexportedSince: time.Now().UTC().Truncate(time.Second),
+		now:             time.Now,
+	}
+}
+
+// SetLimits replaces the monthly token ceilings; usage so far is kept
+func (t *Tracker) SetLimits(limits map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+}
+
+// rollover resets the totals when a new month starts. Callers must hold t.mu.
+func (t *Tracker) rollover() {
+	month := t.now().UTC().Format("2006-01")
+	if month != t.month {
+		t.month = month
+		t.tenants = make(map[string]*Totals)
+		t.keys = make(map[keyID]*Totals)
+	}
+}
+
+// Record adds a completed request's tokens to the key and its tenant. model
+// is the model the client requested, which export records are priced by.
+func (t *Tracker) Record(keyName, tenant, model string, promptTokens, completionTokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	tenantTotals, ok := t.tenants[tenant]
+	if !ok {
+		tenantTotals = &Totals{}
+		t.tenants[tenant] = tenantTotals
+	}
+	tenantTotals.add(promptTokens, completionTokens)
+
+	id := keyID{name: keyName, tenant: tenant}
+	keyTotals, ok := t.keys[id]
+	if !ok {
+		keyTotals = &Totals{}
+		t.keys[id] = keyTotals
+	}
+	keyTotals.add(promptTokens, completionTokens)
+
+	exportTotals, ok := t.unexported[exportID{tenant: tenant, model: model}]
+	if !ok {
+		exportTotals = &Totals{}
+		t.unexported[exportID{tenant: tenant, model: model}] = exportTotals
+	}
+	exportTotals.add(promptTokens, completionTokens)
+}
+
+// TakeRecords returns the usage recorded since the last call, one record per
+// tenant and model, priced by prices, and starts a new period. prices may be
+// nil.
+func (t *Tracker) TakeRecords(prices Prices) []Record {
+	t.mu.Lock()
+	unexported, since := t.unexported, t.unexportedSince
+	// Whole seconds, so that periods line up in every format
+	until := t.now().UTC().Truncate(time.Second)
+	t.unexported, t.unexportedSince = make(map[exportID]*Totals), until
+	t.mu.Unlock()
+
+	records := make([]Record, 0, len(unexported))
+	for id, totals := range unexported {
+		records = append(records, Record{
+			PeriodStart:      since,
+			PeriodEnd:        until,
+			Tenant:           id.tenant,
+			Model:            id.model,
+			Totals:           *totals,
+			EstimatedCostUSD: prices.Cost(id.model, totals.PromptTokens, totals.CompletionTokens),
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Tenant != records[j].Tenant {
+			return records[i].Tenant < records[j].Tenant
+		}
+		return records[i].Model < records[j].Model
+	})
+	return records
+}
+
+// Allow reports whether tenant is below its monthly token ceiling, along
+// with the tokens it has used and its limit (0 when it has none)
+func (t *Tracker) Allow(tenant string) (allowed bool, used, limit int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limit = t.limits[tenant]
+	if limit == 0 {
+		return true, 0, 0
+	}
+
+	t.rollover()
+	if totals, ok := t.tenants[tenant]; ok {
+		used = totals.TotalTokens
+	}
+	return used < limit, used, limit
+}
+
+// Report returns the usage of the current month, sorted by tenant and key.
+// A non-empty tenant restricts the report to that tenant.
+func (t *Tracker) Report(tenant string) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+
+	report := Report{
+		Object:  "usage",
+		Month:   t.month,
+		Tenants: []TenantUsage{},
+		Keys:    []KeyUsage{},
+	}
+	for name, totals := range t.tenants {
+		if tenant == "" || name == tenant {
+			report.Tenants = append(report.Tenants, TenantUsage{Tenant: name, Totals: *totals, MonthlyTokenLimit: t.limits[name]})
+		}
+	}
+	// Tenants with a ceiling are listed even before their first request
+	for name, limit := range t.limits {
+		if _, seen := t.tenants[name]; !seen && (tenant == "" || name == tenant) {
+			report.Tenants = append(report.Tenants, TenantUsage{Tenant: name, MonthlyTokenLimit: limit})
+		}
+	}
+	for id, totals := range t.keys {
+		if tenant == "" || id.tenant == tenant {
+			report.Keys = append(report.Keys, KeyUsage{Name: id.name, Tenant: id.tenant, Totals: *totals})
+		}
+	}
+
+	sort.Slice(report.Tenants, func(i, j int) bool { return report.Tenants[i].Tenant < report.Tenants[j].Tenant })
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Tenant != report.Keys[j].Tenant {
+			return report.Keys[i].Tenant < report.Keys[j].Tenant
+		}
+		return report.Keys[i].Name < report.Keys[j].Name
+	})
+	return report
+}
+
+// ParseLimits parses a comma-separated list of "tenant:tokens" monthly ceilings
+func ParseLimits(list string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tenant, tokens, ok := strings.Cut(entry, ":")
+		limit, err := strconv.ParseInt(tokens, 10, 64)
+		if !ok || tenant == "" || err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid tenant token limit %q, expected tenant:tokens", entry)
+		}
+		limits[tenant] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestTracker returns a tracker enforcing limits whose clock is *now
+func newTestTracker(now *time.Time, limits map[string]int64) *Tracker {
+	t := NewTracker(limits)
+	t.now = func() time.Time { return *now }
+	t.unexportedSince = now.UTC().Truncate(time.Second)
+	return t
+}
+
+// TestTrackerRollover tests that totals restart when a UTC month begins
+func TestTrackerRollover(t *testing.T) {
+	now := time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC)
+	tr := newTestTracker(&now, nil)
+	tr.Record("k1", "acme", "m", 10, 5)
+	tr.Record("k1", "acme", "m", 1, 1)
+
+	report := tr.Report("")
+	if report.Month != "2026-10" || len(report.Tenants) != 1 {
+		t.Fatalf("Report() = %+v", report)
+	}
+	want := Totals{Requests: 2, PromptTokens: 11, CompletionTokens: 6, TotalTokens: 17}
+	if report.Tenants[0].Totals != want || report.Keys[0].Totals != want {
+		t.Errorf("October totals = %+v, %+v, want %+v", report.Tenants[0].Totals, report.Keys[0].Totals, want)
+	}
+
+	// 23:30 on Oct 31 in UTC-5 is already November in UTC
+	now = time.Date(2026, 10, 31, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	report = tr.Report("")
+	if report.Month != "2026-11" || len(report.Tenants) != 0 || len(report.Keys) != 0 {
+		t.Errorf("Report() after the month ended = %+v", report)
+	}
+
+	tr.Record("k1", "acme", "m", 2, 3)
+	report = tr.Report("")
+	want = Totals{Requests: 1, PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5}
+	if len(report.Tenants) != 1 || report.Tenants[0].Totals != want {
+		t.Errorf("November totals = %+v, want %+v", report.Tenants, want)
+	}
+
+	// Usage not yet exported is kept across the month boundary
+	records := tr.TakeRecords(nil)
+	if len(records) != 1 || records[0].Requests != 3 || records[0].TotalTokens != 22 {
+		t.Errorf("TakeRecords() = %+v, want October and November together", records)
+	}
+}
+
+// TestTrackerAllow tests the monthly token ceilings of tenants
+func TestTrackerAllow(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	tr := newTestTracker(&now, map[string]int64{"acme": 100})
+
+	check := func(tenant string, wantAllowed bool, wantUsed, wantLimit int64) {
+		t.Helper()
+		allowed, used, limit := tr.Allow(tenant)
+		if allowed != wantAllowed || used != wantUsed || limit != wantLimit {
+			t.Errorf("Allow(%q) = %v, %d, %d, want %v, %d, %d", tenant, allowed, used, limit, wantAllowed, wantUsed, wantLimit)
+		}
+	}
+
+	check("acme", true, 0, 100)
+	tr.Record("k1", "acme", "m", 60, 39)
+	check("acme", true, 99, 100)
+	// The request that crosses the ceiling completes; the next is refused
+	tr.Record("k1", "acme", "m", 1, 1)
+	check("acme", false, 101, 100)
+
+	// Tenants without a ceiling are always allowed
+	tr.Record("k2", "other", "m", 1000, 1000)
+	check("other", true, 0, 0)
+
+	// A new month lifts the ceiling
+	now = now.Add(12 * time.Hour)
+	check("acme", true, 0, 100)
+
+	// Ceilings can be changed without losing usage
+	tr.Record("k1", "acme", "m", 30, 0)
+	tr.SetLimits(map[string]int64{"acme": 20, "other": 10})
+	check("acme", false, 30, 20)
+	check("other", true, 0, 10)
+}
+
+// TestTrackerReport tests the tenant filter and ordering of reports
+func TestTrackerReport(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tr := newTestTracker(&now, map[string]int64{"acme": 1000, "idle": 50})
+	tr.Record("k2", "acme", "m", 1, 1)
+	tr.Record("k1", "acme", "m", 2, 2)
+	tr.Record("k1", "beta", "m", 3, 3)
+
+	report := tr.Report("")
+	var tenants, keys []string
+	for _, u := range report.Tenants {
+		tenants = append(tenants, u.Tenant)
+	}
+	for _, u := range report.Keys {
+		keys = append(keys, u.Tenant+"/"+u.Name)
+	}
+	// Tenants with a ceiling are listed before their first request
+	if !reflect.DeepEqual(tenants, []string{"acme", "beta", "idle"}) {
+		t.Errorf("tenants = %v", tenants)
+	}
+	if !reflect.DeepEqual(keys, []string{"acme/k1", "acme/k2", "beta/k1"}) {
+		t.Errorf("keys = %v", keys)
+	}
+	if report.Object != "usage" || report.Tenants[0].MonthlyTokenLimit != 1000 || report.Tenants[2].Totals != (Totals{}) {
+		t.Errorf("Report() = %+v", report)
+	}
+
+	acme := tr.Report("acme")
+	if len(acme.Tenants) != 1 || acme.Tenants[0].TotalTokens != 6 || len(acme.Keys) != 2 {
+		t.Errorf("Report(acme) = %+v", acme)
+	}
+	for _, k := range acme.Keys {
+		if k.Tenant != "acme" {
+			t.Errorf("Report(acme) lists key %+v", k)
+		}
+	}
+
+	idle := tr.Report("idle")
+	if len(idle.Tenants) != 1 || idle.Tenants[0].MonthlyTokenLimit != 50 || idle.Keys == nil || len(idle.Keys) != 0 {
+		t.Errorf("Report(idle) = %+v", idle)
+	}
+	if none := tr.Report("unknown"); none.Tenants == nil || len(none.Tenants) != 0 || len(none.Keys) != 0 {
+		t.Errorf("Report(unknown) = %+v", none)
+	}
+}
+
+// TestParseLimits tests parsing tenant token ceilings
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(" acme:1000, beta:5 ,")
+	if err != nil || !reflect.DeepEqual(limits, map[string]int64{"acme": 1000, "beta": 5}) {
+		t.Errorf("ParseLimits() = %v, %v", limits, err)
+	}
+	if limits, err := ParseLimits(""); err != nil || len(limits) != 0 {
+		t.Errorf("ParseLimits(\"\") = %v, %v", limits, err)
+	}
+	for _, list := range []string{"acme", "acme:", ":10", "acme:0", "acme:-1", "acme:ten"} {
+		if _, err := ParseLimits(list); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded", list)
+		}
+	}
+}
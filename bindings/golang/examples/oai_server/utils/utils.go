@@ -2,25 +2,147 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/lightseek/smg/go-grpc-sdk/smghttp"
 	"github.com/valyala/fasthttp"
+
+	"oai_server/requestid"
 )
 
-// RespondError sends an error response in OpenAI format
+// RespondError sends an error response in OpenAI format, including the
+// request ID when one is assigned
 func RespondError(ctx *fasthttp.RequestCtx, statusCode int, message, errorType string) {
+	RespondErrorWithParam(ctx, statusCode, message, errorType, "", "")
+}
+
+// RespondErrorWithParam is RespondError with the request parameter that caused
+// the error and a machine-readable error code; empty values are sent as null
+func RespondErrorWithParam(ctx *fasthttp.RequestCtx, statusCode int, message, errorType, param, code string) {
 	ctx.SetStatusCode(statusCode)
 	ctx.SetContentType("application/json")
 
-	response := map[string]interface{}{
-		"error": map[string]interface{}{
-			"message": message,
-			"type":    errorType,
-			"code":    statusCode,
-		},
+	jsonData, _ := json.Marshal(ErrorBody(message, errorType, param, code, requestid.FromContext(ctx)))
+	ctx.Write(jsonData)
+}
+
+// RespondSDKError sends the error response for a failed SDK call, with the
+// status given by SDKErrorStatus. The message is prefixed with action.
+func RespondSDKError(ctx *fasthttp.RequestCtx, action string, err error) {
+	statusCode, errorType := SDKErrorStatus(err)
+	RespondError(ctx, statusCode, fmt.Sprintf("%s: %v", action, err), errorType)
+}
+
+// RespondDecodeError sends a 400 for a request body that is not valid JSON or
+// does not match the request's shape, naming the mistyped field when known
+func RespondDecodeError(ctx *fasthttp.RequestCtx, err error) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		param := jsonPath(typeErr.Field)
+		RespondErrorWithParam(ctx, fasthttp.StatusBadRequest,
+			fmt.Sprintf("Invalid type for '%s': expected %s, got %s.", param, jsonTypeName(typeErr.Type), typeErr.Value),
+			"invalid_request_error", param, "invalid_type")
+		return
 	}
+	RespondError(ctx, fasthttp.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err), "invalid_request_error")
+}
 
-	jsonData, _ := json.Marshal(response)
-	ctx.Write(jsonData)
+// jsonPath converts an encoding/json field path such as "messages.0.content"
+// to the "messages[0].content" form used in error params
+func jsonPath(field string) string {
+	parts := strings.Split(field, ".")
+	var b strings.Builder
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil && i > 0 {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// jsonTypeName names the JSON type that decodes into t
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return t.String()
+	}
+}
+
+// ServerErrorHandler returns a fasthttp.Server ErrorHandler that reports
+// requests the server could not read, such as bodies over maxBodyBytes, in
+// OpenAI format
+func ServerErrorHandler(maxBodyBytes int) func(*fasthttp.RequestCtx, error) {
+	return func(ctx *fasthttp.RequestCtx, err error) {
+		var smallBuffer *fasthttp.ErrSmallBuffer
+		var netErr net.Error
+		switch {
+		case errors.Is(err, fasthttp.ErrBodyTooLarge):
+			RespondErrorWithParam(ctx, fasthttp.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body exceeds the maximum size of %d bytes.", maxBodyBytes),
+				"invalid_request_error", "", "request_too_large")
+		case errors.As(err, &smallBuffer):
+			RespondError(ctx, fasthttp.StatusRequestHeaderFieldsTooLarge, "Request headers are too large.", "invalid_request_error")
+		case errors.As(err, &netErr) && netErr.Timeout():
+			RespondError(ctx, fasthttp.StatusRequestTimeout, "Timed out reading the request.", "invalid_request_error")
+		default:
+			RespondError(ctx, fasthttp.StatusBadRequest, "Could not parse the HTTP request.", "invalid_request_error")
+		}
+	}
+}
+
+// SDKErrorStatus returns the HTTP status code and OpenAI error type for an
+// error returned by the SDK, as the SDK's smghttp handler answers it
+func SDKErrorStatus(err error) (int, string) {
+	return smghttp.ErrorStatus(err)
+}
+
+// ErrorBody builds an OpenAI error object. param and code are null when
+// empty; requestID is omitted when empty.
+func ErrorBody(message, errorType, param, code, requestID string) map[string]interface{} {
+	errorObj := map[string]interface{}{
+		"message": message,
+		"type":    errorType,
+		"param":   nullIfEmpty(param),
+		"code":    nullIfEmpty(code),
+	}
+	if requestID != "" {
+		errorObj["request_id"] = requestID
+	}
+	return map[string]interface{}{
+		"error": errorObj,
+	}
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
 // BuildResponseBase builds the base response structure for OpenAI-compatible responses
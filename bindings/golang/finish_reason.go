@@ -0,0 +1,30 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the reasons generation finishes.
+package smg
+
+// FinishReason is why generation of a choice stopped, as reported in the
+// finish_reason of responses and stream chunks. Backends may report reasons
+// other than the constants below.
+type FinishReason string
+
+// Finish reasons reported by the workers and OpenAI-compatible APIs.
+const (
+	// FinishReasonStop means the model ended its output or hit a stop
+	// sequence
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonLength means the output reached the token limit
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonToolCalls means the model called tools
+	FinishReasonToolCalls FinishReason = "tool_calls"
+	// FinishReasonContentFilter means the output was withheld by a filter
+	FinishReasonContentFilter FinishReason = "content_filter"
+	// FinishReasonAbort means the request was aborted before it finished
+	FinishReasonAbort FinishReason = "abort"
+)
+
+// IsTruncated reports whether the output was cut short by the token limit,
+// so that it may be incomplete, e.g. an unterminated JSON document.
+func (r FinishReason) IsTruncated() bool {
+	return r == FinishReasonLength
+}
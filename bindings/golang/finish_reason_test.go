@@ -0,0 +1,22 @@
+package smg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestFinishReason tests decoding finish reasons and detecting truncation
+func TestFinishReason(t *testing.T) {
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"Once upon"},"finish_reason":"length"}]}`), &resp); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if reason := resp.Choices[0].FinishReason; reason != FinishReasonLength || !reason.IsTruncated() {
+		t.Errorf("FinishReason = %q, want a truncated length", reason)
+	}
+	for _, reason := range []FinishReason{FinishReasonStop, FinishReasonToolCalls, FinishReasonContentFilter, FinishReasonAbort, ""} {
+		if reason.IsTruncated() {
+			t.Errorf("%q.IsTruncated() = true", reason)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package gemini converts between Google GenAI contents and SMG chat
+// messages, so that code building Gemini conversations can be reused to call
+// SMG workers:
+//
+//	messages, err := gemini.ChatMessages(systemInstruction, contents)
+//	...
+//	resp, err := client.CreateChatCompletion(ctx, smg.ChatCompletionRequest{Model: "default", Messages: messages})
+//	...
+//	reply, err := gemini.ResponseContent(resp)
+//
+// Content and its parts mirror the types of google.golang.org/genai, field
+// for field and with the same JSON encoding, so values of those types convert
+// with a JSON round trip.
+package gemini
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// Content is a turn of a conversation: Role is "user" or "model".
+type Content struct {
+	Role  string  `json:"role,omitempty"`
+	Parts []*Part `json:"parts,omitempty"`
+}
+
+// Part is a piece of content; one of its fields is set.
+type Part struct {
+	Text string `json:"text,omitempty"`
+	// Thought marks text that is the model's reasoning, which is not sent
+	// back to the model
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *Blob             `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// Blob is inline media, such as an image.
+type Blob struct {
+	MIMEType string `json:"mimeType,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// FileData is media referenced by URI.
+type FileData struct {
+	MIMEType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri,omitempty"`
+}
+
+// FunctionCall is a call the model made.
+type FunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// FunctionResponse is the result of a function call. By convention
+// Response holds the result under "output", or a failure under "error".
+type FunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name,omitempty"`
+	Response map[string]interface{} `json:"response,omitempty"`
+}
+
+// NewTextContent returns a content of text parts, like genai.NewContentFromText.
+func NewTextContent(role string, texts ...string) *Content {
+	content := &Content{Role: role}
+	for _, text := range texts {
+		content.Parts = append(content.Parts, &Part{Text: text})
+	}
+	return content
+}
+
+// ChatMessages converts a system instruction, which may be nil, and a
+// conversation to chat messages. Model contents become assistant messages,
+// with their function calls as tool calls, and function responses become
+// tool messages. Calls without an ID are given one, and responses without
+// an ID answer the earliest unanswered call of the same name. Images, inline
+// or by URI, become image parts; other media is rejected.
+func ChatMessages(systemInstruction *Content, contents []*Content) ([]smg.ChatMessage, error) {
+	var messages []smg.ChatMessage
+	if systemInstruction != nil {
+		if text := contentText(systemInstruction); text != "" {
+			messages = append(messages, smg.SystemText(text))
+		}
+	}
+
+	// pending are the IDs of the unanswered calls by function name
+	pending := map[string][]string{}
+	calls := 0
+	for i, content := range contents {
+		if content == nil {
+			continue
+		}
+		switch content.Role {
+		case "model":
+			msg := smg.AssistantText(contentText(content))
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				call := part.FunctionCall
+				calls++
+				id := call.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d", calls)
+				}
+				args, err := json.Marshal(call.Args)
+				if err != nil {
+					return nil, fmt.Errorf("contents[%d]: arguments of %s: %w", i, call.Name, err)
+				}
+				if call.Args == nil {
+					args = []byte("{}")
+				}
+				msg.ToolCalls = append(msg.ToolCalls, smg.ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: smg.FunctionCall{Name: call.Name, Arguments: string(args)},
+				})
+				pending[call.Name] = append(pending[call.Name], id)
+			}
+			messages = append(messages, msg)
+		case "user", "function", "":
+			var parts []smg.ContentPart
+			hasImage := false
+			for _, part := range content.Parts {
+				switch {
+				case part.FunctionResponse != nil:
+					resp := part.FunctionResponse
+					id := resp.ID
+					if ids := pending[resp.Name]; id == "" && len(ids) > 0 {
+						id = ids[0]
+					}
+					pending[resp.Name] = without(pending[resp.Name], id)
+					output, err := responseOutput(resp.Response)
+					if err != nil {
+						return nil, fmt.Errorf("contents[%d]: response of %s: %w", i, resp.Name, err)
+					}
+					messages = append(messages, smg.ToolResult(id, output))
+				case part.InlineData != nil:
+					if !isImage(part.InlineData.MIMEType) {
+						return nil, fmt.Errorf("contents[%d]: unsupported inline data type %q", i, part.InlineData.MIMEType)
+					}
+					parts = append(parts, smg.ImagePart(smg.ImageDataURL(part.InlineData.MIMEType, part.InlineData.Data)))
+					hasImage = true
+				case part.FileData != nil:
+					if part.FileData.MIMEType != "" && !isImage(part.FileData.MIMEType) {
+						return nil, fmt.Errorf("contents[%d]: unsupported file data type %q", i, part.FileData.MIMEType)
+					}
+					parts = append(parts, smg.ImagePart(part.FileData.FileURI))
+					hasImage = true
+				case part.Text != "" && !part.Thought:
+					parts = append(parts, smg.TextPart(part.Text))
+				}
+			}
+			switch {
+			case hasImage:
+				messages = append(messages, smg.UserParts(parts...))
+			case len(parts) > 0:
+				messages = append(messages, smg.UserText(contentText(content)))
+			}
+		default:
+			return nil, fmt.Errorf("contents[%d]: role must be user or model, got %q", i, content.Role)
+		}
+	}
+	return messages, nil
+}
+
+// Contents converts chat messages to a system instruction, nil if there is
+// no system message, and a conversation. Assistant messages become model
+// contents with a function call per tool call, and tool messages become
+// function responses, consecutive ones sharing a user content. Image parts
+// become inline data for data URLs and file data otherwise.
+func Contents(messages []smg.ChatMessage) (*Content, []*Content, error) {
+	var system *Content
+	var contents []*Content
+	// names are the function names of the calls by ID
+	names := map[string]string{}
+	for i, msg := range messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if system == nil {
+				system = &Content{}
+			}
+			system.Parts = append(system.Parts, &Part{Text: text})
+		case "user":
+			parts, err := userParts(msg.Content)
+			if err != nil {
+				return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			contents = append(contents, &Content{Role: "user", Parts: parts})
+		case "assistant":
+			content := &Content{Role: "model"}
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if text != "" {
+				content.Parts = append(content.Parts, &Part{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				var args map[string]interface{}
+				if call.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+						return nil, nil, fmt.Errorf("messages[%d]: arguments of %s: %w", i, call.Function.Name, err)
+					}
+				}
+				names[call.ID] = call.Function.Name
+				content.Parts = append(content.Parts, &Part{FunctionCall: &FunctionCall{ID: call.ID, Name: call.Function.Name, Args: args}})
+			}
+			contents = append(contents, content)
+		case "tool":
+			text, err := messageText(msg.Content)
+			if err != nil {
+				return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			part := &Part{FunctionResponse: &FunctionResponse{
+				ID:       msg.ToolCallID,
+				Name:     names[msg.ToolCallID],
+				Response: map[string]interface{}{"output": text},
+			}}
+			if last := len(contents) - 1; last >= 0 && contents[last].Role == "user" && isFunctionResponses(contents[last]) {
+				contents[last].Parts = append(contents[last].Parts, part)
+				continue
+			}
+			contents = append(contents, &Content{Role: "user", Parts: []*Part{part}})
+		default:
+			return nil, nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+	return system, contents, nil
+}
+
+// ResponseContent converts the first choice of a chat completion to a model
+// content.
+func ResponseContent(resp *smg.ChatCompletionResponse) (*Content, error) {
+	if len(resp.Choices) == 0 {
+		return &Content{Role: "model"}, nil
+	}
+	msg := resp.Choices[0].Message
+	_, contents, err := Contents([]smg.ChatMessage{{Role: "assistant", Content: msg.Content, ToolCalls: msg.ToolCalls}})
+	if err != nil {
+		return nil, err
+	}
+	return contents[0], nil
+}
+
+// contentText returns the text of a content's parts, except thoughts
+func contentText(content *Content) string {
+	var texts []string
+	for _, part := range content.Parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// responseOutput returns a function response as tool message content: the
+// output itself when it is the only, string, field, and JSON otherwise
+func responseOutput(response map[string]interface{}) (string, error) {
+	if output, ok := response["output"].(string); ok && len(response) == 1 {
+		return output, nil
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// userParts converts user message content, a string or content parts
+func userParts(content interface{}) ([]*Part, error) {
+	switch content := content.(type) {
+	case string:
+		return []*Part{{Text: content}}, nil
+	case []smg.ContentPart:
+		parts := make([]*Part, 0, len(content))
+		for _, p := range content {
+			switch p.Type {
+			case "text":
+				parts = append(parts, &Part{Text: p.Text})
+			case "image_url":
+				if p.ImageURL == nil {
+					return nil, fmt.Errorf("image_url part has no URL")
+				}
+				part, err := imagePart(p.ImageURL.URL)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, part)
+			default:
+				return nil, fmt.Errorf("unsupported content part %q", p.Type)
+			}
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("unsupported content type %T", content)
+}
+
+// imagePart returns inline data for a data URL and file data otherwise
+func imagePart(url string) (*Part, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return &Part{FileData: &FileData{FileURI: url}}, nil
+	}
+	header, encoded, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !ok || !isBase64 {
+		return nil, fmt.Errorf("image data URL must be base64")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("image data URL: %w", err)
+	}
+	return &Part{InlineData: &Blob{MIMEType: mimeType, Data: data}}, nil
+}
+
+// messageText returns message content that must be text
+func messageText(content interface{}) (string, error) {
+	switch content := content.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return content, nil
+	case []smg.ContentPart:
+		var texts []string
+		for _, p := range content {
+			if p.Type != "text" {
+				return "", fmt.Errorf("unsupported content part %q", p.Type)
+			}
+			texts = append(texts, p.Text)
+		}
+		return strings.Join(texts, "\n"), nil
+	}
+	return "", fmt.Errorf("unsupported content type %T", content)
+}
+
+func isFunctionResponses(content *Content) bool {
+	for _, part := range content.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// without returns ids without the first occurrence of id
+func without(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,100 @@
+package gemini
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// TestChatMessages tests roles, images, and pairing of function calls with
+// their responses
+func TestChatMessages(t *testing.T) {
+	contents := []*Content{
+		{Role: "user", Parts: []*Part{
+			{InlineData: &Blob{MIMEType: "image/png", Data: []byte{1, 2, 3}}},
+			{Text: "Weather where this was taken?"},
+		}},
+		{Role: "model", Parts: []*Part{
+			{Text: "Thinking it over", Thought: true},
+			{FunctionCall: &FunctionCall{Name: "weather", Args: map[string]interface{}{"city": "Paris"}}},
+			{FunctionCall: &FunctionCall{ID: "fc_9", Name: "time"}},
+		}},
+		{Role: "user", Parts: []*Part{
+			{FunctionResponse: &FunctionResponse{Name: "weather", Response: map[string]interface{}{"output": "sunny"}}},
+			{FunctionResponse: &FunctionResponse{Name: "time", Response: map[string]interface{}{"hour": 9.0}}},
+		}},
+	}
+	messages, err := ChatMessages(NewTextContent("", "Be brief."), contents)
+	if err != nil {
+		t.Fatalf("ChatMessages() error: %v", err)
+	}
+
+	want := []smg.ChatMessage{
+		smg.SystemText("Be brief."),
+		smg.UserParts(smg.ImagePart("data:image/png;base64,AQID"), smg.TextPart("Weather where this was taken?")),
+		smg.AssistantToolCalls(
+			smg.ToolCall{ID: "call_1", Type: "function", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+			smg.ToolCall{ID: "fc_9", Type: "function", Function: smg.FunctionCall{Name: "time", Arguments: `{}`}},
+		),
+		smg.ToolResult("call_1", "sunny"),
+		smg.ToolResult("fc_9", `{"hour":9}`),
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("ChatMessages() =\n%+v\nwant\n%+v", messages, want)
+	}
+
+	if _, err := ChatMessages(nil, []*Content{{Role: "user", Parts: []*Part{{InlineData: &Blob{MIMEType: "audio/wav"}}}}}); err == nil {
+		t.Error("ChatMessages() accepted audio, want error")
+	}
+	if _, err := ChatMessages(nil, []*Content{{Role: "system"}}); err == nil {
+		t.Error("ChatMessages() accepted role system, want error")
+	}
+}
+
+// TestContents tests the conversion back and a round trip
+func TestContents(t *testing.T) {
+	messages := []smg.ChatMessage{
+		smg.SystemText("Be brief."),
+		smg.UserImage("https://example.com/cat.png", "What breed?"),
+		smg.AssistantToolCalls(smg.ToolCall{ID: "call_1", Type: "function", Function: smg.FunctionCall{Name: "lookup", Arguments: `{"q":"cat"}`}}),
+		smg.ToolResult("call_1", "tabby"),
+		smg.AssistantText("A tabby."),
+	}
+	system, contents, err := Contents(messages)
+	if err != nil {
+		t.Fatalf("Contents() error: %v", err)
+	}
+	if system == nil || system.Parts[0].Text != "Be brief." {
+		t.Errorf("system instruction = %+v", system)
+	}
+	data, _ := json.Marshal(contents)
+	want := `[{"role":"user","parts":[{"fileData":{"fileUri":"https://example.com/cat.png"}},{"text":"What breed?"}]},` +
+		`{"role":"model","parts":[{"functionCall":{"id":"call_1","name":"lookup","args":{"q":"cat"}}}]},` +
+		`{"role":"user","parts":[{"functionResponse":{"id":"call_1","name":"lookup","response":{"output":"tabby"}}}]},` +
+		`{"role":"model","parts":[{"text":"A tabby."}]}]`
+	if string(data) != want {
+		t.Errorf("Contents() =\n%s\nwant\n%s", data, want)
+	}
+
+	back, err := ChatMessages(system, contents)
+	if err != nil {
+		t.Fatalf("ChatMessages() error: %v", err)
+	}
+	if !reflect.DeepEqual(back, messages) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", back, messages)
+	}
+
+	if _, _, err := Contents([]smg.ChatMessage{smg.UserParts(smg.ImagePart("data:image/png,raw"))}); err == nil {
+		t.Error("Contents() accepted a data URL that is not base64, want error")
+	}
+}
+
+// TestResponseContent tests converting a completion to a model content
+func TestResponseContent(t *testing.T) {
+	content, err := ResponseContent(&smg.ChatCompletionResponse{Choices: []smg.Choice{{Message: smg.Message{Role: "assistant", Content: "Paris"}}}})
+	if err != nil || content.Role != "model" || len(content.Parts) != 1 || content.Parts[0].Text != "Paris" {
+		t.Errorf("ResponseContent() = %+v, %v", content, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides groups of named generations that run concurrently.
+package smg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// GroupError is returned by GenerationGroup.Wait for the generation that
+// failed the group.
+type GroupError struct {
+	// Name is the name the generation was started with
+	Name string
+	Err  error
+}
+
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("generation %q: %v", e.Name, e.Err)
+}
+
+func (e *GroupError) Unwrap() error {
+	return e.Err
+}
+
+// GenerationGroup runs named generations concurrently and fails as a unit:
+// the first generation to fail cancels the others. It is the fan-out of a
+// prompt pipeline, e.g. summarizing, classifying, and extracting from the
+// same document at once.
+//
+//	g := smg.Group(ctx, client)
+//	g.Go("summary", summaryReq)
+//	g.Go("topics", topicsReq)
+//	results, err := g.Wait()
+//	if err != nil {
+//	    return err
+//	}
+//	summary := results["summary"].Choices[0].Message.Content
+type GenerationGroup struct {
+	client ChatClient
+	group  *errgroup.Group
+	ctx    context.Context
+
+	mu      sync.Mutex
+	names   map[string]bool
+	results map[string]*ChatCompletionResponse
+}
+
+// Group returns an empty group sending generations through client. The
+// generations run with a context derived from ctx, which is cancelled when
+// one of them fails or Wait returns.
+func Group(ctx context.Context, client ChatClient) *GenerationGroup {
+	group, groupCtx := errgroup.WithContext(ctx)
+	return &GenerationGroup{
+		client:  client,
+		group:   group,
+		ctx:     groupCtx,
+		names:   make(map[string]bool),
+		results: make(map[string]*ChatCompletionResponse),
+	}
+}
+
+// SetLimit limits the number of generations in flight to n; Go blocks until
+// one of them finishes. A negative n removes the limit. It must not be
+// called while generations are running.
+func (g *GenerationGroup) SetLimit(n int) {
+	g.group.SetLimit(n)
+}
+
+// Go starts generating req under name.
+func (g *GenerationGroup) Go(name string, req ChatCompletionRequest) {
+	g.GoFunc(name, func(ctx context.Context, client ChatClient) (*ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, req)
+	})
+}
+
+// GoFunc starts generate under name, for generations of more than one
+// request, such as a structured output with retries. generate must return
+// when ctx is done.
+//
+// Names must be unique within the group; a repeated name fails the group
+// with ErrInvalidRequest.
+func (g *GenerationGroup) GoFunc(name string, generate func(ctx context.Context, client ChatClient) (*ChatCompletionResponse, error)) {
+	g.mu.Lock()
+	duplicate := g.names[name]
+	g.names[name] = true
+	g.mu.Unlock()
+
+	g.group.Go(func() error {
+		if duplicate {
+			return &GroupError{Name: name, Err: invalidRequest("duplicate generation name")}
+		}
+		resp, err := generate(g.ctx, g.client)
+		if err != nil {
+			return &GroupError{Name: name, Err: err}
+		}
+		g.mu.Lock()
+		g.results[name] = resp
+		g.mu.Unlock()
+		return nil
+	})
+}
+
+// Wait waits for the generations and returns their responses by name. If
+// one failed, the error is a *GroupError naming the first to fail, and the
+// results hold the generations that succeeded before the others were
+// cancelled.
+func (g *GenerationGroup) Wait() (map[string]*ChatCompletionResponse, error) {
+	err := g.group.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	results := make(map[string]*ChatCompletionResponse, len(g.results))
+	for name, resp := range g.results {
+		results[name] = resp
+	}
+	return results, err
+}
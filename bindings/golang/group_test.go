@@ -0,0 +1,79 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestGroup tests collecting the results of named generations
+func TestGroup(t *testing.T) {
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{Model: req.Model}, nil
+	})
+	g := Group(context.Background(), client)
+	g.SetLimit(1)
+	g.Go("a", ChatCompletionRequest{Model: "model-a"})
+	g.Go("b", ChatCompletionRequest{Model: "model-b"})
+	g.GoFunc("c", func(ctx context.Context, client ChatClient) (*ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "model-c"})
+	})
+
+	results, err := g.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results["a"].Model != "model-a" || results["b"].Model != "model-b" || results["c"].Model != "model-c" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+// TestGroupCancel tests that a failure cancels the other generations
+func TestGroupCancel(t *testing.T) {
+	failure := errors.New("backend down")
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		switch req.Model {
+		case "fast":
+			return &ChatCompletionResponse{Model: req.Model}, nil
+		case "failing":
+			return nil, failure
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return &ChatCompletionResponse{Model: req.Model}, nil
+		}
+	})
+	g := Group(context.Background(), client)
+	g.Go("fast", ChatCompletionRequest{Model: "fast"})
+	g.Go("slow", ChatCompletionRequest{Model: "slow"})
+	g.Go("failing", ChatCompletionRequest{Model: "failing"})
+
+	start := time.Now()
+	results, err := g.Wait()
+	var groupErr *GroupError
+	if !errors.As(err, &groupErr) || groupErr.Name != "failing" || !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want the failing generation's error", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the slow generation was not cancelled")
+	}
+	if _, ok := results["slow"]; ok {
+		t.Errorf("results = %+v, want no slow result", results)
+	}
+}
+
+// TestGroupDuplicateName tests that reusing a name fails the group
+func TestGroupDuplicateName(t *testing.T) {
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{}, nil
+	})
+	g := Group(context.Background(), client)
+	g.Go("a", ChatCompletionRequest{})
+	g.Go("a", ChatCompletionRequest{})
+	if _, err := g.Wait(); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("err = %v, want ErrInvalidRequest", err)
+	}
+}
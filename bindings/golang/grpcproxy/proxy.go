@@ -0,0 +1,276 @@
+// Package grpcproxy serves the SGLang scheduler gRPC service and forwards
+// each call to a worker of an SMG MultiClient, so that existing gRPC clients
+// of a single worker can be pointed at a load-balancing proxy instead:
+//
+//	client, err := smg.NewMultiClient(smg.MultiClientConfig{Endpoints: "grpc://w1:20000,grpc://w2:20000", ...})
+//	...
+//	proxy := grpcproxy.New(client)
+//	defer proxy.Close()
+//	server := grpc.NewServer()
+//	proxy.Register(server)
+//	server.Serve(listener)
+//
+// Requests are forwarded unchanged, already tokenized, so the proxy balances
+// by load rather than with the MultiClient's policy: each call goes to the
+// healthy worker with the fewest requests in flight. Changes to the
+// MultiClient's workers, such as AddWorker, SetWorkerHealth, and
+// DrainWorker, apply to the proxy on its next call.
+package grpcproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
+)
+
+// Pool is the source of the workers to forward to. *smg.MultiClient
+// implements it.
+type Pool interface {
+	Workers() ([]smg.WorkerStatus, error)
+}
+
+// Proxy forwards calls of the SGLang scheduler service to the workers of a
+// Pool. Generate, Embed, HealthCheck, Abort, GetModelInfo, GetServerInfo,
+// and GetTokenizer are forwarded; the administrative calls, which target a
+// single worker, return codes.Unimplemented.
+//
+// Thread-safe: All methods are safe for concurrent use.
+type Proxy struct {
+	proto.UnimplementedSglangSchedulerServer
+	pool Pool
+
+	mu    sync.Mutex
+	conns map[string]*worker
+	// requests maps the IDs of Generate requests in flight to their worker,
+	// so that Abort reaches it
+	requests map[string]*worker
+	closed   bool
+}
+
+// worker is a connection to a worker and the calls in flight on it
+type worker struct {
+	conn     *grpc.ClientConn
+	client   proto.SglangSchedulerClient
+	inFlight int
+}
+
+// New returns a proxy forwarding to the workers of pool. Call Close to
+// release its connections.
+func New(pool Pool) *Proxy {
+	return &Proxy{
+		pool:     pool,
+		conns:    make(map[string]*worker),
+		requests: make(map[string]*worker),
+	}
+}
+
+// Register registers the proxy as the SGLang scheduler service of s.
+func (p *Proxy) Register(s grpc.ServiceRegistrar) {
+	proto.RegisterSglangSchedulerServer(s, p)
+}
+
+// Close closes the connections to the workers. Calls in flight fail.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	var errs []error
+	for endpoint, w := range p.conns {
+		errs = append(errs, w.conn.Close())
+		delete(p.conns, endpoint)
+	}
+	return errors.Join(errs...)
+}
+
+// acquire picks the healthy worker with the fewest requests in flight, as
+// reported by the pool plus those this proxy has sent, and counts the call
+// against it. The caller must release the worker.
+func (p *Proxy) acquire() (*worker, error) {
+	statuses, err := p.pool.Workers()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "listing workers: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, status.Error(codes.Unavailable, "proxy is closed")
+	}
+	p.forget(statuses)
+
+	var best *worker
+	bestLoad := 0
+	for _, s := range statuses {
+		if !s.Healthy {
+			continue
+		}
+		w, err := p.connect(s.Endpoint)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "connecting to %s: %v", s.Endpoint, err)
+		}
+		if load := s.Load + w.inFlight; best == nil || load < bestLoad {
+			best, bestLoad = w, load
+		}
+	}
+	if best == nil {
+		return nil, status.Error(codes.Unavailable, smg.ErrNoHealthyWorkers.Error())
+	}
+	best.inFlight++
+	return best, nil
+}
+
+func (p *Proxy) release(w *worker) {
+	p.mu.Lock()
+	w.inFlight--
+	p.mu.Unlock()
+}
+
+// connect returns the connection to endpoint, dialing it the first time.
+// p.mu must be held.
+func (p *Proxy) connect(endpoint string) (*worker, error) {
+	if w, ok := p.conns[endpoint]; ok {
+		return w, nil
+	}
+	conn, err := grpc.NewClient(strings.TrimPrefix(endpoint, "grpc://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	w := &worker{conn: conn, client: proto.NewSglangSchedulerClient(conn)}
+	p.conns[endpoint] = w
+	return w, nil
+}
+
+// forget closes the idle connections to workers no longer in the pool.
+// p.mu must be held.
+func (p *Proxy) forget(statuses []smg.WorkerStatus) {
+	listed := make(map[string]bool, len(statuses))
+	for _, s := range statuses {
+		listed[s.Endpoint] = true
+	}
+	for endpoint, w := range p.conns {
+		if !listed[endpoint] && w.inFlight == 0 {
+			w.conn.Close()
+			delete(p.conns, endpoint)
+		}
+	}
+}
+
+// Generate forwards a generation request and relays its responses.
+func (p *Proxy) Generate(req *proto.GenerateRequest, stream grpc.ServerStreamingServer[proto.GenerateResponse]) error {
+	w, err := p.acquire()
+	if err != nil {
+		return err
+	}
+	defer p.release(w)
+	if id := req.GetRequestId(); id != "" {
+		p.mu.Lock()
+		p.requests[id] = w
+		p.mu.Unlock()
+		defer func() {
+			p.mu.Lock()
+			delete(p.requests, id)
+			p.mu.Unlock()
+		}()
+	}
+
+	upstream, err := w.client.Generate(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return relay(upstream, stream)
+}
+
+// GetTokenizer forwards a tokenizer request and relays its chunks.
+func (p *Proxy) GetTokenizer(req *proto.GetTokenizerRequest, stream grpc.ServerStreamingServer[proto.GetTokenizerChunk]) error {
+	w, err := p.acquire()
+	if err != nil {
+		return err
+	}
+	defer p.release(w)
+	upstream, err := w.client.GetTokenizer(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return relay(upstream, stream)
+}
+
+// relay sends the messages of upstream to downstream until upstream ends.
+// Upstream errors are returned as they are, keeping their status.
+func relay[T any](upstream grpc.ServerStreamingClient[T], downstream grpc.ServerStreamingServer[T]) error {
+	for {
+		msg, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := downstream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Embed forwards an embedding request.
+func (p *Proxy) Embed(ctx context.Context, req *proto.EmbedRequest) (*proto.EmbedResponse, error) {
+	w, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(w)
+	return w.client.Embed(ctx, req)
+}
+
+// HealthCheck forwards a health check, so it passes while any worker is
+// healthy.
+func (p *Proxy) HealthCheck(ctx context.Context, req *proto.HealthCheckRequest) (*proto.HealthCheckResponse, error) {
+	w, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(w)
+	return w.client.HealthCheck(ctx, req)
+}
+
+// GetModelInfo forwards a model information request. The workers are
+// expected to serve the same model.
+func (p *Proxy) GetModelInfo(ctx context.Context, req *proto.GetModelInfoRequest) (*proto.GetModelInfoResponse, error) {
+	w, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(w)
+	return w.client.GetModelInfo(ctx, req)
+}
+
+// GetServerInfo forwards a server information request.
+func (p *Proxy) GetServerInfo(ctx context.Context, req *proto.GetServerInfoRequest) (*proto.GetServerInfoResponse, error) {
+	w, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(w)
+	return w.client.GetServerInfo(ctx, req)
+}
+
+// Abort forwards an abort to the worker running the request. Aborting a
+// request that is not in flight succeeds without reaching a worker.
+func (p *Proxy) Abort(ctx context.Context, req *proto.AbortRequest) (*proto.AbortResponse, error) {
+	p.mu.Lock()
+	w, ok := p.requests[req.GetRequestId()]
+	p.mu.Unlock()
+	if !ok {
+		return &proto.AbortResponse{Success: true, Message: "request is not in flight"}, nil
+	}
+	return w.client.Abort(ctx, req)
+}
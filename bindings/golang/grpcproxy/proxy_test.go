@@ -0,0 +1,170 @@
+package grpcproxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
+)
+
+// fakeWorker streams two chunks per request, or holds requests whose ID is
+// "hold" until they are aborted
+type fakeWorker struct {
+	proto.UnimplementedSglangSchedulerServer
+	name     string
+	endpoint string
+
+	held    chan struct{}
+	aborted chan struct{}
+}
+
+func startWorker(t *testing.T, name string) *fakeWorker {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	w := &fakeWorker{name: name, endpoint: "grpc://" + lis.Addr().String(), held: make(chan struct{}), aborted: make(chan struct{})}
+	server := grpc.NewServer()
+	proto.RegisterSglangSchedulerServer(server, w)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return w
+}
+
+func (w *fakeWorker) Generate(req *proto.GenerateRequest, stream grpc.ServerStreamingServer[proto.GenerateResponse]) error {
+	if req.RequestId == "hold" {
+		close(w.held)
+		<-w.aborted
+		return status.Error(codes.Canceled, "aborted")
+	}
+	for _, id := range req.Tokenized.InputIds {
+		chunk := &proto.GenerateResponse{RequestId: req.RequestId, Response: &proto.GenerateResponse_Chunk{Chunk: &proto.GenerateStreamChunk{TokenIds: []uint32{id + 1}}}}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *fakeWorker) HealthCheck(ctx context.Context, req *proto.HealthCheckRequest) (*proto.HealthCheckResponse, error) {
+	return &proto.HealthCheckResponse{Healthy: true, Message: w.name}, nil
+}
+
+func (w *fakeWorker) Abort(ctx context.Context, req *proto.AbortRequest) (*proto.AbortResponse, error) {
+	close(w.aborted)
+	return &proto.AbortResponse{Success: true, Message: w.name}, nil
+}
+
+// pool is a Pool with fixed statuses
+type pool struct {
+	mu       sync.Mutex
+	statuses []smg.WorkerStatus
+}
+
+func (p *pool) Workers() ([]smg.WorkerStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]smg.WorkerStatus(nil), p.statuses...), nil
+}
+
+func (p *pool) set(statuses ...smg.WorkerStatus) {
+	p.mu.Lock()
+	p.statuses = statuses
+	p.mu.Unlock()
+}
+
+// serveProxy starts a proxy for pool and returns a client of it
+func serveProxy(t *testing.T, pool Pool) proto.SglangSchedulerClient {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	proxy := New(pool)
+	server := grpc.NewServer()
+	proxy.Register(server)
+	go server.Serve(lis)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+		proxy.Close()
+	})
+	return proto.NewSglangSchedulerClient(conn)
+}
+
+// TestRouting tests that calls go to the least loaded healthy worker
+func TestRouting(t *testing.T) {
+	a, b := startWorker(t, "a"), startWorker(t, "b")
+	p := &pool{}
+	client := serveProxy(t, p)
+	ctx := context.Background()
+
+	p.set(smg.WorkerStatus{Endpoint: a.endpoint, Healthy: true, Load: 3}, smg.WorkerStatus{Index: 1, Endpoint: b.endpoint, Healthy: true})
+	if resp, err := client.HealthCheck(ctx, &proto.HealthCheckRequest{}); err != nil || resp.Message != "b" {
+		t.Errorf("HealthCheck() = %v, %v; want worker b", resp, err)
+	}
+	p.set(smg.WorkerStatus{Endpoint: a.endpoint, Healthy: true, Load: 3}, smg.WorkerStatus{Index: 1, Endpoint: b.endpoint})
+	if resp, err := client.HealthCheck(ctx, &proto.HealthCheckRequest{}); err != nil || resp.Message != "a" {
+		t.Errorf("HealthCheck() = %v, %v; want worker a", resp, err)
+	}
+	p.set(smg.WorkerStatus{Endpoint: a.endpoint}, smg.WorkerStatus{Index: 1, Endpoint: b.endpoint})
+	if _, err := client.HealthCheck(ctx, &proto.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("HealthCheck() with no healthy workers error = %v, want Unavailable", err)
+	}
+	if _, err := client.FlushCache(ctx, &proto.FlushCacheRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("FlushCache() error = %v, want Unimplemented", err)
+	}
+}
+
+// TestGenerate tests relaying a stream and aborting a request in flight
+func TestGenerate(t *testing.T) {
+	w := startWorker(t, "a")
+	p := &pool{}
+	p.set(smg.WorkerStatus{Endpoint: w.endpoint, Healthy: true})
+	client := serveProxy(t, p)
+	ctx := context.Background()
+
+	stream, err := client.Generate(ctx, &proto.GenerateRequest{RequestId: "r1", Tokenized: &proto.TokenizedInput{InputIds: []uint32{1, 2}}})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	var tokens []uint32
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		tokens = append(tokens, resp.GetChunk().TokenIds...)
+	}
+	if len(tokens) != 2 || tokens[0] != 2 || tokens[1] != 3 {
+		t.Errorf("tokens = %v, want [2 3]", tokens)
+	}
+
+	held, err := client.Generate(ctx, &proto.GenerateRequest{RequestId: "hold", Tokenized: &proto.TokenizedInput{}})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	<-w.held
+	if resp, err := client.Abort(ctx, &proto.AbortRequest{RequestId: "hold"}); err != nil || resp.Message != "a" {
+		t.Errorf("Abort() = %v, %v; want it forwarded to the worker", resp, err)
+	}
+	if _, err := held.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("aborted stream error = %v, want Canceled", err)
+	}
+	if resp, err := client.Abort(ctx, &proto.AbortRequest{RequestId: "unknown"}); err != nil || !resp.Success {
+		t.Errorf("Abort(unknown) = %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides guardrails that check requests and scan model output.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ErrBlocked is matched, with errors.Is, by the *GuardrailError returned when
+// a guardrail blocks a request or its output.
+var ErrBlocked = errors.New("blocked by guardrail")
+
+// Violation is a guardrail policy match.
+type Violation struct {
+	// Guardrail names the policy, e.g. "prompt_injection"
+	Guardrail string
+	Reason    string
+}
+
+// GuardrailError is returned when a guardrail fires.
+type GuardrailError struct {
+	Violation
+	// Output is true if the model output, rather than the request, matched
+	Output bool
+}
+
+func (e *GuardrailError) Error() string {
+	stage := "request"
+	if e.Output {
+		stage = "output"
+	}
+	return fmt.Sprintf("%s blocked by guardrail %s: %s", stage, e.Guardrail, e.Reason)
+}
+
+func (e *GuardrailError) Unwrap() error {
+	return ErrBlocked
+}
+
+// InputChecker checks a request before it is sent. It returns a non-nil
+// Violation to block the request; an error fails the request.
+type InputChecker interface {
+	CheckInput(ctx context.Context, req ChatCompletionRequest) (*Violation, error)
+}
+
+// OutputScanner scans model output. It is called with the text of a choice
+// so far each time the choice grows, and once with the full text of a
+// non-streaming response, so that it can match across chunk boundaries.
+type OutputScanner interface {
+	ScanOutput(ctx context.Context, text string) (*Violation, error)
+}
+
+// InputCheckFunc adapts a function to InputChecker.
+type InputCheckFunc func(ctx context.Context, req ChatCompletionRequest) (*Violation, error)
+
+func (f InputCheckFunc) CheckInput(ctx context.Context, req ChatCompletionRequest) (*Violation, error) {
+	return f(ctx, req)
+}
+
+// OutputScanFunc adapts a function to OutputScanner.
+type OutputScanFunc func(ctx context.Context, text string) (*Violation, error)
+
+func (f OutputScanFunc) ScanOutput(ctx context.Context, text string) (*Violation, error) {
+	return f(ctx, text)
+}
+
+// Guardrails lists the checks of WithGuardrails.
+type Guardrails struct {
+	Input  []InputChecker
+	Output []OutputScanner
+}
+
+// WithGuardrails returns a middleware that checks each request with the
+// input checkers before it is sent and scans the output with the output
+// scanners. A blocked request fails with a *GuardrailError without reaching
+// the client. When output matches, a non-streaming request fails with it; a
+// stream returns it from RecvJSON in place of the matching chunk and is
+// closed, aborting the generation. Chunks before the match have already
+// been returned.
+func WithGuardrails(g Guardrails) ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &guardedClient{next: next, guardrails: g}
+	}
+}
+
+type guardedClient struct {
+	next       ChatClient
+	guardrails Guardrails
+}
+
+func (c *guardedClient) checkInput(ctx context.Context, req ChatCompletionRequest) error {
+	for _, checker := range c.guardrails.Input {
+		violation, err := checker.CheckInput(ctx, req)
+		if err != nil {
+			return err
+		}
+		if violation != nil {
+			return &GuardrailError{Violation: *violation}
+		}
+	}
+	return nil
+}
+
+func (c *guardedClient) scanOutput(ctx context.Context, text string) error {
+	for _, scanner := range c.guardrails.Output {
+		violation, err := scanner.ScanOutput(ctx, text)
+		if err != nil {
+			return err
+		}
+		if violation != nil {
+			return &GuardrailError{Violation: *violation, Output: true}
+		}
+	}
+	return nil
+}
+
+func (c *guardedClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := c.checkInput(ctx, req); err != nil {
+		return nil, err
+	}
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, choice := range resp.Choices {
+		if err := c.scanOutput(ctx, choice.Message.Content); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (c *guardedClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	if err := c.checkInput(ctx, req); err != nil {
+		return nil, err
+	}
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &guardedStream{ChatStream: stream, ctx: ctx, client: c, text: map[int]*strings.Builder{}}, nil
+}
+
+// guardedStream scans the text of each choice as it streams
+type guardedStream struct {
+	ChatStream
+	ctx    context.Context
+	client *guardedClient
+	// text holds the content of each choice so far
+	text map[int]*strings.Builder
+	err  error
+}
+
+func (s *guardedStream) RecvJSON() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	chunkJSON, err := s.ChatStream.RecvJSON()
+	if err != nil || len(s.client.guardrails.Output) == 0 {
+		return chunkJSON, err
+	}
+
+	var chunk ChatCompletionStreamResponse
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return chunkJSON, nil
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content == "" {
+			continue
+		}
+		text := s.text[choice.Index]
+		if text == nil {
+			text = &strings.Builder{}
+			s.text[choice.Index] = text
+		}
+		text.WriteString(choice.Delta.Content)
+		if err := s.client.scanOutput(s.ctx, text.String()); err != nil {
+			s.err = err
+			s.ChatStream.Close()
+			return "", err
+		}
+	}
+	return chunkJSON, nil
+}
+
+// Close closes the underlying stream; after a match it is already closed.
+func (s *guardedStream) Close() error {
+	if s.err != nil {
+		return nil
+	}
+	s.err = io.EOF
+	return s.ChatStream.Close()
+}
+
+// PatternGuardrail is an InputChecker and OutputScanner that matches text
+// against regular expressions. As an input checker it scans the text of the
+// request's messages; set Roles to scan only some, e.g. "user".
+type PatternGuardrail struct {
+	Name     string
+	Patterns []*regexp.Regexp
+	Roles    []string
+}
+
+// CheckInput reports the first pattern matching a message.
+func (g *PatternGuardrail) CheckInput(ctx context.Context, req ChatCompletionRequest) (*Violation, error) {
+	for _, msg := range req.Messages {
+		if len(g.Roles) > 0 && !containsString(g.Roles, msg.Role) {
+			continue
+		}
+		if v := g.match(messageText(msg.Content)); v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// ScanOutput reports the first pattern matching text.
+func (g *PatternGuardrail) ScanOutput(ctx context.Context, text string) (*Violation, error) {
+	return g.match(text), nil
+}
+
+func (g *PatternGuardrail) match(text string) *Violation {
+	for _, pattern := range g.Patterns {
+		if pattern.MatchString(text) {
+			return &Violation{Guardrail: g.Name, Reason: fmt.Sprintf("matched %s", pattern)}
+		}
+	}
+	return nil
+}
+
+// PromptInjectionGuardrail returns a PatternGuardrail, named
+// "prompt_injection", for common attempts in user messages to override the
+// system prompt. It is a first line of defense, not a classifier.
+func PromptInjectionGuardrail() *PatternGuardrail {
+	return &PatternGuardrail{
+		Name:  "prompt_injection",
+		Roles: []string{"user"},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+(all\s+|any\s+|the\s+)?(previous|prior|above|earlier|system)\s+(instructions|prompts?|rules|messages)`),
+			regexp.MustCompile(`(?i)\b(reveal|print|show|repeat)\s+(me\s+)?(your|the)\s+(system\s+prompt|hidden\s+instructions)`),
+			regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(in\s+)?(developer|dan|jailbreak)\s+mode\b`),
+		},
+	}
+}
+
+// PIIGuardrail returns a PatternGuardrail, named "pii", for email
+// addresses, US Social Security numbers, payment card numbers, and phone
+// numbers.
+func PIIGuardrail() *PatternGuardrail {
+	return &PatternGuardrail{
+		Name:     "pii",
+		Patterns: []*regexp.Regexp{emailPattern, ssnPattern, cardPattern, phonePattern},
+	}
+}
+
+// messageText returns the text of message content: a string, or the text
+// parts of a list of content parts
+func messageText(content interface{}) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []ContentPart:
+		var parts []string
+		for _, part := range content {
+			if part.Type == "text" {
+				parts = append(parts, part.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	case []interface{}:
+		var parts []string
+		for _, part := range content {
+			if part, ok := part.(map[string]interface{}); ok {
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
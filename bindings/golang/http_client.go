@@ -0,0 +1,254 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides a chat client for OpenAI-compatible HTTP APIs.
+package smg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPClientConfig configures an HTTPClient.
+type HTTPClientConfig struct {
+	// BaseURL is the API root that "/chat/completions" is appended to, e.g.
+	// "https://api.openai.com/v1". Required.
+	BaseURL string
+	// APIKey, if set, is sent as a bearer token.
+	APIKey string
+	// Headers are added to every request, e.g. an organization header.
+	Headers map[string]string
+	// HTTPClient sends the requests. Defaults to http.DefaultClient; set one
+	// with a Timeout to bound requests without a context deadline.
+	HTTPClient *http.Client
+	// StrictDecoding, if set, reports response fields the SDK does not
+	// decode.
+	StrictDecoding *StrictDecoding
+}
+
+// HTTPClient is a ChatClient for any OpenAI-compatible HTTP API, such as a
+// hosted provider or another gateway. It lets code written against ChatClient
+// fall back from SMG workers to a hosted API. It is safe for concurrent use.
+//
+// Requests are sent as JSON; fields specific to SMG, such as TopK, should be
+// left unset for APIs that reject unknown parameters. The request ID of the
+// context is sent as the X-Request-ID header rather than as Rid, except in
+// session requests, whose Rid names the turn for the next one to continue.
+type HTTPClient struct {
+	config HTTPClientConfig
+	client *http.Client
+	strict *strictDecoder
+}
+
+var _ ChatClient = (*HTTPClient)(nil)
+
+// HTTPError is the error returned for a response with a non-2xx status. It
+// matches ErrInvalidRequest for 400, 404, and 422 and ErrNoHealthyWorkers for
+// 502, 503, and 504 with errors.Is.
+type HTTPError struct {
+	StatusCode int
+	// Message, Type, and Code are from the OpenAI error body, if any
+	Message string
+	Type    string
+	Code    string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the classification error of the status, if any.
+func (e *HTTPError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return ErrInvalidRequest
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrNoHealthyWorkers
+	}
+	return nil
+}
+
+// NewHTTPClient creates a client for the API at config.BaseURL.
+func NewHTTPClient(config HTTPClientConfig) (*HTTPClient, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("base URL is required")
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPClient{config: config, client: client, strict: newStrictDecoder(config.StrictDecoding)}, nil
+}
+
+// CreateChatCompletion sends a non-streaming chat completion request.
+func (c *HTTPClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req.Stream = false
+	req.StreamOptions = nil
+	if req.SessionParams == nil {
+		req.Rid = nil
+	}
+	resp, err := c.post(ctx, "/chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var result ChatCompletionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := c.strict.check(body, result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateChatCompletionStream sends a streaming chat completion request. The
+// server-sent events are returned by RecvJSON as chunks; cancelling ctx or
+// calling Close ends the stream.
+func (c *HTTPClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	req.Stream = true
+	if req.SessionParams == nil {
+		req.Rid = nil
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	resp, err := c.post(streamCtx, "/chat/completions", req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &httpStream{body: resp.Body, reader: bufio.NewReader(resp.Body), ctx: streamCtx, cancel: cancel, strict: c.strict}, nil
+}
+
+// post sends req as JSON to path under the base URL and returns the response
+// if its status is 2xx
+func (c *HTTPClient) post(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	return c.postURL(ctx, c.config.BaseURL+path, req)
+}
+
+// postURL is post for any URL
+func (c *HTTPClient) postURL(ctx context.Context, url string, req interface{}) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		httpReq.Header.Set("X-Request-ID", id)
+	}
+	for name, value := range c.config.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &classifiedError{kind: ErrNoHealthyWorkers, err: fmt.Errorf("request failed: %w", err)}
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, readHTTPError(resp)
+	}
+	return resp, nil
+}
+
+// readHTTPError builds the error of a failed response from its OpenAI error
+// body, if it has one
+func readHTTPError(resp *http.Response) error {
+	httpErr := &HTTPError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var errBody struct {
+		Error struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error.Message != "" {
+		httpErr.Message = errBody.Error.Message
+		httpErr.Type = errBody.Error.Type
+		if errBody.Error.Code != nil {
+			httpErr.Code = fmt.Sprint(errBody.Error.Code)
+		}
+	} else if text := strings.TrimSpace(string(body)); text != "" {
+		httpErr.Message = text
+	}
+	return httpErr
+}
+
+// httpStream reads chunks from server-sent events
+type httpStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+	strict *strictDecoder
+}
+
+func (s *httpStream) RecvJSON() (string, error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return "", s.ctx.Err()
+			}
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return "", io.ErrUnexpectedEOF
+			}
+			if err != io.EOF {
+				return "", err
+			}
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "data:")
+		if !ok {
+			// Blank lines, comments, and other fields carry no chunks
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return "", io.EOF
+		}
+		if strings.HasPrefix(data, `{"error"`) {
+			var event struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &event) == nil && event.Error.Message != "" {
+				return "", errors.New(event.Error.Message)
+			}
+		}
+		return data, s.strict.check([]byte(data), ChatCompletionStreamResponse{})
+	}
+}
+
+// Close ends the stream and cancels the request.
+func (s *httpStream) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
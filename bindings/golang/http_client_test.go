@@ -0,0 +1,131 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHTTPClient tests non-streaming requests, headers, and error mapping
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" || r.Header.Get("X-Request-ID") != "req-1" {
+			t.Errorf("request = %s %v", r.URL.Path, r.Header)
+		}
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		if _, ok := req["rid"]; ok {
+			t.Error("rid was sent")
+		}
+		if req["model"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"model not found","type":"invalid_request_error","code":"model_not_found"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","model":"gpt","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL + "/v1/", APIKey: "key"})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error: %v", err)
+	}
+	ctx := WithRequestID(context.Background(), "req-1")
+	rid := "rid"
+	resp, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "gpt", Rid: &rid})
+	if err != nil || resp.Choices[0].Message.Content != "hi" {
+		t.Fatalf("CreateChatCompletion() = %+v, %v", resp, err)
+	}
+
+	_, err = client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "missing"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != "model_not_found" || !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("CreateChatCompletion() error = %v, want a 404 HTTPError matching ErrInvalidRequest", err)
+	}
+}
+
+// TestHTTPClientStream tests reading chunks from server-sent events
+func TestHTTPClientStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\r\n\r\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL})
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "gpt"})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	defer stream.Close()
+
+	var content string
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RecvJSON() error: %v", err)
+		}
+		var chunk ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", chunkJSON, err)
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Hello" {
+		t.Errorf("content = %q, want %q", content, "Hello")
+	}
+}
+
+// TestHTTPClientUnavailable tests that an unreachable API matches
+// ErrNoHealthyWorkers
+func TestHTTPClientUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL})
+	if _, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{}); !errors.Is(err, ErrNoHealthyWorkers) {
+		t.Errorf("503 error = %v, want ErrNoHealthyWorkers", err)
+	}
+	server.Close()
+	if _, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{}); !errors.Is(err, ErrNoHealthyWorkers) {
+		t.Errorf("connection error = %v, want ErrNoHealthyWorkers", err)
+	}
+}
+
+// TestHTTPClientCreateResponse tests Responses API requests
+func TestHTTPClientCreateResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		tools, _ := req["tools"].([]interface{})
+		if r.URL.Path != "/v1/responses" || len(tools) != 1 || tools[0].(map[string]interface{})["server_label"] != "docs" {
+			t.Errorf("request = %s %v", r.URL.Path, req)
+		}
+		fmt.Fprint(w, `{"id":"r1","status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hi"}]}],"usage":{"total_tokens":3}}`)
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL + "/v1"})
+	resp, err := client.CreateResponse(context.Background(), ResponseRequest{
+		Model: "m",
+		Input: []ResponseItem{UserInput("hello")},
+		Tools: []ResponseTool{MCPTool("docs", "http://mcp", "never")},
+	})
+	if err != nil {
+		t.Fatalf("CreateResponse() error: %v", err)
+	}
+	if resp.ID != "r1" || resp.OutputText() != "hi" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("CreateResponse() = %+v", resp)
+	}
+}
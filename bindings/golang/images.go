@@ -0,0 +1,126 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides image content in model output.
+package smg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ImageData decodes the image of an "image_url" part embedded as a data
+// URL, returning its MIME type and bytes. Images at http(s) URLs are not
+// fetched; ImageData returns an error for them.
+func (p ContentPart) ImageData() (string, []byte, error) {
+	if p.ImageURL == nil {
+		return "", nil, fmt.Errorf("content part of type %q has no image", p.Type)
+	}
+	return DecodeDataURL(p.ImageURL.URL)
+}
+
+// SaveImage writes the image of an "image_url" part embedded as a data URL
+// to path.
+func (p ContentPart) SaveImage(path string) error {
+	_, data, err := p.ImageData()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// DecodeDataURL decodes a base64 data URL, as built by ImageDataURL, into
+// its MIME type and bytes.
+func DecodeDataURL(url string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", nil, errors.New("not a data URL")
+	}
+	meta, encoded, ok := strings.Cut(rest, ",")
+	mimeType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 {
+		return "", nil, errors.New("not a base64 data URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode data URL: %w", err)
+	}
+	return mimeType, data, nil
+}
+
+// outputContent splits the content of a reply, a string or an array of
+// content parts, into its text and its image parts. Parts of other types
+// are dropped.
+func outputContent(raw json.RawMessage) (string, []ContentPart, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		err := json.Unmarshal(raw, &text)
+		return text, nil, err
+	}
+
+	var parts []ContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, err
+	}
+	var text strings.Builder
+	var images []ContentPart
+	for _, part := range parts {
+		switch {
+		case part.Type == "text" || part.Type == "output_text":
+			text.WriteString(part.Text)
+		case part.Type == "image_url" && part.ImageURL != nil:
+			images = append(images, part)
+		}
+	}
+	return text.String(), images, nil
+}
+
+type messageFields Message
+
+// UnmarshalJSON accepts content as a string or as an array of content
+// parts, whose text is joined into Content and whose images are added to
+// Images.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		messageFields
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	text, images, err := outputContent(raw.Content)
+	if err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	*m = Message(raw.messageFields)
+	m.Content = text
+	m.Images = append(m.Images, images...)
+	return nil
+}
+
+type messageDeltaFields MessageDelta
+
+// UnmarshalJSON accepts content as Message.UnmarshalJSON does.
+func (d *MessageDelta) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		messageDeltaFields
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	text, images, err := outputContent(raw.Content)
+	if err != nil {
+		return fmt.Errorf("invalid delta content: %w", err)
+	}
+	*d = MessageDelta(raw.messageDeltaFields)
+	d.Content = text
+	d.Images = append(d.Images, images...)
+	return nil
+}
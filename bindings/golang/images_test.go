@@ -0,0 +1,61 @@
+package smg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOutputImages tests image parts in replies and chunks, and saving them
+func TestOutputImages(t *testing.T) {
+	url := ImageDataURL("image/png", []byte("png"))
+	var msg Message
+	data := `{"role":"assistant","content":[{"type":"text","text":"Here "},{"type":"image_url","image_url":{"url":"` + url + `"}},{"type":"text","text":"it is"}]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if msg.Content != "Here it is" || len(msg.Images) != 1 || msg.Images[0].ImageURL.URL != url {
+		t.Errorf("message = %+v", msg)
+	}
+	if err := json.Unmarshal([]byte(`{"role":"assistant","content":"plain"}`), &msg); err != nil || msg.Content != "plain" || msg.Images != nil {
+		t.Errorf("string content = %+v, %v", msg, err)
+	}
+
+	stream := &fakeChatStream{chunks: []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Here"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":[{"type":"image_url","image_url":{"url":"` + url + `"}}]},"finish_reason":"stop"}]}`,
+	}}
+	resp, err := collectChatCompletion(stream)
+	if err != nil {
+		t.Fatalf("collectChatCompletion() error: %v", err)
+	}
+	images := resp.Choices[0].Message.Images
+	if resp.Choices[0].Message.Content != "Here" || len(images) != 1 {
+		t.Fatalf("message = %+v", resp.Choices[0].Message)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.png")
+	if err := images[0].SaveImage(path); err != nil {
+		t.Fatalf("SaveImage() error: %v", err)
+	}
+	if saved, _ := os.ReadFile(path); string(saved) != "png" {
+		t.Errorf("saved %q", saved)
+	}
+	if _, _, err := ImagePart("https://example.com/a.png").ImageData(); err == nil {
+		t.Error("ImageData() of an http URL succeeded")
+	}
+}
+
+// TestDecodeDataURL tests decoding data URLs and rejecting others
+func TestDecodeDataURL(t *testing.T) {
+	mimeType, data, err := DecodeDataURL(ImageDataURL("image/jpeg", []byte{1, 2}))
+	if err != nil || mimeType != "image/jpeg" || len(data) != 2 {
+		t.Errorf("DecodeDataURL() = %q, %v, %v", mimeType, data, err)
+	}
+	for _, url := range []string{"image.png", "data:text/plain,hi", "data:image/png;base64,!!"} {
+		if _, _, err := DecodeDataURL(url); err == nil {
+			t.Errorf("DecodeDataURL(%q) succeeded", url)
+		}
+	}
+}
@@ -22,6 +22,7 @@ typedef enum {
     SGL_ERROR_TOKENIZATION_ERROR = 2,
     SGL_ERROR_PARSING_ERROR = 3,
     SGL_ERROR_MEMORY_ERROR = 4,
+    SGL_ERROR_NO_HEALTHY_WORKERS = 5,
     SGL_ERROR_UNKNOWN = 99
 } SglErrorCode;
 
@@ -30,17 +31,20 @@ typedef void* SglangClientHandle;
 typedef void* SglangStreamHandle;
 
 // Client SDK functions
-SglangClientHandle* sgl_client_create(const char* endpoint, const char* tokenizer_path, char** error_out);
+SglangClientHandle* sgl_client_create(const char* endpoint, const char* tokenizer_path, const char* dialect, char** error_out);
 void sgl_client_free(SglangClientHandle* handle);
 SglErrorCode sgl_client_chat_completion_stream(SglangClientHandle* client_handle, const char* request_json, SglangStreamHandle** stream_handle_out, char** error_out);
 SglErrorCode sgl_stream_read_next(SglangStreamHandle* stream_handle, char** response_json_out, int* is_done_out, char** error_out);
+void sgl_stream_abort(SglangStreamHandle* handle);
 void sgl_stream_free(SglangStreamHandle* handle);
+char* sgl_stream_worker_endpoint(SglangStreamHandle* handle);
 void sgl_free_string(char* s);
 */
 import "C"
 
 import (
 	"fmt"
+	"sync"
 	"unsafe"
 )
 
@@ -61,6 +65,8 @@ const (
 	ErrorParsingError ErrorCode = 3
 	// ErrorMemoryError indicates a memory allocation error
 	ErrorMemoryError ErrorCode = 4
+	// ErrorNoHealthyWorkers indicates no worker was available to route the request to
+	ErrorNoHealthyWorkers ErrorCode = 5
 	// ErrorUnknown indicates an unclassified error
 	ErrorUnknown ErrorCode = 99
 )
@@ -78,6 +84,8 @@ func (e ErrorCode) Error() string {
 		return "parsing error"
 	case ErrorMemoryError:
 		return "memory error"
+	case ErrorNoHealthyWorkers:
+		return "no healthy workers"
 	case ErrorUnknown:
 		return "unknown error"
 	default:
@@ -85,6 +93,23 @@ func (e ErrorCode) Error() string {
 	}
 }
 
+// Error is returned by FFI functions that fail with an error message. It
+// unwraps to its ErrorCode, so callers can check the code with errors.Is.
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+// Error returns the message reported by the Rust function.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error code.
+func (e *Error) Unwrap() error {
+	return e.Code
+}
+
 // SglangClientHandle wraps the Rust client SDK FFI handle.
 //
 // This struct maintains a connection to the SMG gRPC server and is used
@@ -100,19 +125,23 @@ type SglangClientHandle struct {
 // Parameters:
 // - endpoint: gRPC endpoint URL (e.g., "grpc://localhost:20000")
 // - tokenizerPath: Path to tokenizer directory
+// - dialect: Engine protocol of the server ("sglang", "vllm", "trtllm"; "" for "sglang")
 //
 // Returns:
 // - *SglangClientHandle: A new client handle
 // - error: An error if client creation failed
-func NewClient(endpoint, tokenizerPath string) (*SglangClientHandle, error) {
+func NewClient(endpoint, tokenizerPath, dialect string) (*SglangClientHandle, error) {
 	cEndpoint := C.CString(endpoint)
 	defer C.free(unsafe.Pointer(cEndpoint))
 
 	cTokenizerPath := C.CString(tokenizerPath)
 	defer C.free(unsafe.Pointer(cTokenizerPath))
 
+	cDialect := optionalCString(dialect)
+	defer C.free(unsafe.Pointer(cDialect))
+
 	var errorPtr *C.char
-	handle := C.sgl_client_create(cEndpoint, cTokenizerPath, &errorPtr)
+	handle := C.sgl_client_create(cEndpoint, cTokenizerPath, cDialect, &errorPtr)
 
 	if handle == nil {
 		errorMsg := ""
@@ -178,11 +207,21 @@ func (h *SglangClientHandle) ChatCompletionStream(requestJSON string) (*SglangSt
 // SglangStreamHandle wraps the Rust stream FFI handle
 type SglangStreamHandle struct {
 	handle *C.SglangStreamHandle
+	// readMu serializes ReadNext: the Rust side receives a response and
+	// then converts it under separate locks, so concurrent reads could
+	// convert chunks out of order. Free takes it too, as the handle must
+	// not be freed under a read.
+	readMu sync.Mutex
+	// mu guards handle against Abort racing Free
+	mu sync.Mutex
 }
 
-// ReadNext reads the next chunk from the stream
+// ReadNext reads the next chunk from the stream. Chunks are returned in
+// generation order; concurrent calls are serialized.
 // Returns: (responseJSON, isDone, error)
 func (h *SglangStreamHandle) ReadNext() (string, bool, error) {
+	h.readMu.Lock()
+	defer h.readMu.Unlock()
 	if h.handle == nil {
 		return "", true, fmt.Errorf("stream handle is nil")
 	}
@@ -219,8 +258,39 @@ func (h *SglangStreamHandle) ReadNext() (string, bool, error) {
 	return responseStr, isDone == 1, nil
 }
 
-// Free releases the stream handle
+// WorkerEndpoint returns the endpoint of the worker serving the stream, or ""
+// for single-client streams
+func (h *SglangStreamHandle) WorkerEndpoint() string {
+	if h.handle == nil {
+		return ""
+	}
+	endpoint := C.sgl_stream_worker_endpoint(h.handle)
+	if endpoint == nil {
+		return ""
+	}
+	defer C.sgl_free_string(endpoint)
+	return C.GoString(endpoint)
+}
+
+// Abort ends a ReadNext in progress, which then returns an error, as do
+// later calls. Unlike Free, it may be called during a read; the handle must
+// still be freed.
+func (h *SglangStreamHandle) Abort() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handle != nil {
+		C.sgl_stream_abort(h.handle)
+	}
+}
+
+// Free releases the stream handle. It waits for a ReadNext in progress to
+// return, so a read blocked on the backend must be ended with Abort first.
+// Calling Free more than once is safe.
 func (h *SglangStreamHandle) Free() {
+	h.readMu.Lock()
+	defer h.readMu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	if h.handle != nil {
 		C.sgl_stream_free(h.handle)
 		h.handle = nil
@@ -16,6 +16,7 @@ typedef enum {
     SGL_ERROR_TOKENIZATION_ERROR = 2,
     SGL_ERROR_PARSING_ERROR = 3,
     SGL_ERROR_MEMORY_ERROR = 4,
+    SGL_ERROR_NO_HEALTHY_WORKERS = 5,
     SGL_ERROR_UNKNOWN = 99
 } SglErrorCode;
 
@@ -24,14 +25,24 @@ typedef void* MultiWorkerClientHandle;
 typedef void* SglangStreamHandle;
 
 // Multi-worker client functions
-MultiWorkerClientHandle* sgl_multi_client_create(const char* endpoints, const char* tokenizer_path, const char* policy_name, char** error_out);
+MultiWorkerClientHandle* sgl_multi_client_create(const char* endpoints, const char* tokenizer_path, const char* model_tokenizers_json, const char* client_metadata_json, const char* policy_name, const char* dialect, char** error_out);
 void sgl_multi_client_free(MultiWorkerClientHandle* handle);
 size_t sgl_multi_client_worker_count(MultiWorkerClientHandle* handle);
 size_t sgl_multi_client_healthy_count(MultiWorkerClientHandle* handle);
 SglErrorCode sgl_multi_client_set_worker_health(MultiWorkerClientHandle* handle, size_t worker_index, bool healthy);
+SglErrorCode sgl_multi_client_set_worker_health_by_endpoint(MultiWorkerClientHandle* handle, const char* endpoint, bool healthy, char** error_out);
+SglErrorCode sgl_multi_client_add_worker(MultiWorkerClientHandle* handle, const char* endpoint, char** error_out);
+SglErrorCode sgl_multi_client_remove_worker(MultiWorkerClientHandle* handle, size_t worker_index, char** error_out);
+SglErrorCode sgl_multi_client_remove_worker_by_endpoint(MultiWorkerClientHandle* handle, const char* endpoint, char** error_out);
+SglErrorCode sgl_multi_client_workers(MultiWorkerClientHandle* handle, char** result_out, char** error_out);
 char* sgl_multi_client_policy_name(MultiWorkerClientHandle* handle);
 char* sgl_multi_client_tokenizer_path(MultiWorkerClientHandle* handle);
-SglErrorCode sgl_multi_client_chat_completion_stream(MultiWorkerClientHandle* client_handle, const char* request_json, SglangStreamHandle** stream_handle_out, char** error_out);
+SglErrorCode sgl_multi_client_model_info(MultiWorkerClientHandle* handle, uint64_t timeout_ms, char** result_out, char** error_out);
+SglErrorCode sgl_multi_client_embed(MultiWorkerClientHandle* handle, const char* model, const char* inputs_json, const char* caller_request_id, uint64_t timeout_ms, char** result_out, char** error_out);
+SglErrorCode sgl_multi_client_chat_completion_stream(MultiWorkerClientHandle* client_handle, const char* request_json, const char* caller_request_id, SglangStreamHandle** stream_handle_out, char** error_out);
+SglErrorCode sgl_multi_client_completion_stream(MultiWorkerClientHandle* client_handle, const char* request_json, const char* caller_request_id, SglangStreamHandle** stream_handle_out, char** error_out);
+SglErrorCode sgl_multi_client_chat_completion_stream_bytes(MultiWorkerClientHandle* client_handle, const uint8_t* request_json, size_t request_json_len, const char* caller_request_id, SglangStreamHandle** stream_handle_out, char** error_out);
+SglErrorCode sgl_multi_client_completion_stream_bytes(MultiWorkerClientHandle* client_handle, const uint8_t* request_json, size_t request_json_len, const char* caller_request_id, SglangStreamHandle** stream_handle_out, char** error_out);
 
 // Stream and memory functions (already declared in client.go, but needed for this file)
 SglErrorCode sgl_stream_read_next(SglangStreamHandle* stream_handle, char** response_json_out, int* is_done_out, char** error_out);
@@ -41,6 +52,7 @@ void sgl_free_string(char* s);
 import "C"
 
 import (
+	"encoding/json"
 	"fmt"
 	"unsafe"
 )
@@ -58,23 +70,49 @@ type MultiWorkerClientHandle struct {
 // Parameters:
 // - endpoints: Comma-separated list of gRPC endpoints (e.g., "grpc://host1:20000,grpc://host2:20001")
 // - tokenizerPath: Path to tokenizer directory
+// - modelTokenizers: Optional map of model name to tokenizer path (nil for none)
+// - clientMetadata: Optional gRPC metadata sent with every request (nil for none)
 // - policyName: Load balancing policy name ("round_robin", "random", "cache_aware")
+// - dialect: Engine protocol of the workers ("sglang", "vllm", "trtllm"; "" for "sglang")
 //
 // Returns:
 // - *MultiWorkerClientHandle: A new multi-worker client handle
 // - error: An error if client creation failed
-func NewMultiWorkerClient(endpoints, tokenizerPath, policyName string) (*MultiWorkerClientHandle, error) {
+func NewMultiWorkerClient(endpoints, tokenizerPath string, modelTokenizers, clientMetadata map[string]string, policyName, dialect string) (*MultiWorkerClientHandle, error) {
 	cEndpoints := C.CString(endpoints)
 	defer C.free(unsafe.Pointer(cEndpoints))
 
 	cTokenizerPath := C.CString(tokenizerPath)
 	defer C.free(unsafe.Pointer(cTokenizerPath))
 
+	var cModelTokenizers *C.char
+	if len(modelTokenizers) > 0 {
+		modelTokenizersJSON, err := json.Marshal(modelTokenizers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal model tokenizers: %w", err)
+		}
+		cModelTokenizers = C.CString(string(modelTokenizersJSON))
+		defer C.free(unsafe.Pointer(cModelTokenizers))
+	}
+
+	var cClientMetadata *C.char
+	if len(clientMetadata) > 0 {
+		clientMetadataJSON, err := json.Marshal(clientMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal client metadata: %w", err)
+		}
+		cClientMetadata = C.CString(string(clientMetadataJSON))
+		defer C.free(unsafe.Pointer(cClientMetadata))
+	}
+
 	cPolicyName := C.CString(policyName)
 	defer C.free(unsafe.Pointer(cPolicyName))
 
+	cDialect := optionalCString(dialect)
+	defer C.free(unsafe.Pointer(cDialect))
+
 	var errorPtr *C.char
-	handle := C.sgl_multi_client_create(cEndpoints, cTokenizerPath, cPolicyName, &errorPtr)
+	handle := C.sgl_multi_client_create(cEndpoints, cTokenizerPath, cModelTokenizers, cClientMetadata, cPolicyName, cDialect, &errorPtr)
 
 	if handle == nil {
 		errorMsg := ""
@@ -127,6 +165,92 @@ func (h *MultiWorkerClientHandle) SetWorkerHealth(workerIndex int, healthy bool)
 	return nil
 }
 
+// SetWorkerHealthByEndpoint marks the worker with endpoint as healthy or
+// unhealthy, looking it up under the pool lock
+func (h *MultiWorkerClientHandle) SetWorkerHealthByEndpoint(endpoint string, healthy bool) error {
+	if h.handle == nil {
+		return fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	cEndpoint := C.CString(endpoint)
+	defer C.free(unsafe.Pointer(cEndpoint))
+
+	var errorPtr *C.char
+	result := C.sgl_multi_client_set_worker_health_by_endpoint(h.handle, cEndpoint, C.bool(healthy), &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return callError(result, errorPtr)
+	}
+	return nil
+}
+
+// AddWorker connects to endpoint and appends it to the worker pool
+func (h *MultiWorkerClientHandle) AddWorker(endpoint string) error {
+	if h.handle == nil {
+		return fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	cEndpoint := C.CString(endpoint)
+	defer C.free(unsafe.Pointer(cEndpoint))
+
+	var errorPtr *C.char
+	result := C.sgl_multi_client_add_worker(h.handle, cEndpoint, &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return callError(result, errorPtr)
+	}
+	return nil
+}
+
+// RemoveWorker removes a worker from the pool by index
+func (h *MultiWorkerClientHandle) RemoveWorker(workerIndex int) error {
+	if h.handle == nil {
+		return fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	var errorPtr *C.char
+	result := C.sgl_multi_client_remove_worker(h.handle, C.size_t(workerIndex), &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return callError(result, errorPtr)
+	}
+	return nil
+}
+
+// RemoveWorkerByEndpoint removes the worker with endpoint from the pool,
+// looking it up under the pool lock
+func (h *MultiWorkerClientHandle) RemoveWorkerByEndpoint(endpoint string) error {
+	if h.handle == nil {
+		return fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	cEndpoint := C.CString(endpoint)
+	defer C.free(unsafe.Pointer(cEndpoint))
+
+	var errorPtr *C.char
+	result := C.sgl_multi_client_remove_worker_by_endpoint(h.handle, cEndpoint, &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return callError(result, errorPtr)
+	}
+	return nil
+}
+
+// WorkersJSON returns a JSON array with one {"endpoint", "healthy", "load",
+// "processed_requests"} entry per worker, in worker order
+func (h *MultiWorkerClientHandle) WorkersJSON() (string, error) {
+	if h.handle == nil {
+		return "", fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	var resultPtr *C.char
+	var errorPtr *C.char
+
+	result := C.sgl_multi_client_workers(h.handle, &resultPtr, &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return "", callError(result, errorPtr)
+	}
+
+	defer C.sgl_free_string(resultPtr)
+	return C.GoString(resultPtr), nil
+}
+
 // PolicyName returns the name of the load balancing policy
 func (h *MultiWorkerClientHandle) PolicyName() string {
 	if h.handle == nil {
@@ -153,14 +277,65 @@ func (h *MultiWorkerClientHandle) TokenizerPath() string {
 	return C.GoString(cPath)
 }
 
-// ChatCompletionStream creates a streaming chat completion request with load balancing
-func (h *MultiWorkerClientHandle) ChatCompletionStream(requestJSON string) (*SglangStreamHandle, error) {
+// ModelInfoJSON queries every worker for its model information and returns a
+// JSON array with one {"endpoint", "info"|"error"} entry per worker.
+// timeoutMS bounds each worker query; 0 uses the default.
+func (h *MultiWorkerClientHandle) ModelInfoJSON(timeoutMS uint64) (string, error) {
+	if h.handle == nil {
+		return "", fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	var resultPtr *C.char
+	var errorPtr *C.char
+
+	result := C.sgl_multi_client_model_info(h.handle, C.uint64_t(timeoutMS), &resultPtr, &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return "", callError(result, errorPtr)
+	}
+
+	defer C.sgl_free_string(resultPtr)
+	return C.GoString(resultPtr), nil
+}
+
+// EmbedJSON computes embeddings for inputs (a JSON array of strings) and
+// returns a JSON array with one {"embedding", "prompt_tokens"} entry per input.
+// A non-empty requestID is sent to the workers as x-request-id metadata.
+// timeoutMS bounds each input's request; 0 uses the default.
+func (h *MultiWorkerClientHandle) EmbedJSON(model, inputsJSON, requestID string, timeoutMS uint64) (string, error) {
+	if h.handle == nil {
+		return "", fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	cModel := C.CString(model)
+	defer C.free(unsafe.Pointer(cModel))
+	cInputs := C.CString(inputsJSON)
+	defer C.free(unsafe.Pointer(cInputs))
+	cRequestID := optionalCString(requestID)
+	defer C.free(unsafe.Pointer(cRequestID))
+
+	var resultPtr *C.char
+	var errorPtr *C.char
+
+	result := C.sgl_multi_client_embed(h.handle, cModel, cInputs, cRequestID, C.uint64_t(timeoutMS), &resultPtr, &errorPtr)
+	if ErrorCode(result) != ErrorSuccess {
+		return "", callError(result, errorPtr)
+	}
+
+	defer C.sgl_free_string(resultPtr)
+	return C.GoString(resultPtr), nil
+}
+
+// ChatCompletionStream creates a streaming chat completion request with load
+// balancing. A non-empty requestID is sent to the worker as x-request-id metadata.
+func (h *MultiWorkerClientHandle) ChatCompletionStream(requestJSON, requestID string) (*SglangStreamHandle, error) {
 	if h.handle == nil {
 		return nil, fmt.Errorf("multi-worker client handle is nil")
 	}
 
 	cRequestJSON := C.CString(requestJSON)
 	defer C.free(unsafe.Pointer(cRequestJSON))
+	cRequestID := optionalCString(requestID)
+	defer C.free(unsafe.Pointer(cRequestID))
 
 	var streamHandle *C.SglangStreamHandle
 	var errorPtr *C.char
@@ -168,20 +343,13 @@ func (h *MultiWorkerClientHandle) ChatCompletionStream(requestJSON string) (*Sgl
 	result := C.sgl_multi_client_chat_completion_stream(
 		h.handle,
 		cRequestJSON,
+		cRequestID,
 		&streamHandle,
 		&errorPtr,
 	)
 
 	if ErrorCode(result) != ErrorSuccess {
-		errorMsg := ""
-		if errorPtr != nil {
-			errorMsg = C.GoString(errorPtr)
-			C.sgl_free_string(errorPtr)
-		}
-		if errorMsg == "" {
-			errorMsg = fmt.Sprintf("error code %d", result)
-		}
-		return nil, fmt.Errorf("%s", errorMsg)
+		return nil, callError(result, errorPtr)
 	}
 
 	if streamHandle == nil {
@@ -190,3 +358,135 @@ func (h *MultiWorkerClientHandle) ChatCompletionStream(requestJSON string) (*Sgl
 
 	return &SglangStreamHandle{handle: streamHandle}, nil
 }
+
+// CompletionStream creates a streaming legacy completion request with load
+// balancing. The stream yields chat completion chunks. A non-empty requestID
+// is sent to the worker as x-request-id metadata.
+func (h *MultiWorkerClientHandle) CompletionStream(requestJSON, requestID string) (*SglangStreamHandle, error) {
+	if h.handle == nil {
+		return nil, fmt.Errorf("multi-worker client handle is nil")
+	}
+
+	cRequestJSON := C.CString(requestJSON)
+	defer C.free(unsafe.Pointer(cRequestJSON))
+	cRequestID := optionalCString(requestID)
+	defer C.free(unsafe.Pointer(cRequestID))
+
+	var streamHandle *C.SglangStreamHandle
+	var errorPtr *C.char
+
+	result := C.sgl_multi_client_completion_stream(
+		h.handle,
+		cRequestJSON,
+		cRequestID,
+		&streamHandle,
+		&errorPtr,
+	)
+
+	if ErrorCode(result) != ErrorSuccess {
+		return nil, callError(result, errorPtr)
+	}
+
+	if streamHandle == nil {
+		return nil, fmt.Errorf("stream handle is nil")
+	}
+
+	return &SglangStreamHandle{handle: streamHandle}, nil
+}
+
+// ChatCompletionStreamBytes is ChatCompletionStream for request JSON the
+// Rust layer reads in place, without a C string copy, which matters for very
+// large prompts.
+func (h *MultiWorkerClientHandle) ChatCompletionStreamBytes(requestJSON []byte, requestID string) (*SglangStreamHandle, error) {
+	if h.handle == nil {
+		return nil, fmt.Errorf("multi-worker client handle is nil")
+	}
+	if len(requestJSON) == 0 {
+		return nil, fmt.Errorf("empty request JSON")
+	}
+
+	cRequestID := optionalCString(requestID)
+	defer C.free(unsafe.Pointer(cRequestID))
+
+	var streamHandle *C.SglangStreamHandle
+	var errorPtr *C.char
+
+	// The Rust side reads the buffer only during the call
+	result := C.sgl_multi_client_chat_completion_stream_bytes(
+		h.handle,
+		(*C.uint8_t)(unsafe.Pointer(&requestJSON[0])),
+		C.size_t(len(requestJSON)),
+		cRequestID,
+		&streamHandle,
+		&errorPtr,
+	)
+
+	if ErrorCode(result) != ErrorSuccess {
+		return nil, callError(result, errorPtr)
+	}
+
+	if streamHandle == nil {
+		return nil, fmt.Errorf("stream handle is nil")
+	}
+
+	return &SglangStreamHandle{handle: streamHandle}, nil
+}
+
+// CompletionStreamBytes is CompletionStream for request JSON the Rust layer
+// reads in place, without a C string copy.
+func (h *MultiWorkerClientHandle) CompletionStreamBytes(requestJSON []byte, requestID string) (*SglangStreamHandle, error) {
+	if h.handle == nil {
+		return nil, fmt.Errorf("multi-worker client handle is nil")
+	}
+	if len(requestJSON) == 0 {
+		return nil, fmt.Errorf("empty request JSON")
+	}
+
+	cRequestID := optionalCString(requestID)
+	defer C.free(unsafe.Pointer(cRequestID))
+
+	var streamHandle *C.SglangStreamHandle
+	var errorPtr *C.char
+
+	result := C.sgl_multi_client_completion_stream_bytes(
+		h.handle,
+		(*C.uint8_t)(unsafe.Pointer(&requestJSON[0])),
+		C.size_t(len(requestJSON)),
+		cRequestID,
+		&streamHandle,
+		&errorPtr,
+	)
+
+	if ErrorCode(result) != ErrorSuccess {
+		return nil, callError(result, errorPtr)
+	}
+
+	if streamHandle == nil {
+		return nil, fmt.Errorf("stream handle is nil")
+	}
+
+	return &SglangStreamHandle{handle: streamHandle}, nil
+}
+
+// optionalCString converts s to a C string, or returns nil if s is empty.
+// C.free accepts nil.
+func optionalCString(s string) *C.char {
+	if s == "" {
+		return nil
+	}
+	return C.CString(s)
+}
+
+// callError builds the error for a failed FFI call from its result code and
+// error message, freeing the message
+func callError(result C.SglErrorCode, errorPtr *C.char) error {
+	errorMsg := ""
+	if errorPtr != nil {
+		errorMsg = C.GoString(errorPtr)
+		C.sgl_free_string(errorPtr)
+	}
+	if errorMsg == "" {
+		errorMsg = fmt.Sprintf("error code %d", result)
+	}
+	return &Error{Code: ErrorCode(result), Message: errorMsg}
+}
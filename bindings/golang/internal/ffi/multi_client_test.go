@@ -0,0 +1,66 @@
+package ffi
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestStreamBytesInvalid tests the arguments rejected before calling into
+// Rust
+func TestStreamBytesInvalid(t *testing.T) {
+	var h MultiWorkerClientHandle
+	requestJSON := []byte(`{"model":"m","messages":[]}`)
+	if _, err := h.ChatCompletionStreamBytes(requestJSON, ""); err == nil {
+		t.Error("ChatCompletionStreamBytes on a freed client succeeded")
+	}
+	if _, err := h.CompletionStreamBytes(requestJSON, ""); err == nil {
+		t.Error("CompletionStreamBytes on a freed client succeeded")
+	}
+}
+
+// TestChatCompletionStreamBytes tests that request JSON passed by pointer
+// and length reaches the Rust request parser intact. It needs a worker at
+// SGL_GRPC_ENDPOINT (default grpc://localhost:20000) and SGL_TOKENIZER_PATH.
+func TestChatCompletionStreamBytes(t *testing.T) {
+	tokenizerPath := os.Getenv("SGL_TOKENIZER_PATH")
+	if tokenizerPath == "" {
+		t.Skip("SGL_TOKENIZER_PATH not set")
+	}
+	endpoint := os.Getenv("SGL_GRPC_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "grpc://localhost:20000"
+	}
+	// Only model "m" has a tokenizer, so requests for other models fail
+	// once parsed, before anything is sent to the worker
+	h, err := NewMultiWorkerClient(endpoint, "", map[string]string{"m": tokenizerPath}, nil, "round_robin", "")
+	if err != nil {
+		t.Skipf("Skipping: server not available: %v", err)
+	}
+	defer h.Free()
+
+	if _, err := h.ChatCompletionStreamBytes([]byte{'{', 0xff, '}'}, ""); err == nil || !strings.Contains(err.Error(), "UTF-8") {
+		t.Errorf("ChatCompletionStreamBytes of invalid UTF-8 = %v, want a UTF-8 error", err)
+	}
+	if _, err := h.ChatCompletionStreamBytes([]byte("not json"), ""); err == nil || !strings.Contains(err.Error(), "parse") {
+		t.Errorf("ChatCompletionStreamBytes of invalid JSON = %v, want a parse error", err)
+	}
+	if _, err := h.ChatCompletionStreamBytes(nil, ""); err == nil {
+		t.Error("ChatCompletionStreamBytes of no JSON succeeded")
+	}
+
+	// Rust reads exactly len bytes: the request is neither NUL-terminated
+	// nor the whole buffer
+	requestJSON := `{"model":"other","messages":[{"role":"user","content":"Hi"}]}`
+	buffer := []byte(requestJSON + "trailing bytes")
+	_, err = h.ChatCompletionStreamBytes(buffer[:len(requestJSON)], "")
+	if err == nil || !strings.Contains(err.Error(), "No tokenizer configured for model 'other'") {
+		t.Errorf("ChatCompletionStreamBytes = %v, want the request parsed", err)
+	}
+
+	requestJSON = `{"model":"other","prompt":"Hi"}`
+	buffer = []byte(requestJSON + "trailing bytes")
+	if _, err := h.CompletionStreamBytes(buffer[:len(requestJSON)], ""); err == nil || !strings.Contains(err.Error(), "No tokenizer configured for model 'other'") {
+		t.Errorf("CompletionStreamBytes = %v, want the request parsed", err)
+	}
+}
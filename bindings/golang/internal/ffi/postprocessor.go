@@ -13,6 +13,7 @@ typedef enum {
     SGL_ERROR_TOKENIZATION_ERROR = 2,
     SGL_ERROR_PARSING_ERROR = 3,
     SGL_ERROR_MEMORY_ERROR = 4,
+    SGL_ERROR_NO_HEALTHY_WORKERS = 5,
     SGL_ERROR_UNKNOWN = 99
 } SglErrorCode;
 
@@ -13,6 +13,7 @@ typedef enum {
     SGL_ERROR_TOKENIZATION_ERROR = 2,
     SGL_ERROR_PARSING_ERROR = 3,
     SGL_ERROR_MEMORY_ERROR = 4,
+    SGL_ERROR_NO_HEALTHY_WORKERS = 5,
     SGL_ERROR_UNKNOWN = 99
 } SglErrorCode;
 
@@ -49,6 +50,21 @@ SglErrorCode sgl_chat_requires_reasoning_with_tokenizer(
     char** error_out
 );
 
+// Variant taking the request JSON by pointer and length, which also
+// determines require_reasoning
+SglErrorCode sgl_preprocess_chat_request_with_tokenizer_bytes(
+    const uint8_t* request_json,
+    size_t request_json_len,
+    void* tokenizer_handle,
+    char** prompt_text_out,
+    uint32_t** token_ids_out,
+    size_t* token_ids_len_out,
+    char** tool_constraints_json_out,
+    int32_t* prompt_tokens_out,
+    int32_t* require_reasoning_out,
+    char** error_out
+);
+
 void sgl_preprocessed_request_free(
     char* prompt_text,
     uint32_t* token_ids,
@@ -119,7 +135,7 @@ func PreprocessChatRequest(requestJSON, tokenizerPath string) (*PreprocessedRequ
 			errorMsg = C.GoString(errorOut)
 			C.sgl_free_string(errorOut)
 		}
-		return nil, fmt.Errorf("preprocessing failed: %s", errorMsg)
+		return nil, &Error{Code: ErrorCode(errorCode), Message: "preprocessing failed: " + errorMsg}
 	}
 
 	result := &PreprocessedRequest{
@@ -166,58 +182,102 @@ func PreprocessChatRequestWithTokenizer(requestJSON string, tokenizerHandle *Tok
 		return nil, fmt.Errorf("invalid tokenizer handle")
 	}
 
-	var promptTextOut *C.char
-	var tokenIDsOut *C.uint32_t
-	var tokenIDsLenOut C.size_t
-	var toolConstraintsJSONOut *C.char
-	var promptTokensOut C.int32_t
-	var errorOut *C.char
-
+	var out preprocessOutputs
 	errorCode := C.sgl_preprocess_chat_request_with_tokenizer(
 		requestJSONC,
 		unsafe.Pointer(tokenizerHandle.handle), // Convert *C.TokenizerHandle to void*
-		&promptTextOut,
-		&tokenIDsOut,
-		&tokenIDsLenOut,
-		&toolConstraintsJSONOut,
-		&promptTokensOut,
-		&errorOut,
+		&out.promptText,
+		&out.tokenIDs,
+		&out.tokenIDsLen,
+		&out.toolConstraintsJSON,
+		&out.promptTokens,
+		&out.err,
 	)
+	return out.result(errorCode)
+}
 
+// PreprocessChatRequestBytes is PreprocessChatRequestWithTokenizer for
+// request JSON the Rust layer reads in place, without a C string copy, which
+// matters for very large prompts. It also returns what
+// ChatRequiresReasoningWithTokenizer would, from the same parse of the
+// request.
+func PreprocessChatRequestBytes(requestJSON []byte, tokenizerHandle *TokenizerHandle) (*PreprocessedRequest, bool, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return nil, false, fmt.Errorf("invalid tokenizer handle")
+	}
+	if len(requestJSON) == 0 {
+		return nil, false, fmt.Errorf("empty request JSON")
+	}
+
+	var out preprocessOutputs
+	var requireReasoningOut C.int32_t
+	// The Rust side reads requestJSON only during the call
+	errorCode := C.sgl_preprocess_chat_request_with_tokenizer_bytes(
+		(*C.uint8_t)(unsafe.Pointer(&requestJSON[0])),
+		C.size_t(len(requestJSON)),
+		unsafe.Pointer(tokenizerHandle.handle),
+		&out.promptText,
+		&out.tokenIDs,
+		&out.tokenIDsLen,
+		&out.toolConstraintsJSON,
+		&out.promptTokens,
+		&requireReasoningOut,
+		&out.err,
+	)
+	result, err := out.result(errorCode)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, requireReasoningOut != 0, nil
+}
+
+// preprocessOutputs receives the outputs of the preprocessing functions
+type preprocessOutputs struct {
+	promptText          *C.char
+	tokenIDs            *C.uint32_t
+	tokenIDsLen         C.size_t
+	toolConstraintsJSON *C.char
+	promptTokens        C.int32_t
+	err                 *C.char
+}
+
+// result converts the outputs of a preprocessing call that returned
+// errorCode, taking ownership of the Rust allocations
+func (o *preprocessOutputs) result(errorCode C.SglErrorCode) (*PreprocessedRequest, error) {
 	if errorCode != C.SGL_ERROR_SUCCESS {
 		errorMsg := ""
-		if errorOut != nil {
-			errorMsg = C.GoString(errorOut)
-			C.sgl_free_string(errorOut)
+		if o.err != nil {
+			errorMsg = C.GoString(o.err)
+			C.sgl_free_string(o.err)
 		}
-		return nil, fmt.Errorf("preprocessing failed: %s", errorMsg)
+		return nil, &Error{Code: ErrorCode(errorCode), Message: "preprocessing failed: " + errorMsg}
 	}
 
 	result := &PreprocessedRequest{
-		PromptText:          C.GoString(promptTextOut),
-		TokenIDs:            make([]uint32, tokenIDsLenOut),
+		PromptText:          C.GoString(o.promptText),
+		TokenIDs:            make([]uint32, o.tokenIDsLen),
 		ToolConstraintsJSON: "",
-		PromptTokens:        int32(promptTokensOut),
+		PromptTokens:        int32(o.promptTokens),
 	}
 
 	// Copy token IDs
-	if tokenIDsOut != nil && tokenIDsLenOut > 0 {
-		tokenIDsSlice := (*[1 << 30]C.uint32_t)(unsafe.Pointer(tokenIDsOut))[:tokenIDsLenOut:tokenIDsLenOut]
+	if o.tokenIDs != nil && o.tokenIDsLen > 0 {
+		tokenIDsSlice := (*[1 << 30]C.uint32_t)(unsafe.Pointer(o.tokenIDs))[:o.tokenIDsLen:o.tokenIDsLen]
 		for i := range result.TokenIDs {
 			result.TokenIDs[i] = uint32(tokenIDsSlice[i])
 		}
 	}
 
 	// Copy tool constraints JSON if present
-	if toolConstraintsJSONOut != nil {
-		result.ToolConstraintsJSON = C.GoString(toolConstraintsJSONOut)
+	if o.toolConstraintsJSON != nil {
+		result.ToolConstraintsJSON = C.GoString(o.toolConstraintsJSON)
 	}
 
 	// Store pointers for later cleanup
-	result.promptTextPtr = promptTextOut
-	result.tokenIDsPtr = tokenIDsOut
-	result.tokenIDsLen = uintptr(tokenIDsLenOut)
-	result.toolConstraintsJSONPtr = toolConstraintsJSONOut
+	result.promptTextPtr = o.promptText
+	result.tokenIDsPtr = o.tokenIDs
+	result.tokenIDsLen = uintptr(o.tokenIDsLen)
+	result.toolConstraintsJSONPtr = o.toolConstraintsJSON
 
 	return result, nil
 }
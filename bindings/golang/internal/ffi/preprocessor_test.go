@@ -0,0 +1,80 @@
+package ffi
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTokenizer returns a handle to the tokenizer at SGL_TOKENIZER_PATH,
+// skipping the test when it is not set
+func testTokenizer(t *testing.T) *TokenizerHandle {
+	t.Helper()
+	tokenizerPath := os.Getenv("SGL_TOKENIZER_PATH")
+	if tokenizerPath == "" {
+		t.Skip("SGL_TOKENIZER_PATH not set")
+	}
+	handle, err := CreateTokenizerHandle(tokenizerPath)
+	if err != nil {
+		t.Fatalf("CreateTokenizerHandle failed: %v", err)
+	}
+	t.Cleanup(func() { FreeTokenizerHandle(handle) })
+	return handle
+}
+
+// TestPreprocessChatRequestBytesInvalid tests the arguments rejected before
+// calling into Rust
+func TestPreprocessChatRequestBytesInvalid(t *testing.T) {
+	requestJSON := []byte(`{"model":"m","messages":[]}`)
+	if _, _, err := PreprocessChatRequestBytes(requestJSON, nil); err == nil {
+		t.Error("PreprocessChatRequestBytes with a nil tokenizer succeeded")
+	}
+	if _, _, err := PreprocessChatRequestBytes(requestJSON, &TokenizerHandle{}); err == nil {
+		t.Error("PreprocessChatRequestBytes with a freed tokenizer succeeded")
+	}
+}
+
+// TestPreprocessChatRequestBytes tests that passing the request by pointer
+// and length preprocesses it as the C string functions do
+func TestPreprocessChatRequestBytes(t *testing.T) {
+	tokenizer := testTokenizer(t)
+
+	requestJSON := `{"model":"m","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hello, world"}]}`
+	want, err := PreprocessChatRequestWithTokenizer(requestJSON, tokenizer)
+	if err != nil {
+		t.Fatalf("PreprocessChatRequestWithTokenizer failed: %v", err)
+	}
+	defer want.Free()
+	wantReasoning, err := ChatRequiresReasoningWithTokenizer(requestJSON, tokenizer)
+	if err != nil {
+		t.Fatalf("ChatRequiresReasoningWithTokenizer failed: %v", err)
+	}
+
+	// Rust reads exactly len bytes: the request is neither NUL-terminated
+	// nor the whole buffer
+	buffer := []byte(requestJSON + "trailing bytes")
+	got, requireReasoning, err := PreprocessChatRequestBytes(buffer[:len(requestJSON)], tokenizer)
+	if err != nil {
+		t.Fatalf("PreprocessChatRequestBytes failed: %v", err)
+	}
+	defer got.Free()
+
+	if got.PromptText != want.PromptText || !reflect.DeepEqual(got.TokenIDs, want.TokenIDs) || got.PromptTokens != want.PromptTokens {
+		t.Errorf("PreprocessChatRequestBytes = %q (%d tokens), want %q (%d tokens)", got.PromptText, got.PromptTokens, want.PromptText, want.PromptTokens)
+	}
+	if requireReasoning != wantReasoning {
+		t.Errorf("require_reasoning = %v, want %v", requireReasoning, wantReasoning)
+	}
+
+	if _, _, err := PreprocessChatRequestBytes([]byte{'{', 0xff, '}'}, tokenizer); err == nil || !strings.Contains(err.Error(), "UTF-8") {
+		t.Errorf("PreprocessChatRequestBytes of invalid UTF-8 = %v, want a UTF-8 error", err)
+	}
+	if _, _, err := PreprocessChatRequestBytes([]byte("not json"), tokenizer); err == nil {
+		t.Error("PreprocessChatRequestBytes of invalid JSON succeeded")
+	}
+	// An empty slice has no first byte to pass a pointer to
+	if _, _, err := PreprocessChatRequestBytes(nil, tokenizer); err == nil {
+		t.Error("PreprocessChatRequestBytes of no JSON succeeded")
+	}
+}
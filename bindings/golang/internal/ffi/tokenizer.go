@@ -0,0 +1,300 @@
+// Package ffi provides Go bindings for SMG's Rust FFI (Foreign Function Interface).
+package ffi
+
+/*
+#cgo LDFLAGS: -lsmg_go -ldl
+#include <stdlib.h>
+#include <stdint.h>
+
+// Error codes (must match client.go)
+typedef enum {
+    SGL_ERROR_SUCCESS = 0,
+    SGL_ERROR_INVALID_ARGUMENT = 1,
+    SGL_ERROR_TOKENIZATION_ERROR = 2,
+    SGL_ERROR_PARSING_ERROR = 3,
+    SGL_ERROR_MEMORY_ERROR = 4,
+    SGL_ERROR_NO_HEALTHY_WORKERS = 5,
+    SGL_ERROR_UNKNOWN = 99
+} SglErrorCode;
+
+// Tokenizer functions
+SglErrorCode sgl_tokenizer_encode(
+    void* tokenizer_handle,
+    const char* text,
+    int add_special_tokens,
+    uint32_t** token_ids_out,
+    size_t* token_count_out,
+    char** error_out
+);
+
+SglErrorCode sgl_tokenizer_special_tokens(
+    void* tokenizer_handle,
+    char** result_out,
+    char** error_out
+);
+
+SglErrorCode sgl_tokenizer_token_to_id(
+    void* tokenizer_handle,
+    const char* token,
+    uint32_t* id_out,
+    int* found_out
+);
+
+char* sgl_tokenizer_id_to_token(void* tokenizer_handle, uint32_t id);
+
+// Incremental detokenizer functions
+typedef void* DetokenizerHandle;
+
+DetokenizerHandle* sgl_detokenizer_create(
+    void* tokenizer_handle,
+    const uint32_t* prompt_token_ids,
+    size_t prompt_token_count,
+    int skip_special_tokens,
+    char** error_out
+);
+
+SglErrorCode sgl_detokenizer_step(
+    DetokenizerHandle* handle,
+    const uint32_t* token_ids,
+    size_t token_count,
+    char** text_out,
+    char** error_out
+);
+
+SglErrorCode sgl_detokenizer_flush(
+    DetokenizerHandle* handle,
+    char** text_out,
+    char** error_out
+);
+
+void sgl_detokenizer_free(DetokenizerHandle* handle);
+
+// Memory management
+void sgl_free_string(char* s);
+void sgl_free_token_ids(uint32_t* ptr, size_t count);
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// TokenizerEncode tokenizes text without applying a chat template.
+func TokenizerEncode(tokenizerHandle *TokenizerHandle, text string, addSpecialTokens bool) ([]uint32, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return nil, fmt.Errorf("invalid tokenizer handle")
+	}
+
+	textC := C.CString(text)
+	defer C.free(unsafe.Pointer(textC))
+
+	addSpecialTokensC := C.int(0)
+	if addSpecialTokens {
+		addSpecialTokensC = C.int(1)
+	}
+
+	var tokenIDsOut *C.uint32_t
+	var tokenCountOut C.size_t
+	var errorOut *C.char
+
+	errorCode := C.sgl_tokenizer_encode(
+		unsafe.Pointer(tokenizerHandle.handle),
+		textC,
+		addSpecialTokensC,
+		&tokenIDsOut,
+		&tokenCountOut,
+		&errorOut,
+	)
+
+	if errorCode != C.SGL_ERROR_SUCCESS {
+		errorMsg := ""
+		if errorOut != nil {
+			errorMsg = C.GoString(errorOut)
+			C.sgl_free_string(errorOut)
+		}
+		return nil, fmt.Errorf("failed to encode text: %s", errorMsg)
+	}
+
+	count := int(tokenCountOut)
+	tokenIDs := make([]uint32, count)
+	if count > 0 {
+		copy(tokenIDs, unsafe.Slice((*uint32)(unsafe.Pointer(tokenIDsOut)), count))
+		C.sgl_free_token_ids(tokenIDsOut, tokenCountOut)
+	}
+	return tokenIDs, nil
+}
+
+// TokenizerSpecialTokensJSON returns the tokenizer's special tokens as a JSON
+// object (see sgl_tokenizer_special_tokens for the layout).
+func TokenizerSpecialTokensJSON(tokenizerHandle *TokenizerHandle) (string, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return "", fmt.Errorf("invalid tokenizer handle")
+	}
+
+	var resultOut *C.char
+	var errorOut *C.char
+
+	errorCode := C.sgl_tokenizer_special_tokens(
+		unsafe.Pointer(tokenizerHandle.handle),
+		&resultOut,
+		&errorOut,
+	)
+
+	if errorCode != C.SGL_ERROR_SUCCESS {
+		errorMsg := ""
+		if errorOut != nil {
+			errorMsg = C.GoString(errorOut)
+			C.sgl_free_string(errorOut)
+		}
+		return "", fmt.Errorf("failed to read special tokens: %s", errorMsg)
+	}
+
+	result := C.GoString(resultOut)
+	C.sgl_free_string(resultOut)
+	return result, nil
+}
+
+// TokenizerTokenToID looks up the ID of a single token string. The boolean
+// result is false if the token is not in the vocabulary.
+func TokenizerTokenToID(tokenizerHandle *TokenizerHandle, token string) (uint32, bool, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return 0, false, fmt.Errorf("invalid tokenizer handle")
+	}
+
+	tokenC := C.CString(token)
+	defer C.free(unsafe.Pointer(tokenC))
+
+	var idOut C.uint32_t
+	var foundOut C.int
+
+	errorCode := C.sgl_tokenizer_token_to_id(
+		unsafe.Pointer(tokenizerHandle.handle),
+		tokenC,
+		&idOut,
+		&foundOut,
+	)
+	if errorCode != C.SGL_ERROR_SUCCESS {
+		return 0, false, fmt.Errorf("failed to look up token %q: error code %d", token, int(errorCode))
+	}
+
+	return uint32(idOut), foundOut != 0, nil
+}
+
+// TokenizerIDToToken looks up the token string for a single token ID. The
+// boolean result is false if the ID is not in the vocabulary.
+func TokenizerIDToToken(tokenizerHandle *TokenizerHandle, id uint32) (string, bool, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return "", false, fmt.Errorf("invalid tokenizer handle")
+	}
+
+	tokenC := C.sgl_tokenizer_id_to_token(unsafe.Pointer(tokenizerHandle.handle), C.uint32_t(id))
+	if tokenC == nil {
+		return "", false, nil
+	}
+	token := C.GoString(tokenC)
+	C.sgl_free_string(tokenC)
+	return token, true, nil
+}
+
+// DetokenizerHandle wraps the Rust incremental detokenizer handle
+type DetokenizerHandle struct {
+	handle *C.DetokenizerHandle
+}
+
+// NewDetokenizer creates an incremental detokenizer. promptTokenIDs, if set,
+// provide left context so the first decoded tokens are spaced correctly. The
+// detokenizer keeps its own reference to the tokenizer.
+func NewDetokenizer(tokenizerHandle *TokenizerHandle, promptTokenIDs []uint32, skipSpecialTokens bool) (*DetokenizerHandle, error) {
+	if tokenizerHandle == nil || tokenizerHandle.handle == nil {
+		return nil, fmt.Errorf("invalid tokenizer handle")
+	}
+
+	var promptPtr *C.uint32_t
+	if len(promptTokenIDs) > 0 {
+		promptPtr = (*C.uint32_t)(unsafe.Pointer(&promptTokenIDs[0]))
+	}
+
+	skipSpecialTokensC := C.int(0)
+	if skipSpecialTokens {
+		skipSpecialTokensC = C.int(1)
+	}
+
+	var errorOut *C.char
+	handle := C.sgl_detokenizer_create(
+		unsafe.Pointer(tokenizerHandle.handle),
+		promptPtr,
+		C.size_t(len(promptTokenIDs)),
+		skipSpecialTokensC,
+		&errorOut,
+	)
+
+	if handle == nil {
+		errorMsg := ""
+		if errorOut != nil {
+			errorMsg = C.GoString(errorOut)
+			C.sgl_free_string(errorOut)
+		}
+		if errorMsg == "" {
+			errorMsg = "failed to create detokenizer"
+		}
+		return nil, fmt.Errorf("%s", errorMsg)
+	}
+
+	return &DetokenizerHandle{handle: handle}, nil
+}
+
+// Step appends token IDs and returns the text they complete. The result is
+// empty while a multi-byte character is still incomplete.
+func (h *DetokenizerHandle) Step(tokenIDs []uint32) (string, error) {
+	if h == nil || h.handle == nil {
+		return "", fmt.Errorf("invalid detokenizer handle")
+	}
+
+	var idsPtr *C.uint32_t
+	if len(tokenIDs) > 0 {
+		idsPtr = (*C.uint32_t)(unsafe.Pointer(&tokenIDs[0]))
+	}
+
+	var textOut *C.char
+	var errorOut *C.char
+
+	errorCode := C.sgl_detokenizer_step(h.handle, idsPtr, C.size_t(len(tokenIDs)), &textOut, &errorOut)
+	return detokenizerResult(errorCode, textOut, errorOut)
+}
+
+// Flush returns any text still held back by the detokenizer.
+func (h *DetokenizerHandle) Flush() (string, error) {
+	if h == nil || h.handle == nil {
+		return "", fmt.Errorf("invalid detokenizer handle")
+	}
+
+	var textOut *C.char
+	var errorOut *C.char
+
+	errorCode := C.sgl_detokenizer_flush(h.handle, &textOut, &errorOut)
+	return detokenizerResult(errorCode, textOut, errorOut)
+}
+
+// Free frees the detokenizer handle
+func (h *DetokenizerHandle) Free() {
+	if h != nil && h.handle != nil {
+		C.sgl_detokenizer_free(h.handle)
+		h.handle = nil
+	}
+}
+
+func detokenizerResult(errorCode C.SglErrorCode, textOut *C.char, errorOut *C.char) (string, error) {
+	if errorCode != C.SGL_ERROR_SUCCESS {
+		errorMsg := ""
+		if errorOut != nil {
+			errorMsg = C.GoString(errorOut)
+			C.sgl_free_string(errorOut)
+		}
+		return "", fmt.Errorf("failed to detokenize: %s", errorMsg)
+	}
+
+	text := C.GoString(textOut)
+	C.sgl_free_string(textOut)
+	return text, nil
+}
@@ -8,19 +8,26 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
 	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
 )
 
+// invalidRequest returns an error for a request that cannot be served as
+// given, using the code the Rust FFI functions return for invalid arguments
+func invalidRequest(format string, args ...interface{}) error {
+	return &ffi.Error{Code: ffi.ErrorInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
+
 type grpcClientStream interface {
 	Recv() (*proto.GenerateResponse, error)
 	CloseSend() error
@@ -37,6 +44,9 @@ type GrpcClient struct {
 	client          proto.SglangSchedulerClient
 	tokenizerPath   string
 	tokenizerHandle *ffi.TokenizerHandle
+	// modelTokenizers holds per-model tokenizer handles keyed by model name.
+	// Requests whose model is not present fall back to tokenizerHandle.
+	modelTokenizers map[string]*ffi.TokenizerHandle
 	bufferSizes     ChannelBufferSizes
 	timeouts        Timeouts
 	requestCounter  uint64 // Atomic counter to ensure unique request IDs
@@ -54,7 +64,9 @@ type Timeouts struct {
 	CloseTimeout     time.Duration
 }
 
-func NewGrpcClient(endpoint, tokenizerPath string, bufferSizes ChannelBufferSizes, timeouts Timeouts) (*GrpcClient, error) {
+// NewGrpcClient connects to endpoint. clientMetadata is sent as gRPC
+// metadata with every call.
+func NewGrpcClient(endpoint, tokenizerPath string, tokenizerPaths map[string]string, clientMetadata map[string]string, bufferSizes ChannelBufferSizes, timeouts Timeouts) (*GrpcClient, error) {
 	endpoint = strings.TrimPrefix(endpoint, "grpc://")
 	if !strings.Contains(endpoint, ":") {
 		return nil, fmt.Errorf("invalid endpoint format: %s (expected grpc://host:port)", endpoint)
@@ -70,6 +82,20 @@ func NewGrpcClient(endpoint, tokenizerPath string, bufferSizes ChannelBufferSize
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithKeepaliveParams(keepaliveParams),
 	}
+	if len(clientMetadata) > 0 {
+		pairs := make([]string, 0, 2*len(clientMetadata))
+		for key, value := range clientMetadata {
+			pairs = append(pairs, key, value)
+		}
+		opts = append(opts,
+			grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+				return invoker(metadata.AppendToOutgoingContext(ctx, pairs...), method, req, reply, cc, callOpts...)
+			}),
+			grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return streamer(metadata.AppendToOutgoingContext(ctx, pairs...), desc, cc, method, callOpts...)
+			}),
+		)
+	}
 
 	conn, err := grpc.NewClient(endpoint, opts...)
 	if err != nil {
@@ -78,10 +104,35 @@ func NewGrpcClient(endpoint, tokenizerPath string, bufferSizes ChannelBufferSize
 
 	client := proto.NewSglangSchedulerClient(conn)
 
-	tokenizerHandle, err := ffi.CreateTokenizerHandle(tokenizerPath)
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to create tokenizer handle: %w", err)
+	var tokenizerHandle *ffi.TokenizerHandle
+	if tokenizerPath != "" {
+		tokenizerHandle, err = ffi.CreateTokenizerHandle(tokenizerPath)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create tokenizer handle: %w", err)
+		}
+	}
+
+	// Tokenizers shared by several models are loaded once and reused.
+	modelTokenizers := make(map[string]*ffi.TokenizerHandle, len(tokenizerPaths))
+	handlesByPath := make(map[string]*ffi.TokenizerHandle)
+	if tokenizerHandle != nil {
+		handlesByPath[tokenizerPath] = tokenizerHandle
+	}
+	for model, path := range tokenizerPaths {
+		handle, ok := handlesByPath[path]
+		if !ok {
+			handle, err = ffi.CreateTokenizerHandle(path)
+			if err != nil {
+				for _, h := range handlesByPath {
+					ffi.FreeTokenizerHandle(h)
+				}
+				conn.Close()
+				return nil, fmt.Errorf("failed to create tokenizer handle for model %q: %w", model, err)
+			}
+			handlesByPath[path] = handle
+		}
+		modelTokenizers[model] = handle
 	}
 
 	return &GrpcClient{
@@ -89,14 +140,95 @@ func NewGrpcClient(endpoint, tokenizerPath string, bufferSizes ChannelBufferSize
 		client:          client,
 		tokenizerPath:   tokenizerPath,
 		tokenizerHandle: tokenizerHandle,
+		modelTokenizers: modelTokenizers,
 		bufferSizes:     bufferSizes,
 		timeouts:        timeouts,
 	}, nil
 }
 
+// Healthy reports whether the connection to the server is usable. An idle
+// connection counts as healthy; it reconnects on the next call.
+func (c *GrpcClient) Healthy() bool {
+	if c.conn == nil {
+		return false
+	}
+	state := c.conn.GetState()
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+// GetModelInfo returns the model information reported by the server.
+func (c *GrpcClient) GetModelInfo(ctx context.Context) (*proto.GetModelInfoResponse, error) {
+	return c.client.GetModelInfo(ctx, &proto.GetModelInfoRequest{})
+}
+
+// GetServerInfo returns the server configuration and state reported by the
+// server.
+func (c *GrpcClient) GetServerInfo(ctx context.Context) (*proto.GetServerInfoResponse, error) {
+	return c.client.GetServerInfo(ctx, &proto.GetServerInfoRequest{})
+}
+
+// GetLoads returns the load metrics reported by the server, with the given
+// optional sections, e.g. "spec".
+func (c *GrpcClient) GetLoads(ctx context.Context, include ...string) (*proto.GetLoadsResponse, error) {
+	return c.client.GetLoads(ctx, &proto.GetLoadsRequest{Include: include})
+}
+
+// Embed tokenizes text with special tokens and returns its embedding and
+// prompt token count.
+func (c *GrpcClient) Embed(ctx context.Context, model, text string) ([]float32, int, error) {
+	tokenizerHandle := c.TokenizerFor(model)
+	if tokenizerHandle == nil {
+		return nil, 0, invalidRequest("no tokenizer configured for model %q", model)
+	}
+
+	tokenIDs, err := ffi.TokenizerEncode(tokenizerHandle, text, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("tokenization failed: %w", err)
+	}
+
+	counter := atomic.AddUint64(&c.requestCounter, 1)
+	resp, err := c.client.Embed(ctx, &proto.EmbedRequest{
+		RequestId: fmt.Sprintf("embd-%d-%d", time.Now().UnixNano(), counter),
+		Tokenized: &proto.TokenizedInput{
+			OriginalText: text,
+			InputIds:     tokenIDs,
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	promptTokens := int(resp.PromptTokens)
+	if promptTokens == 0 {
+		promptTokens = len(tokenIDs)
+	}
+	return resp.Embedding, promptTokens, nil
+}
+
+// TokenizerFor returns the tokenizer handle registered for model, falling back
+// to the default tokenizer when the model has no dedicated tokenizer.
+// The handle is owned by the client and is freed by Close.
+func (c *GrpcClient) TokenizerFor(model string) *ffi.TokenizerHandle {
+	if handle, ok := c.modelTokenizers[model]; ok {
+		return handle
+	}
+	return c.tokenizerHandle
+}
+
 func (c *GrpcClient) Close() error {
+	// Handles may be shared between models, so free each one exactly once.
+	freed := make(map[*ffi.TokenizerHandle]bool, len(c.modelTokenizers)+1)
+	for _, handle := range c.modelTokenizers {
+		if !freed[handle] {
+			ffi.FreeTokenizerHandle(handle)
+			freed[handle] = true
+		}
+	}
+	c.modelTokenizers = nil
 	if c.tokenizerHandle != nil {
-		ffi.FreeTokenizerHandle(c.tokenizerHandle)
+		if !freed[c.tokenizerHandle] {
+			ffi.FreeTokenizerHandle(c.tokenizerHandle)
+		}
 		c.tokenizerHandle = nil
 	}
 
@@ -106,36 +238,29 @@ func (c *GrpcClient) Close() error {
 	return nil
 }
 
-func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON string) (*GrpcChatCompletionStream, error) {
-	if c.tokenizerHandle == nil {
-		return nil, fmt.Errorf("tokenizer handle is nil (should be created at startup)")
-	}
-
-	preprocessed, err := ffi.PreprocessChatRequestWithTokenizer(reqJSON, c.tokenizerHandle)
-	if err != nil {
-		return nil, fmt.Errorf("preprocessing failed: %w", err)
-	}
-	defer func() {
-		if preprocessed != nil {
-			preprocessed.Free()
-		}
-	}()
-
+func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON []byte) (*GrpcChatCompletionStream, error) {
 	// Parse request JSON to get parameters
 	var reqMap map[string]interface{}
-	if err := json.Unmarshal([]byte(reqJSON), &reqMap); err != nil {
-		return nil, fmt.Errorf("failed to parse request JSON: %w", err)
+	if err := json.Unmarshal(reqJSON, &reqMap); err != nil {
+		return nil, invalidRequest("failed to parse request JSON: %v", err)
 	}
 
 	model, _ := reqMap["model"].(string)
+	tokenizerHandle := c.TokenizerFor(model)
 	if model == "" {
 		model = "default"
 	}
+	if tokenizerHandle == nil {
+		return nil, invalidRequest("no tokenizer configured for model %q", model)
+	}
 
-	requireReasoning, err := ffi.ChatRequiresReasoningWithTokenizer(reqJSON, c.tokenizerHandle)
+	// The JSON is read in place and parsed once for both results, which
+	// spares copies of very large prompts
+	preprocessed, requireReasoning, err := ffi.PreprocessChatRequestBytes(reqJSON, tokenizerHandle)
 	if err != nil {
-		return nil, fmt.Errorf("failed to determine require_reasoning: %w", err)
+		return nil, fmt.Errorf("preprocessing failed: %w", err)
 	}
+	defer preprocessed.Free()
 
 	// Build GenerateRequest
 	// Generate unique request ID using timestamp + atomic counter to avoid collisions
@@ -152,7 +277,86 @@ func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON str
 		RequireReasoning: requireReasoning,
 	}
 
-	// Set sampling parameters
+	samplingParams := samplingParamsFromRequest(reqMap)
+
+	// Parse tool constraints if available. A constraint of the request
+	// takes precedence, as in the gateway.
+	if preprocessed.ToolConstraintsJSON != "" && samplingParams.Constraint == nil {
+		var toolConstraints map[string]interface{}
+		if err := json.Unmarshal([]byte(preprocessed.ToolConstraintsJSON), &toolConstraints); err == nil {
+			if regex, ok := toolConstraints["regex"].(string); ok {
+				samplingParams.Constraint = &proto.SamplingParams_Regex{Regex: regex}
+			} else if jsonSchema, ok := toolConstraints["json_schema"].(string); ok {
+				samplingParams.Constraint = &proto.SamplingParams_JsonSchema{JsonSchema: jsonSchema}
+			}
+		}
+	}
+
+	generateReq.SamplingParams = samplingParams
+	generateReq.Timestamp = timestamppb.Now()
+
+	toolsJSON := ""
+	if tools, ok := reqMap["tools"].([]interface{}); ok && len(tools) > 0 {
+		toolsBytes, _ := json.Marshal(tools)
+		toolsJSON = string(toolsBytes)
+	}
+
+	toolChoiceJSON := ""
+	if toolChoice, ok := reqMap["tool_choice"]; ok {
+		toolChoiceBytes, _ := json.Marshal(toolChoice)
+		toolChoiceJSON = string(toolChoiceBytes)
+	}
+
+	return c.startStream(ctx, generateReq, reqMap, tokenizerHandle, model, toolsJSON, toolChoiceJSON, preprocessed.PromptTokens)
+}
+
+// CreateCompletionStream starts a legacy (/v1/completions) request. The prompt
+// is tokenized as-is, without a chat template. The returned stream yields chat
+// completion chunks; callers map them to completion chunks.
+func (c *GrpcClient) CreateCompletionStream(ctx context.Context, reqJSON []byte) (*GrpcChatCompletionStream, error) {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(reqJSON, &reqMap); err != nil {
+		return nil, invalidRequest("failed to parse request JSON: %v", err)
+	}
+
+	model, _ := reqMap["model"].(string)
+	tokenizerHandle := c.TokenizerFor(model)
+	if model == "" {
+		model = "default"
+	}
+	if tokenizerHandle == nil {
+		return nil, invalidRequest("no tokenizer configured for model %q", model)
+	}
+
+	prompt, ok := reqMap["prompt"].(string)
+	if !ok {
+		return nil, invalidRequest("prompt must be a string")
+	}
+	tokenIDs, err := ffi.TokenizerEncode(tokenizerHandle, prompt, false)
+	if err != nil {
+		return nil, fmt.Errorf("tokenization failed: %w", err)
+	}
+
+	counter := atomic.AddUint64(&c.requestCounter, 1)
+	requestID := fmt.Sprintf("cmpl-%d-%d", time.Now().UnixNano(), counter)
+	generateReq := &proto.GenerateRequest{
+		RequestId: requestID,
+		Tokenized: &proto.TokenizedInput{
+			OriginalText: prompt,
+			InputIds:     tokenIDs,
+		},
+		Stream: true,
+	}
+	generateReq.SamplingParams = samplingParamsFromRequest(reqMap)
+	generateReq.Timestamp = timestamppb.Now()
+
+	return c.startStream(ctx, generateReq, reqMap, tokenizerHandle, model, "", "", int32(len(tokenIDs)))
+}
+
+// samplingParamsFromRequest maps the OpenAI sampling fields and the regex
+// and ebnf constraints of a chat or completion request to proto sampling
+// parameters.
+func samplingParamsFromRequest(reqMap map[string]interface{}) *proto.SamplingParams {
 	samplingParams := &proto.SamplingParams{
 		Temperature:                1.0,
 		TopP:                       1.0,
@@ -200,37 +404,22 @@ func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON str
 	if repPenalty, ok := reqMap["repetition_penalty"].(float64); ok {
 		samplingParams.RepetitionPenalty = float32(repPenalty)
 	}
-
-	// Parse tool constraints if available
-	if preprocessed.ToolConstraintsJSON != "" {
-		var toolConstraints map[string]interface{}
-		if err := json.Unmarshal([]byte(preprocessed.ToolConstraintsJSON), &toolConstraints); err == nil {
-			if regex, ok := toolConstraints["regex"].(string); ok {
-				samplingParams.Constraint = &proto.SamplingParams_Regex{Regex: regex}
-			} else if jsonSchema, ok := toolConstraints["json_schema"].(string); ok {
-				samplingParams.Constraint = &proto.SamplingParams_JsonSchema{JsonSchema: jsonSchema}
-			}
-		}
+	if regex, ok := reqMap["regex"].(string); ok && regex != "" {
+		samplingParams.Constraint = &proto.SamplingParams_Regex{Regex: regex}
+	} else if ebnf, ok := reqMap["ebnf"].(string); ok && ebnf != "" {
+		samplingParams.Constraint = &proto.SamplingParams_EbnfGrammar{EbnfGrammar: ebnf}
 	}
 
-	generateReq.SamplingParams = samplingParams
-	generateReq.Timestamp = timestamppb.Now()
+	return samplingParams
+}
 
+// startStream sends generateReq and starts converting its responses into
+// OpenAI chat completion chunks.
+func (c *GrpcClient) startStream(ctx context.Context, generateReq *proto.GenerateRequest, reqMap map[string]interface{}, tokenizerHandle *ffi.TokenizerHandle, model, toolsJSON, toolChoiceJSON string, promptTokens int32) (*GrpcChatCompletionStream, error) {
 	stream, err := c.client.Generate(ctx, generateReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC stream: %w", err)
 	}
-	toolsJSON := ""
-	if tools, ok := reqMap["tools"].([]interface{}); ok && len(tools) > 0 {
-		toolsBytes, _ := json.Marshal(tools)
-		toolsJSON = string(toolsBytes)
-	}
-
-	toolChoiceJSON := ""
-	if toolChoice, ok := reqMap["tool_choice"]; ok {
-		toolChoiceBytes, _ := json.Marshal(toolChoice)
-		toolChoiceJSON = string(toolChoiceBytes)
-	}
 
 	stopJSON := ""
 	if stop, ok := reqMap["stop"]; ok {
@@ -252,13 +441,8 @@ func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON str
 		skipSpecialTokens = skipSpecialTokensVal
 	}
 
-	if c.tokenizerHandle == nil {
-		stream.CloseSend()
-		return nil, fmt.Errorf("tokenizer handle is nil (should be created at startup)")
-	}
-
 	converterHandle, err := ffi.CreateGrpcResponseConverterWithTokenizer(
-		c.tokenizerHandle,
+		tokenizerHandle,
 		model,
 		generateReq.RequestId,
 		toolsJSON,
@@ -266,7 +450,7 @@ func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON str
 		stopJSON,
 		stopTokenIDs,
 		skipSpecialTokens,
-		preprocessed.PromptTokens, // Pass initial prompt tokens from preprocessing
+		promptTokens, // Pass initial prompt tokens from preprocessing
 	)
 	if err != nil {
 		stream.CloseSend()
@@ -289,7 +473,6 @@ func (c *GrpcClient) CreateChatCompletionStream(ctx context.Context, reqJSON str
 		readLoopDone:       make(chan struct{}),
 		requestID:          generateReq.RequestId,
 		model:              model,
-		processWg:          sync.WaitGroup{},
 		closeTimeout:       c.timeouts.CloseTimeout,
 		bufferSizes:        c.bufferSizes,
 	}
@@ -313,7 +496,6 @@ type GrpcChatCompletionStream struct {
 	readLoopDone       chan struct{}
 	requestID          string
 	model              string
-	processWg          sync.WaitGroup
 	closeTimeout       time.Duration
 	bufferSizes        ChannelBufferSizes
 	clientDisconnected int32 // Atomic flag: 1 if client disconnected, 0 otherwise
@@ -322,7 +504,6 @@ type GrpcChatCompletionStream struct {
 func (s *GrpcChatCompletionStream) readLoop() {
 	defer func() {
 		atomic.StoreInt32(&s.closed, 1)
-		s.processWg.Wait()
 		close(s.resultJSONChan)
 		close(s.errChan)
 		close(s.readLoopDone)
@@ -439,12 +620,11 @@ func (s *GrpcChatCompletionStream) readLoop() {
 				return
 			}
 
+			// Responses are converted one at a time, in the order received:
+			// detokenization is incremental and chunks must reach RecvJSON
+			// in generation order
 			if result.resp != nil {
-				s.processWg.Add(1)
-				go func(resp *proto.GenerateResponse) {
-					defer s.processWg.Done()
-					s.processAndSendResponse(resp)
-				}(result.resp)
+				s.processAndSendResponse(result.resp)
 			}
 		}
 	}
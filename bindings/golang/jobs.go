@@ -0,0 +1,310 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides asynchronous completion jobs that are submitted and
+// polled.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is matched, with errors.Is, by the error returned for a job
+// ID that was never submitted or whose result is no longer retained.
+var ErrJobNotFound = errors.New("completion job not found")
+
+// DefaultJobRetention is how long a JobRunner keeps finished jobs when
+// JobOptions.Retention is not set.
+const DefaultJobRetention = time.Hour
+
+// JobStatus is the state of a completion job.
+type JobStatus string
+
+// Job states. Queued and running jobs are pending; the others are final.
+const (
+	// JobQueued means the job waits for a free slot
+	JobQueued JobStatus = "queued"
+	// JobRunning means the request is being generated
+	JobRunning JobStatus = "running"
+	// JobSucceeded means the response is available
+	JobSucceeded JobStatus = "succeeded"
+	// JobFailed means every attempt failed
+	JobFailed JobStatus = "failed"
+	// JobCancelled means the job was cancelled before it finished
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Done reports whether s is final.
+func (s JobStatus) Done() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobOptions controls a JobRunner.
+type JobOptions struct {
+	// Concurrency is the maximum number of jobs running at once; the others
+	// are queued. Zero means no limit.
+	Concurrency int
+	// Timeout, if positive, bounds each job, including retries
+	Timeout time.Duration
+	// Retry controls retrying failed attempts of a job. The zero value makes
+	// one attempt.
+	Retry RetryPolicy
+	// Retention is how long finished jobs are kept for GetCompletionResult.
+	// Defaults to DefaultJobRetention.
+	Retention time.Duration
+	// Webhook controls the delivery of results to the webhooks of jobs
+	// submitted with SubmitCompletionWithWebhook
+	Webhook WebhookOptions
+}
+
+// CompletionJob is a snapshot of a job submitted to a JobRunner.
+type CompletionJob struct {
+	ID     string
+	Status JobStatus
+	// Response is set once the job succeeds
+	Response *ChatCompletionResponse
+	// Err is set once the job fails or is cancelled
+	Err error
+	// Attempts is the number of requests made so far
+	Attempts   int
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// JobRunner runs chat completions in the background, so that a very long
+// generation continues when the caller that submitted it goes away, e.g. an
+// HTTP client that disconnects and polls for the result later. It is safe
+// for concurrent use.
+//
+//	jobs := smg.NewJobRunner(client, smg.JobOptions{Concurrency: 16})
+//	defer jobs.Close()
+//	id, err := jobs.SubmitCompletion(ctx, req)
+//	...
+//	resp, err := jobs.WaitForCompletion(ctx, id)
+type JobRunner struct {
+	client ChatClient
+	opts   JobOptions
+	// slots limits running jobs; nil when unlimited
+	slots chan struct{}
+	// ctx is cancelled by Close to stop webhook deliveries
+	ctx  context.Context
+	stop context.CancelFunc
+	// running counts the goroutines of jobs, which Close waits for
+	running sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	closed bool
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// job is the state of a submitted job, guarded by the runner's mu
+type job struct {
+	CompletionJob
+	cancel context.CancelFunc
+	// done is closed when the job finishes
+	done chan struct{}
+	// webhook is notified when the job finishes, if set
+	webhook string
+}
+
+// NewJobRunner creates a runner sending jobs through client.
+func NewJobRunner(client ChatClient, opts JobOptions) *JobRunner {
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultJobRetention
+	}
+	r := &JobRunner{client: client, opts: opts, jobs: make(map[string]*job), now: time.Now}
+	r.ctx, r.stop = context.WithCancel(context.Background())
+	if opts.Concurrency > 0 {
+		r.slots = make(chan struct{}, opts.Concurrency)
+	}
+	return r
+}
+
+// SubmitCompletion starts generating req in the background and returns the
+// ID of its job. The job keeps the values of ctx, such as labels and the
+// request ID, but not its cancellation or deadline. Streams cannot be
+// submitted.
+func (r *JobRunner) SubmitCompletion(ctx context.Context, req ChatCompletionRequest) (string, error) {
+	return r.submit(ctx, req, "")
+}
+
+// submit starts a job for req that notifies webhook, if set, when it
+// finishes
+func (r *JobRunner) submit(ctx context.Context, req ChatCompletionRequest, webhook string) (string, error) {
+	if req.Stream {
+		return "", invalidRequest("streaming requests cannot be submitted as jobs")
+	}
+	var jobCtx context.Context
+	var cancel context.CancelFunc
+	if r.opts.Timeout > 0 {
+		jobCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), r.opts.Timeout)
+	} else {
+		jobCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		cancel()
+		return "", errors.New("job runner is closed")
+	}
+	r.prune()
+	j := &job{
+		CompletionJob: CompletionJob{ID: "job-" + randomID(), Status: JobQueued, CreatedAt: r.now()},
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		webhook:       webhook,
+	}
+	r.jobs[j.ID] = j
+	r.running.Add(1)
+	r.mu.Unlock()
+
+	go r.run(jobCtx, j, req)
+	return j.ID, nil
+}
+
+// run generates req, then notifies the webhook of j, outside of its slot
+func (r *JobRunner) run(ctx context.Context, j *job, req ChatCompletionRequest) {
+	defer r.running.Done()
+	r.generate(ctx, j, req)
+	if j.webhook != "" {
+		r.mu.Lock()
+		snapshot := j.CompletionJob
+		r.mu.Unlock()
+		r.notify(snapshot, j.webhook)
+	}
+}
+
+// generate waits for a slot, then generates req
+func (r *JobRunner) generate(ctx context.Context, j *job, req ChatCompletionRequest) {
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+			defer func() { <-r.slots }()
+		case <-ctx.Done():
+			r.finish(j, nil, ctx.Err())
+			return
+		}
+	}
+
+	r.mu.Lock()
+	j.Status = JobRunning
+	r.mu.Unlock()
+	result := r.opts.Retry.do(ctx, func() (*ChatCompletionResponse, error) {
+		r.mu.Lock()
+		j.Attempts++
+		r.mu.Unlock()
+		return r.client.CreateChatCompletion(ctx, req)
+	})
+	r.finish(j, result.Response, result.Err)
+}
+
+// finish records the outcome of j
+func (r *JobRunner) finish(j *job, resp *ChatCompletionResponse, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if j.Status.Done() {
+		return
+	}
+	switch {
+	case err == nil:
+		j.Status = JobSucceeded
+		j.Response = resp
+	case errors.Is(err, context.Canceled):
+		j.Status = JobCancelled
+		j.Err = err
+	default:
+		j.Status = JobFailed
+		j.Err = err
+	}
+	j.FinishedAt = r.now()
+	j.cancel()
+	close(j.done)
+}
+
+// GetCompletionResult returns the current state of the job with jobID,
+// without waiting for it.
+func (r *JobRunner) GetCompletionResult(jobID string) (*CompletionJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, err := r.lookup(jobID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := j.CompletionJob
+	return &snapshot, nil
+}
+
+// WaitForCompletion waits for the job with jobID to finish and returns its
+// response or error. A ctx that is done stops the wait, not the job.
+func (r *JobRunner) WaitForCompletion(ctx context.Context, jobID string) (*ChatCompletionResponse, error) {
+	r.mu.Lock()
+	j, err := r.lookup(jobID)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return j.Response, j.Err
+}
+
+// CancelCompletion cancels the job with jobID if it has not finished.
+func (r *JobRunner) CancelCompletion(jobID string) error {
+	r.mu.Lock()
+	j, err := r.lookup(jobID)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	j.cancel()
+	return nil
+}
+
+// Close cancels the pending jobs and webhook deliveries, rejects new jobs,
+// and waits for the jobs to stop. Finished jobs remain available.
+func (r *JobRunner) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	for _, j := range r.jobs {
+		j.cancel()
+	}
+	r.mu.Unlock()
+	r.stop()
+	r.running.Wait()
+	return nil
+}
+
+// lookup returns the job with id; r.mu must be held
+func (r *JobRunner) lookup(id string) (*job, error) {
+	j, ok := r.jobs[id]
+	if !ok || r.expired(j) {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j, nil
+}
+
+// expired reports whether j finished longer ago than the retention; r.mu
+// must be held
+func (r *JobRunner) expired(j *job) bool {
+	return j.Status.Done() && r.now().Sub(j.FinishedAt) >= r.opts.Retention
+}
+
+// prune forgets expired jobs; r.mu must be held
+func (r *JobRunner) prune() {
+	for id, j := range r.jobs {
+		if r.expired(j) {
+			delete(r.jobs, id)
+		}
+	}
+}
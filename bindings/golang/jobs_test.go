@@ -0,0 +1,108 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestJobRunner tests that jobs outlive the submitting context and can be
+// polled, waited for, and cancelled
+func TestJobRunner(t *testing.T) {
+	release := make(chan struct{})
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		if req.Model == "block" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		<-release
+		return &ChatCompletionResponse{ID: req.Model}, nil
+	})
+	jobs := NewJobRunner(client, JobOptions{Concurrency: 1})
+	defer jobs.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := jobs.SubmitCompletion(ctx, ChatCompletionRequest{Model: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := jobs.SubmitCompletion(ctx, ChatCompletionRequest{Model: "second"})
+	cancel()
+
+	// One job runs while the other waits for the slot
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		a, _ := jobs.GetCompletionResult(first)
+		b, _ := jobs.GetCompletionResult(second)
+		if a.Status == JobRunning || b.Status == JobRunning {
+			if a.Status == b.Status {
+				t.Fatalf("job statuses = %s, %s with a concurrency of 1", a.Status, b.Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no job started")
+		}
+	}
+	close(release)
+
+	resp, err := jobs.WaitForCompletion(context.Background(), second)
+	if err != nil || resp.ID != "second" {
+		t.Fatalf("WaitForCompletion() = %+v, %v", resp, err)
+	}
+	jobs.WaitForCompletion(context.Background(), first)
+	if job, _ := jobs.GetCompletionResult(first); job.Status != JobSucceeded || job.Response.ID != "first" || job.Attempts != 1 {
+		t.Errorf("GetCompletionResult() = %+v", job)
+	}
+
+	blocked, _ := jobs.SubmitCompletion(context.Background(), ChatCompletionRequest{Model: "block"})
+	waitForStatus(t, jobs, blocked, JobRunning)
+	if err := jobs.CancelCompletion(blocked); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.WaitForCompletion(context.Background(), blocked); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitForCompletion() of a cancelled job = %v", err)
+	}
+	if job, _ := jobs.GetCompletionResult(blocked); job.Status != JobCancelled {
+		t.Errorf("cancelled job status = %s", job.Status)
+	}
+
+	if _, err := jobs.SubmitCompletion(context.Background(), ChatCompletionRequest{Stream: true}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("SubmitCompletion() of a stream = %v, want ErrInvalidRequest", err)
+	}
+	if _, err := jobs.GetCompletionResult("job-unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetCompletionResult() of an unknown job = %v, want ErrJobNotFound", err)
+	}
+}
+
+// TestJobRunnerRetention tests that finished jobs are forgotten after the
+// retention
+func TestJobRunnerRetention(t *testing.T) {
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{}, nil
+	})
+	jobs := NewJobRunner(client, JobOptions{Retention: time.Minute})
+	now := time.Now()
+	jobs.now = func() time.Time { return now }
+
+	id, _ := jobs.SubmitCompletion(context.Background(), ChatCompletionRequest{})
+	if _, err := jobs.WaitForCompletion(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	jobs.mu.Lock()
+	now = now.Add(time.Minute)
+	jobs.mu.Unlock()
+	if _, err := jobs.GetCompletionResult(id); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetCompletionResult() after the retention = %v, want ErrJobNotFound", err)
+	}
+}
+
+func waitForStatus(t *testing.T, jobs *JobRunner, id string, status JobStatus) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if job, err := jobs.GetCompletionResult(id); err == nil && job.Status == status {
+			return
+		}
+	}
+	t.Fatalf("job %s did not reach status %s", id, status)
+}
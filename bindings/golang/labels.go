@@ -0,0 +1,44 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides request labels for slicing metrics and usage.
+package smg
+
+import "context"
+
+type labelsKey struct{}
+
+// WithLabels returns a context carrying labels, merged over any the context
+// already carries. Requests made with the context report the labels with
+// their lifecycle events (see EventPublisher), so latency and usage can be
+// sliced by feature, tenant, or experiment.
+//
+// Example:
+//
+//	ctx := smg.WithLabels(ctx, map[string]string{"feature": "search", "experiment": "b"})
+//	resp, err := client.CreateChatCompletion(ctx, req)
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	if len(labels) == 0 {
+		return ctx
+	}
+	merged := LabelsFromContext(ctx)
+	if merged == nil {
+		merged = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+// LabelsFromContext returns a copy of the labels set by WithLabels, or nil.
+func LabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	if labels == nil {
+		return nil
+	}
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,24 @@
+package smg
+
+import (
+	"context"
+	"testing"
+)
+
+// TestWithLabels tests merging labels and that callers cannot alter them
+func TestWithLabels(t *testing.T) {
+	if labels := LabelsFromContext(context.Background()); labels != nil {
+		t.Errorf("LabelsFromContext() = %v, want nil", labels)
+	}
+	ctx := WithLabels(context.Background(), map[string]string{"feature": "search", "experiment": "a"})
+	ctx = WithLabels(ctx, map[string]string{"experiment": "b"})
+
+	labels := LabelsFromContext(ctx)
+	if len(labels) != 2 || labels["feature"] != "search" || labels["experiment"] != "b" {
+		t.Errorf("LabelsFromContext() = %v", labels)
+	}
+	labels["feature"] = "chat"
+	if got := LabelsFromContext(ctx)["feature"]; got != "search" {
+		t.Errorf("label changed through a returned map: %q", got)
+	}
+}
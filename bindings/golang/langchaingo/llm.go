@@ -0,0 +1,378 @@
+// Package langchaingo provides a LangChainGo llms.Model served by an SMG
+// client, so that chains and agents written against LangChainGo run on SMG
+// workers, load balanced when the client is a MultiClient:
+//
+//	backend, err := smg.NewMultiClient(smg.MultiClientConfig{...})
+//	...
+//	llm := langchaingo.New(backend, langchaingo.WithModel("default"))
+//	answer, err := llms.GenerateFromSinglePrompt(ctx, llm, "Capital of France?")
+//
+// Streaming is used when a call sets llms.WithStreamingFunc, and tools given
+// with llms.WithTools are offered to the model; the calls it makes are
+// returned in ContentChoice.ToolCalls.
+//
+// This package is a module of its own, so that the SDK does not depend on
+// LangChainGo.
+package langchaingo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/llms"
+)
+
+var _ llms.Model = (*LLM)(nil)
+
+// LLM is an llms.Model generating with an SMG client.
+type LLM struct {
+	client smg.ChatClient
+	model  string
+
+	// CallbacksHandler, if set, is notified of each generation, as by the
+	// LangChainGo providers.
+	CallbacksHandler callbacks.Handler
+}
+
+// Option configures an LLM.
+type Option func(*LLM)
+
+// WithModel sets the model of requests that do not name one with
+// llms.WithModel. Defaults to "default".
+func WithModel(model string) Option {
+	return func(l *LLM) {
+		l.model = model
+	}
+}
+
+// WithCallbacksHandler sets the LLM's CallbacksHandler.
+func WithCallbacksHandler(handler callbacks.Handler) Option {
+	return func(l *LLM) {
+		l.CallbacksHandler = handler
+	}
+}
+
+// New returns an LLM sending requests through client, typically an
+// *smg.Client or *smg.MultiClient, possibly wrapped with middleware.
+func New(client smg.ChatClient, opts ...Option) *LLM {
+	l := &LLM{client: client, model: "default"}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Call generates a completion of prompt.
+//
+// Deprecated: as for other llms.Model implementations, use
+// llms.GenerateFromSinglePrompt.
+func (l *LLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, l, prompt, options...)
+}
+
+// GenerateContent generates the next message of the conversation in
+// messages. It returns a single choice; llms.WithN and llms.WithCandidateCount
+// are not supported.
+func (l *LLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if l.CallbacksHandler != nil {
+		l.CallbacksHandler.HandleLLMGenerateContentStart(ctx, messages)
+	}
+
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	resp, err := l.generate(ctx, messages, opts)
+	if err != nil {
+		if l.CallbacksHandler != nil {
+			l.CallbacksHandler.HandleLLMError(ctx, err)
+		}
+		return nil, err
+	}
+
+	if l.CallbacksHandler != nil {
+		l.CallbacksHandler.HandleLLMGenerateContentEnd(ctx, resp)
+	}
+	return resp, nil
+}
+
+func (l *LLM) generate(ctx context.Context, messages []llms.MessageContent, opts llms.CallOptions) (*llms.ContentResponse, error) {
+	if opts.N > 1 || opts.CandidateCount > 1 {
+		return nil, errors.New("langchaingo: more than one choice is not supported")
+	}
+	req, err := l.request(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *smg.ChatCompletionResponse
+	if opts.StreamingFunc != nil || opts.StreamingReasoningFunc != nil {
+		resp, err = l.stream(ctx, req, opts)
+	} else {
+		resp, err = l.client.CreateChatCompletion(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contentResponse(resp), nil
+}
+
+// request converts messages and opts to a chat completion request
+func (l *LLM) request(messages []llms.MessageContent, opts llms.CallOptions) (smg.ChatCompletionRequest, error) {
+	req := smg.ChatCompletionRequest{Model: l.model}
+	if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	for _, m := range messages {
+		converted, err := chatMessages(m)
+		if err != nil {
+			return req, err
+		}
+		req.Messages = append(req.Messages, converted...)
+	}
+
+	if opts.MaxTokens > 0 {
+		req.MaxCompletionTokens = &opts.MaxTokens
+	}
+	if opts.Temperature > 0 {
+		req.Temperature = float32Ptr(opts.Temperature)
+	}
+	if opts.TopP > 0 {
+		req.TopP = float32Ptr(opts.TopP)
+	}
+	if opts.TopK > 0 {
+		req.TopK = &opts.TopK
+	}
+	if opts.Seed != 0 {
+		req.Seed = &opts.Seed
+	}
+	if opts.RepetitionPenalty > 0 {
+		req.RepetitionPenalty = float32Ptr(opts.RepetitionPenalty)
+	}
+	if opts.FrequencyPenalty != 0 {
+		req.FrequencyPenalty = float32Ptr(opts.FrequencyPenalty)
+	}
+	if opts.PresencePenalty != 0 {
+		req.PresencePenalty = float32Ptr(opts.PresencePenalty)
+	}
+	if len(opts.StopWords) > 0 {
+		req.Stop = opts.StopWords
+	}
+	if opts.JSONMode || opts.ResponseMIMEType == "application/json" {
+		req.ResponseFormat = &smg.ResponseFormat{Type: "json_object"}
+	}
+
+	for _, tool := range opts.Tools {
+		converted, err := chatTool(tool.Type, tool.Function)
+		if err != nil {
+			return req, err
+		}
+		req.Tools = append(req.Tools, converted)
+	}
+	for i := range opts.Functions {
+		converted, err := chatTool("function", &opts.Functions[i])
+		if err != nil {
+			return req, err
+		}
+		req.Tools = append(req.Tools, converted)
+	}
+	req.ToolChoice = opts.ToolChoice
+	return req, nil
+}
+
+// chatMessages converts a message to chat messages. A tool message becomes
+// one chat message per tool response.
+func chatMessages(m llms.MessageContent) ([]smg.ChatMessage, error) {
+	var role string
+	switch m.Role {
+	case llms.ChatMessageTypeSystem:
+		role = "system"
+	case llms.ChatMessageTypeHuman, llms.ChatMessageTypeGeneric:
+		role = "user"
+	case llms.ChatMessageTypeAI:
+		role = "assistant"
+	case llms.ChatMessageTypeTool, llms.ChatMessageTypeFunction:
+		var out []smg.ChatMessage
+		for _, part := range m.Parts {
+			resp, ok := part.(llms.ToolCallResponse)
+			if !ok {
+				return nil, fmt.Errorf("langchaingo: %T part in a tool message", part)
+			}
+			out = append(out, smg.ChatMessage{Role: "tool", ToolCallID: resp.ToolCallID, Name: resp.Name, Content: resp.Content})
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("langchaingo: %w: %s", llms.ErrUnexpectedChatMessageType, m.Role)
+	}
+
+	msg := smg.ChatMessage{Role: role}
+	var parts []smg.ContentPart
+	multimodal := false
+	for _, part := range m.Parts {
+		switch p := part.(type) {
+		case llms.TextContent:
+			parts = append(parts, smg.TextPart(p.Text))
+		case llms.ImageURLContent:
+			parts = append(parts, smg.ContentPart{Type: "image_url", ImageURL: &smg.ImageURL{URL: p.URL, Detail: p.Detail}})
+			multimodal = true
+		case llms.BinaryContent:
+			parts = append(parts, smg.ImagePart(smg.ImageDataURL(p.MIMEType, p.Data)))
+			multimodal = true
+		case llms.ToolCall:
+			call := smg.ToolCall{ID: p.ID, Type: p.Type}
+			if call.Type == "" {
+				call.Type = "function"
+			}
+			if p.FunctionCall != nil {
+				call.Function = smg.FunctionCall{Name: p.FunctionCall.Name, Arguments: p.FunctionCall.Arguments}
+			}
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		default:
+			return nil, fmt.Errorf("langchaingo: %T part in a %s message", part, m.Role)
+		}
+	}
+
+	if multimodal {
+		msg.Content = parts
+	} else {
+		texts := make([]string, len(parts))
+		for i, part := range parts {
+			texts[i] = part.Text
+		}
+		msg.Content = strings.Join(texts, "")
+	}
+	return []smg.ChatMessage{msg}, nil
+}
+
+// chatTool converts a tool definition, whose parameters may be any value
+// encoding to a JSON schema
+func chatTool(typ string, fn *llms.FunctionDefinition) (smg.Tool, error) {
+	if fn == nil {
+		return smg.Tool{}, fmt.Errorf("langchaingo: %s tool without a function", typ)
+	}
+	if typ == "" {
+		typ = "function"
+	}
+	tool := smg.Tool{Type: typ, Function: smg.Function{Name: fn.Name, Description: fn.Description}}
+	switch params := fn.Parameters.(type) {
+	case nil:
+	case map[string]interface{}:
+		tool.Function.Parameters = params
+	default:
+		data, err := json.Marshal(params)
+		if err != nil {
+			return tool, fmt.Errorf("langchaingo: parameters of tool %s: %w", fn.Name, err)
+		}
+		if err := json.Unmarshal(data, &tool.Function.Parameters); err != nil {
+			return tool, fmt.Errorf("langchaingo: parameters of tool %s are not a JSON object: %w", fn.Name, err)
+		}
+	}
+	return tool, nil
+}
+
+// stream generates req as a stream, passing the deltas to the streaming
+// functions of opts, and returns the aggregated response
+func (l *LLM) stream(ctx context.Context, req smg.ChatCompletionRequest, opts llms.CallOptions) (*smg.ChatCompletionResponse, error) {
+	req.Stream = true
+	includeUsage := true
+	req.StreamOptions = &smg.StreamOptions{IncludeUsage: &includeUsage}
+	stream, err := l.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var content, reasoning strings.Builder
+	resp := &smg.ChatCompletionResponse{Object: "chat.completion"}
+	choice := smg.Choice{Message: smg.Message{Role: "assistant"}}
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var chunk smg.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			return nil, fmt.Errorf("langchaingo: failed to parse chunk: %w", err)
+		}
+		if chunk.ID != "" {
+			resp.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			delta := c.Delta
+			content.WriteString(delta.Content)
+			reasoning.WriteString(delta.ReasoningContent)
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, delta.ToolCalls...)
+			if c.FinishReason != "" {
+				choice.FinishReason = c.FinishReason
+			}
+			if opts.StreamingReasoningFunc != nil && (delta.Content != "" || delta.ReasoningContent != "") {
+				if err := opts.StreamingReasoningFunc(ctx, []byte(delta.ReasoningContent), []byte(delta.Content)); err != nil {
+					return nil, err
+				}
+			}
+			if opts.StreamingFunc != nil && delta.Content != "" {
+				if err := opts.StreamingFunc(ctx, []byte(delta.Content)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	choice.Message.Content = content.String()
+	choice.Message.ReasoningContent = reasoning.String()
+	if choice.FinishReason == "" {
+		choice.FinishReason = smg.FinishReasonStop
+	}
+	resp.Choices = []smg.Choice{choice}
+	return resp, nil
+}
+
+// contentResponse converts a chat completion to a content response
+func contentResponse(resp *smg.ChatCompletionResponse) *llms.ContentResponse {
+	out := &llms.ContentResponse{}
+	for _, c := range resp.Choices {
+		choice := &llms.ContentChoice{
+			Content:          c.Message.Content,
+			StopReason:       string(c.FinishReason),
+			ReasoningContent: c.Message.ReasoningContent,
+			GenerationInfo: map[string]any{
+				"PromptTokens":     resp.Usage.PromptTokens,
+				"CompletionTokens": resp.Usage.CompletionTokens,
+				"TotalTokens":      resp.Usage.TotalTokens,
+				"ReasoningTokens":  resp.Usage.ReasoningTokens(),
+			},
+		}
+		for _, call := range c.Message.ToolCalls {
+			choice.ToolCalls = append(choice.ToolCalls, llms.ToolCall{
+				ID:           call.ID,
+				Type:         call.Type,
+				FunctionCall: &llms.FunctionCall{Name: call.Function.Name, Arguments: call.Function.Arguments},
+			})
+		}
+		if len(choice.ToolCalls) > 0 {
+			choice.FuncCall = choice.ToolCalls[0].FunctionCall
+		}
+		out.Choices = append(out.Choices, choice)
+	}
+	return out
+}
+
+func float32Ptr(v float64) *float32 {
+	f := float32(v)
+	return &f
+}
@@ -0,0 +1,107 @@
+package langchaingo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/smgtest"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// TestGenerateFromSinglePrompt tests a plain generation and the conversion
+// of call options
+func TestGenerateFromSinglePrompt(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Content: "Paris", Usage: smg.Usage{PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6}})
+	llm := New(mock, WithModel("m"))
+
+	answer, err := llms.GenerateFromSinglePrompt(context.Background(), llm, "Capital of France?",
+		llms.WithMaxTokens(16), llms.WithTemperature(0.5), llms.WithStopWords([]string{"\n"}))
+	if err != nil || answer != "Paris" {
+		t.Fatalf("GenerateFromSinglePrompt() = %q, %v", answer, err)
+	}
+	req := mock.Requests()[0]
+	if req.Model != "m" || *req.MaxCompletionTokens != 16 || *req.Temperature != 0.5 || !reflect.DeepEqual(req.Stop, []string{"\n"}) {
+		t.Errorf("request = %+v", req)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "Capital of France?" {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+}
+
+// TestStreaming tests that deltas are passed to the streaming function and
+// aggregated into the response
+func TestStreaming(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Chunks: []string{"Ro", "me"}})
+	var streamed []string
+	resp, err := New(mock).GenerateContent(context.Background(),
+		[]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Capital of Italy?")},
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			streamed = append(streamed, string(chunk))
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, []string{"Ro", "me"}) || resp.Choices[0].Content != "Rome" || resp.Choices[0].StopReason != "stop" {
+		t.Errorf("streamed %q, response %+v", streamed, resp.Choices[0])
+	}
+	if req := mock.Requests()[0]; !req.Stream {
+		t.Error("the request was not streamed")
+	}
+}
+
+// TestToolCalling tests offering a tool, returning the model's call, and
+// replaying the call with its result
+func TestToolCalling(t *testing.T) {
+	call := smg.ToolCall{ID: "call_1", Type: "function", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}
+	mock := smgtest.NewMockClient(smgtest.Reply{ToolCalls: []smg.ToolCall{call}}, smgtest.Reply{Content: "Sunny"})
+	llm := New(mock)
+	tools := []llms.Tool{{Type: "function", Function: &llms.FunctionDefinition{
+		Name:       "weather",
+		Parameters: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}}}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Weather in Paris?")}
+
+	resp, err := llm.GenerateContent(context.Background(), messages, llms.WithTools(tools))
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if choice.StopReason != "tool_calls" || len(choice.ToolCalls) != 1 || choice.ToolCalls[0].FunctionCall.Arguments != `{"city":"Paris"}` || choice.FuncCall.Name != "weather" {
+		t.Fatalf("choice = %+v, want the weather call", choice)
+	}
+	if req := mock.Requests()[0]; len(req.Tools) != 1 || req.Tools[0].Function.Name != "weather" || req.Tools[0].Function.Parameters["type"] != "object" {
+		t.Errorf("tools = %+v", req.Tools)
+	}
+
+	messages = append(messages,
+		llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{choice.ToolCalls[0]}},
+		llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: "call_1", Name: "weather", Content: "sunny"}}},
+	)
+	resp, err = llm.GenerateContent(context.Background(), messages, llms.WithTools(tools))
+	if err != nil || resp.Choices[0].Content != "Sunny" {
+		t.Fatalf("GenerateContent() = %+v, %v", resp, err)
+	}
+	replayed := mock.Requests()[1].Messages
+	if len(replayed) != 3 || replayed[1].ToolCalls[0] != call || replayed[2].Role != "tool" || replayed[2].ToolCallID != "call_1" || replayed[2].Content != "sunny" {
+		t.Errorf("replayed messages = %+v", replayed)
+	}
+}
+
+// TestImageParts tests that messages with images are sent as content parts
+func TestImageParts(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Content: "A cat"})
+	_, err := New(mock).GenerateContent(context.Background(), []llms.MessageContent{{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.TextPart("What is this?"), llms.BinaryPart("image/png", []byte{1, 2})},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, ok := mock.Requests()[0].Messages[0].Content.([]smg.ContentPart)
+	if !ok || len(parts) != 2 || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "data:image/png;base64,AQI=" {
+		t.Errorf("content = %+v", mock.Requests()[0].Messages[0].Content)
+	}
+}
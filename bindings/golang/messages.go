@@ -0,0 +1,105 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides builders for chat messages and content parts.
+package smg
+
+import "encoding/base64"
+
+// ContentPart is a part of multimodal message content: text or an image.
+// Build parts with TextPart and ImagePart.
+type ContentPart struct {
+	// Type is "text" or "image_url"
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL locates the image of an "image_url" content part.
+type ImageURL struct {
+	// URL is an http(s) URL or a data URL, see ImageDataURL
+	URL string `json:"url"`
+	// Detail is "auto", "low", or "high"; empty means the model's default
+	Detail string `json:"detail,omitempty"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image content part for url.
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// ImageDataURL returns a data URL embedding an image, e.g. for ImagePart.
+func ImageDataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// SystemText returns a system message.
+func SystemText(text string) ChatMessage {
+	return ChatMessage{Role: "system", Content: text}
+}
+
+// DeveloperText returns a developer message: instructions from the
+// application, which newer OpenAI models follow in place of a system
+// message. The SDK keeps developer messages wherever it keeps system ones.
+func DeveloperText(text string) ChatMessage {
+	return ChatMessage{Role: "developer", Content: text}
+}
+
+// UserText returns a user message.
+func UserText(text string) ChatMessage {
+	return ChatMessage{Role: "user", Content: text}
+}
+
+// AssistantText returns an assistant message, e.g. to replay a reply.
+func AssistantText(text string) ChatMessage {
+	return ChatMessage{Role: "assistant", Content: text}
+}
+
+// Named returns a copy of m with Name set, distinguishing participants that
+// share a role, e.g. two users in a group chat.
+//
+//	smg.UserText("Any news?").Named("alice")
+func (m ChatMessage) Named(name string) ChatMessage {
+	m.Name = name
+	return m
+}
+
+// isInstruction reports whether role is "system" or "developer", whose
+// messages instruct the model rather than take part in the conversation
+func isInstruction(role string) bool {
+	return role == "system" || role == "developer"
+}
+
+// UserImage returns a user message showing the image at url, followed by
+// the optional text.
+//
+//	smg.UserImage("https://example.com/cat.png", "What breed is this?")
+func UserImage(url string, text ...string) ChatMessage {
+	parts := []ContentPart{ImagePart(url)}
+	for _, t := range text {
+		parts = append(parts, TextPart(t))
+	}
+	return UserParts(parts...)
+}
+
+// UserParts returns a user message with multimodal content.
+func UserParts(parts ...ContentPart) ChatMessage {
+	return ChatMessage{Role: "user", Content: parts}
+}
+
+// AssistantToolCalls returns the assistant message that made tool calls,
+// for replaying a conversation that used tools. It must be followed by a
+// ToolResult for each call.
+func AssistantToolCalls(calls ...ToolCall) ChatMessage {
+	return assistantTurn("", calls)
+}
+
+// ToolResult returns the "tool" message answering the tool call with ID
+// callID.
+func ToolResult(callID, content string) ChatMessage {
+	return ChatMessage{Role: "tool", Content: content, ToolCallID: callID}
+}
@@ -0,0 +1,52 @@
+package smg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestMessageBuilders tests the JSON of built messages
+func TestMessageBuilders(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  ChatMessage
+		want string
+	}{
+		{"system", SystemText("Be brief."), `{"role":"system","content":"Be brief."}`},
+		{"developer", DeveloperText("Answer in French."), `{"role":"developer","content":"Answer in French."}`},
+		{"user", UserText("Hi"), `{"role":"user","content":"Hi"}`},
+		{"named user", UserText("Hi").Named("alice"), `{"role":"user","content":"Hi","name":"alice"}`},
+		{"assistant", AssistantText("Hello"), `{"role":"assistant","content":"Hello"}`},
+		{
+			"image",
+			UserImage("https://example.com/cat.png", "What breed is this?"),
+			`{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}},{"type":"text","text":"What breed is this?"}]}`,
+		},
+		{
+			"data image",
+			UserParts(TextPart("Describe"), ImagePart(ImageDataURL("image/png", []byte("png")))),
+			`{"role":"user","content":[{"type":"text","text":"Describe"},{"type":"image_url","image_url":{"url":"data:image/png;base64,cG5n"}}]}`,
+		},
+		{
+			"tool calls",
+			AssistantToolCalls(weatherCall("call_1", "Paris")),
+			`{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`,
+		},
+		{"tool result", ToolResult("call_1", "sunny"), `{"role":"tool","content":"sunny","tool_call_id":"call_1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("json.Marshal() error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if got := messageText(UserImage("https://example.com/cat.png", "What breed is this?").Content); got != "What breed is this?" {
+		t.Errorf("messageText() = %q", got)
+	}
+}
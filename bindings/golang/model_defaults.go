@@ -0,0 +1,112 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides per-model default request parameters.
+package smg
+
+// ModelDefaults are parameters applied to the requests naming a model, set
+// with ClientConfig.ModelDefaults or MultiClientConfig.ModelDefaults. They
+// let one client serve several models, each with its own sampling policy;
+// the tokenizer of each model is chosen by TokenizerPaths.
+type ModelDefaults struct {
+	// Temperature, TopP, and MaxTokens are used by requests that do not set
+	// them. MaxTokens is the MaxCompletionTokens of chat requests and the
+	// MaxTokens of text completions.
+	Temperature *float32
+	TopP        *float32
+	MaxTokens   *int
+
+	// MaxTemperature, if set, caps the temperature of every request.
+	MaxTemperature *float32
+
+	// Stop and StopTokenIDs are added to those of every request.
+	Stop         []string
+	StopTokenIDs []int
+}
+
+// modelDefaults maps model names to their defaults
+type modelDefaults map[string]ModelDefaults
+
+// newModelDefaults copies the configured defaults, or returns nil if there
+// are none
+func newModelDefaults(config map[string]ModelDefaults) modelDefaults {
+	if len(config) == 0 {
+		return nil
+	}
+	m := make(modelDefaults, len(config))
+	for model, d := range config {
+		m[model] = d
+	}
+	return m
+}
+
+// applyChat applies the defaults of req's model to req
+func (m modelDefaults) applyChat(req *ChatCompletionRequest) {
+	d, ok := m[req.Model]
+	if !ok {
+		return
+	}
+	d.apply(&req.Temperature, &req.TopP, &req.MaxCompletionTokens, &req.Stop, &req.StopTokenIDs)
+}
+
+// applyCompletion applies the defaults of req's model to req
+func (m modelDefaults) applyCompletion(req *CompletionRequest) {
+	d, ok := m[req.Model]
+	if !ok {
+		return
+	}
+	d.apply(&req.Temperature, &req.TopP, &req.MaxTokens, &req.Stop, &req.StopTokenIDs)
+}
+
+// apply fills in and caps the parameters of a request. Values are replaced,
+// never written through, as they may be shared with the caller.
+func (d ModelDefaults) apply(temperature, topP **float32, maxTokens **int, stop *interface{}, stopTokenIDs *[]int) {
+	if *temperature == nil {
+		*temperature = d.Temperature
+	}
+	if d.MaxTemperature != nil && *temperature != nil && **temperature > *d.MaxTemperature {
+		*temperature = d.MaxTemperature
+	}
+	if *topP == nil {
+		*topP = d.TopP
+	}
+	if *maxTokens == nil {
+		*maxTokens = d.MaxTokens
+	}
+	if len(d.Stop) > 0 {
+		*stop = mergeStop(*stop, d.Stop)
+	}
+	if len(d.StopTokenIDs) > 0 {
+		*stopTokenIDs = append(append([]int(nil), *stopTokenIDs...), d.StopTokenIDs...)
+	}
+}
+
+// mergeStop returns the stop sequences of stop, a string or a list of
+// strings, followed by those of extra it does not already hold
+func mergeStop(stop interface{}, extra []string) interface{} {
+	var merged []string
+	switch s := stop.(type) {
+	case string:
+		merged = append(merged, s)
+	case []string:
+		merged = append(merged, s...)
+	case []interface{}:
+		for _, v := range s {
+			if str, ok := v.(string); ok {
+				merged = append(merged, str)
+			}
+		}
+	}
+	for _, e := range extra {
+		found := false
+		for _, s := range merged {
+			if s == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,42 @@
+package smg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestModelDefaults tests filling in, capping, and merging parameters
+func TestModelDefaults(t *testing.T) {
+	temp, maxTemp, hot := float32(0.2), float32(1), float32(1.5)
+	maxTokens := 256
+	m := newModelDefaults(map[string]ModelDefaults{
+		"chat": {Temperature: &temp, MaxTemperature: &maxTemp, MaxTokens: &maxTokens, Stop: []string{"<|end|>"}, StopTokenIDs: []int{7}},
+	})
+
+	req := ChatCompletionRequest{Model: "chat", Stop: "###"}
+	m.applyChat(&req)
+	if *req.Temperature != temp || *req.MaxCompletionTokens != 256 || !reflect.DeepEqual(req.Stop, []string{"###", "<|end|>"}) || !reflect.DeepEqual(req.StopTokenIDs, []int{7}) {
+		t.Errorf("chat request = %+v", req)
+	}
+
+	ids := []int{1}
+	req = ChatCompletionRequest{Model: "chat", Temperature: &hot, StopTokenIDs: ids, Stop: []string{"<|end|>"}}
+	m.applyChat(&req)
+	if *req.Temperature != maxTemp || hot != 1.5 || !reflect.DeepEqual(req.Stop, []string{"<|end|>"}) || len(ids) != 1 || len(req.StopTokenIDs) != 2 {
+		t.Errorf("capped request = %+v, caller's values %v %v", req, hot, ids)
+	}
+
+	completion := CompletionRequest{Model: "chat"}
+	m.applyCompletion(&completion)
+	if *completion.MaxTokens != 256 {
+		t.Errorf("completion request = %+v", completion)
+	}
+
+	other := ChatCompletionRequest{Model: "other"}
+	m.applyChat(&other)
+	if other.Temperature != nil || other.Stop != nil {
+		t.Errorf("request for another model = %+v", other)
+	}
+	var none modelDefaults
+	none.applyChat(&other)
+}
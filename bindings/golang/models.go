@@ -0,0 +1,165 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides model discovery across workers.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
+)
+
+// ModelInfo describes a model served by a worker, as reported by the
+// worker's GetModelInfo RPC.
+type ModelInfo struct {
+	// ID is the name clients should use in requests: the served model name,
+	// or the model path when the worker does not report one.
+	ID string `json:"id"`
+
+	// Endpoint is the worker that reported the model. When several workers
+	// serve the same model, ListModels reports the first one.
+	Endpoint string `json:"endpoint"`
+
+	ModelPath        string   `json:"model_path"`
+	TokenizerPath    string   `json:"tokenizer_path"`
+	ServedModelName  string   `json:"served_model_name"`
+	IsGeneration     bool     `json:"is_generation"`
+	SupportsVision   bool     `json:"supports_vision"`
+	WeightVersion    string   `json:"weight_version"`
+	ModelType        string   `json:"model_type"`
+	Architectures    []string `json:"architectures"`
+	MaxContextLength int      `json:"max_context_length"`
+	VocabSize        int      `json:"vocab_size"`
+}
+
+func (m *ModelInfo) setID() {
+	m.ID = m.ServedModelName
+	if m.ID == "" {
+		m.ID = m.ModelPath
+	}
+}
+
+func modelInfoFromProto(endpoint string, resp *proto.GetModelInfoResponse) ModelInfo {
+	info := ModelInfo{
+		Endpoint:         endpoint,
+		ModelPath:        resp.GetModelPath(),
+		TokenizerPath:    resp.GetTokenizerPath(),
+		ServedModelName:  resp.GetServedModelName(),
+		IsGeneration:     resp.GetIsGeneration(),
+		SupportsVision:   resp.GetSupportsVision(),
+		WeightVersion:    resp.GetWeightVersion(),
+		ModelType:        resp.GetModelType(),
+		Architectures:    resp.GetArchitectures(),
+		MaxContextLength: int(resp.GetMaxContextLength()),
+		VocabSize:        int(resp.GetVocabSize()),
+	}
+	info.setID()
+	return info
+}
+
+// ListModels returns the model served by the worker.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if c.backend != nil {
+		return c.backend.ListModels(ctx)
+	}
+
+	c.mu.RLock()
+	grpcClient := c.grpcClient
+	c.mu.RUnlock()
+
+	if grpcClient == nil {
+		return nil, errors.New("gRPC client is closed")
+	}
+
+	resp, err := grpcClient.GetModelInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model info: %w", err)
+	}
+	return []ModelInfo{modelInfoFromProto(c.endpoint, resp)}, nil
+}
+
+// ListModels returns the distinct models served by the workers, in worker
+// order. Unreachable workers are skipped; an error is returned only if no
+// worker responds.
+//
+// The ctx deadline, if any, bounds each worker query; cancellation is not
+// otherwise observed.
+func (c *MultiClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	c.mu.RLock()
+	ffiClient := c.ffiClient
+	c.mu.RUnlock()
+
+	if ffiClient == nil {
+		return nil, errors.New("multi-worker client is closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timeoutMS, err := ffiTimeoutMS(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultJSON, err := ffiClient.ModelInfoJSON(timeoutMS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model info: %w", err)
+	}
+	return parseWorkerModelInfo(resultJSON)
+}
+
+// ffiTimeoutMS returns the time left before the ctx deadline in
+// milliseconds, for FFI calls that take a timeout, or 0 for their default
+// if ctx has no deadline
+func ffiTimeoutMS(ctx context.Context) (uint64, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+	return uint64(remaining.Milliseconds()) + 1, nil
+}
+
+// parseWorkerModelInfo decodes the per-worker model info returned by the FFI
+// layer and removes duplicate models.
+func parseWorkerModelInfo(resultJSON string) ([]ModelInfo, error) {
+	var entries []struct {
+		Endpoint string     `json:"endpoint"`
+		Info     *ModelInfo `json:"info"`
+		Error    string     `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse model info: %w", err)
+	}
+
+	var models []ModelInfo
+	var failures []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Info == nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", entry.Endpoint, entry.Error))
+			continue
+		}
+		info := *entry.Info
+		info.Endpoint = entry.Endpoint
+		info.setID()
+		if seen[info.ID] {
+			continue
+		}
+		seen[info.ID] = true
+		models = append(models, info)
+	}
+
+	if len(models) == 0 && len(failures) > 0 {
+		return nil, fmt.Errorf("no worker returned model info: %s", strings.Join(failures, "; "))
+	}
+	return models, nil
+}
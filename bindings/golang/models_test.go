@@ -0,0 +1,53 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestParseWorkerModelInfo tests deduplication and error handling of per-worker model info
+func TestParseWorkerModelInfo(t *testing.T) {
+	resultJSON := `[
+		{"endpoint": "grpc://a:1", "info": {"served_model_name": "llama", "model_path": "/m/llama", "max_context_length": 8192}},
+		{"endpoint": "grpc://b:1", "error": "connection refused"},
+		{"endpoint": "grpc://c:1", "info": {"served_model_name": "llama", "model_path": "/m/llama"}},
+		{"endpoint": "grpc://d:1", "info": {"model_path": "/m/qwen"}}
+	]`
+
+	models, err := parseWorkerModelInfo(resultJSON)
+	if err != nil {
+		t.Fatalf("parseWorkerModelInfo() error: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("parseWorkerModelInfo() returned %d models, want 2: %+v", len(models), models)
+	}
+	if models[0].ID != "llama" || models[0].Endpoint != "grpc://a:1" || models[0].MaxContextLength != 8192 {
+		t.Errorf("models[0] = %+v", models[0])
+	}
+	if models[1].ID != "/m/qwen" {
+		t.Errorf("models[1].ID = %q, want model path fallback", models[1].ID)
+	}
+
+	if _, err := parseWorkerModelInfo(`[{"endpoint": "grpc://a:1", "error": "down"}]`); err == nil {
+		t.Error("parseWorkerModelInfo() with no healthy workers should fail")
+	}
+}
+
+// TestFFITimeoutMS tests converting a context deadline to an FFI timeout
+func TestFFITimeoutMS(t *testing.T) {
+	if ms, err := ffiTimeoutMS(context.Background()); ms != 0 || err != nil {
+		t.Errorf("ffiTimeoutMS() without a deadline = %d, %v, want the default", ms, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if ms, err := ffiTimeoutMS(ctx); ms < 59000 || ms > 60001 || err != nil {
+		t.Errorf("ffiTimeoutMS() a minute before the deadline = %d, %v", ms, err)
+	}
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := ffiTimeoutMS(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ffiTimeoutMS() past the deadline = %v, want DeadlineExceeded", err)
+	}
+}
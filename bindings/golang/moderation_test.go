@@ -0,0 +1,77 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPromptModerator tests the moderation request, scoring, and bad output
+func TestPromptModerator(t *testing.T) {
+	client := &scriptedClient{contents: []string{
+		`{"spam": 0.9, "violence": 0.1}`,
+		`{"spam": 0.2}`,
+	}}
+	moderator, err := NewPromptModerator(client, PromptModeratorOptions{Model: "guard", Categories: []string{"spam", "violence"}})
+	if err != nil {
+		t.Fatalf("NewPromptModerator() error: %v", err)
+	}
+
+	result, err := moderator.Moderate(context.Background(), "Buy now!!!")
+	if err != nil {
+		t.Fatalf("Moderate() error: %v", err)
+	}
+	if !result.Flagged || len(result.Categories) != 1 || result.Categories[0] != "spam" || result.Scores["violence"] != 0.1 {
+		t.Errorf("Moderate() = %+v, want spam flagged", result)
+	}
+	req := client.requests[0]
+	if req.Model != "guard" || req.ResponseFormat == nil || req.ResponseFormat.JSONSchema.Name != "moderation" {
+		t.Errorf("request = %+v", req)
+	}
+	if system := req.Messages[0].Content.(string); !strings.Contains(system, "spam, violence") {
+		t.Errorf("system prompt = %q, want the categories", system)
+	}
+	if req.Messages[1].Content != "Buy now!!!" {
+		t.Errorf("user message = %v", req.Messages[1].Content)
+	}
+
+	if _, err := moderator.Moderate(context.Background(), "hello"); !errors.Is(err, ErrInvalidOutput) {
+		t.Errorf("Moderate(missing score) error = %v, want ErrInvalidOutput", err)
+	}
+	if _, err := NewPromptModerator(client, PromptModeratorOptions{}); err == nil {
+		t.Error("NewPromptModerator() without a model succeeded")
+	}
+}
+
+// TestClassifierModerator tests the moderations endpoint with the classifier's
+// flags and with a threshold
+func TestClassifierModerator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v1/moderations" || req["model"] != "omni" || req["input"] != "text" {
+			t.Errorf("request = %s %v", r.URL.Path, req)
+		}
+		fmt.Fprint(w, `{"results":[{"flagged":true,"categories":{"hate":false,"violence":true},"category_scores":{"hate":0.4,"violence":0.7}}]}`)
+	}))
+	defer server.Close()
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL + "/v1"})
+
+	result, err := NewClassifierModerator(client, ClassifierModeratorOptions{Model: "omni"}).Moderate(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("Moderate() error: %v", err)
+	}
+	if !result.Flagged || len(result.Categories) != 1 || result.Categories[0] != "violence" || result.Scores["hate"] != 0.4 {
+		t.Errorf("Moderate() = %+v, want violence flagged", result)
+	}
+
+	result, err = NewClassifierModerator(client, ClassifierModeratorOptions{Model: "omni", Threshold: 0.3}).Moderate(context.Background(), "text")
+	if err != nil || len(result.Categories) != 2 || result.Categories[0] != "hate" {
+		t.Errorf("Moderate(threshold) = %+v, %v, want both flagged", result, err)
+	}
+}
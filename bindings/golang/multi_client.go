@@ -9,8 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
 )
@@ -20,11 +20,20 @@ import (
 //
 // Thread-safe: All public methods are safe for concurrent use.
 type MultiClient struct {
-	endpoints     string
-	tokenizerPath string
-	policyName    string
-	ffiClient     *ffi.MultiWorkerClientHandle
-	mu            sync.RWMutex
+	endpoints      string
+	tokenizerPath  string
+	tokenizerPaths map[string]string
+	defaults       modelDefaults
+	strict         *strictDecoder
+	policyName     string
+	ffiClient      *ffi.MultiWorkerClientHandle
+	// admission limits the requests in flight; nil without limits
+	admission *admission
+	// reaper closes streams left unread; nil without StreamIdleTimeout
+	reaper *streamReaper
+	// tokenizers caches Go-side tokenizers keyed by path (see Tokenizer)
+	tokenizers map[string]*Tokenizer
+	mu         sync.RWMutex
 }
 
 // MultiClientConfig holds configuration for creating a new multi-worker client.
@@ -34,15 +43,71 @@ type MultiClientConfig struct {
 	// Required field. Each endpoint must include the scheme (grpc://) and port number.
 	Endpoints string
 
+	// Dialect is the gRPC protocol of the engine serving every endpoint,
+	// including workers added later. Defaults to DialectSGLang.
+	Dialect Dialect
+
 	// TokenizerPath is the path to the tokenizer directory containing
-	// tokenizer configuration files (e.g., tokenizer.json, vocab.json).
-	// Required field.
+	// tokenizer configuration files (e.g., tokenizer.json, vocab.json), or to
+	// a single tokenizer file: tokenizer.json, a tiktoken file (*.tiktoken,
+	// tiktoken.model), or a SentencePiece model (tokenizer.model).
+	// Required unless TokenizerPaths is set.
 	TokenizerPath string
 
+	// TokenizerPaths maps model names to tokenizer paths. A request whose Model
+	// matches a key uses that tokenizer; other requests use TokenizerPath.
+	TokenizerPaths map[string]string
+
+	// TokenizerPin, if set, is checked against the tokenizer at TokenizerPath.
+	// NewMultiClient fails with ErrTokenizerMismatch on mismatch.
+	TokenizerPin *TokenizerPin
+
+	// TokenizerPins maps model names from TokenizerPaths to the pin their
+	// tokenizer must match.
+	TokenizerPins map[string]TokenizerPin
+
+	// ModelDefaults maps model names to the default parameters of the
+	// requests naming them.
+	ModelDefaults map[string]ModelDefaults
+
+	// StrictDecoding, if set, reports response fields the SDK does not
+	// decode.
+	StrictDecoding *StrictDecoding
+
+	// ClientInfo identifies the client to the workers in the metadata of
+	// every request. If nil, the SDK's name and version are sent.
+	ClientInfo *ClientInfo
+
 	// PolicyName is the load balancing policy to use.
 	// Available policies: "round_robin", "random", "cache_aware"
 	// Defaults to "round_robin" if not specified.
 	PolicyName string
+
+	// MaxConcurrentRequests, if positive, bounds the chat and completion
+	// requests in flight, streams included until they end or are closed.
+	// Requests beyond it wait, and are admitted by Priority, most urgent
+	// first, then in arrival order.
+	MaxConcurrentRequests int
+
+	// MaxConcurrentBatchRequests, if positive, bounds the requests in
+	// flight with a priority below PriorityNormal, keeping the remaining
+	// capacity for interactive traffic so that batch jobs do not delay its
+	// first tokens.
+	MaxConcurrentBatchRequests int
+
+	// StreamIdleTimeout, if positive, closes streams with no activity for
+	// longer than it, so that a caller abandoning a stream without reading
+	// it to the end or closing it, or a backend that stops responding
+	// during a read, does not leak the worker request and its handle. A
+	// read starting or returning is activity, so the timeout must exceed
+	// the longest expected wait for a chunk, first chunk included. RecvJSON
+	// on a closed stream returns an error matching ErrStreamIdle.
+	StreamIdleTimeout time.Duration
+
+	// OnStreamIdle, if set, is called for each stream StreamIdleTimeout
+	// closes, with the request ID from its context and how long it was
+	// idle. Defaults to logging them.
+	OnStreamIdle func(requestID string, idle time.Duration)
 }
 
 // NewMultiClient creates a new multi-worker client with load balancing.
@@ -52,33 +117,84 @@ type MultiClientConfig struct {
 //
 // Returns an error if:
 // - Endpoints is empty
-// - TokenizerPath is empty
+// - Both TokenizerPath and TokenizerPaths are empty
 // - Connection to any worker fails
 // - Invalid policy name is specified
+// - Dialect is unknown
+// - A tokenizer does not match its pin (ErrTokenizerMismatch)
 func NewMultiClient(config MultiClientConfig) (*MultiClient, error) {
 	if config.Endpoints == "" {
 		return nil, errors.New("endpoints is required")
 	}
-	if config.TokenizerPath == "" {
+	if err := config.Dialect.validate(); err != nil {
+		return nil, err
+	}
+	if config.TokenizerPath == "" && len(config.TokenizerPaths) == 0 {
 		return nil, errors.New("tokenizer path is required")
 	}
+	for model, path := range config.TokenizerPaths {
+		if path == "" {
+			return nil, fmt.Errorf("tokenizer path for model %q is empty", model)
+		}
+	}
+	if err := validateTokenizerPins(config.TokenizerPath, config.TokenizerPin, config.TokenizerPaths, config.TokenizerPins); err != nil {
+		return nil, err
+	}
 
 	policyName := config.PolicyName
 	if policyName == "" {
 		policyName = "round_robin"
 	}
 
-	ffiClient, err := ffi.NewMultiWorkerClient(config.Endpoints, config.TokenizerPath, policyName)
+	tokenizerPaths := make(map[string]string, len(config.TokenizerPaths))
+	for model, path := range config.TokenizerPaths {
+		tokenizerPaths[model] = path
+	}
+
+	md, err := clientMetadata(config.ClientInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	ffiClient, err := ffi.NewMultiWorkerClient(config.Endpoints, config.TokenizerPath, tokenizerPaths, md, policyName, string(config.Dialect))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create multi-worker client: %w", err)
 	}
 
-	return &MultiClient{
-		endpoints:     config.Endpoints,
-		tokenizerPath: config.TokenizerPath,
-		policyName:    policyName,
-		ffiClient:     ffiClient,
-	}, nil
+	client := &MultiClient{
+		endpoints:      config.Endpoints,
+		tokenizerPath:  config.TokenizerPath,
+		tokenizerPaths: tokenizerPaths,
+		defaults:       newModelDefaults(config.ModelDefaults),
+		strict:         newStrictDecoder(config.StrictDecoding),
+		policyName:     policyName,
+		ffiClient:      ffiClient,
+		admission:      newAdmission(config.MaxConcurrentRequests, config.MaxConcurrentBatchRequests),
+		reaper:         newStreamReaper(config.StreamIdleTimeout, config.OnStreamIdle),
+	}
+
+	if config.TokenizerPin != nil || len(config.TokenizerPins) > 0 {
+		// Workers load tokenizers lazily; load pinned ones now so model IDs
+		// are downloaded before their pins are checked.
+		if config.TokenizerPin != nil {
+			if _, err := client.Tokenizer(""); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+		for model := range config.TokenizerPins {
+			if _, err := client.Tokenizer(model); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+		if err := verifyTokenizerPins(config.TokenizerPath, config.TokenizerPin, tokenizerPaths, config.TokenizerPins); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
 }
 
 // Close closes the client and releases all resources.
@@ -89,10 +205,15 @@ func (c *MultiClient) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.reaper.close()
 	if c.ffiClient != nil {
 		c.ffiClient.Free()
 		c.ffiClient = nil
 	}
+	for _, tok := range c.tokenizers {
+		tok.Close()
+	}
+	c.tokenizers = nil
 	return nil
 }
 
@@ -151,6 +272,7 @@ func (c *MultiClient) PolicyName() string {
 func (c *MultiClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	// For non-streaming, we'll collect all chunks and return the final response
 	req.Stream = true
+	req.StreamOptions = withUsage()
 
 	if len(req.Tools) == 0 {
 		req.Tools = nil
@@ -161,97 +283,37 @@ func (c *MultiClient) CreateChatCompletion(ctx context.Context, req ChatCompleti
 		return nil, err
 	}
 	defer stream.Close()
+	return collectChatCompletion(stream)
+}
 
-	var fullContent strings.Builder
-	var fullToolCalls []ToolCall
-	var finishReason string
-	var usage Usage
-	var responseID string
-	var created int64
-	var model string
-	var systemFingerprint string
-
-	for {
-		chunkJSON, err := stream.RecvJSON()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		var chunk ChatCompletionStreamResponse
-		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
-			return nil, fmt.Errorf("failed to parse chunk: %w", err)
-		}
-
-		if chunk.ID != "" {
-			responseID = chunk.ID
-		}
-		if chunk.Created > 0 {
-			created = chunk.Created
-		}
-		if chunk.Model != "" {
-			model = chunk.Model
-		}
-		if chunk.SystemFingerprint != "" {
-			systemFingerprint = chunk.SystemFingerprint
-		}
-
-		for _, choice := range chunk.Choices {
-			if choice.Delta.Content != "" {
-				fullContent.WriteString(choice.Delta.Content)
-			}
-			if len(choice.Delta.ToolCalls) > 0 {
-				fullToolCalls = append(fullToolCalls, choice.Delta.ToolCalls...)
-			}
-			if choice.FinishReason != "" {
-				finishReason = choice.FinishReason
-			}
-		}
-
-		if chunk.Usage != nil {
-			usage = *chunk.Usage
-		}
-	}
-
-	message := Message{
-		Role:    "assistant",
-		Content: fullContent.String(),
-	}
-	if len(fullToolCalls) > 0 {
-		message.ToolCalls = fullToolCalls
-	}
-
-	if finishReason == "" {
-		finishReason = "stop"
-	}
-
-	return &ChatCompletionResponse{
-		ID:                responseID,
-		Object:            "chat.completion",
-		Created:           created,
-		Model:             model,
-		SystemFingerprint: systemFingerprint,
-		Choices: []Choice{
-			{
-				Index:        0,
-				Message:      message,
-				FinishReason: finishReason,
-			},
-		},
-		Usage: usage,
-	}, nil
+// streamHandle is the FFI stream a MultiClientStream reads, an
+// *ffi.SglangStreamHandle outside of tests
+type streamHandle interface {
+	ReadNext() (string, bool, error)
+	Abort()
+	Free()
 }
 
 // MultiClientStream represents a streaming chat completion from a multi-worker client
 type MultiClientStream struct {
-	ffiStream *ffi.SglangStreamHandle
+	ffiStream streamHandle
 	ctx       context.Context
 	cancel    context.CancelFunc
+	usage     usageFilter
+	seq       sequencer
+	strict    *strictDecoder
+	// release frees the request's admission slot
+	release func()
 }
 
+// RecvJSON returns the next chunk as JSON, or io.EOF when the stream is
+// done. Chunks are numbered in sequence_number; concurrent calls are
+// serialized.
 func (s *MultiClientStream) RecvJSON() (string, error) {
+	return s.seq.next(func() (string, error) { return s.usage.next(s.recv) })
+}
+
+func (s *MultiClientStream) recv() (string, error) {
 	// Check context first
 	select {
 	case <-s.ctx.Done():
@@ -261,30 +323,60 @@ func (s *MultiClientStream) RecvJSON() (string, error) {
 
 	responseJSON, isDone, err := s.ffiStream.ReadNext()
 	if err != nil {
+		s.releaseSlot()
 		return "", err
 	}
 	if isDone {
+		s.releaseSlot()
 		return "", io.EOF
 	}
-	return responseJSON, nil
+	return responseJSON, s.strict.check([]byte(responseJSON), ChatCompletionStreamResponse{})
 }
 
-// Close closes the stream and cancels any pending operations.
+// Close closes the stream and cancels any pending operations. It may be
+// called while RecvJSON is blocked, which then returns an error: the
+// generation is aborted, and the handle freed once the read has returned.
 func (s *MultiClientStream) Close() error {
 	if s.cancel != nil {
 		s.cancel()
 	}
 	if s.ffiStream != nil {
+		s.ffiStream.Abort()
 		s.ffiStream.Free()
-		s.ffiStream = nil
 	}
+	s.releaseSlot()
 	return nil
 }
 
+// newMultiClientStream returns a stream reading ffiStream, which is aborted
+// when ctx is done so that a read blocked on the worker returns
+func newMultiClientStream(ctx context.Context, ffiStream streamHandle, release func(), usage usageFilter, strict *strictDecoder) *MultiClientStream {
+	streamCtx, cancel := context.WithCancel(ctx)
+	context.AfterFunc(streamCtx, ffiStream.Abort)
+	return &MultiClientStream{
+		ffiStream: ffiStream,
+		ctx:       streamCtx,
+		cancel:    cancel,
+		release:   release,
+		usage:     usage,
+		strict:    strict,
+	}
+}
+
+func (s *MultiClientStream) releaseSlot() {
+	if s.release != nil {
+		s.release()
+	}
+}
+
 // CreateChatCompletionStream creates a streaming chat completion with load balancing.
 //
 // The request is routed to a healthy worker using the configured load balancing policy.
-func (c *MultiClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*MultiClientStream, error) {
+func (c *MultiClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	c.defaults.applyChat(&req)
+	if err := validateChatRequest(req); err != nil {
+		return nil, err
+	}
 	c.mu.RLock()
 	ffiClient := c.ffiClient
 	c.mu.RUnlock()
@@ -312,15 +404,17 @@ func (c *MultiClient) CreateChatCompletionStream(ctx context.Context, req ChatCo
 		return nil, fmt.Errorf("failed to marshal request map to JSON: %w", err)
 	}
 
-	ffiStream, err := ffiClient.ChatCompletionStream(string(reqJSON))
+	release, err := c.admission.acquire(ctx, req.Priority)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stream: %w", err)
+		return nil, err
 	}
+	ffiStream, err := ffiClient.ChatCompletionStreamBytes(reqJSON, RequestIDFromContext(ctx))
+	if err != nil {
+		release()
+		return nil, classify(fmt.Errorf("failed to create stream: %w", err))
+	}
+	observeWorker(ctx, ffiStream.WorkerEndpoint())
 
-	streamCtx, cancel := context.WithCancel(ctx)
-	return &MultiClientStream{
-		ffiStream: ffiStream,
-		ctx:       streamCtx,
-		cancel:    cancel,
-	}, nil
+	stream := newMultiClientStream(ctx, ffiStream, release, usageFilter{include: includeUsage(req.StreamOptions)}, c.strict)
+	return c.reaper.track(ctx, stream), nil
 }
@@ -0,0 +1,378 @@
+// Package ollama converts between the Ollama API format and SMG chat
+// completions, so that tooling that only speaks Ollama can use SMG workers:
+//
+//	var req ollama.ChatRequest
+//	json.Unmarshal(body, &req)
+//	chatReq, err := ollama.ConvertChatRequest(req)
+//	...
+//	resp, err := client.CreateChatCompletion(ctx, chatReq)
+//	...
+//	json.Marshal(ollama.ChatResponseFrom(resp, time.Since(start)))
+//
+// Streams, which Ollama sends as newline-delimited JSON, are converted chunk
+// by chunk with a StreamConverter. The smghttp handler serves /api/chat,
+// /api/generate, and /api/tags with this package when Options.Ollama is set.
+package ollama
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// ChatRequest is an /api/chat request. Fields the chat completion API has no
+// equivalent for, such as keep_alive, are not decoded.
+type ChatRequest struct {
+	Model    string     `json:"model"`
+	Messages []Message  `json:"messages"`
+	Tools    []smg.Tool `json:"tools,omitempty"`
+	// Format is "json" or a JSON schema the reply must match
+	Format  json.RawMessage `json:"format,omitempty"`
+	Options *Options        `json:"options,omitempty"`
+	// Stream defaults to true
+	Stream *bool `json:"stream,omitempty"`
+}
+
+// Streaming reports whether the reply is streamed, which is the default.
+func (r ChatRequest) Streaming() bool {
+	return r.Stream == nil || *r.Stream
+}
+
+// GenerateRequest is an /api/generate request.
+type GenerateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	System string `json:"system,omitempty"`
+	// Images are base64-encoded images shown with the prompt
+	Images []string        `json:"images,omitempty"`
+	Format json.RawMessage `json:"format,omitempty"`
+	// Raw sends the prompt without a template, which needs a completion
+	// backend; Suffix asks for fill-in-the-middle. Both are rejected.
+	Raw     bool     `json:"raw,omitempty"`
+	Suffix  string   `json:"suffix,omitempty"`
+	Options *Options `json:"options,omitempty"`
+	// Stream defaults to true
+	Stream *bool `json:"stream,omitempty"`
+}
+
+// Streaming reports whether the reply is streamed, which is the default.
+func (r GenerateRequest) Streaming() bool {
+	return r.Stream == nil || *r.Stream
+}
+
+// Message is a message of an /api/chat conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Thinking is the model's reasoning, when the backend separates it
+	Thinking string `json:"thinking,omitempty"`
+	// Images are base64-encoded images, in user messages
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the function a "tool" message answers
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// ToolCall is a function call made by the model. Ollama's calls have no
+// IDs; the arguments are an object.
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the function and arguments of a ToolCall.
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// Options are the model options of a request. Options without a chat
+// completion equivalent, such as num_ctx, are not decoded.
+type Options struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`
+	MinP             *float32 `json:"min_p,omitempty"`
+	NumPredict       *int     `json:"num_predict,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	RepeatPenalty    *float32 `json:"repeat_penalty,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+}
+
+// Metrics are the statistics of a finished reply.
+type Metrics struct {
+	TotalDuration   time.Duration `json:"total_duration,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+}
+
+// ChatResponse is an /api/chat response, or a line of a stream of them.
+type ChatResponse struct {
+	Model      string    `json:"model"`
+	CreatedAt  time.Time `json:"created_at"`
+	Message    Message   `json:"message"`
+	Done       bool      `json:"done"`
+	DoneReason string    `json:"done_reason,omitempty"`
+	Metrics
+}
+
+// GenerateResponse is an /api/generate response, or a line of a stream of
+// them.
+type GenerateResponse struct {
+	Model      string    `json:"model"`
+	CreatedAt  time.Time `json:"created_at"`
+	Response   string    `json:"response"`
+	Thinking   string    `json:"thinking,omitempty"`
+	Done       bool      `json:"done"`
+	DoneReason string    `json:"done_reason,omitempty"`
+	Metrics
+}
+
+// ConvertChatRequest converts an /api/chat request to a chat completion
+// request. Images become image parts, and tool calls, which Ollama does not
+// identify, are given IDs that the following "tool" messages answer in
+// order, or by ToolName. Invalid requests return an error matching
+// smg.ErrInvalidRequest.
+func ConvertChatRequest(req ChatRequest) (smg.ChatCompletionRequest, error) {
+	if len(req.Messages) == 0 {
+		return smg.ChatCompletionRequest{}, invalid("messages must not be empty")
+	}
+	chatReq, err := baseRequest(req.Model, req.Options, req.Format, req.Streaming())
+	if err != nil {
+		return smg.ChatCompletionRequest{}, err
+	}
+	chatReq.Tools = req.Tools
+
+	// pending are the IDs of the unanswered calls, with their names
+	type call struct{ id, name string }
+	var pending []call
+	calls := 0
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "user":
+			chatMsg, err := userMessage(msg.Role, msg.Content, msg.Images)
+			if err != nil {
+				return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("messages[%d]: %v", i, err))
+			}
+			chatReq.Messages = append(chatReq.Messages, chatMsg)
+		case "assistant":
+			chatMsg := smg.AssistantText(msg.Content)
+			chatMsg.ReasoningContent = msg.Thinking
+			for _, tc := range msg.ToolCalls {
+				calls++
+				id := fmt.Sprintf("call_%d", calls)
+				args, err := json.Marshal(tc.Function.Arguments)
+				if err != nil || tc.Function.Arguments == nil {
+					args = []byte("{}")
+				}
+				chatMsg.ToolCalls = append(chatMsg.ToolCalls, smg.ToolCall{
+					ID:       id,
+					Type:     "function",
+					Function: smg.FunctionCall{Name: tc.Function.Name, Arguments: string(args)},
+				})
+				pending = append(pending, call{id, tc.Function.Name})
+			}
+			chatReq.Messages = append(chatReq.Messages, chatMsg)
+		case "tool":
+			if len(pending) == 0 {
+				return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("messages[%d]: tool message without a tool call", i))
+			}
+			answered := 0
+			for j, c := range pending {
+				if c.name == msg.ToolName {
+					answered = j
+					break
+				}
+			}
+			chatReq.Messages = append(chatReq.Messages, smg.ToolResult(pending[answered].id, msg.Content))
+			pending = append(pending[:answered:answered], pending[answered+1:]...)
+		default:
+			return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("messages[%d]: unsupported role %q", i, msg.Role))
+		}
+	}
+	return chatReq, nil
+}
+
+// ConvertGenerateRequest converts an /api/generate request to a chat
+// completion request with the system prompt, if any, and the prompt as a
+// user message.
+func ConvertGenerateRequest(req GenerateRequest) (smg.ChatCompletionRequest, error) {
+	if req.Raw {
+		return smg.ChatCompletionRequest{}, invalid("raw prompts are not supported")
+	}
+	if req.Suffix != "" {
+		return smg.ChatCompletionRequest{}, invalid("suffix is not supported")
+	}
+	chatReq, err := baseRequest(req.Model, req.Options, req.Format, req.Streaming())
+	if err != nil {
+		return smg.ChatCompletionRequest{}, err
+	}
+	if req.System != "" {
+		chatReq.Messages = append(chatReq.Messages, smg.SystemText(req.System))
+	}
+	msg, err := userMessage("user", req.Prompt, req.Images)
+	if err != nil {
+		return smg.ChatCompletionRequest{}, invalid(err.Error())
+	}
+	chatReq.Messages = append(chatReq.Messages, msg)
+	return chatReq, nil
+}
+
+// baseRequest returns a chat completion request with the options and format
+// of a request
+func baseRequest(model string, opts *Options, format json.RawMessage, stream bool) (smg.ChatCompletionRequest, error) {
+	chatReq := smg.ChatCompletionRequest{Model: model, Stream: stream}
+	if stream {
+		// The final line reports the token counts
+		includeUsage := true
+		chatReq.StreamOptions = &smg.StreamOptions{IncludeUsage: &includeUsage}
+	}
+	if opts != nil {
+		chatReq.Temperature = opts.Temperature
+		chatReq.TopP = opts.TopP
+		chatReq.TopK = opts.TopK
+		chatReq.MinP = opts.MinP
+		chatReq.MaxCompletionTokens = opts.NumPredict
+		chatReq.Seed = opts.Seed
+		chatReq.RepetitionPenalty = opts.RepeatPenalty
+		chatReq.PresencePenalty = opts.PresencePenalty
+		chatReq.FrequencyPenalty = opts.FrequencyPenalty
+		if len(opts.Stop) > 0 {
+			chatReq.Stop = opts.Stop
+		}
+		// A negative num_predict means no limit
+		if opts.NumPredict != nil && *opts.NumPredict < 0 {
+			chatReq.MaxCompletionTokens = nil
+		}
+	}
+
+	var f interface{}
+	if len(format) > 0 {
+		if err := json.Unmarshal(format, &f); err != nil {
+			return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("invalid format: %v", err))
+		}
+	}
+	switch f := f.(type) {
+	case nil:
+	case string:
+		if f != "json" {
+			return smg.ChatCompletionRequest{}, invalid(fmt.Sprintf("format must be \"json\" or a JSON schema, got %q", f))
+		}
+		chatReq.ResponseFormat = &smg.ResponseFormat{Type: "json_object"}
+	case map[string]interface{}:
+		chatReq.ResponseFormat = &smg.ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &smg.JSONSchema{Name: "response", Schema: f},
+		}
+	default:
+		return smg.ChatCompletionRequest{}, invalid("format must be \"json\" or a JSON schema")
+	}
+	return chatReq, nil
+}
+
+// userMessage returns a user or system message with the text and base64
+// images
+func userMessage(role, text string, images []string) (smg.ChatMessage, error) {
+	if len(images) == 0 {
+		return smg.ChatMessage{Role: role, Content: text}, nil
+	}
+	if role != "user" {
+		return smg.ChatMessage{}, fmt.Errorf("images are only supported in user messages")
+	}
+	var parts []smg.ContentPart
+	for i, image := range images {
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return smg.ChatMessage{}, fmt.Errorf("images[%d]: %v", i, err)
+		}
+		parts = append(parts, smg.ImagePart(smg.ImageDataURL(http.DetectContentType(data), data)))
+	}
+	if text != "" {
+		parts = append(parts, smg.TextPart(text))
+	}
+	return smg.UserParts(parts...), nil
+}
+
+// ChatResponseFrom converts a chat completion to an /api/chat response.
+// elapsed is reported as the total duration.
+func ChatResponseFrom(resp *smg.ChatCompletionResponse, elapsed time.Duration) *ChatResponse {
+	out := &ChatResponse{
+		Model:     resp.Model,
+		CreatedAt: time.Now().UTC(),
+		Message:   Message{Role: "assistant"},
+		Done:      true,
+		Metrics: Metrics{
+			TotalDuration:   elapsed,
+			PromptEvalCount: resp.Usage.PromptTokens,
+			EvalCount:       resp.Usage.CompletionTokens,
+		},
+		DoneReason: "stop",
+	}
+	if len(resp.Choices) == 0 {
+		return out
+	}
+	choice := resp.Choices[0]
+	out.Message.Content = choice.Message.Content
+	out.Message.Thinking = choice.Message.ReasoningContent
+	for _, call := range choice.Message.ToolCalls {
+		out.Message.ToolCalls = append(out.Message.ToolCalls, toolCall(call.Function.Name, call.Function.Arguments))
+	}
+	out.DoneReason = DoneReason(choice.FinishReason)
+	return out
+}
+
+// GenerateResponseFrom converts a chat completion to an /api/generate
+// response.
+func GenerateResponseFrom(resp *smg.ChatCompletionResponse, elapsed time.Duration) *GenerateResponse {
+	out := GenerateResponseFromChat(*ChatResponseFrom(resp, elapsed))
+	return &out
+}
+
+// GenerateResponseFromChat converts an /api/chat response, or stream line, to
+// the /api/generate equivalent. Tool calls are dropped.
+func GenerateResponseFromChat(resp ChatResponse) GenerateResponse {
+	return GenerateResponse{
+		Model:      resp.Model,
+		CreatedAt:  resp.CreatedAt,
+		Response:   resp.Message.Content,
+		Thinking:   resp.Message.Thinking,
+		Done:       resp.Done,
+		DoneReason: resp.DoneReason,
+		Metrics:    resp.Metrics,
+	}
+}
+
+// DoneReason converts a chat completion finish reason to an Ollama done
+// reason: "length" when the token limit was reached and "stop" otherwise,
+// including for tool calls.
+func DoneReason(finishReason smg.FinishReason) string {
+	if finishReason.IsTruncated() {
+		return "length"
+	}
+	return "stop"
+}
+
+// ErrorBody is the body of an Ollama error response, which is also sent as
+// the last line of a failed stream.
+type ErrorBody struct {
+	Error string `json:"error"`
+}
+
+// toolCall returns an Ollama tool call; arguments that are not a JSON object
+// become an empty object
+func toolCall(name, arguments string) ToolCall {
+	var args map[string]interface{}
+	if json.Unmarshal([]byte(arguments), &args) != nil || args == nil {
+		args = map[string]interface{}{}
+	}
+	return ToolCall{Function: ToolCallFunction{Name: name, Arguments: args}}
+}
+
+func invalid(message string) error {
+	return fmt.Errorf("%w: %s", smg.ErrInvalidRequest, message)
+}
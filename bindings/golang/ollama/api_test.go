@@ -0,0 +1,107 @@
+package ollama
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// TestConvertChatRequest tests options, format, images, and the IDs given
+// to tool calls and their results
+func TestConvertChatRequest(t *testing.T) {
+	var req ChatRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "llama3",
+		"format": {"type": "object"},
+		"options": {"temperature": 0.2, "num_predict": 64, "repeat_penalty": 1.1, "stop": ["END"]},
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Weather and time?", "images": ["iVBORw0KGgo="]},
+			{"role": "assistant", "content": "", "tool_calls": [
+				{"function": {"name": "weather", "arguments": {"city": "Paris"}}},
+				{"function": {"name": "time", "arguments": {}}}
+			]},
+			{"role": "tool", "content": "12:00", "tool_name": "time"},
+			{"role": "tool", "content": "sunny"}
+		]
+	}`), &req)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	chatReq, err := ConvertChatRequest(req)
+	if err != nil {
+		t.Fatalf("ConvertChatRequest error: %v", err)
+	}
+	if !chatReq.Stream || chatReq.StreamOptions == nil || !*chatReq.StreamOptions.IncludeUsage {
+		t.Errorf("stream = %v, %+v; want streaming with usage by default", chatReq.Stream, chatReq.StreamOptions)
+	}
+	if *chatReq.Temperature != 0.2 || *chatReq.MaxCompletionTokens != 64 || *chatReq.RepetitionPenalty != 1.1 {
+		t.Errorf("options = %v, %v, %v", *chatReq.Temperature, *chatReq.MaxCompletionTokens, *chatReq.RepetitionPenalty)
+	}
+	if f := chatReq.ResponseFormat; f == nil || f.Type != "json_schema" || f.JSONSchema.Schema["type"] != "object" {
+		t.Errorf("ResponseFormat = %+v, want the schema", f)
+	}
+
+	msgs := chatReq.Messages
+	if len(msgs) != 5 {
+		t.Fatalf("got %d messages, want 5", len(msgs))
+	}
+	parts, ok := msgs[1].Content.([]smg.ContentPart)
+	if !ok || len(parts) != 2 || parts[0].ImageURL.URL != "data:image/png;base64,iVBORw0KGgo=" || parts[1].Text != "Weather and time?" {
+		t.Errorf("user content = %+v, want a PNG image and the text", msgs[1].Content)
+	}
+	calls := msgs[2].ToolCalls
+	if len(calls) != 2 || calls[0].ID != "call_1" || calls[0].Function.Arguments != `{"city":"Paris"}` || calls[1].ID != "call_2" {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if msgs[3].ToolCallID != "call_2" || msgs[4].ToolCallID != "call_1" {
+		t.Errorf("tool results answer %q and %q, want call_2 by name and then call_1", msgs[3].ToolCallID, msgs[4].ToolCallID)
+	}
+}
+
+// TestConvertRequestErrors tests that unsupported requests are invalid
+func TestConvertRequestErrors(t *testing.T) {
+	for name, body := range map[string]string{
+		"no messages":     `{"model":"m"}`,
+		"role":            `{"model":"m","messages":[{"role":"critic","content":"x"}]}`,
+		"unanswered tool": `{"model":"m","messages":[{"role":"tool","content":"x"}]}`,
+		"format":          `{"model":"m","format":"yaml","messages":[{"role":"user","content":"x"}]}`,
+		"image encoding":  `{"model":"m","messages":[{"role":"user","content":"x","images":["not base64!"]}]}`,
+		"system image":    `{"model":"m","messages":[{"role":"system","content":"x","images":["iVBORw0KGgo="]}]}`,
+	} {
+		var req ChatRequest
+		json.Unmarshal([]byte(body), &req)
+		if _, err := ConvertChatRequest(req); !errors.Is(err, smg.ErrInvalidRequest) {
+			t.Errorf("%s: error = %v, want ErrInvalidRequest", name, err)
+		}
+	}
+	for _, req := range []GenerateRequest{{Prompt: "x", Raw: true}, {Prompt: "x", Suffix: "y"}} {
+		if _, err := ConvertGenerateRequest(req); !errors.Is(err, smg.ErrInvalidRequest) {
+			t.Errorf("ConvertGenerateRequest(%+v) error = %v, want ErrInvalidRequest", req, err)
+		}
+	}
+}
+
+// TestGenerate tests a non-streaming generate round trip
+func TestGenerate(t *testing.T) {
+	stream := false
+	chatReq, err := ConvertGenerateRequest(GenerateRequest{Model: "m", System: "Be brief.", Prompt: "Hi", Format: json.RawMessage(`"json"`), Stream: &stream})
+	if err != nil {
+		t.Fatalf("ConvertGenerateRequest error: %v", err)
+	}
+	if chatReq.Stream || len(chatReq.Messages) != 2 || chatReq.Messages[1].Content != "Hi" || chatReq.ResponseFormat.Type != "json_object" {
+		t.Errorf("request = %+v", chatReq)
+	}
+
+	resp := GenerateResponseFrom(&smg.ChatCompletionResponse{
+		Model:   "m",
+		Choices: []smg.Choice{{Message: smg.Message{Content: "{}"}, FinishReason: "length"}},
+		Usage:   smg.Usage{PromptTokens: 7, CompletionTokens: 2},
+	}, time.Second)
+	if resp.Response != "{}" || !resp.Done || resp.DoneReason != "length" || resp.PromptEvalCount != 7 || resp.EvalCount != 2 || resp.TotalDuration != time.Second {
+		t.Errorf("response = %+v", resp)
+	}
+}
@@ -0,0 +1,129 @@
+package ollama
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// streamChunk is the part of a chat completion stream chunk that lines are
+// built from
+type streamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []struct {
+				Index    int `json:"index"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason smg.FinishReason `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *smg.Usage `json:"usage"`
+}
+
+// StreamConverter converts the chunks of a chat completion stream to
+// /api/chat stream lines. Content and thinking are sent as they arrive;
+// tool calls, which Ollama sends whole, are collected and sent in one line
+// once the stream ends. Feed it every chunk with Chunk, then call Finish.
+// Use GenerateResponseFromChat for /api/generate lines.
+//
+// Streams need usage (see smg.StreamOptions) for the final line to report
+// token counts; ConvertChatRequest asks for it.
+type StreamConverter struct {
+	model   string
+	started time.Time
+	// calls are the tool calls so far, by index
+	calls        map[int]*smg.ToolCall
+	finishReason smg.FinishReason
+	usage        smg.Usage
+}
+
+// NewStreamConverter returns a converter for one stream, which reports the
+// time since it was created as the total duration. model, if not empty, is
+// reported instead of the model named by the chunks.
+func NewStreamConverter(model string) *StreamConverter {
+	return &StreamConverter{model: model, started: time.Now(), calls: make(map[int]*smg.ToolCall)}
+}
+
+// Chunk returns the lines for one chunk, as returned by RecvJSON: one line
+// when the chunk has content or thinking, and none otherwise.
+func (c *StreamConverter) Chunk(chunkJSON string) ([]ChatResponse, error) {
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return nil, err
+	}
+	if c.model == "" {
+		c.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		c.usage = *chunk.Usage
+	}
+	var content, thinking strings.Builder
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		content.WriteString(choice.Delta.Content)
+		thinking.WriteString(choice.Delta.ReasoningContent)
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := c.calls[tc.Index]
+			if !ok {
+				call = &smg.ToolCall{}
+				c.calls[tc.Index] = call
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+		if choice.FinishReason != "" {
+			c.finishReason = choice.FinishReason
+		}
+	}
+	if content.Len() == 0 && thinking.Len() == 0 {
+		return nil, nil
+	}
+	return []ChatResponse{c.line(Message{Role: "assistant", Content: content.String(), Thinking: thinking.String()})}, nil
+}
+
+// Finish returns the lines ending the stream: the tool calls, if any, then
+// the final line with done set, the done reason, and the metrics.
+func (c *StreamConverter) Finish() []ChatResponse {
+	var lines []ChatResponse
+	if len(c.calls) > 0 {
+		indexes := make([]int, 0, len(c.calls))
+		for index := range c.calls {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		msg := Message{Role: "assistant"}
+		for _, index := range indexes {
+			call := c.calls[index]
+			msg.ToolCalls = append(msg.ToolCalls, toolCall(call.Function.Name, call.Function.Arguments))
+		}
+		lines = append(lines, c.line(msg))
+	}
+	final := c.line(Message{Role: "assistant"})
+	final.Done = true
+	final.DoneReason = DoneReason(c.finishReason)
+	final.Metrics = Metrics{
+		TotalDuration:   time.Since(c.started),
+		PromptEvalCount: c.usage.PromptTokens,
+		EvalCount:       c.usage.CompletionTokens,
+	}
+	return append(lines, final)
+}
+
+func (c *StreamConverter) line(msg Message) ChatResponse {
+	return ChatResponse{Model: c.model, CreatedAt: time.Now().UTC(), Message: msg}
+}
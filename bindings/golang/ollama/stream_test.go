@@ -0,0 +1,43 @@
+package ollama
+
+import "testing"
+
+// TestStreamConverter tests that content streams as it arrives and tool
+// calls are sent whole before the final line
+func TestStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"model":"m","choices":[{"delta":{"role":"assistant","reasoning_content":"Hmm."}}]}`,
+		`{"model":"m","choices":[{"delta":{"content":"Checking."}}]}`,
+		`{"model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"model":"m","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+	}
+	c := NewStreamConverter("alias")
+	var lines []ChatResponse
+	for _, chunk := range chunks {
+		ls, err := c.Chunk(chunk)
+		if err != nil {
+			t.Fatalf("Chunk(%s) error: %v", chunk, err)
+		}
+		lines = append(lines, ls...)
+	}
+	lines = append(lines, c.Finish()...)
+
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %+v", len(lines), lines)
+	}
+	if lines[0].Message.Thinking != "Hmm." || lines[1].Message.Content != "Checking." || lines[0].Done || lines[0].Model != "alias" {
+		t.Errorf("content lines = %+v", lines[:2])
+	}
+	calls := lines[2].Message.ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "weather" || calls[0].Function.Arguments["city"] != "Paris" || lines[2].Done {
+		t.Errorf("tool call line = %+v", lines[2])
+	}
+	final := lines[3]
+	if !final.Done || final.DoneReason != "stop" || final.PromptEvalCount != 10 || final.EvalCount != 5 || final.TotalDuration <= 0 {
+		t.Errorf("final line = %+v", final)
+	}
+	if _, err := c.Chunk("not json"); err == nil {
+		t.Error("Chunk(not json) succeeded, want error")
+	}
+}
@@ -0,0 +1,130 @@
+// Package openaicompat serves the OpenAI REST API in process from an SMG
+// client, so that applications written against the official openai-go SDK,
+// or any other OpenAI HTTP client, can switch to SMG gRPC workers by swapping
+// the HTTP client they are constructed with:
+//
+//	backend, err := smg.NewClient(smg.ClientConfig{Endpoint: "grpc://localhost:20000", TokenizerPath: "..."})
+//	...
+//	client := openai.NewClient(
+//	    option.WithBaseURL("http://smg/v1"),
+//	    option.WithHTTPClient(openaicompat.NewHTTPClient(backend)),
+//	)
+//
+// Requests never reach the network: the Transport passes each one to the
+// handler of package smghttp, which calls the SMG client and encodes the
+// result as the OpenAI server would, including server-sent events for
+// streams.
+package openaicompat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/smghttp"
+)
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport is an http.RoundTripper answering OpenAI API requests with an
+// SMG client. It serves the endpoints of smghttp.Handler under any base URL,
+// with its default options.
+type Transport struct {
+	handler http.Handler
+}
+
+// NewTransport returns a Transport serving requests with client, typically
+// an *smg.Client or *smg.MultiClient, possibly wrapped with middleware.
+func NewTransport(client smg.ChatClient) *Transport {
+	return &Transport{handler: smghttp.Handler(client, smghttp.Options{})}
+}
+
+// NewHTTPClient returns an HTTP client whose requests are served by
+// NewTransport(client), for openai-go's option.WithHTTPClient.
+func NewHTTPClient(client smg.ChatClient) *http.Client {
+	return &http.Client{Transport: NewTransport(client)}
+}
+
+// RoundTrip serves one request. It returns an error only when the request's
+// context is done; every other failure is an error response. The response
+// is returned once its header is written, and its body streams what the
+// handler writes after that; closing the body cancels the handler.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	pr, pw := io.Pipe()
+	w := &responseWriter{header: http.Header{}, body: pw, ready: make(chan struct{})}
+	go func() {
+		defer func() {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			w.WriteHeader(http.StatusOK)
+			pw.Close()
+		}()
+		t.handler.ServeHTTP(w, req.WithContext(ctx))
+	}()
+
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		cancel()
+		pr.Close()
+		return nil, req.Context().Err()
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(w.status) + " " + http.StatusText(w.status),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          &body{PipeReader: pr, cancel: cancel},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// responseWriter writes a handler's response body to a pipe
+type responseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+	once   sync.Once
+	ready  chan struct{}
+	// status and sent, the header as written, are set before ready is closed
+	status int
+	sent   http.Header
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status = status
+		w.sent = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// Flush is a no-op: each write is passed to the reader as it happens.
+func (w *responseWriter) Flush() {}
+
+// body is a response body that cancels the handler when closed
+type body struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (b *body) Close() error {
+	b.cancel()
+	return b.PipeReader.Close()
+}
@@ -0,0 +1,107 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/smgtest"
+)
+
+func post(t *testing.T, client *http.Client, path, body string) (*http.Response, string) {
+	t.Helper()
+	resp, err := client.Post("http://smg/v1"+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s error: %v", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s response: %v", path, err)
+	}
+	return resp, string(data)
+}
+
+// TestChatCompletion tests chat completions, streamed and not
+func TestChatCompletion(t *testing.T) {
+	mock := smgtest.NewMockClient(
+		smgtest.Reply{Content: "Paris"},
+		smgtest.Reply{Chunks: []string{"Ro", "me"}},
+		smgtest.Reply{Err: smg.ErrInvalidRequest},
+	)
+	client := NewHTTPClient(mock)
+
+	resp, body := post(t, client, "/chat/completions", `{"model":"m","max_tokens":5,"messages":[{"role":"user","content":"Capital of France?"}]}`)
+	var completion smg.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(body), &completion); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("response = %d %s", resp.StatusCode, body)
+	}
+	if completion.Choices[0].Message.Content != "Paris" {
+		t.Errorf("content = %q, want Paris", completion.Choices[0].Message.Content)
+	}
+	if req := mock.Requests()[0]; req.Model != "m" || *req.MaxCompletionTokens != 5 || req.Messages[0].Content != "Capital of France?" {
+		t.Errorf("request = %+v", req)
+	}
+
+	resp, body = post(t, client, "/chat/completions", `{"model":"m","stream":true,"messages":[{"role":"user","content":"Capital of Italy?"}]}`)
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	events := strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n")
+	if len(events) != 4 || events[3] != "data: [DONE]" {
+		t.Fatalf("events = %q", events)
+	}
+	var content string
+	for _, event := range events[:2] {
+		var chunk smg.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Fatalf("event %q: %v", event, err)
+		}
+		content += chunk.Choices[0].Delta.Content
+	}
+	if content != "Rome" {
+		t.Errorf("streamed content = %q, want Rome", content)
+	}
+
+	resp, body = post(t, client, "/chat/completions", `{"model":"m","messages":[]}`)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, `"type":"invalid_request_error"`) {
+		t.Errorf("invalid request response = %d %s", resp.StatusCode, body)
+	}
+	resp, _ = post(t, client, "/chat/completions", `{"model":"m","n":2,"messages":[]}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("n=2 response status = %d, want 400", resp.StatusCode)
+	}
+}
+
+// TestToolCalling tests a tool-calling exchange shaped like those of the
+// OpenAI providers of openai-go and LangChainGo
+func TestToolCalling(t *testing.T) {
+	call := smg.ToolCall{ID: "call_1", Type: "function", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}
+	mock := smgtest.NewMockClient(smgtest.Reply{ToolCalls: []smg.ToolCall{call}}, smgtest.Reply{Content: "Sunny"})
+	client := NewHTTPClient(mock)
+
+	tools := `"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`
+	_, body := post(t, client, "/chat/completions", `{"model":"m",`+tools+`,"messages":[{"role":"user","content":"Weather in Paris?"}]}`)
+	var completion smg.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(body), &completion); err != nil {
+		t.Fatalf("response %s: %v", body, err)
+	}
+	if choice := completion.Choices[0]; choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0] != call {
+		t.Errorf("choice = %+v, want the weather call", choice)
+	}
+	if req := mock.Requests()[0]; len(req.Tools) != 1 || req.Tools[0].Function.Name != "weather" {
+		t.Errorf("tools = %+v", req.Tools)
+	}
+
+	post(t, client, "/chat/completions", `{"model":"m",`+tools+`,"messages":[
+		{"role":"user","content":[{"type":"text","text":"Weather in Paris?"}]},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"}]}`)
+	messages := mock.Requests()[1].Messages
+	if len(messages) != 3 || messages[1].ToolCalls[0] != call || messages[2].ToolCallID != "call_1" {
+		t.Errorf("replayed messages = %+v", messages)
+	}
+}
@@ -0,0 +1,132 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides request priorities and the MultiClient's admission
+// control.
+package smg
+
+import (
+	"context"
+	"sync"
+)
+
+// Priority is the scheduling priority of a request; larger values are more
+// urgent. It is forwarded in the priority field of HTTP request bodies, as
+// SGLang and vLLM servers accept it, and orders admission to a MultiClient
+// with concurrency limits. The SGLang gRPC scheduler service has no priority
+// field, so gRPC workers schedule all requests alike.
+type Priority int
+
+// Common priorities. Requests below PriorityNormal count as batch traffic
+// for MultiClientConfig.MaxConcurrentBatchRequests.
+const (
+	PriorityBatch       Priority = -1
+	PriorityNormal      Priority = 0
+	PriorityInteractive Priority = 1
+)
+
+// admission limits the requests in flight, admitting waiting requests in
+// priority order and batch requests only up to their own limit. A limit of
+// zero is no limit.
+type admission struct {
+	limit      int
+	batchLimit int
+
+	mu          sync.Mutex
+	active      int
+	activeBatch int
+	// waiting is ordered by priority, then arrival
+	waiting []*admissionWaiter
+}
+
+type admissionWaiter struct {
+	priority Priority
+	admitted bool
+	ready    chan struct{}
+}
+
+// newAdmission returns the admission control for the limits, or nil if
+// there are none
+func newAdmission(limit, batchLimit int) *admission {
+	if limit <= 0 && batchLimit <= 0 {
+		return nil
+	}
+	return &admission{limit: limit, batchLimit: batchLimit}
+}
+
+// acquire waits until a request of priority p may be sent, and returns the
+// function releasing its slot, which may be called more than once. A nil
+// admission admits every request at once.
+func (a *admission) acquire(ctx context.Context, p Priority) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	w := &admissionWaiter{priority: p, ready: make(chan struct{})}
+	a.mu.Lock()
+	i := len(a.waiting)
+	for i > 0 && a.waiting[i-1].priority < p {
+		i--
+	}
+	a.waiting = append(a.waiting, nil)
+	copy(a.waiting[i+1:], a.waiting[i:])
+	a.waiting[i] = w
+	a.dispatch()
+	a.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			a.mu.Lock()
+			a.active--
+			if p < PriorityNormal {
+				a.activeBatch--
+			}
+			a.dispatch()
+			a.mu.Unlock()
+		})
+	}
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		a.mu.Lock()
+		admitted := w.admitted
+		if !admitted {
+			for i, waiter := range a.waiting {
+				if waiter == w {
+					a.waiting = append(a.waiting[:i], a.waiting[i+1:]...)
+					break
+				}
+			}
+			// A batch request leaving may unblock others behind it
+			a.dispatch()
+		}
+		a.mu.Unlock()
+		if admitted {
+			release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// dispatch admits the most urgent waiting requests that fit. Called with mu
+// held.
+func (a *admission) dispatch() {
+	for i := 0; i < len(a.waiting); {
+		if a.limit > 0 && a.active >= a.limit {
+			return
+		}
+		w := a.waiting[i]
+		batch := w.priority < PriorityNormal
+		if batch && a.batchLimit > 0 && a.activeBatch >= a.batchLimit {
+			i++
+			continue
+		}
+		a.waiting = append(a.waiting[:i], a.waiting[i+1:]...)
+		a.active++
+		if batch {
+			a.activeBatch++
+		}
+		w.admitted = true
+		close(w.ready)
+	}
+}
@@ -0,0 +1,104 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// admitted reports whether the acquisition in done finished within a short
+// wait
+func admitted(done <-chan func()) (func(), bool) {
+	select {
+	case release := <-done:
+		return release, true
+	case <-time.After(20 * time.Millisecond):
+		return nil, false
+	}
+}
+
+// acquireAsync acquires a slot for p in the background
+func acquireAsync(a *admission, p Priority) <-chan func() {
+	done := make(chan func(), 1)
+	go func() {
+		release, err := a.acquire(context.Background(), p)
+		if err == nil {
+			done <- release
+		}
+	}()
+	return done
+}
+
+// TestAdmissionPriority tests that waiting requests are admitted most
+// urgent first, and that batch requests are held to their own limit
+func TestAdmissionPriority(t *testing.T) {
+	a := newAdmission(2, 1)
+	batch, err := a.acquire(context.Background(), PriorityBatch)
+	if err != nil {
+		t.Fatalf("acquire error: %v", err)
+	}
+	secondBatch := acquireAsync(a, PriorityBatch)
+	if _, ok := admitted(secondBatch); ok {
+		t.Fatal("second batch request admitted beyond the batch limit")
+	}
+	interactive, ok := admitted(acquireAsync(a, PriorityInteractive))
+	if !ok {
+		t.Fatal("interactive request waited behind a batch request")
+	}
+
+	// Full: a normal request waits for a slot. Releasing twice frees one.
+	normal := acquireAsync(a, PriorityNormal)
+	if _, ok := admitted(normal); ok {
+		t.Fatal("normal request admitted beyond the limit")
+	}
+	interactive()
+	interactive()
+	release, ok := admitted(normal)
+	if !ok {
+		t.Fatal("normal request not admitted after a release")
+	}
+	late := acquireAsync(a, PriorityInteractive)
+	if _, ok := admitted(late); ok {
+		t.Fatal("request admitted beyond the limit after a double release")
+	}
+
+	// The interactive request that arrived last goes first
+	batch()
+	lateRelease, ok := admitted(late)
+	if !ok {
+		t.Fatal("interactive request not admitted after a release")
+	}
+	if _, ok := admitted(secondBatch); ok {
+		t.Fatal("batch request admitted before a more urgent one")
+	}
+	release()
+	if _, ok := admitted(secondBatch); !ok {
+		t.Fatal("second batch request not admitted after a release")
+	}
+	lateRelease()
+
+	if a := newAdmission(0, 0); a != nil {
+		t.Errorf("newAdmission(0, 0) = %+v, want nil", a)
+	}
+	var none *admission
+	if _, err := none.acquire(context.Background(), PriorityBatch); err != nil {
+		t.Errorf("acquire without limits error: %v", err)
+	}
+}
+
+// TestAdmissionCancel tests that a waiting request gives up with its
+// context and frees its place
+func TestAdmissionCancel(t *testing.T) {
+	a := newAdmission(1, 0)
+	release, _ := a.acquire(context.Background(), PriorityNormal)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.acquire(ctx, PriorityInteractive); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire error = %v, want DeadlineExceeded", err)
+	}
+	release()
+	if _, ok := admitted(acquireAsync(a, PriorityNormal)); !ok {
+		t.Error("request not admitted after a cancelled waiter and a release")
+	}
+}
@@ -0,0 +1,311 @@
+// Package prompt renders chat messages from text/template files, so that
+// prompts can live beside the code rather than in string concatenation.
+//
+// A template marks where each message starts with the role function and may
+// include few-shot examples and partials:
+//
+//	{{role "system"}}
+//	You are a support agent for {{.product}}.
+//	{{fewshot .examples}}
+//	{{role "user"}}
+//	{{template "question" .}}
+//
+// The variables a template reads from its data, including through partials
+// given the same data, are required: rendering without them fails. A
+// variable tested by {{if .name}} is optional within that if.
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// roles are the message roles a template may start
+var roles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+}
+
+// marker delimits messages in rendered output; it cannot appear in text
+// produced by variables, which have NUL bytes removed
+const marker = "\x00"
+
+// Example is a few-shot example: a user message and the assistant's answer.
+type Example struct {
+	User      string `json:"user" yaml:"user"`
+	Assistant string `json:"assistant" yaml:"assistant"`
+}
+
+// funcs are available to every template
+var funcs = template.FuncMap{
+	"role": func(role string) (string, error) {
+		if !roles[role] {
+			return "", fmt.Errorf("unknown role %q", role)
+		}
+		return marker + role + marker, nil
+	},
+	"fewshot": func(examples []Example) string {
+		var b strings.Builder
+		for _, ex := range examples {
+			b.WriteString(marker + "user" + marker + ex.User)
+			b.WriteString(marker + "assistant" + marker + ex.Assistant)
+		}
+		return b.String()
+	},
+}
+
+// Set is a group of templates that may include one another as partials.
+type Set struct {
+	tmpl *template.Template
+}
+
+// ParseFS parses the files in fsys matching patterns into a set. Each file's
+// templates are named by the file's base name and by any {{define}} it holds.
+func ParseFS(fsys fs.FS, patterns ...string) (*Set, error) {
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(fsys, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{tmpl: tmpl}, nil
+}
+
+// ParseFiles parses the named files into a set.
+func ParseFiles(filenames ...string) (*Set, error) {
+	tmpl, err := template.New("").Funcs(funcs).ParseFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{tmpl: tmpl}, nil
+}
+
+// Parse parses a single template from text.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(tmpl), nil
+}
+
+// Lookup returns the named template of the set, or nil if there is none.
+func (s *Set) Lookup(name string) *Template {
+	tmpl := s.tmpl.Lookup(name)
+	if tmpl == nil || tmpl.Tree == nil {
+		return nil
+	}
+	return newTemplate(tmpl)
+}
+
+// Template renders a list of messages.
+type Template struct {
+	tmpl     *template.Template
+	required []string
+}
+
+func newTemplate(tmpl *template.Template) *Template {
+	c := &varCollector{tmpl: tmpl, vars: map[string]bool{}, visiting: map[string]bool{}}
+	c.walk(tmpl.Tree.Root, true, map[string]bool{})
+	required := make([]string, 0, len(c.vars))
+	for name := range c.vars {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return &Template{tmpl: tmpl, required: required}
+}
+
+// Required returns the names of the variables the template reads, sorted.
+func (t *Template) Required() []string {
+	return append([]string(nil), t.required...)
+}
+
+// Validate reports the required variables missing from data.
+func (t *Template) Validate(data map[string]any) error {
+	var missing []string
+	for _, name := range t.required {
+		if _, ok := data[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("template %s: missing required variables: %s", t.tmpl.Name(), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Render executes the template with data and splits the output into
+// messages. Each message's content is trimmed of surrounding whitespace. A
+// template without role markers renders a single user message.
+func (t *Template) Render(data map[string]any) ([]smg.ChatMessage, error) {
+	if err := t.Validate(data); err != nil {
+		return nil, err
+	}
+
+	var out strings.Builder
+	if err := t.tmpl.Execute(&out, sanitize(data)); err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(out.String(), marker)
+	if len(parts) == 1 {
+		return []smg.ChatMessage{{Role: "user", Content: strings.TrimSpace(parts[0])}}, nil
+	}
+	if strings.TrimSpace(parts[0]) != "" {
+		return nil, fmt.Errorf("template %s: text before the first role", t.tmpl.Name())
+	}
+	messages := make([]smg.ChatMessage, 0, len(parts)/2)
+	for i := 1; i+1 < len(parts); i += 2 {
+		messages = append(messages, smg.ChatMessage{Role: parts[i], Content: strings.TrimSpace(parts[i+1])})
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("template rendered no messages")
+	}
+	return messages, nil
+}
+
+// sanitize removes NUL bytes from the strings in data so that variables
+// cannot forge message boundaries
+func sanitize(v any) any {
+	switch v := v.(type) {
+	case string:
+		return strings.ReplaceAll(v, marker, "")
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = sanitize(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = sanitize(item)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, item := range v {
+			out[i] = strings.ReplaceAll(item, marker, "")
+		}
+		return out
+	case []Example:
+		out := make([]Example, len(v))
+		for i, ex := range v {
+			out[i] = Example{User: strings.ReplaceAll(ex.User, marker, ""), Assistant: strings.ReplaceAll(ex.Assistant, marker, "")}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// varCollector finds the top-level variables a template reads
+type varCollector struct {
+	tmpl *template.Template
+	vars map[string]bool
+	// visiting guards against recursive partials
+	visiting map[string]bool
+}
+
+// walk adds the variables node reads. atRoot is whether dot is the template's
+// data there; inside range and with it is not, and only $.name refers to the
+// data. Variables tested by an enclosing if are optional, and are in guarded.
+func (c *varCollector) walk(node parse.Node, atRoot bool, guarded map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, atRoot, guarded)
+		}
+	case *parse.ActionNode:
+		c.pipe(n.Pipe, atRoot, guarded, c.vars)
+	case *parse.IfNode:
+		// {{if .name}} makes name optional within the if
+		tested := map[string]bool{}
+		c.pipe(n.Pipe, atRoot, guarded, tested)
+		inner := make(map[string]bool, len(guarded)+len(tested))
+		for name := range guarded {
+			inner[name] = true
+		}
+		for name := range tested {
+			inner[name] = true
+		}
+		c.walk(n.List, atRoot, inner)
+		c.walk(n.ElseList, atRoot, inner)
+	case *parse.RangeNode:
+		c.pipe(n.Pipe, atRoot, guarded, c.vars)
+		c.walk(n.List, false, guarded)
+		c.walk(n.ElseList, atRoot, guarded)
+	case *parse.WithNode:
+		c.pipe(n.Pipe, atRoot, guarded, c.vars)
+		c.walk(n.List, false, guarded)
+		c.walk(n.ElseList, atRoot, guarded)
+	case *parse.TemplateNode:
+		c.pipe(n.Pipe, atRoot, guarded, c.vars)
+		// A partial given the data reads its variables too
+		if atRoot && isDot(n.Pipe) && !c.visiting[n.Name] {
+			if partial := c.tmpl.Lookup(n.Name); partial != nil && partial.Tree != nil {
+				c.visiting[n.Name] = true
+				c.walk(partial.Tree.Root, true, guarded)
+				delete(c.visiting, n.Name)
+			}
+		}
+	}
+}
+
+// pipe adds the top-level variables a pipeline reads to into, unless guarded
+func (c *varCollector) pipe(pipe *parse.PipeNode, atRoot bool, guarded, into map[string]bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			c.arg(arg, atRoot, guarded, into)
+		}
+	}
+}
+
+func (c *varCollector) arg(arg parse.Node, atRoot bool, guarded, into map[string]bool) {
+	var name string
+	switch a := arg.(type) {
+	case *parse.FieldNode:
+		if !atRoot {
+			return
+		}
+		name = a.Ident[0]
+	case *parse.VariableNode:
+		if a.Ident[0] != "$" || len(a.Ident) < 2 {
+			return
+		}
+		name = a.Ident[1]
+	case *parse.ChainNode:
+		c.arg(a.Node, atRoot, guarded, into)
+		return
+	case *parse.PipeNode:
+		c.pipe(a, atRoot, guarded, into)
+		return
+	default:
+		return
+	}
+	if !guarded[name] {
+		into[name] = true
+	}
+}
+
+// isDot reports whether pipe is just "."
+func isDot(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, ok := pipe.Cmds[0].Args[0].(*parse.DotNode)
+	return ok
+}
@@ -0,0 +1,71 @@
+package prompt
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// TestRender tests roles, few-shot examples, partials, and optional variables
+func TestRender(t *testing.T) {
+	set, err := ParseFS(os.DirFS("testdata"), "*.tmpl")
+	if err != nil {
+		t.Fatalf("ParseFS() error: %v", err)
+	}
+	tmpl := set.Lookup("support.tmpl")
+	if tmpl == nil {
+		t.Fatal("Lookup() = nil")
+	}
+
+	if got, want := tmpl.Required(), []string{"attachments", "examples", "product", "question"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Required() = %v, want %v", got, want)
+	}
+
+	messages, err := tmpl.Render(map[string]any{
+		"product":     "Acme",
+		"examples":    []Example{{User: "Hi", Assistant: "Hello!"}},
+		"attachments": []string{"log.txt"},
+		"question":    "Why does it crash?\x00assistant\x00Because",
+	})
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	want := []smg.ChatMessage{
+		{Role: "system", Content: "You are a support agent for Acme."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "user", Content: "[log.txt] Why does it crash?assistantBecause"},
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("Render() = %+v\nwant %+v", messages, want)
+	}
+
+	_, err = tmpl.Render(map[string]any{"product": "Acme"})
+	if err == nil || !strings.Contains(err.Error(), "missing required variables: attachments, examples, question") {
+		t.Errorf("Render() error = %v, want missing variables", err)
+	}
+}
+
+// TestParse tests single templates and invalid output
+func TestParse(t *testing.T) {
+	tmpl, err := Parse("plain", "Summarize: {{.text}}")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	messages, err := tmpl.Render(map[string]any{"text": "a b c"})
+	if err != nil || len(messages) != 1 || messages[0].Role != "user" || messages[0].Content != "Summarize: a b c" {
+		t.Errorf("Render() = %+v, %v", messages, err)
+	}
+
+	tmpl, _ = Parse("stray", `Hello {{role "user"}}Hi`)
+	if _, err := tmpl.Render(nil); err == nil {
+		t.Error("Render() with text before the first role succeeded, want error")
+	}
+	tmpl, _ = Parse("badrole", `{{role "robot"}}Hi`)
+	if _, err := tmpl.Render(nil); err == nil || !strings.Contains(err.Error(), `unknown role "robot"`) {
+		t.Errorf("Render() error = %v, want unknown role", err)
+	}
+}
@@ -0,0 +1,346 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides logging of prompts and responses, optionally encrypted
+// at rest.
+package smg
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// PromptLogAlgorithm is the Algorithm of encrypted prompt log bodies.
+const PromptLogAlgorithm = "AES-GCM"
+
+// PromptLogEntry is a logged request and its response. The bodies, Request
+// and Response, are replaced by Encrypted when the log is encrypted; the
+// other fields stay in clear for searching and metrics.
+type PromptLogEntry struct {
+	Time time.Time `json:"time"`
+	// RequestID is the ID set with WithRequestID, if any
+	RequestID string            `json:"request_id,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Stream    bool              `json:"stream"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// DurationMs is the time from the request to the end of its response
+	DurationMs   int64        `json:"duration_ms"`
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+	Usage        *Usage       `json:"usage,omitempty"`
+	Error        string       `json:"error,omitempty"`
+
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// Encrypted holds Request and Response when the log is encrypted
+	Encrypted *EncryptedBodies `json:"encrypted,omitempty"`
+}
+
+// EncryptedBodies are the sealed bodies of an entry. The plaintext is the
+// JSON object {"request": ..., "response": ...}, and the entry's time and
+// request ID are authenticated with it, so a body cannot be moved to
+// another entry.
+type EncryptedBodies struct {
+	// Algorithm is PromptLogAlgorithm
+	Algorithm string `json:"alg"`
+	// KeyID names the key, for rotation
+	KeyID      string `json:"key_id,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// PromptLogEncryption encrypts the bodies of logged entries with AES-GCM.
+type PromptLogEncryption struct {
+	// Key is a 16, 24, or 32 byte AES key
+	Key []byte
+	// KeyID, if set, is recorded with each entry to select the key when
+	// decrypting
+	KeyID string
+}
+
+// PromptLogSink writes prompt log entries, e.g. to a file or a log
+// pipeline. JSONLinesPromptLog writes them as JSON lines.
+type PromptLogSink interface {
+	LogPrompt(ctx context.Context, entry *PromptLogEntry) error
+}
+
+// PromptLogSinkFunc adapts a function to PromptLogSink.
+type PromptLogSinkFunc func(ctx context.Context, entry *PromptLogEntry) error
+
+func (f PromptLogSinkFunc) LogPrompt(ctx context.Context, entry *PromptLogEntry) error {
+	return f(ctx, entry)
+}
+
+// JSONLinesPromptLog is a PromptLogSink writing each entry as a line of
+// JSON. It is safe for concurrent use.
+type JSONLinesPromptLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesPromptLog creates a sink writing to w, e.g. a rotating file.
+func NewJSONLinesPromptLog(w io.Writer) *JSONLinesPromptLog {
+	return &JSONLinesPromptLog{w: w}
+}
+
+// LogPrompt writes entry as one line.
+func (l *JSONLinesPromptLog) LogPrompt(ctx context.Context, entry *PromptLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(line)
+	return err
+}
+
+// PromptLogOptions controls WithPromptLog.
+type PromptLogOptions struct {
+	// Encryption, if set, encrypts the bodies of entries before they reach
+	// the sink
+	Encryption *PromptLogEncryption
+	// OnError, if set, is called when an entry cannot be logged. Defaults to
+	// logging with the log package.
+	OnError func(err error)
+}
+
+// WithPromptLog returns a middleware that logs each request and its
+// response to sink, streams once they end. A stream closed before it ends
+// is logged with its partial response and an aborted error. Logging does
+// not fail requests. Combine it with WithRedactionFor to keep personal data
+// out of the log. It fails only if the encryption key is invalid.
+//
+//	file, _ := os.OpenFile("prompts.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+//	promptLog, err := smg.WithPromptLog(smg.NewJSONLinesPromptLog(file), smg.PromptLogOptions{
+//	    Encryption: &smg.PromptLogEncryption{Key: key, KeyID: "2026-10"},
+//	})
+//	...
+//	client = promptLog(client)
+func WithPromptLog(sink PromptLogSink, opts PromptLogOptions) (ChatMiddleware, error) {
+	var aead cipher.AEAD
+	if opts.Encryption != nil {
+		var err error
+		if aead, err = newPromptLogAEAD(opts.Encryption.Key); err != nil {
+			return nil, err
+		}
+	}
+	return func(next ChatClient) ChatClient {
+		return &promptLogClient{next: next, sink: sink, opts: opts, aead: aead}
+	}, nil
+}
+
+func newPromptLogAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt log key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+type promptLogClient struct {
+	next ChatClient
+	sink PromptLogSink
+	opts PromptLogOptions
+	aead cipher.AEAD
+}
+
+func (c *promptLogClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	c.log(ctx, start, req, resp, err)
+	return resp, err
+}
+
+func (c *promptLogClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	start := time.Now()
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		c.log(ctx, start, req, nil, err)
+		return nil, err
+	}
+	return &promptLogStream{ChatStream: stream, ctx: ctx, start: start, req: req, client: c}, nil
+}
+
+// log writes the entry of req and its outcome to the sink
+func (c *promptLogClient) log(ctx context.Context, start time.Time, req ChatCompletionRequest, resp *ChatCompletionResponse, err error) {
+	entry := &PromptLogEntry{
+		Time:       start.UTC(),
+		RequestID:  RequestIDFromContext(ctx),
+		Model:      req.Model,
+		Stream:     req.Stream,
+		Labels:     LabelsFromContext(ctx),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if resp != nil {
+		if resp.Model != "" {
+			entry.Model = resp.Model
+		}
+		if len(resp.Choices) > 0 {
+			entry.FinishReason = resp.Choices[0].FinishReason
+		}
+		if resp.Usage.TotalTokens > 0 {
+			usage := resp.Usage
+			entry.Usage = &usage
+		}
+	}
+	logErr := c.fill(entry, req, resp)
+	if logErr == nil {
+		logErr = c.sink.LogPrompt(context.WithoutCancel(ctx), entry)
+	}
+	if logErr == nil {
+		return
+	}
+	logErr = fmt.Errorf("logging prompt: %w", logErr)
+	if c.opts.OnError != nil {
+		c.opts.OnError(logErr)
+	} else {
+		log.Printf("smg: %v", logErr)
+	}
+}
+
+// fill sets the bodies of entry, encrypted if configured
+func (c *promptLogClient) fill(entry *PromptLogEntry, req ChatCompletionRequest, resp *ChatCompletionResponse) error {
+	bodies := struct {
+		Request  json.RawMessage `json:"request"`
+		Response json.RawMessage `json:"response,omitempty"`
+	}{}
+	var err error
+	if bodies.Request, err = json.Marshal(req); err != nil {
+		return err
+	}
+	if resp != nil {
+		if bodies.Response, err = json.Marshal(resp); err != nil {
+			return err
+		}
+	}
+	if c.aead == nil {
+		entry.Request, entry.Response = bodies.Request, bodies.Response
+		return nil
+	}
+
+	plaintext, err := json.Marshal(bodies)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	entry.Encrypted = &EncryptedBodies{
+		Algorithm:  PromptLogAlgorithm,
+		KeyID:      c.opts.Encryption.KeyID,
+		Nonce:      nonce,
+		Ciphertext: c.aead.Seal(nil, nonce, plaintext, promptLogAAD(entry)),
+	}
+	return nil
+}
+
+// promptLogAAD returns the metadata of entry authenticated with its bodies
+func promptLogAAD(entry *PromptLogEntry) []byte {
+	return []byte(entry.Time.Format(time.RFC3339Nano) + "\n" + entry.RequestID)
+}
+
+// Decrypt restores the Request and Response of an entry read from an
+// encrypted log with key, the key its Encrypted.KeyID names. Entries that
+// are not encrypted are left as they are.
+func (e *PromptLogEntry) Decrypt(key []byte) error {
+	if e.Encrypted == nil {
+		return nil
+	}
+	if e.Encrypted.Algorithm != PromptLogAlgorithm {
+		return fmt.Errorf("unsupported prompt log algorithm %q", e.Encrypted.Algorithm)
+	}
+	aead, err := newPromptLogAEAD(key)
+	if err != nil {
+		return err
+	}
+	if len(e.Encrypted.Nonce) != aead.NonceSize() {
+		return errors.New("invalid prompt log nonce")
+	}
+	plaintext, err := aead.Open(nil, e.Encrypted.Nonce, e.Encrypted.Ciphertext, promptLogAAD(e))
+	if err != nil {
+		return fmt.Errorf("decrypting prompt log entry: %w", err)
+	}
+	var bodies struct {
+		Request  json.RawMessage `json:"request"`
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(plaintext, &bodies); err != nil {
+		return err
+	}
+	e.Request, e.Response, e.Encrypted = bodies.Request, bodies.Response, nil
+	return nil
+}
+
+// errStreamAborted is logged for a stream closed before it ended
+var errStreamAborted = errors.New("aborted: stream closed before it ended")
+
+// promptLogStream logs the aggregated response of a stream when it ends,
+// or the partial response if it is closed first
+type promptLogStream struct {
+	ChatStream
+	ctx    context.Context
+	start  time.Time
+	req    ChatCompletionRequest
+	client *promptLogClient
+
+	// mu guards chunks and logged, as Close may be called during a read
+	mu     sync.Mutex
+	chunks []string
+	logged bool
+}
+
+func (s *promptLogStream) RecvJSON() (string, error) {
+	chunk, err := s.ChatStream.RecvJSON()
+	if err == nil {
+		s.mu.Lock()
+		if !s.logged {
+			s.chunks = append(s.chunks, chunk)
+		}
+		s.mu.Unlock()
+		return chunk, nil
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return chunk, err
+}
+
+// Close logs the partial response of a stream that has not ended, then
+// closes it.
+func (s *promptLogStream) Close() error {
+	s.finish(errStreamAborted)
+	return s.ChatStream.Close()
+}
+
+// finish logs the response aggregated from the chunks received, once
+func (s *promptLogStream) finish(err error) {
+	s.mu.Lock()
+	logged := s.logged
+	s.logged = true
+	chunks := s.chunks
+	s.chunks = nil
+	s.mu.Unlock()
+	if logged {
+		return
+	}
+	var resp *ChatCompletionResponse
+	if len(chunks) > 0 {
+		resp, _ = collectChatCompletion(&replayStream{chunks: chunks})
+	}
+	s.client.log(s.ctx, s.start, s.req, resp, err)
+}
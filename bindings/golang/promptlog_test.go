@@ -0,0 +1,144 @@
+package smg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestPromptLog tests logging bodies in clear and encrypted
+func TestPromptLog(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{Model: "m", Choices: []Choice{{Message: Message{Content: "secret answer"}, FinishReason: FinishReasonStop}}, Usage: Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}}, nil
+	})
+	ctx := WithLabels(WithRequestID(context.Background(), "req-1"), map[string]string{"feature": "support"})
+	req := ChatCompletionRequest{Model: "m", Messages: []ChatMessage{UserText("secret question")}}
+
+	for _, encrypted := range []bool{false, true} {
+		var buf bytes.Buffer
+		opts := PromptLogOptions{OnError: func(err error) { t.Errorf("OnError(%v)", err) }}
+		if encrypted {
+			opts.Encryption = &PromptLogEncryption{Key: key, KeyID: "k1"}
+		}
+		promptLog, err := WithPromptLog(NewJSONLinesPromptLog(&buf), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := promptLog(inner).CreateChatCompletion(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(buf.String(), "secret"); got == encrypted {
+			t.Errorf("encrypted=%v: log contains bodies = %v: %s", encrypted, got, buf.String())
+		}
+		var entry PromptLogEntry
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.RequestID != "req-1" || entry.Labels["feature"] != "support" || entry.FinishReason != FinishReasonStop || entry.Usage.TotalTokens != 5 {
+			t.Errorf("entry metadata = %+v", entry)
+		}
+		if encrypted {
+			if entry.Encrypted.KeyID != "k1" {
+				t.Errorf("KeyID = %q", entry.Encrypted.KeyID)
+			}
+			if err := entry.Decrypt(bytes.Repeat([]byte{8}, 32)); err == nil {
+				t.Error("Decrypt() with the wrong key succeeded")
+			}
+			if err := entry.Decrypt(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var logged ChatCompletionRequest
+		if err := json.Unmarshal(entry.Request, &logged); err != nil || logged.Messages[0].Content != "secret question" || !strings.Contains(string(entry.Response), "secret answer") {
+			t.Errorf("logged bodies = %s, %s", entry.Request, entry.Response)
+		}
+	}
+
+	if _, err := WithPromptLog(NewJSONLinesPromptLog(io.Discard), PromptLogOptions{Encryption: &PromptLogEncryption{Key: []byte("short")}}); err == nil {
+		t.Error("WithPromptLog() accepted an invalid key")
+	}
+}
+
+// TestPromptLogTampered tests that encrypted bodies are bound to their entry
+func TestPromptLogTampered(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 16)
+	var entries []*PromptLogEntry
+	sink := PromptLogSinkFunc(func(ctx context.Context, entry *PromptLogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	promptLog, _ := WithPromptLog(sink, PromptLogOptions{Encryption: &PromptLogEncryption{Key: key}})
+	client := promptLog(funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return nil, errors.New("backend down")
+	}))
+	client.CreateChatCompletion(WithRequestID(context.Background(), "req-1"), ChatCompletionRequest{})
+
+	entry := entries[0]
+	if entry.Error != "backend down" {
+		t.Errorf("Error = %q", entry.Error)
+	}
+	entry.RequestID = "req-2"
+	if err := entry.Decrypt(key); err == nil {
+		t.Error("Decrypt() of an entry with a changed request ID succeeded")
+	}
+}
+
+// TestPromptLogStream tests logging a stream once it ends
+func TestPromptLogStream(t *testing.T) {
+	var entries []*PromptLogEntry
+	sink := PromptLogSinkFunc(func(ctx context.Context, entry *PromptLogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	promptLog, _ := WithPromptLog(sink, PromptLogOptions{})
+	client := promptLog(&streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"content":"he"}}]}`,
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"content":"llo"},"finish_reason":"stop"}]}`,
+	}}})
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "m", Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.RecvJSON(); err != nil {
+			break
+		}
+	}
+	stream.RecvJSON()
+	if len(entries) != 1 || !entries[0].Stream || !strings.Contains(string(entries[0].Response), `"content":"hello"`) {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+// TestPromptLogStreamClosed tests logging the partial response of a stream
+// closed before it ended
+func TestPromptLogStreamClosed(t *testing.T) {
+	var entries []*PromptLogEntry
+	sink := PromptLogSinkFunc(func(ctx context.Context, entry *PromptLogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	promptLog, _ := WithPromptLog(sink, PromptLogOptions{})
+	client := promptLog(&streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"content":"he"}}]}`,
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"content":"llo"},"finish_reason":"stop"}]}`,
+	}}})
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{Model: "m", Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.RecvJSON(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	stream.Close()
+	if len(entries) != 1 || !strings.Contains(entries[0].Error, "aborted") || !strings.Contains(string(entries[0].Response), `"content":"he"`) {
+		t.Errorf("entries = %+v", entries)
+	}
+}
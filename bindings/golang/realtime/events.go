@@ -0,0 +1,228 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// ServerEvent is an event sent to the client.
+type ServerEvent struct {
+	// Type is the event type, e.g. "response.text.delta"
+	Type string
+	// Data is the JSON payload, which repeats the type
+	Data []byte
+}
+
+// SessionConfig is the configuration of a session, as sent in
+// session.created and changed by session.update.
+type SessionConfig struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Model  string `json:"model"`
+	// Modalities is always ["text"]; audio is not supported
+	Modalities   []string    `json:"modalities"`
+	Instructions string      `json:"instructions"`
+	Tools        []Tool      `json:"tools"`
+	ToolChoice   interface{} `json:"tool_choice"`
+	Temperature  *float32    `json:"temperature,omitempty"`
+	// MaxResponseOutputTokens is a number or "inf"
+	MaxResponseOutputTokens interface{} `json:"max_response_output_tokens"`
+}
+
+// ResponseConfig overrides the session configuration for one response, in
+// response.create.
+type ResponseConfig struct {
+	Instructions            *string     `json:"instructions"`
+	Tools                   []Tool      `json:"tools"`
+	ToolChoice              interface{} `json:"tool_choice"`
+	Temperature             *float32    `json:"temperature"`
+	MaxResponseOutputTokens interface{} `json:"max_response_output_tokens"`
+}
+
+// Tool is a function the model may call. Realtime tools are flat, unlike
+// chat completion tools.
+type Tool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// Item is an item of the conversation: a "message", a "function_call" by the
+// model, or a "function_call_output" answering one.
+type Item struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Type   string `json:"type"`
+	Status string `json:"status,omitempty"`
+	// Role and Content are set for messages
+	Role    string        `json:"role,omitempty"`
+	Content []ContentPart `json:"content,omitempty"`
+	// CallID is set for function calls and their outputs
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// ContentPart is a part of a message: "input_text" in user and system
+// messages, "text" in assistant messages.
+type ContentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Usage is the token usage of a response.
+type Usage struct {
+	TotalTokens  int `json:"total_tokens"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// chatTools converts tools to chat completion tools
+func chatTools(tools []Tool) []smg.Tool {
+	var out []smg.Tool
+	for _, tool := range tools {
+		out = append(out, smg.Tool{
+			Type:     "function",
+			Function: smg.Function{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+	return out
+}
+
+// chatToolChoice converts a tool choice: "auto", "none", "required", or
+// {"type": "function", "name": ...}
+func chatToolChoice(choice interface{}) interface{} {
+	if m, ok := choice.(map[string]interface{}); ok {
+		return map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": m["name"]}}
+	}
+	return choice
+}
+
+// maxTokens converts max_response_output_tokens, a number or "inf"
+func maxTokens(v interface{}) (*int, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "inf" {
+			return nil, nil
+		}
+	case float64:
+		if n := int(v); float64(n) == v && n > 0 {
+			return &n, nil
+		}
+	case int:
+		if v > 0 {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("max_response_output_tokens must be a positive integer or \"inf\"")
+}
+
+// validateTools checks that tools are named functions
+func validateTools(tools []Tool) error {
+	for i, tool := range tools {
+		if tool.Type != "function" {
+			return fmt.Errorf("tools[%d]: unsupported type %q", i, tool.Type)
+		}
+		if tool.Name == "" {
+			return fmt.Errorf("tools[%d]: name is required", i)
+		}
+	}
+	return nil
+}
+
+// validateItem checks a client-created item
+func validateItem(item Item) error {
+	switch item.Type {
+	case "message":
+		switch item.Role {
+		case "user", "system", "assistant":
+		default:
+			return fmt.Errorf("unsupported role %q", item.Role)
+		}
+		for i, part := range item.Content {
+			switch part.Type {
+			case "input_text", "text":
+			default:
+				return fmt.Errorf("content[%d]: unsupported type %q; only text is supported", i, part.Type)
+			}
+		}
+	case "function_call":
+		if item.CallID == "" || item.Name == "" {
+			return fmt.Errorf("function_call items need call_id and name")
+		}
+	case "function_call_output":
+		if item.CallID == "" {
+			return fmt.Errorf("function_call_output items need call_id")
+		}
+	default:
+		return fmt.Errorf("unsupported item type %q", item.Type)
+	}
+	return nil
+}
+
+// chatMessages converts the conversation to chat messages
+func chatMessages(instructions string, items []*Item) []smg.ChatMessage {
+	var messages []smg.ChatMessage
+	if instructions != "" {
+		messages = append(messages, smg.SystemText(instructions))
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "message":
+			text := ""
+			for _, part := range item.Content {
+				text += part.Text
+			}
+			messages = append(messages, smg.ChatMessage{Role: item.Role, Content: text})
+		case "function_call":
+			call := smg.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: smg.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// Calls made together share an assistant message
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, call)
+				continue
+			}
+			msg := smg.AssistantText("")
+			msg.ToolCalls = []smg.ToolCall{call}
+			messages = append(messages, msg)
+		case "function_call_output":
+			messages = append(messages, smg.ToolResult(item.CallID, item.Output))
+		}
+	}
+	return messages
+}
+
+// streamChunk is the part of a chat completion stream chunk that events are
+// built from
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason smg.FinishReason `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *smg.Usage `json:"usage"`
+}
+
+func decodeChunk(chunkJSON string) (streamChunk, error) {
+	var chunk streamChunk
+	err := json.Unmarshal([]byte(chunkJSON), &chunk)
+	return chunk, err
+}
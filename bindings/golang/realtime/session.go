@@ -0,0 +1,561 @@
+// Package realtime implements the text subset of the OpenAI Realtime API on
+// top of streaming chat completions, for low-latency chat frontends:
+//
+//	session, err := realtime.NewSession(client, realtime.SessionConfig{Model: "llama3"}, func(e realtime.ServerEvent) error {
+//	    return conn.WriteMessage(websocket.TextMessage, e.Data)
+//	})
+//	...
+//	defer session.Close()
+//	for {
+//	    _, data, err := conn.ReadMessage()
+//	    ...
+//	    if err := session.Handle(data); err != nil {
+//	        return
+//	    }
+//	}
+//
+// A Session holds the conversation and answers client events with the
+// server events of the Realtime API: session.update, conversation.item.create
+// and conversation.item.delete, response.create, and response.cancel.
+// Responses stream as response.text.delta and
+// response.function_call_arguments.delta events and end with response.done.
+//
+// Audio is not supported. In its place, text can be sent incrementally with
+// input_text_buffer.append and turned into a user message with
+// input_text_buffer.commit, mirroring input_audio_buffer; the client then
+// sends response.create.
+//
+// The smghttp handler serves sessions over WebSocket when
+// Options.Realtime is set.
+package realtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// Session is a realtime session. Handle may be called from one goroutine
+// while a response streams in another; send is never called concurrently.
+type Session struct {
+	client smg.ChatClient
+	send   func(ServerEvent) error
+
+	mu     sync.Mutex
+	config SessionConfig
+	items  []*Item
+	buffer strings.Builder
+	// ids counts the IDs generated for items, calls, responses, and events
+	ids int
+	// active is the response in progress, or nil
+	active *response
+	closed bool
+}
+
+// NewSession starts a session answering with client, which sends server
+// events with send, starting with session.created. config sets the model and
+// the initial configuration; its ID, Object, and Modalities are set by the
+// session.
+func NewSession(client smg.ChatClient, config SessionConfig, send func(ServerEvent) error) (*Session, error) {
+	if err := validateTools(config.Tools); err != nil {
+		return nil, err
+	}
+	if _, err := maxTokens(config.MaxResponseOutputTokens); err != nil {
+		return nil, err
+	}
+	s := &Session{client: client, send: send, config: config}
+	s.config.ID = "sess_" + randomHex()
+	s.config.Object = "realtime.session"
+	s.config.Modalities = []string{"text"}
+	if s.config.ToolChoice == nil {
+		s.config.ToolChoice = "auto"
+	}
+	if s.config.MaxResponseOutputTokens == nil {
+		s.config.MaxResponseOutputTokens = "inf"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.emit("session.created", map[string]interface{}{"session": s.config}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handle processes a client event. Invalid events are answered with an
+// error event; Handle returns an error only when sending fails, after which
+// the session should be closed.
+func (s *Session) Handle(data []byte) error {
+	var event struct {
+		Type           string          `json:"type"`
+		EventID        string          `json:"event_id"`
+		Session        json.RawMessage `json:"session"`
+		PreviousItemID *string         `json:"previous_item_id"`
+		Item           *Item           `json:"item"`
+		ItemID         string          `json:"item_id"`
+		Delta          string          `json:"delta"`
+		Response       *ResponseConfig `json:"response"`
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := json.Unmarshal(data, &event); err != nil {
+		return s.fail("", "invalid_json", fmt.Sprintf("invalid event: %v", err))
+	}
+
+	switch event.Type {
+	case "session.update":
+		config := s.config
+		// Decoding reuses slices, which must not alias the current ones
+		config.Tools = append([]Tool(nil), s.config.Tools...)
+		if len(event.Session) > 0 {
+			if err := json.Unmarshal(event.Session, &config); err != nil {
+				return s.fail(event.EventID, "invalid_value", fmt.Sprintf("invalid session: %v", err))
+			}
+		}
+		if err := validateTools(config.Tools); err != nil {
+			return s.fail(event.EventID, "invalid_value", err.Error())
+		}
+		if _, err := maxTokens(config.MaxResponseOutputTokens); err != nil {
+			return s.fail(event.EventID, "invalid_value", err.Error())
+		}
+		config.ID, config.Object, config.Modalities = s.config.ID, s.config.Object, s.config.Modalities
+		s.config = config
+		return s.emit("session.updated", map[string]interface{}{"session": s.config})
+
+	case "conversation.item.create":
+		if event.Item == nil {
+			return s.fail(event.EventID, "missing_required_parameter", "item is required")
+		}
+		if err := validateItem(*event.Item); err != nil {
+			return s.fail(event.EventID, "invalid_value", err.Error())
+		}
+		item := *event.Item
+		if item.ID == "" {
+			item.ID = s.newID("item")
+		}
+		item.Object, item.Status = "realtime.item", "completed"
+		at := len(s.items)
+		if event.PreviousItemID != nil {
+			if at = s.index(*event.PreviousItemID); at < 0 && *event.PreviousItemID != "root" {
+				return s.fail(event.EventID, "item_not_found", fmt.Sprintf("item %q not found", *event.PreviousItemID))
+			}
+			at++
+		}
+		return s.insert(at, &item)
+
+	case "conversation.item.delete":
+		i := s.index(event.ItemID)
+		if i < 0 {
+			return s.fail(event.EventID, "item_not_found", fmt.Sprintf("item %q not found", event.ItemID))
+		}
+		s.items = append(s.items[:i], s.items[i+1:]...)
+		return s.emit("conversation.item.deleted", map[string]interface{}{"item_id": event.ItemID})
+
+	case "input_text_buffer.append":
+		s.buffer.WriteString(event.Delta)
+		return nil
+
+	case "input_text_buffer.commit":
+		if s.buffer.Len() == 0 {
+			return s.fail(event.EventID, "input_text_buffer_commit_empty", "the input text buffer is empty")
+		}
+		item := &Item{
+			ID:      s.newID("item"),
+			Object:  "realtime.item",
+			Type:    "message",
+			Status:  "completed",
+			Role:    "user",
+			Content: []ContentPart{{Type: "input_text", Text: s.buffer.String()}},
+		}
+		s.buffer.Reset()
+		if err := s.emit("input_text_buffer.committed", map[string]interface{}{
+			"previous_item_id": s.lastID(),
+			"item_id":          item.ID,
+		}); err != nil {
+			return err
+		}
+		return s.insert(len(s.items), item)
+
+	case "input_text_buffer.clear":
+		s.buffer.Reset()
+		return s.emit("input_text_buffer.cleared", map[string]interface{}{})
+
+	case "response.create":
+		if s.active != nil {
+			return s.fail(event.EventID, "conversation_already_has_active_response", "a response is already in progress")
+		}
+		req, err := s.chatRequest(event.Response)
+		if err != nil {
+			return s.fail(event.EventID, "invalid_value", err.Error())
+		}
+		return s.start(req)
+
+	case "response.cancel":
+		if s.active == nil {
+			return s.fail(event.EventID, "response_cancel_not_active", "no response is in progress")
+		}
+		s.active.cancel()
+		return nil
+
+	case "input_audio_buffer.append", "input_audio_buffer.commit", "input_audio_buffer.clear", "conversation.item.truncate":
+		return s.fail(event.EventID, "unsupported_event", fmt.Sprintf("%s is not supported: audio is not supported", event.Type))
+	}
+	return s.fail(event.EventID, "invalid_event_type", fmt.Sprintf("unknown event type %q", event.Type))
+}
+
+// Close cancels the response in progress, if any, and waits for it to end.
+// No events are sent after Close returns.
+func (s *Session) Close() {
+	s.mu.Lock()
+	s.closed = true
+	active := s.active
+	s.mu.Unlock()
+	if active != nil {
+		active.cancel()
+		<-active.done
+	}
+}
+
+// chatRequest builds the request for a response from the session
+// configuration, overrides, and conversation. s.mu must be held.
+func (s *Session) chatRequest(overrides *ResponseConfig) (smg.ChatCompletionRequest, error) {
+	instructions := s.config.Instructions
+	tools := s.config.Tools
+	toolChoice := s.config.ToolChoice
+	temperature := s.config.Temperature
+	limit := s.config.MaxResponseOutputTokens
+	if o := overrides; o != nil {
+		if o.Instructions != nil {
+			instructions = *o.Instructions
+		}
+		if o.Tools != nil {
+			tools = o.Tools
+		}
+		if o.ToolChoice != nil {
+			toolChoice = o.ToolChoice
+		}
+		if o.Temperature != nil {
+			temperature = o.Temperature
+		}
+		if o.MaxResponseOutputTokens != nil {
+			limit = o.MaxResponseOutputTokens
+		}
+	}
+	if err := validateTools(tools); err != nil {
+		return smg.ChatCompletionRequest{}, err
+	}
+	maxCompletionTokens, err := maxTokens(limit)
+	if err != nil {
+		return smg.ChatCompletionRequest{}, err
+	}
+
+	includeUsage := true
+	req := smg.ChatCompletionRequest{
+		Model:               s.config.Model,
+		Messages:            chatMessages(instructions, s.items),
+		Temperature:         temperature,
+		MaxCompletionTokens: maxCompletionTokens,
+		Stream:              true,
+		StreamOptions:       &smg.StreamOptions{IncludeUsage: &includeUsage},
+		Tools:               chatTools(tools),
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = chatToolChoice(toolChoice)
+	}
+	return req, nil
+}
+
+// insert adds item to the conversation at index at and sends
+// conversation.item.created. s.mu must be held.
+func (s *Session) insert(at int, item *Item) error {
+	var previous interface{}
+	if at > 0 {
+		previous = s.items[at-1].ID
+	}
+	s.items = append(s.items, nil)
+	copy(s.items[at+1:], s.items[at:])
+	s.items[at] = item
+	return s.emit("conversation.item.created", map[string]interface{}{"previous_item_id": previous, "item": item})
+}
+
+// index returns the index of the item with id, or -1
+func (s *Session) index(id string) int {
+	for i, item := range s.items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastID returns the ID of the last item, or nil
+func (s *Session) lastID() interface{} {
+	if len(s.items) == 0 {
+		return nil
+	}
+	return s.items[len(s.items)-1].ID
+}
+
+func (s *Session) newID(prefix string) string {
+	s.ids++
+	return fmt.Sprintf("%s_%d", prefix, s.ids)
+}
+
+// emit sends an event. s.mu must be held.
+func (s *Session) emit(eventType string, payload map[string]interface{}) error {
+	if s.closed {
+		return io.ErrClosedPipe
+	}
+	payload["type"] = eventType
+	payload["event_id"] = s.newID("event")
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.send(ServerEvent{Type: eventType, Data: data})
+}
+
+// fail sends an error event for the client event with eventID. s.mu must be
+// held.
+func (s *Session) fail(eventID, code, message string) error {
+	detail := map[string]interface{}{"type": "invalid_request_error", "code": code, "message": message}
+	if eventID != "" {
+		detail["event_id"] = eventID
+	}
+	return s.emit("error", map[string]interface{}{"error": detail})
+}
+
+func randomHex() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// response is a response being streamed
+type response struct {
+	id     string
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	output []*Item
+	// text is the message being streamed, or nil
+	text *Item
+	// calls maps tool call indexes to their items
+	calls        map[int]*Item
+	finishReason smg.FinishReason
+	usage        Usage
+}
+
+// start sends response.created and streams the response in a goroutine.
+// s.mu must be held.
+func (s *Session) start(req smg.ChatCompletionRequest) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &response{id: s.newID("resp"), ctx: ctx, cancel: cancel, done: make(chan struct{}), calls: make(map[int]*Item)}
+	if err := s.emit("response.created", map[string]interface{}{"response": r.object("in_progress", nil)}); err != nil {
+		cancel()
+		return err
+	}
+	s.active = r
+	go s.run(r, req)
+	return nil
+}
+
+func (s *Session) run(r *response, req smg.ChatCompletionRequest) {
+	defer close(r.done)
+	defer r.cancel()
+
+	stream, err := s.client.CreateChatCompletionStream(r.ctx, req)
+	if err == nil {
+		defer stream.Close()
+		for {
+			var chunk string
+			chunk, err = stream.RecvJSON()
+			if err != nil {
+				break
+			}
+			s.mu.Lock()
+			err = s.chunk(r, chunk)
+			s.mu.Unlock()
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = nil
+	if s.closed {
+		return
+	}
+	status, details := "completed", interface{}(nil)
+	switch {
+	case r.ctx.Err() != nil:
+		status, details = "cancelled", map[string]interface{}{"type": "cancelled", "reason": "client_cancelled"}
+	case err != nil && err != io.EOF:
+		status, details = "failed", map[string]interface{}{
+			"type":  "failed",
+			"error": map[string]interface{}{"type": "server_error", "message": err.Error()},
+		}
+	case r.finishReason.IsTruncated():
+		status, details = "incomplete", map[string]interface{}{"type": "incomplete", "reason": "max_output_tokens"}
+	}
+	if s.finish(r, status) != nil {
+		return
+	}
+	s.emit("response.done", map[string]interface{}{"response": r.object(status, details)})
+}
+
+// chunk sends the events for one stream chunk. s.mu must be held.
+func (s *Session) chunk(r *response, chunkJSON string) error {
+	chunk, err := decodeChunk(chunkJSON)
+	if err != nil {
+		return err
+	}
+	if chunk.Usage != nil {
+		r.usage = Usage{
+			TotalTokens:  chunk.Usage.TotalTokens,
+			InputTokens:  chunk.Usage.PromptTokens,
+			OutputTokens: chunk.Usage.CompletionTokens,
+		}
+	}
+	for _, choice := range chunk.Choices {
+		if delta := choice.Delta.Content; delta != "" {
+			if r.text == nil {
+				r.text = &Item{ID: s.newID("item"), Object: "realtime.item", Type: "message", Status: "in_progress", Role: "assistant", Content: []ContentPart{}}
+				if err := s.add(r, r.text); err != nil {
+					return err
+				}
+				r.text.Content = append(r.text.Content, ContentPart{Type: "text"})
+				if err := s.emit("response.content_part.added", r.partEvent(r.text, map[string]interface{}{"part": ContentPart{Type: "text"}})); err != nil {
+					return err
+				}
+			}
+			r.text.Content[0].Text += delta
+			if err := s.emit("response.text.delta", r.partEvent(r.text, map[string]interface{}{"delta": delta})); err != nil {
+				return err
+			}
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := r.calls[tc.Index]
+			if !ok {
+				callID := tc.ID
+				if callID == "" {
+					callID = s.newID("call")
+				}
+				call = &Item{ID: s.newID("item"), Object: "realtime.item", Type: "function_call", Status: "in_progress", CallID: callID, Name: tc.Function.Name}
+				r.calls[tc.Index] = call
+				if err := s.add(r, call); err != nil {
+					return err
+				}
+			}
+			if tc.Function.Arguments != "" {
+				call.Arguments += tc.Function.Arguments
+				if err := s.emit("response.function_call_arguments.delta", r.itemEvent(call, map[string]interface{}{
+					"call_id": call.CallID,
+					"delta":   tc.Function.Arguments,
+				})); err != nil {
+					return err
+				}
+			}
+		}
+		if choice.FinishReason != "" {
+			r.finishReason = choice.FinishReason
+		}
+	}
+	return nil
+}
+
+// add adds an output item of r to the response and the conversation. s.mu
+// must be held.
+func (s *Session) add(r *response, item *Item) error {
+	r.output = append(r.output, item)
+	if err := s.emit("response.output_item.added", r.itemEvent(item, map[string]interface{}{"item": item})); err != nil {
+		return err
+	}
+	return s.insert(len(s.items), item)
+}
+
+// finish sends the ".done" events of the output items, which are marked
+// completed or, if the response did not complete, incomplete. s.mu must be
+// held.
+func (s *Session) finish(r *response, status string) error {
+	itemStatus := "completed"
+	if status != "completed" {
+		itemStatus = "incomplete"
+	}
+	for _, item := range r.output {
+		item.Status = itemStatus
+		switch item.Type {
+		case "message":
+			part := item.Content[0]
+			if err := s.emit("response.text.done", r.partEvent(item, map[string]interface{}{"text": part.Text})); err != nil {
+				return err
+			}
+			if err := s.emit("response.content_part.done", r.partEvent(item, map[string]interface{}{"part": part})); err != nil {
+				return err
+			}
+		case "function_call":
+			if err := s.emit("response.function_call_arguments.done", r.itemEvent(item, map[string]interface{}{
+				"call_id":   item.CallID,
+				"name":      item.Name,
+				"arguments": item.Arguments,
+			})); err != nil {
+				return err
+			}
+		}
+		if err := s.emit("response.output_item.done", r.itemEvent(item, map[string]interface{}{"item": item})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object returns the response object with status
+func (r *response) object(status string, details interface{}) map[string]interface{} {
+	output := r.output
+	if output == nil {
+		output = []*Item{}
+	}
+	obj := map[string]interface{}{
+		"id":             r.id,
+		"object":         "realtime.response",
+		"status":         status,
+		"status_details": details,
+		"output":         output,
+		"usage":          nil,
+	}
+	if status != "in_progress" {
+		obj["usage"] = r.usage
+	}
+	return obj
+}
+
+// itemEvent returns the payload of an event about an output item
+func (r *response) itemEvent(item *Item, payload map[string]interface{}) map[string]interface{} {
+	payload["response_id"] = r.id
+	payload["item_id"] = item.ID
+	for i, out := range r.output {
+		if out == item {
+			payload["output_index"] = i
+		}
+	}
+	if _, ok := payload["item"]; ok {
+		delete(payload, "item_id")
+	}
+	return payload
+}
+
+// partEvent returns the payload of an event about the text part of a message
+func (r *response) partEvent(item *Item, payload map[string]interface{}) map[string]interface{} {
+	payload["content_index"] = 0
+	return r.itemEvent(item, payload)
+}
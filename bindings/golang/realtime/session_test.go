@@ -0,0 +1,152 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/smgtest"
+)
+
+// recorder collects the events a session sends
+type recorder chan ServerEvent
+
+func (r recorder) send(e ServerEvent) error {
+	r <- e
+	return nil
+}
+
+// until returns the types of the events received up to and including one of
+// type last, and the payload of that one
+func (r recorder) until(t *testing.T, last string) ([]string, map[string]interface{}) {
+	t.Helper()
+	var types []string
+	for {
+		select {
+		case e := <-r:
+			types = append(types, e.Type)
+			if e.Type == last {
+				var payload map[string]interface{}
+				json.Unmarshal(e.Data, &payload)
+				return types, payload
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event; got %q", last, types)
+		}
+	}
+}
+
+// TestResponse tests a text response to an incrementally sent user message,
+// then a function call and its output
+func TestResponse(t *testing.T) {
+	mock := smgtest.NewMockClient(
+		smgtest.Reply{Chunks: []string{"Bon", "jour"}, Usage: smg.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}},
+		smgtest.Reply{ToolCalls: []smg.ToolCall{{ID: "call_9", Type: "function", Function: smg.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}}},
+	)
+	events := make(recorder, 100)
+	session, err := NewSession(mock, SessionConfig{Model: "m"}, events.send)
+	if err != nil {
+		t.Fatalf("NewSession error: %v", err)
+	}
+	defer session.Close()
+	if _, created := events.until(t, "session.created"); created["session"].(map[string]interface{})["model"] != "m" {
+		t.Errorf("session.created = %v", created)
+	}
+
+	for _, event := range []string{
+		`{"type":"session.update","session":{"instructions":"Be brief.","tools":[{"type":"function","name":"weather","parameters":{"type":"object"}}]}}`,
+		`{"type":"input_text_buffer.append","delta":"Hel"}`,
+		`{"type":"input_text_buffer.append","delta":"lo"}`,
+		`{"type":"input_text_buffer.commit"}`,
+		`{"type":"response.create"}`,
+	} {
+		if err := session.Handle([]byte(event)); err != nil {
+			t.Fatalf("Handle(%s) error: %v", event, err)
+		}
+	}
+	types, done := events.until(t, "response.done")
+	want := []string{
+		"session.updated", "input_text_buffer.committed", "conversation.item.created",
+		"response.created", "response.output_item.added", "conversation.item.created", "response.content_part.added",
+		"response.text.delta", "response.text.delta",
+		"response.text.done", "response.content_part.done", "response.output_item.done", "response.done",
+	}
+	if strings.Join(types, " ") != strings.Join(want, " ") {
+		t.Errorf("events = %q, want %q", types, want)
+	}
+	resp := done["response"].(map[string]interface{})
+	output := resp["output"].([]interface{})[0].(map[string]interface{})
+	if resp["status"] != "completed" || output["content"].([]interface{})[0].(map[string]interface{})["text"] != "Bonjour" {
+		t.Errorf("response.done = %v", resp)
+	}
+	if usage := resp["usage"].(map[string]interface{}); usage["input_tokens"] != 5.0 || usage["output_tokens"] != 2.0 {
+		t.Errorf("usage = %v", usage)
+	}
+	req := mock.Requests()[0]
+	if len(req.Messages) != 2 || req.Messages[0].Content != "Be brief." || req.Messages[1].Content != "Hello" || len(req.Tools) != 1 {
+		t.Errorf("request = %+v", req)
+	}
+
+	session.Handle([]byte(`{"type":"response.create"}`))
+	_, done = events.until(t, "response.done")
+	call := done["response"].(map[string]interface{})["output"].([]interface{})[0].(map[string]interface{})
+	if call["type"] != "function_call" || call["call_id"] != "call_9" || call["arguments"] != `{"city":"Paris"}` {
+		t.Errorf("function call = %v", call)
+	}
+	session.Handle([]byte(`{"type":"conversation.item.create","item":{"type":"function_call_output","call_id":"call_9","output":"sunny"}}`))
+	events.until(t, "conversation.item.created")
+	mock.Enqueue(smgtest.Reply{Content: "Sunny."})
+	session.Handle([]byte(`{"type":"response.create"}`))
+	events.until(t, "response.done")
+	msgs := mock.Requests()[2].Messages
+	if len(msgs) != 4 || msgs[2].Content != "Bonjour" || msgs[2].ToolCalls[0].ID != "call_9" || msgs[3].ToolCallID != "call_9" {
+		t.Errorf("messages = %+v, want the call joined to the assistant message and its output replayed", msgs)
+	}
+}
+
+// TestCancel tests that a cancelled response ends as cancelled
+func TestCancel(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Chunks: []string{"a", "b"}, ChunkDelay: time.Minute})
+	events := make(recorder, 100)
+	session, _ := NewSession(mock, SessionConfig{}, events.send)
+	defer session.Close()
+
+	session.Handle([]byte(`{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"Hi"}]}}`))
+	session.Handle([]byte(`{"type":"response.create"}`))
+	events.until(t, "response.text.delta")
+	session.Handle([]byte(`{"type":"response.create"}`))
+	if _, e := events.until(t, "error"); e["error"].(map[string]interface{})["code"] != "conversation_already_has_active_response" {
+		t.Errorf("second response.create error = %v", e)
+	}
+	session.Handle([]byte(`{"type":"response.cancel"}`))
+	_, done := events.until(t, "response.done")
+	resp := done["response"].(map[string]interface{})
+	if resp["status"] != "cancelled" || resp["output"].([]interface{})[0].(map[string]interface{})["status"] != "incomplete" {
+		t.Errorf("response.done = %v", resp)
+	}
+}
+
+// TestInvalidEvents tests the error events for unsupported input
+func TestInvalidEvents(t *testing.T) {
+	events := make(recorder, 100)
+	session, _ := NewSession(smgtest.NewMockClient(), SessionConfig{}, events.send)
+	defer session.Close()
+	for event, code := range map[string]string{
+		`not json`: "invalid_json",
+		`{"type":"input_audio_buffer.append","audio":""}`:                                                                "unsupported_event",
+		`{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_audio"}]}}`: "invalid_value",
+		`{"type":"conversation.item.delete","item_id":"item_404"}`:                                                       "item_not_found",
+		`{"type":"session.update","session":{"max_response_output_tokens":-1}}`:                                          "invalid_value",
+		`{"type":"input_text_buffer.commit"}`:                                                                            "input_text_buffer_commit_empty",
+		`{"type":"response.cancel","event_id":"evt_1"}`:                                                                  "response_cancel_not_active",
+		`{"type":"bogus"}`: "invalid_event_type",
+	} {
+		session.Handle([]byte(event))
+		_, e := events.until(t, "error")
+		if got := e["error"].(map[string]interface{})["code"]; got != code {
+			t.Errorf("%s: code = %v, want %s", event, got, code)
+		}
+	}
+}
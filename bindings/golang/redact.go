@@ -0,0 +1,382 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides redaction of personal data in prompts.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PIIPattern is a kind of personal data and the pattern matching it.
+type PIIPattern struct {
+	// Name names the placeholders of matches, e.g. "EMAIL" for "[EMAIL_1]".
+	// It may hold letters, digits, and underscores.
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// Patterns of DefaultPIIPatterns, shared with PIIGuardrail
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	cardPattern  = regexp.MustCompile(`\b(?:\d[ -]?){13,16}\b`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b`)
+)
+
+// DefaultPIIPatterns returns patterns for email addresses, US Social
+// Security numbers, payment card numbers, and phone numbers, the data
+// PIIGuardrail detects.
+func DefaultPIIPatterns() []PIIPattern {
+	return []PIIPattern{
+		{Name: "EMAIL", Pattern: emailPattern},
+		{Name: "SSN", Pattern: ssnPattern},
+		{Name: "CARD", Pattern: cardPattern},
+		{Name: "PHONE", Pattern: phonePattern},
+	}
+}
+
+// Redactor replaces personal data in the text of messages with placeholders
+// such as "[EMAIL_1]". Patterns are applied in order, so list specific
+// patterns before general ones. Set Roles to redact only some messages,
+// e.g. "user".
+//
+//	redactor := smg.PIIRedactor()
+//	redactor.Patterns = append(redactor.Patterns, smg.PIIPattern{
+//	    Name:    "ACCOUNT",
+//	    Pattern: regexp.MustCompile(`\bACC-\d{8}\b`),
+//	})
+type Redactor struct {
+	Patterns []PIIPattern
+	Roles    []string
+}
+
+// PIIRedactor returns a Redactor for DefaultPIIPatterns.
+func PIIRedactor() *Redactor {
+	return &Redactor{Patterns: DefaultPIIPatterns()}
+}
+
+// Redaction maps the placeholders of one request to the values they
+// replaced. Equal values share a placeholder.
+type Redaction struct {
+	values map[string]string
+	// placeholders maps values to their placeholders
+	placeholders map[string]string
+	counts       map[string]int
+	// longest is the length of the longest placeholder
+	longest int
+}
+
+func newRedaction() *Redaction {
+	return &Redaction{values: map[string]string{}, placeholders: map[string]string{}, counts: map[string]int{}}
+}
+
+// Len returns the number of distinct values redacted.
+func (r *Redaction) Len() int {
+	return len(r.values)
+}
+
+// placeholder returns the placeholder of value, a match of the pattern
+// named name
+func (r *Redaction) placeholder(name, value string) string {
+	if p, ok := r.placeholders[value]; ok {
+		return p
+	}
+	r.counts[name]++
+	p := fmt.Sprintf("[%s_%d]", name, r.counts[name])
+	r.placeholders[value] = p
+	r.values[p] = value
+	if len(p) > r.longest {
+		r.longest = len(p)
+	}
+	return p
+}
+
+// Restore replaces the placeholders in text with the values they replaced.
+func (r *Redaction) Restore(text string) string {
+	if len(r.values) == 0 || !strings.Contains(text, "[") {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(p string) string {
+		if value, ok := r.values[p]; ok {
+			return value
+		}
+		return p
+	})
+}
+
+// placeholderPattern matches placeholders of any pattern name
+var placeholderPattern = regexp.MustCompile(`\[[A-Za-z0-9_]+_\d+\]`)
+
+// RedactText returns text with personal data replaced, e.g. for logging.
+func (r *Redactor) RedactText(text string) string {
+	return r.redact(text, newRedaction())
+}
+
+func (r *Redactor) redact(text string, redaction *Redaction) string {
+	for _, p := range r.Patterns {
+		text = p.Pattern.ReplaceAllStringFunc(text, func(value string) string {
+			return redaction.placeholder(p.Name, value)
+		})
+	}
+	return text
+}
+
+// RedactRequest returns a copy of req with personal data in the text of its
+// messages replaced, and the mapping that restores it. req is not modified.
+func (r *Redactor) RedactRequest(req ChatCompletionRequest) (ChatCompletionRequest, *Redaction) {
+	redaction := newRedaction()
+	req.Messages = mapMessages(req.Messages, r.Roles, func(text string) string {
+		return r.redact(text, redaction)
+	})
+	return req, redaction
+}
+
+// mapMessages returns a copy of messages with f applied to the text of
+// those with one of roles, or of all if roles is empty
+func mapMessages(messages []ChatMessage, roles []string, f func(string) string) []ChatMessage {
+	out := make([]ChatMessage, len(messages))
+	for i, msg := range messages {
+		if len(roles) == 0 || containsString(roles, msg.Role) {
+			msg.Content = mapContentText(msg.Content, f)
+		}
+		out[i] = msg
+	}
+	return out
+}
+
+// mapContentText returns content with f applied to its text: a string, or
+// the text parts of a list of content parts
+func mapContentText(content interface{}, f func(string) string) interface{} {
+	switch content := content.(type) {
+	case string:
+		return f(content)
+	case []ContentPart:
+		out := make([]ContentPart, len(content))
+		for i, part := range content {
+			if part.Type == "text" {
+				part.Text = f(part.Text)
+			}
+			out[i] = part
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(content))
+		for i, part := range content {
+			if m, ok := part.(map[string]interface{}); ok {
+				if text, ok := m["text"].(string); ok {
+					copied := make(map[string]interface{}, len(m))
+					for k, v := range m {
+						copied[k] = v
+					}
+					copied["text"] = f(text)
+					part = copied
+				}
+			}
+			out[i] = part
+		}
+		return out
+	}
+	return content
+}
+
+// RedactionOptions controls WithRedaction.
+type RedactionOptions struct {
+	// Restore replaces the placeholders in responses with the values they
+	// replaced, so that callers see the model refer to the original data.
+	// The content and tool call arguments of responses are restored, and
+	// the content of streams.
+	Restore bool
+}
+
+// WithRedaction returns a middleware that replaces personal data in
+// requests before they reach next: the backend and any middleware, such as
+// WithStore, between them. Without Restore, responses keep the
+// placeholders.
+func WithRedaction(redactor *Redactor, opts RedactionOptions) ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &redactingClient{next: next, redactor: redactor, restore: opts.Restore}
+	}
+}
+
+// WithRedactionFor returns a middleware that shows observer, e.g. a logging
+// or metrics middleware, requests with personal data replaced, while the
+// backend receives the original requests. Responses are not redacted.
+//
+//	client = smg.WithRedactionFor(smg.PIIRedactor(), smg.WithStore(store, smg.StoreOptions{}))(client)
+func WithRedactionFor(redactor *Redactor, observer ChatMiddleware) ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &redactingClient{next: observer(&unredactingClient{next: next}), redactor: redactor, carry: true}
+	}
+}
+
+// redactionKey is the context key of the Redaction of a request
+type redactionKey struct{}
+
+// redactingClient redacts requests to next
+type redactingClient struct {
+	next     ChatClient
+	redactor *Redactor
+	// restore restores placeholders in responses
+	restore bool
+	// carry passes the Redaction to an unredactingClient in the context
+	carry bool
+}
+
+func (c *redactingClient) redact(ctx context.Context, req ChatCompletionRequest) (context.Context, ChatCompletionRequest, *Redaction) {
+	req, redaction := c.redactor.RedactRequest(req)
+	if c.carry {
+		ctx = context.WithValue(ctx, redactionKey{}, redaction)
+	}
+	return ctx, req, redaction
+}
+
+func (c *redactingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	ctx, req, redaction := c.redact(ctx, req)
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	if err != nil || !c.restore || redaction.Len() == 0 {
+		return resp, err
+	}
+	restored := *resp
+	restored.Choices = make([]Choice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choice.Message.Content = redaction.Restore(choice.Message.Content)
+		if len(choice.Message.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(choice.Message.ToolCalls))
+			for j, call := range choice.Message.ToolCalls {
+				call.Function.Arguments = redaction.Restore(call.Function.Arguments)
+				calls[j] = call
+			}
+			choice.Message.ToolCalls = calls
+		}
+		restored.Choices[i] = choice
+	}
+	return &restored, nil
+}
+
+func (c *redactingClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	ctx, req, redaction := c.redact(ctx, req)
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil || !c.restore || redaction.Len() == 0 {
+		return stream, err
+	}
+	return &restoringStream{ChatStream: stream, redaction: redaction, held: map[int]string{}}, nil
+}
+
+// unredactingClient restores the requests redacted by the redactingClient
+// of WithRedactionFor before they reach next
+type unredactingClient struct {
+	next ChatClient
+}
+
+func (c *unredactingClient) unredact(ctx context.Context, req ChatCompletionRequest) ChatCompletionRequest {
+	if redaction, ok := ctx.Value(redactionKey{}).(*Redaction); ok && redaction.Len() > 0 {
+		req.Messages = mapMessages(req.Messages, nil, redaction.Restore)
+	}
+	return req
+}
+
+func (c *unredactingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	return c.next.CreateChatCompletion(ctx, c.unredact(ctx, req))
+}
+
+func (c *unredactingClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	return c.next.CreateChatCompletionStream(ctx, c.unredact(ctx, req))
+}
+
+// restoringStream restores placeholders in the content of a stream. A
+// placeholder may be split across chunks, so text that may begin one is
+// held back until it is complete.
+type restoringStream struct {
+	ChatStream
+	redaction *Redaction
+	// held is the text held back of each choice
+	held map[int]string
+	// last is the last chunk, whose ID and model a final chunk of held text
+	// repeats
+	last ChatCompletionStreamResponse
+	done bool
+}
+
+func (s *restoringStream) RecvJSON() (string, error) {
+	if s.done {
+		return "", io.EOF
+	}
+	chunkJSON, err := s.ChatStream.RecvJSON()
+	if err == io.EOF {
+		s.done = true
+		if len(s.held) > 0 {
+			return s.flush(), nil
+		}
+		return "", io.EOF
+	}
+	if err != nil {
+		return chunkJSON, err
+	}
+	var chunk ChatCompletionStreamResponse
+	if json.Unmarshal([]byte(chunkJSON), &chunk) != nil {
+		return chunkJSON, nil
+	}
+	s.last = chunk
+	changed := false
+	for i, choice := range chunk.Choices {
+		held := s.held[choice.Index]
+		if choice.Delta.Content == "" && (held == "" || choice.FinishReason == "") {
+			continue
+		}
+		text := held + choice.Delta.Content
+		held = ""
+		if choice.FinishReason == "" {
+			text, held = splitPartialPlaceholder(text, s.redaction.longest)
+		}
+		if held != "" {
+			s.held[choice.Index] = held
+		} else {
+			delete(s.held, choice.Index)
+		}
+		restored := s.redaction.Restore(text)
+		if restored != choice.Delta.Content {
+			chunk.Choices[i].Delta.Content = restored
+			changed = true
+		}
+	}
+	if !changed {
+		return chunkJSON, nil
+	}
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return chunkJSON, nil
+	}
+	return string(data), nil
+}
+
+// flush returns a chunk with the text held back when the stream ended
+func (s *restoringStream) flush() string {
+	chunk := ChatCompletionStreamResponse{ID: s.last.ID, Object: s.last.Object, Created: s.last.Created, Model: s.last.Model}
+	indices := make([]int, 0, len(s.held))
+	for index := range s.held {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		chunk.Choices = append(chunk.Choices, StreamChoice{Index: index, Delta: MessageDelta{Content: s.redaction.Restore(s.held[index])}})
+	}
+	s.held = nil
+	data, _ := json.Marshal(chunk)
+	return string(data)
+}
+
+// splitPartialPlaceholder splits text before a trailing "[" that may begin a
+// placeholder of at most longest bytes
+func splitPartialPlaceholder(text string, longest int) (string, string) {
+	i := strings.LastIndexByte(text, '[')
+	if i < 0 || strings.IndexByte(text[i:], ']') >= 0 || len(text)-i >= longest {
+		return text, ""
+	}
+	return text[:i], text[i:]
+}
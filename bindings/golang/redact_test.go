@@ -0,0 +1,120 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestRedactRequest tests placeholders and restoring them
+func TestRedactRequest(t *testing.T) {
+	redactor := PIIRedactor()
+	redactor.Patterns = append([]PIIPattern{{Name: "ACCOUNT", Pattern: regexp.MustCompile(`\bACC-\d{8}\b`)}}, redactor.Patterns...)
+	req := ChatCompletionRequest{Messages: []ChatMessage{
+		SystemText("Support bot."),
+		UserText("I'm ana@example.com, account ACC-12345678. Call 555-123-4567 or mail ana@example.com."),
+		UserParts(TextPart("Card 4111 1111 1111 1111"), ImagePart("https://example.com/receipt.png")),
+	}}
+
+	redacted, redaction := redactor.RedactRequest(req)
+	want := "I'm [EMAIL_1], account [ACCOUNT_1]. Call [PHONE_1] or mail [EMAIL_1]."
+	if got := redacted.Messages[1].Content; got != want {
+		t.Errorf("redacted message = %q, want %q", got, want)
+	}
+	if got := redacted.Messages[2].Content.([]ContentPart)[0].Text; got != "Card [CARD_1]" {
+		t.Errorf("redacted part = %q", got)
+	}
+	if redaction.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", redaction.Len())
+	}
+	if got := redaction.Restore(want + " [EMAIL_9]"); got != req.Messages[1].Content.(string)+" [EMAIL_9]" {
+		t.Errorf("Restore() = %q", got)
+	}
+	if req.Messages[1].Content != "I'm ana@example.com, account ACC-12345678. Call 555-123-4567 or mail ana@example.com." {
+		t.Error("RedactRequest() modified its input")
+	}
+}
+
+// TestWithRedaction tests that the backend sees placeholders and the caller
+// the original data
+func TestWithRedaction(t *testing.T) {
+	var sent string
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		sent = req.Messages[0].Content.(string)
+		return &ChatCompletionResponse{Choices: []Choice{{Message: Message{Content: "I emailed [EMAIL_1]."}}}}, nil
+	})
+	req := ChatCompletionRequest{Messages: []ChatMessage{UserText("Email bob@example.com")}}
+
+	resp, err := WithRedaction(PIIRedactor(), RedactionOptions{Restore: true})(inner).CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != "Email [EMAIL_1]" || resp.Choices[0].Message.Content != "I emailed bob@example.com." {
+		t.Errorf("sent %q, received %q", sent, resp.Choices[0].Message.Content)
+	}
+
+	resp, _ = WithRedaction(PIIRedactor(), RedactionOptions{})(inner).CreateChatCompletion(context.Background(), req)
+	if resp.Choices[0].Message.Content != "I emailed [EMAIL_1]." {
+		t.Errorf("received %q without Restore", resp.Choices[0].Message.Content)
+	}
+}
+
+// TestRedactionStream tests restoring placeholders split across chunks
+func TestRedactionStream(t *testing.T) {
+	client := &streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"Sent to [EM"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"AIL_1] and"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{"content":" [PH"}}]}`,
+	}}}
+	stream, err := WithRedaction(PIIRedactor(), RedactionOptions{Restore: true})(client).CreateChatCompletionStream(context.Background(),
+		ChatCompletionRequest{Messages: []ChatMessage{UserText("Email bob@example.com")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var chunk ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+		}
+	}
+	if got := text.String(); got != "Sent to bob@example.com and [PH" {
+		t.Errorf("stream text = %q", got)
+	}
+}
+
+// TestWithRedactionFor tests that an observer sees placeholders while the
+// backend sees the original data
+func TestWithRedactionFor(t *testing.T) {
+	var observed, sent string
+	observer := func(next ChatClient) ChatClient {
+		return funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+			observed = req.Messages[0].Content.(string)
+			return next.CreateChatCompletion(ctx, req)
+		})
+	}
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		sent = req.Messages[0].Content.(string)
+		return &ChatCompletionResponse{}, nil
+	})
+	client := WithRedactionFor(PIIRedactor(), observer)(inner)
+	if _, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{Messages: []ChatMessage{UserText("SSN 123-45-6789")}}); err != nil {
+		t.Fatal(err)
+	}
+	if observed != "SSN [SSN_1]" || sent != "SSN 123-45-6789" {
+		t.Errorf("observed %q, sent %q", observed, sent)
+	}
+}
@@ -0,0 +1,155 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides a registry routing requests to providers by model ID.
+package smg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry routes chat requests to the clients of named providers by model
+// IDs of the form "provider/model", such as "smg/llama3-70b" or
+// "openai/gpt-4o", so that one entry point reaches SMG pools and HTTP APIs
+// alike:
+//
+//	registry := smg.NewRegistry()
+//	registry.Register("smg", multiClient)
+//	registry.Register("openai", openaiHTTPClient)
+//	resp, err := registry.Chat(ctx, "openai/gpt-4o", req)
+//
+// The provider's client receives the request with Model set to the part of
+// the ID after the provider name, which may itself contain slashes, as in
+// "smg/meta-llama/Llama-3.1-8B-Instruct". Responses name the model as the
+// provider reports it.
+//
+// Registry is a ChatClient routing on the request's Model, so middleware
+// and servers such as smghttp accept it. Unknown providers fail with
+// ErrInvalidRequest.
+//
+// Thread-safe: All methods are safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]ChatClient
+}
+
+var _ ChatClient = (*Registry)(nil)
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]ChatClient)}
+}
+
+// Register adds the provider name served by client, replacing any provider
+// registered under name. The name must be non-empty and must not contain
+// "/".
+func (r *Registry) Register(name string, client ChatClient) error {
+	if name == "" || strings.Contains(name, "/") {
+		return invalidRequest(fmt.Sprintf("invalid provider name %q", name))
+	}
+	if client == nil {
+		return invalidRequest(fmt.Sprintf("provider %q has no client", name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = client
+	return nil
+}
+
+// Unregister removes the provider name, if registered.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.providers, name)
+}
+
+// Providers returns the names of the registered providers, sorted.
+func (r *Registry) Providers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the client of the provider named by model and the model
+// name to send it.
+func (r *Registry) Resolve(model string) (ChatClient, string, error) {
+	name, providerModel, ok := strings.Cut(model, "/")
+	if !ok || name == "" || providerModel == "" {
+		return nil, "", invalidRequest(fmt.Sprintf("model %q is not of the form provider/model", model))
+	}
+	r.mu.RLock()
+	client, ok := r.providers[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, "", invalidRequest(fmt.Sprintf("unknown provider %q in model %q", name, model))
+	}
+	return client, providerModel, nil
+}
+
+// Chat sends req to the provider of model, which overrides req.Model.
+func (r *Registry) Chat(ctx context.Context, model string, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req.Model = model
+	return r.CreateChatCompletion(ctx, req)
+}
+
+// ChatStream is Chat for streaming requests.
+func (r *Registry) ChatStream(ctx context.Context, model string, req ChatCompletionRequest) (ChatStream, error) {
+	req.Model = model
+	return r.CreateChatCompletionStream(ctx, req)
+}
+
+// CreateChatCompletion sends req to the provider named by req.Model.
+func (r *Registry) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	client, model, err := r.Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = model
+	return client.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream sends the streaming req to the provider named
+// by req.Model.
+func (r *Registry) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	client, model, err := r.Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	req.Model = model
+	return client.CreateChatCompletionStream(ctx, req)
+}
+
+// ListModels returns the models of the providers whose clients implement
+// ListModels, with IDs prefixed by the provider name so that they can be
+// used with the registry. The first provider that fails fails the listing.
+func (r *Registry) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	for _, name := range r.Providers() {
+		r.mu.RLock()
+		client, ok := r.providers[name]
+		r.mu.RUnlock()
+		lister, canList := client.(interface {
+			ListModels(ctx context.Context) ([]ModelInfo, error)
+		})
+		if !ok || !canList {
+			continue
+		}
+		infos, err := lister.ListModels(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing models of provider %q: %w", name, err)
+		}
+		for _, info := range infos {
+			info.ID = name + "/" + info.ID
+			models = append(models, info)
+		}
+	}
+	return models, nil
+}
@@ -0,0 +1,57 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// listingClient is a funcClient that also lists models
+type listingClient struct {
+	funcClient
+	models []ModelInfo
+}
+
+func (c listingClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return c.models, nil
+}
+
+// TestRegistry tests routing by provider, model names with slashes, and
+// unknown providers
+func TestRegistry(t *testing.T) {
+	var got []string
+	provider := func(name string) funcClient {
+		return func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+			got = append(got, name+":"+req.Model)
+			return &ChatCompletionResponse{Model: req.Model}, nil
+		}
+	}
+	registry := NewRegistry()
+	registry.Register("smg", listingClient{provider("smg"), []ModelInfo{{ID: "llama3-70b"}}})
+	registry.Register("openai", provider("openai"))
+
+	ctx := context.Background()
+	registry.Chat(ctx, "openai/gpt-4o", ChatCompletionRequest{Model: "ignored"})
+	registry.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "smg/meta-llama/Llama-3.1-8B"})
+	if len(got) != 2 || got[0] != "openai:gpt-4o" || got[1] != "smg:meta-llama/Llama-3.1-8B" {
+		t.Errorf("requests = %q", got)
+	}
+
+	for _, model := range []string{"gpt-4o", "anthropic/claude", "smg/", "/gpt-4o"} {
+		if _, err := registry.Chat(ctx, model, ChatCompletionRequest{}); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("Chat(%q) error = %v, want ErrInvalidRequest", model, err)
+		}
+	}
+	if err := registry.Register("a/b", provider("x")); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Register(a/b) error = %v, want ErrInvalidRequest", err)
+	}
+
+	models, err := registry.ListModels(ctx)
+	if err != nil || len(models) != 1 || models[0].ID != "smg/llama3-70b" {
+		t.Errorf("ListModels() = %+v, %v", models, err)
+	}
+	registry.Unregister("openai")
+	if providers := registry.Providers(); len(providers) != 1 || providers[0] != "smg" {
+		t.Errorf("Providers() = %q after Unregister", providers)
+	}
+}
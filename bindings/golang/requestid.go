@@ -0,0 +1,38 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides request ID propagation to workers.
+package smg
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDMetadataKey is the gRPC metadata key that carries the request ID
+// to workers.
+const RequestIDMetadataKey = "x-request-id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying id. Calls made with the context
+// send id to the worker as x-request-id gRPC metadata, so a single ID can
+// trace a request from the caller (e.g. an HTTP X-Request-ID) to the worker.
+//
+// Example:
+//
+//	ctx := smg.WithRequestID(ctx, r.Header.Get("X-Request-ID"))
+//	resp, err := client.CreateChatCompletion(ctx, req)
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, id)
+}
+
+// RequestIDFromContext returns the request ID set by WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,32 @@
+package smg
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// TestWithRequestID tests that the request ID is readable and sent as outgoing gRPC metadata
+func TestWithRequestID(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-123")
+
+	if got := RequestIDFromContext(ctx); got != "req-123" {
+		t.Errorf("RequestIDFromContext() = %q, want %q", got, "req-123")
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		t.Fatal("WithRequestID() did not set outgoing metadata")
+	}
+	if got := md.Get(RequestIDMetadataKey); len(got) != 1 || got[0] != "req-123" {
+		t.Errorf("metadata %s = %v, want [req-123]", RequestIDMetadataKey, got)
+	}
+
+	empty := WithRequestID(context.Background(), "")
+	if got := RequestIDFromContext(empty); got != "" {
+		t.Errorf("RequestIDFromContext() after empty ID = %q, want empty", got)
+	}
+	if _, ok := metadata.FromOutgoingContext(empty); ok {
+		t.Error("WithRequestID() with empty ID should not set metadata")
+	}
+}
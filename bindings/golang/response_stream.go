@@ -0,0 +1,127 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides streaming of Responses API responses.
+package smg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Event types of a Responses API stream. Items, including MCP calls, tool
+// listings, and approval requests, arrive complete in
+// ResponseEventOutputItemDone; the MCP events report the progress of the
+// backend's calls as it runs them.
+const (
+	ResponseEventCreated                    = "response.created"
+	ResponseEventInProgress                 = "response.in_progress"
+	ResponseEventCompleted                  = "response.completed"
+	ResponseEventIncomplete                 = "response.incomplete"
+	ResponseEventFailed                     = "response.failed"
+	ResponseEventOutputItemAdded            = "response.output_item.added"
+	ResponseEventOutputItemDone             = "response.output_item.done"
+	ResponseEventOutputTextDelta            = "response.output_text.delta"
+	ResponseEventOutputTextDone             = "response.output_text.done"
+	ResponseEventFunctionCallArgumentsDelta = "response.function_call_arguments.delta"
+	ResponseEventFunctionCallArgumentsDone  = "response.function_call_arguments.done"
+	ResponseEventMCPCallArgumentsDelta      = "response.mcp_call_arguments.delta"
+	ResponseEventMCPCallArgumentsDone       = "response.mcp_call_arguments.done"
+	ResponseEventMCPCallInProgress          = "response.mcp_call.in_progress"
+	ResponseEventMCPCallCompleted           = "response.mcp_call.completed"
+	ResponseEventMCPCallFailed              = "response.mcp_call.failed"
+	ResponseEventMCPListToolsInProgress     = "response.mcp_list_tools.in_progress"
+	ResponseEventMCPListToolsCompleted      = "response.mcp_list_tools.completed"
+	ResponseEventMCPListToolsFailed         = "response.mcp_list_tools.failed"
+)
+
+// ResponseStreamEvent is an event of a Responses API stream. The fields set
+// depend on Type.
+type ResponseStreamEvent struct {
+	Type           string `json:"type"`
+	SequenceNumber int    `json:"sequence_number"`
+	OutputIndex    int    `json:"output_index"`
+	ItemID         string `json:"item_id,omitempty"`
+
+	// Delta is the text or arguments added by a ".delta" event
+	Delta string `json:"delta,omitempty"`
+	// Text and Arguments are complete in ".done" events
+	Text      string `json:"text,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+
+	// Item is the item of ResponseEventOutputItemAdded and
+	// ResponseEventOutputItemDone
+	Item *ResponseItem `json:"item,omitempty"`
+	// Response is the response so far of the "response.*" lifecycle events
+	Response *Response `json:"response,omitempty"`
+}
+
+// ResponseStream is a streaming Responses API response.
+type ResponseStream struct {
+	stream   *httpStream
+	response *Response
+	done     bool
+}
+
+// CreateResponseStream sends a streaming Responses API request. Cancelling
+// ctx or calling Close on the stream ends it.
+func (c *HTTPClient) CreateResponseStream(ctx context.Context, req ResponseRequest) (*ResponseStream, error) {
+	req.Stream = true
+	streamCtx, cancel := context.WithCancel(ctx)
+	resp, err := c.post(streamCtx, "/responses", req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &ResponseStream{
+		stream: &httpStream{body: resp.Body, reader: bufio.NewReader(resp.Body), ctx: streamCtx, cancel: cancel},
+	}, nil
+}
+
+// Recv returns the next event. It returns io.EOF after the response
+// completes, is incomplete, or fails; a failed response is reported by its
+// ResponseEventFailed event, whose Response has the error. An "error" event
+// is returned as a *ResponseError.
+func (s *ResponseStream) Recv() (*ResponseStreamEvent, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	for {
+		data, err := s.stream.RecvJSON()
+		if err != nil {
+			return nil, err
+		}
+		var event ResponseStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "":
+			continue
+		case "error":
+			var e ResponseError
+			json.Unmarshal([]byte(data), &e)
+			return nil, &e
+		case ResponseEventCompleted, ResponseEventIncomplete, ResponseEventFailed:
+			s.done = true
+		}
+		if event.Response != nil {
+			s.response = event.Response
+		}
+		return &event, nil
+	}
+}
+
+// Response returns the response as of the last lifecycle event received,
+// which after io.EOF is the final response, or nil before the first one.
+func (s *ResponseStream) Response() *Response {
+	return s.response
+}
+
+// Close ends the stream and cancels the request.
+func (s *ResponseStream) Close() error {
+	return s.stream.Close()
+}
@@ -0,0 +1,104 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestResponseStream tests a stream with an MCP tool listing and call
+func TestResponseStream(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","sequence_number":0,"response":{"id":"resp_1","status":"in_progress","output":[]}}`,
+		`{"type":"response.mcp_list_tools.in_progress","sequence_number":1,"output_index":0,"item_id":"mcpl_1"}`,
+		`{"type":"response.output_item.done","sequence_number":2,"output_index":0,"item":{"type":"mcp_list_tools","id":"mcpl_1","server_label":"docs","tools":[{"name":"search","input_schema":{"type":"object"}}]}}`,
+		`{"type":"response.mcp_call_arguments.delta","sequence_number":3,"output_index":1,"item_id":"mcp_1","delta":"{\"q\":"}`,
+		`{"type":"response.mcp_call.completed","sequence_number":4,"output_index":1,"item_id":"mcp_1"}`,
+		`{"type":"response.output_item.done","sequence_number":5,"output_index":1,"item":{"type":"mcp_call","id":"mcp_1","server_label":"docs","name":"search","arguments":"{\"q\":\"go\"}","output":"found","status":"completed"}}`,
+		`{"type":"response.output_text.delta","sequence_number":6,"output_index":2,"item_id":"msg_1","delta":"Found it."}`,
+		`{"type":"response.completed","sequence_number":7,"response":{"id":"resp_1","status":"completed","output":[],"usage":{"input_tokens":5,"output_tokens":3,"total_tokens":8}}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ResponseRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v1/responses" || !req.Stream || req.Tools[0].Type != "mcp" {
+			t.Errorf("request = %s %+v", r.URL.Path, req)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL + "/v1"})
+	stream, err := client.CreateResponseStream(context.Background(), ResponseRequest{
+		Model: "m",
+		Input: []ResponseItem{UserInput("Search the docs")},
+		Tools: []ResponseTool{MCPTool("docs", "https://docs.example.com/mcp", "never")},
+	})
+	if err != nil {
+		t.Fatalf("CreateResponseStream() error: %v", err)
+	}
+	defer stream.Close()
+
+	var received []*ResponseStreamEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() error: %v", err)
+		}
+		received = append(received, event)
+	}
+	if len(received) != len(events) {
+		t.Fatalf("got %d events, want %d", len(received), len(events))
+	}
+	if item := received[2].Item; item.Type != "mcp_list_tools" || len(item.Tools) != 1 || item.Tools[0].Name != "search" {
+		t.Errorf("tool listing = %+v", item)
+	}
+	if e := received[3]; e.Type != ResponseEventMCPCallArgumentsDelta || e.ItemID != "mcp_1" || e.Delta != `{"q":` {
+		t.Errorf("arguments delta = %+v", e)
+	}
+	if item := received[5].Item; item.Type != "mcp_call" || item.Output != "found" {
+		t.Errorf("call = %+v", item)
+	}
+	if resp := stream.Response(); resp == nil || resp.Status != "completed" || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Response() = %+v", resp)
+	}
+}
+
+// TestResponseStreamError tests that an error event ends the stream
+func TestResponseStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"type\":\"error\",\"code\":\"mcp_error\",\"message\":\"server unreachable\"}\n\n")
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL})
+	stream, err := client.CreateResponseStream(context.Background(), ResponseRequest{Model: "m"})
+	if err != nil {
+		t.Fatalf("CreateResponseStream() error: %v", err)
+	}
+	defer stream.Close()
+	_, err = stream.Recv()
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Code != "mcp_error" {
+		t.Errorf("Recv() error = %v, want the error event", err)
+	}
+}
+
+// TestMCPApprovalResponse tests the approval item sent back as input
+func TestMCPApprovalResponse(t *testing.T) {
+	data, _ := json.Marshal(MCPApprovalResponse("mcpr_1", false))
+	if want := `{"type":"mcp_approval_response","approval_request_id":"mcpr_1","approve":false}`; string(data) != want {
+		t.Errorf("MCPApprovalResponse() = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,213 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides the types of the Responses API.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ResponsesClient creates responses with the Responses API. Hosted tools such
+// as MCP servers are run by the backend, so it must be a gateway or provider
+// that serves them; HTTPClient implements it.
+type ResponsesClient interface {
+	CreateResponse(ctx context.Context, req ResponseRequest) (*Response, error)
+}
+
+// ResponseRequest is a Responses API request.
+type ResponseRequest struct {
+	Model        string         `json:"model"`
+	Input        []ResponseItem `json:"input"`
+	Instructions string         `json:"instructions,omitempty"`
+	Tools        []ResponseTool `json:"tools,omitempty"`
+	// ToolChoice is "auto", "none", "required", or an object naming a tool
+	ToolChoice        interface{}       `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool             `json:"parallel_tool_calls,omitempty"`
+	Temperature       *float32          `json:"temperature,omitempty"`
+	TopP              *float32          `json:"top_p,omitempty"`
+	MaxOutputTokens   *int              `json:"max_output_tokens,omitempty"`
+	Store             *bool             `json:"store,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	User              string            `json:"user,omitempty"`
+	// Stream is set by CreateResponseStream
+	Stream bool `json:"stream,omitempty"`
+}
+
+// ResponseTool is a tool of a Responses API request: a "function" tool the
+// caller runs, or an "mcp" tool the backend runs on an MCP server.
+type ResponseTool struct {
+	Type string `json:"type"`
+
+	// Function tool fields
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Strict      *bool                  `json:"strict,omitempty"`
+
+	// MCP tool fields
+	ServerLabel       string            `json:"server_label,omitempty"`
+	ServerURL         string            `json:"server_url,omitempty"`
+	ServerDescription string            `json:"server_description,omitempty"`
+	Authorization     string            `json:"authorization,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	// RequireApproval is "always", "never", or an object of tool filters
+	RequireApproval interface{} `json:"require_approval,omitempty"`
+	// AllowedTools is a list of tool names or an object of tool filters
+	AllowedTools interface{} `json:"allowed_tools,omitempty"`
+}
+
+// MCPTool returns an "mcp" tool for the server at url. Calls need approval
+// unless requireApproval is "never".
+func MCPTool(label, url, requireApproval string) ResponseTool {
+	tool := ResponseTool{Type: "mcp", ServerLabel: label, ServerURL: url}
+	if requireApproval != "" {
+		tool.RequireApproval = requireApproval
+	}
+	return tool
+}
+
+// ResponseItem is an input or output item: a "message", a "function_call" and
+// its "function_call_output", or an MCP item such as "mcp_call",
+// "mcp_list_tools", "mcp_approval_request", or "mcp_approval_response". Items
+// decoded from a response keep their JSON, so that sending them back as
+// input loses no fields.
+type ResponseItem struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	// Message fields. Content is a string or a list of content parts.
+	Role    string      `json:"role,omitempty"`
+	Content interface{} `json:"content,omitempty"`
+
+	// Call fields
+	CallID      string `json:"call_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Arguments   string `json:"arguments,omitempty"`
+	Output      string `json:"output,omitempty"`
+	ServerLabel string `json:"server_label,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// Approval fields
+	ApprovalRequestID string `json:"approval_request_id,omitempty"`
+	Approve           *bool  `json:"approve,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+
+	// Tools are the tools an MCP server offers, in "mcp_list_tools" items
+	Tools []MCPToolInfo `json:"tools,omitempty"`
+
+	// Summary is the summary of a "reasoning" item, whose Content holds the
+	// reasoning itself
+	Summary []ResponseContentPart `json:"summary,omitempty"`
+
+	raw json.RawMessage
+}
+
+// MarshalJSON returns the JSON an item was decoded from, if any.
+func (i ResponseItem) MarshalJSON() ([]byte, error) {
+	if i.raw != nil {
+		return i.raw, nil
+	}
+	type item ResponseItem
+	return json.Marshal(item(i))
+}
+
+// UnmarshalJSON decodes an item and keeps its JSON.
+func (i *ResponseItem) UnmarshalJSON(data []byte) error {
+	type item ResponseItem
+	var decoded item
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*i = ResponseItem(decoded)
+	i.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MCPToolInfo is a tool listed by an MCP server.
+type MCPToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+	Annotations map[string]interface{} `json:"annotations,omitempty"`
+}
+
+// MCPApprovalResponse returns the item answering an "mcp_approval_request"
+// item, to send back as input.
+func MCPApprovalResponse(approvalRequestID string, approve bool) ResponseItem {
+	return ResponseItem{Type: "mcp_approval_response", ApprovalRequestID: approvalRequestID, Approve: &approve}
+}
+
+// UserInput returns a user message item.
+func UserInput(text string) ResponseItem {
+	return ResponseItem{Type: "message", Role: "user", Content: text}
+}
+
+// Response is a Responses API response.
+type Response struct {
+	ID     string         `json:"id"`
+	Model  string         `json:"model"`
+	Status string         `json:"status"`
+	Output []ResponseItem `json:"output"`
+	Usage  ResponseUsage  `json:"usage"`
+	// Error is set when Status is "failed"
+	Error *ResponseError `json:"error,omitempty"`
+}
+
+// ResponseError is the error of a failed response.
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("response failed: %s: %s", e.Code, e.Message)
+}
+
+// ResponseUsage is the token usage of a response.
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// OutputText returns the text of the response's output messages.
+func (r *Response) OutputText() string {
+	var b strings.Builder
+	for _, item := range r.Output {
+		if item.Type != "message" {
+			continue
+		}
+		if text, ok := item.Content.(string); ok {
+			b.WriteString(text)
+			continue
+		}
+		parts, _ := itemParts(item.Content)
+		for _, part := range parts {
+			if part.Type == "output_text" {
+				b.WriteString(part.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+var _ ResponsesClient = (*HTTPClient)(nil)
+
+// CreateResponse sends a non-streaming Responses API request.
+func (c *HTTPClient) CreateResponse(ctx context.Context, req ResponseRequest) (*Response, error) {
+	resp, err := c.post(ctx, "/responses", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,448 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file converts between the Responses API and Chat Completions, so that
+// a gateway can accept either format and serve both with one client.
+package smg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ResponseContentPart is a part of the content of a message or reasoning
+// item: "input_text", "input_image", "output_text", "summary_text", or
+// "reasoning_text".
+type ResponseContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// ChatRequestFromResponses converts a Responses API request to a chat
+// completion request. Instructions become a leading system message and
+// function tools become chat tools. Hosted tools, such as "mcp" tools, need
+// a backend that runs them and return an error matching ErrInvalidRequest.
+func ChatRequestFromResponses(req ResponseRequest) (ChatCompletionRequest, error) {
+	messages, err := ChatMessagesFromResponseItems(req.Instructions, req.Input)
+	if err != nil {
+		return ChatCompletionRequest{}, err
+	}
+	chatReq := ChatCompletionRequest{
+		Model:               req.Model,
+		Messages:            messages,
+		Temperature:         req.Temperature,
+		TopP:                req.TopP,
+		MaxCompletionTokens: req.MaxOutputTokens,
+		Stream:              req.Stream,
+		User:                req.User,
+	}
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return ChatCompletionRequest{}, invalidRequest(fmt.Sprintf("%s tools are not supported by chat completions", tool.Type))
+		}
+		chatReq.Tools = append(chatReq.Tools, Tool{
+			Type:     "function",
+			Function: Function{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+	switch choice := req.ToolChoice.(type) {
+	case map[string]interface{}:
+		// {"type": "function", "name": ...} names the function at the top level
+		if name, ok := choice["name"].(string); ok && choice["type"] == "function" {
+			chatReq.ToolChoice = map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": name}}
+		} else {
+			chatReq.ToolChoice = choice
+		}
+	default:
+		chatReq.ToolChoice = choice
+	}
+	return chatReq, nil
+}
+
+// ResponsesRequestFromChat converts a chat completion request to a Responses
+// API request, the reverse of ChatRequestFromResponses.
+func ResponsesRequestFromChat(req ChatCompletionRequest) (ResponseRequest, error) {
+	instructions, items, err := ResponseItemsFromChatMessages(req.Messages)
+	if err != nil {
+		return ResponseRequest{}, err
+	}
+	respReq := ResponseRequest{
+		Model:           req.Model,
+		Input:           items,
+		Instructions:    instructions,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxOutputTokens: req.MaxCompletionTokens,
+		Stream:          req.Stream,
+		User:            req.User,
+	}
+	for _, tool := range req.Tools {
+		respReq.Tools = append(respReq.Tools, ResponseTool{
+			Type:        "function",
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	switch choice := req.ToolChoice.(type) {
+	case map[string]interface{}:
+		if fn, ok := choice["function"].(map[string]interface{}); ok {
+			respReq.ToolChoice = map[string]interface{}{"type": "function", "name": fn["name"]}
+		} else {
+			respReq.ToolChoice = choice
+		}
+	default:
+		respReq.ToolChoice = choice
+	}
+	return respReq, nil
+}
+
+// ChatMessagesFromResponseItems converts Responses API instructions, which
+// may be empty, and input items to chat messages. Consecutive function calls
+// join the assistant message before them, and a reasoning item becomes the
+// ReasoningContent of the assistant message after it. MCP calls the backend
+// ran become a tool call and its result; the other MCP items are dropped, as
+// they only concern the backend. Other item types return an error matching
+// ErrInvalidRequest.
+func ChatMessagesFromResponseItems(instructions string, items []ResponseItem) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	if instructions != "" {
+		messages = append(messages, SystemText(instructions))
+	}
+	reasoning := ""
+	// assistant returns the assistant message to add calls to: the last
+	// message if it is one without tool results after it, or a new one
+	assistant := func() *ChatMessage {
+		if last := len(messages) - 1; last < 0 || messages[last].Role != "assistant" {
+			messages = append(messages, ChatMessage{Role: "assistant", Content: ""})
+		}
+		msg := &messages[len(messages)-1]
+		if reasoning != "" {
+			msg.ReasoningContent, reasoning = reasoning, ""
+		}
+		return msg
+	}
+
+	for i, item := range items {
+		switch item.Type {
+		case "message", "":
+			msg, err := itemMessage(item)
+			if err != nil {
+				return nil, fmt.Errorf("input[%d]: %w", i, err)
+			}
+			if msg.Role == "assistant" {
+				prev := assistant()
+				*prev = mergeAssistant(*prev, msg)
+				continue
+			}
+			messages = append(messages, msg)
+		case "reasoning":
+			parts, err := itemParts(item.Content)
+			if err != nil {
+				return nil, fmt.Errorf("input[%d]: %w", i, err)
+			}
+			reasoning = partsText(parts, "reasoning_text")
+			if reasoning == "" {
+				reasoning = partsText(item.Summary, "summary_text")
+			}
+		case "function_call":
+			msg := assistant()
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: item.CallID, Type: "function", Function: FunctionCall{Name: item.Name, Arguments: item.Arguments}})
+		case "function_call_output":
+			messages = append(messages, ToolResult(item.CallID, item.Output))
+		case "mcp_call":
+			msg := assistant()
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: item.ID, Type: "function", Function: FunctionCall{Name: item.Name, Arguments: item.Arguments}})
+			output := item.Output
+			if item.Error != "" {
+				output = "Error: " + item.Error
+			}
+			messages = append(messages, ToolResult(item.ID, output))
+		case "mcp_list_tools", "mcp_approval_request", "mcp_approval_response":
+		default:
+			return nil, invalidRequest(fmt.Sprintf("input[%d]: unsupported item type %q", i, item.Type))
+		}
+	}
+	return messages, nil
+}
+
+// ResponseItemsFromChatMessages converts chat messages to Responses API
+// instructions and input items. The leading system and developer messages
+// become the instructions; later ones stay messages. An assistant message
+// becomes a reasoning item if it has ReasoningContent, a message if it has
+// content, and a function call per tool call; tool messages become function
+// call outputs.
+func ResponseItemsFromChatMessages(messages []ChatMessage) (string, []ResponseItem, error) {
+	var instructions []string
+	var items []ResponseItem
+	for i, msg := range messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := chatText(msg.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if len(items) == 0 {
+				instructions = append(instructions, text)
+				continue
+			}
+			items = append(items, ResponseItem{Type: "message", Role: msg.Role, Content: text})
+		case "user":
+			content, err := inputContent(msg.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			items = append(items, ResponseItem{Type: "message", Role: "user", Content: content})
+		case "assistant":
+			text, err := chatText(msg.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			items = append(items, assistantItems("", text, msg.ReasoningContent, msg.ToolCalls)...)
+		case "tool":
+			text, err := chatText(msg.Content)
+			if err != nil {
+				return "", nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			items = append(items, ResponseItem{Type: "function_call_output", CallID: msg.ToolCallID, Output: text})
+		default:
+			return "", nil, invalidRequest(fmt.Sprintf("messages[%d]: unsupported role %q", i, msg.Role))
+		}
+	}
+	return strings.Join(instructions, "\n\n"), items, nil
+}
+
+// ResponseFromChatCompletion converts the first choice of a chat completion
+// to a Responses API response. A completion cut off by the token limit is
+// "incomplete".
+func ResponseFromChatCompletion(resp *ChatCompletionResponse) *Response {
+	id := strings.TrimPrefix(resp.ID, "chatcmpl-")
+	out := &Response{
+		ID:     "resp_" + id,
+		Model:  resp.Model,
+		Status: "completed",
+		Output: []ResponseItem{},
+		Usage: ResponseUsage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			TotalTokens:  resp.Usage.TotalTokens,
+		},
+	}
+	if len(resp.Choices) == 0 {
+		return out
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason.IsTruncated() {
+		out.Status = "incomplete"
+	}
+	for _, item := range assistantItems(id, choice.Message.Content, choice.Message.ReasoningContent, choice.Message.ToolCalls) {
+		item.Status = "completed"
+		if item.Type == "reasoning" {
+			item.Status = ""
+		}
+		out.Output = append(out.Output, item)
+	}
+	return out
+}
+
+// ChatCompletionFromResponse converts a Responses API response to a chat
+// completion with one choice, the reverse of ResponseFromChatCompletion.
+// Items the backend ran, such as MCP calls, are left out.
+func ChatCompletionFromResponse(resp *Response) (*ChatCompletionResponse, error) {
+	messages, err := ChatMessagesFromResponseItems("", withoutHostedCalls(resp.Output))
+	if err != nil {
+		return nil, err
+	}
+	message := Message{Role: "assistant"}
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		text, _ := chatText(msg.Content)
+		message.Content += text
+		message.ReasoningContent += msg.ReasoningContent
+		message.ToolCalls = append(message.ToolCalls, msg.ToolCalls...)
+	}
+	finishReason := FinishReasonStop
+	switch {
+	case len(message.ToolCalls) > 0:
+		finishReason = FinishReasonToolCalls
+	case resp.Status == "incomplete":
+		finishReason = FinishReasonLength
+	}
+	return &ChatCompletionResponse{
+		ID:      "chatcmpl-" + strings.TrimPrefix(resp.ID, "resp_"),
+		Object:  "chat.completion",
+		Model:   resp.Model,
+		Choices: []Choice{{Message: message, FinishReason: finishReason}},
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// assistantItems returns the items of an assistant turn; id, if set, makes
+// the item IDs
+func assistantItems(id, text, reasoning string, calls []ToolCall) []ResponseItem {
+	var items []ResponseItem
+	if reasoning != "" {
+		item := ResponseItem{Type: "reasoning", Content: []ResponseContentPart{{Type: "reasoning_text", Text: reasoning}}}
+		if id != "" {
+			item.ID = "rs_" + id
+		}
+		items = append(items, item)
+	}
+	if text != "" {
+		item := ResponseItem{Type: "message", Role: "assistant", Content: []ResponseContentPart{{Type: "output_text", Text: text}}}
+		if id != "" {
+			item.ID = "msg_" + id
+		}
+		items = append(items, item)
+	}
+	for _, call := range calls {
+		item := ResponseItem{Type: "function_call", CallID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments}
+		if id != "" {
+			item.ID = "fc_" + call.ID
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// itemMessage converts a message item to a chat message
+func itemMessage(item ResponseItem) (ChatMessage, error) {
+	role := item.Role
+	if role == "" {
+		role = "user"
+	}
+	if text, ok := item.Content.(string); ok {
+		return ChatMessage{Role: role, Content: text}, nil
+	}
+	parts, err := itemParts(item.Content)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	var chatParts []ContentPart
+	hasImage := false
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			chatParts = append(chatParts, TextPart(part.Text))
+		case "input_image":
+			chatParts = append(chatParts, ImagePart(part.ImageURL))
+			hasImage = true
+		case "refusal":
+		default:
+			return ChatMessage{}, invalidRequest(fmt.Sprintf("unsupported content part %q", part.Type))
+		}
+	}
+	if hasImage {
+		if role != "user" {
+			return ChatMessage{}, invalidRequest("images are only supported in user messages")
+		}
+		return ChatMessage{Role: role, Content: chatParts}, nil
+	}
+	texts := make([]string, len(chatParts))
+	for i, part := range chatParts {
+		texts[i] = part.Text
+	}
+	return ChatMessage{Role: role, Content: strings.Join(texts, "")}, nil
+}
+
+// mergeAssistant appends the content of next to an assistant message
+func mergeAssistant(msg, next ChatMessage) ChatMessage {
+	text, _ := msg.Content.(string)
+	nextText, _ := next.Content.(string)
+	msg.Content = text + nextText
+	return msg
+}
+
+// itemParts returns the content parts of an item, whether decoded from JSON
+// or built as []ResponseContentPart
+func itemParts(content interface{}) ([]ResponseContentPart, error) {
+	switch content := content.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []ResponseContentPart{{Type: "input_text", Text: content}}, nil
+	case []ResponseContentPart:
+		return content, nil
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	var parts []ResponseContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, invalidRequest("content must be a string or a list of parts")
+	}
+	return parts, nil
+}
+
+// partsText joins the text of the parts of the given type
+func partsText(parts []ResponseContentPart, partType string) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == partType {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// inputContent converts user message content to a string or input parts
+func inputContent(content interface{}) (interface{}, error) {
+	switch content := content.(type) {
+	case string:
+		return content, nil
+	case []ContentPart:
+		parts := make([]ResponseContentPart, 0, len(content))
+		for _, p := range content {
+			switch {
+			case p.Type == "text":
+				parts = append(parts, ResponseContentPart{Type: "input_text", Text: p.Text})
+			case p.Type == "image_url" && p.ImageURL != nil:
+				parts = append(parts, ResponseContentPart{Type: "input_image", ImageURL: p.ImageURL.URL})
+			default:
+				return nil, invalidRequest(fmt.Sprintf("unsupported content part %q", p.Type))
+			}
+		}
+		return parts, nil
+	}
+	return nil, invalidRequest(fmt.Sprintf("unsupported content type %T", content))
+}
+
+// chatText returns message content that must be text
+func chatText(content interface{}) (string, error) {
+	switch content := content.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return content, nil
+	case []ContentPart:
+		var b strings.Builder
+		for _, p := range content {
+			if p.Type != "text" {
+				return "", invalidRequest(fmt.Sprintf("unsupported content part %q", p.Type))
+			}
+			b.WriteString(p.Text)
+		}
+		return b.String(), nil
+	}
+	return "", invalidRequest(fmt.Sprintf("unsupported content type %T", content))
+}
+
+// withoutHostedCalls returns the items except MCP calls, which the backend
+// ran and which are not part of a chat completion's message
+func withoutHostedCalls(items []ResponseItem) []ResponseItem {
+	var kept []ResponseItem
+	for _, item := range items {
+		if item.Type != "mcp_call" {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
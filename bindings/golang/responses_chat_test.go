@@ -0,0 +1,138 @@
+package smg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestResponseItemsChatMessages tests converting a tool-using conversation
+// with reasoning both ways
+func TestResponseItemsChatMessages(t *testing.T) {
+	call := ToolCall{ID: "call_1", Type: "function", Function: FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}
+	reasoned := AssistantToolCalls(call)
+	reasoned.ReasoningContent = "Need the weather."
+	messages := []ChatMessage{
+		SystemText("Be brief."),
+		UserImage("https://example.com/paris.png", "Weather here?"),
+		reasoned,
+		ToolResult("call_1", "sunny"),
+		AssistantText("Sunny."),
+	}
+
+	instructions, items, err := ResponseItemsFromChatMessages(messages)
+	if err != nil {
+		t.Fatalf("ResponseItemsFromChatMessages() error: %v", err)
+	}
+	data, _ := json.Marshal(items)
+	want := `[{"type":"message","role":"user","content":[{"type":"input_image","image_url":"https://example.com/paris.png"},{"type":"input_text","text":"Weather here?"}]},` +
+		`{"type":"reasoning","content":[{"type":"reasoning_text","text":"Need the weather."}]},` +
+		`{"type":"function_call","call_id":"call_1","name":"weather","arguments":"{\"city\":\"Paris\"}"},` +
+		`{"type":"function_call_output","call_id":"call_1","output":"sunny"},` +
+		`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Sunny."}]}]`
+	if instructions != "Be brief." || string(data) != want {
+		t.Errorf("ResponseItemsFromChatMessages() = %q,\n%s\nwant\n%s", instructions, data, want)
+	}
+
+	// Items decoded from JSON convert back like the ones built
+	var decoded []ResponseItem
+	json.Unmarshal(data, &decoded)
+	back, err := ChatMessagesFromResponseItems(instructions, decoded)
+	if err != nil {
+		t.Fatalf("ChatMessagesFromResponseItems() error: %v", err)
+	}
+	if !reflect.DeepEqual(back, messages) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", back, messages)
+	}
+
+	if _, err := ChatMessagesFromResponseItems("", []ResponseItem{{Type: "web_search_call"}}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("unsupported item error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// TestMCPCallItems tests that MCP calls become a call and its result, and
+// that the other MCP items are dropped
+func TestMCPCallItems(t *testing.T) {
+	messages, err := ChatMessagesFromResponseItems("", []ResponseItem{
+		UserInput("Search the docs"),
+		{Type: "mcp_list_tools", ServerLabel: "docs"},
+		{Type: "mcp_call", ID: "mcp_1", Name: "search", Arguments: `{}`, Error: "timeout"},
+	})
+	if err != nil {
+		t.Fatalf("ChatMessagesFromResponseItems() error: %v", err)
+	}
+	if len(messages) != 3 || messages[1].ToolCalls[0].ID != "mcp_1" || messages[2].Content != "Error: timeout" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+// TestRequestConversion tests tools and tool choice
+func TestRequestConversion(t *testing.T) {
+	maxTokens := 50
+	req := ResponseRequest{
+		Model:           "m",
+		Instructions:    "Be brief.",
+		Input:           []ResponseItem{UserInput("Hi")},
+		Tools:           []ResponseTool{{Type: "function", Name: "weather", Parameters: map[string]interface{}{"type": "object"}}},
+		ToolChoice:      map[string]interface{}{"type": "function", "name": "weather"},
+		MaxOutputTokens: &maxTokens,
+	}
+	chatReq, err := ChatRequestFromResponses(req)
+	if err != nil {
+		t.Fatalf("ChatRequestFromResponses() error: %v", err)
+	}
+	if len(chatReq.Messages) != 2 || chatReq.Tools[0].Function.Name != "weather" || *chatReq.MaxCompletionTokens != 50 {
+		t.Errorf("chat request = %+v", chatReq)
+	}
+	if choice, _ := json.Marshal(chatReq.ToolChoice); string(choice) != `{"function":{"name":"weather"},"type":"function"}` {
+		t.Errorf("chat tool choice = %s", choice)
+	}
+
+	back, err := ResponsesRequestFromChat(chatReq)
+	if err != nil {
+		t.Fatalf("ResponsesRequestFromChat() error: %v", err)
+	}
+	if back.Instructions != "Be brief." || len(back.Input) != 1 || back.Tools[0].Name != "weather" || !reflect.DeepEqual(back.ToolChoice, req.ToolChoice) {
+		t.Errorf("responses request = %+v", back)
+	}
+
+	req.Tools = append(req.Tools, MCPTool("docs", "https://docs.example.com/mcp", ""))
+	if _, err := ChatRequestFromResponses(req); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("mcp tool error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// TestResponseConversion tests converting completions to responses and back
+func TestResponseConversion(t *testing.T) {
+	completion := &ChatCompletionResponse{
+		ID:    "chatcmpl-42",
+		Model: "m",
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: "Checking.", ReasoningContent: "Look it up.", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "weather", Arguments: "{}"}}}},
+			FinishReason: "tool_calls",
+		}},
+		Usage: Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+	}
+	resp := ResponseFromChatCompletion(completion)
+	if resp.ID != "resp_42" || resp.Status != "completed" || len(resp.Output) != 3 || resp.OutputText() != "Checking." || resp.Usage.TotalTokens != 8 {
+		t.Errorf("ResponseFromChatCompletion() = %+v", resp)
+	}
+	if types := []string{resp.Output[0].Type, resp.Output[1].Type, resp.Output[2].Type}; !reflect.DeepEqual(types, []string{"reasoning", "message", "function_call"}) {
+		t.Errorf("output types = %v", types)
+	}
+
+	back, err := ChatCompletionFromResponse(resp)
+	if err != nil {
+		t.Fatalf("ChatCompletionFromResponse() error: %v", err)
+	}
+	completion.Object = "chat.completion"
+	if !reflect.DeepEqual(back, completion) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", back, completion)
+	}
+
+	completion.Choices[0] = Choice{Message: Message{Role: "assistant", Content: "Long"}, FinishReason: "length"}
+	if resp := ResponseFromChatCompletion(completion); resp.Status != "incomplete" {
+		t.Errorf("status = %q, want incomplete", resp.Status)
+	}
+}
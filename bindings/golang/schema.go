@@ -0,0 +1,264 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file validates JSON values against JSON schemas.
+package smg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaViolation is a way in which a value does not match a schema.
+type SchemaViolation struct {
+	// Path locates the value, e.g. "$.topics[2]"
+	Path    string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// SchemaError lists the violations of a value that does not match a schema.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return "value does not match the schema: " + strings.Join(messages, "; ")
+}
+
+// ValidateSchema checks a JSON document against a JSON schema and returns a
+// *SchemaError listing every violation, or nil if it matches. It supports the
+// keywords of the schemas ToolFromFunc and Generate build ("type",
+// "properties", "required", "additionalProperties", "items", and "enum")
+// along with "const", "minimum", "maximum", "exclusiveMinimum",
+// "exclusiveMaximum", "minLength", "maxLength", "pattern", "minItems", and
+// "maxItems". Other keywords are ignored.
+func ValidateSchema(schema map[string]interface{}, document []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return err
+	}
+	var violations []SchemaViolation
+	validateValue(schema, value, "$", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// validateValue appends the violations of value at path to violations
+func validateValue(schema map[string]interface{}, value interface{}, path string, violations *[]SchemaViolation) {
+	violate := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		violate("must be %s, got %s", describeType(t), jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"]; ok && !inEnum(enum, value) {
+		violate("must be one of %s", describeEnum(enum))
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		violate("must be %s", describeValue(c))
+	}
+
+	switch value := value.(type) {
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && value < min {
+			violate("must be at least %v", min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && value > max {
+			violate("must be at most %v", max)
+		}
+		if min, ok := schemaNumber(schema, "exclusiveMinimum"); ok && value <= min {
+			violate("must be greater than %v", min)
+		}
+		if max, ok := schemaNumber(schema, "exclusiveMaximum"); ok && value >= max {
+			violate("must be less than %v", max)
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(value))
+		if min, ok := schemaNumber(schema, "minLength"); ok && n < min {
+			violate("must be at least %v characters", min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && n > max {
+			violate("must be at most %v characters", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				violate("must match %s", pattern)
+			}
+		}
+	case []interface{}:
+		n := float64(len(value))
+		if min, ok := schemaNumber(schema, "minItems"); ok && n < min {
+			violate("must have at least %v items", min)
+		}
+		if max, ok := schemaNumber(schema, "maxItems"); ok && n > max {
+			violate("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := value[name]; !ok {
+				violate("missing required property %q", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propPath := path + "." + name
+			if prop, ok := properties[name].(map[string]interface{}); ok {
+				validateValue(prop, value[name], propPath, violations)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					violate("unknown property %q", name)
+				}
+			case map[string]interface{}:
+				validateValue(additional, value[name], propPath, violations)
+			}
+		}
+	}
+}
+
+// matchesType reports whether value has the schema type t, a name or a list
+// of names
+func matchesType(t interface{}, value interface{}) bool {
+	for _, name := range schemaStrings(t) {
+		actual := jsonType(value)
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON schema type of a decoded value
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) && !math.IsInf(value, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func describeType(t interface{}) string {
+	return strings.Join(schemaStrings(t), " or ")
+}
+
+func inEnum(enum interface{}, value interface{}) bool {
+	for _, allowed := range schemaValues(enum) {
+		if jsonEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeEnum(enum interface{}) string {
+	values := schemaValues(enum)
+	described := make([]string, len(values))
+	for i, v := range values {
+		described[i] = describeValue(v)
+	}
+	return strings.Join(described, ", ")
+}
+
+func describeValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// jsonEqual compares values by their JSON, so that a schema built in Go
+// compares equal to the decoded document
+func jsonEqual(a, b interface{}) bool {
+	return describeValue(a) == describeValue(b)
+}
+
+// schemaNumber returns a numeric keyword of a schema built in Go or decoded
+// from JSON
+func schemaNumber(schema map[string]interface{}, keyword string) (float64, bool) {
+	switch n := schema[keyword].(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// schemaStrings returns a keyword that is a string or a list of strings
+func schemaStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var out []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// schemaValues returns a keyword that is a list of values
+func schemaValues(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	}
+	return nil
+}
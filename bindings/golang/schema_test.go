@@ -0,0 +1,63 @@
+package smg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestValidateSchema tests each supported keyword
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"age":   map[string]interface{}{"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"score": map[string]interface{}{"type": "number", "maximum": 1.0},
+			"kind":  map[string]interface{}{"const": "person"},
+			"tags": map[string]interface{}{
+				"type":     "array",
+				"items":    map[string]interface{}{"type": "string", "enum": []string{"a", "b"}},
+				"maxItems": 2,
+			},
+			"nick": map[string]interface{}{"type": []interface{}{"string", "null"}},
+		},
+		"required":             []string{"name", "age"},
+		"additionalProperties": false,
+	}
+
+	if err := ValidateSchema(schema, []byte(`{"name": "ann", "age": 30, "score": 1, "kind": "person", "tags": ["a"], "nick": null}`)); err != nil {
+		t.Errorf("ValidateSchema(valid) error: %v", err)
+	}
+
+	err := ValidateSchema(schema, []byte(`{"name": "A", "age": 150.5, "score": 2, "kind": "robot", "tags": ["a", "c", "b"], "nick": 1, "extra": true}`))
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("ValidateSchema(invalid) error = %v, want a SchemaError", err)
+	}
+	var got []string
+	for _, v := range schemaErr.Violations {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"$.age: must be integer, got number",
+		`$: unknown property "extra"`,
+		`$.kind: must be "person"`,
+		`$.name: must be at least 2 characters`,
+		`$.name: must match ^[a-z]+$`,
+		"$.nick: must be string or null, got integer",
+		"$.score: must be at most 1",
+		"$.tags: must have at most 2 items",
+		`$.tags[1]: must be one of "a", "b"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations =\n%q\nwant\n%q", got, want)
+	}
+
+	if err := ValidateSchema(schema, []byte(`{"name": "ann"}`)); err == nil || err.Error() != `value does not match the schema: $: missing required property "age"` {
+		t.Errorf("ValidateSchema(missing) error = %v", err)
+	}
+	if err := ValidateSchema(schema, []byte(`not json`)); err == nil || errors.As(err, &schemaErr) {
+		t.Errorf("ValidateSchema(not json) error = %v, want a syntax error", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file re-chunks streamed text into sentences or paragraphs.
+package smg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SentenceDelimiters end a sentence: terminal punctuation followed by
+// whitespace, so that "3.14" is not split, a line break, or full-width
+// punctuation, which needs no space.
+var SentenceDelimiters = []string{
+	". ", "! ", "? ", ".\n", "!\n", "?\n", "\n",
+	"。", "！", "？",
+}
+
+// ParagraphDelimiters end a paragraph.
+var ParagraphDelimiters = []string{"\n\n"}
+
+// SegmentOptions controls how text is split into segments.
+type SegmentOptions struct {
+	// Delimiters end a segment, which includes its delimiter. Defaults to
+	// SentenceDelimiters; use ParagraphDelimiters for paragraphs.
+	Delimiters []string
+	// MinLength, if positive, joins a segment shorter than this many bytes
+	// to the next, e.g. to keep a list marker such as "1." with its item.
+	MinLength int
+}
+
+// Segmenter splits text written in arbitrary pieces, such as token deltas,
+// into segments ending at a delimiter. Concatenating the segments, and the
+// text returned by Flush, gives back the text written.
+type Segmenter struct {
+	delimiters []string
+	minLength  int
+	buf        strings.Builder
+	// scanned is the length of the prefix of buf searched without finding a
+	// delimiter
+	scanned int
+}
+
+// NewSegmenter creates a segmenter.
+func NewSegmenter(opts SegmentOptions) *Segmenter {
+	delimiters := opts.Delimiters
+	if len(delimiters) == 0 {
+		delimiters = SentenceDelimiters
+	}
+	// Prefer the longest delimiter at a position, e.g. "\n\n" over "\n"
+	delimiters = append([]string(nil), delimiters...)
+	sort.SliceStable(delimiters, func(i, j int) bool { return len(delimiters[i]) > len(delimiters[j]) })
+	return &Segmenter{delimiters: delimiters, minLength: opts.MinLength}
+}
+
+// Write adds text and returns the segments it completes.
+func (s *Segmenter) Write(text string) []string {
+	s.buf.WriteString(text)
+	var segments []string
+	for {
+		text := s.buf.String()
+		end := s.nextEnd(text)
+		if end < 0 {
+			return segments
+		}
+		segments = append(segments, text[:end])
+		s.buf.Reset()
+		s.buf.WriteString(text[end:])
+		s.scanned = 0
+	}
+}
+
+// nextEnd returns the end of the first complete segment in text, or -1
+func (s *Segmenter) nextEnd(text string) int {
+	// A delimiter may have started before the unscanned text
+	start := s.scanned - s.maxDelimiter() + 1
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(text); i++ {
+		for _, d := range s.delimiters {
+			end := i + len(d)
+			// A delimiter does not end a segment of only whitespace, such
+			// as the second line break of a paragraph break
+			if strings.HasPrefix(text[i:], d) && end >= s.minLength && strings.TrimSpace(text[:end]) != "" {
+				return end
+			}
+		}
+	}
+	s.scanned = len(text)
+	return -1
+}
+
+func (s *Segmenter) maxDelimiter() int {
+	return len(s.delimiters[0])
+}
+
+// Flush returns the text after the last segment and resets the segmenter.
+func (s *Segmenter) Flush() string {
+	rest := s.buf.String()
+	s.buf.Reset()
+	s.scanned = 0
+	return rest
+}
+
+// Segment is a sentence or paragraph of a streamed choice.
+type Segment struct {
+	// Index is the choice the text belongs to
+	Index int
+	Text  string
+	// FinishReason is set on the last segment of a choice, whose Text is
+	// empty if the choice ended with a delimiter
+	FinishReason FinishReason
+}
+
+// SegmentStream re-chunks the text of a chat or text completion stream into
+// segments, for text-to-speech or for rendering a sentence at a time.
+//
+//	segments := smg.NewSegmentStream(stream, smg.SegmentOptions{})
+//	defer segments.Close()
+//	for {
+//	    seg, err := segments.Recv()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    ...
+//	    speak(seg.Text)
+//	}
+type SegmentStream struct {
+	stream     ChatStream
+	opts       SegmentOptions
+	segmenters map[int]*Segmenter
+	ready      []Segment
+	err        error
+}
+
+// NewSegmentStream creates a segment stream reading from stream.
+func NewSegmentStream(stream ChatStream, opts SegmentOptions) *SegmentStream {
+	return &SegmentStream{stream: stream, opts: opts, segmenters: map[int]*Segmenter{}}
+}
+
+// Recv returns the next segment, or io.EOF after the last. A choice's
+// remaining text is returned as a final segment when it finishes or the
+// stream ends, even without a delimiter. Segments of several choices are
+// returned in the order they complete.
+func (s *SegmentStream) Recv() (Segment, error) {
+	for len(s.ready) == 0 {
+		if s.err != nil {
+			return Segment{}, s.err
+		}
+		chunkJSON, err := s.stream.RecvJSON()
+		if err != nil {
+			s.err = err
+			if err == io.EOF {
+				s.flushAll()
+			}
+			continue
+		}
+		if err := s.add(chunkJSON); err != nil {
+			s.err = err
+		}
+	}
+	seg := s.ready[0]
+	s.ready = s.ready[1:]
+	return seg, nil
+}
+
+// add splits the text of a chat or text completion chunk
+func (s *SegmentStream) add(chunkJSON string) error {
+	var chunk struct {
+		Choices []struct {
+			Index int `json:"index"`
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			Text         string       `json:"text"`
+			FinishReason FinishReason `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return fmt.Errorf("failed to parse chunk: %w", err)
+	}
+	for _, choice := range chunk.Choices {
+		seg := s.segmenters[choice.Index]
+		if seg == nil {
+			seg = NewSegmenter(s.opts)
+			s.segmenters[choice.Index] = seg
+		}
+		for _, text := range seg.Write(choice.Delta.Content + choice.Text) {
+			s.ready = append(s.ready, Segment{Index: choice.Index, Text: text})
+		}
+		if choice.FinishReason != "" {
+			s.ready = append(s.ready, Segment{Index: choice.Index, Text: seg.Flush(), FinishReason: choice.FinishReason})
+			delete(s.segmenters, choice.Index)
+		}
+	}
+	return nil
+}
+
+// flushAll returns the remaining text of unfinished choices
+func (s *SegmentStream) flushAll() {
+	indices := make([]int, 0, len(s.segmenters))
+	for index := range s.segmenters {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		if rest := s.segmenters[index].Flush(); rest != "" {
+			s.ready = append(s.ready, Segment{Index: index, Text: rest})
+		}
+		delete(s.segmenters, index)
+	}
+}
+
+// Close closes the underlying stream.
+func (s *SegmentStream) Close() error {
+	return s.stream.Close()
+}
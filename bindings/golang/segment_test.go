@@ -0,0 +1,98 @@
+package smg
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSegmenter tests splitting text written in pieces into sentences and
+// paragraphs
+func TestSegmenter(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   SegmentOptions
+		pieces []string
+		want   []string
+		rest   string
+	}{
+		{
+			name:   "sentences across pieces",
+			pieces: []string{"Pi is 3", ".14. It", "'s irr", "ational!", " Right?", " Yes"},
+			want:   []string{"Pi is 3.14. ", "It's irrational! ", "Right? "},
+			rest:   "Yes",
+		},
+		{
+			name:   "line breaks",
+			pieces: []string{"One.\n", "\nTwo\nThree"},
+			want:   []string{"One.\n", "\nTwo\n"},
+			rest:   "Three",
+		},
+		{
+			name:   "full-width punctuation",
+			pieces: []string{"你好。", "再见！"},
+			want:   []string{"你好。", "再见！"},
+		},
+		{
+			name:   "paragraphs",
+			opts:   SegmentOptions{Delimiters: ParagraphDelimiters},
+			pieces: []string{"First. Still first.\n", "\nSecond.\n\n"},
+			want:   []string{"First. Still first.\n\n", "Second.\n\n"},
+		},
+		{
+			name:   "minimum length",
+			opts:   SegmentOptions{MinLength: 5},
+			pieces: []string{"1. Buy milk. 2. Eggs."},
+			want:   []string{"1. Buy milk. "},
+			rest:   "2. Eggs.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSegmenter(tt.opts)
+			var got []string
+			for _, piece := range tt.pieces {
+				got = append(got, s.Write(piece)...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %q, want %q", got, tt.want)
+			}
+			if rest := s.Flush(); rest != tt.rest {
+				t.Errorf("Flush() = %q, want %q", rest, tt.rest)
+			}
+			if strings.Join(got, "")+tt.rest != strings.Join(tt.pieces, "") {
+				t.Error("segments do not add up to the text written")
+			}
+		})
+	}
+}
+
+// TestSegmentStream tests segmenting chat chunks per choice
+func TestSegmentStream(t *testing.T) {
+	stream := NewSegmentStream(&fakeChatStream{chunks: []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hi. How"}}]}`,
+		`{"choices":[{"index":1,"delta":{"content":"Yo"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":" are you?"},"finish_reason":"stop"}]}`,
+	}}, SegmentOptions{})
+
+	var got []Segment
+	for {
+		seg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() error: %v", err)
+		}
+		got = append(got, seg)
+	}
+	want := []Segment{
+		{Index: 0, Text: "Hi. "},
+		{Index: 0, Text: "How are you?", FinishReason: "stop"},
+		{Index: 1, Text: "Yo"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("segments = %+v, want %+v", got, want)
+	}
+}
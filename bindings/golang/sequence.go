@@ -0,0 +1,41 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file numbers stream chunks.
+package smg
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sequencer numbers the chunks of a stream and serializes its reads, so the
+// numbers follow the order in which chunks are returned. Chunks are
+// numbered from 1 in their sequence_number field; see
+// ChatCompletionStreamResponse.SequenceNumber.
+type sequencer struct {
+	mu sync.Mutex
+	n  int64
+}
+
+// next returns the next chunk read with recv, numbered
+func (s *sequencer) next(recv func() (string, error)) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunkJSON, err := recv()
+	if err != nil || !strings.HasPrefix(chunkJSON, "{") {
+		return chunkJSON, err
+	}
+	s.n++
+	return withSequenceNumber(chunkJSON, s.n), nil
+}
+
+// withSequenceNumber adds a sequence_number field to a chunk, a JSON object,
+// without decoding it
+func withSequenceNumber(chunkJSON string, n int64) string {
+	rest := chunkJSON[1:]
+	if strings.TrimSpace(rest) != "}" {
+		rest = "," + rest
+	}
+	return `{"sequence_number":` + strconv.FormatInt(n, 10) + rest
+}
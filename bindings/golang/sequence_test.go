@@ -0,0 +1,85 @@
+package smg
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+)
+
+// TestSequencer tests numbering chunks in read order under concurrent reads
+func TestSequencer(t *testing.T) {
+	if got := withSequenceNumber(`{}`, 1); got != `{"sequence_number":1}` {
+		t.Errorf("withSequenceNumber({}) = %s", got)
+	}
+
+	var mu sync.Mutex
+	remaining := 100
+	recv := func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if remaining == 0 {
+			return "", io.EOF
+		}
+		remaining--
+		return `{"choices":[]}`, nil
+	}
+
+	var seq sequencer
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				chunkJSON, err := seq.next(recv)
+				if err != nil {
+					return
+				}
+				var chunk ChatCompletionStreamResponse
+				if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+					t.Errorf("chunk %s: %v", chunkJSON, err)
+					return
+				}
+				mu.Lock()
+				seen[chunk.SequenceNumber] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for n := int64(1); n <= 100; n++ {
+		if !seen[n] {
+			t.Fatalf("sequence number %d missing", n)
+		}
+	}
+}
+
+// TestCompletionStreamSequence tests that completion chunks are renumbered
+// after skipping chat chunks
+func TestCompletionStreamSequence(t *testing.T) {
+	stream := newCompletionStream(&fakeChatStream{chunks: []string{
+		`{"sequence_number":1,"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`{"sequence_number":2,"choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"sequence_number":3,"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}}, CompletionRequest{})
+
+	for want := int64(1); ; want++ {
+		chunkJSON, err := stream.RecvJSON()
+		if err == io.EOF {
+			if want != 3 {
+				t.Errorf("got %d chunks, want 2", want-1)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("RecvJSON() error: %v", err)
+		}
+		var chunk CompletionStreamResponse
+		json.Unmarshal([]byte(chunkJSON), &chunk)
+		if chunk.SequenceNumber != want {
+			t.Errorf("sequence number = %d, want %d", chunk.SequenceNumber, want)
+		}
+	}
+}
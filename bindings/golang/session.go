@@ -0,0 +1,99 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides backend sessions that keep the KV cache across turns.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultSessionCapacity is the capacity, in characters, of sessions opened
+// without SessionOptions.Capacity.
+const DefaultSessionCapacity = 1 << 16
+
+// SessionParams attaches a request to a backend session. The backend
+// prepends the prompt and output of the turn named by Rid to the request's
+// prompt, whose KV cache it kept, so only the new messages are sent and
+// prefilled.
+type SessionParams struct {
+	// ID is the session, as returned by OpenSession
+	ID string `json:"id"`
+	// Rid is the request ID of the turn to continue; empty starts the
+	// session over
+	Rid string `json:"rid,omitempty"`
+	// Offset, if set, keeps only this many tokens of the continued turn
+	Offset *int `json:"offset,omitempty"`
+	// Replace drops the other branches continuing the same turn
+	Replace bool `json:"replace,omitempty"`
+}
+
+// SessionOptions controls OpenSession.
+type SessionOptions struct {
+	// ID names the session; the backend picks one if empty
+	ID string
+	// Capacity bounds the length of the session's context, in characters.
+	// Defaults to DefaultSessionCapacity.
+	Capacity int
+}
+
+// SessionClient opens and closes backend sessions. HTTPClient implements it
+// for SGLang servers. The SGLang scheduler gRPC protocol has no session
+// calls, so Client and MultiClient do not.
+type SessionClient interface {
+	OpenSession(ctx context.Context, opts SessionOptions) (string, error)
+	CloseSession(ctx context.Context, id string) error
+}
+
+var _ SessionClient = (*HTTPClient)(nil)
+
+// OpenSession opens a session whose KV cache persists across turns, and
+// returns its ID. Requests join it with SessionParams, as a Conversation
+// with ConversationOptions.SessionID does. Close it with CloseSession to
+// free the cache.
+//
+// Sessions are served at the server root, so a base URL ending in "/v1" is
+// used without it.
+func (c *HTTPClient) OpenSession(ctx context.Context, opts SessionOptions) (string, error) {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultSessionCapacity
+	}
+	body := struct {
+		Capacity  int    `json:"capacity_of_str_len"`
+		SessionID string `json:"session_id,omitempty"`
+	}{opts.Capacity, opts.ID}
+	resp, err := c.postURL(ctx, c.rootURL()+"/open_session", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var id string
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		return "", fmt.Errorf("failed to decode session ID: %w", err)
+	}
+	if id == "" {
+		return "", fmt.Errorf("failed to open session %q", opts.ID)
+	}
+	return id, nil
+}
+
+// CloseSession closes the session id, releasing its KV cache.
+func (c *HTTPClient) CloseSession(ctx context.Context, id string) error {
+	body := struct {
+		SessionID string `json:"session_id"`
+	}{id}
+	resp, err := c.postURL(ctx, c.rootURL()+"/close_session", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// rootURL returns the base URL without its "/v1" API version
+func (c *HTTPClient) rootURL() string {
+	return strings.TrimSuffix(c.config.BaseURL, "/v1")
+}
@@ -0,0 +1,78 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHTTPClientSession tests opening and closing sessions at the server root
+func TestHTTPClientSession(t *testing.T) {
+	var closed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/open_session":
+			if body["capacity_of_str_len"] != float64(DefaultSessionCapacity) {
+				t.Errorf("open_session body = %v", body)
+			}
+			fmt.Fprint(w, `"s1"`)
+		case "/close_session":
+			closed, _ = body["session_id"].(string)
+		default:
+			t.Errorf("path = %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL + "/v1"})
+	id, err := client.OpenSession(context.Background(), SessionOptions{})
+	if err != nil || id != "s1" {
+		t.Fatalf("OpenSession() = %q, %v", id, err)
+	}
+	if err := client.CloseSession(context.Background(), id); err != nil || closed != "s1" {
+		t.Errorf("CloseSession() = %v, closed %q", err, closed)
+	}
+}
+
+// TestConversationSession tests sending only new messages in a session
+func TestConversationSession(t *testing.T) {
+	var reqs []ChatCompletionRequest
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		reqs = append(reqs, req)
+		return &ChatCompletionResponse{Choices: []Choice{{Message: Message{Role: "assistant", Content: "ok"}}}}, nil
+	})
+	if _, err := NewConversation(client, ChatCompletionRequest{}, ConversationOptions{SessionID: "s1", MaxPromptTokens: 10}); err == nil {
+		t.Error("NewConversation() with a session and MaxPromptTokens succeeded")
+	}
+	conv, err := NewConversation(client, ChatCompletionRequest{Model: "m"}, ConversationOptions{System: "sys", SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("NewConversation() error: %v", err)
+	}
+	conv.Send(context.Background(), "one")
+	conv.Append(ChatMessage{Role: "user", Content: "note"})
+	conv.Send(context.Background(), "two")
+	conv.Reset()
+	conv.Send(context.Background(), "three")
+
+	if len(reqs) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(reqs))
+	}
+	first, second, third := reqs[0], reqs[1], reqs[2]
+	if len(first.Messages) != 2 || first.SessionParams.ID != "s1" || first.SessionParams.Rid != "" || first.Rid == nil {
+		t.Errorf("first request = %+v, %+v", first.Messages, first.SessionParams)
+	}
+	if len(second.Messages) != 2 || second.Messages[0].Content != "note" || second.SessionParams.Rid != *first.Rid {
+		t.Errorf("second request = %+v, %+v", second.Messages, second.SessionParams)
+	}
+	if len(third.Messages) != 2 || third.SessionParams.Rid != "" {
+		t.Errorf("third request = %+v, %+v", third.Messages, third.SessionParams)
+	}
+	if n := len(conv.Messages()); n != 3 {
+		t.Errorf("history has %d messages, want 3", n)
+	}
+}
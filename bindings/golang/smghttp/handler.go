@@ -0,0 +1,566 @@
+// Package smghttp serves an OpenAI-compatible REST API from an SMG client as
+// a net/http handler, so that applications can mount the API inside their
+// existing servers instead of running the example oai_server:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/v1/", smghttp.Handler(client, smghttp.Options{HeartbeatInterval: 15 * time.Second}))
+//
+// The handler serves the inference endpoints only; authentication, rate
+// limits, and logging are left to the application's middleware.
+//
+// The example oai_server keeps its own fasthttp handlers, as fasthttp's
+// net/http adaptor buffers whole responses and so cannot stream, and as it
+// adds model aliases, quotas, and moderation to each endpoint. It answers
+// SDK errors with ErrorStatus so that both servers fail alike.
+package smghttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// DefaultMaxRequestBytes is the largest request body accepted when
+// Options.MaxRequestBytes is not set.
+const DefaultMaxRequestBytes = 4 << 20
+
+// Options controls Handler.
+type Options struct {
+	// MaxRequestBytes bounds request bodies; larger requests get 413.
+	// Defaults to DefaultMaxRequestBytes.
+	MaxRequestBytes int64
+	// HeartbeatInterval, if positive, is how long a stream may be idle
+	// before a ": ping" comment is sent, so that proxies with idle timeouts
+	// keep it open through long prefills.
+	HeartbeatInterval time.Duration
+	// Ollama also serves the Ollama API's /api/chat, /api/generate, and
+	// /api/tags, for tooling that only speaks Ollama.
+	Ollama bool
+	// Realtime also serves the Realtime API over WebSocket at /realtime,
+	// bridged to streaming chat completions.
+	Realtime bool
+	// TGI also serves the Hugging Face Text Generation Inference API's
+	// /generate and /generate_stream, for TGI clients and benchmarks.
+	TGI bool
+	// SageMaker also serves the SageMaker hosting contract's /invocations
+	// and /ping, for pipelines that deploy models behind that interface.
+	SageMaker bool
+}
+
+// The optional methods of the client that serve the endpoints other than
+// chat completions. smg.Client and smg.MultiClient implement all of them.
+type (
+	completer interface {
+		CreateCompletion(ctx context.Context, req smg.CompletionRequest) (*smg.CompletionResponse, error)
+		CreateCompletionStream(ctx context.Context, req smg.CompletionRequest) (smg.ChatStream, error)
+	}
+	embedder interface {
+		CreateEmbeddings(ctx context.Context, req smg.EmbeddingRequest) (*smg.EmbeddingResponse, error)
+	}
+	modelLister interface {
+		ListModels(ctx context.Context) ([]smg.ModelInfo, error)
+	}
+	workerCounter interface {
+		HealthyWorkerCount() int
+	}
+)
+
+// Handler returns a handler answering OpenAI API requests with client,
+// typically an *smg.Client or *smg.MultiClient, possibly wrapped with
+// middleware. It serves these endpoints under any path prefix:
+//
+//	POST /chat/completions
+//	POST /completions       (if the client implements CreateCompletion)
+//	POST /embeddings        (if the client implements CreateEmbeddings)
+//	GET  /models            (if the client implements ListModels)
+//	GET  /models/{id}
+//
+// Streams are sent as server-sent events ending with "data: [DONE]". Other
+// requests get a 404 error response. Failed requests get the OpenAI error
+// body with the status given by ErrorStatus.
+//
+// With Options.Ollama it also serves the Ollama endpoints; see the ollama
+// package for how they are converted:
+//
+//	POST /api/chat
+//	POST /api/generate
+//	GET  /api/tags          (if the client implements ListModels)
+//
+// Ollama streams are newline-delimited JSON, streaming is the default, and
+// errors have the Ollama body, {"error": message}. Heartbeats are not sent
+// in Ollama streams.
+//
+// With Options.Realtime it also serves realtime sessions over WebSocket; see
+// the realtime package for the events supported:
+//
+//	GET  /realtime?model={model}
+//
+// With Options.TGI it also serves the TGI endpoints with text completions of
+// the client's default model; see the tgi package for how they are
+// converted:
+//
+//	POST /generate          (if the client implements CreateCompletion)
+//	POST /generate_stream   (if the client implements CreateCompletion)
+//
+// TGI streams are server-sent events without a [DONE] event, and errors
+// have the TGI body, {"error": message, "error_type": type}, with status 422
+// for invalid requests. With Options.Ollama as well, /api/generate is
+// served by the Ollama API.
+//
+// With Options.SageMaker it also serves the SageMaker hosting contract:
+//
+//	POST /invocations
+//	GET  /ping
+//
+// Invocations are OpenAI chat completion requests, or completion requests
+// if the body has a prompt and no messages, answered as above. Pings get
+// 503 when a client implementing HealthyWorkerCount has no healthy workers,
+// and 200 otherwise.
+func Handler(client smg.ChatClient, opts Options) http.Handler {
+	if opts.MaxRequestBytes <= 0 {
+		opts.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+	return &handler{client: client, opts: opts}
+}
+
+type handler struct {
+	client smg.ChatClient
+	opts   Options
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(w, req.Body, h.opts.MaxRequestBytes)
+	}
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case h.opts.Ollama && strings.HasSuffix(path, "/api/chat"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.ollamaChat(w, req)
+		return
+	case h.opts.Ollama && strings.HasSuffix(path, "/api/generate"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.ollamaGenerate(w, req)
+		return
+	case h.opts.Ollama && strings.HasSuffix(path, "/api/tags"):
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		if l, ok := h.client.(modelLister); ok {
+			ollamaTags(w, req, l)
+			return
+		}
+	case h.opts.Realtime && strings.HasSuffix(path, "/realtime"):
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.realtime(w, req)
+		return
+	case h.opts.TGI && (strings.HasSuffix(path, "/generate") || strings.HasSuffix(path, "/generate_stream")):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		if c, ok := h.client.(completer); ok {
+			tgiGenerate(w, req, c, strings.HasSuffix(path, "/generate_stream"))
+			return
+		}
+	case h.opts.SageMaker && strings.HasSuffix(path, "/invocations"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.invocations(w, req)
+		return
+	case h.opts.SageMaker && strings.HasSuffix(path, "/ping"):
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.ping(w)
+		return
+	case strings.HasSuffix(path, "/chat/completions"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		h.chatCompletion(w, req)
+		return
+	case strings.HasSuffix(path, "/completions"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		if c, ok := h.client.(completer); ok {
+			h.completion(w, req, c)
+			return
+		}
+	case strings.HasSuffix(path, "/embeddings"):
+		if req.Method != http.MethodPost {
+			methodNotAllowed(w, req)
+			return
+		}
+		if e, ok := h.client.(embedder); ok {
+			embeddings(w, req, e)
+			return
+		}
+	case strings.HasSuffix(path, "/models"), strings.Contains(path, "/models/"):
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		if l, ok := h.client.(modelLister); ok {
+			id := ""
+			if i := strings.LastIndex(path, "/models/"); i >= 0 {
+				id = path[i+len("/models/"):]
+			}
+			models(w, req, l, id)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "not_found_error", fmt.Sprintf("%s %s is not supported", req.Method, req.URL.Path))
+}
+
+func (h *handler) chatCompletion(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		smg.ChatCompletionRequest
+		// MaxTokens is the deprecated name of max_completion_tokens
+		MaxTokens *int `json:"max_tokens"`
+		N         *int `json:"n"`
+	}
+	if !decode(w, req, &body) {
+		return
+	}
+	if body.N != nil && *body.N != 1 {
+		invalidRequest(w, "n must be 1")
+		return
+	}
+	chatReq := body.ChatCompletionRequest
+	if chatReq.MaxCompletionTokens == nil {
+		chatReq.MaxCompletionTokens = body.MaxTokens
+	}
+
+	if chatReq.Stream {
+		stream, err := h.client.CreateChatCompletionStream(req.Context(), chatReq)
+		if err != nil {
+			failure(w, err)
+			return
+		}
+		h.eventStream(w, req, stream)
+		return
+	}
+	resp, err := h.client.CreateChatCompletion(req.Context(), chatReq)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) completion(w http.ResponseWriter, req *http.Request, client completer) {
+	var body struct {
+		smg.CompletionRequest
+		Prompt json.RawMessage `json:"prompt"`
+	}
+	if !decode(w, req, &body) {
+		return
+	}
+	prompt, err := single(body.Prompt, "prompt")
+	if err != nil {
+		invalidRequest(w, err.Error())
+		return
+	}
+	completionReq := body.CompletionRequest
+	completionReq.Prompt = prompt
+
+	if completionReq.Stream {
+		stream, err := client.CreateCompletionStream(req.Context(), completionReq)
+		if err != nil {
+			failure(w, err)
+			return
+		}
+		h.eventStream(w, req, stream)
+		return
+	}
+	resp, err := client.CreateCompletion(req.Context(), completionReq)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func embeddings(w http.ResponseWriter, req *http.Request, client embedder) {
+	var body struct {
+		smg.EmbeddingRequest
+		Input          json.RawMessage `json:"input"`
+		EncodingFormat string          `json:"encoding_format"`
+	}
+	if !decode(w, req, &body) {
+		return
+	}
+	if body.EncodingFormat != "" && body.EncodingFormat != "float" {
+		invalidRequest(w, fmt.Sprintf("encoding_format %q is not supported", body.EncodingFormat))
+		return
+	}
+	embeddingReq := body.EmbeddingRequest
+	embeddingReq.Input = nil
+	var input interface{}
+	json.Unmarshal(body.Input, &input)
+	switch input := input.(type) {
+	case string:
+		embeddingReq.Input = []string{input}
+	case []interface{}:
+		for _, text := range input {
+			text, ok := text.(string)
+			if !ok {
+				invalidRequest(w, "input must be a string or an array of strings")
+				return
+			}
+			embeddingReq.Input = append(embeddingReq.Input, text)
+		}
+	default:
+		invalidRequest(w, "input must be a string or an array of strings")
+		return
+	}
+
+	resp, err := client.CreateEmbeddings(req.Context(), embeddingReq)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// model is the OpenAI model object
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func models(w http.ResponseWriter, req *http.Request, client modelLister, id string) {
+	infos, err := client.ListModels(req.Context())
+	if err != nil {
+		failure(w, err)
+		return
+	}
+	list := struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}{Object: "list", Data: []model{}}
+	for _, info := range infos {
+		m := model{ID: info.ID, Object: "model", OwnedBy: "smg"}
+		if id != "" && info.ID == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+		list.Data = append(list.Data, m)
+	}
+	if id != "" {
+		writeError(w, http.StatusNotFound, "not_found_error", fmt.Sprintf("model %q not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// decode decodes the JSON request body into v, or sends the error response
+// and returns false
+func decode(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if status, message := readJSON(req, v); status != 0 {
+		writeError(w, status, "invalid_request_error", message)
+		return false
+	}
+	return true
+}
+
+// readJSON decodes the JSON request body into v, returning the error status
+// and message if it cannot
+func readJSON(req *http.Request, v interface{}) (int, string) {
+	if req.Body == nil {
+		return http.StatusBadRequest, "request body is required"
+	}
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)
+		}
+		return http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err)
+	}
+	return 0, ""
+}
+
+// single decodes a string, or an array holding one string
+func single(raw json.RawMessage, name string) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) == 1 {
+		return list[0], nil
+	}
+	return "", fmt.Errorf("%s must be a string or an array of one string", name)
+}
+
+type recvResult struct {
+	chunk string
+	err   error
+}
+
+// eventStream relays the stream's chunks as server-sent events, ending with
+// "data: [DONE]". An error after the first chunk is sent as an event with an
+// "error" object, which OpenAI clients report. The stream is closed when the
+// client goes away.
+func (h *handler) eventStream(w http.ResponseWriter, req *http.Request, stream smg.ChatStream) {
+	defer stream.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	// Receive in a goroutine so that idle periods can be filled with
+	// heartbeats; closing the stream on return unblocks it
+	done := make(chan struct{})
+	defer close(done)
+	results := make(chan recvResult)
+	go func() {
+		for {
+			chunk, err := stream.RecvJSON()
+			select {
+			case results <- recvResult{chunk, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	var heartbeat <-chan time.Time
+	if h.opts.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(h.opts.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		var r recvResult
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flush()
+			continue
+		case r = <-results:
+		}
+
+		switch {
+		case r.err == io.EOF:
+			io.WriteString(w, "data: [DONE]\n\n")
+			flush()
+			return
+		case r.err != nil:
+			_, errType, message := classify(r.err)
+			data, _ := json.Marshal(errorBody(errType, message))
+			io.WriteString(w, "data: "+string(data)+"\n\n")
+			flush()
+			return
+		}
+		if _, err := io.WriteString(w, "data: "+r.chunk+"\n\n"); err != nil {
+			// The client went away
+			return
+		}
+		flush()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(errorBody("server_error", err.Error()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// apiError is the error object of an OpenAI error response
+type apiError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+func errorBody(errType, message string) map[string]apiError {
+	return map[string]apiError{"error": {Message: message, Type: errType}}
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, errorBody(errType, message))
+}
+
+func invalidRequest(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusBadRequest, "invalid_request_error", message)
+}
+
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", fmt.Sprintf("method %s is not allowed for %s", req.Method, req.URL.Path))
+}
+
+// failure sends the error response for an error of the SMG client
+func failure(w http.ResponseWriter, err error) {
+	status, errType, message := classify(err)
+	writeError(w, status, errType, message)
+}
+
+// classify returns the status, OpenAI error type, and message for an error
+// of the SMG client
+func classify(err error) (int, string, string) {
+	status, errType := ErrorStatus(err)
+	return status, errType, err.Error()
+}
+
+// ErrorStatus returns the HTTP status and OpenAI error type of an error of
+// the SMG client: 400 for errors matching smg.ErrInvalidRequest, 503 for
+// smg.ErrNoHealthyWorkers, 504 for context.DeadlineExceeded, and 500
+// otherwise. Servers with their own handlers use it to fail like Handler.
+func ErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, smg.ErrInvalidRequest):
+		return http.StatusBadRequest, "invalid_request_error"
+	case errors.Is(err, smg.ErrNoHealthyWorkers):
+		return http.StatusServiceUnavailable, "service_unavailable"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "timeout_error"
+	}
+	return http.StatusInternalServerError, "server_error"
+}
@@ -0,0 +1,279 @@
+package smghttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/smgtest"
+)
+
+// backend adds the other endpoints to a mock chat client
+type backend struct {
+	*smgtest.MockClient
+	embeddingReq smg.EmbeddingRequest
+}
+
+func (b *backend) CreateCompletion(ctx context.Context, req smg.CompletionRequest) (*smg.CompletionResponse, error) {
+	return &smg.CompletionResponse{Object: "text_completion", Model: req.Model, Choices: []smg.CompletionChoice{{Text: req.Prompt + "!"}}}, nil
+}
+
+func (b *backend) CreateCompletionStream(ctx context.Context, req smg.CompletionRequest) (smg.ChatStream, error) {
+	return nil, smg.ErrNoHealthyWorkers
+}
+
+func (b *backend) CreateEmbeddings(ctx context.Context, req smg.EmbeddingRequest) (*smg.EmbeddingResponse, error) {
+	b.embeddingReq = req
+	return &smg.EmbeddingResponse{Object: "list", Model: req.Model}, nil
+}
+
+func (b *backend) ListModels(ctx context.Context) ([]smg.ModelInfo, error) {
+	return []smg.ModelInfo{{ID: "llama"}, {ID: "qwen"}}, nil
+}
+
+// serve sends a request to h and returns the response status and body
+func serve(h http.Handler, method, path, body string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, "/v1"+path, strings.NewReader(body)))
+	return rec.Code, rec.Body.String()
+}
+
+// TestStreamError tests that an error after the first chunk is sent as an
+// error event
+func TestStreamError(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Content: "par", StreamErr: errors.New("worker lost")})
+	_, body := serve(Handler(mock, Options{}), http.MethodPost, "/chat/completions", `{"model":"m","stream":true,"messages":[]}`)
+	if !strings.HasSuffix(body, `data: {"error":{"message":"worker lost","type":"server_error","param":null,"code":null}}`+"\n\n") {
+		t.Errorf("stream = %q, want a final error event", body)
+	}
+}
+
+// TestErrorStatus tests the status and error type of SDK errors
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  int
+		errType string
+	}{
+		{fmt.Errorf("bad: %w", smg.ErrInvalidRequest), http.StatusBadRequest, "invalid_request_error"},
+		{smg.ErrNoHealthyWorkers, http.StatusServiceUnavailable, "service_unavailable"},
+		{fmt.Errorf("embed: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "timeout_error"},
+		{errors.New("worker lost"), http.StatusInternalServerError, "server_error"},
+	}
+	for _, tt := range tests {
+		if status, errType := ErrorStatus(tt.err); status != tt.status || errType != tt.errType {
+			t.Errorf("ErrorStatus(%v) = %d, %s, want %d, %s", tt.err, status, errType, tt.status, tt.errType)
+		}
+	}
+}
+
+// TestHeartbeat tests that idle streams get ping comments and that streams
+// are flushed as they go
+func TestHeartbeat(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Content: "hi", Latency: 50 * time.Millisecond})
+	server := httptest.NewServer(Handler(mock, Options{HeartbeatInterval: 10 * time.Millisecond}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"m","stream":true,"messages":[]}`))
+	if err != nil {
+		t.Fatalf("POST error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	body := string(data)
+	if !strings.HasPrefix(body, ": ping\n\n") || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("stream = %q, want pings before the chunks", body)
+	}
+}
+
+// TestMaxRequestBytes tests that oversized bodies are rejected
+func TestMaxRequestBytes(t *testing.T) {
+	h := Handler(smgtest.NewMockClient(), Options{MaxRequestBytes: 64})
+	status, body := serve(h, http.MethodPost, "/chat/completions", `{"model":"m","messages":[{"role":"user","content":"`+strings.Repeat("x", 100)+`"}]}`)
+	if status != http.StatusRequestEntityTooLarge || !strings.Contains(body, "exceeds 64 bytes") {
+		t.Errorf("response = %d %s, want 413", status, body)
+	}
+}
+
+// TestOtherEndpoints tests completions, embeddings, and models
+func TestOtherEndpoints(t *testing.T) {
+	b := &backend{MockClient: smgtest.NewMockClient()}
+	h := Handler(b, Options{})
+
+	if _, body := serve(h, http.MethodPost, "/completions", `{"model":"m","prompt":["Hello"]}`); !strings.Contains(body, `"text":"Hello!"`) {
+		t.Errorf("completion = %s", body)
+	}
+	if status, _ := serve(h, http.MethodPost, "/completions", `{"model":"m","prompt":"Hello","stream":true}`); status != http.StatusServiceUnavailable {
+		t.Errorf("stream with no workers status = %d, want 503", status)
+	}
+
+	serve(h, http.MethodPost, "/embeddings", `{"model":"e","input":"one"}`)
+	if got := b.embeddingReq.Input; len(got) != 1 || got[0] != "one" {
+		t.Errorf("embedding input = %q", got)
+	}
+	serve(h, http.MethodPost, "/embeddings", `{"model":"e","input":["one","two"]}`)
+	if got := b.embeddingReq.Input; len(got) != 2 {
+		t.Errorf("embedding input = %q", got)
+	}
+	if status, _ := serve(h, http.MethodPost, "/embeddings", `{"model":"e","input":"one","encoding_format":"base64"}`); status != http.StatusBadRequest {
+		t.Errorf("base64 encoding status = %d, want 400", status)
+	}
+
+	if _, body := serve(h, http.MethodGet, "/models", ""); !strings.Contains(body, `{"id":"qwen","object":"model","created":0,"owned_by":"smg"}`) {
+		t.Errorf("models = %s", body)
+	}
+	if status, body := serve(h, http.MethodGet, "/models/llama", ""); status != http.StatusOK || !strings.Contains(body, `"id":"llama"`) {
+		t.Errorf("model = %d %s", status, body)
+	}
+	if status, _ := serve(h, http.MethodGet, "/models/gpt", ""); status != http.StatusNotFound {
+		t.Errorf("unknown model status = %d, want 404", status)
+	}
+	if status, _ := serve(h, http.MethodGet, "/files", ""); status != http.StatusNotFound {
+		t.Errorf("unsupported endpoint status = %d, want 404", status)
+	}
+	if status, _ := serve(h, http.MethodGet, "/chat/completions", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET chat completions status = %d, want 405", status)
+	}
+}
+
+// TestOllama tests the Ollama endpoints: a streamed chat, a generate, the
+// model list, and the Ollama error body
+func TestOllama(t *testing.T) {
+	b := &backend{MockClient: smgtest.NewMockClient(
+		smgtest.Reply{Chunks: []string{"Bon", "jour"}, Usage: smg.Usage{PromptTokens: 3, CompletionTokens: 2}},
+		smgtest.Reply{Content: "Hi"},
+	)}
+	h := Handler(b, Options{Ollama: true})
+
+	_, body := serve(h, http.MethodPost, "/api/chat", `{"model":"llama3","messages":[{"role":"user","content":"Hello"}]}`)
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"content":"Bon"`) || !strings.Contains(lines[1], `"content":"jour"`) {
+		t.Fatalf("chat stream = %q, want two content lines and a final line", body)
+	}
+	if final := lines[2]; !strings.Contains(final, `"done":true,"done_reason":"stop"`) || !strings.Contains(final, `"prompt_eval_count":3,"eval_count":2`) {
+		t.Errorf("final line = %s", final)
+	}
+
+	status, body := serve(h, http.MethodPost, "/api/generate", `{"model":"llama3","prompt":"Hello","stream":false}`)
+	if status != http.StatusOK || !strings.Contains(body, `"model":"llama3"`) || !strings.Contains(body, `"response":"Hi","done":true`) {
+		t.Errorf("generate = %d %s", status, body)
+	}
+
+	if _, body := serve(h, http.MethodGet, "/api/tags", ""); !strings.Contains(body, `{"name":"qwen","model":"qwen"`) {
+		t.Errorf("tags = %s", body)
+	}
+	if status, body := serve(h, http.MethodPost, "/api/generate", `{"model":"llama3","prompt":"Hello","raw":true}`); status != http.StatusBadRequest || !strings.HasPrefix(body, `{"error":"`) {
+		t.Errorf("raw generate = %d %s, want 400 with the Ollama error body", status, body)
+	}
+	if status, _ := serve(Handler(b, Options{}), http.MethodPost, "/api/chat", `{}`); status != http.StatusNotFound {
+		t.Errorf("chat without Options.Ollama status = %d, want 404", status)
+	}
+}
+
+// TestTGI tests the TGI endpoints: a generate, a stream that cannot start,
+// and the TGI error body
+func TestTGI(t *testing.T) {
+	b := &backend{MockClient: smgtest.NewMockClient()}
+	h := Handler(b, Options{TGI: true})
+
+	status, body := serve(h, http.MethodPost, "/generate", `{"inputs":"Hello","parameters":{"details":true}}`)
+	if status != http.StatusOK || !strings.Contains(body, `{"generated_text":"Hello!","details":{"finish_reason":"eos_token"`) {
+		t.Errorf("generate = %d %s", status, body)
+	}
+	if status, body := serve(h, http.MethodPost, "/generate_stream", `{"inputs":"Hello"}`); status != http.StatusServiceUnavailable || !strings.Contains(body, `"error_type":"overloaded"`) {
+		t.Errorf("stream with no workers = %d %s, want 503", status, body)
+	}
+	if status, body := serve(h, http.MethodPost, "/generate", `{"inputs":"Hello","parameters":{"best_of":2}}`); status != http.StatusUnprocessableEntity || !strings.Contains(body, `"error_type":"validation"`) {
+		t.Errorf("best_of generate = %d %s, want 422 with the TGI error body", status, body)
+	}
+	if status, _ := serve(Handler(b, Options{}), http.MethodPost, "/generate", `{}`); status != http.StatusNotFound {
+		t.Errorf("generate without Options.TGI status = %d, want 404", status)
+	}
+}
+
+// workerBackend is a backend reporting its healthy workers
+type workerBackend struct {
+	*backend
+	healthy int
+}
+
+func (b workerBackend) HealthyWorkerCount() int { return b.healthy }
+
+// TestSageMaker tests that invocations are chat completions or completions
+// by their body, and that pings report healthy workers
+func TestSageMaker(t *testing.T) {
+	b := &backend{MockClient: smgtest.NewMockClient(smgtest.Reply{Content: "Hi"})}
+	h := Handler(b, Options{SageMaker: true})
+
+	if status, body := serve(h, http.MethodPost, "/invocations", `{"model":"m","messages":[{"role":"user","content":"Hello"}]}`); status != http.StatusOK || !strings.Contains(body, `"content":"Hi"`) {
+		t.Errorf("chat invocation = %d %s", status, body)
+	}
+	if status, body := serve(h, http.MethodPost, "/invocations", `{"model":"m","prompt":"Hello"}`); status != http.StatusOK || !strings.Contains(body, `"text":"Hello!"`) {
+		t.Errorf("completion invocation = %d %s", status, body)
+	}
+	if status, _ := serve(h, http.MethodPost, "/invocations", `{`); status != http.StatusBadRequest {
+		t.Errorf("malformed invocation status = %d, want 400", status)
+	}
+
+	if status, _ := serve(h, http.MethodGet, "/ping", ""); status != http.StatusOK {
+		t.Errorf("ping status = %d, want 200", status)
+	}
+	if status, _ := serve(Handler(workerBackend{b, 0}, Options{SageMaker: true}), http.MethodGet, "/ping", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("ping without healthy workers status = %d, want 503", status)
+	}
+	if status, _ := serve(Handler(workerBackend{b, 2}, Options{SageMaker: true}), http.MethodGet, "/ping", ""); status != http.StatusOK {
+		t.Errorf("ping with healthy workers status = %d, want 200", status)
+	}
+	if status, _ := serve(Handler(b, Options{}), http.MethodGet, "/ping", ""); status != http.StatusNotFound {
+		t.Errorf("ping without Options.SageMaker status = %d, want 404", status)
+	}
+}
+
+// TestRealtime tests a realtime session over WebSocket, with the
+// subprotocols browser clients offer
+func TestRealtime(t *testing.T) {
+	mock := smgtest.NewMockClient(smgtest.Reply{Content: "Hi!"})
+	server := httptest.NewServer(Handler(mock, Options{Realtime: true}))
+	defer server.Close()
+
+	config, _ := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/realtime?model=llama3", server.URL)
+	config.Protocol = []string{"realtime", "openai-insecure-api-key.sk-test"}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	websocket.Message.Send(conn, `{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"Hello"}]}}`)
+	websocket.Message.Send(conn, `{"type":"response.create"}`)
+	var events []string
+	for {
+		var msg string
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			t.Fatalf("Receive error after %d events: %v", len(events), err)
+		}
+		events = append(events, msg)
+		if strings.Contains(msg, `"type":"response.done"`) {
+			break
+		}
+	}
+	if !strings.Contains(events[0], `"type":"session.created"`) || !strings.Contains(events[0], `"model":"llama3"`) {
+		t.Errorf("first event = %s", events[0])
+	}
+	if !strings.Contains(strings.Join(events, "\n"), `"delta":"Hi!"`) {
+		t.Errorf("events = %q, want a text delta", events)
+	}
+	if got := mock.Requests()[0]; got.Model != "llama3" || got.Messages[0].Content != "Hello" {
+		t.Errorf("request = %+v", got)
+	}
+}
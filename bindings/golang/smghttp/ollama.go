@@ -0,0 +1,163 @@
+package smghttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/ollama"
+)
+
+func (h *handler) ollamaChat(w http.ResponseWriter, req *http.Request) {
+	var body ollama.ChatRequest
+	if status, message := readJSON(req, &body); status != 0 {
+		ollamaError(w, status, message)
+		return
+	}
+	chatReq, err := ollama.ConvertChatRequest(body)
+	if err != nil {
+		ollamaFailure(w, err)
+		return
+	}
+	h.ollamaReply(w, req, chatReq,
+		func(resp *smg.ChatCompletionResponse, elapsed time.Duration) interface{} {
+			return ollama.ChatResponseFrom(resp, elapsed)
+		},
+		func(line ollama.ChatResponse) interface{} { return line })
+}
+
+func (h *handler) ollamaGenerate(w http.ResponseWriter, req *http.Request) {
+	var body ollama.GenerateRequest
+	if status, message := readJSON(req, &body); status != 0 {
+		ollamaError(w, status, message)
+		return
+	}
+	chatReq, err := ollama.ConvertGenerateRequest(body)
+	if err != nil {
+		ollamaFailure(w, err)
+		return
+	}
+	h.ollamaReply(w, req, chatReq,
+		func(resp *smg.ChatCompletionResponse, elapsed time.Duration) interface{} {
+			return ollama.GenerateResponseFrom(resp, elapsed)
+		},
+		func(line ollama.ChatResponse) interface{} {
+			if len(line.Message.ToolCalls) > 0 {
+				return nil
+			}
+			return ollama.GenerateResponseFromChat(line)
+		})
+}
+
+// ollamaReply answers an Ollama request with the chat completion for chatReq,
+// converted by reply, or streamed as newline-delimited JSON with each line
+// converted by line; lines converted to nil are skipped. The model named by
+// the request is reported.
+func (h *handler) ollamaReply(w http.ResponseWriter, req *http.Request, chatReq smg.ChatCompletionRequest,
+	reply func(*smg.ChatCompletionResponse, time.Duration) interface{}, line func(ollama.ChatResponse) interface{}) {
+	if !chatReq.Stream {
+		start := time.Now()
+		resp, err := h.client.CreateChatCompletion(req.Context(), chatReq)
+		if err != nil {
+			ollamaFailure(w, err)
+			return
+		}
+		if chatReq.Model != "" {
+			resp.Model = chatReq.Model
+		}
+		writeJSON(w, http.StatusOK, reply(resp, time.Since(start)))
+		return
+	}
+
+	converter := ollama.NewStreamConverter(chatReq.Model)
+	stream, err := h.client.CreateChatCompletionStream(req.Context(), chatReq)
+	if err != nil {
+		ollamaFailure(w, err)
+		return
+	}
+	defer stream.Close()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(v interface{}) bool {
+		if v == nil {
+			return true
+		}
+		data, _ := json.Marshal(v)
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			// The client went away
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for {
+		chunk, err := stream.RecvJSON()
+		if err == io.EOF {
+			for _, l := range converter.Finish() {
+				if !send(line(l)) {
+					return
+				}
+			}
+			return
+		}
+		if err == nil {
+			var lines []ollama.ChatResponse
+			lines, err = converter.Chunk(chunk)
+			for _, l := range lines {
+				if !send(line(l)) {
+					return
+				}
+			}
+		}
+		if err != nil {
+			// Ollama clients report an error line in place of the rest of
+			// the stream
+			_, _, message := classify(err)
+			send(ollama.ErrorBody{Error: message})
+			return
+		}
+	}
+}
+
+// ollamaModel is a model of the /api/tags list
+type ollamaModel struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+}
+
+func ollamaTags(w http.ResponseWriter, req *http.Request, client modelLister) {
+	infos, err := client.ListModels(req.Context())
+	if err != nil {
+		ollamaFailure(w, err)
+		return
+	}
+	list := struct {
+		Models []ollamaModel `json:"models"`
+	}{Models: []ollamaModel{}}
+	for _, info := range infos {
+		list.Models = append(list.Models, ollamaModel{Name: info.ID, Model: info.ID})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func ollamaError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ollama.ErrorBody{Error: message})
+}
+
+// ollamaFailure sends the Ollama error response for an error of the SMG
+// client or of a conversion
+func ollamaFailure(w http.ResponseWriter, err error) {
+	status, _, message := classify(err)
+	ollamaError(w, status, message)
+}
@@ -0,0 +1,59 @@
+package smghttp
+
+import (
+	"net/http"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/lightseek/smg/go-grpc-sdk/realtime"
+)
+
+// realtime upgrades the request to a WebSocket and runs a realtime session
+// on it until either side closes it. Each text message is a client event or
+// a server event.
+func (h *handler) realtime(w http.ResponseWriter, req *http.Request) {
+	if _, ok := w.(http.Hijacker); !ok {
+		writeError(w, http.StatusInternalServerError, "server_error", "the server cannot upgrade this connection to a WebSocket")
+		return
+	}
+	config := realtime.SessionConfig{Model: req.URL.Query().Get("model")}
+	websocket.Server{
+		Handshake: selectProtocol,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = int(h.opts.MaxRequestBytes)
+			session, err := realtime.NewSession(h.client, config, func(event realtime.ServerEvent) error {
+				return websocket.Message.Send(conn, string(event.Data))
+			})
+			if err != nil {
+				return
+			}
+			defer session.Close()
+			for {
+				var data []byte
+				if err := websocket.Message.Receive(conn, &data); err != nil {
+					return
+				}
+				if err := session.Handle(data); err != nil {
+					return
+				}
+			}
+		},
+	}.ServeHTTP(w, req)
+}
+
+// selectProtocol accepts connections from any origin, leaving access
+// control to the application's middleware, and picks the "realtime"
+// subprotocol when the client offers several, as browser clients do to
+// pass credentials
+func selectProtocol(config *websocket.Config, req *http.Request) error {
+	if len(config.Protocol) > 1 {
+		chosen := config.Protocol[0]
+		for _, protocol := range config.Protocol {
+			if protocol == "realtime" {
+				chosen = protocol
+			}
+		}
+		config.Protocol = []string{chosen}
+	}
+	return nil
+}
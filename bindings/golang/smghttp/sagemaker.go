@@ -0,0 +1,53 @@
+package smghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// invocations answers a SageMaker invocation: a chat completion request, or
+// a completion request if the body has a prompt and no messages
+func (h *handler) invocations(w http.ResponseWriter, req *http.Request) {
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			invalidRequest(w, fmt.Sprintf("reading request body: %v", err))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+
+		var kind struct {
+			Messages json.RawMessage `json:"messages"`
+			Prompt   json.RawMessage `json:"prompt"`
+		}
+		if json.Unmarshal(data, &kind) == nil && kind.Messages == nil && kind.Prompt != nil {
+			c, ok := h.client.(completer)
+			if !ok {
+				invalidRequest(w, "this endpoint does not serve completion requests; send messages")
+				return
+			}
+			h.completion(w, req, c)
+			return
+		}
+	}
+	h.chatCompletion(w, req)
+}
+
+// ping answers a SageMaker health check: 200 if the client has a healthy
+// worker or does not report workers, and 503 otherwise
+func (h *handler) ping(w http.ResponseWriter) {
+	if c, ok := h.client.(workerCounter); ok && c.HealthyWorkerCount() == 0 {
+		writeError(w, http.StatusServiceUnavailable, "service_unavailable", "no healthy workers")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+}
@@ -0,0 +1,105 @@
+package smghttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+	"github.com/lightseek/smg/go-grpc-sdk/tgi"
+)
+
+// tgiGenerate answers a TGI /generate request, or a /generate_stream request
+// if stream is set, with a text completion of client
+func tgiGenerate(w http.ResponseWriter, req *http.Request, client completer, stream bool) {
+	var body tgi.GenerateRequest
+	if status, message := readJSON(req, &body); status != 0 {
+		if status == http.StatusBadRequest {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, tgi.ErrorBody{Error: message, ErrorType: "validation"})
+		return
+	}
+	completionReq, err := tgi.CompletionRequest(body, stream)
+	if err != nil {
+		tgiFailure(w, err)
+		return
+	}
+	if !stream {
+		resp, err := client.CreateCompletion(req.Context(), completionReq)
+		if err != nil {
+			tgiFailure(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tgi.GenerateResponseFrom(body, resp))
+		return
+	}
+
+	converter := tgi.NewStreamConverter(body)
+	completionStream, err := client.CreateCompletionStream(req.Context(), completionReq)
+	if err != nil {
+		tgiFailure(w, err)
+		return
+	}
+	defer completionStream.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	// TGI events are "data:" lines without a space, and streams end without
+	// a [DONE] event
+	send := func(v interface{}) bool {
+		data, _ := json.Marshal(v)
+		if _, err := w.Write(append(append([]byte("data:"), data...), '\n', '\n')); err != nil {
+			// The client went away
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for {
+		chunk, err := completionStream.RecvJSON()
+		if err == io.EOF {
+			send(converter.Finish())
+			return
+		}
+		if err == nil {
+			var events []tgi.StreamResponse
+			events, err = converter.Chunk(chunk)
+			for _, event := range events {
+				if !send(event) {
+					return
+				}
+			}
+		}
+		if err != nil {
+			_, errType, message := tgiClassify(err)
+			send(tgi.ErrorBody{Error: message, ErrorType: errType})
+			return
+		}
+	}
+}
+
+// tgiFailure sends the TGI error response for an error of the SMG client or
+// of a conversion
+func tgiFailure(w http.ResponseWriter, err error) {
+	status, errType, message := tgiClassify(err)
+	writeJSON(w, status, tgi.ErrorBody{Error: message, ErrorType: errType})
+}
+
+// tgiClassify returns the status, TGI error type, and message for an error.
+// TGI rejects invalid requests with 422.
+func tgiClassify(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, smg.ErrInvalidRequest):
+		return http.StatusUnprocessableEntity, "validation", err.Error()
+	case errors.Is(err, smg.ErrNoHealthyWorkers):
+		return http.StatusServiceUnavailable, "overloaded", err.Error()
+	}
+	return http.StatusInternalServerError, "generation", err.Error()
+}
@@ -0,0 +1,395 @@
+package smgtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// RecordEnv names the environment variable that, when set, makes UseCassette
+// record against a live backend instead of replaying.
+const RecordEnv = "SMG_RECORD"
+
+// ErrNoInteraction is returned when a Replayer has no unused recorded
+// interaction matching a request.
+var ErrNoInteraction = errors.New("smgtest: no recorded interaction matches request")
+
+var (
+	_ smg.ChatClient = (*Recorder)(nil)
+	_ smg.ChatClient = (*Replayer)(nil)
+)
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and its outcome.
+type Interaction struct {
+	Request smg.ChatCompletionRequest `json:"request"`
+	Stream  bool                      `json:"stream,omitempty"`
+
+	// Latency is the time to the response, or to opening the stream
+	Latency  time.Duration               `json:"latency_ns"`
+	Response *smg.ChatCompletionResponse `json:"response,omitempty"`
+	Chunks   []Chunk                     `json:"chunks,omitempty"`
+
+	// Error is the error of the request or of opening the stream
+	Error *RecordedError `json:"error,omitempty"`
+	// StreamError is the error other than io.EOF that ended the stream
+	StreamError *RecordedError `json:"stream_error,omitempty"`
+}
+
+// Chunk is one recorded stream chunk.
+type Chunk struct {
+	// Delay is the time RecvJSON waited for the chunk
+	Delay time.Duration   `json:"delay_ns"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// RecordedError is a recorded error. Replayed errors keep the message and
+// still match smg.ErrInvalidRequest, smg.ErrNoHealthyWorkers, and the context
+// errors with errors.Is.
+type RecordedError struct {
+	Message string `json:"message"`
+	// Kind is "invalid_request", "no_healthy_workers", "canceled",
+	// "deadline_exceeded", or empty
+	Kind string `json:"kind,omitempty"`
+}
+
+var errorKinds = map[string]error{
+	"invalid_request":    smg.ErrInvalidRequest,
+	"no_healthy_workers": smg.ErrNoHealthyWorkers,
+	"canceled":           context.Canceled,
+	"deadline_exceeded":  context.DeadlineExceeded,
+}
+
+func recordError(err error) *RecordedError {
+	recorded := &RecordedError{Message: err.Error()}
+	for kind, target := range errorKinds {
+		if errors.Is(err, target) {
+			recorded.Kind = kind
+			break
+		}
+	}
+	return recorded
+}
+
+func (e *RecordedError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error of Kind, if any.
+func (e *RecordedError) Unwrap() error {
+	return errorKinds[e.Kind]
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to path, creating its directory.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Recorder passes requests to a live client and records each interaction,
+// including the timing of stream chunks. It is safe for concurrent use;
+// interactions are recorded in the order they complete.
+type Recorder struct {
+	client smg.ChatClient
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates a recorder around client.
+func NewRecorder(client smg.ChatClient) *Recorder {
+	return &Recorder{client: client}
+}
+
+func (r *Recorder) add(interaction Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// Cassette returns a copy of the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the interactions recorded so far to path.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// CreateChatCompletion sends req to the live client and records the outcome.
+func (r *Recorder) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := r.client.CreateChatCompletion(ctx, req)
+	interaction := Interaction{Request: req, Latency: time.Since(start), Response: resp}
+	if err != nil {
+		interaction.Error = recordError(err)
+	}
+	r.add(interaction)
+	return resp, err
+}
+
+// CreateChatCompletionStream opens a live stream whose chunks are recorded as
+// they are received. The interaction is recorded when the stream ends or is
+// closed.
+func (r *Recorder) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	start := time.Now()
+	stream, err := r.client.CreateChatCompletionStream(ctx, req)
+	interaction := Interaction{Request: req, Stream: true, Latency: time.Since(start)}
+	if err != nil {
+		interaction.Error = recordError(err)
+		r.add(interaction)
+		return nil, err
+	}
+	return &recordingStream{recorder: r, stream: stream, interaction: interaction}, nil
+}
+
+// recordingStream records the chunks of a live stream
+type recordingStream struct {
+	recorder    *Recorder
+	stream      smg.ChatStream
+	interaction Interaction
+	done        bool
+}
+
+func (s *recordingStream) RecvJSON() (string, error) {
+	start := time.Now()
+	chunk, err := s.stream.RecvJSON()
+	if s.done {
+		return chunk, err
+	}
+	if err != nil {
+		if err != io.EOF {
+			s.interaction.StreamError = recordError(err)
+		}
+		s.finish()
+		return chunk, err
+	}
+	s.interaction.Chunks = append(s.interaction.Chunks, Chunk{Delay: time.Since(start), Data: json.RawMessage(chunk)})
+	return chunk, nil
+}
+
+func (s *recordingStream) Close() error {
+	s.finish()
+	return s.stream.Close()
+}
+
+func (s *recordingStream) finish() {
+	if !s.done {
+		s.done = true
+		s.recorder.add(s.interaction)
+	}
+}
+
+// Replayer answers requests from a cassette without a backend. Each request
+// is answered by the first unused interaction whose request matches, so
+// repeated identical requests replay in recorded order. It is safe for
+// concurrent use.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+
+	// Match reports whether a recorded request answers req. The default
+	// requires the two to encode to the same JSON.
+	Match func(recorded, req smg.ChatCompletionRequest) bool
+	// Realtime replays the recorded latency and chunk delays; by default
+	// replies are immediate.
+	Realtime bool
+}
+
+// NewReplayer creates a replayer for the interactions of cassette.
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{
+		interactions: cassette.Interactions,
+		used:         make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// LoadReplayer creates a replayer for the cassette file at path.
+func LoadReplayer(path string) (*Replayer, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(cassette), nil
+}
+
+// Unused returns the number of interactions not yet replayed.
+func (r *Replayer) Unused() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// sameRequest reports whether two requests encode to the same JSON
+func sameRequest(a, b smg.ChatCompletionRequest) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+// next takes the interaction answering req
+func (r *Replayer) next(req smg.ChatCompletionRequest, stream bool) (Interaction, error) {
+	match := r.Match
+	if match == nil {
+		match = sameRequest
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if !r.used[i] && interaction.Stream == stream && match(interaction.Request, req) {
+			r.used[i] = true
+			return interaction, nil
+		}
+	}
+	return Interaction{}, fmt.Errorf("%w (model %q, %d messages, stream %t)", ErrNoInteraction, req.Model, len(req.Messages), stream)
+}
+
+func (r *Replayer) delay(ctx context.Context, d time.Duration) error {
+	if !r.Realtime {
+		return ctx.Err()
+	}
+	return sleep(ctx, d)
+}
+
+// CreateChatCompletion replays the recorded response to req.
+func (r *Replayer) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	interaction, err := r.next(req, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.delay(ctx, interaction.Latency); err != nil {
+		return nil, err
+	}
+	if interaction.Error != nil {
+		return nil, interaction.Error
+	}
+	return interaction.Response, nil
+}
+
+// CreateChatCompletionStream replays the recorded stream for req.
+func (r *Replayer) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	interaction, err := r.next(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.delay(ctx, interaction.Latency); err != nil {
+		return nil, err
+	}
+	if interaction.Error != nil {
+		return nil, interaction.Error
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	return &replayStream{replayer: r, ctx: streamCtx, cancel: cancel, interaction: interaction}, nil
+}
+
+// replayStream replays recorded chunks
+type replayStream struct {
+	replayer    *Replayer
+	ctx         context.Context
+	cancel      context.CancelFunc
+	interaction Interaction
+	sent        int
+}
+
+func (s *replayStream) RecvJSON() (string, error) {
+	if s.sent == len(s.interaction.Chunks) {
+		if err := s.ctx.Err(); err != nil {
+			return "", err
+		}
+		if s.interaction.StreamError != nil {
+			return "", s.interaction.StreamError
+		}
+		return "", io.EOF
+	}
+	chunk := s.interaction.Chunks[s.sent]
+	if err := s.replayer.delay(s.ctx, chunk.Delay); err != nil {
+		return "", err
+	}
+	s.sent++
+	// Cassettes are saved indented; chunks are replayed compact, as received
+	var data bytes.Buffer
+	if err := json.Compact(&data, chunk.Data); err != nil {
+		return "", err
+	}
+	return data.String(), nil
+}
+
+func (s *replayStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+// UseCassette returns a client for a test that replays the cassette at path.
+// When the SMG_RECORD environment variable is set, it instead records
+// against the live backend returned by connect and saves the cassette when
+// the test ends:
+//
+//	func TestSummarize(t *testing.T) {
+//	    client := smgtest.UseCassette(t, "testdata/summarize.json", connect)
+//	    ...
+//	}
+//
+// Record once with SMG_RECORD=1 go test ./..., commit the cassette, and CI
+// replays it without workers.
+func UseCassette(t testing.TB, path string, connect func(t testing.TB) smg.ChatClient) smg.ChatClient {
+	t.Helper()
+	if os.Getenv(RecordEnv) != "" {
+		recorder := NewRecorder(connect(t))
+		t.Cleanup(func() {
+			if err := recorder.Save(path); err != nil {
+				t.Errorf("failed to save cassette: %v", err)
+			}
+		})
+		return recorder
+	}
+
+	replayer, err := LoadReplayer(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette (record it with %s=1): %v", RecordEnv, err)
+	}
+	return replayer
+}
@@ -0,0 +1,121 @@
+package smgtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+func drain(t *testing.T, stream smg.ChatStream) ([]string, error) {
+	t.Helper()
+	defer stream.Close()
+	var chunks []string
+	for {
+		chunk, err := stream.RecvJSON()
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// TestCassetteRecordReplay tests that recorded responses, streams, and
+// errors replay identically from a cassette file
+func TestCassetteRecordReplay(t *testing.T) {
+	streamErr := errors.New("worker lost")
+	live := NewMockClient(
+		Reply{Content: "Paris"},
+		Reply{Chunks: []string{"Ro", "me"}, ChunkDelay: 5 * time.Millisecond},
+		Reply{Err: smg.ErrNoHealthyWorkers},
+		Reply{Chunks: []string{"Ber"}, StreamErr: streamErr},
+	)
+	ask := func(q string) smg.ChatCompletionRequest {
+		return smg.ChatCompletionRequest{Model: "m", Messages: []smg.ChatMessage{{Role: "user", Content: q}}}
+	}
+
+	recorder := NewRecorder(live)
+	ctx := context.Background()
+	resp, err := recorder.CreateChatCompletion(ctx, ask("France"))
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() error: %v", err)
+	}
+	stream, err := recorder.CreateChatCompletionStream(ctx, ask("Italy"))
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	liveChunks, _ := drain(t, stream)
+	if _, err := recorder.CreateChatCompletion(ctx, ask("Spain")); !errors.Is(err, smg.ErrNoHealthyWorkers) {
+		t.Fatalf("CreateChatCompletion() error = %v", err)
+	}
+	stream, _ = recorder.CreateChatCompletionStream(ctx, ask("Germany"))
+	drain(t, stream)
+
+	path := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette() error: %v", err)
+	}
+	if len(cassette.Interactions) != 4 || cassette.Interactions[1].Chunks[1].Delay < 5*time.Millisecond {
+		t.Fatalf("cassette = %+v", cassette.Interactions)
+	}
+
+	// Replay out of order; requests are matched by content
+	replayer := NewReplayer(cassette)
+	stream, err = replayer.CreateChatCompletionStream(ctx, ask("Italy"))
+	if err != nil {
+		t.Fatalf("replayed CreateChatCompletionStream() error: %v", err)
+	}
+	chunks, err := drain(t, stream)
+	if err != io.EOF || len(chunks) != len(liveChunks) || chunks[1] != liveChunks[1] {
+		t.Errorf("replayed stream = %q, %v; want %q", chunks, err, liveChunks)
+	}
+	got, err := replayer.CreateChatCompletion(ctx, ask("France"))
+	if err != nil || got.ID != resp.ID || got.Choices[0].Message.Content != "Paris" {
+		t.Errorf("replayed response = %+v, %v", got, err)
+	}
+	if _, err := replayer.CreateChatCompletion(ctx, ask("Spain")); !errors.Is(err, smg.ErrNoHealthyWorkers) {
+		t.Errorf("replayed error = %v, want ErrNoHealthyWorkers", err)
+	}
+	stream, _ = replayer.CreateChatCompletionStream(ctx, ask("Germany"))
+	if chunks, err := drain(t, stream); len(chunks) != 2 || err == nil || err.Error() != "worker lost" {
+		t.Errorf("replayed failing stream = %q, %v", chunks, err)
+	}
+
+	if n := replayer.Unused(); n != 0 {
+		t.Errorf("Unused() = %d, want 0", n)
+	}
+	if _, err := replayer.CreateChatCompletion(ctx, ask("France")); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("replaying a used interaction: error = %v, want ErrNoInteraction", err)
+	}
+}
+
+// TestReplayerRealtime tests that recorded chunk delays are replayed on request
+func TestReplayerRealtime(t *testing.T) {
+	cassette := &Cassette{Interactions: []Interaction{{
+		Stream: true,
+		Chunks: []Chunk{{Data: []byte(`{}`)}, {Delay: time.Hour, Data: []byte(`{}`)}},
+	}}}
+	replayer := NewReplayer(cassette)
+	replayer.Realtime = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	stream, err := replayer.CreateChatCompletionStream(ctx, smg.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	if _, err := stream.RecvJSON(); err != nil {
+		t.Fatalf("first RecvJSON() error: %v", err)
+	}
+	if _, err := stream.RecvJSON(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("delayed RecvJSON() error = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,255 @@
+// Package smgtest provides a mock chat client for testing code that uses the
+// SMG SDK without a backend.
+//
+//	client := smgtest.NewMockClient(
+//	    smgtest.Reply{Content: "Paris"},
+//	    smgtest.Reply{Chunks: []string{"Ro", "me"}},
+//	    smgtest.Reply{Err: smg.ErrNoHealthyWorkers},
+//	)
+//	answer, err := myapp.Ask(ctx, client, "Capital of France?")
+//	if got := client.Requests()[0].Messages; ...
+package smgtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// ErrNoReply is returned when a MockClient has no reply left for a request.
+var ErrNoReply = errors.New("smgtest: no reply scripted for request")
+
+var _ smg.ChatClient = (*MockClient)(nil)
+
+// Reply scripts the answer to one request.
+type Reply struct {
+	// Content is the assistant message. Streams deliver it as one chunk
+	// unless Chunks is set.
+	Content string
+	// Chunks are the content deltas of a stream; non-streaming requests get
+	// them joined. They take precedence over Content.
+	Chunks       []string
+	ToolCalls    []smg.ToolCall
+	FinishReason smg.FinishReason
+	Usage        smg.Usage
+
+	// Err fails the request before any response.
+	Err error
+	// StreamErr is returned by RecvJSON after the chunks instead of io.EOF;
+	// non-streaming requests fail with it.
+	StreamErr error
+
+	// Latency delays the response, or a stream's first chunk; ChunkDelay
+	// delays each later chunk. Both end early when the context is done.
+	Latency    time.Duration
+	ChunkDelay time.Duration
+}
+
+func (r Reply) content() string {
+	if r.Chunks != nil {
+		return strings.Join(r.Chunks, "")
+	}
+	return r.Content
+}
+
+func (r Reply) finishReason() smg.FinishReason {
+	switch {
+	case r.FinishReason != "":
+		return r.FinishReason
+	case len(r.ToolCalls) > 0:
+		return smg.FinishReasonToolCalls
+	default:
+		return smg.FinishReasonStop
+	}
+}
+
+// MockClient is a chat client that answers with scripted replies in order and
+// records the requests it receives. It is safe for concurrent use.
+type MockClient struct {
+	mu       sync.Mutex
+	replies  []Reply
+	requests []smg.ChatCompletionRequest
+
+	// Handler, if set, computes the reply to each request once the scripted
+	// replies are used up.
+	Handler func(req smg.ChatCompletionRequest) Reply
+}
+
+// NewMockClient creates a client that answers with replies in order.
+func NewMockClient(replies ...Reply) *MockClient {
+	return &MockClient{replies: replies}
+}
+
+// Enqueue adds replies after those already scripted.
+func (m *MockClient) Enqueue(replies ...Reply) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, replies...)
+}
+
+// Requests returns the requests received so far, in order.
+func (m *MockClient) Requests() []smg.ChatCompletionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]smg.ChatCompletionRequest(nil), m.requests...)
+}
+
+// next records req and returns its reply
+func (m *MockClient) next(req smg.ChatCompletionRequest) (Reply, int, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	n := len(m.requests)
+	if len(m.replies) > 0 {
+		reply := m.replies[0]
+		m.replies = m.replies[1:]
+		m.mu.Unlock()
+		return reply, n, nil
+	}
+	handler := m.Handler
+	m.mu.Unlock()
+
+	if handler == nil {
+		return Reply{}, n, ErrNoReply
+	}
+	return handler(req), n, nil
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CreateChatCompletion returns the next reply as a response.
+func (m *MockClient) CreateChatCompletion(ctx context.Context, req smg.ChatCompletionRequest) (*smg.ChatCompletionResponse, error) {
+	reply, n, err := m.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := sleep(ctx, reply.Latency); err != nil {
+		return nil, err
+	}
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	if reply.StreamErr != nil {
+		return nil, reply.StreamErr
+	}
+
+	return &smg.ChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-mock-%d", n),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []smg.Choice{{
+			Message:      smg.Message{Role: "assistant", Content: reply.content(), ToolCalls: reply.ToolCalls},
+			FinishReason: reply.finishReason(),
+		}},
+		Usage: reply.Usage,
+	}, nil
+}
+
+// CreateChatCompletionStream returns the next reply as a stream of chunks.
+// The final chunk carries the tool calls and finish reason; a usage chunk
+// follows when req.StreamOptions asks for one.
+func (m *MockClient) CreateChatCompletionStream(ctx context.Context, req smg.ChatCompletionRequest) (smg.ChatStream, error) {
+	reply, n, err := m.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Err != nil {
+		if err := sleep(ctx, reply.Latency); err != nil {
+			return nil, err
+		}
+		return nil, reply.Err
+	}
+
+	id := fmt.Sprintf("chatcmpl-mock-%d", n)
+	created := time.Now().Unix()
+	chunk := func(choices []smg.StreamChoice, usage *smg.Usage) string {
+		data, _ := json.Marshal(smg.ChatCompletionStreamResponse{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: req.Model,
+			Choices: choices, Usage: usage,
+		})
+		return string(data)
+	}
+
+	deltas := reply.Chunks
+	if deltas == nil {
+		deltas = []string{reply.Content}
+	}
+	var chunks []string
+	for i, delta := range deltas {
+		choice := smg.StreamChoice{Delta: smg.MessageDelta{Content: delta}}
+		if i == 0 {
+			choice.Delta.Role = "assistant"
+		}
+		chunks = append(chunks, chunk([]smg.StreamChoice{choice}, nil))
+	}
+	chunks = append(chunks, chunk([]smg.StreamChoice{{
+		Delta:        smg.MessageDelta{ToolCalls: reply.ToolCalls},
+		FinishReason: reply.finishReason(),
+	}}, nil))
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage != nil && *req.StreamOptions.IncludeUsage {
+		usage := reply.Usage
+		chunks = append(chunks, chunk([]smg.StreamChoice{}, &usage))
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	return &Stream{ctx: streamCtx, cancel: cancel, chunks: chunks, reply: reply}, nil
+}
+
+// Stream is a scripted chat completion stream.
+type Stream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	chunks []string
+	reply  Reply
+	sent   int
+}
+
+// RecvJSON returns the next chunk as JSON, then the reply's StreamErr or
+// io.EOF.
+func (s *Stream) RecvJSON() (string, error) {
+	delay := s.reply.ChunkDelay
+	if s.sent == 0 {
+		delay = s.reply.Latency
+	}
+	if s.sent == len(s.chunks) {
+		delay = 0
+	}
+	if err := sleep(s.ctx, delay); err != nil {
+		return "", err
+	}
+	if s.sent == len(s.chunks) {
+		if s.reply.StreamErr != nil {
+			return "", s.reply.StreamErr
+		}
+		return "", io.EOF
+	}
+	chunk := s.chunks[s.sent]
+	s.sent++
+	return chunk, nil
+}
+
+// Close ends the stream; later RecvJSON calls return context.Canceled.
+func (s *Stream) Close() error {
+	s.cancel()
+	return nil
+}
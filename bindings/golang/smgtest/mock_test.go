@@ -0,0 +1,112 @@
+package smgtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// TestMockClient tests canned replies, recording, and error injection
+func TestMockClient(t *testing.T) {
+	client := NewMockClient(
+		Reply{Content: "Paris", Usage: smg.Usage{TotalTokens: 7}},
+		Reply{Err: smg.ErrNoHealthyWorkers},
+	)
+	client.Handler = func(req smg.ChatCompletionRequest) Reply {
+		return Reply{Content: "echo: " + req.Messages[0].Content.(string)}
+	}
+	req := smg.ChatCompletionRequest{Model: "m", Messages: []smg.ChatMessage{{Role: "user", Content: "hi"}}}
+
+	resp, err := client.CreateChatCompletion(context.Background(), req)
+	if err != nil || resp.Choices[0].Message.Content != "Paris" || resp.Usage.TotalTokens != 7 || resp.Model != "m" {
+		t.Errorf("first reply = %+v, %v", resp, err)
+	}
+	if _, err := client.CreateChatCompletion(context.Background(), req); !errors.Is(err, smg.ErrNoHealthyWorkers) {
+		t.Errorf("second reply error = %v, want ErrNoHealthyWorkers", err)
+	}
+	resp, err = client.CreateChatCompletion(context.Background(), req)
+	if err != nil || resp.Choices[0].Message.Content != "echo: hi" {
+		t.Errorf("handler reply = %+v, %v", resp, err)
+	}
+	if n := len(client.Requests()); n != 3 {
+		t.Errorf("recorded %d requests, want 3", n)
+	}
+
+	if _, err := NewMockClient().CreateChatCompletion(context.Background(), req); !errors.Is(err, ErrNoReply) {
+		t.Errorf("unscripted error = %v, want ErrNoReply", err)
+	}
+}
+
+// TestMockStream tests scripted chunks, usage, and mid-stream errors
+func TestMockStream(t *testing.T) {
+	streamErr := errors.New("worker lost")
+	client := NewMockClient(Reply{Chunks: []string{"Hel", "lo"}, Usage: smg.Usage{TotalTokens: 3}, StreamErr: streamErr})
+	includeUsage := true
+	req := smg.ChatCompletionRequest{Stream: true, StreamOptions: &smg.StreamOptions{IncludeUsage: &includeUsage}}
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	defer stream.Close()
+
+	var content string
+	var finish smg.FinishReason
+	var usage *smg.Usage
+	for {
+		chunkJSON, err := stream.RecvJSON()
+		if err != nil {
+			if !errors.Is(err, streamErr) {
+				t.Errorf("RecvJSON() error = %v, want the scripted error", err)
+			}
+			break
+		}
+		var chunk smg.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", chunkJSON, err)
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			if choice.FinishReason != "" {
+				finish = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	if content != "Hello" || finish != "stop" || usage == nil || usage.TotalTokens != 3 {
+		t.Errorf("stream = %q, %q, %+v", content, finish, usage)
+	}
+}
+
+// TestMockLatency tests that latency is injected and honors cancellation
+func TestMockLatency(t *testing.T) {
+	client := NewMockClient(Reply{Content: "slow", Latency: time.Hour}, Reply{Content: "x", ChunkDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.CreateChatCompletion(ctx, smg.ChatCompletionRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CreateChatCompletion() error = %v, want DeadlineExceeded", err)
+	}
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), smg.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	if _, err := stream.RecvJSON(); err != nil {
+		t.Fatalf("first RecvJSON() error: %v", err)
+	}
+	stream.Close()
+	if _, err := stream.RecvJSON(); !errors.Is(err, context.Canceled) {
+		t.Errorf("RecvJSON() after Close = %v, want Canceled", err)
+	}
+	if _, err := stream.RecvJSON(); err == io.EOF {
+		t.Error("RecvJSON() after Close returned io.EOF")
+	}
+}
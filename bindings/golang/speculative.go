@@ -0,0 +1,115 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file reports the speculative decoding configuration of workers.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
+)
+
+// SpeculativeDecoding describes a worker's speculative decoding. SGLang
+// configures it when the worker is launched (--speculative-algorithm,
+// --speculative-draft-model-path, and so on), and the scheduler protocol has
+// no per-request speculative parameters, so workloads that need different
+// settings are served by separate pools of workers; SpeculativeDecoding
+// tells them apart and reports how well drafts are accepted.
+type SpeculativeDecoding struct {
+	// Endpoint is the worker described
+	Endpoint string `json:"endpoint"`
+
+	// Algorithm is e.g. "EAGLE", "EAGLE3", "NEXTN", or "NGRAM"; empty when
+	// speculative decoding is disabled
+	Algorithm      string `json:"algorithm"`
+	DraftModelPath string `json:"draft_model_path"`
+	// NumSteps is the number of draft steps per verification
+	NumSteps int `json:"num_steps"`
+	// EagleTopK is the branching factor of each draft step
+	EagleTopK int `json:"eagle_topk"`
+	// NumDraftTokens is the number of draft tokens verified at once
+	NumDraftTokens int `json:"num_draft_tokens"`
+	// AcceptThresholdSingle and AcceptThresholdAcc are the acceptance
+	// thresholds of tree verification
+	AcceptThresholdSingle float64 `json:"accept_threshold_single"`
+	AcceptThresholdAcc    float64 `json:"accept_threshold_acc"`
+
+	// AcceptLength is the mean number of tokens accepted per verification,
+	// and AcceptRate the fraction of draft tokens accepted, averaged over
+	// the worker's data parallel ranks. Both are zero when the worker
+	// reports no speculative metrics.
+	AcceptLength float64 `json:"accept_length"`
+	AcceptRate   float64 `json:"accept_rate"`
+}
+
+// Enabled reports whether the worker decodes speculatively.
+func (s *SpeculativeDecoding) Enabled() bool {
+	return s.Algorithm != ""
+}
+
+// SpeculativeDecoding returns the worker's speculative decoding
+// configuration, from its server arguments, and its acceptance metrics.
+// Workers that do not report load metrics are described without them.
+// Only SGLang workers report their server arguments; other dialects fail
+// with ErrInvalidRequest.
+func (c *Client) SpeculativeDecoding(ctx context.Context) (*SpeculativeDecoding, error) {
+	if c.backend != nil {
+		return nil, invalidRequest("speculative decoding is reported by SGLang workers only")
+	}
+
+	c.mu.RLock()
+	grpcClient := c.grpcClient
+	c.mu.RUnlock()
+
+	if grpcClient == nil {
+		return nil, errors.New("gRPC client is closed")
+	}
+
+	info, err := grpcClient.GetServerInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server info: %w", err)
+	}
+	loads, err := grpcClient.GetLoads(ctx, "spec")
+	if err != nil {
+		loads = nil
+	}
+	return speculativeFromProto(c.endpoint, info.GetServerArgs(), loads), nil
+}
+
+func speculativeFromProto(endpoint string, serverArgs *structpb.Struct, loads *proto.GetLoadsResponse) *SpeculativeDecoding {
+	args := serverArgs.GetFields()
+	str := func(key string) string {
+		return args[key].GetStringValue()
+	}
+	num := func(key string) float64 {
+		return args[key].GetNumberValue()
+	}
+	spec := &SpeculativeDecoding{
+		Endpoint:              endpoint,
+		Algorithm:             str("speculative_algorithm"),
+		DraftModelPath:        str("speculative_draft_model_path"),
+		NumSteps:              int(num("speculative_num_steps")),
+		EagleTopK:             int(num("speculative_eagle_topk")),
+		NumDraftTokens:        int(num("speculative_num_draft_tokens")),
+		AcceptThresholdSingle: num("speculative_accept_threshold_single"),
+		AcceptThresholdAcc:    num("speculative_accept_threshold_acc"),
+	}
+
+	ranks := 0
+	for _, load := range loads.GetLoads() {
+		if metrics := load.GetSpeculative(); metrics != nil {
+			spec.AcceptLength += metrics.GetAcceptLength()
+			spec.AcceptRate += metrics.GetAcceptRate()
+			ranks++
+		}
+	}
+	if ranks > 0 {
+		spec.AcceptLength /= float64(ranks)
+		spec.AcceptRate /= float64(ranks)
+	}
+	return spec
+}
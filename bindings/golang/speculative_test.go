@@ -0,0 +1,45 @@
+package smg
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/proto"
+)
+
+// TestSpeculativeFromProto tests reading the configuration from server
+// arguments and averaging the metrics of data parallel ranks
+func TestSpeculativeFromProto(t *testing.T) {
+	args, err := structpb.NewStruct(map[string]interface{}{
+		"speculative_algorithm":               "EAGLE3",
+		"speculative_draft_model_path":        "/models/draft",
+		"speculative_num_steps":               3,
+		"speculative_eagle_topk":              1,
+		"speculative_num_draft_tokens":        4,
+		"speculative_accept_threshold_single": 1.0,
+		"speculative_accept_threshold_acc":    1.0,
+		"tp_size":                             8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := &proto.GetLoadsResponse{Loads: []*proto.SchedulerLoad{
+		{Speculative: &proto.SpeculativeMetrics{AcceptLength: 3, AcceptRate: 0.6}},
+		{Speculative: &proto.SpeculativeMetrics{AcceptLength: 2, AcceptRate: 0.4}},
+		{},
+	}}
+
+	spec := speculativeFromProto("grpc://w:20000", args, loads)
+	if !spec.Enabled() || spec.Algorithm != "EAGLE3" || spec.DraftModelPath != "/models/draft" || spec.NumSteps != 3 || spec.EagleTopK != 1 || spec.NumDraftTokens != 4 || spec.AcceptThresholdAcc != 1 {
+		t.Errorf("configuration = %+v", spec)
+	}
+	if spec.AcceptLength != 2.5 || spec.AcceptRate != 0.5 {
+		t.Errorf("metrics = %v, %v, want 2.5, 0.5", spec.AcceptLength, spec.AcceptRate)
+	}
+
+	disabled, _ := structpb.NewStruct(map[string]interface{}{"speculative_algorithm": nil})
+	if spec := speculativeFromProto("grpc://w:20000", disabled, nil); spec.Enabled() || spec.AcceptLength != 0 {
+		t.Errorf("disabled = %+v", spec)
+	}
+}
@@ -13,12 +13,14 @@ use openai_protocol::{
     common::{ToolChoice, ToolChoiceValue},
 };
 use smg::routers::grpc::utils::process_chat_messages;
-use smg_grpc_client::sglang_scheduler::{SglangGenerateRequestOptions, SglangSchedulerClient};
+use smg_grpc_client::NoopTraceInjector;
 use uuid::Uuid;
 
 use super::{
+    dialect::{status_error_code, BackendClient},
     error::{set_error_message, SglErrorCode},
     grpc_converter::sgl_grpc_response_converter_create,
+    policy::dialect_from_ptr,
     runtime::RUNTIME,
     stream::SglangStreamHandle,
     tokenizer::TokenizerHandle,
@@ -26,9 +28,9 @@ use super::{
 };
 
 /// Handle for complete client SDK (gRPC client + tokenizer)
-/// This handle manages the connection to sglang and provides a complete SDK interface
+/// This handle manages the connection to the backend and provides a complete SDK interface
 pub struct SglangClientHandle {
-    pub(crate) client: Arc<SglangSchedulerClient>,
+    pub(crate) client: Arc<BackendClient>,
     pub(crate) tokenizer: Arc<dyn Tokenizer>,
 }
 
@@ -37,6 +39,7 @@ pub struct SglangClientHandle {
 /// # Arguments
 /// * `endpoint` - gRPC endpoint (e.g., "grpc://localhost:20000")
 /// * `tokenizer_path` - Path to tokenizer directory
+/// * `dialect` - Backend dialect: "sglang", "vllm" or "trtllm" (null or empty for "sglang")
 /// * `error_out` - Optional pointer to receive error message
 ///
 /// # Returns
@@ -44,12 +47,14 @@ pub struct SglangClientHandle {
 ///
 /// # Safety
 /// - `endpoint` and `tokenizer_path` must be valid null-terminated C strings
+/// - `dialect` may be null; if non-null, must be a valid null-terminated C string
 /// - `error_out` may be null; if non-null, must point to writable memory
 /// - Caller owns the returned handle and must free it with `sgl_client_free`
 #[no_mangle]
 pub unsafe extern "C" fn sgl_client_create(
     endpoint: *const c_char,
     tokenizer_path: *const c_char,
+    dialect: *const c_char,
     error_out: *mut *mut c_char,
 ) -> *mut SglangClientHandle {
     if endpoint.is_null() || tokenizer_path.is_null() {
@@ -73,6 +78,14 @@ pub unsafe extern "C" fn sgl_client_create(
         }
     };
 
+    let dialect = match dialect_from_ptr(dialect) {
+        Ok(d) => d,
+        Err(e) => {
+            set_error_message(error_out, &e);
+            return ptr::null_mut();
+        }
+    };
+
     // Create tokenizer
     let tokenizer = match create_tokenizer_from_file(tokenizer_path_str) {
         Ok(t) => t,
@@ -83,14 +96,15 @@ pub unsafe extern "C" fn sgl_client_create(
     };
 
     // Create gRPC client
-    let client =
-        match RUNTIME.block_on(async { SglangSchedulerClient::connect(endpoint_str).await }) {
-            Ok(c) => Arc::new(c),
-            Err(e) => {
-                set_error_message(error_out, &format!("Failed to connect to endpoint: {e}"));
-                return ptr::null_mut();
-            }
-        };
+    let client = match RUNTIME.block_on(async {
+        BackendClient::connect(dialect, endpoint_str, Arc::new(NoopTraceInjector)).await
+    }) {
+        Ok(c) => Arc::new(c),
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to connect to endpoint: {e}"));
+            return ptr::null_mut();
+        }
+    };
 
     Box::into_raw(Box::new(SglangClientHandle { client, tokenizer }))
 }
@@ -214,16 +228,13 @@ pub unsafe extern "C" fn sgl_client_chat_completion_stream(
     // Build GenerateRequest
     let request_id = format!("chatcmpl-{}", Uuid::now_v7());
     let require_reasoning = chat_requires_reasoning(&chat_request, tokenizer.as_ref());
-    let proto_request = match client.build_generate_request_from_chat(
+    let proto_request = match client.build_chat_request(
         request_id.clone(),
         &chat_request,
         processed_messages.text,
         token_ids,
-        SglangGenerateRequestOptions {
-            multimodal_inputs: None, // multimodal not supported in golang bindings
-            tool_call_constraint: tool_constraint,
-            require_reasoning,
-        },
+        tool_constraint,
+        require_reasoning,
     ) {
         Ok(req) => req,
         Err(e) => {
@@ -237,7 +248,7 @@ pub unsafe extern "C" fn sgl_client_chat_completion_stream(
         Ok(s) => s,
         Err(e) => {
             set_error_message(error_out, &format!("Failed to send request: {e}"));
-            return SglErrorCode::UnknownError;
+            return status_error_code(&e);
         }
     };
 
@@ -337,6 +348,7 @@ pub unsafe extern "C" fn sgl_client_chat_completion_stream(
         converter: Arc::new(tokio::sync::Mutex::new(converter_handle)),
         client: Arc::clone(&client),
         prompt_tokens,
+        abort: tokio::sync::watch::Sender::new(false),
         worker: None, // Single-client doesn't need load tracking
     }));
 
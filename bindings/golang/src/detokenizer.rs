@@ -0,0 +1,289 @@
+//! Incremental detokenizer FFI functions
+//!
+//! Exposes the same `DecodeStream` the response converter uses for streaming so
+//! callers holding raw token IDs (e.g., from logprobs) can reconstruct text
+//! without splitting multi-byte characters.
+
+use std::{
+    ffi::CString,
+    os::raw::{c_char, c_int},
+    ptr,
+};
+
+use llm_tokenizer::stream::DecodeStream;
+
+use super::{
+    error::{clear_error_message, set_error_message, SglErrorCode},
+    tokenizer::TokenizerHandle,
+};
+
+/// Opaque handle for an incremental detokenizer
+///
+/// The handle keeps its own reference to the tokenizer, so it remains valid
+/// after the tokenizer handle it was created from is freed.
+pub struct DetokenizerHandle {
+    stream: DecodeStream,
+}
+
+/// Hand a decoded chunk to C, writing an empty string when there is no text.
+unsafe fn write_text(
+    text: Option<String>,
+    text_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    match CString::new(text.unwrap_or_default()) {
+        Ok(s) => {
+            *text_out = s.into_raw();
+            clear_error_message(error_out);
+            SglErrorCode::Success
+        }
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create result string: {e}"));
+            SglErrorCode::MemoryError
+        }
+    }
+}
+
+/// Create an incremental detokenizer
+///
+/// # Arguments
+/// * `tokenizer_handle` - Tokenizer handle
+/// * `prompt_token_ids` - Optional prompt token IDs that precede the decoded tokens
+/// * `prompt_token_count` - Number of prompt token IDs
+/// * `skip_special_tokens` - Whether to omit special tokens from the output
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * Pointer to DetokenizerHandle on success, null on failure
+///
+/// # Safety
+/// - `tokenizer_handle` must be a valid pointer returned by `sgl_tokenizer_create_from_file`
+/// - `prompt_token_ids` may be null only if `prompt_token_count` is 0
+/// - `error_out` may be null; if non-null, must point to writable memory
+/// - Caller owns the returned handle and must free it with `sgl_detokenizer_free`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_detokenizer_create(
+    tokenizer_handle: *mut TokenizerHandle,
+    prompt_token_ids: *const u32,
+    prompt_token_count: usize,
+    skip_special_tokens: c_int,
+    error_out: *mut *mut c_char,
+) -> *mut DetokenizerHandle {
+    if tokenizer_handle.is_null() || (prompt_token_ids.is_null() && prompt_token_count > 0) {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return ptr::null_mut();
+    }
+
+    let prompt: &[u32] = if prompt_token_count == 0 {
+        &[]
+    } else {
+        std::slice::from_raw_parts(prompt_token_ids, prompt_token_count)
+    };
+
+    let tokenizer = (*tokenizer_handle).tokenizer.clone();
+    clear_error_message(error_out);
+    Box::into_raw(Box::new(DetokenizerHandle {
+        stream: DecodeStream::new(tokenizer, prompt, skip_special_tokens != 0),
+    }))
+}
+
+/// Feed token IDs to the detokenizer and return the text they complete
+///
+/// Text is only emitted once it forms valid UTF-8, so the result may be empty
+/// while a multi-byte character is still incomplete.
+///
+/// # Arguments
+/// * `handle` - Detokenizer handle
+/// * `token_ids` - Token IDs to append
+/// * `token_count` - Number of token IDs
+/// * `text_out` - Pointer to receive decoded text (must be freed with sgl_free_string)
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_detokenizer_create`
+/// - `token_ids` may be null only if `token_count` is 0
+/// - `text_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_detokenizer_step(
+    handle: *mut DetokenizerHandle,
+    token_ids: *const u32,
+    token_count: usize,
+    text_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || text_out.is_null() || (token_ids.is_null() && token_count > 0) {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    if token_count == 0 {
+        return write_text(None, text_out, error_out);
+    }
+
+    let ids = std::slice::from_raw_parts(token_ids, token_count);
+    match (*handle).stream.step_batch(ids) {
+        Ok(chunks) => write_text(Some(chunks.concat()), text_out, error_out),
+        Err(e) => {
+            set_error_message(error_out, &e.to_string());
+            SglErrorCode::TokenizationError
+        }
+    }
+}
+
+/// Flush any text held back by the detokenizer
+///
+/// # Arguments
+/// * `handle` - Detokenizer handle
+/// * `text_out` - Pointer to receive remaining text (must be freed with sgl_free_string)
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_detokenizer_create`
+/// - `text_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_detokenizer_flush(
+    handle: *mut DetokenizerHandle,
+    text_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || text_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    match (*handle).stream.flush() {
+        Ok(text) => write_text(text, text_out, error_out),
+        Err(e) => {
+            set_error_message(error_out, &e.to_string());
+            SglErrorCode::TokenizationError
+        }
+    }
+}
+
+/// Free a detokenizer handle
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_detokenizer_create`, or null
+/// - `handle` must not be used after this call
+/// - This function must not be called more than once for the same handle
+#[no_mangle]
+pub unsafe extern "C" fn sgl_detokenizer_free(handle: *mut DetokenizerHandle) {
+    if !handle.is_null() {
+        let _ = Box::from_raw(handle);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use std::{ffi::CStr, sync::Arc};
+
+    use llm_tokenizer::{Decoder, Encoder, Encoding, SpecialTokens, TokenizerTrait};
+
+    use super::*;
+
+    /// A tokenizer whose tokens are single UTF-8 bytes, so multi-byte
+    /// characters span several tokens as they do in byte-level BPE
+    struct ByteTokenizer {
+        special_tokens: SpecialTokens,
+    }
+
+    impl Encoder for ByteTokenizer {
+        fn encode(&self, input: &str, _add_special_tokens: bool) -> anyhow::Result<Encoding> {
+            Ok(Encoding::Plain(input.bytes().map(u32::from).collect()))
+        }
+
+        fn encode_batch(
+            &self,
+            inputs: &[&str],
+            add_special_tokens: bool,
+        ) -> anyhow::Result<Vec<Encoding>> {
+            inputs
+                .iter()
+                .map(|input| self.encode(input, add_special_tokens))
+                .collect()
+        }
+    }
+
+    impl Decoder for ByteTokenizer {
+        fn decode(&self, token_ids: &[u32], _skip_special_tokens: bool) -> anyhow::Result<String> {
+            let bytes: Vec<u8> = token_ids.iter().map(|&id| id as u8).collect();
+            Ok(String::from_utf8_lossy(&bytes).into_owned())
+        }
+    }
+
+    impl TokenizerTrait for ByteTokenizer {
+        fn vocab_size(&self) -> usize {
+            256
+        }
+
+        fn get_special_tokens(&self) -> &SpecialTokens {
+            &self.special_tokens
+        }
+
+        fn token_to_id(&self, token: &str) -> Option<u32> {
+            token.bytes().next().map(u32::from)
+        }
+
+        fn id_to_token(&self, id: u32) -> Option<String> {
+            Some(String::from_utf8_lossy(&[id as u8]).into_owned())
+        }
+
+        fn as_any(&self) -> &dyn std::any::Any {
+            self
+        }
+    }
+
+    /// Take ownership of a string returned through `text_out`
+    unsafe fn take_text(code: SglErrorCode, text: *mut c_char) -> String {
+        assert_eq!(code, SglErrorCode::Success);
+        let owned = CStr::from_ptr(text).to_str().unwrap().to_string();
+        drop(CString::from_raw(text));
+        owned
+    }
+
+    unsafe fn step(handle: *mut DetokenizerHandle, ids: &[u32]) -> String {
+        let mut text = ptr::null_mut();
+        let code =
+            sgl_detokenizer_step(handle, ids.as_ptr(), ids.len(), &mut text, ptr::null_mut());
+        take_text(code, text)
+    }
+
+    unsafe fn flush(handle: *mut DetokenizerHandle) -> String {
+        let mut text = ptr::null_mut();
+        let code = sgl_detokenizer_flush(handle, &mut text, ptr::null_mut());
+        take_text(code, text)
+    }
+
+    #[test]
+    fn test_multi_byte_character_split_across_steps() {
+        let mut tokenizer = TokenizerHandle {
+            tokenizer: Arc::new(ByteTokenizer {
+                special_tokens: SpecialTokens::default(),
+            }),
+        };
+        let euro: Vec<u32> = "€".bytes().map(u32::from).collect();
+        assert_eq!(euro.len(), 3);
+
+        unsafe {
+            let handle = sgl_detokenizer_create(&mut tokenizer, ptr::null(), 0, 1, ptr::null_mut());
+            assert!(!handle.is_null());
+
+            assert_eq!(step(handle, &[u32::from(b'a')]), "a");
+            // The first byte alone is held back rather than emitted as U+FFFD
+            assert_eq!(step(handle, &euro[..1]), "");
+            assert_eq!(step(handle, &euro[1..]), "€");
+            // Everything was emitted, so nothing partial is left to flush
+            assert_eq!(flush(handle), "");
+
+            sgl_detokenizer_free(handle);
+        }
+    }
+}
@@ -0,0 +1,527 @@
+//! Backend dialects for the gRPC client SDK
+//!
+//! Workers speak the gRPC protocol of their engine: SGLang's scheduler,
+//! vLLM's engine, or TensorRT-LLM's service. The engines name sampling
+//! parameters differently and shape their responses differently. This module
+//! builds each engine's requests from the OpenAI ones, and normalizes each
+//! engine's responses into SGLang's, which the response converter reads.
+
+use futures_util::StreamExt;
+use openai_protocol::{chat::ChatCompletionRequest, completion::CompletionRequest};
+use smg::worker::RuntimeType;
+use smg_grpc_client::{
+    sglang_proto as proto, sglang_scheduler, trtllm_proto, trtllm_service, vllm_engine, vllm_proto,
+    BoxedTraceInjector, SglangGenerateRequestOptions, SglangSchedulerClient, TrtllmServiceClient,
+    VllmEngineClient,
+};
+
+use super::error::SglErrorCode;
+
+/// Engine protocol spoken by the workers of a client
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Dialect {
+    Sglang,
+    Vllm,
+    Trtllm,
+}
+
+impl Dialect {
+    /// Parse a dialect name. The empty name is SGLang.
+    pub fn parse(name: &str) -> Result<Self, String> {
+        match name {
+            "" | "sglang" => Ok(Self::Sglang),
+            "vllm" => Ok(Self::Vllm),
+            "trtllm" | "tensorrt-llm" => Ok(Self::Trtllm),
+            _ => Err(format!(
+                "Unknown dialect: '{name}'. Supported dialects: sglang, vllm, trtllm"
+            )),
+        }
+    }
+
+    /// Engine name for error messages
+    pub fn display_name(self) -> &'static str {
+        match self {
+            Self::Sglang => "SGLang",
+            Self::Vllm => "vLLM",
+            Self::Trtllm => "TensorRT-LLM",
+        }
+    }
+
+    pub fn runtime_type(self) -> RuntimeType {
+        match self {
+            Self::Sglang => RuntimeType::Sglang,
+            Self::Vllm => RuntimeType::Vllm,
+            Self::Trtllm => RuntimeType::Trtllm,
+        }
+    }
+
+    /// Reject request fields the engine has no parameter for, rather than
+    /// dropping them silently
+    fn check_fields(self, has_session: bool, no_stop_trim: bool) -> Result<(), String> {
+        // Sessions are an SGLang scheduler feature
+        if has_session && self != Self::Sglang {
+            return Err(format!(
+                "session_params is not supported by {} workers",
+                self.display_name()
+            ));
+        }
+        // vLLM always trims the matched stop string
+        if no_stop_trim && self == Self::Vllm {
+            return Err("no_stop_trim is not supported by vLLM workers".to_string());
+        }
+        Ok(())
+    }
+
+    pub fn check_chat(self, request: &ChatCompletionRequest) -> Result<(), String> {
+        self.check_fields(request.session_params.is_some(), request.no_stop_trim)
+    }
+
+    pub fn check_completion(self, request: &CompletionRequest) -> Result<(), String> {
+        self.check_fields(request.session_params.is_some(), request.no_stop_trim)
+    }
+}
+
+/// Error code for a gRPC status returned by a worker.
+///
+/// The engines report requests they reject during validation with
+/// INVALID_ARGUMENT (vLLM for any `ValueError`) or OUT_OF_RANGE, and RPCs
+/// they do not implement with UNIMPLEMENTED; all are errors in the request
+/// for that dialect rather than worker failures.
+pub fn status_error_code(status: &tonic::Status) -> SglErrorCode {
+    match status.code() {
+        tonic::Code::InvalidArgument
+        | tonic::Code::OutOfRange
+        | tonic::Code::FailedPrecondition
+        | tonic::Code::Unimplemented => SglErrorCode::InvalidArgument,
+        _ => SglErrorCode::UnknownError,
+    }
+}
+
+/// gRPC client for one worker, in the worker's dialect
+#[derive(Clone)]
+pub enum BackendClient {
+    Sglang(SglangSchedulerClient),
+    Vllm(VllmEngineClient),
+    Trtllm(TrtllmServiceClient),
+}
+
+/// Generate request built by a `BackendClient` for its own dialect
+pub enum BackendRequest {
+    Sglang(Box<proto::GenerateRequest>),
+    Vllm(Box<vllm_proto::GenerateRequest>),
+    Trtllm(Box<trtllm_proto::GenerateRequest>),
+}
+
+impl BackendClient {
+    pub async fn connect(
+        dialect: Dialect,
+        endpoint: &str,
+        injector: BoxedTraceInjector,
+    ) -> Result<Self, Box<dyn std::error::Error + Send + Sync>> {
+        Ok(match dialect {
+            Dialect::Sglang => Self::Sglang(
+                SglangSchedulerClient::connect_with_trace_injector(endpoint, injector).await?,
+            ),
+            Dialect::Vllm => {
+                Self::Vllm(VllmEngineClient::connect_with_trace_injector(endpoint, injector).await?)
+            }
+            Dialect::Trtllm => Self::Trtllm(
+                TrtllmServiceClient::connect_with_trace_injector(endpoint, injector).await?,
+            ),
+        })
+    }
+
+    pub fn dialect(&self) -> Dialect {
+        match self {
+            Self::Sglang(_) => Dialect::Sglang,
+            Self::Vllm(_) => Dialect::Vllm,
+            Self::Trtllm(_) => Dialect::Trtllm,
+        }
+    }
+
+    /// Build a generate request from a chat request whose messages were
+    /// templated into `processed_text` and tokenized into `token_ids`
+    pub fn build_chat_request(
+        &self,
+        request_id: String,
+        body: &ChatCompletionRequest,
+        processed_text: String,
+        token_ids: Vec<u32>,
+        tool_call_constraint: Option<(String, String)>,
+        require_reasoning: bool,
+    ) -> Result<BackendRequest, String> {
+        self.dialect().check_chat(body)?;
+        // Multimodal inputs are not supported in the golang bindings
+        match self {
+            Self::Sglang(client) => client
+                .build_generate_request_from_chat(
+                    request_id,
+                    body,
+                    processed_text,
+                    token_ids,
+                    SglangGenerateRequestOptions {
+                        multimodal_inputs: None,
+                        tool_call_constraint,
+                        require_reasoning,
+                    },
+                )
+                .map(|req| BackendRequest::Sglang(Box::new(req))),
+            Self::Vllm(client) => client
+                .build_generate_request_from_chat(
+                    request_id,
+                    body,
+                    processed_text,
+                    token_ids,
+                    None,
+                    tool_call_constraint,
+                )
+                .map(|req| BackendRequest::Vllm(Box::new(req))),
+            Self::Trtllm(client) => client
+                .build_generate_request_from_chat(
+                    request_id,
+                    body,
+                    processed_text,
+                    token_ids,
+                    None,
+                    tool_call_constraint,
+                )
+                .map(|req| BackendRequest::Trtllm(Box::new(req))),
+        }
+    }
+
+    /// Build a generate request from a completion request whose prompt was
+    /// tokenized into `token_ids`
+    pub fn build_completion_request(
+        &self,
+        request_id: String,
+        body: &CompletionRequest,
+        original_text: String,
+        token_ids: Vec<u32>,
+    ) -> Result<BackendRequest, String> {
+        self.dialect().check_completion(body)?;
+        match self {
+            Self::Sglang(client) => client
+                .build_generate_request_from_completion(request_id, body, original_text, token_ids)
+                .map(|req| BackendRequest::Sglang(Box::new(req))),
+            Self::Vllm(client) => client
+                .build_generate_request_from_completion(request_id, body, original_text, token_ids)
+                .map(|req| BackendRequest::Vllm(Box::new(req))),
+            Self::Trtllm(client) => client
+                .build_generate_request_from_completion(request_id, body, original_text, token_ids)
+                .map(|req| BackendRequest::Trtllm(Box::new(req))),
+        }
+    }
+
+    /// Send a generate request built by this client
+    pub async fn generate(&self, request: BackendRequest) -> Result<BackendStream, tonic::Status> {
+        match (self, request) {
+            (Self::Sglang(client), BackendRequest::Sglang(req)) => {
+                Ok(BackendStream::Sglang(client.generate(*req).await?))
+            }
+            (Self::Vllm(client), BackendRequest::Vllm(req)) => {
+                // vLLM responses do not echo the request ID
+                let request_id = req.request_id.clone();
+                Ok(BackendStream::Vllm {
+                    stream: client.generate(*req).await?,
+                    request_id,
+                })
+            }
+            (Self::Trtllm(client), BackendRequest::Trtllm(req)) => {
+                Ok(BackendStream::Trtllm(client.generate(*req).await?))
+            }
+            _ => Err(tonic::Status::internal(
+                "generate request was built for another dialect",
+            )),
+        }
+    }
+
+    /// Embed tokenized text, returning the embedding and its prompt tokens
+    pub async fn embed(
+        &self,
+        request_id: String,
+        text: String,
+        token_ids: Vec<u32>,
+    ) -> Result<(Vec<f32>, u32), tonic::Status> {
+        match self {
+            Self::Sglang(client) => {
+                let request = client.build_embed_request(request_id, Some(text), token_ids);
+                let response = client.embed(request).await?;
+                Ok((response.embedding, response.prompt_tokens))
+            }
+            Self::Vllm(client) => {
+                let request = client.build_embed_request(request_id, Some(text), token_ids);
+                let response = client.embed(request).await?;
+                Ok((response.embedding, response.prompt_tokens))
+            }
+            Self::Trtllm(_) => Err(tonic::Status::unimplemented(
+                "embeddings are not supported by TensorRT-LLM workers",
+            )),
+        }
+    }
+
+    /// Model information as the JSON object the Go SDK decodes into
+    /// `ModelInfo`. Fields the engine does not report are omitted.
+    pub async fn model_info(&self) -> Result<serde_json::Value, tonic::Status> {
+        Ok(match self {
+            Self::Sglang(client) => {
+                let info = client.get_model_info().await?;
+                serde_json::json!({
+                    "model_path": info.model_path,
+                    "tokenizer_path": info.tokenizer_path,
+                    "served_model_name": info.served_model_name,
+                    "is_generation": info.is_generation,
+                    "supports_vision": info.supports_vision,
+                    "weight_version": info.weight_version,
+                    "model_type": info.model_type,
+                    "architectures": info.architectures,
+                    "max_context_length": info.max_context_length,
+                    "vocab_size": info.vocab_size,
+                })
+            }
+            Self::Vllm(client) => {
+                let info = client.get_model_info().await?;
+                serde_json::json!({
+                    "model_path": info.model_path,
+                    "tokenizer_path": info.tokenizer_path,
+                    "served_model_name": info.served_model_name,
+                    "is_generation": info.is_generation,
+                    "supports_vision": info.supports_vision,
+                    "model_type": info.model_type,
+                    "architectures": info.architectures,
+                    "max_context_length": info.max_context_length,
+                    "vocab_size": info.vocab_size,
+                })
+            }
+            Self::Trtllm(client) => {
+                let info = client.get_model_info().await?;
+                // TensorRT-LLM serves generation models only
+                serde_json::json!({
+                    "model_path": info.model_id,
+                    "is_generation": true,
+                    "max_context_length": info.max_seq_len,
+                    "vocab_size": info.vocab_size,
+                })
+            }
+        })
+    }
+}
+
+/// Generate stream of a worker, read as SGLang responses
+pub enum BackendStream {
+    Sglang(sglang_scheduler::AbortOnDropStream),
+    Vllm {
+        stream: vllm_engine::AbortOnDropStream,
+        request_id: String,
+    },
+    Trtllm(trtllm_service::AbortOnDropStream),
+}
+
+impl BackendStream {
+    /// Next response, normalized to SGLang's shape
+    pub async fn next(&mut self) -> Option<Result<proto::GenerateResponse, tonic::Status>> {
+        match self {
+            Self::Sglang(stream) => stream.next().await,
+            Self::Vllm { stream, request_id } => {
+                let result = stream.next().await?;
+                Some(result.map(|response| response_from_vllm(response, request_id)))
+            }
+            Self::Trtllm(stream) => {
+                let result = stream.next().await?;
+                Some(result.map(response_from_trtllm))
+            }
+        }
+    }
+
+    /// Mark the stream as completed so dropping it does not abort the request
+    pub fn mark_completed(&self) {
+        match self {
+            Self::Sglang(stream) => stream.mark_completed(),
+            Self::Vllm { stream, .. } => stream.mark_completed(),
+            Self::Trtllm(stream) => stream.mark_completed(),
+        }
+    }
+}
+
+fn response_from_vllm(
+    response: vllm_proto::GenerateResponse,
+    request_id: &str,
+) -> proto::GenerateResponse {
+    use vllm_proto::{generate_complete::MatchedStop, generate_response::Response};
+
+    let response = response.response.map(|response| match response {
+        Response::Chunk(chunk) => {
+            proto::generate_response::Response::Chunk(proto::GenerateStreamChunk {
+                token_ids: chunk.token_ids,
+                prompt_tokens: chunk.prompt_tokens,
+                completion_tokens: chunk.completion_tokens,
+                cached_tokens: chunk.cached_tokens,
+                index: chunk.index,
+                ..Default::default()
+            })
+        }
+        Response::Complete(complete) => {
+            proto::generate_response::Response::Complete(proto::GenerateComplete {
+                output_ids: complete.output_ids,
+                finish_reason: complete.finish_reason,
+                prompt_tokens: complete.prompt_tokens,
+                completion_tokens: complete.completion_tokens,
+                cached_tokens: complete.cached_tokens,
+                matched_stop: complete.matched_stop.map(|matched| match matched {
+                    MatchedStop::MatchedTokenId(id) => {
+                        proto::generate_complete::MatchedStop::MatchedTokenId(id)
+                    }
+                    MatchedStop::MatchedStopStr(stop) => {
+                        proto::generate_complete::MatchedStop::MatchedStopStr(stop)
+                    }
+                }),
+                index: complete.index,
+                ..Default::default()
+            })
+        }
+    });
+    proto::GenerateResponse {
+        request_id: request_id.to_string(),
+        response,
+    }
+}
+
+fn response_from_trtllm(response: trtllm_proto::GenerateResponse) -> proto::GenerateResponse {
+    use trtllm_proto::{generate_complete::MatchedStop, generate_response::Response};
+
+    let converted = response.response.map(|response| match response {
+        Response::Chunk(chunk) => {
+            proto::generate_response::Response::Chunk(proto::GenerateStreamChunk {
+                token_ids: chunk.token_ids,
+                prompt_tokens: chunk.prompt_tokens,
+                completion_tokens: chunk.completion_tokens,
+                cached_tokens: chunk.cached_tokens,
+                index: chunk.sequence_index,
+                ..Default::default()
+            })
+        }
+        Response::Complete(complete) => {
+            proto::generate_response::Response::Complete(proto::GenerateComplete {
+                output_ids: complete.output_token_ids,
+                finish_reason: trtllm_finish_reason(complete.finish_reason),
+                prompt_tokens: complete.prompt_tokens,
+                completion_tokens: complete.completion_tokens,
+                cached_tokens: complete.cached_tokens,
+                matched_stop: complete.matched_stop.map(|matched| match matched {
+                    MatchedStop::MatchedTokenId(id) => {
+                        proto::generate_complete::MatchedStop::MatchedTokenId(id)
+                    }
+                    MatchedStop::MatchedStopStr(stop) => {
+                        proto::generate_complete::MatchedStop::MatchedStopStr(stop)
+                    }
+                }),
+                index: complete.sequence_index,
+                ..Default::default()
+            })
+        }
+    });
+    proto::GenerateResponse {
+        request_id: response.request_id,
+        response: converted,
+    }
+}
+
+/// TensorRT-LLM reports a matched stop string as "stop_word", which is an
+/// OpenAI "stop"
+fn trtllm_finish_reason(reason: String) -> String {
+    if reason == "stop_word" {
+        "stop".to_string()
+    } else {
+        reason
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_dialect_parse() {
+        assert_eq!(Dialect::parse(""), Ok(Dialect::Sglang));
+        assert_eq!(Dialect::parse("vllm"), Ok(Dialect::Vllm));
+        assert_eq!(Dialect::parse("tensorrt-llm"), Ok(Dialect::Trtllm));
+        assert!(Dialect::parse("tgi").is_err());
+    }
+
+    #[test]
+    fn test_check_fields() {
+        assert!(Dialect::Sglang.check_fields(true, true).is_ok());
+        assert!(Dialect::Vllm.check_fields(false, true).is_err());
+        assert!(Dialect::Trtllm.check_fields(false, true).is_ok());
+        assert!(Dialect::Trtllm.check_fields(true, false).is_err());
+    }
+
+    #[test]
+    fn test_status_error_code() {
+        let invalid = tonic::Status::invalid_argument("prompt is too long");
+        assert_eq!(status_error_code(&invalid), SglErrorCode::InvalidArgument);
+        let internal = tonic::Status::internal("engine died");
+        assert_eq!(status_error_code(&internal), SglErrorCode::UnknownError);
+    }
+
+    #[test]
+    fn test_response_from_vllm() {
+        let chunk = vllm_proto::GenerateResponse {
+            response: Some(vllm_proto::generate_response::Response::Chunk(
+                vllm_proto::GenerateStreamChunk {
+                    token_ids: vec![1, 2],
+                    prompt_tokens: 5,
+                    completion_tokens: 2,
+                    index: 1,
+                    ..Default::default()
+                },
+            )),
+        };
+        let response = response_from_vllm(chunk, "chatcmpl-1");
+        assert_eq!(response.request_id, "chatcmpl-1");
+        match response.response {
+            Some(proto::generate_response::Response::Chunk(chunk)) => {
+                assert_eq!(chunk.token_ids, vec![1, 2]);
+                assert_eq!(chunk.prompt_tokens, 5);
+                assert_eq!(chunk.index, 1);
+            }
+            _ => panic!("expected a chunk"),
+        }
+    }
+
+    #[test]
+    fn test_response_from_trtllm() {
+        let complete = trtllm_proto::GenerateResponse {
+            request_id: "chatcmpl-2".to_string(),
+            response: Some(trtllm_proto::generate_response::Response::Complete(
+                trtllm_proto::GenerateComplete {
+                    output_token_ids: vec![7, 8, 9],
+                    sequence_index: 2,
+                    finish_reason: "stop_word".to_string(),
+                    matched_stop: Some(
+                        trtllm_proto::generate_complete::MatchedStop::MatchedStopStr(
+                            "\n\n".to_string(),
+                        ),
+                    ),
+                    completion_tokens: 3,
+                    ..Default::default()
+                },
+            )),
+        };
+        let response = response_from_trtllm(complete);
+        assert_eq!(response.request_id, "chatcmpl-2");
+        match response.response {
+            Some(proto::generate_response::Response::Complete(complete)) => {
+                assert_eq!(complete.output_ids, vec![7, 8, 9]);
+                assert_eq!(complete.index, 2);
+                assert_eq!(complete.finish_reason, "stop");
+                assert_eq!(
+                    complete.matched_stop,
+                    Some(proto::generate_complete::MatchedStop::MatchedStopStr(
+                        "\n\n".to_string()
+                    ))
+                );
+            }
+            _ => panic!("expected a completion"),
+        }
+    }
+}
@@ -11,6 +11,7 @@ pub enum SglErrorCode {
     TokenizationError = 2,
     ParsingError = 3,
     MemoryError = 4,
+    NoHealthyWorkers = 5,
     UnknownError = 99,
 }
 
@@ -18,6 +18,11 @@
 pub use client::sgl_client_chat_completion_stream;
 // Re-export client SDK functions
 pub use client::{sgl_client_create, sgl_client_free, SglangClientHandle};
+// Re-export incremental detokenizer functions
+pub use detokenizer::{
+    sgl_detokenizer_create, sgl_detokenizer_flush, sgl_detokenizer_free, sgl_detokenizer_step,
+    DetokenizerHandle,
+};
 // Re-export multi-worker client with load balancing
 pub use error::{clear_error_message, set_error_message, set_error_message_fmt, SglErrorCode};
 // Re-export gRPC converter functions
@@ -28,24 +33,32 @@ pub use grpc_converter::{
 // Re-export memory management functions
 pub use memory::{sgl_free_string, sgl_free_token_ids};
 pub use policy::{
-    sgl_multi_client_chat_completion_stream, sgl_multi_client_create, sgl_multi_client_free,
-    sgl_multi_client_healthy_count, sgl_multi_client_policy_name,
-    sgl_multi_client_set_worker_health, sgl_multi_client_tokenizer_path,
-    sgl_multi_client_worker_count, MultiWorkerClientHandle,
+    sgl_multi_client_add_worker, sgl_multi_client_chat_completion_stream,
+    sgl_multi_client_chat_completion_stream_bytes, sgl_multi_client_completion_stream,
+    sgl_multi_client_completion_stream_bytes, sgl_multi_client_create, sgl_multi_client_embed,
+    sgl_multi_client_free, sgl_multi_client_healthy_count, sgl_multi_client_model_info,
+    sgl_multi_client_policy_name, sgl_multi_client_remove_worker,
+    sgl_multi_client_remove_worker_by_endpoint, sgl_multi_client_set_worker_health,
+    sgl_multi_client_set_worker_health_by_endpoint, sgl_multi_client_tokenizer_path,
+    sgl_multi_client_worker_count, sgl_multi_client_workers, MultiWorkerClientHandle,
 };
 // Re-export postprocessor functions
 pub use postprocessor::{sgl_postprocess_stream_chunk, sgl_postprocess_stream_chunks_batch};
 // Re-export preprocessor functions
 pub use preprocessor::{
     sgl_preprocess_chat_request, sgl_preprocess_chat_request_with_tokenizer,
-    sgl_preprocessed_request_free,
+    sgl_preprocess_chat_request_with_tokenizer_bytes, sgl_preprocessed_request_free,
 };
 // Re-export stream functions
-pub use stream::{sgl_stream_free, sgl_stream_read_next, SglangStreamHandle};
+pub use stream::{
+    sgl_stream_abort, sgl_stream_free, sgl_stream_read_next, sgl_stream_worker_endpoint,
+    SglangStreamHandle,
+};
 // Re-export tokenizer functions
 pub use tokenizer::{
     sgl_tokenizer_apply_chat_template, sgl_tokenizer_apply_chat_template_with_tools,
     sgl_tokenizer_create_from_file, sgl_tokenizer_decode, sgl_tokenizer_encode, sgl_tokenizer_free,
+    sgl_tokenizer_id_to_token, sgl_tokenizer_special_tokens, sgl_tokenizer_token_to_id,
     TokenizerHandle,
 };
 // Re-export tool parser functions
@@ -56,6 +69,8 @@ pub use tool_parser::{
 
 // Sub-modules
 mod client;
+mod detokenizer;
+mod dialect;
 mod error;
 mod grpc_converter;
 mod memory;
@@ -63,6 +78,7 @@ mod policy;
 mod postprocessor;
 mod preprocessor;
 mod proto_parse;
+mod request_id;
 mod runtime;
 mod stream;
 mod stream_state;
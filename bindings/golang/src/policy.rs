@@ -7,19 +7,23 @@
 
 use std::{
     any::Any,
+    collections::HashMap,
     ffi::{CStr, CString},
     os::raw::c_char,
     ptr,
     sync::{
         atomic::{AtomicU8, AtomicUsize, Ordering},
-        Arc,
+        Arc, PoisonError, RwLock, RwLockReadGuard, RwLockWriteGuard,
     },
 };
 
 use async_trait::async_trait;
+use futures_util::StreamExt;
 use llm_tokenizer::{create_tokenizer_from_file, traits::Tokenizer};
 use openai_protocol::{
     chat::ChatCompletionRequest,
+    common::StringOrArray,
+    completion::CompletionRequest,
     worker::{HealthCheckConfig, WorkerSpec, WorkerStatus},
 };
 use smg::{
@@ -31,27 +35,28 @@ use smg::{
     worker::{
         circuit_breaker::{CircuitBreaker, CircuitState},
         resilience::ResolvedResilience,
-        worker::{RuntimeType, WorkerMetadata, WorkerRoutingKeyLoad},
+        worker::{WorkerMetadata, WorkerRoutingKeyLoad},
         ConnectionMode, Worker, WorkerResult, WorkerType,
     },
 };
-use smg_grpc_client::sglang_scheduler::{SglangGenerateRequestOptions, SglangSchedulerClient};
 use tokio::sync::Mutex as TokioMutex;
 use uuid::Uuid;
 
 use super::{
+    dialect::{status_error_code, BackendClient, Dialect},
     error::{set_error_message, SglErrorCode},
     grpc_converter::sgl_grpc_response_converter_create,
+    request_id::{request_id_from_ptr, with_request_id, RequestIdInjector},
     runtime::RUNTIME,
     stream::SglangStreamHandle,
     tokenizer::TokenizerHandle,
-    utils::chat_requires_reasoning,
+    utils::{chat_requires_reasoning, request_json_from_bytes},
 };
 
 /// FFI worker that implements the gateway's `Worker` trait so policies
 /// can select workers using their real selection logic (not a fallback).
 pub struct GrpcWorker {
-    pub(crate) client: Arc<SglangSchedulerClient>,
+    pub(crate) client: Arc<BackendClient>,
     pub(crate) endpoint: String,
     pub(crate) status: AtomicU8,
     pub(crate) load: AtomicUsize,
@@ -65,10 +70,10 @@ pub struct GrpcWorker {
 }
 
 impl GrpcWorker {
-    pub fn new(client: Arc<SglangSchedulerClient>, endpoint: String) -> Self {
+    pub fn new(client: Arc<BackendClient>, endpoint: String) -> Self {
         let mut spec = WorkerSpec::new(endpoint.clone());
         spec.connection_mode = ConnectionMode::Grpc;
-        spec.runtime_type = RuntimeType::Sglang;
+        spec.runtime_type = client.dialect().runtime_type();
 
         let metadata = WorkerMetadata {
             spec: Arc::new(spec),
@@ -236,44 +241,126 @@ impl Worker for GrpcWorker {
 /// Workers implement the gateway's `Worker` trait so that the real
 /// `LoadBalancingPolicy::select_worker` is used — no fallback logic needed.
 pub struct MultiWorkerClientHandle {
+    /// Workers can be added and removed while requests are in flight;
+    /// a request holds its own `Arc` to the worker it was sent to
+    pub(crate) pool: RwLock<WorkerPool>,
+    pub(crate) policy: Arc<dyn LoadBalancingPolicy>,
+    pub(crate) tokenizer_path: String,
+    /// Per-model tokenizer paths; models not listed use `tokenizer_path`
+    pub(crate) model_tokenizer_paths: HashMap<String, String>,
+    /// Adds the client metadata and request ID to requests to all workers
+    pub(crate) injector: RequestIdInjector,
+    /// Engine protocol of every worker
+    pub(crate) dialect: Dialect,
+}
+
+/// The workers of a multi-worker client, in the same order in both lists
+#[derive(Default)]
+pub(crate) struct WorkerPool {
     /// Workers as trait objects so policies can use them directly
     pub(crate) workers: Vec<Arc<dyn Worker>>,
     /// Concrete workers for accessing the gRPC client
     pub(crate) grpc_workers: Vec<Arc<GrpcWorker>>,
-    pub(crate) policy: Arc<dyn LoadBalancingPolicy>,
-    pub(crate) tokenizer_path: String,
+}
+
+impl WorkerPool {
+    fn push(&mut self, worker: Arc<GrpcWorker>) {
+        self.workers.push(Arc::clone(&worker) as Arc<dyn Worker>);
+        self.grpc_workers.push(worker);
+    }
+
+    fn remove(&mut self, index: usize) {
+        self.workers.remove(index);
+        self.grpc_workers.remove(index);
+    }
 }
 
 impl MultiWorkerClientHandle {
+    /// Lock the worker pool for reading. Pool updates cannot leave it
+    /// inconsistent, so a poisoned lock is still usable.
+    pub(crate) fn pool(&self) -> RwLockReadGuard<'_, WorkerPool> {
+        self.pool.read().unwrap_or_else(PoisonError::into_inner)
+    }
+
+    fn pool_mut(&self) -> RwLockWriteGuard<'_, WorkerPool> {
+        self.pool.write().unwrap_or_else(PoisonError::into_inner)
+    }
+
+    /// Snapshot of the current workers
+    pub(crate) fn grpc_workers(&self) -> Vec<Arc<GrpcWorker>> {
+        self.pool().grpc_workers.clone()
+    }
+
+    /// Resolve the tokenizer path for a request's model name.
+    pub fn tokenizer_path_for(&self, model: &str) -> &str {
+        self.model_tokenizer_paths
+            .get(model)
+            .map(String::as_str)
+            .unwrap_or(&self.tokenizer_path)
+    }
+
     /// Select a worker using the configured policy.
     ///
     /// Delegates to `LoadBalancingPolicy::select_worker` with real `Arc<dyn Worker>`
     /// objects, so all policies (round_robin, random, cache_aware, etc.) work natively.
     pub fn select_worker(&self, info: &SelectWorkerInfo) -> Option<Arc<GrpcWorker>> {
-        let idx = self.policy.select_worker(&self.workers, info)?;
-        Some(Arc::clone(&self.grpc_workers[idx]))
+        let pool = self.pool();
+        let idx = self.policy.select_worker(&pool.workers, info)?;
+        Some(Arc::clone(&pool.grpc_workers[idx]))
     }
 }
 
+/// Connect to a worker endpoint that speaks `dialect`
+fn connect_worker(
+    endpoint: &str,
+    injector: &RequestIdInjector,
+    dialect: Dialect,
+) -> Result<Arc<GrpcWorker>, String> {
+    // Requests carry the client metadata and the caller's request ID as
+    // gRPC metadata
+    let client = RUNTIME
+        .block_on(async {
+            BackendClient::connect(dialect, endpoint, Arc::new(injector.clone())).await
+        })
+        .map_err(|e| format!("Failed to connect to {endpoint}: {e}"))?;
+    Ok(Arc::new(GrpcWorker::new(
+        Arc::new(client),
+        endpoint.to_string(),
+    )))
+}
+
 /// Create a multi-worker client with load balancing
 ///
 /// # Arguments
 /// * `endpoints` - Comma-separated list of gRPC endpoints (e.g., "grpc://host1:20000,grpc://host2:20001")
-/// * `tokenizer_path` - Path to tokenizer directory
+/// * `tokenizer_path` - Path to tokenizer directory (may be empty when every
+///   model is listed in `model_tokenizers_json`)
+/// * `model_tokenizers_json` - Optional JSON object mapping model names to tokenizer paths
+///   (null or empty string for none)
+/// * `client_metadata_json` - Optional JSON object of gRPC metadata sent with every
+///   request, e.g. the client name and version (null or empty string for none)
 /// * `policy_name` - Load balancing policy name ("round_robin", "random", "cache_aware")
+/// * `dialect` - Engine protocol of the workers ("sglang", "vllm", "trtllm"; null or
+///   empty string for "sglang")
 /// * `error_out` - Optional pointer to receive error message
 ///
 /// # Returns
 /// * Pointer to MultiWorkerClientHandle on success, null on failure
 ///
 /// # Safety
-/// - All string arguments must be valid null-terminated C strings
+/// - All string arguments except `model_tokenizers_json`, `client_metadata_json` and
+///   `dialect` must be valid null-terminated C strings
+/// - `model_tokenizers_json`, `client_metadata_json` and `dialect` may be null; if
+///   non-null, must be valid null-terminated C strings
 /// - Caller owns the returned handle and must free it with `sgl_multi_client_free`
 #[no_mangle]
 pub unsafe extern "C" fn sgl_multi_client_create(
     endpoints: *const c_char,
     tokenizer_path: *const c_char,
+    model_tokenizers_json: *const c_char,
+    client_metadata_json: *const c_char,
     policy_name: *const c_char,
+    dialect: *const c_char,
     error_out: *mut *mut c_char,
 ) -> *mut MultiWorkerClientHandle {
     if endpoints.is_null() || tokenizer_path.is_null() || policy_name.is_null() {
@@ -305,6 +392,38 @@ pub unsafe extern "C" fn sgl_multi_client_create(
         }
     };
 
+    let dialect = match dialect_from_ptr(dialect) {
+        Ok(d) => d,
+        Err(e) => {
+            set_error_message(error_out, &e);
+            return ptr::null_mut();
+        }
+    };
+
+    let model_tokenizer_paths =
+        match string_map_from_ptr(model_tokenizers_json, "model_tokenizers_json") {
+            Ok(m) => m,
+            Err(e) => {
+                set_error_message(error_out, &e);
+                return ptr::null_mut();
+            }
+        };
+
+    let injector = match string_map_from_ptr(client_metadata_json, "client_metadata_json")
+        .and_then(|m| RequestIdInjector::with_client_metadata(&m))
+    {
+        Ok(injector) => injector,
+        Err(e) => {
+            set_error_message(error_out, &e);
+            return ptr::null_mut();
+        }
+    };
+
+    if tokenizer_path_str.is_empty() && model_tokenizer_paths.is_empty() {
+        set_error_message(error_out, "tokenizer_path or model tokenizers must be provided");
+        return ptr::null_mut();
+    }
+
     // Parse endpoints
     let endpoint_list: Vec<&str> = endpoints_str
         .split(',')
@@ -358,30 +477,60 @@ pub unsafe extern "C" fn sgl_multi_client_create(
     };
 
     // Create gRPC clients for all endpoints
-    let mut grpc_workers = Vec::with_capacity(endpoint_list.len());
-    let mut workers: Vec<Arc<dyn Worker>> = Vec::with_capacity(endpoint_list.len());
+    let mut pool = WorkerPool::default();
     for endpoint in endpoint_list {
-        let client =
-            match RUNTIME.block_on(async { SglangSchedulerClient::connect(endpoint).await }) {
-                Ok(c) => Arc::new(c),
-                Err(e) => {
-                    set_error_message(error_out, &format!("Failed to connect to {endpoint}: {e}"));
-                    return ptr::null_mut();
-                }
-            };
-        let grpc_worker = Arc::new(GrpcWorker::new(client, endpoint.to_string()));
-        workers.push(Arc::clone(&grpc_worker) as Arc<dyn Worker>);
-        grpc_workers.push(grpc_worker);
+        match connect_worker(endpoint, &injector, dialect) {
+            Ok(worker) => pool.push(worker),
+            Err(e) => {
+                set_error_message(error_out, &e);
+                return ptr::null_mut();
+            }
+        }
     }
 
     Box::into_raw(Box::new(MultiWorkerClientHandle {
-        workers,
-        grpc_workers,
+        pool: RwLock::new(pool),
         policy,
         tokenizer_path: tokenizer_path_str,
+        model_tokenizer_paths,
+        injector,
+        dialect,
     }))
 }
 
+/// Read an optional dialect name. Null and empty arguments are SGLang.
+///
+/// # Safety
+/// - `dialect` must be null or a valid null-terminated C string
+pub(crate) unsafe fn dialect_from_ptr(dialect: *const c_char) -> Result<Dialect, String> {
+    if dialect.is_null() {
+        return Ok(Dialect::Sglang);
+    }
+    match CStr::from_ptr(dialect).to_str() {
+        Ok(s) => Dialect::parse(s),
+        Err(_) => Err("Invalid UTF-8 in dialect".to_string()),
+    }
+}
+
+/// Read an optional JSON object of strings. Null and empty arguments are
+/// an empty map.
+///
+/// # Safety
+/// - `json` must be null or a valid null-terminated C string
+unsafe fn string_map_from_ptr(
+    json: *const c_char,
+    name: &str,
+) -> Result<HashMap<String, String>, String> {
+    if json.is_null() {
+        return Ok(HashMap::new());
+    }
+    match CStr::from_ptr(json).to_str() {
+        Ok("") => Ok(HashMap::new()),
+        Ok(s) => serde_json::from_str(s).map_err(|e| format!("Failed to parse {name}: {e}")),
+        Err(_) => Err(format!("Invalid UTF-8 in {name}")),
+    }
+}
+
 /// Free a multi-worker client handle
 ///
 /// # Safety
@@ -405,7 +554,7 @@ pub unsafe extern "C" fn sgl_multi_client_worker_count(
     if handle.is_null() {
         return 0;
     }
-    (*handle).grpc_workers.len()
+    (*handle).pool().grpc_workers.len()
 }
 
 /// Get the number of healthy workers in the multi-worker client
@@ -420,6 +569,7 @@ pub unsafe extern "C" fn sgl_multi_client_healthy_count(
         return 0;
     }
     (*handle)
+        .pool()
         .grpc_workers
         .iter()
         .filter(|w| w.is_healthy())
@@ -439,10 +589,56 @@ pub unsafe extern "C" fn sgl_multi_client_set_worker_health(
     if handle.is_null() {
         return SglErrorCode::InvalidArgument;
     }
-    let client = &*handle;
-    if worker_index >= client.grpc_workers.len() {
+    let pool = (*handle).pool();
+    let Some(worker) = pool.grpc_workers.get(worker_index) else {
+        return SglErrorCode::InvalidArgument;
+    };
+    set_worker_health(worker, healthy);
+    SglErrorCode::Success
+}
+
+/// Mark a worker as healthy or unhealthy by endpoint
+///
+/// The worker is looked up and updated under the pool lock, so workers added
+/// or removed concurrently cannot make it update another worker.
+///
+/// # Returns
+/// * SglErrorCode::Success on success, InvalidArgument if no worker has the
+///   endpoint
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `endpoint` must be a valid null-terminated C string
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_set_worker_health_by_endpoint(
+    handle: *mut MultiWorkerClientHandle,
+    endpoint: *const c_char,
+    healthy: bool,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || endpoint.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
         return SglErrorCode::InvalidArgument;
     }
+    let Ok(endpoint_str) = CStr::from_ptr(endpoint).to_str() else {
+        set_error_message(error_out, "Invalid UTF-8 in endpoint");
+        return SglErrorCode::InvalidArgument;
+    };
+    let pool = (*handle).pool();
+    let Some(worker) = pool
+        .grpc_workers
+        .iter()
+        .find(|w| w.endpoint == endpoint_str)
+    else {
+        set_error_message(error_out, &format!("Worker {endpoint_str} not found"));
+        return SglErrorCode::InvalidArgument;
+    };
+    set_worker_health(worker, healthy);
+    SglErrorCode::Success
+}
+
+fn set_worker_health(worker: &GrpcWorker, healthy: bool) {
     // The Go SDK is the source of truth for FFI worker health, so we
     // map its boolean directly without the legacy `set_healthy` guard
     // (which only demoted from `Ready`). FFI workers never run the
@@ -453,10 +649,195 @@ pub unsafe extern "C" fn sgl_multi_client_set_worker_health(
     } else {
         WorkerStatus::NotReady
     };
-    client.grpc_workers[worker_index].set_status(status);
+    worker.set_status(status);
+}
+
+/// Connect to a new worker and add it to the pool
+///
+/// The worker is appended, so existing worker indices are unchanged.
+///
+/// # Arguments
+/// * `handle` - Multi-worker client handle
+/// * `endpoint` - gRPC endpoint of the worker (e.g., "grpc://host3:20000")
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, InvalidArgument if the endpoint is
+///   already in the pool, UnknownError if the connection fails
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `endpoint` must be a valid null-terminated C string
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_add_worker(
+    handle: *mut MultiWorkerClientHandle,
+    endpoint: *const c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || endpoint.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+    let endpoint_str = match CStr::from_ptr(endpoint).to_str() {
+        Ok(s) => s.trim(),
+        Err(_) => {
+            set_error_message(error_out, "Invalid UTF-8 in endpoint");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+    if endpoint_str.is_empty() {
+        set_error_message(error_out, "No valid endpoint provided");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let client = &*handle;
+    let is_duplicate =
+        |pool: &WorkerPool| pool.grpc_workers.iter().any(|w| w.endpoint == endpoint_str);
+    if is_duplicate(&client.pool()) {
+        set_error_message(error_out, &format!("Worker {endpoint_str} already exists"));
+        return SglErrorCode::InvalidArgument;
+    }
+
+    // Connect without holding the lock so requests keep flowing meanwhile
+    let worker = match connect_worker(endpoint_str, &client.injector, client.dialect) {
+        Ok(w) => w,
+        Err(e) => {
+            set_error_message(error_out, &e);
+            return SglErrorCode::UnknownError;
+        }
+    };
+
+    let mut pool = client.pool_mut();
+    if is_duplicate(&pool) {
+        set_error_message(error_out, &format!("Worker {endpoint_str} already exists"));
+        return SglErrorCode::InvalidArgument;
+    }
+    pool.push(worker);
     SglErrorCode::Success
 }
 
+/// Remove a worker from the pool by index
+///
+/// The worker stops receiving new requests; requests already sent to it run
+/// to completion. Workers after it move down one index.
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_remove_worker(
+    handle: *mut MultiWorkerClientHandle,
+    worker_index: usize,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+    let mut pool = (*handle).pool_mut();
+    if worker_index >= pool.grpc_workers.len() {
+        set_error_message(
+            error_out,
+            &format!(
+                "Worker index {worker_index} out of range ({} workers)",
+                pool.grpc_workers.len()
+            ),
+        );
+        return SglErrorCode::InvalidArgument;
+    }
+    pool.remove(worker_index);
+    SglErrorCode::Success
+}
+
+/// Remove a worker from the pool by endpoint
+///
+/// Like `sgl_multi_client_remove_worker`, but the worker is looked up and
+/// removed under the pool lock, so workers added or removed concurrently
+/// cannot make it remove another worker.
+///
+/// # Returns
+/// * SglErrorCode::Success on success, InvalidArgument if no worker has the
+///   endpoint
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `endpoint` must be a valid null-terminated C string
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_remove_worker_by_endpoint(
+    handle: *mut MultiWorkerClientHandle,
+    endpoint: *const c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || endpoint.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+    let Ok(endpoint_str) = CStr::from_ptr(endpoint).to_str() else {
+        set_error_message(error_out, "Invalid UTF-8 in endpoint");
+        return SglErrorCode::InvalidArgument;
+    };
+    let mut pool = (*handle).pool_mut();
+    let Some(index) = pool
+        .grpc_workers
+        .iter()
+        .position(|w| w.endpoint == endpoint_str)
+    else {
+        set_error_message(error_out, &format!("Worker {endpoint_str} not found"));
+        return SglErrorCode::InvalidArgument;
+    };
+    pool.remove(index);
+    SglErrorCode::Success
+}
+
+/// Describe every worker in the pool
+///
+/// Returns a JSON array with one `{"endpoint", "healthy", "load",
+/// "processed_requests"}` entry per worker, in worker order. `load` is the
+/// number of requests in flight on the worker.
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `result_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+/// - Caller must free the string written to `result_out` using `sgl_free_string`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_workers(
+    handle: *mut MultiWorkerClientHandle,
+    result_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || result_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let entries: Vec<serde_json::Value> = (*handle)
+        .grpc_workers()
+        .iter()
+        .map(|worker| {
+            serde_json::json!({
+                "endpoint": worker.endpoint,
+                "healthy": worker.is_healthy(),
+                "load": worker.load(),
+                "processed_requests": worker.processed_requests(),
+            })
+        })
+        .collect();
+
+    match CString::new(serde_json::Value::Array(entries).to_string()) {
+        Ok(s) => {
+            *result_out = s.into_raw();
+            SglErrorCode::Success
+        }
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create result string: {e}"));
+            SglErrorCode::MemoryError
+        }
+    }
+}
+
 /// Get the policy name
 ///
 /// # Safety
@@ -494,11 +875,248 @@ pub unsafe extern "C" fn sgl_multi_client_tokenizer_path(
     }
 }
 
+/// Query every worker for the model it serves
+///
+/// Returns a JSON array with one entry per worker, in worker order. Each entry
+/// has an `endpoint` and either an `info` object (GetModelInfo fields) or an
+/// `error` string if the worker could not be reached.
+///
+/// # Arguments
+/// * `handle` - Multi-worker client handle
+/// * `timeout_ms` - Per-worker timeout in milliseconds (0 for the default of 5s)
+/// * `result_out` - Pointer to receive JSON string (must be freed with sgl_free_string)
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `result_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+/// - Caller must free the string written to `result_out` using `sgl_free_string`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_model_info(
+    handle: *mut MultiWorkerClientHandle,
+    timeout_ms: u64,
+    result_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || result_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let timeout = std::time::Duration::from_millis(if timeout_ms == 0 {
+        5000
+    } else {
+        timeout_ms
+    });
+    let workers = (*handle).grpc_workers();
+
+    let entries: Vec<serde_json::Value> = RUNTIME.block_on(async move {
+        futures_util::future::join_all(workers.iter().map(|worker| async move {
+            match tokio::time::timeout(timeout, worker.client.model_info()).await {
+                Ok(Ok(info)) => serde_json::json!({
+                    "endpoint": worker.endpoint,
+                    "info": info,
+                }),
+                Ok(Err(status)) => serde_json::json!({
+                    "endpoint": worker.endpoint,
+                    "error": status.message(),
+                }),
+                Err(_) => serde_json::json!({
+                    "endpoint": worker.endpoint,
+                    "error": format!("timed out after {}ms", timeout.as_millis()),
+                }),
+            }
+        }))
+        .await
+    });
+
+    match CString::new(serde_json::Value::Array(entries).to_string()) {
+        Ok(s) => {
+            *result_out = s.into_raw();
+            SglErrorCode::Success
+        }
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create result string: {e}"));
+            SglErrorCode::MemoryError
+        }
+    }
+}
+
+/// Number of inputs `sgl_multi_client_embed` sends to the workers at a time,
+/// as the Go `Client` does
+const EMBED_CONCURRENCY: usize = 8;
+
+/// Compute embeddings for a batch of inputs using load-balanced worker selection
+///
+/// Each input is tokenized (with special tokens) and sent to a worker picked by
+/// the policy, `EMBED_CONCURRENCY` inputs at a time. The call fails if any
+/// input fails.
+///
+/// Returns a JSON array with one `{"embedding": [...], "prompt_tokens": n}`
+/// entry per input, in input order.
+///
+/// # Arguments
+/// * `handle` - Multi-worker client handle
+/// * `model` - Model name used to pick the tokenizer
+/// * `inputs_json` - JSON array of input strings
+/// * `caller_request_id` - Optional request ID sent as `x-request-id` gRPC metadata (may be null)
+/// * `timeout_ms` - Per-input timeout in milliseconds (0 for the default of 5s)
+/// * `result_out` - Pointer to receive JSON string (must be freed with sgl_free_string)
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `model` and `inputs_json` must be valid null-terminated C strings
+/// - `caller_request_id` must be null or a valid null-terminated C string
+/// - `result_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+/// - Caller must free the string written to `result_out` using `sgl_free_string`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_embed(
+    handle: *mut MultiWorkerClientHandle,
+    model: *const c_char,
+    inputs_json: *const c_char,
+    caller_request_id: *const c_char,
+    timeout_ms: u64,
+    result_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || model.is_null() || inputs_json.is_null() || result_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let (model_str, inputs_str) = match (
+        CStr::from_ptr(model).to_str(),
+        CStr::from_ptr(inputs_json).to_str(),
+    ) {
+        (Ok(m), Ok(i)) => (m, i),
+        _ => {
+            set_error_message(error_out, "Invalid UTF-8 in arguments");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    let inputs: Vec<String> = match serde_json::from_str(inputs_str) {
+        Ok(v) => v,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to parse inputs JSON: {e}"));
+            return SglErrorCode::ParsingError;
+        }
+    };
+
+    let multi_client = &*handle;
+    if multi_client.dialect == Dialect::Trtllm {
+        set_error_message(
+            error_out,
+            "Embeddings are not supported by TensorRT-LLM workers",
+        );
+        return SglErrorCode::InvalidArgument;
+    }
+    let tokenizer_path = multi_client.tokenizer_path_for(model_str);
+    if tokenizer_path.is_empty() {
+        set_error_message(
+            error_out,
+            &format!("No tokenizer configured for model '{model_str}'"),
+        );
+        return SglErrorCode::InvalidArgument;
+    }
+    let tokenizer: Arc<dyn Tokenizer> = match create_tokenizer_from_file(tokenizer_path) {
+        Ok(t) => t,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create tokenizer: {e}"));
+            return SglErrorCode::TokenizationError;
+        }
+    };
+
+    // Tokenize and pick a worker for every input before sending anything
+    let mut requests = Vec::with_capacity(inputs.len());
+    for text in inputs {
+        let token_ids = match tokenizer.encode(&text, true) {
+            Ok(encoding) => encoding.token_ids().to_vec(),
+            Err(e) => {
+                set_error_message(error_out, &format!("Failed to tokenize: {e}"));
+                return SglErrorCode::TokenizationError;
+            }
+        };
+        let select_info = SelectWorkerInfo {
+            request_text: Some(&text),
+            tokens: Some(&token_ids),
+            ..Default::default()
+        };
+        let Some(worker) = multi_client.select_worker(&select_info) else {
+            set_error_message(error_out, "No healthy workers available");
+            return SglErrorCode::NoHealthyWorkers;
+        };
+        requests.push((worker, format!("embd-{}", Uuid::now_v7()), text, token_ids));
+    }
+
+    let timeout = std::time::Duration::from_millis(if timeout_ms == 0 { 5000 } else { timeout_ms });
+    let caller_request_id = request_id_from_ptr(caller_request_id);
+    let results = RUNTIME.block_on(with_request_id(caller_request_id, async move {
+        // buffered keeps the results in input order
+        futures_util::stream::iter(requests)
+            .map(|(worker, request_id, text, token_ids)| async move {
+                worker.increment_load();
+                // The timeout wraps only the call, so the load is always released
+                let result =
+                    tokio::time::timeout(timeout, worker.client.embed(request_id, text, token_ids))
+                        .await;
+                worker.decrement_load();
+                worker.increment_processed();
+                result
+            })
+            .buffered(EMBED_CONCURRENCY)
+            .collect::<Vec<_>>()
+            .await
+    }));
+
+    let mut entries = Vec::with_capacity(results.len());
+    for result in results {
+        match result {
+            Ok(Ok((embedding, prompt_tokens))) => entries.push(serde_json::json!({
+                "embedding": embedding,
+                "prompt_tokens": prompt_tokens,
+            })),
+            Ok(Err(status)) => {
+                set_error_message(error_out, &format!("Embed failed: {}", status.message()));
+                return status_error_code(&status);
+            }
+            Err(_) => {
+                set_error_message(
+                    error_out,
+                    &format!("Embed timed out after {}ms", timeout.as_millis()),
+                );
+                return SglErrorCode::UnknownError;
+            }
+        }
+    }
+
+    match CString::new(serde_json::Value::Array(entries).to_string()) {
+        Ok(s) => {
+            *result_out = s.into_raw();
+            SglErrorCode::Success
+        }
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create result string: {e}"));
+            SglErrorCode::MemoryError
+        }
+    }
+}
+
 /// Send a chat completion request using load-balanced worker selection
 ///
 /// # Arguments
 /// * `client_handle` - Multi-worker client handle
 /// * `request_json` - OpenAI ChatCompletionRequest as JSON string
+/// * `caller_request_id` - Optional request ID sent as `x-request-id` gRPC metadata (may be null)
 /// * `stream_handle_out` - Pointer to receive stream handle
 /// * `error_out` - Optional pointer to receive error message
 ///
@@ -508,12 +1126,14 @@ pub unsafe extern "C" fn sgl_multi_client_tokenizer_path(
 /// # Safety
 /// - `client_handle` must be a valid pointer returned by `sgl_multi_client_create`
 /// - `request_json` must be a valid null-terminated C string containing valid JSON
+/// - `caller_request_id` must be null or a valid null-terminated C string
 /// - `stream_handle_out` must be a valid pointer to writable memory
 /// - Caller owns the stream handle and must free it with `sgl_stream_free`
 #[no_mangle]
 pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
     client_handle: *mut MultiWorkerClientHandle,
     request_json: *const c_char,
+    caller_request_id: *const c_char,
     stream_handle_out: *mut *mut SglangStreamHandle,
     error_out: *mut *mut c_char,
 ) -> SglErrorCode {
@@ -530,18 +1150,77 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
         }
     };
 
-    let multi_client = &*client_handle;
+    chat_completion_stream(
+        &*client_handle,
+        request_str,
+        caller_request_id,
+        stream_handle_out,
+        error_out,
+    )
+}
 
-    // Create tokenizer
-    let tokenizer: Arc<dyn Tokenizer> =
-        match create_tokenizer_from_file(&multi_client.tokenizer_path) {
-            Ok(t) => t,
-            Err(e) => {
-                set_error_message(error_out, &format!("Failed to create tokenizer: {e}"));
-                return SglErrorCode::TokenizationError;
-            }
-        };
+/// Send a chat completion request whose JSON is passed by pointer and length
+///
+/// Like `sgl_multi_client_chat_completion_stream`, but the JSON need not be
+/// NUL-terminated, so callers can pass large requests (long documents,
+/// many-shot prompts) from their own memory without copying them.
+///
+/// # Arguments
+/// * `client_handle` - Multi-worker client handle
+/// * `request_json` - OpenAI ChatCompletionRequest as UTF-8 JSON
+/// * `request_json_len` - Length of `request_json` in bytes
+/// * `caller_request_id` - Optional request ID sent as `x-request-id` gRPC metadata (may be null)
+/// * `stream_handle_out` - Pointer to receive stream handle
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `client_handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `request_json` must be valid for reads of `request_json_len` bytes
+/// - `caller_request_id` must be null or a valid null-terminated C string
+/// - `stream_handle_out` must be a valid pointer to writable memory
+/// - Caller owns the stream handle and must free it with `sgl_stream_free`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream_bytes(
+    client_handle: *mut MultiWorkerClientHandle,
+    request_json: *const u8,
+    request_json_len: usize,
+    caller_request_id: *const c_char,
+    stream_handle_out: *mut *mut SglangStreamHandle,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if client_handle.is_null() || request_json.is_null() || stream_handle_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let request_str = match request_json_from_bytes(request_json, request_json_len) {
+        Ok(s) => s,
+        Err(e) => {
+            set_error_message(error_out, e);
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    chat_completion_stream(
+        &*client_handle,
+        request_str,
+        caller_request_id,
+        stream_handle_out,
+        error_out,
+    )
+}
 
+/// Shared implementation of `sgl_multi_client_chat_completion_stream` and its `_bytes` variant
+unsafe fn chat_completion_stream(
+    multi_client: &MultiWorkerClientHandle,
+    request_str: &str,
+    caller_request_id: *const c_char,
+    stream_handle_out: *mut *mut SglangStreamHandle,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
     // Parse OpenAI ChatCompletionRequest
     let mut chat_request: ChatCompletionRequest = match serde_json::from_str(request_str) {
         Ok(req) => req,
@@ -551,6 +1230,23 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
         }
     };
 
+    // Create tokenizer for the requested model
+    let tokenizer_path = multi_client.tokenizer_path_for(&chat_request.model);
+    if tokenizer_path.is_empty() {
+        set_error_message(
+            error_out,
+            &format!("No tokenizer configured for model '{}'", chat_request.model),
+        );
+        return SglErrorCode::InvalidArgument;
+    }
+    let tokenizer: Arc<dyn Tokenizer> = match create_tokenizer_from_file(tokenizer_path) {
+        Ok(t) => t,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create tokenizer: {e}"));
+            return SglErrorCode::TokenizationError;
+        }
+    };
+
     // Process messages and apply chat template
     let processed_messages = match process_chat_messages(&chat_request, tokenizer.as_ref(), None) {
         Ok(msgs) => msgs,
@@ -580,7 +1276,7 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
         Some(w) => w,
         None => {
             set_error_message(error_out, "No healthy workers available");
-            return SglErrorCode::UnknownError;
+            return SglErrorCode::NoHealthyWorkers;
         }
     };
 
@@ -625,19 +1321,16 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
         chat_request.skip_special_tokens = false;
     }
 
-    // Build GenerateRequest
+    // Build GenerateRequest in the worker's dialect
     let request_id = format!("chatcmpl-{}", Uuid::now_v7());
     let require_reasoning = chat_requires_reasoning(&chat_request, tokenizer.as_ref());
-    let proto_request = match client.build_generate_request_from_chat(
+    let proto_request = match client.build_chat_request(
         request_id.clone(),
         &chat_request,
         processed_messages.text,
         token_ids,
-        SglangGenerateRequestOptions {
-            multimodal_inputs: None, // multimodal not supported in golang bindings
-            tool_call_constraint: tool_constraint,
-            require_reasoning,
-        },
+        tool_constraint,
+        require_reasoning,
     ) {
         Ok(req) => req,
         Err(e) => {
@@ -647,11 +1340,14 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
     };
 
     // Send request and get stream
-    let stream = match RUNTIME.block_on(async { client.generate(proto_request).await }) {
+    let caller_request_id = request_id_from_ptr(caller_request_id);
+    let stream = match RUNTIME.block_on(with_request_id(caller_request_id, async {
+        client.generate(proto_request).await
+    })) {
         Ok(s) => s,
         Err(e) => {
             set_error_message(error_out, &format!("Failed to send request: {e}"));
-            return SglErrorCode::UnknownError;
+            return status_error_code(&e);
         }
     };
 
@@ -751,8 +1447,357 @@ pub unsafe extern "C" fn sgl_multi_client_chat_completion_stream(
         converter: Arc::new(TokioMutex::new(converter_handle)),
         client: Arc::clone(&client),
         prompt_tokens,
+        abort: tokio::sync::watch::Sender::new(false),
+        worker: Some(Arc::clone(&worker)),
+    }));
+
+    SglErrorCode::Success
+}
+
+/// Send a legacy completion request using load-balanced worker selection
+///
+/// The prompt is tokenized as-is (no chat template). The returned stream yields
+/// chat completion chunks, like `sgl_multi_client_chat_completion_stream`; the
+/// Go SDK maps them to completion chunks.
+///
+/// # Arguments
+/// * `client_handle` - Multi-worker client handle
+/// * `request_json` - OpenAI CompletionRequest as JSON string with a single prompt
+/// * `caller_request_id` - Optional request ID sent as `x-request-id` gRPC metadata (may be null)
+/// * `stream_handle_out` - Pointer to receive stream handle
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `client_handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `request_json` must be a valid null-terminated C string containing valid JSON
+/// - `caller_request_id` must be null or a valid null-terminated C string
+/// - `stream_handle_out` must be a valid pointer to writable memory
+/// - Caller owns the stream handle and must free it with `sgl_stream_free`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_completion_stream(
+    client_handle: *mut MultiWorkerClientHandle,
+    request_json: *const c_char,
+    caller_request_id: *const c_char,
+    stream_handle_out: *mut *mut SglangStreamHandle,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if client_handle.is_null() || request_json.is_null() || stream_handle_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let request_str = match CStr::from_ptr(request_json).to_str() {
+        Ok(s) => s,
+        Err(_) => {
+            set_error_message(error_out, "Invalid UTF-8 in request_json");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    completion_stream(
+        &*client_handle,
+        request_str,
+        caller_request_id,
+        stream_handle_out,
+        error_out,
+    )
+}
+
+/// Send a legacy completion request whose JSON is passed by pointer and length
+///
+/// Like `sgl_multi_client_completion_stream`, but the JSON need not be
+/// NUL-terminated, so callers can pass large requests (long documents,
+/// many-shot prompts) from their own memory without copying them.
+///
+/// # Arguments
+/// * `client_handle` - Multi-worker client handle
+/// * `request_json` - OpenAI CompletionRequest as UTF-8 JSON
+/// * `request_json_len` - Length of `request_json` in bytes
+/// * `caller_request_id` - Optional request ID sent as `x-request-id` gRPC metadata (may be null)
+/// * `stream_handle_out` - Pointer to receive stream handle
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `client_handle` must be a valid pointer returned by `sgl_multi_client_create`
+/// - `request_json` must be valid for reads of `request_json_len` bytes
+/// - `caller_request_id` must be null or a valid null-terminated C string
+/// - `stream_handle_out` must be a valid pointer to writable memory
+/// - Caller owns the stream handle and must free it with `sgl_stream_free`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_multi_client_completion_stream_bytes(
+    client_handle: *mut MultiWorkerClientHandle,
+    request_json: *const u8,
+    request_json_len: usize,
+    caller_request_id: *const c_char,
+    stream_handle_out: *mut *mut SglangStreamHandle,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if client_handle.is_null() || request_json.is_null() || stream_handle_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let request_str = match request_json_from_bytes(request_json, request_json_len) {
+        Ok(s) => s,
+        Err(e) => {
+            set_error_message(error_out, e);
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    completion_stream(
+        &*client_handle,
+        request_str,
+        caller_request_id,
+        stream_handle_out,
+        error_out,
+    )
+}
+
+/// Shared implementation of `sgl_multi_client_completion_stream` and its `_bytes` variant
+unsafe fn completion_stream(
+    multi_client: &MultiWorkerClientHandle,
+    request_str: &str,
+    caller_request_id: *const c_char,
+    stream_handle_out: *mut *mut SglangStreamHandle,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    let mut completion_request: CompletionRequest = match serde_json::from_str(request_str) {
+        Ok(req) => req,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to parse request JSON: {e}"));
+            return SglErrorCode::ParsingError;
+        }
+    };
+    // Chunks are always read from a stream; the Go SDK aggregates them for
+    // non-streaming calls.
+    completion_request.stream = true;
+
+    let prompt = match &completion_request.prompt {
+        StringOrArray::String(s) => s.clone(),
+        StringOrArray::Array(arr) if arr.len() == 1 => arr[0].clone(),
+        StringOrArray::Array(_) => {
+            set_error_message(error_out, "Exactly one prompt is supported per request");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    let tokenizer_path = multi_client.tokenizer_path_for(&completion_request.model);
+    if tokenizer_path.is_empty() {
+        set_error_message(
+            error_out,
+            &format!(
+                "No tokenizer configured for model '{}'",
+                completion_request.model
+            ),
+        );
+        return SglErrorCode::InvalidArgument;
+    }
+    let tokenizer: Arc<dyn Tokenizer> = match create_tokenizer_from_file(tokenizer_path) {
+        Ok(t) => t,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create tokenizer: {e}"));
+            return SglErrorCode::TokenizationError;
+        }
+    };
+
+    let token_ids = match tokenizer.encode(&prompt, false) {
+        Ok(encoding) => encoding.token_ids().to_vec(),
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to tokenize: {e}"));
+            return SglErrorCode::TokenizationError;
+        }
+    };
+    let prompt_tokens = token_ids.len() as u32;
+
+    let select_info = SelectWorkerInfo {
+        request_text: Some(&prompt),
+        tokens: Some(&token_ids),
+        ..Default::default()
+    };
+    let worker = match multi_client.select_worker(&select_info) {
+        Some(w) => w,
+        None => {
+            set_error_message(error_out, "No healthy workers available");
+            return SglErrorCode::NoHealthyWorkers;
+        }
+    };
+
+    let client = Arc::clone(&worker.client);
+
+    let request_id = format!("cmpl-{}", Uuid::now_v7());
+    let proto_request = match client.build_completion_request(
+        request_id.clone(),
+        &completion_request,
+        prompt,
+        token_ids,
+    ) {
+        Ok(req) => req,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to build generate request: {e}"));
+            return SglErrorCode::ParsingError;
+        }
+    };
+
+    worker.increment_load();
+
+    let caller_request_id = request_id_from_ptr(caller_request_id);
+    let stream = match RUNTIME.block_on(with_request_id(caller_request_id, async {
+        client.generate(proto_request).await
+    })) {
+        Ok(s) => s,
+        Err(e) => {
+            worker.decrement_load();
+            set_error_message(error_out, &format!("Failed to send request: {e}"));
+            return status_error_code(&e);
+        }
+    };
+
+    let stop_json = completion_request
+        .stop
+        .as_ref()
+        .and_then(|s| serde_json::to_string(s).ok())
+        .and_then(|s| CString::new(s).ok());
+    let stop_token_ids_json = completion_request
+        .stop_token_ids
+        .as_ref()
+        .and_then(|ids| serde_json::to_string(ids).ok())
+        .and_then(|s| CString::new(s).ok());
+
+    let model_cstr = match CString::new(completion_request.model.clone()) {
+        Ok(s) => s,
+        Err(_) => {
+            worker.decrement_load();
+            set_error_message(error_out, "Invalid model name: contains null byte");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+    let request_id_cstr = match CString::new(request_id) {
+        Ok(s) => s,
+        Err(_) => {
+            worker.decrement_load();
+            set_error_message(error_out, "Invalid request ID: contains null byte");
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    // The converter keeps its own reference to the tokenizer
+    let tokenizer_handle = Box::into_raw(Box::new(TokenizerHandle { tokenizer }));
+    let converter = sgl_grpc_response_converter_create(
+        tokenizer_handle,
+        model_cstr.as_ptr(),
+        request_id_cstr.as_ptr(),
+        ptr::null(),
+        ptr::null(),
+        stop_json.as_ref().map_or(ptr::null(), |s| s.as_ptr()),
+        stop_token_ids_json
+            .as_ref()
+            .map_or(ptr::null(), |s| s.as_ptr()),
+        if completion_request.skip_special_tokens {
+            1
+        } else {
+            0
+        },
+        error_out,
+    );
+    let _ = Box::from_raw(tokenizer_handle);
+
+    if converter.is_null() {
+        worker.decrement_load();
+        return SglErrorCode::MemoryError;
+    }
+
+    let mut converter_handle = *Box::from_raw(converter);
+    converter_handle.initial_prompt_tokens = Some(prompt_tokens);
+
+    *stream_handle_out = Box::into_raw(Box::new(SglangStreamHandle {
+        stream: Arc::new(TokioMutex::new(stream)),
+        converter: Arc::new(TokioMutex::new(converter_handle)),
+        client: Arc::clone(&client),
+        prompt_tokens,
+        abort: tokio::sync::watch::Sender::new(false),
         worker: Some(Arc::clone(&worker)),
     }));
 
     SglErrorCode::Success
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A client without workers whose model "m" has a tokenizer path that
+    /// does not exist
+    fn client_without_workers() -> MultiWorkerClientHandle {
+        MultiWorkerClientHandle {
+            pool: RwLock::new(WorkerPool::default()),
+            policy: Arc::new(RoundRobinPolicy::new()),
+            tokenizer_path: String::new(),
+            model_tokenizer_paths: HashMap::from([(
+                "m".to_string(),
+                "/nonexistent/tokenizer".to_string(),
+            )]),
+            injector: RequestIdInjector::default(),
+            dialect: Dialect::Sglang,
+        }
+    }
+
+    /// Call `sgl_multi_client_chat_completion_stream_bytes` with `request`,
+    /// returning its error code and message
+    fn chat_completion_stream_bytes(
+        client: &mut MultiWorkerClientHandle,
+        request: &[u8],
+    ) -> (SglErrorCode, String) {
+        let mut stream: *mut SglangStreamHandle = ptr::null_mut();
+        let mut error: *mut c_char = ptr::null_mut();
+        let code = unsafe {
+            sgl_multi_client_chat_completion_stream_bytes(
+                client,
+                request.as_ptr(),
+                request.len(),
+                ptr::null(),
+                &mut stream,
+                &mut error,
+            )
+        };
+        assert!(stream.is_null());
+        assert!(!error.is_null());
+        let message = unsafe { CString::from_raw(error) }.into_string().unwrap();
+        (code, message)
+    }
+
+    #[test]
+    fn test_chat_completion_stream_bytes() {
+        let mut client = client_without_workers();
+
+        let (code, message) = chat_completion_stream_bytes(&mut client, &[b'{', 0xff, b'}']);
+        assert_eq!(code, SglErrorCode::InvalidArgument);
+        assert!(message.contains("Invalid UTF-8"), "{message}");
+
+        let (code, message) = chat_completion_stream_bytes(&mut client, b"not json");
+        assert_eq!(code, SglErrorCode::ParsingError);
+        assert!(
+            message.contains("Failed to parse request JSON"),
+            "{message}"
+        );
+
+        // Only the given length is read: the request is parsed although it
+        // is neither NUL-terminated nor the whole buffer
+        let buffer = br#"{"model":"other","messages":[{"role":"user","content":"Hi"}]} trailing"#;
+        let request = &buffer[..buffer.len() - " trailing".len()];
+        let (code, message) = chat_completion_stream_bytes(&mut client, request);
+        assert_eq!(code, SglErrorCode::InvalidArgument);
+        assert_eq!(message, "No tokenizer configured for model 'other'");
+
+        let request = br#"{"model":"m","messages":[{"role":"user","content":"Hi"}]}"#;
+        let (code, message) = chat_completion_stream_bytes(&mut client, request);
+        assert_eq!(code, SglErrorCode::TokenizationError);
+        assert!(message.contains("Failed to create tokenizer"), "{message}");
+    }
+}
@@ -21,7 +21,7 @@ use super::{
     error::{set_error_message, SglErrorCode},
     memory::{sgl_free_string, sgl_free_token_ids},
     tokenizer::TokenizerHandle,
-    utils::chat_requires_reasoning,
+    utils::{chat_requires_reasoning, request_json_from_bytes},
 };
 
 /// Result of preprocessing a chat request
@@ -322,6 +322,88 @@ pub unsafe extern "C" fn sgl_preprocess_chat_request_with_tokenizer(
     }
 }
 
+/// Preprocess a chat completion request passed by pointer and length
+///
+/// Like `sgl_preprocess_chat_request_with_tokenizer`, but the JSON need not be
+/// NUL-terminated, so callers can pass large requests (long documents,
+/// many-shot prompts) from their own memory without copying them. The request
+/// is parsed once for both the preprocessing and `require_reasoning`, which
+/// otherwise takes a call to `sgl_chat_requires_reasoning_with_tokenizer`.
+///
+/// # Arguments
+/// * `request_json` - OpenAI ChatCompletionRequest as UTF-8 JSON
+/// * `request_json_len` - Length of `request_json` in bytes
+/// * `require_reasoning_out` - Pointer to receive whether the request should
+///   ask SGLang to count reasoning tokens
+/// * Other arguments as for `sgl_preprocess_chat_request_with_tokenizer`
+///
+/// # Safety
+/// - `request_json` must be valid for reads of `request_json_len` bytes
+/// - `require_reasoning_out` must point to writable memory
+/// - Other pointers as for `sgl_preprocess_chat_request_with_tokenizer`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_preprocess_chat_request_with_tokenizer_bytes(
+    request_json: *const u8,
+    request_json_len: usize,
+    tokenizer_handle: *mut TokenizerHandle,
+    prompt_text_out: *mut *mut c_char,
+    token_ids_out: *mut *mut c_uint,
+    token_ids_len_out: *mut usize,
+    tool_constraints_json_out: *mut *mut c_char,
+    prompt_tokens_out: *mut c_int,
+    require_reasoning_out: *mut c_int,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if request_json.is_null()
+        || tokenizer_handle.is_null()
+        || prompt_text_out.is_null()
+        || token_ids_out.is_null()
+        || token_ids_len_out.is_null()
+        || prompt_tokens_out.is_null()
+        || require_reasoning_out.is_null()
+    {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let request_str = match request_json_from_bytes(request_json, request_json_len) {
+        Ok(s) => s,
+        Err(e) => {
+            set_error_message(error_out, e);
+            return SglErrorCode::InvalidArgument;
+        }
+    };
+
+    let chat_request: ChatCompletionRequest = match serde_json::from_str(request_str) {
+        Ok(req) => req,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to parse request JSON: {e}"));
+            return SglErrorCode::ParsingError;
+        }
+    };
+
+    let tokenizer = (*tokenizer_handle).tokenizer.as_ref();
+
+    match preprocess_impl(&chat_request, tokenizer) {
+        Ok(result) => {
+            write_preprocess_outputs(
+                result,
+                prompt_text_out,
+                token_ids_out,
+                token_ids_len_out,
+                tool_constraints_json_out,
+                prompt_tokens_out,
+            );
+            *require_reasoning_out = i32::from(chat_requires_reasoning(&chat_request, tokenizer));
+            SglErrorCode::Success
+        }
+        Err((code, msg)) => {
+            set_error_message(error_out, &msg);
+            code
+        }
+    }
+}
+
 /// Free a preprocessed request handle (cleanup function)
 ///
 /// This function frees the memory allocated by sgl_preprocess_chat_request.
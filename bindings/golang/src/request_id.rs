@@ -0,0 +1,84 @@
+//! Request ID propagation for FFI calls
+//!
+//! The Go SDK passes the caller's request ID (e.g. an HTTP `X-Request-ID`)
+//! into FFI calls. It is held in a task-local while the gRPC call is made and
+//! injected into the request metadata, so one ID traces a request from the
+//! HTTP layer through to the scheduler. Metadata identifying the client,
+//! such as its name and version, is injected alongside it.
+
+use std::{collections::HashMap, ffi::CStr, future::Future, os::raw::c_char, sync::Arc};
+
+use smg_grpc_client::TraceInjector;
+use tonic::metadata::{AsciiMetadataKey, AsciiMetadataValue, MetadataMap, MetadataValue};
+
+/// gRPC metadata key carrying the request ID
+pub const REQUEST_ID_METADATA_KEY: &str = "x-request-id";
+
+tokio::task_local! {
+    static REQUEST_ID: String;
+}
+
+/// Trace injector that adds the client's metadata and the current task's
+/// request ID to gRPC metadata
+#[derive(Clone, Default)]
+pub struct RequestIdInjector {
+    /// Metadata sent with every request
+    client_metadata: Arc<Vec<(AsciiMetadataKey, AsciiMetadataValue)>>,
+}
+
+impl RequestIdInjector {
+    /// Create an injector that also sends `client_metadata` with every request
+    pub fn with_client_metadata(client_metadata: &HashMap<String, String>) -> Result<Self, String> {
+        let mut entries = Vec::with_capacity(client_metadata.len());
+        for (name, value) in client_metadata {
+            let key = AsciiMetadataKey::from_bytes(name.as_bytes())
+                .map_err(|e| format!("Invalid metadata key '{name}': {e}"))?;
+            let value = AsciiMetadataValue::try_from(value.as_str())
+                .map_err(|e| format!("Invalid metadata value for '{name}': {e}"))?;
+            entries.push((key, value));
+        }
+        Ok(Self {
+            client_metadata: Arc::new(entries),
+        })
+    }
+}
+
+impl TraceInjector for RequestIdInjector {
+    fn inject(
+        &self,
+        metadata: &mut MetadataMap,
+    ) -> Result<(), Box<dyn std::error::Error + Send + Sync>> {
+        for (key, value) in self.client_metadata.iter() {
+            metadata.insert(key.clone(), value.clone());
+        }
+        let Ok(request_id) = REQUEST_ID.try_with(Clone::clone) else {
+            return Ok(());
+        };
+        metadata.insert(REQUEST_ID_METADATA_KEY, MetadataValue::try_from(request_id)?);
+        Ok(())
+    }
+}
+
+/// Run `fut` with `request_id` as the request ID of the gRPC calls it makes
+pub async fn with_request_id<F: Future>(request_id: Option<String>, fut: F) -> F::Output {
+    match request_id {
+        Some(id) => REQUEST_ID.scope(id, fut).await,
+        None => fut.await,
+    }
+}
+
+/// Read an optional request ID argument. Null, empty, and non-UTF-8 values
+/// are treated as absent.
+///
+/// # Safety
+/// - `request_id` must be null or a valid null-terminated C string
+pub unsafe fn request_id_from_ptr(request_id: *const c_char) -> Option<String> {
+    if request_id.is_null() {
+        return None;
+    }
+    CStr::from_ptr(request_id)
+        .to_str()
+        .ok()
+        .filter(|s| !s.is_empty())
+        .map(str::to_owned)
+}
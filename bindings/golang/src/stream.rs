@@ -7,14 +7,11 @@ use std::{
     sync::Arc,
 };
 
-use futures_util::StreamExt;
 use smg::worker::Worker;
-use smg_grpc_client::{
-    sglang_proto as proto,
-    sglang_scheduler::{AbortOnDropStream, SglangSchedulerClient},
-};
+use smg_grpc_client::sglang_proto as proto;
 
 use super::{
+    dialect::{status_error_code, BackendClient, BackendStream},
     error::{set_error_message, SglErrorCode},
     grpc_converter::{convert_proto_chunk_to_openai, GrpcResponseConverterHandle},
     policy::GrpcWorker,
@@ -28,17 +25,23 @@ use super::{
 ///
 /// # Fields
 ///
-/// * `stream` - The gRPC stream wrapped in AbortOnDropStream for automatic cleanup
+/// * `stream` - The gRPC stream in the worker's dialect, which aborts the request when
+///   dropped before completing
 /// * `converter` - Response converter that transforms proto messages to OpenAI format
 /// * `client` - The underlying gRPC client connection
 /// * `prompt_tokens` - Number of prompt tokens from the original request
+/// * `abort` - Set by `sgl_stream_abort` to end a read in progress
 pub struct SglangStreamHandle {
-    pub(crate) stream: Arc<tokio::sync::Mutex<AbortOnDropStream>>,
+    pub(crate) stream: Arc<tokio::sync::Mutex<BackendStream>>,
     pub(crate) converter: Arc<tokio::sync::Mutex<GrpcResponseConverterHandle>>,
     #[expect(dead_code)]
-    pub(crate) client: Arc<SglangSchedulerClient>,
+    pub(crate) client: Arc<BackendClient>,
     #[expect(dead_code)]
     pub(crate) prompt_tokens: u32, // Number of prompt tokens for this request
+    /// Set to true by `sgl_stream_abort`. It is a watch channel rather than a
+    /// flag so that a read waiting on the stream lock or the next chunk
+    /// wakes up.
+    pub(crate) abort: tokio::sync::watch::Sender<bool>,
     /// Worker that owns this stream (for load tracking). None for single-client streams.
     pub(crate) worker: Option<Arc<GrpcWorker>>,
 }
@@ -93,12 +96,24 @@ pub unsafe extern "C" fn sgl_stream_read_next(
     let handle_ref = &*stream_handle;
     let stream = Arc::clone(&handle_ref.stream);
     let converter = Arc::clone(&handle_ref.converter);
+    let mut abort = handle_ref.abort.subscribe();
 
-    // Read next chunk from stream
+    // Read next chunk from stream, unless the stream is aborted first
     let chunk_result = RUNTIME.block_on(async {
-        let mut stream_guard = stream.lock().await;
-        stream_guard.next().await
+        tokio::select! {
+            chunk = async {
+                let mut stream_guard = stream.lock().await;
+                stream_guard.next().await
+            } => Some(chunk),
+            _ = abort.wait_for(|aborted| *aborted) => None,
+        }
     });
+    let Some(chunk_result) = chunk_result else {
+        set_error_message(error_out, "Stream aborted");
+        *response_json_out = ptr::null_mut();
+        *is_done_out = 1;
+        return SglErrorCode::UnknownError;
+    };
 
     match chunk_result {
         Some(Ok(proto_response)) => {
@@ -185,7 +200,7 @@ pub unsafe extern "C" fn sgl_stream_read_next(
 
             set_error_message(error_out, &format!("Stream error: {e}"));
             *is_done_out = 1;
-            SglErrorCode::UnknownError
+            status_error_code(&e)
         }
         None => {
             // Stream ended naturally - mark as completed to prevent abort
@@ -200,6 +215,59 @@ pub unsafe extern "C" fn sgl_stream_read_next(
     }
 }
 
+/// Get the endpoint of the worker serving a stream
+///
+/// # Arguments
+///
+/// * `handle` - Stream handle
+///
+/// # Returns
+///
+/// The worker endpoint, or null for single-client streams, which have no
+/// worker, and null handles
+///
+/// # Safety
+///
+/// - `handle` must be null or a valid pointer to a live `SglangStreamHandle`
+/// - A non-null result must be freed with `sgl_free_string`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_stream_worker_endpoint(
+    handle: *mut SglangStreamHandle,
+) -> *mut c_char {
+    if handle.is_null() {
+        return ptr::null_mut();
+    }
+    match &(*handle).worker {
+        Some(worker) => {
+            CString::new(worker.endpoint.as_str()).map_or(ptr::null_mut(), CString::into_raw)
+        }
+        None => ptr::null_mut(),
+    }
+}
+
+/// Abort a stream, ending any read in progress.
+///
+/// A read waiting for the next chunk returns an error, as does every later
+/// read. The handle stays valid and must still be freed with
+/// `sgl_stream_free`, which then lets the stream send an abort to the
+/// server unless it already completed.
+///
+/// # Arguments
+///
+/// * `handle` - Stream handle
+///   - If NULL, this function does nothing
+///
+/// # Safety
+///
+/// - `handle` must be null or a valid pointer to a live `SglangStreamHandle`
+/// - Unlike `sgl_stream_free`, it may be called while a read is in progress
+#[no_mangle]
+pub unsafe extern "C" fn sgl_stream_abort(handle: *mut SglangStreamHandle) {
+    if !handle.is_null() {
+        (*handle).abort.send_replace(true);
+    }
+}
+
 /// Free a stream handle and release all associated resources.
 ///
 /// This function must be called exactly once for each stream handle returned by
@@ -214,13 +282,16 @@ pub unsafe extern "C" fn sgl_stream_read_next(
 /// # Safety
 ///
 /// - Must be called only once per handle
+/// - Must not be called while a read is in progress; abort the stream with
+///   `sgl_stream_abort` to end the read first
 /// - Handle must not be used after calling this function
 /// - After this call, the stream is no longer valid
 ///
 /// # Notes
 ///
-/// - This function calls `mark_completed()` before freeing to ensure
-///   the stream cleanup doesn't trigger an abort RPC to the server
+/// - Unless the stream was aborted, this function calls `mark_completed()`
+///   before freeing to ensure the stream cleanup doesn't trigger an abort
+///   RPC to the server
 #[no_mangle]
 pub unsafe extern "C" fn sgl_stream_free(handle: *mut SglangStreamHandle) {
     if !handle.is_null() {
@@ -232,6 +303,14 @@ pub unsafe extern "C" fn sgl_stream_free(handle: *mut SglangStreamHandle) {
             worker.increment_processed();
         }
 
+        // An aborted stream that did not complete sends an abort to the
+        // server when dropped, which spawns onto the runtime
+        if *handle_ref.abort.borrow() {
+            let _guard = RUNTIME.enter();
+            drop(handle_ref);
+            return;
+        }
+
         // Mark stream as completed to prevent abort on drop
         // (should already be marked by ReadNext, but ensure it for safety)
         RUNTIME.block_on(async {
@@ -10,7 +10,7 @@ use std::{
 use llm_tokenizer::{
     chat_template::ChatTemplateParams, create_tokenizer, traits::Tokenizer as TokenizerTrait,
 };
-use serde_json::Value;
+use serde_json::{json, Value};
 
 use super::error::{clear_error_message, set_error_message, SglErrorCode};
 
@@ -375,6 +375,150 @@ pub unsafe extern "C" fn sgl_tokenizer_decode(
     }
 }
 
+/// Describe the tokenizer's special tokens as a JSON object
+///
+/// The object contains `bos`, `eos`, `unk`, `sep`, `pad`, `cls`, and `mask`
+/// entries (each `{"token": ..., "id": ...}` or null), an
+/// `additional_special_tokens` array of the same shape (chat-control tokens
+/// such as `<|im_start|>` live here), `eos_token_ids` merged from the model's
+/// generation config, and `vocab_size`. An `id` is null when the token string
+/// is not in the vocabulary.
+///
+/// # Arguments
+/// * `handle` - Tokenizer handle
+/// * `result_out` - Pointer to receive JSON string (must be freed with sgl_free_string)
+/// * `error_out` - Optional pointer to receive error message
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_tokenizer_create_from_file`
+/// - `result_out` must be a valid pointer to writable memory
+/// - `error_out` may be null; if non-null, must point to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_tokenizer_special_tokens(
+    handle: *mut TokenizerHandle,
+    result_out: *mut *mut c_char,
+    error_out: *mut *mut c_char,
+) -> SglErrorCode {
+    if handle.is_null() || result_out.is_null() {
+        set_error_message(error_out, "Invalid arguments: null pointer");
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let tokenizer = (*handle).tokenizer.as_ref();
+    let special = tokenizer.get_special_tokens();
+    let describe = |token: &Option<String>| -> Value {
+        match token {
+            Some(t) => json!({ "token": t, "id": tokenizer.token_to_id(t) }),
+            None => Value::Null,
+        }
+    };
+
+    let additional: Vec<Value> = special
+        .additional_special_tokens
+        .iter()
+        .map(|t| json!({ "token": t, "id": tokenizer.token_to_id(t) }))
+        .collect();
+
+    let result_json = json!({
+        "bos": describe(&special.bos_token),
+        "eos": describe(&special.eos_token),
+        "unk": describe(&special.unk_token),
+        "sep": describe(&special.sep_token),
+        "pad": describe(&special.pad_token),
+        "cls": describe(&special.cls_token),
+        "mask": describe(&special.mask_token),
+        "additional_special_tokens": additional,
+        "eos_token_ids": tokenizer.eos_token_ids(),
+        "vocab_size": tokenizer.vocab_size(),
+    });
+
+    let result_cstr = match CString::new(result_json.to_string()) {
+        Ok(s) => s,
+        Err(e) => {
+            set_error_message(error_out, &format!("Failed to create result string: {e}"));
+            return SglErrorCode::MemoryError;
+        }
+    };
+    *result_out = result_cstr.into_raw();
+    clear_error_message(error_out);
+    SglErrorCode::Success
+}
+
+/// Look up the ID of a single token string
+///
+/// # Arguments
+/// * `handle` - Tokenizer handle
+/// * `token` - Token string (null-terminated C string)
+/// * `id_out` - Pointer to receive the token ID
+/// * `found_out` - Pointer set to 1 if the token is in the vocabulary, 0 otherwise
+///
+/// # Returns
+/// * SglErrorCode::Success on success, error code on failure
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_tokenizer_create_from_file`
+/// - `token` must be a valid null-terminated C string
+/// - `id_out` and `found_out` must be valid pointers to writable memory
+#[no_mangle]
+pub unsafe extern "C" fn sgl_tokenizer_token_to_id(
+    handle: *mut TokenizerHandle,
+    token: *const c_char,
+    id_out: *mut u32,
+    found_out: *mut c_int,
+) -> SglErrorCode {
+    if handle.is_null() || token.is_null() || id_out.is_null() || found_out.is_null() {
+        return SglErrorCode::InvalidArgument;
+    }
+
+    let token_str = match CStr::from_ptr(token).to_str() {
+        Ok(s) => s,
+        Err(_) => return SglErrorCode::InvalidArgument,
+    };
+
+    match (*handle).tokenizer.token_to_id(token_str) {
+        Some(id) => {
+            *id_out = id;
+            *found_out = 1;
+        }
+        None => {
+            *id_out = 0;
+            *found_out = 0;
+        }
+    }
+    SglErrorCode::Success
+}
+
+/// Look up the token string for a single token ID
+///
+/// # Arguments
+/// * `handle` - Tokenizer handle
+/// * `id` - Token ID
+///
+/// # Returns
+/// * Token string (must be freed with sgl_free_string), or null if the ID is not in the vocabulary
+///
+/// # Safety
+/// - `handle` must be a valid pointer returned by `sgl_tokenizer_create_from_file`
+#[no_mangle]
+pub unsafe extern "C" fn sgl_tokenizer_id_to_token(
+    handle: *mut TokenizerHandle,
+    id: u32,
+) -> *mut c_char {
+    if handle.is_null() {
+        return ptr::null_mut();
+    }
+    match (*handle).tokenizer.id_to_token(id) {
+        Some(token) => match CString::new(token) {
+            Ok(s) => s.into_raw(),
+            Err(_) => ptr::null_mut(),
+        },
+        None => ptr::null_mut(),
+    }
+}
+
 /// Free a tokenizer handle
 ///
 /// # Safety
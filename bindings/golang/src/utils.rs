@@ -40,3 +40,33 @@ pub(crate) fn chat_requires_reasoning(
         tokenizer,
     )
 }
+
+/// Borrow request JSON passed by pointer and length, without copying it
+///
+/// The `_bytes` variants of the request functions take their JSON this way,
+/// which spares the caller a NUL-terminated copy of very large requests.
+///
+/// # Safety
+/// `data` must be valid for reads of `len` bytes for the lifetime `'a`
+pub(crate) unsafe fn request_json_from_bytes<'a>(
+    data: *const u8,
+    len: usize,
+) -> Result<&'a str, &'static str> {
+    std::str::from_utf8(std::slice::from_raw_parts(data, len))
+        .map_err(|_| "Invalid UTF-8 in request_json")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_request_json_from_bytes() {
+        let json = br#"{"model":"m","messages":[]}"#;
+        let request = unsafe { request_json_from_bytes(json.as_ptr(), json.len()) };
+        assert_eq!(request, Ok(r#"{"model":"m","messages":[]}"#));
+
+        let invalid = [b'{', 0xff, b'}'];
+        assert!(unsafe { request_json_from_bytes(invalid.as_ptr(), invalid.len()) }.is_err());
+    }
+}
@@ -0,0 +1,336 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides stored completions for offline evaluation and replay.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrCompletionNotFound is matched, with errors.Is, by the error returned
+// when no completion is stored under an ID.
+var ErrCompletionNotFound = errors.New("stored completion not found")
+
+// DefaultStoredCompletionsLimit is the number of completions
+// ListStoredCompletions returns when ListStoredCompletionsOptions.Limit is
+// not set.
+const DefaultStoredCompletionsLimit = 20
+
+// StoredCompletion is a chat completion request and its response, persisted
+// by WithStore.
+type StoredCompletion struct {
+	// ID is the ID of the response
+	ID        string            `json:"id"`
+	Model     string            `json:"model"`
+	CreatedAt time.Time         `json:"created_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Request is the request as sent; Stream is set if it was streamed
+	Request  ChatCompletionRequest  `json:"request"`
+	Response ChatCompletionResponse `json:"response"`
+}
+
+// ListStoredCompletionsOptions filters and pages ListStoredCompletions.
+type ListStoredCompletionsOptions struct {
+	// Model, if set, returns only completions of the model
+	Model string
+	// Metadata, if set, returns only completions tagged with all of its
+	// keys and values
+	Metadata map[string]string
+	// After is the ID of the last completion of the previous page
+	After string
+	// Limit is the maximum number of completions returned. Defaults to
+	// DefaultStoredCompletionsLimit.
+	Limit int
+}
+
+// CompletionStore persists stored completions. FileCompletionStore and
+// SQLiteCompletionStore are provided; implementations must be safe for
+// concurrent use.
+type CompletionStore interface {
+	// SaveCompletion stores c, replacing any completion with its ID
+	SaveCompletion(ctx context.Context, c *StoredCompletion) error
+	// GetStoredCompletion returns the completion stored under id, or an
+	// error matching ErrCompletionNotFound
+	GetStoredCompletion(ctx context.Context, id string) (*StoredCompletion, error)
+	// ListStoredCompletions returns the matching completions, oldest first
+	ListStoredCompletions(ctx context.Context, opts ListStoredCompletionsOptions) ([]*StoredCompletion, error)
+	// DeleteStoredCompletion removes the completion stored under id, or
+	// returns an error matching ErrCompletionNotFound
+	DeleteStoredCompletion(ctx context.Context, id string) error
+}
+
+// StoreOptions controls WithStore.
+type StoreOptions struct {
+	// OnError, if set, is called with the ID of each completion that cannot
+	// be stored. Defaults to logging with the log package.
+	OnError func(id string, err error)
+}
+
+// WithStore returns a middleware that persists requests with Store set, and
+// their responses, in store. Streams are stored when they are read to the
+// end, aggregated as CreateChatCompletion would return them. A failure to
+// store is reported to opts.OnError and does not fail the request.
+func WithStore(store CompletionStore, opts StoreOptions) ChatMiddleware {
+	return func(next ChatClient) ChatClient {
+		return &storingClient{next: next, store: store, opts: opts}
+	}
+}
+
+type storingClient struct {
+	next  ChatClient
+	store CompletionStore
+	opts  StoreOptions
+}
+
+func (c *storingClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	resp, err := c.next.CreateChatCompletion(ctx, req)
+	if err != nil || !req.Store {
+		return resp, err
+	}
+	c.save(ctx, req, resp)
+	return resp, nil
+}
+
+func (c *storingClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil || !req.Store {
+		return stream, err
+	}
+	return &storingStream{ChatStream: stream, ctx: ctx, req: req, client: c}, nil
+}
+
+// save stores req and resp, even if ctx has been cancelled since
+func (c *storingClient) save(ctx context.Context, req ChatCompletionRequest, resp *ChatCompletionResponse) {
+	stored := &StoredCompletion{
+		ID:        resp.ID,
+		Model:     resp.Model,
+		CreatedAt: time.Now().UTC(),
+		Metadata:  req.Metadata,
+		Request:   req,
+		Response:  *resp,
+	}
+	if stored.ID == "" {
+		stored.ID = "chatcmpl-" + randomID()
+		stored.Response.ID = stored.ID
+	}
+	if stored.Model == "" {
+		stored.Model = req.Model
+	}
+	err := c.store.SaveCompletion(context.WithoutCancel(ctx), stored)
+	if err == nil {
+		return
+	}
+	if c.opts.OnError != nil {
+		c.opts.OnError(stored.ID, err)
+	} else {
+		log.Printf("smg: storing completion %s: %v", stored.ID, err)
+	}
+}
+
+// storingStream records the chunks of a stream and stores the aggregated
+// response when the stream ends
+type storingStream struct {
+	ChatStream
+	ctx    context.Context
+	req    ChatCompletionRequest
+	client *storingClient
+	chunks []string
+	done   bool
+}
+
+func (s *storingStream) RecvJSON() (string, error) {
+	chunk, err := s.ChatStream.RecvJSON()
+	if err == nil {
+		s.chunks = append(s.chunks, chunk)
+		return chunk, nil
+	}
+	if err == io.EOF && !s.done {
+		s.done = true
+		if resp, collectErr := collectChatCompletion(&replayStream{chunks: s.chunks}); collectErr == nil {
+			s.client.save(s.ctx, s.req, resp)
+		}
+		s.chunks = nil
+	}
+	return chunk, err
+}
+
+// replayStream returns recorded chunks
+type replayStream struct {
+	chunks []string
+}
+
+func (s *replayStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *replayStream) Close() error { return nil }
+
+// matchesStoredCompletion reports whether c passes the filters of opts
+func matchesStoredCompletion(c *StoredCompletion, opts ListStoredCompletionsOptions) bool {
+	if opts.Model != "" && c.Model != opts.Model {
+		return false
+	}
+	for key, value := range opts.Metadata {
+		if v, ok := c.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// storedBefore orders completions oldest first, by ID when created together
+func storedBefore(a, b *StoredCompletion) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// FileCompletionStore is a CompletionStore keeping each completion in a JSON
+// file named after its ID in a directory. Listing reads every file, so it
+// suits evaluation sets rather than production traffic.
+type FileCompletionStore struct {
+	dir string
+}
+
+// NewFileCompletionStore creates a store in dir, creating the directory if
+// needed.
+func NewFileCompletionStore(dir string) (*FileCompletionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create completion store: %w", err)
+	}
+	return &FileCompletionStore{dir: dir}, nil
+}
+
+// path returns the file of the completion with id
+func (s *FileCompletionStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid completion ID %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// SaveCompletion writes c to its file, replacing it atomically.
+func (s *FileCompletionStore) SaveCompletion(ctx context.Context, c *StoredCompletion) error {
+	path, err := s.path(c.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// GetStoredCompletion reads the completion stored under id.
+func (s *FileCompletionStore) GetStoredCompletion(ctx context.Context, id string) (*StoredCompletion, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return readStoredCompletion(path)
+}
+
+func readStoredCompletion(path string) (*StoredCompletion, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCompletionNotFound, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c StoredCompletion
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// ListStoredCompletions reads the completions in the directory and returns
+// the matching ones, oldest first.
+func (s *FileCompletionStore) ListStoredCompletions(ctx context.Context, opts ListStoredCompletionsOptions) ([]*StoredCompletion, error) {
+	var after *StoredCompletion
+	if opts.After != "" {
+		var err error
+		if after, err = s.GetStoredCompletion(ctx, opts.After); err != nil {
+			return nil, err
+		}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultStoredCompletionsLimit
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var matched []*StoredCompletion
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c, err := readStoredCompletion(filepath.Join(s.dir, name))
+		if errors.Is(err, ErrCompletionNotFound) {
+			// Deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if matchesStoredCompletion(c, opts) && (after == nil || storedBefore(after, c)) {
+			matched = append(matched, c)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return storedBefore(matched[i], matched[j]) })
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+// DeleteStoredCompletion removes the file of the completion stored under id.
+func (s *FileCompletionStore) DeleteStoredCompletion(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrCompletionNotFound, id)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
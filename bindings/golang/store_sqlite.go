@@ -0,0 +1,149 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides a SQLite store for stored completions.
+package smg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SQLiteCompletionStore is a CompletionStore in a table of a SQLite
+// database. The SDK does not depend on a SQLite driver; open the database
+// with one, such as modernc.org/sqlite or github.com/mattn/go-sqlite3:
+//
+//	db, err := sql.Open("sqlite", "completions.db")
+//	...
+//	store, err := smg.NewSQLiteCompletionStore(ctx, db)
+type SQLiteCompletionStore struct {
+	db *sql.DB
+}
+
+// sqliteCompletionsSchema creates the table of a SQLiteCompletionStore.
+// created_at is in Unix nanoseconds.
+const sqliteCompletionsSchema = `
+CREATE TABLE IF NOT EXISTS smg_stored_completions (
+	id TEXT PRIMARY KEY,
+	model TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	data TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS smg_stored_completions_created
+	ON smg_stored_completions (created_at, id);
+`
+
+// NewSQLiteCompletionStore creates a store in db, creating its table,
+// smg_stored_completions, if needed.
+func NewSQLiteCompletionStore(ctx context.Context, db *sql.DB) (*SQLiteCompletionStore, error) {
+	for _, stmt := range strings.Split(sqliteCompletionsSchema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to create completion store: %w", err)
+		}
+	}
+	return &SQLiteCompletionStore{db: db}, nil
+}
+
+// SaveCompletion inserts c, replacing any row with its ID.
+func (s *SQLiteCompletionStore) SaveCompletion(ctx context.Context, c *StoredCompletion) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO smg_stored_completions (id, model, created_at, data) VALUES (?, ?, ?, ?)`,
+		c.ID, c.Model, c.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+// GetStoredCompletion returns the completion stored under id.
+func (s *SQLiteCompletionStore) GetStoredCompletion(ctx context.Context, id string) (*StoredCompletion, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM smg_stored_completions WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrCompletionNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeStoredCompletion(data)
+}
+
+// ListStoredCompletions queries the matching completions, oldest first.
+// The model is matched in SQL and metadata as rows are read.
+func (s *SQLiteCompletionStore) ListStoredCompletions(ctx context.Context, opts ListStoredCompletionsOptions) ([]*StoredCompletion, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultStoredCompletionsLimit
+	}
+	query := `SELECT data FROM smg_stored_completions`
+	var where []string
+	var args []interface{}
+	if opts.Model != "" {
+		where = append(where, `model = ?`)
+		args = append(args, opts.Model)
+	}
+	if opts.After != "" {
+		after, err := s.GetStoredCompletion(ctx, opts.After)
+		if err != nil {
+			return nil, err
+		}
+		created := after.CreatedAt.UnixNano()
+		where = append(where, `(created_at > ? OR (created_at = ? AND id > ?))`)
+		args = append(args, created, created, after.ID)
+	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY created_at, id`
+	if len(opts.Metadata) == 0 {
+		query += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var matched []*StoredCompletion
+	for len(matched) < limit && rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		c, err := decodeStoredCompletion(data)
+		if err != nil {
+			return nil, err
+		}
+		if matchesStoredCompletion(c, opts) {
+			matched = append(matched, c)
+		}
+	}
+	return matched, rows.Err()
+}
+
+// DeleteStoredCompletion deletes the row of the completion stored under id.
+func (s *SQLiteCompletionStore) DeleteStoredCompletion(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM smg_stored_completions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrCompletionNotFound, id)
+	}
+	return nil
+}
+
+func decodeStoredCompletion(data string) (*StoredCompletion, error) {
+	var c StoredCompletion
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, fmt.Errorf("failed to parse stored completion: %w", err)
+	}
+	return &c, nil
+}
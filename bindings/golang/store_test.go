@@ -0,0 +1,146 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestWithStore tests storing completions and streams that ask to be stored
+func TestWithStore(t *testing.T) {
+	store, err := NewFileCompletionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{ID: "chatcmpl-1", Model: "m", Choices: []Choice{{Message: Message{Role: "assistant", Content: "hi"}, FinishReason: FinishReasonStop}}}, nil
+	})
+	client := WithStore(store, StoreOptions{})(inner)
+
+	if _, err := client.CreateChatCompletion(ctx, ChatCompletionRequest{Model: "m", Messages: []ChatMessage{UserText("hello")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetStoredCompletion(ctx, "chatcmpl-1"); !errors.Is(err, ErrCompletionNotFound) {
+		t.Errorf("GetStoredCompletion() of an unstored request = %v, want ErrCompletionNotFound", err)
+	}
+
+	req := ChatCompletionRequest{Model: "m", Messages: []ChatMessage{UserText("hello")}, Store: true, Metadata: map[string]string{"eval": "greeting"}}
+	if _, err := client.CreateChatCompletion(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetStoredCompletion(ctx, "chatcmpl-1")
+	if err != nil || got.Model != "m" || got.Metadata["eval"] != "greeting" || got.Response.Choices[0].Message.Content != "hi" || got.Request.Messages[0].Content != "hello" {
+		t.Errorf("GetStoredCompletion() = %+v, %v", got, err)
+	}
+
+	streaming := WithStore(store, StoreOptions{})(&streamClient{stream: &fakeChatStream{chunks: []string{
+		`{"id":"chatcmpl-2","model":"m","choices":[{"index":0,"delta":{"content":"he"}}]}`,
+		`{"id":"chatcmpl-2","model":"m","choices":[{"index":0,"delta":{"content":"llo"},"finish_reason":"length"}]}`,
+	}}})
+	req.Stream = true
+	stream, err := streaming.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.RecvJSON(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = store.GetStoredCompletion(ctx, "chatcmpl-2")
+	if err != nil || got.Response.Choices[0].Message.Content != "hello" || got.Response.Choices[0].FinishReason != FinishReasonLength || !got.Request.Stream {
+		t.Errorf("GetStoredCompletion() of a stream = %+v, %v", got, err)
+	}
+}
+
+// failingCompletionStore fails to save completions
+type failingCompletionStore struct {
+	CompletionStore
+}
+
+func (failingCompletionStore) SaveCompletion(context.Context, *StoredCompletion) error {
+	return errors.New("disk full")
+}
+
+// TestWithStoreOnError tests that failures to store are reported and do not
+// fail the request
+func TestWithStoreOnError(t *testing.T) {
+	inner := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{ID: "chatcmpl-1", Model: "m"}, nil
+	})
+	var failed []string
+	client := WithStore(failingCompletionStore{}, StoreOptions{
+		OnError: func(id string, err error) { failed = append(failed, id+": "+err.Error()) },
+	})(inner)
+
+	resp, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{Model: "m", Store: true})
+	if err != nil || resp.ID != "chatcmpl-1" {
+		t.Fatalf("CreateChatCompletion() = %+v, %v", resp, err)
+	}
+	if !reflect.DeepEqual(failed, []string{"chatcmpl-1: disk full"}) {
+		t.Errorf("OnError calls = %q", failed)
+	}
+}
+
+// TestFileCompletionStore tests listing, paging, and deleting completions
+func TestFileCompletionStore(t *testing.T) {
+	store, err := NewFileCompletionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range []StoredCompletion{
+		{ID: "c", Model: "a", Metadata: map[string]string{"eval": "x"}},
+		{ID: "a", Model: "a"},
+		{ID: "b", Model: "b", Metadata: map[string]string{"eval": "x"}},
+		{ID: "d", Model: "a", Metadata: map[string]string{"eval": "x"}},
+	} {
+		c.CreatedAt = start.Add(time.Duration(i) * time.Second)
+		if err := store.SaveCompletion(ctx, &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(opts ListStoredCompletionsOptions) []string {
+		list, err := store.ListStoredCompletions(ctx, opts)
+		if err != nil {
+			t.Fatalf("ListStoredCompletions(%+v) error: %v", opts, err)
+		}
+		var out []string
+		for _, c := range list {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		opts ListStoredCompletionsOptions
+		want []string
+	}{
+		{ListStoredCompletionsOptions{}, []string{"c", "a", "b", "d"}},
+		{ListStoredCompletionsOptions{Model: "a"}, []string{"c", "a", "d"}},
+		{ListStoredCompletionsOptions{Metadata: map[string]string{"eval": "x"}}, []string{"c", "b", "d"}},
+		{ListStoredCompletionsOptions{Limit: 2}, []string{"c", "a"}},
+		{ListStoredCompletionsOptions{After: "a", Limit: 1}, []string{"b"}},
+	} {
+		if got := ids(tt.opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListStoredCompletions(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+
+	if err := store.DeleteStoredCompletion(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteStoredCompletion(ctx, "a"); !errors.Is(err, ErrCompletionNotFound) {
+		t.Errorf("DeleteStoredCompletion() twice = %v, want ErrCompletionNotFound", err)
+	}
+	if _, err := store.GetStoredCompletion(ctx, "../a"); err == nil {
+		t.Error("GetStoredCompletion() accepted a path")
+	}
+}
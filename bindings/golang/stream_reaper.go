@@ -0,0 +1,189 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file closes streams that their callers abandoned.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrStreamIdle is matched, with errors.Is, by the error RecvJSON returns
+// once a stream has been closed for going idle longer than the client's
+// StreamIdleTimeout.
+var ErrStreamIdle = errors.New("stream closed while idle")
+
+// streamReaper tracks the open streams of a client and closes those idle for
+// longer than timeout: streams whose caller neither read to the end nor
+// closed them, and streams whose read waits on a backend that stopped
+// responding. Closing releases the worker request and FFI handle. A nil
+// reaper tracks nothing.
+type streamReaper struct {
+	timeout time.Duration
+	onIdle  func(requestID string, idle time.Duration)
+	now     func() time.Time
+
+	mu      sync.Mutex
+	streams map[*reapedStream]struct{}
+	stop    chan struct{}
+	stopped bool
+}
+
+// newStreamReaper starts the reaper for timeout, or returns nil if timeout
+// is not positive. onIdle is called for each stream closed; if nil, they
+// are logged.
+func newStreamReaper(timeout time.Duration, onIdle func(requestID string, idle time.Duration)) *streamReaper {
+	if timeout <= 0 {
+		return nil
+	}
+	if onIdle == nil {
+		onIdle = func(requestID string, idle time.Duration) {
+			if requestID == "" {
+				requestID = "without id"
+			}
+			log.Printf("smg: closed stream for request %s, idle for %s", requestID, idle)
+		}
+	}
+	r := &streamReaper{
+		timeout: timeout,
+		onIdle:  onIdle,
+		now:     time.Now,
+		streams: make(map[*reapedStream]struct{}),
+		stop:    make(chan struct{}),
+	}
+	go r.run(timeout / 4)
+	return r
+}
+
+// track returns stream closed by the reaper once idle
+func (r *streamReaper) track(ctx context.Context, stream ChatStream) ChatStream {
+	if r == nil {
+		return stream
+	}
+	s := &reapedStream{ChatStream: stream, reaper: r, requestID: RequestIDFromContext(ctx), last: r.now()}
+	r.mu.Lock()
+	r.streams[s] = struct{}{}
+	r.mu.Unlock()
+	return s
+}
+
+// close stops the reaper; the streams still open are left to their callers
+func (r *streamReaper) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+}
+
+func (r *streamReaper) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
+}
+
+// sweep closes the streams idle for longer than the timeout. A stream
+// with a read in progress is closed under the read, which then returns.
+func (r *streamReaper) sweep() {
+	now := r.now()
+	r.mu.Lock()
+	idle := make(map[*reapedStream]time.Duration)
+	for s := range r.streams {
+		if d, ok := s.reap(now); ok {
+			delete(r.streams, s)
+			idle[s] = d
+		}
+	}
+	r.mu.Unlock()
+
+	for s, d := range idle {
+		r.onIdle(s.requestID, d)
+		s.ChatStream.Close()
+	}
+}
+
+func (r *streamReaper) untrack(s *reapedStream) {
+	r.mu.Lock()
+	delete(r.streams, s)
+	r.mu.Unlock()
+}
+
+// reapedStream records the last activity of the embedded stream: a read
+// starting or returning. A stream is idle both when its caller stops
+// reading and when a read waits on the backend.
+type reapedStream struct {
+	ChatStream
+	reaper    *streamReaper
+	requestID string
+
+	mu   sync.Mutex
+	last time.Time
+	// closed is set by Close or once the stream is reaped
+	closed bool
+	reaped bool
+}
+
+func (s *reapedStream) RecvJSON() (string, error) {
+	if err := s.touch(); err != nil {
+		return "", err
+	}
+	chunk, err := s.ChatStream.RecvJSON()
+	if touchErr := s.touch(); touchErr != nil {
+		// Reaped under the read, which failed as the stream was closed
+		return "", touchErr
+	}
+	return chunk, err
+}
+
+// touch records activity, or returns ErrStreamIdle once the stream is reaped
+func (s *reapedStream) touch() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reaped {
+		return fmt.Errorf("%w: idle for over %s", ErrStreamIdle, s.reaper.timeout)
+	}
+	s.last = s.reaper.now()
+	return nil
+}
+
+// reap marks the stream reaped, returning how long it was idle, if it was
+// idle at now
+func (s *reapedStream) reap(now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idle := now.Sub(s.last)
+	if s.closed || idle <= s.reaper.timeout {
+		return 0, false
+	}
+	s.closed = true
+	s.reaped = true
+	return idle, true
+}
+
+// Close closes the embedded stream unless it was already reaped.
+func (s *reapedStream) Close() error {
+	s.mu.Lock()
+	closed := s.closed
+	s.closed = true
+	s.mu.Unlock()
+	if closed {
+		return nil
+	}
+	s.reaper.untrack(s)
+	return s.ChatStream.Close()
+}
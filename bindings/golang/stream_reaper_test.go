@@ -0,0 +1,71 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStreamReaper tests closing streams left unread and streams whose read
+// hangs, but not streams closed by their callers
+func TestStreamReaper(t *testing.T) {
+	var mu sync.Mutex
+	idle := map[string]time.Duration{}
+	reaper := newStreamReaper(40*time.Millisecond, func(requestID string, d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		idle[requestID] = d
+	})
+	defer reaper.close()
+
+	abandoned := newSlowStream([]string{`{"id":"a"}`, `{"id":"a"}`}, 0, 0)
+	stream := reaper.track(WithRequestID(context.Background(), "abandoned"), abandoned)
+	if _, err := stream.RecvJSON(); err != nil {
+		t.Fatal(err)
+	}
+
+	hung := newSlowStream([]string{`{"id":"h"}`}, -1)
+	reading := reaper.track(WithRequestID(context.Background(), "hung"), hung)
+	done := make(chan error, 1)
+	go func() {
+		_, err := reading.RecvJSON()
+		done <- err
+	}()
+
+	closed := newSlowStream([]string{`{"id":"c"}`}, 0)
+	reaper.track(WithRequestID(context.Background(), "closed"), closed).Close()
+
+	select {
+	case <-abandoned.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the abandoned stream was not closed")
+	}
+	if _, err := stream.RecvJSON(); !errors.Is(err, ErrStreamIdle) {
+		t.Errorf("err = %v, want ErrStreamIdle", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("Close() = %v after the stream was reaped", err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStreamIdle) {
+			t.Errorf("hung read err = %v, want ErrStreamIdle", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hung stream was not closed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(idle) != 2 || idle["abandoned"] <= 40*time.Millisecond || idle["hung"] <= 40*time.Millisecond {
+		t.Errorf("OnStreamIdle calls = %v, want the abandoned and hung streams", idle)
+	}
+	reaper.mu.Lock()
+	defer reaper.mu.Unlock()
+	if len(reaper.streams) != 0 {
+		t.Errorf("%d streams still tracked", len(reaper.streams))
+	}
+}
@@ -0,0 +1,84 @@
+package smg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// includeUsage reports whether opts asks for a usage chunk
+func includeUsage(opts *StreamOptions) bool {
+	return opts != nil && opts.IncludeUsage != nil && *opts.IncludeUsage
+}
+
+// withUsage returns stream options asking for a usage chunk. Non-streaming
+// calls collect a stream with these options so the response has usage.
+func withUsage() *StreamOptions {
+	include := true
+	return &StreamOptions{IncludeUsage: &include}
+}
+
+// usageFilter applies stream_options.include_usage to chat chunks. Workers
+// report usage on the chunk that finishes a choice. Without include_usage the
+// usage is dropped; with it, the usage is moved to a separate chunk with no
+// choices, sent after all other chunks as in the OpenAI API.
+type usageFilter struct {
+	include bool
+	// usageChunk is held until the underlying stream ends
+	usageChunk string
+	done       bool
+}
+
+// next returns the next chunk read with recv, after applying the filter
+func (f *usageFilter) next(recv func() (string, error)) (string, error) {
+	if f.done {
+		return "", io.EOF
+	}
+
+	for {
+		chunkJSON, err := recv()
+		if err == io.EOF && f.usageChunk != "" {
+			f.done = true
+			return f.usageChunk, nil
+		}
+		if err != nil || !strings.Contains(chunkJSON, `"usage"`) {
+			return chunkJSON, err
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(chunkJSON), &fields); err != nil {
+			return "", fmt.Errorf("failed to parse chunk: %w", err)
+		}
+		usage, ok := fields["usage"]
+		if !ok || string(usage) == "null" {
+			return chunkJSON, nil
+		}
+		var choices []json.RawMessage
+		_ = json.Unmarshal(fields["choices"], &choices)
+
+		if len(choices) == 0 {
+			// Already a usage chunk
+			if f.include {
+				f.usageChunk = chunkJSON
+			}
+			continue
+		}
+
+		delete(fields, "usage")
+		stripped, err := json.Marshal(fields)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal chunk: %w", err)
+		}
+		if f.include {
+			fields["choices"] = json.RawMessage("[]")
+			fields["usage"] = usage
+			usageChunk, err := json.Marshal(fields)
+			if err != nil {
+				return "", fmt.Errorf("failed to marshal usage chunk: %w", err)
+			}
+			f.usageChunk = string(usageChunk)
+		}
+		return string(stripped), nil
+	}
+}
@@ -0,0 +1,62 @@
+package smg
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// TestUsageFilter tests that usage is dropped or moved to a final usage chunk
+func TestUsageFilter(t *testing.T) {
+	chunks := []string{
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`,
+	}
+
+	tests := []struct {
+		name       string
+		include    bool
+		wantChunks int
+	}{
+		{name: "without include_usage", include: false, wantChunks: 2},
+		{name: "with include_usage", include: true, wantChunks: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeChatStream{chunks: append([]string(nil), chunks...)}
+			filter := usageFilter{include: tt.include}
+
+			var got []ChatCompletionStreamResponse
+			for {
+				chunkJSON, err := filter.next(source.RecvJSON)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("next() error = %v", err)
+				}
+				var chunk ChatCompletionStreamResponse
+				if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+					t.Fatalf("invalid chunk %s: %v", chunkJSON, err)
+				}
+				got = append(got, chunk)
+			}
+
+			if len(got) != tt.wantChunks {
+				t.Fatalf("got %d chunks, want %d", len(got), tt.wantChunks)
+			}
+			for i, chunk := range got[:2] {
+				if chunk.Usage != nil || len(chunk.Choices) != 1 {
+					t.Errorf("chunk %d = %+v, want one choice and no usage", i, chunk)
+				}
+			}
+			if tt.include {
+				last := got[2]
+				if len(last.Choices) != 0 || last.Usage == nil || last.Usage.TotalTokens != 3 || last.ID != "c" {
+					t.Errorf("usage chunk = %+v, want no choices and the usage", last)
+				}
+			}
+		})
+	}
+}
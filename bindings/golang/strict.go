@@ -0,0 +1,233 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides strict decoding of responses.
+package smg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StrictDecoding reports response fields the SDK does not decode, so that a
+// backend adding or renaming fields is noticed instead of its data being
+// silently dropped. It is set with ClientConfig.StrictDecoding,
+// MultiClientConfig.StrictDecoding, or HTTPClientConfig.StrictDecoding.
+//
+// Chat completion responses and stream chunks are checked as json.Decoder's
+// DisallowUnknownFields would, including the fields of messages and deltas,
+// and every unknown field is reported, not just the first. Unknown fields
+// that are null carry no data and are not reported.
+type StrictDecoding struct {
+	// Reject fails the request, or the stream read, with an
+	// *UnknownFieldsError instead of reporting it.
+	Reject bool
+	// OnUnknownFields, if set, is called the first time each unknown field
+	// is seen, e.g. to record a metric. Defaults to logging with the log
+	// package.
+	OnUnknownFields func(err *UnknownFieldsError)
+}
+
+// UnknownFieldsError lists the fields of a response that the SDK does not
+// decode.
+type UnknownFieldsError struct {
+	// Type is the Go type decoded, e.g. "ChatCompletionStreamResponse"
+	Type string
+	// Fields are the paths of the unknown fields, e.g.
+	// "choices[].delta.audio"
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return fmt.Sprintf("unknown fields in %s: %s", e.Type, strings.Join(e.Fields, ", "))
+}
+
+// strictDecoder checks responses for a client
+type strictDecoder struct {
+	config StrictDecoding
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// newStrictDecoder returns a decoder for config, or nil if config is nil
+func newStrictDecoder(config *StrictDecoding) *strictDecoder {
+	if config == nil {
+		return nil
+	}
+	return &strictDecoder{config: *config, seen: make(map[string]bool)}
+}
+
+// check reports the fields of data that decoding into v's type would drop,
+// and returns the error if they are rejected. A nil decoder checks nothing.
+func (d *strictDecoder) check(data []byte, v interface{}) error {
+	if d == nil {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	fields := unknownFields(data, t)
+	if len(fields) == 0 {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	err := &UnknownFieldsError{Type: t.Name(), Fields: fields}
+	if d.config.Reject {
+		return err
+	}
+
+	// Report each field once, as a stream repeats it in every chunk
+	d.mu.Lock()
+	var unseen []string
+	for _, field := range fields {
+		key := err.Type + "." + field
+		if !d.seen[key] {
+			d.seen[key] = true
+			unseen = append(unseen, field)
+		}
+	}
+	d.mu.Unlock()
+	if len(unseen) == 0 {
+		return nil
+	}
+	err.Fields = unseen
+	if d.config.OnUnknownFields != nil {
+		d.config.OnUnknownFields(err)
+	} else {
+		log.Printf("smg: %v", err)
+	}
+	return nil
+}
+
+// unknownFields returns the paths of the fields of the JSON document data
+// that decoding into a value of type t would drop and that are not null,
+// sorted. Array elements share a path. Malformed documents are left to the
+// decoder to reject.
+func unknownFields(data []byte, t reflect.Type) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if decoder.Decode(&doc) != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	collectUnknownFields(doc, t, "", seen)
+	if len(seen) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// collectUnknownFields adds the unknown fields of value, decoded into a
+// value of type t at path, to seen
+func collectUnknownFields(value interface{}, t reflect.Type, path string, seen map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, v := range value {
+				fieldPath := key
+				if path != "" {
+					fieldPath = path + "." + key
+				}
+				fieldType, ok := lookupJSONField(fields, key)
+				if !ok {
+					if v != nil {
+						seen[fieldPath] = true
+					}
+					continue
+				}
+				collectUnknownFields(v, fieldType, fieldPath, seen)
+			}
+		case reflect.Map:
+			for key, v := range value {
+				collectUnknownFields(v, t.Elem(), path+"."+key, seen)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, v := range value {
+				collectUnknownFields(v, t.Elem(), path+"[]", seen)
+			}
+		}
+	}
+}
+
+// jsonFieldCache maps struct types to their jsonFields
+var jsonFieldCache sync.Map
+
+// jsonFields returns the types of the fields encoding/json decodes into a
+// struct of type t, by JSON name, including those of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	if fields, ok := jsonFieldCache.Load(t); ok {
+		return fields.(map[string]reflect.Type)
+	}
+	fields := make(map[string]reflect.Type)
+	addJSONFields(t, fields)
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+func addJSONFields(t reflect.Type, fields map[string]reflect.Type) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = f.Type
+		}
+	}
+	// Fields of embedded structs are shadowed by the outer ones
+	for _, e := range embedded {
+		addJSONFields(e, fields)
+	}
+}
+
+// lookupJSONField finds the field for key, preferring an exact match and
+// otherwise matching case-insensitively as encoding/json does
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
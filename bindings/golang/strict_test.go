@@ -0,0 +1,65 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestUnknownFields tests finding the fields decoding would drop
+func TestUnknownFields(t *testing.T) {
+	chunk := `{"id":"c","Model":"m","choices":[{"index":0,"delta":{"content":[{"type":"text","text":"hi"}],"audio":{"data":"x"}},"logprobs":null,"matched_stop":2}],"usage":{"prompt_tokens":1,"prompt_tokens_details":{"cached_tokens":1,"audio_tokens":0}},"sequence_number":1}`
+	got := unknownFields([]byte(chunk), reflect.TypeOf(ChatCompletionStreamResponse{}))
+	want := []string{"choices[].delta.audio", "choices[].matched_stop", "usage.prompt_tokens_details.audio_tokens"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownFields() = %v, want %v", got, want)
+	}
+	if got := unknownFields([]byte(`not json`), reflect.TypeOf(ChatCompletionStreamResponse{})); got != nil {
+		t.Errorf("unknownFields() of malformed JSON = %v", got)
+	}
+}
+
+// TestStrictDecoder tests reporting unknown fields once and rejecting them
+func TestStrictDecoder(t *testing.T) {
+	var reported []*UnknownFieldsError
+	d := newStrictDecoder(&StrictDecoding{OnUnknownFields: func(err *UnknownFieldsError) {
+		reported = append(reported, err)
+	}})
+	for _, chunk := range []string{`{"choices":[],"extra":1}`, `{"choices":[],"extra":2,"more":true}`} {
+		if err := d.check([]byte(chunk), ChatCompletionStreamResponse{}); err != nil {
+			t.Errorf("check() error: %v", err)
+		}
+	}
+	if len(reported) != 2 || !reflect.DeepEqual(reported[0].Fields, []string{"extra"}) || !reflect.DeepEqual(reported[1].Fields, []string{"more"}) || reported[0].Type != "ChatCompletionStreamResponse" {
+		t.Errorf("reported %v", reported)
+	}
+
+	var nilDecoder *strictDecoder
+	if err := nilDecoder.check([]byte(`{"extra":1}`), ChatCompletionStreamResponse{}); err != nil {
+		t.Errorf("check() of a nil decoder = %v", err)
+	}
+}
+
+// TestHTTPClientStrictDecoding tests rejecting responses with unknown fields
+func TestHTTPClientStrictDecoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"hi","refusal":"no"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL, StrictDecoding: &StrictDecoding{Reject: true}})
+	_, err := client.CreateChatCompletion(context.Background(), ChatCompletionRequest{Model: "m"})
+	var unknownErr *UnknownFieldsError
+	if !errors.As(err, &unknownErr) || unknownErr.Type != "ChatCompletionResponse" || !reflect.DeepEqual(unknownErr.Fields, []string{"choices[].message.refusal"}) {
+		t.Errorf("CreateChatCompletion() error = %v, want an UnknownFieldsError", err)
+	}
+
+	lenient, _ := NewHTTPClient(HTTPClientConfig{BaseURL: server.URL})
+	if resp, err := lenient.CreateChatCompletion(context.Background(), ChatCompletionRequest{Model: "m"}); err != nil || resp.Choices[0].Message.Content != "hi" {
+		t.Errorf("CreateChatCompletion() without strict decoding = %+v, %v", resp, err)
+	}
+}
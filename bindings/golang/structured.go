@@ -0,0 +1,156 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides typed structured output.
+package smg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// GenerateAttempts is the number of model calls Generate makes before giving
+// up on output that does not match the schema.
+const GenerateAttempts = 3
+
+// ErrInvalidOutput is matched, with errors.Is, by the error Generate returns
+// when no attempt produced output that decodes into the requested type.
+var ErrInvalidOutput = errors.New("model output does not match the schema")
+
+// OutputError is returned by Generate when the model output of the last
+// attempt could not be decoded.
+type OutputError struct {
+	// Output is the model output of the last attempt
+	Output string
+	// Err is a *SchemaError if the output is JSON that does not match the
+	// schema, or the decoding error otherwise
+	Err error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInvalidOutput, e.Err)
+}
+
+func (e *OutputError) Unwrap() []error {
+	return []error{ErrInvalidOutput, e.Err}
+}
+
+// schemaNameRe matches the characters not allowed in a response format name
+var schemaNameRe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// GenerateOptions controls GenerateWithOptions.
+type GenerateOptions struct {
+	// MaxAttempts is the number of model calls to make before giving up.
+	// Defaults to GenerateAttempts.
+	MaxAttempts int
+}
+
+// Generate asks the model for a value of type T. It sets req.ResponseFormat to
+// the JSON schema of T, built as ToolFromFunc builds tool parameters,
+// validates the output against the schema, and decodes it into T. Output
+// that is not valid JSON or does not match the schema is sent back to the
+// model with the errors, up to GenerateAttempts calls in all; an
+// *OutputError is returned if none matches.
+//
+//	type Review struct {
+//	    Sentiment string   `json:"sentiment" enum:"positive,negative,neutral"`
+//	    Topics    []string `json:"topics"`
+//	}
+//	review, err := smg.Generate[Review](ctx, client, req)
+func Generate[T any](ctx context.Context, client ChatClient, req ChatCompletionRequest) (T, error) {
+	return GenerateWithOptions[T](ctx, client, req, GenerateOptions{})
+}
+
+// GenerateWithOptions is Generate with a configurable number of attempts.
+func GenerateWithOptions[T any](ctx context.Context, client ChatClient, req ChatCompletionRequest, opts GenerateOptions) (T, error) {
+	var value T
+	t := reflect.TypeOf(&value).Elem()
+	name := schemaNameRe.ReplaceAllString(t.Name(), "_")
+	if name == "" {
+		name = "output"
+	}
+	schema := schemaOf(t)
+	req.ResponseFormat = &ResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: &JSONSchema{Name: name, Schema: schema, Strict: true},
+	}
+	req.Messages = append([]ChatMessage(nil), req.Messages...)
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = GenerateAttempts
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return value, err
+		}
+		if len(resp.Choices) == 0 {
+			return value, errors.New("response has no choices")
+		}
+
+		// Decode into a fresh value so that a failed attempt leaves nothing
+		// behind
+		output := resp.Choices[0].Message.Content
+		var decoded T
+		if err = ValidateSchema(schema, []byte(stripCodeFence(output))); err == nil {
+			if err = decodeOutput(output, &decoded); err == nil {
+				return decoded, nil
+			}
+		}
+		lastErr = &OutputError{Output: output, Err: err}
+
+		req.Messages = append(req.Messages,
+			ChatMessage{Role: "assistant", Content: output},
+			ChatMessage{Role: "user", Content: repairPrompt(err)},
+		)
+	}
+	return value, lastErr
+}
+
+// repairPrompt asks the model to correct output that failed with err
+func repairPrompt(err error) string {
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		return fmt.Sprintf("That response is not valid JSON for the required schema: %v. Reply with only the corrected JSON.", err)
+	}
+	var b strings.Builder
+	b.WriteString("That response does not match the required schema:\n")
+	for _, v := range schemaErr.Violations {
+		fmt.Fprintf(&b, "- %s\n", v)
+	}
+	b.WriteString("Reply with only the corrected JSON.")
+	return b.String()
+}
+
+// stripCodeFence unwraps output wrapped in a Markdown code fence
+func stripCodeFence(output string) string {
+	output = strings.TrimSpace(output)
+	if strings.HasPrefix(output, "```") {
+		output = strings.TrimPrefix(output, "```json")
+		output = strings.TrimPrefix(output, "```")
+		output = strings.TrimSuffix(output, "```")
+	}
+	return output
+}
+
+// decodeOutput decodes model output into v, rejecting properties the schema
+// does not allow. Output wrapped in a Markdown code fence is unwrapped.
+func decodeOutput(output string, v interface{}) error {
+	output = stripCodeFence(output)
+	decoder := json.NewDecoder(bytes.NewReader([]byte(output)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
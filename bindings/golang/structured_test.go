@@ -0,0 +1,104 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedClient answers chat requests with fixed contents in turn.
+type scriptedClient struct {
+	contents []string
+	requests []ChatCompletionRequest
+}
+
+func (c *scriptedClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.requests = append(c.requests, req)
+	content := c.contents[0]
+	c.contents = c.contents[1:]
+	return &ChatCompletionResponse{Choices: []Choice{{Message: Message{Role: "assistant", Content: content}}}}, nil
+}
+
+func (c *scriptedClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	return nil, errors.New("streams are not scripted")
+}
+
+type review struct {
+	Sentiment string   `json:"sentiment" enum:"positive,negative"`
+	Topics    []string `json:"topics"`
+}
+
+// TestGenerate tests decoding, retries with feedback, and the response format
+func TestGenerate(t *testing.T) {
+	client := &scriptedClient{contents: []string{
+		`{"sentiment": "positive", "topics": ["food"], "extra": 1}`,
+		"```json\n{\"sentiment\": \"positive\", \"topics\": [\"food\", \"service\"]}\n```",
+	}}
+	req := ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "Great food and service!"}}}
+
+	got, err := Generate[review](context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if got.Sentiment != "positive" || strings.Join(got.Topics, ",") != "food,service" {
+		t.Errorf("Generate() = %+v", got)
+	}
+
+	format := client.requests[0].ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema.Name != "review" {
+		t.Fatalf("ResponseFormat = %+v", format)
+	}
+	if required := format.JSONSchema.Schema["required"].([]string); strings.Join(required, ",") != "sentiment,topics" {
+		t.Errorf("schema required = %v", required)
+	}
+
+	retry := client.requests[1].Messages
+	if len(retry) != 3 || retry[1].Role != "assistant" || !strings.Contains(retry[2].Content.(string), `$: unknown property "extra"`) {
+		t.Errorf("retry messages = %+v", retry)
+	}
+	if len(req.Messages) != 1 {
+		t.Errorf("request messages modified: %+v", req.Messages)
+	}
+}
+
+// TestGenerateInvalidOutput tests the error after every attempt fails
+func TestGenerateInvalidOutput(t *testing.T) {
+	client := &scriptedClient{contents: []string{"no", "still no", `{"sentiment": 5}`}}
+	_, err := Generate[review](context.Background(), client, ChatCompletionRequest{})
+
+	var outputErr *OutputError
+	if !errors.Is(err, ErrInvalidOutput) || !errors.As(err, &outputErr) || outputErr.Output != `{"sentiment": 5}` {
+		t.Errorf("Generate() error = %v, want an OutputError for the last output", err)
+	}
+	if len(client.requests) != GenerateAttempts {
+		t.Errorf("made %d requests, want %d", len(client.requests), GenerateAttempts)
+	}
+}
+
+// TestGenerateSchemaRepair tests that schema violations are fed back and
+// that the attempts are configurable
+func TestGenerateSchemaRepair(t *testing.T) {
+	client := &scriptedClient{contents: []string{
+		`{"sentiment": "mixed", "topics": "food"}`,
+		`{"sentiment": "positive"}`,
+	}}
+	_, err := GenerateWithOptions[review](context.Background(), client, ChatCompletionRequest{}, GenerateOptions{MaxAttempts: 2})
+
+	var schemaErr *SchemaError
+	if !errors.Is(err, ErrInvalidOutput) || !errors.As(err, &schemaErr) {
+		t.Fatalf("GenerateWithOptions() error = %v, want a SchemaError", err)
+	}
+	if len(schemaErr.Violations) != 1 || schemaErr.Violations[0].String() != `$: missing required property "topics"` {
+		t.Errorf("violations = %v", schemaErr.Violations)
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("made %d requests, want 2", len(client.requests))
+	}
+	feedback := client.requests[1].Messages[1].Content.(string)
+	for _, want := range []string{`- $.sentiment: must be one of "positive", "negative"`, "- $.topics: must be array, got string"} {
+		if !strings.Contains(feedback, want) {
+			t.Errorf("feedback = %q, want %q", feedback, want)
+		}
+	}
+}
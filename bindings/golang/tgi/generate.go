@@ -0,0 +1,208 @@
+// Package tgi converts between the Hugging Face Text Generation Inference
+// (TGI) /generate API and SMG text completions, so that existing TGI clients
+// and benchmarks can target SMG workers:
+//
+//	var req tgi.GenerateRequest
+//	json.Unmarshal(body, &req)
+//	completionReq, err := tgi.CompletionRequest(req, false)
+//	...
+//	resp, err := client.CreateCompletion(ctx, completionReq)
+//	...
+//	json.Marshal(tgi.GenerateResponseFrom(req, resp))
+//
+// Streams for /generate_stream are converted chunk by chunk with a
+// StreamConverter. The smghttp handler serves /generate and /generate_stream
+// with this package when Options.TGI is set.
+//
+// Completions report no token IDs or log probabilities, so tokens are sent
+// with ID 0 and log probability 0, and details list no tokens.
+package tgi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// DefaultMaxNewTokens is the number of tokens generated when a request does
+// not set max_new_tokens, as in TGI.
+const DefaultMaxNewTokens = 100
+
+// GenerateRequest is a /generate or /generate_stream request.
+type GenerateRequest struct {
+	Inputs     string     `json:"inputs"`
+	Parameters Parameters `json:"parameters"`
+}
+
+// Parameters are the generation parameters of a request. Parameters the
+// completion API has no equivalent for are decoded only to be rejected.
+type Parameters struct {
+	DoSample          bool     `json:"do_sample"`
+	MaxNewTokens      *int     `json:"max_new_tokens"`
+	Temperature       *float32 `json:"temperature"`
+	TopK              *int     `json:"top_k"`
+	TopP              *float32 `json:"top_p"`
+	RepetitionPenalty *float32 `json:"repetition_penalty"`
+	FrequencyPenalty  *float32 `json:"frequency_penalty"`
+	Seed              *int     `json:"seed"`
+	Stop              []string `json:"stop"`
+	// ReturnFullText prepends the inputs to the generated text
+	ReturnFullText bool `json:"return_full_text"`
+	// Details adds the finish reason and token counts to /generate responses
+	Details bool `json:"details"`
+
+	BestOf              *int            `json:"best_of"`
+	TypicalP            *float32        `json:"typical_p"`
+	Truncate            *int            `json:"truncate"`
+	TopNTokens          *int            `json:"top_n_tokens"`
+	Grammar             json.RawMessage `json:"grammar"`
+	Watermark           bool            `json:"watermark"`
+	DecoderInputDetails bool            `json:"decoder_input_details"`
+}
+
+// GenerateResponse is a /generate response.
+type GenerateResponse struct {
+	GeneratedText string   `json:"generated_text"`
+	Details       *Details `json:"details,omitempty"`
+}
+
+// Details are the details of a /generate response.
+type Details struct {
+	FinishReason    string  `json:"finish_reason"`
+	GeneratedTokens int     `json:"generated_tokens"`
+	Seed            *int    `json:"seed"`
+	Prefill         []Token `json:"prefill"`
+	Tokens          []Token `json:"tokens"`
+}
+
+// Token is a generated token.
+type Token struct {
+	ID      int     `json:"id"`
+	Text    string  `json:"text"`
+	Logprob float32 `json:"logprob"`
+	Special bool    `json:"special"`
+}
+
+// StreamResponse is an event of a /generate_stream response. The last event
+// has the generated text and details.
+type StreamResponse struct {
+	Index         int            `json:"index"`
+	Token         Token          `json:"token"`
+	GeneratedText *string        `json:"generated_text"`
+	Details       *StreamDetails `json:"details"`
+}
+
+// StreamDetails are the details of the last event of a stream.
+type StreamDetails struct {
+	FinishReason    string `json:"finish_reason"`
+	GeneratedTokens int    `json:"generated_tokens"`
+	Seed            *int   `json:"seed"`
+	InputLength     int    `json:"input_length"`
+}
+
+// ErrorBody is the body of a TGI error response, which is also sent as an
+// event in place of the rest of a failed stream. ErrorType is "validation",
+// "overloaded", or "generation".
+type ErrorBody struct {
+	Error     string `json:"error"`
+	ErrorType string `json:"error_type"`
+}
+
+// CompletionRequest converts a TGI request to a completion request, for a
+// stream if stream is set. Without do_sample, temperature, top_k, or top_p
+// the request is greedy, as in TGI. Requests using parameters without a
+// completion equivalent, such as best_of or grammar, return an error
+// matching smg.ErrInvalidRequest.
+func CompletionRequest(req GenerateRequest, stream bool) (smg.CompletionRequest, error) {
+	p := req.Parameters
+	if req.Inputs == "" {
+		return smg.CompletionRequest{}, invalid("inputs must not be empty")
+	}
+	switch {
+	case p.BestOf != nil && *p.BestOf > 1:
+		return smg.CompletionRequest{}, invalid("best_of is not supported")
+	case p.TypicalP != nil:
+		return smg.CompletionRequest{}, invalid("typical_p is not supported")
+	case p.Truncate != nil:
+		return smg.CompletionRequest{}, invalid("truncate is not supported")
+	case p.TopNTokens != nil && *p.TopNTokens > 0:
+		return smg.CompletionRequest{}, invalid("top_n_tokens is not supported")
+	case len(p.Grammar) > 0 && string(p.Grammar) != "null":
+		return smg.CompletionRequest{}, invalid("grammar is not supported")
+	case p.Watermark:
+		return smg.CompletionRequest{}, invalid("watermark is not supported")
+	case p.DecoderInputDetails:
+		return smg.CompletionRequest{}, invalid("decoder_input_details is not supported")
+	case p.MaxNewTokens != nil && *p.MaxNewTokens <= 0:
+		return smg.CompletionRequest{}, invalid("max_new_tokens must be positive")
+	}
+
+	maxTokens := DefaultMaxNewTokens
+	if p.MaxNewTokens != nil {
+		maxTokens = *p.MaxNewTokens
+	}
+	completionReq := smg.CompletionRequest{
+		Prompt:            req.Inputs,
+		MaxTokens:         &maxTokens,
+		Temperature:       p.Temperature,
+		TopK:              p.TopK,
+		TopP:              p.TopP,
+		RepetitionPenalty: p.RepetitionPenalty,
+		FrequencyPenalty:  p.FrequencyPenalty,
+		Seed:              p.Seed,
+		Stream:            stream,
+	}
+	if !p.DoSample && p.Temperature == nil && p.TopK == nil && p.TopP == nil {
+		greedy := float32(0)
+		completionReq.Temperature = &greedy
+	}
+	if len(p.Stop) > 0 {
+		completionReq.Stop = p.Stop
+	}
+	if stream {
+		// The last event reports the token counts; the inputs are
+		// prepended to its generated text rather than streamed
+		includeUsage := true
+		completionReq.StreamOptions = &smg.StreamOptions{IncludeUsage: &includeUsage}
+	} else {
+		completionReq.Echo = p.ReturnFullText
+	}
+	return completionReq, nil
+}
+
+// GenerateResponseFrom converts a completion to the /generate response for
+// req, with details if req asked for them.
+func GenerateResponseFrom(req GenerateRequest, resp *smg.CompletionResponse) *GenerateResponse {
+	out := &GenerateResponse{}
+	var finishReason smg.FinishReason
+	if len(resp.Choices) > 0 {
+		out.GeneratedText = resp.Choices[0].Text
+		finishReason = resp.Choices[0].FinishReason
+	}
+	if req.Parameters.Details {
+		out.Details = &Details{
+			FinishReason:    FinishReason(finishReason),
+			GeneratedTokens: resp.Usage.CompletionTokens,
+			Seed:            req.Parameters.Seed,
+			Prefill:         []Token{},
+			Tokens:          []Token{},
+		}
+	}
+	return out
+}
+
+// FinishReason converts a completion finish reason to a TGI one: "length"
+// when the token limit was reached and "eos_token" otherwise. Completions do
+// not say whether a stop sequence matched, so "stop_sequence" is not
+// reported.
+func FinishReason(finishReason smg.FinishReason) string {
+	if finishReason.IsTruncated() {
+		return "length"
+	}
+	return "eos_token"
+}
+
+func invalid(message string) error {
+	return fmt.Errorf("%w: %s", smg.ErrInvalidRequest, message)
+}
@@ -0,0 +1,75 @@
+package tgi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+func decodeRequest(t *testing.T, body string) GenerateRequest {
+	t.Helper()
+	var req GenerateRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return req
+}
+
+// TestCompletionRequest tests the parameter mapping, greedy decoding by
+// default, and the rejection of unsupported parameters
+func TestCompletionRequest(t *testing.T) {
+	req := decodeRequest(t, `{"inputs":"Hello","parameters":{"max_new_tokens":20,"top_p":0.9,"seed":7,"stop":["\n"],"return_full_text":true}}`)
+	got, err := CompletionRequest(req, false)
+	if err != nil {
+		t.Fatalf("CompletionRequest error: %v", err)
+	}
+	if got.Prompt != "Hello" || *got.MaxTokens != 20 || *got.TopP != 0.9 || *got.Seed != 7 || got.Stop == nil || !got.Echo {
+		t.Errorf("CompletionRequest = %+v", got)
+	}
+	if got.Temperature != nil {
+		t.Errorf("temperature = %v, want unset when top_p is set", *got.Temperature)
+	}
+
+	got, err = CompletionRequest(decodeRequest(t, `{"inputs":"Hello","parameters":{"return_full_text":true}}`), true)
+	if err != nil {
+		t.Fatalf("CompletionRequest error: %v", err)
+	}
+	if *got.MaxTokens != DefaultMaxNewTokens || got.Temperature == nil || *got.Temperature != 0 {
+		t.Errorf("default request = %+v, want greedy with %d tokens", got, DefaultMaxNewTokens)
+	}
+	if !got.Stream || got.Echo || got.StreamOptions == nil || !*got.StreamOptions.IncludeUsage {
+		t.Errorf("stream request = %+v, want usage and no echo", got)
+	}
+
+	for _, body := range []string{
+		`{"inputs":""}`,
+		`{"inputs":"Hello","parameters":{"best_of":2}}`,
+		`{"inputs":"Hello","parameters":{"grammar":{"type":"json","value":{}}}}`,
+		`{"inputs":"Hello","parameters":{"max_new_tokens":0}}`,
+	} {
+		if _, err := CompletionRequest(decodeRequest(t, body), false); !errors.Is(err, smg.ErrInvalidRequest) {
+			t.Errorf("CompletionRequest(%s) error = %v, want ErrInvalidRequest", body, err)
+		}
+	}
+}
+
+// TestGenerateResponseFrom tests that details are added only on request
+func TestGenerateResponseFrom(t *testing.T) {
+	resp := &smg.CompletionResponse{
+		Choices: []smg.CompletionChoice{{Text: " world", FinishReason: "length"}},
+		Usage:   smg.Usage{PromptTokens: 1, CompletionTokens: 2},
+	}
+	if got := GenerateResponseFrom(GenerateRequest{Inputs: "Hello"}, resp); got.GeneratedText != " world" || got.Details != nil {
+		t.Errorf("response = %+v", got)
+	}
+	seed := 7
+	got := GenerateResponseFrom(GenerateRequest{Inputs: "Hello", Parameters: Parameters{Details: true, Seed: &seed}}, resp)
+	if got.Details == nil || got.Details.FinishReason != "length" || got.Details.GeneratedTokens != 2 || *got.Details.Seed != 7 {
+		t.Errorf("details = %+v", got.Details)
+	}
+	if reason := FinishReason("stop"); reason != "eos_token" {
+		t.Errorf("FinishReason(stop) = %q, want eos_token", reason)
+	}
+}
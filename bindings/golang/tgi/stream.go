@@ -0,0 +1,96 @@
+package tgi
+
+import (
+	"encoding/json"
+	"strings"
+
+	smg "github.com/lightseek/smg/go-grpc-sdk"
+)
+
+// streamChunk is the part of a completion stream chunk that events are
+// built from
+type streamChunk struct {
+	Choices []struct {
+		Text         string           `json:"text"`
+		FinishReason smg.FinishReason `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// StreamConverter converts the chunks of a completion stream to
+// /generate_stream events, one per chunk with text. The last event carries
+// the generated text and details, so each event is held back until the
+// next one or the end of the stream. Feed it every chunk with Chunk, then
+// call Finish.
+type StreamConverter struct {
+	req     GenerateRequest
+	pending *StreamResponse
+	index   int
+	text    strings.Builder
+
+	finishReason    smg.FinishReason
+	inputLength     int
+	generatedTokens int
+}
+
+// NewStreamConverter returns a converter for the stream answering req.
+func NewStreamConverter(req GenerateRequest) *StreamConverter {
+	return &StreamConverter{req: req}
+}
+
+// Chunk returns the events ready to send after one chunk, as returned by
+// RecvJSON.
+func (c *StreamConverter) Chunk(chunkJSON string) ([]StreamResponse, error) {
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(chunkJSON), &chunk); err != nil {
+		return nil, err
+	}
+	if chunk.Usage != nil {
+		c.inputLength = chunk.Usage.PromptTokens
+		c.generatedTokens = chunk.Usage.CompletionTokens
+	}
+	var events []StreamResponse
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != "" {
+			c.finishReason = choice.FinishReason
+		}
+		if choice.Text == "" {
+			continue
+		}
+		if c.pending != nil {
+			events = append(events, *c.pending)
+		}
+		c.index++
+		c.text.WriteString(choice.Text)
+		c.pending = &StreamResponse{Index: c.index, Token: Token{Text: choice.Text}}
+	}
+	return events, nil
+}
+
+// Finish returns the last event, with the generated text and details. A
+// stream without text ends with an empty token.
+func (c *StreamConverter) Finish() StreamResponse {
+	last := StreamResponse{Index: c.index + 1}
+	if c.pending != nil {
+		last = *c.pending
+	}
+	text := c.text.String()
+	if c.req.Parameters.ReturnFullText {
+		text = c.req.Inputs + text
+	}
+	generatedTokens := c.generatedTokens
+	if generatedTokens == 0 {
+		generatedTokens = c.index
+	}
+	last.GeneratedText = &text
+	last.Details = &StreamDetails{
+		FinishReason:    FinishReason(c.finishReason),
+		GeneratedTokens: generatedTokens,
+		Seed:            c.req.Parameters.Seed,
+		InputLength:     c.inputLength,
+	}
+	return last
+}
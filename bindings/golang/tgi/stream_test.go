@@ -0,0 +1,45 @@
+package tgi
+
+import "testing"
+
+// TestStreamConverter tests that each text chunk becomes a token event and
+// the last one carries the generated text and details
+func TestStreamConverter(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"text":"Bon"}]}`,
+		`{"choices":[{"text":"jour","finish_reason":"length"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+	}
+	c := NewStreamConverter(GenerateRequest{Inputs: "Hello: ", Parameters: Parameters{ReturnFullText: true}})
+	var events []StreamResponse
+	for _, chunk := range chunks {
+		es, err := c.Chunk(chunk)
+		if err != nil {
+			t.Fatalf("Chunk(%s) error: %v", chunk, err)
+		}
+		events = append(events, es...)
+	}
+	events = append(events, c.Finish())
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if first := events[0]; first.Index != 1 || first.Token.Text != "Bon" || first.GeneratedText != nil || first.Details != nil {
+		t.Errorf("first event = %+v", first)
+	}
+	last := events[1]
+	if last.Index != 2 || last.Token.Text != "jour" || last.GeneratedText == nil || *last.GeneratedText != "Hello: Bonjour" {
+		t.Errorf("last event = %+v", last)
+	}
+	if d := last.Details; d == nil || d.FinishReason != "length" || d.GeneratedTokens != 2 || d.InputLength != 3 {
+		t.Errorf("details = %+v", d)
+	}
+
+	empty := NewStreamConverter(GenerateRequest{Inputs: "Hello"}).Finish()
+	if empty.Index != 1 || empty.Token.Text != "" || *empty.GeneratedText != "" || empty.Details.FinishReason != "eos_token" {
+		t.Errorf("empty stream event = %+v", empty)
+	}
+	if _, err := c.Chunk("not json"); err == nil {
+		t.Error("Chunk(not json) succeeded, want an error")
+	}
+}
@@ -0,0 +1,312 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file exposes the tokenizer used for request preprocessing so callers
+// can measure prompts exactly as the SDK and backend see them.
+package smg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// Tokenizer wraps the Rust tokenizer that the SDK uses to apply chat templates
+// and tokenize prompts.
+//
+// A Tokenizer is either created with NewTokenizer, in which case the caller
+// owns it and must call Close, or borrowed from a client via Client.Tokenizer
+// or MultiClient.Tokenizer, in which case it remains valid until the client is
+// closed and Close is a no-op. Methods of a borrowed tokenizer return an error
+// once its client is closed.
+//
+// Thread-safe: All public methods are safe for concurrent use.
+type Tokenizer struct {
+	path   string
+	handle *ffi.TokenizerHandle
+	owned  bool
+	// owner is the client a borrowed tokenizer belongs to, nil if owned
+	owner *tokenizerOwner
+	mu    sync.RWMutex
+}
+
+// tokenizerOwner is the client that frees a borrowed tokenizer's handle when
+// closed. Calls hold its read lock, so the handle is not freed under them.
+type tokenizerOwner struct {
+	mu *sync.RWMutex
+	// open reports whether the client is open; called under mu
+	open func() bool
+}
+
+// lock read-locks the tokenizer, and the client it is borrowed from, and
+// returns the handle, or nil once either is closed. unlock must be called
+// either way.
+func (t *Tokenizer) lock() (handle *ffi.TokenizerHandle, unlock func()) {
+	t.mu.RLock()
+	if t.owner == nil {
+		return t.handle, t.mu.RUnlock
+	}
+	t.owner.mu.RLock()
+	unlock = func() {
+		t.owner.mu.RUnlock()
+		t.mu.RUnlock()
+	}
+	if !t.owner.open() {
+		return nil, unlock
+	}
+	return t.handle, unlock
+}
+
+// NewTokenizer loads the tokenizer at path (a tokenizer directory, a
+// tokenizer.json, tiktoken, or SentencePiece model file, or a HuggingFace
+// model ID).
+func NewTokenizer(path string) (*Tokenizer, error) {
+	if path == "" {
+		return nil, errors.New("tokenizer path is required")
+	}
+	handle, err := ffi.CreateTokenizerHandle(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	return &Tokenizer{path: path, handle: handle, owned: true}, nil
+}
+
+// Path returns the path the tokenizer was loaded from.
+func (t *Tokenizer) Path() string {
+	return t.path
+}
+
+// Close releases the tokenizer. It is a no-op for tokenizers borrowed from a
+// client. Calling Close multiple times is safe.
+func (t *Tokenizer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.owned && t.handle != nil {
+		ffi.FreeTokenizerHandle(t.handle)
+	}
+	t.handle = nil
+	return nil
+}
+
+// Encode tokenizes text as-is, without a chat template. addSpecialTokens
+// adds the tokens the tokenizer puts around each sequence, such as BOS.
+func (t *Tokenizer) Encode(text string, addSpecialTokens bool) ([]uint32, error) {
+	handle, unlock := t.lock()
+	defer unlock()
+
+	if handle == nil {
+		return nil, errors.New("tokenizer is closed")
+	}
+	return ffi.TokenizerEncode(handle, text, addSpecialTokens)
+}
+
+// CountPromptTokens returns the number of prompt tokens req produces after the
+// chat template is applied and the prompt is tokenized. This is the same
+// preprocessing the SDK performs before sending a request, so the result
+// matches the prompt_tokens the backend reports.
+func (t *Tokenizer) CountPromptTokens(req ChatCompletionRequest) (int, error) {
+	handle, unlock := t.lock()
+	defer unlock()
+
+	if handle == nil {
+		return 0, errors.New("tokenizer is closed")
+	}
+
+	if len(req.Tools) == 0 {
+		req.Tools = nil
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	preprocessed, err := ffi.PreprocessChatRequestWithTokenizer(string(reqJSON), handle)
+	if err != nil {
+		return 0, err
+	}
+	defer preprocessed.Free()
+
+	return len(preprocessed.TokenIDs), nil
+}
+
+// SpecialToken is a special token string together with its vocabulary ID.
+// ID is nil when the token string is not in the vocabulary, which usually
+// indicates a mismatched tokenizer_config.json.
+type SpecialToken struct {
+	Token string  `json:"token"`
+	ID    *uint32 `json:"id"`
+}
+
+// SpecialTokens describes the special tokens of a loaded tokenizer. Fields
+// are nil when the tokenizer does not define the corresponding token.
+type SpecialTokens struct {
+	BOS  *SpecialToken `json:"bos"`
+	EOS  *SpecialToken `json:"eos"`
+	UNK  *SpecialToken `json:"unk"`
+	SEP  *SpecialToken `json:"sep"`
+	Pad  *SpecialToken `json:"pad"`
+	CLS  *SpecialToken `json:"cls"`
+	Mask *SpecialToken `json:"mask"`
+
+	// Additional holds the remaining special tokens, including chat-control
+	// tokens such as "<|im_start|>" or "<|eot_id|>".
+	Additional []SpecialToken `json:"additional_special_tokens"`
+
+	// EOSTokenIDs lists every token ID that ends generation, merged from the
+	// tokenizer and the model's generation_config.json.
+	EOSTokenIDs []uint32 `json:"eos_token_ids"`
+
+	// VocabSize is the size of the tokenizer vocabulary.
+	VocabSize int `json:"vocab_size"`
+}
+
+// StopTokenIDs returns token IDs suitable for ChatCompletionRequest.StopTokenIDs:
+// EOSTokenIDs, falling back to the EOS token when the list is empty.
+func (s *SpecialTokens) StopTokenIDs() []int {
+	if len(s.EOSTokenIDs) > 0 {
+		ids := make([]int, len(s.EOSTokenIDs))
+		for i, id := range s.EOSTokenIDs {
+			ids[i] = int(id)
+		}
+		return ids
+	}
+	if s.EOS != nil && s.EOS.ID != nil {
+		return []int{int(*s.EOS.ID)}
+	}
+	return nil
+}
+
+// Unresolved returns the special tokens whose strings are not in the
+// vocabulary. A non-empty result means the chat template will emit tokens the
+// model has never seen and is a common cause of degenerate output.
+func (s *SpecialTokens) Unresolved() []SpecialToken {
+	var out []SpecialToken
+	for _, tok := range []*SpecialToken{s.BOS, s.EOS, s.UNK, s.SEP, s.Pad, s.CLS, s.Mask} {
+		if tok != nil && tok.ID == nil {
+			out = append(out, *tok)
+		}
+	}
+	for _, tok := range s.Additional {
+		if tok.ID == nil {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// SpecialTokens returns the tokenizer's BOS/EOS/pad and chat-control tokens
+// with their IDs.
+func (t *Tokenizer) SpecialTokens() (*SpecialTokens, error) {
+	handle, unlock := t.lock()
+	defer unlock()
+
+	if handle == nil {
+		return nil, errors.New("tokenizer is closed")
+	}
+
+	resultJSON, err := ffi.TokenizerSpecialTokensJSON(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var special SpecialTokens
+	if err := json.Unmarshal([]byte(resultJSON), &special); err != nil {
+		return nil, fmt.Errorf("failed to parse special tokens: %w", err)
+	}
+	return &special, nil
+}
+
+// TokenToID returns the ID of token. The boolean result is false if token is
+// not in the vocabulary.
+func (t *Tokenizer) TokenToID(token string) (uint32, bool, error) {
+	handle, unlock := t.lock()
+	defer unlock()
+
+	if handle == nil {
+		return 0, false, errors.New("tokenizer is closed")
+	}
+	return ffi.TokenizerTokenToID(handle, token)
+}
+
+// IDToToken returns the token string for id. The boolean result is false if
+// id is not in the vocabulary.
+func (t *Tokenizer) IDToToken(id uint32) (string, bool, error) {
+	handle, unlock := t.lock()
+	defer unlock()
+
+	if handle == nil {
+		return "", false, errors.New("tokenizer is closed")
+	}
+	return ffi.TokenizerIDToToken(handle, id)
+}
+
+// Tokenizer returns the tokenizer the client uses for requests naming model.
+// The returned tokenizer is owned by the client and stays valid until the
+// client is closed.
+func (c *Client) Tokenizer(model string) (*Tokenizer, error) {
+	if c.backend != nil {
+		return c.backend.Tokenizer(model)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.grpcClient == nil {
+		return nil, errors.New("gRPC client is closed")
+	}
+	handle := c.grpcClient.TokenizerFor(model)
+	if handle == nil {
+		return nil, fmt.Errorf("no tokenizer configured for model %q", model)
+	}
+	return &Tokenizer{
+		path:   c.TokenizerPathForModel(model),
+		handle: handle,
+		owner:  &tokenizerOwner{mu: &c.mu, open: func() bool { return c.grpcClient != nil }},
+	}, nil
+}
+
+// Tokenizer returns the tokenizer the client uses for requests naming model.
+// Tokenizers are loaded on first use and cached per path; they stay valid
+// until the client is closed.
+func (c *MultiClient) Tokenizer(model string) (*Tokenizer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ffiClient == nil {
+		return nil, errors.New("multi-worker client is closed")
+	}
+
+	path := c.tokenizerPath
+	if p, ok := c.tokenizerPaths[model]; ok {
+		path = p
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no tokenizer configured for model %q", model)
+	}
+
+	if tok, ok := c.tokenizers[path]; ok {
+		return c.borrowTokenizer(tok), nil
+	}
+	tok, err := NewTokenizer(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.tokenizers == nil {
+		c.tokenizers = make(map[string]*Tokenizer)
+	}
+	c.tokenizers[path] = tok
+	return c.borrowTokenizer(tok), nil
+}
+
+// borrowTokenizer returns a tokenizer sharing the handle of tok, a tokenizer
+// the client caches and closes
+func (c *MultiClient) borrowTokenizer(tok *Tokenizer) *Tokenizer {
+	return &Tokenizer{
+		path:   tok.path,
+		handle: tok.handle,
+		owner:  &tokenizerOwner{mu: &c.mu, open: func() bool { return c.ffiClient != nil }},
+	}
+}
@@ -0,0 +1,218 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides tokenizer integrity pinning.
+package smg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrTokenizerMismatch is returned by NewClient and NewMultiClient when a
+// loaded tokenizer does not match its TokenizerPin.
+var ErrTokenizerMismatch = errors.New("tokenizer does not match pin")
+
+// TokenizerPin describes the tokenizer a client expects to load. Empty fields
+// are not checked.
+type TokenizerPin struct {
+	// SHA256 is the expected hex checksum as computed by TokenizerChecksum.
+	SHA256 string
+
+	// Revision is the expected HuggingFace commit hash (or a prefix of it) of
+	// the snapshot the tokenizer was loaded from. It only applies to
+	// tokenizers in the HuggingFace cache, including those downloaded by
+	// model ID; branch names such as "main" cannot be verified.
+	Revision string
+}
+
+// tokenizerFileNames are the files in a tokenizer directory that affect
+// tokenization or chat templating.
+var tokenizerFileNames = map[string]bool{
+	"tokenizer.json":          true,
+	"tokenizer_config.json":   true,
+	"special_tokens_map.json": true,
+	"vocab.json":              true,
+	"merges.txt":              true,
+	"tokenizer.model":         true,
+	"tiktoken.model":          true,
+	"chat_template.json":      true,
+	"generation_config.json":  true,
+}
+
+func isTokenizerFile(name string) bool {
+	return tokenizerFileNames[name] || strings.HasSuffix(name, ".tiktoken") || strings.HasSuffix(name, ".jinja")
+}
+
+// TokenizerChecksum returns the hex SHA-256 checksum used by TokenizerPin.
+//
+// For a file it is the SHA-256 of the file. For a directory it is the SHA-256
+// of the sha256sum-style listing ("<hex>  <name>\n", sorted by name) of the
+// tokenizer files in it (tokenizer.json, tokenizer_config.json,
+// special_tokens_map.json, vocab.json, merges.txt, tokenizer.model,
+// tiktoken.model, *.tiktoken, chat templates, and generation_config.json),
+// so it can be reproduced with:
+//
+//	sha256sum <files in name order> | sha256sum
+//
+// HuggingFace model IDs are resolved to their cached snapshot.
+func TokenizerChecksum(path string) (string, error) {
+	local, err := resolveTokenizerPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fileSHA256(local)
+	}
+
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isTokenizerFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no tokenizer files found in %s", local)
+	}
+	sort.Strings(names)
+
+	listing := sha256.New()
+	for _, name := range names {
+		sum, err := fileSHA256(filepath.Join(local, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(listing, "%s  %s\n", sum, name)
+	}
+	return hex.EncodeToString(listing.Sum(nil)), nil
+}
+
+// TokenizerRevision returns the HuggingFace commit hash of the cache snapshot
+// path belongs to. HuggingFace model IDs are resolved to their cached
+// snapshot.
+func TokenizerRevision(path string) (string, error) {
+	local, err := resolveTokenizerPath(path)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(local)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(filepath.ToSlash(abs), "/")
+	for i := 1; i+1 < len(parts); i++ {
+		if parts[i] == "snapshots" && strings.HasPrefix(parts[i-1], "models--") {
+			return parts[i+1], nil
+		}
+	}
+	return "", fmt.Errorf("%s is not in a HuggingFace cache snapshot", local)
+}
+
+// verifyTokenizerPin checks the tokenizer at path against pin.
+func verifyTokenizerPin(path string, pin TokenizerPin) error {
+	if pin.SHA256 != "" {
+		sum, err := TokenizerChecksum(path)
+		if err != nil {
+			return fmt.Errorf("failed to checksum tokenizer %s: %w", path, err)
+		}
+		if !strings.EqualFold(sum, pin.SHA256) {
+			return fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrTokenizerMismatch, path, sum, pin.SHA256)
+		}
+	}
+	if pin.Revision != "" {
+		rev, err := TokenizerRevision(path)
+		if err != nil {
+			return fmt.Errorf("failed to determine tokenizer revision: %w", err)
+		}
+		if !strings.HasPrefix(rev, pin.Revision) {
+			return fmt.Errorf("%w: %s is at revision %s, expected %s", ErrTokenizerMismatch, path, rev, pin.Revision)
+		}
+	}
+	return nil
+}
+
+// verifyTokenizerPins checks every pinned tokenizer of a client configuration.
+// pins is keyed by model name and applies to the matching paths entry.
+func verifyTokenizerPins(defaultPath string, defaultPin *TokenizerPin, paths map[string]string, pins map[string]TokenizerPin) error {
+	if defaultPin != nil {
+		if err := verifyTokenizerPin(defaultPath, *defaultPin); err != nil {
+			return err
+		}
+	}
+	for model, pin := range pins {
+		if err := verifyTokenizerPin(paths[model], pin); err != nil {
+			return fmt.Errorf("model %q: %w", model, err)
+		}
+	}
+	return nil
+}
+
+// validateTokenizerPins checks that pins only name configured tokenizers.
+func validateTokenizerPins(defaultPath string, defaultPin *TokenizerPin, paths map[string]string, pins map[string]TokenizerPin) error {
+	if defaultPin != nil && defaultPath == "" {
+		return errors.New("tokenizer pin is set but tokenizer path is empty")
+	}
+	for model := range pins {
+		if _, ok := paths[model]; !ok {
+			return fmt.Errorf("tokenizer pin for model %q has no matching tokenizer path", model)
+		}
+	}
+	return nil
+}
+
+// resolveTokenizerPath maps a HuggingFace model ID to its snapshot directory
+// in the local HuggingFace cache. Existing local paths are returned unchanged.
+func resolveTokenizerPath(path string) (string, error) {
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	cacheDir := os.Getenv("HF_HUB_CACHE")
+	if cacheDir == "" {
+		if home := os.Getenv("HF_HOME"); home != "" {
+			cacheDir = filepath.Join(home, "hub")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			cacheDir = filepath.Join(home, ".cache", "huggingface", "hub")
+		}
+	}
+	if cacheDir == "" {
+		return "", fmt.Errorf("tokenizer %s not found", path)
+	}
+
+	repoDir := filepath.Join(cacheDir, "models--"+strings.ReplaceAll(path, "/", "--"))
+	ref, err := os.ReadFile(filepath.Join(repoDir, "refs", "main"))
+	if err != nil {
+		return "", fmt.Errorf("tokenizer %s not found locally or in the HuggingFace cache", path)
+	}
+	return filepath.Join(repoDir, "snapshots", strings.TrimSpace(string(ref))), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package smg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestTokenizerChecksum tests file and directory checksums
+func TestTokenizerChecksum(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tokenizer.json":        `{"model":{}}`,
+		"tokenizer_config.json": `{}`,
+		"README.md":             "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := TokenizerChecksum(filepath.Join(dir, "tokenizer.json"))
+	if err != nil {
+		t.Fatalf("TokenizerChecksum(file) error: %v", err)
+	}
+	if want := sha256Hex(`{"model":{}}`); got != want {
+		t.Errorf("TokenizerChecksum(file) = %s, want %s", got, want)
+	}
+
+	listing := fmt.Sprintf("%s  tokenizer.json\n%s  tokenizer_config.json\n", sha256Hex(`{"model":{}}`), sha256Hex(`{}`))
+	got, err = TokenizerChecksum(dir)
+	if err != nil {
+		t.Fatalf("TokenizerChecksum(dir) error: %v", err)
+	}
+	if want := sha256Hex(listing); got != want {
+		t.Errorf("TokenizerChecksum(dir) = %s, want %s", got, want)
+	}
+
+	if err := verifyTokenizerPin(dir, TokenizerPin{SHA256: got}); err != nil {
+		t.Errorf("verifyTokenizerPin() with matching checksum: %v", err)
+	}
+	if err := verifyTokenizerPin(dir, TokenizerPin{SHA256: sha256Hex("other")}); !errors.Is(err, ErrTokenizerMismatch) {
+		t.Errorf("verifyTokenizerPin() with wrong checksum error = %v, want ErrTokenizerMismatch", err)
+	}
+}
+
+// TestTokenizerRevision tests revision detection for HuggingFace cache snapshots
+func TestTokenizerRevision(t *testing.T) {
+	cache := t.TempDir()
+	snapshot := filepath.Join(cache, "models--org--model", "snapshots", "abc123def")
+	if err := os.MkdirAll(snapshot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(cache, "models--org--model", "refs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cache, "models--org--model", "refs", "main"), []byte("abc123def\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HF_HUB_CACHE", cache)
+
+	for _, path := range []string{snapshot, "org/model"} {
+		rev, err := TokenizerRevision(path)
+		if err != nil {
+			t.Fatalf("TokenizerRevision(%q) error: %v", path, err)
+		}
+		if rev != "abc123def" {
+			t.Errorf("TokenizerRevision(%q) = %s, want abc123def", path, rev)
+		}
+	}
+
+	if err := verifyTokenizerPin("org/model", TokenizerPin{Revision: "abc123"}); err != nil {
+		t.Errorf("verifyTokenizerPin() with matching revision prefix: %v", err)
+	}
+	if err := verifyTokenizerPin("org/model", TokenizerPin{Revision: "fff"}); !errors.Is(err, ErrTokenizerMismatch) {
+		t.Errorf("verifyTokenizerPin() with wrong revision error = %v, want ErrTokenizerMismatch", err)
+	}
+	if _, err := TokenizerRevision(t.TempDir()); err == nil {
+		t.Error("TokenizerRevision() outside the cache should fail")
+	}
+}
@@ -0,0 +1,84 @@
+package smg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// TestSpecialTokens tests decoding and helpers of the special token report
+func TestSpecialTokens(t *testing.T) {
+	raw := `{
+		"bos": {"token": "<s>", "id": 1},
+		"eos": {"token": "</s>", "id": 2},
+		"unk": null, "sep": null, "cls": null, "mask": null,
+		"pad": {"token": "<pad>", "id": null},
+		"additional_special_tokens": [
+			{"token": "<|im_start|>", "id": 100},
+			{"token": "<|im_end|>", "id": null}
+		],
+		"eos_token_ids": [],
+		"vocab_size": 32000
+	}`
+
+	var special SpecialTokens
+	if err := json.Unmarshal([]byte(raw), &special); err != nil {
+		t.Fatalf("failed to decode special tokens: %v", err)
+	}
+
+	if special.VocabSize != 32000 {
+		t.Errorf("VocabSize = %d, want 32000", special.VocabSize)
+	}
+	if got := special.StopTokenIDs(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("StopTokenIDs() = %v, want [2]", got)
+	}
+
+	special.EOSTokenIDs = []uint32{2, 7}
+	if got := special.StopTokenIDs(); !reflect.DeepEqual(got, []int{2, 7}) {
+		t.Errorf("StopTokenIDs() = %v, want [2 7]", got)
+	}
+
+	var unresolved []string
+	for _, tok := range special.Unresolved() {
+		unresolved = append(unresolved, tok.Token)
+	}
+	if want := []string{"<pad>", "<|im_end|>"}; !reflect.DeepEqual(unresolved, want) {
+		t.Errorf("Unresolved() = %v, want %v", unresolved, want)
+	}
+}
+
+// TestBorrowedTokenizerAfterClose tests that a tokenizer borrowed from a
+// client stops using the handle the client frees on Close
+func TestBorrowedTokenizerAfterClose(t *testing.T) {
+	// The handles are never passed to the library: the client is closed
+	// before the tokenizer is used
+	client := &MultiClient{
+		tokenizerPath: "/models/llama",
+		ffiClient:     &ffi.MultiWorkerClientHandle{},
+		tokenizers: map[string]*Tokenizer{
+			"/models/llama": {path: "/models/llama", handle: &ffi.TokenizerHandle{}},
+		},
+	}
+	tok, err := client.Tokenizer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tok.Encode("hello", false); err == nil {
+		t.Error("Encode() after the client closed succeeded")
+	}
+	if _, err := tok.CountPromptTokens(ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "hi"}}}); err == nil {
+		t.Error("CountPromptTokens() after the client closed succeeded")
+	}
+	if _, err := tok.NewDetokenizer(nil, true); err == nil {
+		t.Error("NewDetokenizer() after the client closed succeeded")
+	}
+	if _, err := client.Tokenizer(""); err == nil {
+		t.Error("Tokenizer() on a closed client succeeded")
+	}
+}
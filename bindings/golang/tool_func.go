@@ -0,0 +1,224 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file builds tools, and their JSON schemas, from Go functions.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToolFromFunc builds a function tool from fn, which must have the form
+//
+//	func([ctx context.Context,] [args T]) (R, error)
+//
+// where T is a struct, or a pointer to one, describing the arguments. The
+// tool's parameters are the JSON schema of T: properties are named by their
+// json tags, fields without omitempty are required, and the "description"
+// and "enum" (comma-separated) struct tags describe a property:
+//
+//	type WeatherArgs struct {
+//	    City string `json:"city" description:"City name"`
+//	    Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+//	}
+//
+// The returned ToolFunc decodes the model's arguments into T and calls fn. A
+// string R is returned as is; other results are encoded as JSON.
+func ToolFromFunc(fn any, name, desc string) (Tool, ToolFunc, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return Tool{}, nil, fmt.Errorf("tool %q: expected a function, got %T", name, fn)
+	}
+	t := v.Type()
+	if t.NumOut() != 2 || t.Out(1) != errorType {
+		return Tool{}, nil, fmt.Errorf("tool %q: function must return (result, error)", name)
+	}
+
+	in := 0
+	withContext := in < t.NumIn() && t.In(in) == contextType
+	if withContext {
+		in++
+	}
+	var argsType reflect.Type
+	if in < t.NumIn() {
+		argsType = t.In(in)
+		in++
+		structType := argsType
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		if structType.Kind() != reflect.Struct {
+			return Tool{}, nil, fmt.Errorf("tool %q: arguments must be a struct, got %s", name, argsType)
+		}
+	}
+	if in != t.NumIn() || t.IsVariadic() {
+		return Tool{}, nil, fmt.Errorf("tool %q: function must take an optional context.Context and an optional arguments struct", name)
+	}
+
+	parameters := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	if argsType != nil {
+		parameters = schemaOf(argsType)
+	}
+	tool := Tool{
+		Type:     "function",
+		Function: Function{Name: name, Description: desc, Parameters: parameters},
+	}
+
+	call := func(ctx context.Context, arguments string) (string, error) {
+		var callArgs []reflect.Value
+		if withContext {
+			callArgs = append(callArgs, reflect.ValueOf(ctx))
+		}
+		if argsType != nil {
+			args, err := decodeArguments(argsType, arguments)
+			if err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			callArgs = append(callArgs, args)
+		}
+
+		out := v.Call(callArgs)
+		if err, _ := out[1].Interface().(error); err != nil {
+			return "", err
+		}
+		if s, ok := out[0].Interface().(string); ok {
+			return s, nil
+		}
+		result, err := json.Marshal(out[0].Interface())
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result: %w", err)
+		}
+		return string(result), nil
+	}
+	return tool, call, nil
+}
+
+// RegisterFunc adds a tool built from fn by ToolFromFunc.
+func (r *ToolRegistry) RegisterFunc(fn any, name, desc string) error {
+	tool, call, err := ToolFromFunc(fn, name, desc)
+	if err != nil {
+		return err
+	}
+	r.Register(name, desc, tool.Function.Parameters, call)
+	return nil
+}
+
+// decodeArguments decodes the JSON arguments of a tool call into a new value
+// of type t. Empty arguments decode as an empty object.
+func decodeArguments(t reflect.Type, arguments string) (reflect.Value, error) {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		t = t.Elem()
+	}
+	args := reflect.New(t)
+	if err := json.Unmarshal([]byte(arguments), args.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	if ptr {
+		return args, nil
+	}
+	return args.Elem(), nil
+}
+
+// schemaOf returns the JSON schema of values of type t as encoded by
+// encoding/json.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	return typeSchema(t, map[reflect.Type]bool{})
+}
+
+// typeSchema returns the schema of t. Structs in visiting are being described
+// already; recursive references to them accept any value.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), visiting)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]interface{}{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		return structSchema(t, visiting)
+	default:
+		// Interfaces hold any value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the schema of a struct, including the fields of
+// embedded structs as encoding/json does
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Ptr {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					addFields(embedded)
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			prop := typeSchema(field.Type, visiting)
+			if desc := field.Tag.Get("description"); desc != "" {
+				prop["description"] = desc
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				prop["enum"] = strings.Split(enum, ",")
+			}
+			properties[name] = prop
+			if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
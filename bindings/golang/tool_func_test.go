@@ -0,0 +1,99 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type weatherArgs struct {
+	City  string   `json:"city" description:"City name"`
+	Unit  string   `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days  *int     `json:"days"`
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"-"`
+}
+
+type forecast struct {
+	City string  `json:"city"`
+	Temp float64 `json:"temp"`
+}
+
+// TestToolFromFunc tests the schema and argument decoding of a function tool
+func TestToolFromFunc(t *testing.T) {
+	tool, call, err := ToolFromFunc(func(ctx context.Context, args weatherArgs) (forecast, error) {
+		if args.City == "" {
+			return forecast{}, errors.New("city is required")
+		}
+		return forecast{City: args.City, Temp: 21.5}, nil
+	}, "get_weather", "Get the weather")
+	if err != nil {
+		t.Fatalf("ToolFromFunc() error: %v", err)
+	}
+
+	params, _ := json.Marshal(tool.Function.Parameters)
+	want := `{"additionalProperties":false,"properties":{"city":{"description":"City name","type":"string"},` +
+		`"days":{"type":"integer"},"tags":{"items":{"type":"string"},"type":"array"},` +
+		`"unit":{"enum":["celsius","fahrenheit"],"type":"string"}},"required":["city"],"type":"object"}`
+	if string(params) != want {
+		t.Errorf("Parameters = %s\nwant %s", params, want)
+	}
+	if tool.Type != "function" || tool.Function.Name != "get_weather" {
+		t.Errorf("Tool = %+v", tool)
+	}
+
+	result, err := call(context.Background(), `{"city":"Paris"}`)
+	if err != nil || result != `{"city":"Paris","temp":21.5}` {
+		t.Errorf("call() = %q, %v", result, err)
+	}
+	if _, err := call(context.Background(), `{}`); err == nil || err.Error() != "city is required" {
+		t.Errorf("call() error = %v, want the function's error", err)
+	}
+	if _, err := call(context.Background(), `{"city":5}`); err == nil || !strings.HasPrefix(err.Error(), "invalid arguments") {
+		t.Errorf("call() error = %v, want invalid arguments", err)
+	}
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+// TestToolFromFuncSignatures tests the accepted and rejected function forms
+func TestToolFromFuncSignatures(t *testing.T) {
+	valid := []any{
+		func() (string, error) { return "ok", nil },
+		func(ctx context.Context) (string, error) { return "ok", nil },
+		func(args *weatherArgs) (string, error) { return args.City, nil },
+		func(args treeNode) (int, error) { return len(args.Children), nil },
+	}
+	for i, fn := range valid {
+		if _, call, err := ToolFromFunc(fn, "tool", ""); err != nil {
+			t.Errorf("valid[%d]: ToolFromFunc() error: %v", i, err)
+		} else if _, err := call(context.Background(), ""); err != nil {
+			t.Errorf("valid[%d]: call() error: %v", i, err)
+		}
+	}
+
+	invalid := []any{
+		"not a function",
+		func() string { return "" },
+		func(n int) (string, error) { return "", nil },
+		func(a, b weatherArgs) (string, error) { return "", nil },
+		func(args weatherArgs, ctx context.Context) (string, error) { return "", nil },
+	}
+	for i, fn := range invalid {
+		if _, _, err := ToolFromFunc(fn, "tool", ""); err == nil {
+			t.Errorf("invalid[%d]: ToolFromFunc() succeeded, want error", i)
+		}
+	}
+
+	// Recursive types end in an open schema rather than recursing forever
+	children := schemaOf(reflect.TypeOf(treeNode{}))["properties"].(map[string]interface{})["children"].(map[string]interface{})
+	if items := children["items"].(map[string]interface{}); len(items) != 0 {
+		t.Errorf("recursive items = %v, want {}", items)
+	}
+}
@@ -0,0 +1,454 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides an automatic tool execution loop.
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxToolSteps is the number of model calls RunTools makes when
+// RunToolsOptions.MaxSteps is not set.
+const DefaultMaxToolSteps = 10
+
+// ErrMaxToolSteps is returned by RunTools when the model still requests tool
+// calls after the maximum number of steps.
+var ErrMaxToolSteps = errors.New("tool loop exceeded maximum steps")
+
+// ToolFunc executes a tool call. arguments is the JSON object the model
+// produced; the returned string is sent back to the model as the result.
+type ToolFunc func(ctx context.Context, arguments string) (string, error)
+
+// ToolRegistry holds the function tools RunTools may execute. It is safe for
+// concurrent use.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]registeredTool
+	order []string
+}
+
+type registeredTool struct {
+	def Tool
+	fn  ToolFunc
+}
+
+// NewToolRegistry creates an empty tool registry.
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]registeredTool)}
+}
+
+// Register adds a function tool, replacing any tool with the same name.
+// parameters is the JSON schema of its arguments.
+func (r *ToolRegistry) Register(name, description string, parameters map[string]interface{}, fn ToolFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.tools[name] = registeredTool{
+		def: Tool{
+			Type:     "function",
+			Function: Function{Name: name, Description: description, Parameters: parameters},
+		},
+		fn: fn,
+	}
+}
+
+// Tools returns the definitions of the registered tools in registration
+// order, for use as ChatCompletionRequest.Tools.
+func (r *ToolRegistry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]Tool, len(r.order))
+	for i, name := range r.order {
+		tools[i] = r.tools[name].def
+	}
+	return tools
+}
+
+// RunToolsOptions controls RunTools.
+type RunToolsOptions struct {
+	// MaxSteps bounds the number of model calls. Zero means
+	// DefaultMaxToolSteps.
+	MaxSteps int
+
+	// Parallel executes the tool calls of one response concurrently rather
+	// than in order. Results are still sent to the model in call order.
+	Parallel bool
+
+	// MaxParallel, if positive, bounds the number of tool calls running at
+	// once with Parallel.
+	MaxParallel int
+
+	// ToolTimeout, if positive, bounds each tool call. The call's context is
+	// cancelled at the deadline and the call fails with an error matching
+	// context.DeadlineExceeded, even if the tool has not returned.
+	ToolTimeout time.Duration
+
+	// ToolTimeouts overrides ToolTimeout for the tools it names.
+	ToolTimeouts map[string]time.Duration
+
+	// StopOnToolError aborts the loop with the error of a failed or unknown
+	// tool. By default the error text is sent to the model as the tool
+	// result so that it can recover.
+	StopOnToolError bool
+
+	// OnToolCall, if set, is called after each tool call with its result or
+	// error. With Parallel it may be called concurrently.
+	OnToolCall func(call ToolCall, result string, err error)
+}
+
+func (o RunToolsOptions) maxSteps() int {
+	if o.MaxSteps > 0 {
+		return o.MaxSteps
+	}
+	return DefaultMaxToolSteps
+}
+
+func (o RunToolsOptions) timeout(tool string) time.Duration {
+	if timeout, ok := o.ToolTimeouts[tool]; ok {
+		return timeout
+	}
+	return o.ToolTimeout
+}
+
+// RunToolsResult is the outcome of a tool loop.
+type RunToolsResult struct {
+	// Response is the last model response: the final answer, or the response
+	// whose tool calls exceeded the maximum steps.
+	Response *ChatCompletionResponse
+	// Messages is the conversation including the request messages, every
+	// assistant turn, and every tool result.
+	Messages []ChatMessage
+	// Steps is the number of model calls made.
+	Steps int
+	// Usage is summed over all model calls.
+	Usage Usage
+}
+
+// RunTools sends req, executes the tool calls in each response with the
+// functions in registry, appends their results to the conversation, and
+// repeats until the model answers without tool calls.
+//
+// When req.Tools is empty, the registry's tools are offered. ErrMaxToolSteps
+// is returned, together with the result so far, if the model is still calling
+// tools after opts.MaxSteps calls.
+func (c *Client) RunTools(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions) (*RunToolsResult, error) {
+	return runTools(ctx, req, registry, opts, c.CreateChatCompletion)
+}
+
+// RunTools is Client.RunTools with load balancing; each step may be served by
+// a different worker.
+func (c *MultiClient) RunTools(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions) (*RunToolsResult, error) {
+	return runTools(ctx, req, registry, opts, c.CreateChatCompletion)
+}
+
+func runTools(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions,
+	complete func(context.Context, ChatCompletionRequest) (*ChatCompletionResponse, error)) (*RunToolsResult, error) {
+	if len(req.Tools) == 0 {
+		req.Tools = registry.Tools()
+	}
+	req.Messages = append([]ChatMessage(nil), req.Messages...)
+	result := &RunToolsResult{}
+
+	for {
+		resp, err := complete(ctx, req)
+		if err != nil {
+			result.Messages = req.Messages
+			return result, err
+		}
+		result.Response = resp
+		result.Steps++
+		result.Usage = addUsage(result.Usage, resp.Usage)
+
+		var message Message
+		if len(resp.Choices) > 0 {
+			message = resp.Choices[0].Message
+		}
+		req.Messages = append(req.Messages, assistantTurn(message.Content, message.ToolCalls))
+		if len(message.ToolCalls) == 0 {
+			result.Messages = req.Messages
+			return result, nil
+		}
+		if result.Steps >= opts.maxSteps() {
+			result.Messages = req.Messages
+			return result, ErrMaxToolSteps
+		}
+
+		toolMessages, err := registry.execute(ctx, message.ToolCalls, opts)
+		req.Messages = append(req.Messages, toolMessages...)
+		if err != nil {
+			result.Messages = req.Messages
+			return result, err
+		}
+	}
+}
+
+// assistantTurn is the assistant message that replays a model response
+func assistantTurn(content string, toolCalls []ToolCall) ChatMessage {
+	return ChatMessage{Role: "assistant", Content: content, ToolCalls: toolCalls}
+}
+
+func addUsage(total, u Usage) Usage {
+	sum := Usage{
+		PromptTokens:     total.PromptTokens + u.PromptTokens,
+		CompletionTokens: total.CompletionTokens + u.CompletionTokens,
+		TotalTokens:      total.TotalTokens + u.TotalTokens,
+	}
+	if cached := total.CachedTokens() + u.CachedTokens(); cached > 0 {
+		sum.PromptTokensDetails = &PromptTokensDetails{CachedTokens: cached}
+	}
+	if reasoning := total.ReasoningTokens() + u.ReasoningTokens(); reasoning > 0 {
+		sum.CompletionTokensDetails = &CompletionTokensDetails{ReasoningTokens: reasoning}
+	}
+	return sum
+}
+
+// execute runs the tool calls and returns a "tool" message answering each, in
+// call order. With StopOnToolError, the messages before the first failure are
+// returned with its error.
+func (r *ToolRegistry) execute(ctx context.Context, calls []ToolCall, opts RunToolsOptions) ([]ChatMessage, error) {
+	results := make([]string, len(calls))
+	errs := make([]error, len(calls))
+	run := func(i int) {
+		results[i], errs[i] = r.call(ctx, calls[i], opts.timeout(calls[i].Function.Name))
+		if opts.OnToolCall != nil {
+			opts.OnToolCall(calls[i], results[i], errs[i])
+		}
+	}
+
+	if opts.Parallel {
+		limit := len(calls)
+		if opts.MaxParallel > 0 && opts.MaxParallel < limit {
+			limit = opts.MaxParallel
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for i := range calls {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range calls {
+			run(i)
+			if errs[i] != nil && opts.StopOnToolError {
+				break
+			}
+		}
+	}
+
+	messages := make([]ChatMessage, 0, len(calls))
+	for i, call := range calls {
+		if errs[i] != nil {
+			if opts.StopOnToolError {
+				return messages, fmt.Errorf("tool %q: %w", call.Function.Name, errs[i])
+			}
+			results[i] = "Error: " + errs[i].Error()
+		}
+		messages = append(messages, ChatMessage{
+			Role:       "tool",
+			Content:    results[i],
+			Name:       call.Function.Name,
+			ToolCallID: call.ID,
+		})
+	}
+	return messages, nil
+}
+
+// call executes a single tool call. A panic in the tool is returned as an
+// error. With a timeout, the call is abandoned at the deadline; the tool
+// keeps running until it notices its context is done.
+func (r *ToolRegistry) call(ctx context.Context, call ToolCall, timeout time.Duration) (string, error) {
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if timeout <= 0 {
+		return safeCall(ctx, tool.fn, call.Function.Arguments)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := safeCall(ctx, tool.fn, call.Function.Arguments)
+		done <- outcome{result, err}
+	}()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+		}
+		return "", ctx.Err()
+	}
+}
+
+// safeCall calls fn, returning a panic as an error
+func safeCall(ctx context.Context, fn ToolFunc, arguments string) (result string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("tool panicked: %v", p)
+		}
+	}()
+	return fn(ctx, arguments)
+}
+
+// ToolRunStream streams the chunks of every model turn of a tool loop. When a
+// turn ends with tool calls, they are executed before the first chunk of the
+// next turn is returned.
+type ToolRunStream struct {
+	ctx      context.Context
+	req      ChatCompletionRequest
+	registry *ToolRegistry
+	opts     RunToolsOptions
+	open     func(context.Context, ChatCompletionRequest) (ChatStream, error)
+
+	current   ChatStream
+	steps     int
+	content   strings.Builder
+	toolCalls []ToolCall
+	done      bool
+}
+
+// RunToolsStream is the streaming variant of RunTools. The returned stream's
+// RecvJSON yields chat completion chunks from each model call in turn, and
+// io.EOF after the final answer. ErrMaxToolSteps and tool errors, with
+// StopOnToolError, are returned by RecvJSON.
+func (c *Client) RunToolsStream(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions) (*ToolRunStream, error) {
+	return newToolRunStream(ctx, req, registry, opts, c.CreateChatCompletionStream)
+}
+
+// RunToolsStream is Client.RunToolsStream with load balancing.
+func (c *MultiClient) RunToolsStream(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions) (*ToolRunStream, error) {
+	return newToolRunStream(ctx, req, registry, opts, c.CreateChatCompletionStream)
+}
+
+func newToolRunStream(ctx context.Context, req ChatCompletionRequest, registry *ToolRegistry, opts RunToolsOptions,
+	open func(context.Context, ChatCompletionRequest) (ChatStream, error)) (*ToolRunStream, error) {
+	if len(req.Tools) == 0 {
+		req.Tools = registry.Tools()
+	}
+	req.Messages = append([]ChatMessage(nil), req.Messages...)
+	req.Stream = true
+
+	s := &ToolRunStream{ctx: ctx, req: req, registry: registry, opts: opts, open: open}
+	if err := s.nextTurn(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// nextTurn opens the stream of the next model call
+func (s *ToolRunStream) nextTurn() error {
+	stream, err := s.open(s.ctx, s.req)
+	if err != nil {
+		return err
+	}
+	s.current = stream
+	s.steps++
+	s.content.Reset()
+	s.toolCalls = nil
+	return nil
+}
+
+// RecvJSON returns the next chunk as JSON, or io.EOF when the model has
+// answered without tool calls.
+func (s *ToolRunStream) RecvJSON() (string, error) {
+	for {
+		if s.done {
+			return "", io.EOF
+		}
+		chunkJSON, err := s.current.RecvJSON()
+		if err == nil {
+			if chunkJSON != "" {
+				s.accumulate(chunkJSON)
+			}
+			return chunkJSON, nil
+		}
+		if err != io.EOF {
+			return "", err
+		}
+
+		s.current.Close()
+		s.current = nil
+		s.req.Messages = append(s.req.Messages, assistantTurn(s.content.String(), s.toolCalls))
+		if len(s.toolCalls) == 0 {
+			s.done = true
+			return "", io.EOF
+		}
+		if s.steps >= s.opts.maxSteps() {
+			s.done = true
+			return "", ErrMaxToolSteps
+		}
+		toolMessages, err := s.registry.execute(s.ctx, s.toolCalls, s.opts)
+		s.req.Messages = append(s.req.Messages, toolMessages...)
+		if err != nil {
+			s.done = true
+			return "", err
+		}
+		if err := s.nextTurn(); err != nil {
+			s.done = true
+			return "", err
+		}
+	}
+}
+
+// accumulate records the content and tool calls of a chunk
+func (s *ToolRunStream) accumulate(chunkJSON string) {
+	var chunk ChatCompletionStreamResponse
+	if json.Unmarshal([]byte(chunkJSON), &chunk) != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		s.content.WriteString(choice.Delta.Content)
+		s.toolCalls = append(s.toolCalls, choice.Delta.ToolCalls...)
+	}
+}
+
+// Steps returns the number of model calls made so far.
+func (s *ToolRunStream) Steps() int {
+	return s.steps
+}
+
+// Messages returns the conversation so far, including every completed
+// assistant turn and tool result.
+func (s *ToolRunStream) Messages() []ChatMessage {
+	return append([]ChatMessage(nil), s.req.Messages...)
+}
+
+// Close closes the current model stream.
+func (s *ToolRunStream) Close() error {
+	s.done = true
+	if s.current != nil {
+		return s.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// weatherRegistry has a single tool that reports the weather of a city.
+func weatherRegistry() *ToolRegistry {
+	registry := NewToolRegistry()
+	registry.Register("get_weather", "Get the weather", map[string]interface{}{"type": "object"},
+		func(ctx context.Context, arguments string) (string, error) {
+			if !strings.Contains(arguments, "Paris") {
+				return "", errors.New("unknown city")
+			}
+			return "sunny", nil
+		})
+	return registry
+}
+
+func toolCallResponse(calls ...ToolCall) *ChatCompletionResponse {
+	return &ChatCompletionResponse{
+		Choices: []Choice{{Message: Message{Role: "assistant", ToolCalls: calls}, FinishReason: "tool_calls"}},
+		Usage:   Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+}
+
+func weatherCall(id, city string) ToolCall {
+	return ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"` + city + `"}`}}
+}
+
+// TestRunTools tests that tool results are fed back until a final answer
+func TestRunTools(t *testing.T) {
+	var requests []ChatCompletionRequest
+	complete := func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			return toolCallResponse(weatherCall("call_1", "Paris"), weatherCall("call_2", "Atlantis")), nil
+		}
+		return &ChatCompletionResponse{
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "It is sunny in Paris."}, FinishReason: "stop"}},
+			Usage:   Usage{PromptTokens: 30, CompletionTokens: 7, TotalTokens: 37},
+		}, nil
+	}
+
+	req := ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "Weather?"}}}
+	result, err := runTools(context.Background(), req, weatherRegistry(), RunToolsOptions{Parallel: true}, complete)
+	if err != nil {
+		t.Fatalf("runTools() error: %v", err)
+	}
+	if result.Steps != 2 || result.Usage.TotalTokens != 52 {
+		t.Errorf("Steps = %d, Usage = %+v, want 2 steps and 52 tokens", result.Steps, result.Usage)
+	}
+	if got := result.Response.Choices[0].Message.Content; got != "It is sunny in Paris." {
+		t.Errorf("final content = %q", got)
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "get_weather" {
+		t.Errorf("first request tools = %+v, want the registry's", requests[0].Tools)
+	}
+
+	var got []string
+	for _, m := range requests[1].Messages {
+		got = append(got, m.Role+":"+m.ToolCallID+":"+m.Content.(string))
+	}
+	want := []string{"user::Weather?", "assistant::", "tool:call_1:sunny", "tool:call_2:Error: unknown city"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("second request messages = %v, want %v", got, want)
+	}
+	if len(result.Messages) != 5 || len(req.Messages) != 1 {
+		t.Errorf("result has %d messages and request %d, want 5 and 1", len(result.Messages), len(req.Messages))
+	}
+}
+
+// TestRunToolsLimits tests the step limit and StopOnToolError
+func TestRunToolsLimits(t *testing.T) {
+	alwaysCall := func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return toolCallResponse(weatherCall("call_1", "Paris")), nil
+	}
+	result, err := runTools(context.Background(), ChatCompletionRequest{}, weatherRegistry(), RunToolsOptions{MaxSteps: 3}, alwaysCall)
+	if !errors.Is(err, ErrMaxToolSteps) || result.Steps != 3 {
+		t.Errorf("runTools() = %d steps, %v; want 3 steps, ErrMaxToolSteps", result.Steps, err)
+	}
+
+	unknownCity := func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return toolCallResponse(weatherCall("call_1", "Atlantis")), nil
+	}
+	_, err = runTools(context.Background(), ChatCompletionRequest{}, weatherRegistry(), RunToolsOptions{StopOnToolError: true}, unknownCity)
+	if err == nil || !strings.Contains(err.Error(), "unknown city") {
+		t.Errorf("runTools() error = %v, want the tool's error", err)
+	}
+}
+
+// TestToolRunStream tests that the stream runs tools between model turns
+func TestToolRunStream(t *testing.T) {
+	turns := [][]string{
+		{
+			`{"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		},
+		{
+			`{"choices":[{"index":0,"delta":{"content":"Sunny"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"."},"finish_reason":"stop"}]}`,
+		},
+	}
+	var opened []ChatCompletionRequest
+	open := func(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+		opened = append(opened, req)
+		return &fakeChatStream{chunks: turns[len(opened)-1]}, nil
+	}
+
+	req := ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "Weather?"}}}
+	stream, err := newToolRunStream(context.Background(), req, weatherRegistry(), RunToolsOptions{}, open)
+	if err != nil {
+		t.Fatalf("newToolRunStream() error: %v", err)
+	}
+	defer stream.Close()
+
+	chunks := 0
+	for {
+		_, err := stream.RecvJSON()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("RecvJSON() error: %v", err)
+		}
+		chunks++
+	}
+	if chunks != 4 || stream.Steps() != 2 {
+		t.Errorf("got %d chunks in %d steps, want 4 in 2", chunks, stream.Steps())
+	}
+	if !opened[1].Stream || len(opened[1].Messages) != 3 || opened[1].Messages[2].Content != "sunny" {
+		t.Errorf("second turn request = %+v", opened[1])
+	}
+	messages := stream.Messages()
+	if last := messages[len(messages)-1]; last.Role != "assistant" || last.Content != "Sunny." {
+		t.Errorf("last message = %+v, want the final answer", last)
+	}
+}
+
+// TestExecuteParallel tests concurrent tool calls with a concurrency bound,
+// per-tool timeouts, and panic recovery
+func TestExecuteParallel(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	registry := NewToolRegistry()
+	registry.Register("slow", "", nil, func(ctx context.Context, arguments string) (string, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "done " + arguments, nil
+	})
+	registry.Register("hang", "", nil, func(ctx context.Context, arguments string) (string, error) {
+		// Ignores its context, so the call must be abandoned
+		time.Sleep(time.Second)
+		return "late", nil
+	})
+	registry.Register("crash", "", nil, func(ctx context.Context, arguments string) (string, error) {
+		panic("boom")
+	})
+
+	call := func(id, name string) ToolCall {
+		return ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: name, Arguments: id}}
+	}
+	calls := []ToolCall{call("1", "slow"), call("2", "hang"), call("3", "slow"), call("4", "crash"), call("5", "slow")}
+	start := time.Now()
+	messages, err := registry.execute(context.Background(), calls, RunToolsOptions{
+		Parallel:     true,
+		MaxParallel:  2,
+		ToolTimeout:  time.Second,
+		ToolTimeouts: map[string]time.Duration{"hang": 30 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("execute() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("execute() took %v, want the hanging tool abandoned", elapsed)
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d tools ran at once, want at most 2", maxRunning)
+	}
+
+	want := []string{"done 1", "Error: timed out after 30ms: context deadline exceeded", "done 3", "Error: tool panicked: boom", "done 5"}
+	for i, msg := range messages {
+		if msg.ToolCallID != calls[i].ID || msg.Content != want[i] {
+			t.Errorf("messages[%d] = %s %v, want %s %q", i, msg.ToolCallID, msg.Content, calls[i].ID, want[i])
+		}
+	}
+}
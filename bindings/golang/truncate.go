@@ -0,0 +1,163 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides token-budget truncation of chat history.
+package smg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPromptTooLong is returned by TruncateMessages when the messages cannot be
+// made to fit the token budget without dropping messages the strategy must keep.
+var ErrPromptTooLong = errors.New("prompt exceeds token budget")
+
+// TruncationStrategy controls which messages TruncateMessages removes when the
+// conversation exceeds the token budget.
+//
+// Messages are always removed oldest first and the final message is never
+// removed. Tool result messages are removed together with the assistant turn
+// that requested them so the history stays well-formed.
+type TruncationStrategy struct {
+	// KeepSystem preserves leading system and developer messages. When false
+	// they are removed like any other message.
+	KeepSystem bool
+
+	// Summarize, if set, is called with the removed messages and its result is
+	// inserted in their place (after any kept system messages). It is called
+	// once the messages to remove are found by counting tokens, and again,
+	// with more messages, only if the summary itself does not fit.
+	Summarize func(dropped []ChatMessage) (ChatMessage, error)
+}
+
+// DropOldest returns a strategy that removes the oldest messages, including
+// system messages, until the conversation fits.
+func DropOldest() TruncationStrategy {
+	return TruncationStrategy{}
+}
+
+// KeepSystem returns a strategy that removes the oldest non-system messages
+// until the conversation fits, preserving leading system messages.
+func KeepSystem() TruncationStrategy {
+	return TruncationStrategy{KeepSystem: true}
+}
+
+// SummarizeDropped returns a strategy that preserves leading system messages
+// and replaces removed history with the message produced by summarize.
+func SummarizeDropped(summarize func(dropped []ChatMessage) (ChatMessage, error)) TruncationStrategy {
+	return TruncationStrategy{KeepSystem: true, Summarize: summarize}
+}
+
+// TruncateMessages returns the longest suffix of messages (plus any messages
+// the strategy keeps) whose templated prompt is at most maxPromptTokens
+// tokens, counted with this tokenizer exactly as the backend counts them.
+//
+// The input slice is not modified. ErrPromptTooLong is returned if the
+// messages the strategy must keep already exceed the budget.
+func (t *Tokenizer) TruncateMessages(messages []ChatMessage, maxPromptTokens int, strategy TruncationStrategy) ([]ChatMessage, error) {
+	return truncateMessages(messages, maxPromptTokens, strategy, func(msgs []ChatMessage) (int, error) {
+		return t.CountPromptTokens(ChatCompletionRequest{Messages: msgs})
+	})
+}
+
+// truncateMessages implements TruncateMessages against an arbitrary token
+// counter so the selection logic does not depend on the FFI layer.
+func truncateMessages(messages []ChatMessage, maxPromptTokens int, strategy TruncationStrategy, count func([]ChatMessage) (int, error)) ([]ChatMessage, error) {
+	if maxPromptTokens <= 0 {
+		return nil, fmt.Errorf("maxPromptTokens must be positive, got %d", maxPromptTokens)
+	}
+	if len(messages) == 0 {
+		return []ChatMessage{}, nil
+	}
+
+	fits := func(msgs []ChatMessage) (bool, error) {
+		n, err := count(msgs)
+		if err != nil {
+			return false, fmt.Errorf("failed to count prompt tokens: %w", err)
+		}
+		return n <= maxPromptTokens, nil
+	}
+
+	ok, err := fits(messages)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return append([]ChatMessage(nil), messages...), nil
+	}
+
+	// pinned is the number of leading system messages that must be kept.
+	pinned := 0
+	if strategy.KeepSystem {
+		for pinned < len(messages)-1 && isInstruction(messages[pinned].Role) {
+			pinned++
+		}
+	}
+	head := messages[:pinned]
+	body := messages[pinned : len(messages)-1]
+	last := messages[len(messages)-1]
+
+	// Candidate cut points: dropping body[:k] for each k in cuts. A cut never
+	// lands on a tool message so tool results are dropped with their call.
+	cuts := make([]int, 0, len(body))
+	for k := 1; k <= len(body); k++ {
+		if k < len(body) && body[k].Role == "tool" {
+			continue
+		}
+		cuts = append(cuts, k)
+	}
+
+	build := func(k int, summary *ChatMessage) []ChatMessage {
+		out := make([]ChatMessage, 0, len(head)+len(body)-k+2)
+		out = append(out, head...)
+		if summary != nil {
+			out = append(out, *summary)
+		}
+		out = append(out, body[k:]...)
+		return append(out, last)
+	}
+
+	// Find the first cut that fits by counting tokens alone, then summarize
+	// what it drops. A summary that does not fit stays in place while the
+	// search moves on, and is redone for the next cut that fits with it.
+	var summary *ChatMessage
+	for _, k := range cuts {
+		candidate := build(k, summary)
+		ok, err := fits(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if strategy.Summarize == nil {
+			return candidate, nil
+		}
+		msg, err := strategy.Summarize(append([]ChatMessage(nil), body[:k]...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize dropped messages: %w", err)
+		}
+		summary = &msg
+		candidate = build(k, summary)
+		if ok, err = fits(candidate); err != nil {
+			return nil, err
+		}
+		if ok {
+			return candidate, nil
+		}
+	}
+
+	// Everything droppable is gone; try without a summary as a last resort.
+	if strategy.Summarize != nil {
+		candidate := build(len(body), nil)
+		ok, err := fits(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return candidate, nil
+		}
+	}
+
+	return nil, ErrPromptTooLong
+}
@@ -0,0 +1,129 @@
+package smg
+
+import (
+	"errors"
+	"testing"
+)
+
+// countChars is a stand-in token counter: one token per content byte.
+func countChars(msgs []ChatMessage) (int, error) {
+	n := 0
+	for _, m := range msgs {
+		if s, ok := m.Content.(string); ok {
+			n += len(s)
+		}
+	}
+	return n, nil
+}
+
+func roles(msgs []ChatMessage) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Role + ":" + m.Content.(string)
+	}
+	return out
+}
+
+// TestTruncateMessages tests the selection logic of each truncation strategy
+func TestTruncateMessages(t *testing.T) {
+	history := []ChatMessage{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "aaaa"},
+		{Role: "assistant", Content: "bbbb"},
+		{Role: "tool", Content: "cc"},
+		{Role: "user", Content: "dddd"},
+		{Role: "assistant", Content: "eeee"},
+		{Role: "user", Content: "ff"},
+	}
+
+	tests := []struct {
+		name     string
+		max      int
+		strategy TruncationStrategy
+		want     []string
+		wantErr  error
+	}{
+		{
+			name:     "fits unchanged",
+			max:      100,
+			strategy: DropOldest(),
+			want:     roles(history),
+		},
+		{
+			name:     "drop oldest removes system",
+			max:      10,
+			strategy: DropOldest(),
+			want:     []string{"user:dddd", "assistant:eeee", "user:ff"},
+		},
+		{
+			name:     "keep system",
+			max:      13,
+			strategy: KeepSystem(),
+			want:     []string{"system:sys", "user:dddd", "assistant:eeee", "user:ff"},
+		},
+		{
+			name:     "tool results dropped with their call",
+			max:      17,
+			strategy: KeepSystem(),
+			want:     []string{"system:sys", "user:dddd", "assistant:eeee", "user:ff"},
+		},
+		{
+			name: "summarize",
+			max:  16,
+			strategy: SummarizeDropped(func(dropped []ChatMessage) (ChatMessage, error) {
+				return ChatMessage{Role: "system", Content: "sum"}, nil
+			}),
+			want: []string{"system:sys", "system:sum", "user:dddd", "assistant:eeee", "user:ff"},
+		},
+		{
+			name:     "last message too long",
+			max:      1,
+			strategy: DropOldest(),
+			wantErr:  ErrPromptTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := truncateMessages(history, tt.max, tt.strategy, countChars)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("truncateMessages() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("truncateMessages() unexpected error: %v", err)
+			}
+			gotRoles := roles(got)
+			if len(gotRoles) != len(tt.want) {
+				t.Fatalf("truncateMessages() = %v, want %v", gotRoles, tt.want)
+			}
+			for i := range gotRoles {
+				if gotRoles[i] != tt.want[i] {
+					t.Fatalf("truncateMessages() = %v, want %v", gotRoles, tt.want)
+				}
+			}
+		})
+	}
+
+	if len(history) != 7 || history[0].Content != "sys" {
+		t.Error("truncateMessages() modified its input")
+	}
+
+	var summarized []int
+	summarize := SummarizeDropped(func(dropped []ChatMessage) (ChatMessage, error) {
+		summarized = append(summarized, len(dropped))
+		return ChatMessage{Role: "system", Content: "summary"}, nil
+	})
+	got, err := truncateMessages(history, 16, summarize, countChars)
+	if err != nil || len(got) != 4 || got[1].Content != "summary" || len(summarized) != 2 || summarized[0] != 3 || summarized[1] != 4 {
+		t.Errorf("truncateMessages() = %v, %v after summarizing %v, want summaries of 3 then 4 messages", got, err, summarized)
+	}
+
+	developer := []ChatMessage{SystemText("sys"), DeveloperText("dev"), UserText("aaaa"), AssistantText("bbbb"), UserText("cc")}
+	got, err = truncateMessages(developer, 8, KeepSystem(), countChars)
+	if err != nil || len(got) != 3 || got[1].Role != "developer" {
+		t.Errorf("truncateMessages() with a developer message = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides vector math for embeddings.
+package smg
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// The loops below are unrolled by four with independent accumulators, which
+// lets the compiler keep four lanes in flight and avoids a serial dependency
+// on one sum.
+
+// Dot returns the dot product of a and b, which must have the same length.
+func Dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		panic("smg: vectors of different lengths")
+	}
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		// Reslicing lets the compiler drop the bounds checks
+		x, y := a[i:i+4:i+4], b[i:i+4:i+4]
+		s0 += x[0] * y[0]
+		s1 += x[1] * y[1]
+		s2 += x[2] * y[2]
+		s3 += x[3] * y[3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+// Norm returns the Euclidean length of v.
+func Norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(Dot(v, v))))
+}
+
+// Normalize scales v in place to unit length and returns it. A zero vector is
+// left unchanged. The dot product of normalized vectors is their cosine
+// similarity, so normalizing a corpus once makes each comparison a Dot.
+func Normalize(v []float32) []float32 {
+	norm := Norm(v)
+	if norm == 0 {
+		return v
+	}
+	scale := 1 / norm
+	for i := range v {
+		v[i] *= scale
+	}
+	return v
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, from -1
+// to 1, or 0 if either is a zero vector. a and b must have the same length.
+func CosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		panic("smg: vectors of different lengths")
+	}
+	var dot, na, nb [4]float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		x, y := a[i:i+4:i+4], b[i:i+4:i+4]
+		for j := 0; j < 4; j++ {
+			dot[j] += x[j] * y[j]
+			na[j] += x[j] * x[j]
+			nb[j] += y[j] * y[j]
+		}
+	}
+	for ; i < len(a); i++ {
+		dot[0] += a[i] * b[i]
+		na[0] += a[i] * a[i]
+		nb[0] += b[i] * b[i]
+	}
+	sumDot := (dot[0] + dot[1]) + (dot[2] + dot[3])
+	sumA := (na[0] + na[1]) + (na[2] + na[3])
+	sumB := (nb[0] + nb[1]) + (nb[2] + nb[3])
+	if sumA == 0 || sumB == 0 {
+		return 0
+	}
+	return float32(float64(sumDot) / math.Sqrt(float64(sumA)*float64(sumB)))
+}
+
+// VectorMatch is a vector of a corpus and its score against a query.
+type VectorMatch struct {
+	// Index is the position of the vector in the corpus
+	Index int
+	Score float32
+}
+
+// TopK returns the k vectors of corpus most similar to query by cosine
+// similarity, best first. Ties are broken by index. It returns fewer than k
+// matches if the corpus is smaller.
+func TopK(query []float32, corpus [][]float32, k int) []VectorMatch {
+	return topK(len(corpus), k, func(i int) float32 { return CosineSimilarity(query, corpus[i]) })
+}
+
+// TopKDot is TopK scored by dot product, for a normalized query and corpus,
+// where it gives the same order without computing norms.
+func TopKDot(query []float32, corpus [][]float32, k int) []VectorMatch {
+	return topK(len(corpus), k, func(i int) float32 { return Dot(query, corpus[i]) })
+}
+
+// topK keeps the k best scores in a min-heap, so that a large corpus takes
+// O(n log k) time and O(k) space
+func topK(n, k int, score func(i int) float32) []VectorMatch {
+	if k <= 0 || n == 0 {
+		return nil
+	}
+	if k > n {
+		k = n
+	}
+	h := make(matchHeap, 0, k)
+	for i := 0; i < n; i++ {
+		m := VectorMatch{Index: i, Score: score(i)}
+		if len(h) < k {
+			heap.Push(&h, m)
+		} else if ranksBefore(m, h[0]) {
+			h[0] = m
+			heap.Fix(&h, 0)
+		}
+	}
+	matches := []VectorMatch(h)
+	sort.Slice(matches, func(i, j int) bool { return ranksBefore(matches[i], matches[j]) })
+	return matches
+}
+
+// ranksBefore reports whether a ranks before b
+func ranksBefore(a, b VectorMatch) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Index < b.Index
+}
+
+// matchHeap is a min-heap with the worst match at the root
+type matchHeap []VectorMatch
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return ranksBefore(h[j], h[i]) }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(VectorMatch)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
@@ -0,0 +1,78 @@
+package smg
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-5
+}
+
+// TestVectorMath tests Dot, Norm, Normalize, and CosineSimilarity, including
+// lengths that are not a multiple of the unrolled width
+func TestVectorMath(t *testing.T) {
+	a := []float32{1, 2, 3, 4, 5}
+	b := []float32{5, 4, 3, 2, 1}
+	if got := Dot(a, b); got != 35 {
+		t.Errorf("Dot() = %v, want 35", got)
+	}
+	if got := Norm([]float32{3, 4}); got != 5 {
+		t.Errorf("Norm() = %v, want 5", got)
+	}
+	if got := CosineSimilarity(a, b); !approxEqual(got, 35.0/55) {
+		t.Errorf("CosineSimilarity() = %v, want %v", got, 35.0/55)
+	}
+	if got := CosineSimilarity(a, []float32{-1, -2, -3, -4, -5}); !approxEqual(got, -1) {
+		t.Errorf("CosineSimilarity(opposite) = %v, want -1", got)
+	}
+	if got := CosineSimilarity(a, make([]float32, 5)); got != 0 {
+		t.Errorf("CosineSimilarity(zero) = %v, want 0", got)
+	}
+
+	v := Normalize([]float32{3, 0, 4})
+	if !approxEqual(v[0], 0.6) || v[1] != 0 || !approxEqual(v[2], 0.8) || !approxEqual(Norm(v), 1) {
+		t.Errorf("Normalize() = %v", v)
+	}
+	if zero := Normalize(make([]float32, 3)); zero[0] != 0 {
+		t.Errorf("Normalize(zero) = %v", zero)
+	}
+	if got, want := Dot(Normalize(append([]float32(nil), a...)), Normalize(append([]float32(nil), b...))), CosineSimilarity(a, b); !approxEqual(got, want) {
+		t.Errorf("Dot of normalized = %v, want cosine %v", got, want)
+	}
+}
+
+// TestTopK tests ranking, tie-breaking, and k larger than the corpus
+func TestTopK(t *testing.T) {
+	corpus := [][]float32{
+		{0, 1},
+		{1, 0},
+		{1, 1},
+		{-1, 0},
+		{2, 0},
+	}
+	got := TopK([]float32{1, 0}, corpus, 3)
+	// {1, 0} and {2, 0} tie at 1 and are ordered by index
+	want := []int{1, 4, 2}
+	if len(got) != len(want) {
+		t.Fatalf("TopK() = %+v, want indices %v", got, want)
+	}
+	for i, m := range got {
+		if m.Index != want[i] {
+			t.Errorf("TopK()[%d] = %+v, want index %d", i, m, want[i])
+		}
+	}
+	if !approxEqual(got[2].Score, float32(1/math.Sqrt2)) {
+		t.Errorf("TopK()[2].Score = %v", got[2].Score)
+	}
+
+	if all := TopK([]float32{1, 0}, corpus, 10); len(all) != 5 || all[4].Index != 3 {
+		t.Errorf("TopK(k > n) = %+v", all)
+	}
+	if none := TopK([]float32{1, 0}, corpus, 0); none != nil {
+		t.Errorf("TopK(k = 0) = %+v, want nil", none)
+	}
+	if dot := TopKDot([]float32{1, 0}, corpus, 1); dot[0].Index != 4 || dot[0].Score != 2 {
+		t.Errorf("TopKDot() = %+v, want index 4 with score 2", dot)
+	}
+}
@@ -0,0 +1,156 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file aborts generations that stop producing output.
+package smg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultStallTimeout is the longest gap between chunks WithWatchdog allows
+// when WatchdogOptions.StallTimeout is not set.
+const DefaultStallTimeout = 30 * time.Second
+
+// ErrStalled is matched, with errors.Is, by the error returned when a
+// generation produces no output within the watchdog's timeout.
+var ErrStalled = errors.New("generation stalled")
+
+// WatchdogOptions controls WithWatchdog.
+type WatchdogOptions struct {
+	// FirstChunkTimeout, if positive, bounds the wait for the first chunk,
+	// which includes queueing and prefill of a long prompt.
+	FirstChunkTimeout time.Duration
+	// StallTimeout bounds the wait for each chunk after the first. Defaults
+	// to DefaultStallTimeout.
+	StallTimeout time.Duration
+	// Retries is the number of times a stalled generation is restarted. A
+	// stream is restarted only while none of its chunks has been returned;
+	// a non-streaming request is restarted at any point.
+	Retries int
+}
+
+// WithWatchdog returns a middleware that aborts generations that stall, so
+// that a hung backend does not hold a caller, and the connection it serves,
+// forever. A stalled stream is closed, cancelling the generation, and
+// RecvJSON returns an error matching ErrStalled. Non-streaming requests are
+// sent as streams and aggregated, so that their progress can be watched too.
+func WithWatchdog(opts WatchdogOptions) ChatMiddleware {
+	if opts.StallTimeout <= 0 {
+		opts.StallTimeout = DefaultStallTimeout
+	}
+	return func(next ChatClient) ChatClient {
+		return &watchdogClient{next: next, opts: opts}
+	}
+}
+
+type watchdogClient struct {
+	next ChatClient
+	opts WatchdogOptions
+}
+
+func (c *watchdogClient) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req.Stream = true
+	req.StreamOptions = withUsage()
+	for attempt := 0; ; attempt++ {
+		stream, err := c.open(ctx, req, 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := collectChatCompletion(stream)
+		stream.Close()
+		if errors.Is(err, ErrStalled) && attempt < c.opts.Retries {
+			continue
+		}
+		return resp, err
+	}
+}
+
+func (c *watchdogClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	return c.open(ctx, req, c.opts.Retries)
+}
+
+// open opens a watched stream that may be restarted retries times
+func (c *watchdogClient) open(ctx context.Context, req ChatCompletionRequest, retries int) (ChatStream, error) {
+	stream, err := c.next.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &watchdogStream{ChatStream: stream, ctx: ctx, req: req, client: c, retries: retries}, nil
+}
+
+// watchdogStream times each RecvJSON of the embedded stream
+type watchdogStream struct {
+	ChatStream
+	ctx     context.Context
+	req     ChatCompletionRequest
+	client  *watchdogClient
+	retries int
+	// started is set once a chunk has been returned
+	started bool
+	err     error
+}
+
+type recvResult struct {
+	chunk string
+	err   error
+}
+
+func (s *watchdogStream) RecvJSON() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	for {
+		timeout := s.client.opts.StallTimeout
+		if !s.started {
+			timeout = s.client.opts.FirstChunkTimeout
+		}
+		if timeout <= 0 {
+			chunk, err := s.ChatStream.RecvJSON()
+			s.started = s.started || err == nil
+			return chunk, err
+		}
+
+		// The receive is abandoned at the deadline; closing the stream
+		// unblocks it
+		stream := s.ChatStream
+		done := make(chan recvResult, 1)
+		go func() {
+			chunk, err := stream.RecvJSON()
+			done <- recvResult{chunk, err}
+		}()
+		timer := time.NewTimer(timeout)
+		select {
+		case r := <-done:
+			timer.Stop()
+			s.started = s.started || r.err == nil
+			return r.chunk, r.err
+		case <-timer.C:
+		}
+
+		stream.Close()
+		if s.started || s.retries <= 0 {
+			s.err = fmt.Errorf("%w: no output for %s", ErrStalled, timeout)
+			return "", s.err
+		}
+		s.retries--
+		next, err := s.client.next.CreateChatCompletionStream(s.ctx, s.req)
+		if err != nil {
+			s.err = err
+			return "", err
+		}
+		s.ChatStream = next
+	}
+}
+
+// Close closes the underlying stream; after a stall it is already closed.
+func (s *watchdogStream) Close() error {
+	if s.err != nil {
+		return nil
+	}
+	s.err = io.EOF
+	return s.ChatStream.Close()
+}
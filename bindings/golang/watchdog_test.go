@@ -0,0 +1,233 @@
+package smg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowStream returns its chunks after their delays; a negative delay hangs
+// until the stream is closed
+type slowStream struct {
+	chunks []string
+	delays []time.Duration
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newSlowStream(chunks []string, delays ...time.Duration) *slowStream {
+	return &slowStream{chunks: chunks, delays: delays, closed: make(chan struct{})}
+}
+
+func (s *slowStream) RecvJSON() (string, error) {
+	if len(s.chunks) == 0 {
+		return "", io.EOF
+	}
+	delay := s.delays[0]
+	if delay < 0 {
+		<-s.closed
+		return "", errors.New("closed")
+	}
+	select {
+	case <-time.After(delay):
+	case <-s.closed:
+		return "", errors.New("closed")
+	}
+	chunk := s.chunks[0]
+	s.chunks, s.delays = s.chunks[1:], s.delays[1:]
+	return chunk, nil
+}
+
+func (s *slowStream) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// sequenceClient opens its streams in turn
+type sequenceClient struct {
+	scriptedClient
+	mu      sync.Mutex
+	streams []*slowStream
+	opened  int
+}
+
+func (c *sequenceClient) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatStream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stream := c.streams[c.opened]
+	c.opened++
+	return stream, nil
+}
+
+const (
+	helloChunk = `{"choices":[{"index":0,"delta":{"content":"Hello"}}]}`
+	stopChunk  = `{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
+)
+
+// TestWatchdogStream tests that a stream stalling after its first chunk is
+// closed and fails with ErrStalled
+func TestWatchdogStream(t *testing.T) {
+	inner := newSlowStream([]string{helloChunk, stopChunk}, 0, -1)
+	client := WithWatchdog(WatchdogOptions{StallTimeout: 20 * time.Millisecond, Retries: 1})(&sequenceClient{streams: []*slowStream{inner}})
+
+	stream, err := client.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	if chunk, err := stream.RecvJSON(); err != nil || chunk != helloChunk {
+		t.Fatalf("first RecvJSON() = %q, %v", chunk, err)
+	}
+	if _, err := stream.RecvJSON(); !errors.Is(err, ErrStalled) {
+		t.Fatalf("second RecvJSON() error = %v, want ErrStalled", err)
+	}
+	select {
+	case <-inner.closed:
+	default:
+		t.Error("stalled stream was not closed")
+	}
+	if _, err := stream.RecvJSON(); !errors.Is(err, ErrStalled) {
+		t.Errorf("RecvJSON() after stall error = %v, want ErrStalled", err)
+	}
+}
+
+// TestWatchdogRetry tests that a generation stalled before its first chunk
+// is restarted, for streams and non-streaming requests
+func TestWatchdogRetry(t *testing.T) {
+	opts := WatchdogOptions{FirstChunkTimeout: 20 * time.Millisecond, StallTimeout: time.Second, Retries: 1}
+
+	inner := &sequenceClient{streams: []*slowStream{
+		newSlowStream([]string{helloChunk}, -1),
+		newSlowStream([]string{helloChunk, stopChunk}, 0, 0),
+	}}
+	stream, err := WithWatchdog(opts)(inner).CreateChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream() error: %v", err)
+	}
+	if chunk, err := stream.RecvJSON(); err != nil || chunk != helloChunk || inner.opened != 2 {
+		t.Errorf("RecvJSON() = %q, %v after %d opens, want the retried stream", chunk, err, inner.opened)
+	}
+
+	// Non-streaming requests restart even after output
+	inner = &sequenceClient{streams: []*slowStream{
+		newSlowStream([]string{helloChunk, stopChunk}, 0, -1),
+		newSlowStream([]string{helloChunk, stopChunk}, 0, 0),
+	}}
+	resp, err := WithWatchdog(WatchdogOptions{StallTimeout: 20 * time.Millisecond, Retries: 1})(inner).CreateChatCompletion(context.Background(), ChatCompletionRequest{})
+	if err != nil || resp.Choices[0].Message.Content != "Hello" || inner.opened != 2 {
+		t.Errorf("CreateChatCompletion() = %+v, %v after %d opens", resp, err, inner.opened)
+	}
+
+	inner = &sequenceClient{streams: []*slowStream{newSlowStream([]string{helloChunk, stopChunk}, 0, -1)}}
+	if _, err := WithWatchdog(WatchdogOptions{StallTimeout: 20 * time.Millisecond})(inner).CreateChatCompletion(context.Background(), ChatCompletionRequest{}); !errors.Is(err, ErrStalled) {
+		t.Errorf("CreateChatCompletion() error = %v, want ErrStalled", err)
+	}
+}
+
+// ffiHandle models an ffi.SglangStreamHandle: a read holds the Rust stream
+// lock until a chunk arrives or the stream is aborted, and Free takes the
+// lock, so freeing under a read blocks until the read returns
+type ffiHandle struct {
+	lock      sync.Mutex
+	chunks    chan string
+	abort     chan struct{}
+	abortOnce sync.Once
+	freed     chan struct{}
+}
+
+func newFFIHandle(chunks ...string) *ffiHandle {
+	h := &ffiHandle{chunks: make(chan string, len(chunks)), abort: make(chan struct{}), freed: make(chan struct{})}
+	for _, chunk := range chunks {
+		h.chunks <- chunk
+	}
+	return h
+}
+
+func (h *ffiHandle) ReadNext() (string, bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	select {
+	case <-h.freed:
+		return "", true, errors.New("stream handle is nil")
+	default:
+	}
+	select {
+	case chunk := <-h.chunks:
+		return chunk, false, nil
+	case <-h.abort:
+		return "", true, errors.New("Stream aborted")
+	}
+}
+
+func (h *ffiHandle) Abort() {
+	h.abortOnce.Do(func() { close(h.abort) })
+}
+
+func (h *ffiHandle) Free() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	select {
+	case <-h.freed:
+	default:
+		close(h.freed)
+	}
+}
+
+// TestWatchdogFFIStream tests that a MultiClient stream stalled inside a
+// read is aborted, and its handle freed, without waiting for the backend
+func TestWatchdogFFIStream(t *testing.T) {
+	handle := newFFIHandle(helloChunk)
+	inner := newMultiClientStream(context.Background(), handle, func() {}, usageFilter{}, nil)
+	stream, err := WithWatchdog(WatchdogOptions{StallTimeout: 20 * time.Millisecond})(&streamClient{stream: inner}).CreateChatCompletionStream(context.Background(), ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.RecvJSON(); err != nil {
+		t.Fatalf("first RecvJSON() error: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.RecvJSON()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStalled) {
+			t.Errorf("RecvJSON() error = %v, want ErrStalled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the stalled stream blocked on the read")
+	}
+	select {
+	case <-handle.freed:
+	default:
+		t.Error("the handle was not freed")
+	}
+}
+
+// TestMultiClientStreamCancel tests that cancelling the context ends a read
+// blocked on the backend
+func TestMultiClientStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handle := newFFIHandle()
+	stream := newMultiClientStream(ctx, handle, func() {}, usageFilter{}, nil)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.RecvJSON()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("RecvJSON() returned no error after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel did not end the read")
+	}
+	stream.Close()
+}
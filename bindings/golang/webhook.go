@@ -0,0 +1,233 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file provides webhook notifications of finished completion jobs.
+package smg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of webhook deliveries.
+const (
+	// WebhookSignatureHeader carries the signature checked by
+	// VerifyWebhookSignature, "t=<unix seconds>,v1=<hex HMAC-SHA256>"
+	WebhookSignatureHeader = "X-SMG-Signature"
+	// WebhookJobIDHeader carries the job ID, which receivers can use to
+	// ignore repeated deliveries
+	WebhookJobIDHeader = "X-SMG-Job-ID"
+)
+
+// Defaults of WebhookOptions.
+const (
+	DefaultWebhookAttempts = 5
+	DefaultWebhookBackoff  = time.Second
+	DefaultWebhookTimeout  = 10 * time.Second
+)
+
+// ErrInvalidSignature is matched, with errors.Is, by the error
+// VerifyWebhookSignature returns for a delivery that was not signed with the
+// secret, or was signed too long ago.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// WebhookOptions controls the delivery of job results to the webhooks given
+// to JobRunner.SubmitCompletionWithWebhook.
+type WebhookOptions struct {
+	// Secret signs each delivery with HMAC-SHA256 in the
+	// WebhookSignatureHeader. Deliveries are unsigned if it is empty.
+	Secret []byte
+	// MaxAttempts is the maximum number of attempts per delivery. Defaults to
+	// DefaultWebhookAttempts.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles for each later
+	// retry, up to MaxBackoff if set. Defaults to DefaultWebhookBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt. Defaults to DefaultWebhookTimeout.
+	Timeout time.Duration
+	// Client sends the requests; defaults to http.DefaultClient
+	Client *http.Client
+	// OnError, if set, is called when a delivery fails for good. Defaults to
+	// logging with the log package.
+	OnError func(jobID string, err error)
+}
+
+// JobNotification is the JSON body posted to the webhook of a job when it
+// finishes.
+type JobNotification struct {
+	JobID    string                  `json:"job_id"`
+	Status   JobStatus               `json:"status"`
+	Response *ChatCompletionResponse `json:"response,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+	// Attempts is the number of requests the job made
+	Attempts   int       `json:"attempts"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// SubmitCompletionWithWebhook submits req like SubmitCompletion, and posts a
+// JobNotification to webhookURL when the job finishes, so that the caller
+// need not poll. Failed deliveries are retried with backoff as configured by
+// JobOptions.Webhook; 4xx responses other than 429 are not retried. Close
+// stops deliveries in progress.
+func (r *JobRunner) SubmitCompletionWithWebhook(ctx context.Context, req ChatCompletionRequest, webhookURL string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", invalidRequest(fmt.Sprintf("invalid webhook URL %q", webhookURL))
+	}
+	return r.submit(ctx, req, webhookURL)
+}
+
+// notify delivers the outcome of job to webhookURL
+func (r *JobRunner) notify(job CompletionJob, webhookURL string) {
+	n := JobNotification{
+		JobID:      job.ID,
+		Status:     job.Status,
+		Response:   job.Response,
+		Attempts:   job.Attempts,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Err != nil {
+		n.Error = job.Err.Error()
+	}
+	opts := r.opts.Webhook
+	if err := deliverWebhook(r.ctx, webhookURL, n, opts); err != nil {
+		if opts.OnError != nil {
+			opts.OnError(job.ID, err)
+		} else {
+			log.Printf("smg: delivering job %s to webhook: %v", job.ID, err)
+		}
+	}
+}
+
+// deliverWebhook posts n to webhookURL until it is accepted, the attempts
+// run out, or ctx is done
+func deliverWebhook(ctx context.Context, webhookURL string, n JobNotification, opts WebhookOptions) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultWebhookAttempts
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := postWebhook(ctx, webhookURL, n.JobID, body, opts)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= attempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		backoff *= 2
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
+	}
+}
+
+// postWebhook makes one delivery attempt and reports whether a failure is
+// worth retrying
+func postWebhook(ctx context.Context, webhookURL, jobID string, body []byte, opts WebhookOptions) (bool, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookJobIDHeader, jobID)
+	if len(opts.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, signWebhook(opts.Secret, time.Now(), body))
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// signWebhook returns the signature header of body sent at t
+func signWebhook(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, body)
+}
+
+func webhookMAC(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the WebhookSignatureHeader of a delivery,
+// for receivers of job webhooks. A positive tolerance also rejects
+// deliveries signed longer ago, which limits replays.
+//
+//	body, _ := io.ReadAll(r.Body)
+//	err := smg.VerifyWebhookSignature(secret, r.Header.Get(smg.WebhookSignatureHeader), body, 5*time.Minute)
+func VerifyWebhookSignature(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var ts, signature string
+	for _, field := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || signature == "" {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(signature), []byte(webhookMAC(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("%w: signed %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+	return nil
+}
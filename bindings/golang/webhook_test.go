@@ -0,0 +1,162 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestJobWebhook tests signed delivery of a job result, retrying failures
+func TestJobWebhook(t *testing.T) {
+	secret := []byte("s3cret")
+	var calls int32
+	delivered := make(chan JobNotification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := VerifyWebhookSignature(secret, r.Header.Get(WebhookSignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("VerifyWebhookSignature() error: %v", err)
+		}
+		var n JobNotification
+		if err := json.Unmarshal(body, &n); err != nil || r.Header.Get(WebhookJobIDHeader) != n.JobID {
+			t.Errorf("delivery %s = %+v, %v", r.Header.Get(WebhookJobIDHeader), n, err)
+		}
+		delivered <- n
+	}))
+	defer server.Close()
+
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{ID: "chatcmpl-1"}, nil
+	})
+	jobs := NewJobRunner(client, JobOptions{Webhook: WebhookOptions{Secret: secret, Backoff: time.Millisecond}})
+	defer jobs.Close()
+
+	id, err := jobs.SubmitCompletionWithWebhook(context.Background(), ChatCompletionRequest{}, server.URL+"/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-delivered:
+		if n.JobID != id || n.Status != JobSucceeded || n.Response.ID != "chatcmpl-1" {
+			t.Errorf("notification = %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	if calls != 2 {
+		t.Errorf("webhook called %d times, want 2", calls)
+	}
+
+	if _, err := jobs.SubmitCompletionWithWebhook(context.Background(), ChatCompletionRequest{}, "ftp://example.com"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("SubmitCompletionWithWebhook() with an ftp URL = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// TestJobWebhookRejected tests that client errors are not retried
+func TestJobWebhookRejected(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	failed := make(chan error, 1)
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return nil, errors.New("worker crashed")
+	})
+	jobs := NewJobRunner(client, JobOptions{Webhook: WebhookOptions{Backoff: time.Millisecond, OnError: func(jobID string, err error) {
+		failed <- err
+	}}})
+	defer jobs.Close()
+
+	if _, err := jobs.SubmitCompletionWithWebhook(context.Background(), ChatCompletionRequest{}, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failed:
+		if !strings.Contains(err.Error(), "400") || calls != 1 {
+			t.Errorf("OnError(%v) after %d calls", err, calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError not called")
+	}
+}
+
+// TestJobWebhookClosed tests that Close stops retries and waits for the
+// delivery to give up
+func TestJobWebhookClosed(t *testing.T) {
+	attempted := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case attempted <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var failed error
+	client := funcClient(func(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+		return &ChatCompletionResponse{}, nil
+	})
+	jobs := NewJobRunner(client, JobOptions{Webhook: WebhookOptions{Backoff: time.Hour, OnError: func(jobID string, err error) {
+		failed = err
+	}}})
+	if _, err := jobs.SubmitCompletionWithWebhook(context.Background(), ChatCompletionRequest{}, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-attempted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		jobs.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the retry")
+	}
+	if failed == nil || !strings.HasPrefix(failed.Error(), "attempt 1:") {
+		t.Errorf("OnError(%v), want the first attempt to fail", failed)
+	}
+}
+
+// TestVerifyWebhookSignature tests rejecting tampered and stale deliveries
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("s3cret")
+	body := []byte(`{"job_id":"job-1"}`)
+	header := signWebhook(secret, time.Now(), body)
+	if err := VerifyWebhookSignature(secret, header, body, time.Minute); err != nil {
+		t.Errorf("VerifyWebhookSignature() error: %v", err)
+	}
+	stale := signWebhook(secret, time.Now().Add(-time.Hour), body)
+	for name, err := range map[string]error{
+		"tampered body": VerifyWebhookSignature(secret, header, []byte(`{"job_id":"job-2"}`), time.Minute),
+		"wrong secret":  VerifyWebhookSignature([]byte("other"), header, body, time.Minute),
+		"stale":         VerifyWebhookSignature(secret, stale, body, time.Minute),
+		"malformed":     VerifyWebhookSignature(secret, "v1=abc", body, time.Minute),
+	} {
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: VerifyWebhookSignature() = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+	if err := VerifyWebhookSignature(secret, stale, body, 0); err != nil {
+		t.Errorf("VerifyWebhookSignature() without a tolerance = %v", err)
+	}
+}
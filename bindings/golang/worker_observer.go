@@ -0,0 +1,32 @@
+// Package smg provides a Go SDK for SMG (Shepherd Model Gateway) gRPC API.
+//
+// This file lets callers learn which worker served a request.
+package smg
+
+import "context"
+
+type workerObserverKey struct{}
+
+// WithWorkerObserver returns a context whose chat and completion calls report
+// the endpoint of the worker chosen to serve them to observe, e.g. for access
+// logs. observe is called once per call, when the request is sent.
+//
+// Example:
+//
+//	var worker string
+//	ctx := smg.WithWorkerObserver(ctx, func(endpoint string) { worker = endpoint })
+//	resp, err := client.CreateChatCompletion(ctx, req)
+func WithWorkerObserver(ctx context.Context, observe func(endpoint string)) context.Context {
+	if observe == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, workerObserverKey{}, observe)
+}
+
+// observeWorker reports endpoint to the observer set by WithWorkerObserver,
+// if any
+func observeWorker(ctx context.Context, endpoint string) {
+	if observe, ok := ctx.Value(workerObserverKey{}).(func(string)); ok && endpoint != "" {
+		observe(endpoint)
+	}
+}
@@ -0,0 +1,26 @@
+package smg
+
+import (
+	"context"
+	"testing"
+)
+
+// TestWithWorkerObserver tests that observed endpoints reach the observer
+func TestWithWorkerObserver(t *testing.T) {
+	var got []string
+	ctx := WithWorkerObserver(context.Background(), func(endpoint string) {
+		got = append(got, endpoint)
+	})
+
+	observeWorker(ctx, "grpc://worker-1:20000")
+	observeWorker(ctx, "")
+	if len(got) != 1 || got[0] != "grpc://worker-1:20000" {
+		t.Errorf("observed %v, want [grpc://worker-1:20000]", got)
+	}
+
+	// Contexts without an observer, or with a nil one, are left alone
+	observeWorker(context.Background(), "grpc://worker-1:20000")
+	if ctx := WithWorkerObserver(context.Background(), nil); ctx != context.Background() {
+		t.Error("WithWorkerObserver() with nil observer should return ctx unchanged")
+	}
+}
@@ -0,0 +1,247 @@
+package smg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// drainPollInterval is how often DrainWorker checks a worker's load
+const drainPollInterval = 100 * time.Millisecond
+
+// ErrWorkerNotFound is matched, with errors.Is, by the error the ByEndpoint
+// worker methods return when no worker has the endpoint, e.g. because it was
+// removed concurrently.
+var ErrWorkerNotFound = errors.New("worker not found")
+
+// WorkerStatus describes a worker of a MultiClient.
+type WorkerStatus struct {
+	// Index is the worker's position, as used by SetWorkerHealth,
+	// RemoveWorker, and DrainWorker. It changes as workers are removed;
+	// use the ByEndpoint methods to act on a worker found in a listing.
+	Index    int    `json:"index"`
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	// Load is the number of requests in flight on the worker
+	Load              int `json:"load"`
+	ProcessedRequests int `json:"processed_requests"`
+}
+
+// Workers returns the status of every worker, in worker order.
+func (c *MultiClient) Workers() ([]WorkerStatus, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ffiClient == nil {
+		return nil, errors.New("multi-worker client is closed")
+	}
+	resultJSON, err := c.ffiClient.WorkersJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workers: %w", err)
+	}
+	return parseWorkers(resultJSON)
+}
+
+// AddWorker connects to a new worker and adds it to the pool, so that it
+// starts receiving requests. The worker gets the next index; existing indices
+// are unchanged.
+//
+// Returns an error matching ErrInvalidRequest if endpoint is empty or already
+// in the pool.
+func (c *MultiClient) AddWorker(endpoint string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ffiClient == nil {
+		return errors.New("multi-worker client is closed")
+	}
+	return classify(c.ffiClient.AddWorker(endpoint))
+}
+
+// RemoveWorker removes a worker from the pool by index. Requests already sent
+// to the worker run to completion; call DrainWorker first to wait for them.
+// Workers after it move down one index.
+//
+// Returns an error matching ErrInvalidRequest if the index is out of range.
+func (c *MultiClient) RemoveWorker(workerIndex int) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ffiClient == nil {
+		return errors.New("multi-worker client is closed")
+	}
+	if workerIndex < 0 {
+		return invalidRequest(fmt.Sprintf("worker index %d out of range", workerIndex))
+	}
+	return classify(c.ffiClient.RemoveWorker(workerIndex))
+}
+
+// RemoveWorkerByEndpoint removes the worker with endpoint from the pool,
+// like RemoveWorker. The worker is looked up and removed under one lock, so
+// workers added or removed concurrently cannot make it remove another.
+//
+// Returns an error matching ErrWorkerNotFound if no worker has endpoint.
+func (c *MultiClient) RemoveWorkerByEndpoint(endpoint string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ffiClient == nil {
+		return errors.New("multi-worker client is closed")
+	}
+	return workerError(endpoint, c.ffiClient.RemoveWorkerByEndpoint(endpoint))
+}
+
+// SetWorkerHealthByEndpoint marks the worker with endpoint as healthy or
+// unhealthy, like SetWorkerHealth, looking it up under the same lock.
+//
+// Returns an error matching ErrWorkerNotFound if no worker has endpoint.
+func (c *MultiClient) SetWorkerHealthByEndpoint(endpoint string, healthy bool) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ffiClient == nil {
+		return errors.New("multi-worker client is closed")
+	}
+	return workerError(endpoint, c.ffiClient.SetWorkerHealthByEndpoint(endpoint, healthy))
+}
+
+// workerError converts the error of an FFI call on the worker with endpoint,
+// which fails with an invalid argument only if there is no such worker
+func workerError(endpoint string, err error) error {
+	var ffiErr *ffi.Error
+	if errors.As(err, &ffiErr) && ffiErr.Code == ffi.ErrorInvalidArgument {
+		return fmt.Errorf("%w: %s", ErrWorkerNotFound, endpoint)
+	}
+	return classify(err)
+}
+
+// SetWorkers changes the pool to exactly endpoints, e.g. after a
+// configuration reload: workers not listed are removed and new endpoints are
+// added, while workers in both keep their state. Removed workers finish the
+// requests already sent to them. It returns the endpoints added and removed.
+//
+// Changes are applied one worker at a time; if one fails, the changes made
+// so far are kept and the error is returned. Returns an error matching
+// ErrInvalidRequest if endpoints is empty.
+func (c *MultiClient) SetWorkers(endpoints []string) (added, removed []string, err error) {
+	if len(endpoints) == 0 {
+		return nil, nil, invalidRequest("at least one worker endpoint is required")
+	}
+	workers, err := c.Workers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	add, remove := diffWorkers(workers, endpoints)
+	// Add before removing so that the pool never runs empty
+	for _, endpoint := range add {
+		if err := c.AddWorker(endpoint); err != nil {
+			return added, removed, fmt.Errorf("failed to add worker %s: %w", endpoint, err)
+		}
+		added = append(added, endpoint)
+	}
+	for _, worker := range remove {
+		if err := c.RemoveWorkerByEndpoint(worker.Endpoint); err != nil {
+			if errors.Is(err, ErrWorkerNotFound) {
+				// Removed concurrently
+				continue
+			}
+			return added, removed, fmt.Errorf("failed to remove worker %s: %w", worker.Endpoint, err)
+		}
+		removed = append(removed, worker.Endpoint)
+	}
+	return added, removed, nil
+}
+
+// diffWorkers returns the endpoints missing from workers and the workers,
+// in index order, whose endpoints are not listed
+func diffWorkers(workers []WorkerStatus, endpoints []string) (add []string, remove []WorkerStatus) {
+	wanted := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if wanted[endpoint] {
+			continue
+		}
+		wanted[endpoint] = true
+		if _, ok := findWorker(workers, endpoint); !ok {
+			add = append(add, endpoint)
+		}
+	}
+	for _, worker := range workers {
+		if !wanted[worker.Endpoint] {
+			remove = append(remove, worker)
+		}
+	}
+	return add, remove
+}
+
+// DrainWorker marks a worker unhealthy so that it gets no new requests, then
+// waits until its in-flight requests finish or ctx is done. The worker stays
+// in the pool; remove it with RemoveWorker or return it to service with
+// SetWorkerHealth.
+//
+// The worker is tracked by endpoint while draining, so indices shifting due
+// to concurrent removals do not matter. Returns an error matching
+// ErrInvalidRequest if the index is out of range.
+func (c *MultiClient) DrainWorker(ctx context.Context, workerIndex int) error {
+	workers, err := c.Workers()
+	if err != nil {
+		return err
+	}
+	if workerIndex < 0 || workerIndex >= len(workers) {
+		return invalidRequest(fmt.Sprintf("worker index %d out of range (%d workers)", workerIndex, len(workers)))
+	}
+	return c.DrainWorkerByEndpoint(ctx, workers[workerIndex].Endpoint)
+}
+
+// DrainWorkerByEndpoint drains the worker with endpoint, like DrainWorker.
+//
+// Returns an error matching ErrWorkerNotFound if no worker has endpoint.
+func (c *MultiClient) DrainWorkerByEndpoint(ctx context.Context, endpoint string) error {
+	if err := c.SetWorkerHealthByEndpoint(endpoint, false); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		workers, err := c.Workers()
+		if err != nil {
+			return err
+		}
+		worker, ok := findWorker(workers, endpoint)
+		if !ok || worker.Load == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("worker %s still has %d requests in flight: %w", endpoint, worker.Load, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseWorkers decodes the worker list returned by the FFI layer
+func parseWorkers(resultJSON string) ([]WorkerStatus, error) {
+	var workers []WorkerStatus
+	if err := json.Unmarshal([]byte(resultJSON), &workers); err != nil {
+		return nil, fmt.Errorf("failed to parse workers: %w", err)
+	}
+	for i := range workers {
+		workers[i].Index = i
+	}
+	return workers, nil
+}
+
+// findWorker returns the worker with the given endpoint
+func findWorker(workers []WorkerStatus, endpoint string) (WorkerStatus, bool) {
+	for _, worker := range workers {
+		if worker.Endpoint == endpoint {
+			return worker, true
+		}
+	}
+	return WorkerStatus{}, false
+}
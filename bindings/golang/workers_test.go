@@ -0,0 +1,87 @@
+package smg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lightseek/smg/go-grpc-sdk/internal/ffi"
+)
+
+// TestParseWorkers tests decoding of the FFI worker list and index assignment
+func TestParseWorkers(t *testing.T) {
+	resultJSON := `[
+		{"endpoint": "grpc://a:1", "healthy": true, "load": 2, "processed_requests": 10},
+		{"endpoint": "grpc://b:1", "healthy": false, "load": 0, "processed_requests": 3}
+	]`
+
+	workers, err := parseWorkers(resultJSON)
+	if err != nil {
+		t.Fatalf("parseWorkers() error: %v", err)
+	}
+	want := []WorkerStatus{
+		{Index: 0, Endpoint: "grpc://a:1", Healthy: true, Load: 2, ProcessedRequests: 10},
+		{Index: 1, Endpoint: "grpc://b:1", Healthy: false, Load: 0, ProcessedRequests: 3},
+	}
+	if len(workers) != len(want) {
+		t.Fatalf("parseWorkers() returned %d workers, want %d", len(workers), len(want))
+	}
+	for i := range want {
+		if workers[i] != want[i] {
+			t.Errorf("workers[%d] = %+v, want %+v", i, workers[i], want[i])
+		}
+	}
+
+	if worker, ok := findWorker(workers, "grpc://b:1"); !ok || worker.Index != 1 {
+		t.Errorf("findWorker(grpc://b:1) = %+v, %v", worker, ok)
+	}
+	if _, ok := findWorker(workers, "grpc://c:1"); ok {
+		t.Error("findWorker() found a worker not in the list")
+	}
+
+	if _, err := parseWorkers("not json"); err == nil {
+		t.Error("parseWorkers() with invalid JSON should fail")
+	}
+}
+
+// TestDiffWorkers tests which workers SetWorkers adds and removes
+func TestDiffWorkers(t *testing.T) {
+	workers := []WorkerStatus{
+		{Index: 0, Endpoint: "grpc://a:1"},
+		{Index: 1, Endpoint: "grpc://b:1"},
+		{Index: 2, Endpoint: "grpc://c:1"},
+	}
+
+	add, remove := diffWorkers(workers, []string{"grpc://c:1", "grpc://d:1", "grpc://a:1", "grpc://d:1"})
+	if len(add) != 1 || add[0] != "grpc://d:1" {
+		t.Errorf("add = %v, want [grpc://d:1]", add)
+	}
+	if len(remove) != 1 || remove[0] != workers[1] {
+		t.Errorf("remove = %+v, want [%+v]", remove, workers[1])
+	}
+
+	add, remove = diffWorkers(workers, []string{"grpc://a:1", "grpc://b:1", "grpc://c:1"})
+	if len(add) != 0 || len(remove) != 0 {
+		t.Errorf("unchanged pool: add = %v, remove = %+v", add, remove)
+	}
+
+	_, remove = diffWorkers(workers, []string{"grpc://z:1"})
+	if len(remove) != 3 || remove[0].Index != 0 || remove[2].Index != 2 {
+		t.Errorf("remove = %+v, want all workers in index order", remove)
+	}
+}
+
+// TestWorkerError tests that a worker missing from the pool is reported as
+// not found and other errors are classified as usual
+func TestWorkerError(t *testing.T) {
+	err := workerError("grpc://a:1", &ffi.Error{Code: ffi.ErrorInvalidArgument, Message: "Worker grpc://a:1 not found"})
+	if !errors.Is(err, ErrWorkerNotFound) || err.Error() != "worker not found: grpc://a:1" {
+		t.Errorf("workerError(invalid argument) = %v, want ErrWorkerNotFound", err)
+	}
+	err = workerError("grpc://a:1", &ffi.Error{Code: ffi.ErrorNoHealthyWorkers})
+	if errors.Is(err, ErrWorkerNotFound) || !errors.Is(err, ErrNoHealthyWorkers) {
+		t.Errorf("workerError(no healthy workers) = %v", err)
+	}
+	if err := workerError("grpc://a:1", nil); err != nil {
+		t.Errorf("workerError(nil) = %v", err)
+	}
+}
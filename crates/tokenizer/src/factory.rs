@@ -6,6 +6,7 @@ use tracing::debug;
 use crate::{
     hub::download_tokenizer_from_hf,
     huggingface::HuggingFaceTokenizer,
+    sentencepiece::is_sentencepiece_file,
     tiktoken::{has_tiktoken_file, is_tiktoken_file, TiktokenTokenizer},
     traits,
 };
@@ -16,13 +17,16 @@ pub enum TokenizerType {
     HuggingFace(String),
     Mock,
     Tiktoken(String),
-    // Future: SentencePiece, GGUF
+    SentencePiece(String),
+    // Future: GGUF
 }
 
 /// Create a tokenizer from a file path to a tokenizer file.
 /// The file extension is used to determine the tokenizer type.
 /// Supported file types are:
 /// - json: HuggingFace tokenizer
+/// - tiktoken / tiktoken.model: tiktoken BPE ranks
+/// - model: SentencePiece model (Unigram or BPE)
 /// - For testing: can return mock tokenizer
 pub fn create_tokenizer_from_file(file_path: &str) -> Result<Arc<dyn traits::Tokenizer>> {
     create_tokenizer_with_chat_template(file_path, None)
@@ -90,6 +94,19 @@ pub fn create_tokenizer_with_chat_template(
             )?));
         }
 
+        // Priority 4: SentencePiece tokenizer.model
+        let sentencepiece_model = path.join("tokenizer.model");
+        if is_sentencepiece_file(&sentencepiece_model) {
+            let final_chat_template =
+                resolve_and_log_chat_template(chat_template_path, path, file_path);
+            return Ok(Arc::new(
+                HuggingFaceTokenizer::from_sentencepiece_file_with_chat_template(
+                    &sentencepiece_model,
+                    final_chat_template.as_deref(),
+                )?,
+            ));
+        }
+
         // Preserve the specific validation error for vocab + merges layouts
         // when there is no supported tokenizer to fall back to.
         if has_vocab_and_merges {
@@ -104,7 +121,7 @@ pub fn create_tokenizer_with_chat_template(
         }
 
         return Err(Error::msg(format!(
-            "Directory '{file_path}' does not contain a valid tokenizer file (tokenizer.json, tiktoken.model, *.tiktoken, or vocab.json)"
+            "Directory '{file_path}' does not contain a valid tokenizer file (tokenizer.json, tiktoken.model, *.tiktoken, tokenizer.model, or vocab.json)"
         )));
     }
 
@@ -128,8 +145,17 @@ pub fn create_tokenizer_with_chat_template(
                     path,
                     chat_template_path,
                 )?) as Arc<dyn traits::Tokenizer>)
+            } else if is_sentencepiece_file(path) {
+                Ok(Arc::new(
+                    HuggingFaceTokenizer::from_sentencepiece_file_with_chat_template(
+                        path,
+                        chat_template_path,
+                    )?,
+                ) as Arc<dyn traits::Tokenizer>)
             } else {
-                Err(Error::msg("SentencePiece models not yet supported"))
+                Err(Error::msg(format!(
+                    "File '{file_path}' is neither a tiktoken nor a SentencePiece model"
+                )))
             }
         }
         Some("gguf") => {
@@ -177,10 +203,10 @@ fn auto_detect_tokenizer(file_path: &str) -> Result<Arc<dyn traits::Tokenizer>>
     }
 
     // Check for SentencePiece model
-    if is_likely_sentencepiece(&buffer) {
-        return Err(Error::msg(
-            "SentencePiece model detected but not yet supported",
-        ));
+    if is_likely_sentencepiece(&buffer) && is_sentencepiece_file(Path::new(file_path)) {
+        return Ok(Arc::new(HuggingFaceTokenizer::from_sentencepiece_file(
+            Path::new(file_path),
+        )?));
     }
 
     Err(Error::msg(format!(
@@ -503,6 +529,10 @@ pub fn get_tokenizer_info(file_path: &str) -> Result<TokenizerType> {
 
     match extension.as_deref() {
         Some("json") => Ok(TokenizerType::HuggingFace(file_path.to_string())),
+        _ if is_tiktoken_file(path) => Ok(TokenizerType::Tiktoken(file_path.to_string())),
+        _ if is_sentencepiece_file(path) => {
+            Ok(TokenizerType::SentencePiece(file_path.to_string()))
+        }
         _ => {
             // Try auto-detection
             use std::{fs::File, io::Read};
@@ -104,6 +104,26 @@ impl HuggingFaceTokenizer {
         Self::from_built_tokenizer(tokenizer, &logical_tokenizer_path, chat_template_path)
     }
 
+    /// Create a tokenizer from a SentencePiece `.model` file. Config files
+    /// (tokenizer_config.json, generation_config.json) are read from the same
+    /// directory, as for tokenizer.json.
+    pub fn from_sentencepiece_file(file_path: &Path) -> Result<Self> {
+        let chat_template_path = file_path
+            .parent()
+            .and_then(crate::factory::discover_chat_template_in_dir);
+        Self::from_sentencepiece_file_with_chat_template(file_path, chat_template_path.as_deref())
+    }
+
+    /// Create a tokenizer from a SentencePiece `.model` file with an optional
+    /// explicit chat template.
+    pub fn from_sentencepiece_file_with_chat_template(
+        file_path: &Path,
+        chat_template_path: Option<&str>,
+    ) -> Result<Self> {
+        let tokenizer = crate::sentencepiece::load_sentencepiece_model(file_path)?;
+        Self::from_built_tokenizer(tokenizer, file_path, chat_template_path)
+    }
+
     fn build_qwen2_bpe_tokenizer(dir: &Path) -> Result<HfTokenizer> {
         let vocab_path = dir.join("vocab.json");
         let merges_path = dir.join("merges.txt");
@@ -10,6 +10,7 @@ pub mod hub;
 pub(crate) mod json_dumps;
 pub mod mock;
 pub mod registry;
+pub mod sentencepiece;
 pub mod sequence;
 pub mod stop;
 pub mod stream;
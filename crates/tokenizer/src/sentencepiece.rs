@@ -0,0 +1,455 @@
+//! SentencePiece `.model` support.
+//!
+//! SentencePiece models are serialized `ModelProto` protobuf messages. Rather
+//! than pulling in a protobuf runtime for a single message type, this module
+//! decodes the handful of fields needed to reproduce the model and converts it
+//! into an equivalent HuggingFace tokenizer, mirroring what `transformers`'
+//! slow-to-fast converters do for Llama/T5-style models.
+
+use std::{collections::HashMap, path::Path};
+
+use anyhow::{Error, Result};
+use base64::{engine::general_purpose::STANDARD, Engine};
+use serde_json::{json, Value};
+use tokenizers::tokenizer::Tokenizer as HfTokenizer;
+
+/// `SentencePiece.Type` values from sentencepiece_model.proto
+const PIECE_NORMAL: u64 = 1;
+const PIECE_UNKNOWN: u64 = 2;
+const PIECE_CONTROL: u64 = 3;
+const PIECE_USER_DEFINED: u64 = 4;
+
+/// `TrainerSpec.ModelType` values from sentencepiece_model.proto
+const MODEL_UNIGRAM: u64 = 1;
+const MODEL_BPE: u64 = 2;
+
+const METASPACE: &str = "\u{2581}";
+
+#[derive(Debug, Clone)]
+struct Piece {
+    piece: String,
+    score: f32,
+    kind: u64,
+}
+
+#[derive(Debug)]
+struct ModelProto {
+    pieces: Vec<Piece>,
+    model_type: u64,
+    byte_fallback: bool,
+    split_by_whitespace: bool,
+    unk_id: i32,
+    add_dummy_prefix: bool,
+    remove_extra_whitespaces: bool,
+    precompiled_charsmap: Vec<u8>,
+}
+
+impl Default for ModelProto {
+    /// Field defaults as declared in sentencepiece_model.proto
+    fn default() -> Self {
+        Self {
+            pieces: Vec::new(),
+            model_type: MODEL_UNIGRAM,
+            byte_fallback: false,
+            split_by_whitespace: true,
+            unk_id: 0,
+            add_dummy_prefix: true,
+            remove_extra_whitespaces: true,
+            precompiled_charsmap: Vec::new(),
+        }
+    }
+}
+
+/// Minimal protobuf wire-format reader
+struct Reader<'a> {
+    buf: &'a [u8],
+    pos: usize,
+}
+
+enum Field<'a> {
+    Varint(u64),
+    Fixed32(u32),
+    Bytes(&'a [u8]),
+    Other,
+}
+
+impl<'a> Reader<'a> {
+    fn new(buf: &'a [u8]) -> Self {
+        Self { buf, pos: 0 }
+    }
+
+    fn varint(&mut self) -> Result<u64> {
+        let mut value = 0u64;
+        for shift in (0..64).step_by(7) {
+            let byte = *self
+                .buf
+                .get(self.pos)
+                .ok_or_else(|| Error::msg("truncated varint"))?;
+            self.pos += 1;
+            value |= u64::from(byte & 0x7f) << shift;
+            if byte & 0x80 == 0 {
+                return Ok(value);
+            }
+        }
+        Err(Error::msg("varint too long"))
+    }
+
+    fn take(&mut self, len: usize) -> Result<&'a [u8]> {
+        let end = self
+            .pos
+            .checked_add(len)
+            .filter(|&end| end <= self.buf.len())
+            .ok_or_else(|| Error::msg("truncated field"))?;
+        let bytes = &self.buf[self.pos..end];
+        self.pos = end;
+        Ok(bytes)
+    }
+
+    /// Read the next field, returning `None` at the end of the buffer
+    fn next(&mut self) -> Result<Option<(u64, Field<'a>)>> {
+        if self.pos >= self.buf.len() {
+            return Ok(None);
+        }
+        let key = self.varint()?;
+        let field = match key & 0x7 {
+            0 => Field::Varint(self.varint()?),
+            1 => {
+                self.take(8)?;
+                Field::Other
+            }
+            2 => {
+                let len = usize::try_from(self.varint()?)?;
+                Field::Bytes(self.take(len)?)
+            }
+            5 => {
+                let bytes = self.take(4)?;
+                Field::Fixed32(u32::from_le_bytes([bytes[0], bytes[1], bytes[2], bytes[3]]))
+            }
+            wire => return Err(Error::msg(format!("unsupported wire type {wire}"))),
+        };
+        Ok(Some((key >> 3, field)))
+    }
+}
+
+fn parse_piece(buf: &[u8]) -> Result<Piece> {
+    let mut piece = Piece {
+        piece: String::new(),
+        score: 0.0,
+        kind: PIECE_NORMAL,
+    };
+    let mut reader = Reader::new(buf);
+    while let Some((number, field)) = reader.next()? {
+        match (number, field) {
+            (1, Field::Bytes(b)) => piece.piece = String::from_utf8(b.to_vec())?,
+            (2, Field::Fixed32(bits)) => piece.score = f32::from_bits(bits),
+            (3, Field::Varint(v)) => piece.kind = v,
+            _ => {}
+        }
+    }
+    Ok(piece)
+}
+
+fn parse_model(buf: &[u8]) -> Result<ModelProto> {
+    let mut model = ModelProto::default();
+    let mut reader = Reader::new(buf);
+    while let Some((number, field)) = reader.next()? {
+        match (number, field) {
+            (1, Field::Bytes(b)) => model.pieces.push(parse_piece(b)?),
+            (2, Field::Bytes(b)) => {
+                // TrainerSpec
+                let mut spec = Reader::new(b);
+                while let Some((number, field)) = spec.next()? {
+                    match (number, field) {
+                        (3, Field::Varint(v)) => model.model_type = v,
+                        (22, Field::Varint(v)) => model.split_by_whitespace = v != 0,
+                        (35, Field::Varint(v)) => model.byte_fallback = v != 0,
+                        // int32 fields are sign-extended to 64 bits on the wire
+                        (40, Field::Varint(v)) => model.unk_id = v as i64 as i32,
+                        _ => {}
+                    }
+                }
+            }
+            (3, Field::Bytes(b)) => {
+                // NormalizerSpec
+                let mut spec = Reader::new(b);
+                while let Some((number, field)) = spec.next()? {
+                    match (number, field) {
+                        (2, Field::Bytes(b)) => model.precompiled_charsmap = b.to_vec(),
+                        (3, Field::Varint(v)) => model.add_dummy_prefix = v != 0,
+                        (4, Field::Varint(v)) => model.remove_extra_whitespaces = v != 0,
+                        _ => {}
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+    if model.pieces.is_empty() {
+        return Err(Error::msg("SentencePiece model contains no pieces"));
+    }
+    Ok(model)
+}
+
+/// Derive BPE merges from the vocabulary, as SentencePiece BPE models do not
+/// store them. Every split of a piece into two in-vocabulary halves becomes a
+/// merge, ranked by the merged piece's score.
+fn extract_merges(pieces: &[Piece], vocab: &HashMap<&str, usize>) -> Vec<(String, String)> {
+    let mut merges: Vec<(f32, usize, usize, String, String)> = Vec::new();
+    for piece in pieces.iter().filter(|p| p.kind == PIECE_NORMAL) {
+        for (split, _) in piece.piece.char_indices().skip(1) {
+            let (left, right) = piece.piece.split_at(split);
+            if let (Some(&l), Some(&r)) = (vocab.get(left), vocab.get(right)) {
+                merges.push((piece.score, l, r, left.to_string(), right.to_string()));
+            }
+        }
+    }
+    merges.sort_by(|a, b| b.0.total_cmp(&a.0).then(a.1.cmp(&b.1)).then(a.2.cmp(&b.2)));
+    merges
+        .into_iter()
+        .map(|(_, _, _, left, right)| (left, right))
+        .collect()
+}
+
+/// Build the tokenizer.json representation of a SentencePiece model
+fn to_tokenizer_json(model: &ModelProto) -> Result<Value> {
+    let unk_id = usize::try_from(model.unk_id)
+        .ok()
+        .filter(|&id| id < model.pieces.len());
+
+    let model_json = match model.model_type {
+        MODEL_UNIGRAM => {
+            let vocab: Vec<Value> = model
+                .pieces
+                .iter()
+                .map(|p| json!([p.piece, f64::from(p.score)]))
+                .collect();
+            json!({
+                "type": "Unigram",
+                "unk_id": unk_id,
+                "vocab": vocab,
+                "byte_fallback": model.byte_fallback,
+            })
+        }
+        MODEL_BPE => {
+            let index: HashMap<&str, usize> = model
+                .pieces
+                .iter()
+                .enumerate()
+                .map(|(id, p)| (p.piece.as_str(), id))
+                .collect();
+            let vocab: serde_json::Map<String, Value> = model
+                .pieces
+                .iter()
+                .enumerate()
+                .map(|(id, p)| (p.piece.clone(), json!(id)))
+                .collect();
+            let merges: Vec<Value> = extract_merges(&model.pieces, &index)
+                .into_iter()
+                .map(|(left, right)| json!([left, right]))
+                .collect();
+            json!({
+                "type": "BPE",
+                "dropout": null,
+                "unk_token": unk_id.map(|id| model.pieces[id].piece.clone()),
+                "continuing_subword_prefix": null,
+                "end_of_word_suffix": null,
+                "fuse_unk": true,
+                "byte_fallback": model.byte_fallback,
+                "ignore_merges": false,
+                "vocab": vocab,
+                "merges": merges,
+            })
+        }
+        other => {
+            return Err(Error::msg(format!(
+                "Unsupported SentencePiece model type {other} (only Unigram and BPE are supported)"
+            )))
+        }
+    };
+
+    let added_tokens: Vec<Value> = model
+        .pieces
+        .iter()
+        .enumerate()
+        .filter(|(_, p)| matches!(p.kind, PIECE_UNKNOWN | PIECE_CONTROL | PIECE_USER_DEFINED))
+        .map(|(id, p)| {
+            json!({
+                "id": id,
+                "content": p.piece,
+                "single_word": false,
+                "lstrip": false,
+                "rstrip": false,
+                "normalized": false,
+                "special": p.kind != PIECE_USER_DEFINED,
+            })
+        })
+        .collect();
+
+    let mut normalizers = Vec::new();
+    if !model.precompiled_charsmap.is_empty() {
+        normalizers.push(json!({
+            "type": "Precompiled",
+            "precompiled_charsmap": STANDARD.encode(&model.precompiled_charsmap),
+        }));
+    }
+    if model.remove_extra_whitespaces {
+        normalizers.push(json!({
+            "type": "Replace",
+            "pattern": {"Regex": " {2,}"},
+            "content": " ",
+        }));
+    }
+    let normalizer = if normalizers.is_empty() {
+        Value::Null
+    } else {
+        json!({"type": "Sequence", "normalizers": normalizers})
+    };
+
+    let prepend_scheme = if model.add_dummy_prefix {
+        "first"
+    } else {
+        "never"
+    };
+    let metaspace = json!({
+        "type": "Metaspace",
+        "replacement": METASPACE,
+        "prepend_scheme": prepend_scheme,
+        "split": model.split_by_whitespace,
+    });
+
+    let mut decoders = Vec::new();
+    if model.byte_fallback {
+        decoders.push(json!({"type": "ByteFallback"}));
+    }
+    decoders.push(json!({"type": "Fuse"}));
+    decoders.push(metaspace.clone());
+
+    Ok(json!({
+        "version": "1.0",
+        "truncation": null,
+        "padding": null,
+        "added_tokens": added_tokens,
+        "normalizer": normalizer,
+        "pre_tokenizer": metaspace,
+        "post_processor": null,
+        "decoder": {"type": "Sequence", "decoders": decoders},
+        "model": model_json,
+    }))
+}
+
+/// Check whether a file looks like a serialized SentencePiece `ModelProto`.
+///
+/// The first field of every SentencePiece model is a length-delimited piece
+/// (field 1, wire type 2), which text formats such as tiktoken never start with.
+pub fn is_sentencepiece_file(path: &Path) -> bool {
+    use std::io::Read;
+
+    let mut header = [0u8; 1];
+    std::fs::File::open(path)
+        .and_then(|mut f| f.read_exact(&mut header))
+        .map(|()| header[0] == 0x0a)
+        .unwrap_or(false)
+}
+
+/// Load a SentencePiece `.model` file as a HuggingFace tokenizer
+pub fn load_sentencepiece_model(path: &Path) -> Result<HfTokenizer> {
+    let bytes = std::fs::read(path).map_err(|e| {
+        Error::msg(format!(
+            "Failed to read SentencePiece model {}: {e}",
+            path.display()
+        ))
+    })?;
+    build_tokenizer(&bytes)
+        .map_err(|e| Error::msg(format!("Invalid SentencePiece model {}: {e}", path.display())))
+}
+
+fn build_tokenizer(bytes: &[u8]) -> Result<HfTokenizer> {
+    let model = parse_model(bytes)?;
+    let tokenizer_json = to_tokenizer_json(&model)?;
+    HfTokenizer::from_bytes(serde_json::to_vec(&tokenizer_json)?)
+        .map_err(|e| Error::msg(format!("Failed to build tokenizer: {e}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn varint(mut v: u64, out: &mut Vec<u8>) {
+        while v >= 0x80 {
+            out.push((v as u8) | 0x80);
+            v >>= 7;
+        }
+        out.push(v as u8);
+    }
+
+    fn bytes_field(number: u64, payload: &[u8], out: &mut Vec<u8>) {
+        varint(number << 3 | 2, out);
+        varint(payload.len() as u64, out);
+        out.extend_from_slice(payload);
+    }
+
+    fn varint_field(number: u64, value: u64, out: &mut Vec<u8>) {
+        varint(number << 3, out);
+        varint(value, out);
+    }
+
+    fn piece(text: &str, score: f32, kind: u64) -> Vec<u8> {
+        let mut out = Vec::new();
+        bytes_field(1, text.as_bytes(), &mut out);
+        varint(2 << 3 | 5, &mut out);
+        out.extend_from_slice(&score.to_le_bytes());
+        varint_field(3, kind, &mut out);
+        out
+    }
+
+    fn bpe_model() -> Vec<u8> {
+        let pieces = [
+            ("<unk>", 0.0, PIECE_UNKNOWN),
+            ("<s>", 0.0, PIECE_CONTROL),
+            ("</s>", 0.0, PIECE_CONTROL),
+            ("\u{2581}h", -1.0, PIECE_NORMAL),
+            ("\u{2581}hi", -2.0, PIECE_NORMAL),
+            ("\u{2581}", -3.0, PIECE_NORMAL),
+            ("h", -4.0, PIECE_NORMAL),
+            ("i", -5.0, PIECE_NORMAL),
+        ];
+        let mut out = Vec::new();
+        for (text, score, kind) in pieces {
+            bytes_field(1, &piece(text, score, kind), &mut out);
+        }
+        let mut trainer = Vec::new();
+        varint_field(3, MODEL_BPE, &mut trainer);
+        bytes_field(2, &trainer, &mut out);
+        let mut normalizer = Vec::new();
+        varint_field(4, 0, &mut normalizer);
+        bytes_field(3, &normalizer, &mut out);
+        out
+    }
+
+    #[test]
+    fn test_parse_model() {
+        let model = parse_model(&bpe_model()).unwrap();
+        assert_eq!(model.pieces.len(), 8);
+        assert_eq!(model.model_type, MODEL_BPE);
+        assert_eq!(model.unk_id, 0);
+        assert!(model.add_dummy_prefix);
+        assert!(!model.remove_extra_whitespaces);
+        assert_eq!(model.pieces[1].kind, PIECE_CONTROL);
+        assert_eq!(model.pieces[4].score, -2.0);
+    }
+
+    #[test]
+    fn test_bpe_round_trip() {
+        let tokenizer = build_tokenizer(&bpe_model()).unwrap();
+        let encoding = tokenizer.encode("hi hi", false).unwrap();
+        assert_eq!(encoding.get_ids(), &[4, 4]);
+        assert_eq!(tokenizer.decode(encoding.get_ids(), false).unwrap(), "hi hi");
+        assert_eq!(tokenizer.token_to_id("<s>"), Some(1));
+    }
+
+    #[test]
+    fn test_rejects_garbage() {
+        assert!(parse_model(b"").is_err());
+        assert!(parse_model(b"\x0a\xff").is_err());
+    }
+}